@@ -0,0 +1,47 @@
+// fake-oauth 本地 fake OAuth 服务，用于无外网环境下联调第三方登录
+//
+//	go run ./cmd/fake-oauth -addr :9999 -email alice@example.com
+//
+// 启动 unit-auth 时将各提供者的基础地址指向该服务，例如：
+//
+//	GOOGLE_ACCOUNTS_BASE_URL=http://localhost:9999
+//	GOOGLE_OAUTH2_BASE_URL=http://localhost:9999
+//	GOOGLE_API_BASE_URL=http://localhost:9999
+package main
+
+import (
+	"flag"
+	"log"
+
+	"unit-auth/plugins/fakeprovider"
+)
+
+func main() {
+	addr := flag.String("addr", ":9999", "listen address")
+	baseURL := flag.String("base-url", "", "public base URL used as OIDC issuer prefix (default: derived from request host)")
+	id := flag.Int64("id", 10001, "fake user id")
+	login := flag.String("login", "fakeuser", "fake user login")
+	name := flag.String("name", "Fake User", "fake user display name")
+	email := flag.String("email", "fake@example.com", "fake user email")
+	verified := flag.Bool("email-verified", true, "whether the fake user's email is verified")
+	unionID := flag.String("unionid", "", "fake wechat unionid")
+	flag.Parse()
+
+	srv := fakeprovider.New()
+	srv.SetUser(fakeprovider.User{
+		ID:            *id,
+		Login:         *login,
+		Name:          *name,
+		Email:         *email,
+		EmailVerified: *verified,
+		UnionID:       *unionID,
+	})
+	if *baseURL != "" {
+		srv.SetBaseURL(*baseURL)
+	}
+
+	log.Printf("Fake OAuth server listening on %s (OIDC issuer: <base>/oidc)", *addr)
+	if err := srv.ListenAndServe(*addr); err != nil {
+		log.Fatalf("Fake OAuth server stopped: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+// fake-sms 本地 fake 短信服务，用于无外网环境下联调短信网关
+//
+//	go run ./cmd/fake-sms -addr :9998
+//
+// 启动 unit-auth 时将各服务商端点指向该服务，例如：
+//
+//	SMS_PROVIDERS=aliyun:3,tencent:1,twilio
+//	SMS_ALIYUN_ENDPOINT=http://localhost:9998/aliyun
+//	SMS_TENCENT_ENDPOINT=http://localhost:9998/tencent
+//	SMS_TWILIO_ENDPOINT=http://localhost:9998/twilio
+package main
+
+import (
+	"flag"
+	"log"
+
+	"unit-auth/services/smsfake"
+)
+
+func main() {
+	creds := smsfake.DefaultCredentials
+	addr := flag.String("addr", ":9998", "listen address")
+	flag.StringVar(&creds.AliyunAccessKeyID, "aliyun-key", creds.AliyunAccessKeyID, "aliyun access key id")
+	flag.StringVar(&creds.AliyunAccessKeySecret, "aliyun-secret", creds.AliyunAccessKeySecret, "aliyun access key secret")
+	flag.StringVar(&creds.TencentSecretID, "tencent-id", creds.TencentSecretID, "tencent cloud secret id")
+	flag.StringVar(&creds.TencentSecretKey, "tencent-key", creds.TencentSecretKey, "tencent cloud secret key")
+	flag.StringVar(&creds.TwilioAccountSID, "twilio-sid", creds.TwilioAccountSID, "twilio account sid")
+	flag.StringVar(&creds.TwilioAuthToken, "twilio-token", creds.TwilioAuthToken, "twilio auth token")
+	flag.Parse()
+
+	log.Printf("Fake SMS server listening on %s (/aliyun, /tencent, /twilio, /_fake/messages)", *addr)
+	if err := smsfake.New(creds).ListenAndServe(*addr); err != nil {
+		log.Fatalf("Fake SMS server stopped: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+// mail-selftest 检查发信域名认证配置：打印需要发布的 SPF / DKIM / DMARC 记录，并与已发布的 DNS 记录对比
+//
+//	go run ./cmd/mail-selftest                             # 检查 SMTP_FROM 域名与 MAIL_DKIM_KEYS 中的所有域名
+//	go run ./cmd/mail-selftest -gen-key dkim.pem -domain example.com -selector s1
+//	go run ./cmd/mail-selftest -send you@example.com       # 通过当前传输同步发送一封签名的测试邮件
+//
+// 读取与服务相同的 .env / 环境变量（SMTP_*、MAIL_TRANSPORT、MAIL_DKIM_KEYS 等）
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"unit-auth/config"
+	"unit-auth/utils"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+// spfIncludes 常见 SMTP 服务商的 SPF include
+var spfIncludes = map[string]string{
+	"smtp.163.com":             "include:spf.163.com",
+	"smtp.126.com":             "include:spf.163.com",
+	"smtp.yeah.net":            "include:spf.163.com",
+	"smtp.gmail.com":           "include:_spf.google.com",
+	"smtp.qq.com":              "include:spf.mail.qq.com",
+	"smtp.exmail.qq.com":       "include:spf.mail.qq.com",
+	"smtp.office365.com":       "include:spf.protection.outlook.com",
+	"smtpdm.aliyun.com":        "include:spfdm.aliyun.com",
+	"smtp.sendgrid.net":        "include:sendgrid.net",
+	"email-smtp.amazonaws.com": "include:amazonses.com",
+}
+
+func main() {
+	domain := flag.String("domain", "", "sender domain (default: domain of SMTP_FROM)")
+	selector := flag.String("selector", "default", "dkim selector used with -gen-key")
+	genKey := flag.String("gen-key", "", "generate a 2048-bit RSA dkim private key at this path")
+	sendTo := flag.String("send", "", "send a signed test email to this address")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+	config.Init()
+
+	if *domain == "" {
+		*domain = utils.EmailDomain(config.AppConfig.SMTPFrom)
+	}
+
+	if *genKey != "" {
+		if *domain == "" {
+			log.Fatal("-domain is required with -gen-key when SMTP_FROM is not set")
+		}
+		signer, err := generateKey(*genKey, *domain, *selector)
+		if err != nil {
+			log.Fatalf("Failed to generate dkim key: %v", err)
+		}
+		fmt.Printf("✅ 已生成私钥 %s\n", *genKey)
+		fmt.Printf("   配置: MAIL_DKIM_KEYS=%s:%s:%s\n\n", signer.Domain, signer.Selector, *genKey)
+		printDKIM(signer)
+		return
+	}
+
+	fmt.Printf("📮 传输: MAIL_TRANSPORT=%q  SMTP: %s:%d  发件人: %s\n\n",
+		config.AppConfig.MailTransport, config.AppConfig.SMTPHost, config.AppConfig.SMTPPort, config.AppConfig.SMTPFrom)
+
+	keyring := utils.LoadDKIMKeyring(config.AppConfig.MailDKIMKeys)
+	domains := map[string]bool{}
+	if *domain != "" {
+		domains[*domain] = true
+	}
+	for _, s := range keyring.Signers() {
+		domains[s.Domain] = true
+	}
+	if len(domains) == 0 {
+		log.Fatal("No sender domain: set SMTP_FROM, MAIL_DKIM_KEYS or -domain")
+	}
+	names := make([]string, 0, len(domains))
+	for d := range domains {
+		names = append(names, d)
+	}
+	sort.Strings(names)
+
+	for _, d := range names {
+		fmt.Printf("==================== %s ====================\n\n", d)
+		printSPF(d)
+		if signer := keyring.SignerFor("postmaster@" + d); signer != nil {
+			printDKIM(signer)
+		} else {
+			fmt.Printf("❌ DKIM: 未配置 %s 的私钥，邮件不会签名\n", d)
+			fmt.Printf("   生成: go run ./cmd/mail-selftest -gen-key dkim-%s.pem -domain %s -selector s1\n\n", d, d)
+		}
+		printDMARC(d)
+	}
+
+	if *sendTo != "" {
+		if err := sendTest(*sendTo); err != nil {
+			log.Fatalf("❌ 测试邮件发送失败: %v", err)
+		}
+		fmt.Printf("✅ 测试邮件已发送到 %s，请在收件箱查看原始邮件中的 Authentication-Results（spf / dkim / dmarc 均应为 pass）\n", *sendTo)
+	}
+}
+
+func generateKey(path, domain, selector string) (*utils.DKIMSigner, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, keyPEM, 0o600); err != nil {
+		return nil, err
+	}
+	return utils.NewDKIMSigner(domain, selector, keyPEM)
+}
+
+func printSPF(domain string) {
+	include, ok := spfIncludes[config.AppConfig.SMTPHost]
+	if !ok {
+		include = "a mx"
+	}
+	fmt.Println("SPF")
+	fmt.Printf("  %s TXT \"v=spf1 %s ~all\"\n", domain, include)
+	published := lookupTXT(domain, "v=spf1")
+	switch {
+	case published == "":
+		fmt.Println("  ❌ 未发布 SPF 记录")
+	case !ok || strings.Contains(published, include):
+		fmt.Printf("  ✅ 已发布: %s\n", published)
+	default:
+		fmt.Printf("  ⚠️  已发布但未包含 %s: %s\n", include, published)
+	}
+	fmt.Println()
+}
+
+func printDKIM(signer *utils.DKIMSigner) {
+	name, value, err := signer.DNSRecord()
+	if err != nil {
+		fmt.Printf("❌ DKIM: %v\n\n", err)
+		return
+	}
+	fmt.Printf("DKIM (%s)\n", signer.Algorithm())
+	fmt.Printf("  %s TXT \"%s\"\n", name, value)
+	if len(value) > 255 {
+		fmt.Println("  (超过 255 字符，部分 DNS 控制台需要拆成多个带引号的字符串)")
+	}
+	published := lookupTXT(name, "v=DKIM1")
+	switch {
+	case published == "":
+		fmt.Println("  ❌ 未发布 DKIM 记录")
+	case strings.ReplaceAll(published, " ", "") == strings.ReplaceAll(value, " ", ""):
+		fmt.Println("  ✅ 已发布且与私钥匹配")
+	default:
+		fmt.Printf("  ⚠️  已发布但与私钥不匹配: %s\n", published)
+	}
+	fmt.Println()
+}
+
+func printDMARC(domain string) {
+	name := "_dmarc." + domain
+	fmt.Println("DMARC")
+	fmt.Printf("  %s TXT \"v=DMARC1; p=none; rua=mailto:dmarc@%s; adkim=r; aspf=r\"\n", name, domain)
+	fmt.Println("  (确认 SPF / DKIM 均通过后再将 p=none 调整为 quarantine 或 reject)")
+	if published := lookupTXT(name, "v=DMARC1"); published != "" {
+		fmt.Printf("  ✅ 已发布: %s\n", published)
+	} else {
+		fmt.Println("  ❌ 未发布 DMARC 记录")
+	}
+	fmt.Println()
+}
+
+// lookupTXT 查询以 prefix 开头的 TXT 记录（多段字符串已由解析器拼接）
+func lookupTXT(name, prefix string) string {
+	records, err := net.LookupTXT(name)
+	if err != nil {
+		return ""
+	}
+	for _, r := range records {
+		if strings.HasPrefix(r, prefix) {
+			return r
+		}
+	}
+	return ""
+}
+
+func sendTest(to string) error {
+	mailer := utils.NewMailer()
+	ec := utils.EmailContext{}
+	rendered, err := mailer.Render(ec, utils.EmailTemplateLoginNotification, utils.EmailTemplateSample(utils.EmailTemplateLoginNotification))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return mailer.Transport().Send(ctx, &utils.OutgoingEmail{
+		MessageID: uuid.NewString(),
+		Template:  utils.EmailTemplateLoginNotification,
+		From:      config.AppConfig.SMTPFrom,
+		FromName:  rendered.SenderName,
+		To:        to,
+		Subject:   "[self-test] " + rendered.Subject,
+		HTML:      rendered.HTML,
+		Text:      rendered.Text,
+	})
+}
@@ -24,8 +24,133 @@ type Config struct {
 	SMTPPassword string
 	SMTPFrom     string
 
+	// 邮件模板与品牌（项目可单独配置品牌，模板可在管理后台按项目/语言覆盖）
+	MailBrandName     string
+	MailSenderName    string
+	MailBrandColor    string
+	MailLogoURL       string
+	MailLoginURL      string
+	MailDefaultLocale string
+
+	// 邮件投递：传输方式（smtp / file / http / log）与发件箱队列的重试策略
+	MailTransport        string
+	MailFileDir          string
+	MailQueueWorkers     int
+	MailMaxAttempts      int
+	MailRetryBaseSeconds int
+	MailRetryMaxSeconds  int
+	MailHTTPURL          string
+	MailHTTPToken        string
+
+	// 发信域名认证：DKIM 私钥（domain:selector:keyfile，可配置多个发件域名）与退订链接地址
+	MailDKIMKeys       string
+	MailUnsubscribeURL string
+
+	// 邮箱 / 手机号变更：通知旧地址的撤销链接有效天数与撤销接口地址
+	ContactChangeRevertDays int
+	ContactChangeRevertURL  string
+
+	// 用户事件 Webhook：投递 worker 数、最大尝试次数、重试退避、单次请求超时与事件保留天数
+	WebhookWorkers          int
+	WebhookMaxAttempts      int
+	WebhookRetryBaseSeconds int
+	WebhookRetryMaxSeconds  int
+	WebhookTimeoutSeconds   int
+	WebhookRetentionDays    int
+
+	// 项目开通发件箱：worker 数、最大尝试次数、重试退避，以及强制映射注册同步等待首次结果的上限
+	ProvisioningWorkers          int
+	ProvisioningMaxAttempts      int
+	ProvisioningRetryBaseSeconds int
+	ProvisioningRetryMaxSeconds  int
+	ProvisioningSyncWaitMS       int
+
+	// 项目客户端：项目未配置 retry_policy 时的默认重试，以及每个项目的熔断阈值与熔断时长
+	ProjectClientRetries           int
+	ProjectClientRetryBackoffMS    int
+	ProjectClientMaxBackoffMS      int
+	ProjectCircuitFailureThreshold int
+	ProjectCircuitOpenSeconds      int
+
+	// 数据同步：调度间隔、并发执行的任务数、每批读取的记录数、单次执行上限
+	SyncPollSeconds       int
+	SyncWorkers           int
+	SyncBatchSize         int
+	SyncRunTimeoutMinutes int
+
+	// 变更捕获：记录变更的表（逗号分隔）、变更处理的轮询间隔、最大重试次数、已处理记录的保留天数
+	CDCTables        string
+	CDCPollSeconds   int
+	CDCMaxRetries    int
+	CDCRetentionDays int
+
+	// SCIM：资源 meta.location 的基础地址、列表每页最大条数
+	SCIMBaseURL    string
+	SCIMMaxResults int
+
+	// 项目映射核对：调度检查间隔、默认每批条数、默认每秒项目调用数、执行租约（秒）
+	ReconcilePollSeconds   int
+	ReconcileBatchSize     int
+	ReconcileRatePerSecond int
+	ReconcileLeaseSeconds  int
+
+	// 额外允许跨域访问的来源（逗号分隔，如管理后台）；与项目的 allowed_origins 合并
+	CORSAllowedOrigins string
+
 	ServerPort string
 	ServerHost string
+
+	// 数据加密密钥（第三方访问令牌等敏感字段落库加密），未配置时由 JWTSecret 派生
+	DataEncryptionKey string
+
+	// 上游HTTP客户端（第三方登录等外部调用）
+	UpstreamTimeoutMS int    // 单次请求超时（毫秒）
+	UpstreamRetries   int    // 幂等请求重试次数
+	UpstreamProxy     string // 出口代理，留空读取 HTTP(S)_PROXY
+
+	// 短信网关：服务商及权重、路由策略，以及阿里云 / 腾讯云状态回执推送地址上的 token
+	SMSProviders     string // 服务商及权重，如 "aliyun:3,tencent:1,twilio"
+	SMSRouting       string // 路由策略：failover / weighted
+	SMSCallbackToken string
+
+	// 阿里云短信（模板映射：模板类型:模板CODE，default 为兜底模板）
+	SMSAliyunAccessKeyID     string
+	SMSAliyunAccessKeySecret string
+	SMSAliyunSignName        string
+	SMSAliyunTemplates       string
+	SMSAliyunRegion          string
+	SMSAliyunEndpoint        string
+
+	// 腾讯云短信（模板变量按位置传递，TemplateParams 为变量顺序）
+	SMSTencentSecretID       string
+	SMSTencentSecretKey      string
+	SMSTencentSDKAppID       string
+	SMSTencentSignName       string
+	SMSTencentTemplates      string
+	SMSTencentTemplateParams string
+	SMSTencentRegion         string
+	SMSTencentEndpoint       string
+
+	// Twilio 风格 HTTP 短信（StatusCallback 为公网回调地址并用于校验签名）
+	SMSTwilioAccountSID          string
+	SMSTwilioAuthToken           string
+	SMSTwilioFrom                string
+	SMSTwilioMessagingServiceSID string
+	SMSTwilioStatusCallback      string
+	SMSTwilioEndpoint            string
+
+	// 手机号默认国家/地区（不带区号的号码按该地区解析，项目可单独配置）
+	PhoneDefaultRegion string
+
+	// 验证码发送限制（按接收方、国家/号段、费用预算；CAPTCHA 凭据读取自 CAPTCHA_* 环境变量）
+	VerifyCooldownSeconds int    // 同一接收方两次发送的最小间隔（秒）
+	VerifyDailyCap        int    // 同一接收方每日发送上限
+	VerifyCaptchaAfter    int    // 同一接收方当日发送达到该次数后要求 CAPTCHA，0 为不要求
+	VerifyCaptchaIPHourly int    // 同一 IP 每小时发送达到该次数后要求 CAPTCHA，0 为不要求
+	SMSCountryBudgets     string // 国家/地区每日短信条数预算，如 "CN:20000,852:500,*:200"；未配置不限，0 即禁止
+	SMSPrefixBudgets      string // 号段每日短信条数预算，如 "+8617:2000,+88:0"；未配置不限，0 即禁止
+	SMSCosts              string // 单条短信费用（分），如 "CN:5,*:60"
+	SMSDailySpendLimit    int    // 全局每日短信费用上限（分），超出后熔断至次日，0 为不限
 }
 
 var AppConfig Config
@@ -49,9 +174,113 @@ func Init() {
 		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 		SMTPFrom:     getEnv("SMTP_FROM", ""),
 
+		MailBrandName:     getEnv("MAIL_BRAND_NAME", "Verita"),
+		MailSenderName:    getEnv("MAIL_SENDER_NAME", "Verita"),
+		MailBrandColor:    getEnv("MAIL_BRAND_COLOR", "#2563eb"),
+		MailLogoURL:       getEnv("MAIL_LOGO_URL", ""),
+		MailLoginURL:      getEnv("MAIL_LOGIN_URL", "http://localhost:8080/login"),
+		MailDefaultLocale: getEnv("MAIL_DEFAULT_LOCALE", "zh-CN"),
+
+		MailTransport:        getEnv("MAIL_TRANSPORT", ""), // 为空时：配置了 SMTP 账号用 smtp，否则用 log（仅打印）
+		MailFileDir:          getEnv("MAIL_FILE_DIR", "./tmp/mail"),
+		MailQueueWorkers:     getEnvAsInt("MAIL_QUEUE_WORKERS", 4),
+		MailMaxAttempts:      getEnvAsInt("MAIL_MAX_ATTEMPTS", 8),
+		MailRetryBaseSeconds: getEnvAsInt("MAIL_RETRY_BASE_SECONDS", 30),
+		MailRetryMaxSeconds:  getEnvAsInt("MAIL_RETRY_MAX_SECONDS", 3600),
+		MailHTTPURL:          getEnv("MAIL_HTTP_URL", ""), // MAIL_TRANSPORT=http 时的邮件服务商接口
+		MailHTTPToken:        getEnv("MAIL_HTTP_TOKEN", ""),
+
+		MailDKIMKeys:       getEnv("MAIL_DKIM_KEYS", ""),
+		MailUnsubscribeURL: getEnv("MAIL_UNSUBSCRIBE_URL", "http://localhost:8080/api/v1/email/unsubscribe"),
+
+		ContactChangeRevertDays: getEnvAsInt("CONTACT_CHANGE_REVERT_DAYS", 7),
+		ContactChangeRevertURL:  getEnv("CONTACT_CHANGE_REVERT_URL", "http://localhost:8080/api/v1/user/contact-change/revert"),
+
+		WebhookWorkers:          getEnvAsInt("WEBHOOK_WORKERS", 4),
+		WebhookMaxAttempts:      getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 10),
+		WebhookRetryBaseSeconds: getEnvAsInt("WEBHOOK_RETRY_BASE_SECONDS", 30),
+		WebhookRetryMaxSeconds:  getEnvAsInt("WEBHOOK_RETRY_MAX_SECONDS", 21600),
+		WebhookTimeoutSeconds:   getEnvAsInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+		WebhookRetentionDays:    getEnvAsInt("WEBHOOK_RETENTION_DAYS", 30),
+
+		ProvisioningWorkers:          getEnvAsInt("PROVISIONING_WORKERS", 4),
+		ProvisioningMaxAttempts:      getEnvAsInt("PROVISIONING_MAX_ATTEMPTS", 12),
+		ProvisioningRetryBaseSeconds: getEnvAsInt("PROVISIONING_RETRY_BASE_SECONDS", 15),
+		ProvisioningRetryMaxSeconds:  getEnvAsInt("PROVISIONING_RETRY_MAX_SECONDS", 3600),
+		ProvisioningSyncWaitMS:       getEnvAsInt("PROVISIONING_SYNC_WAIT_MS", 8000),
+
+		ProjectClientRetries:           getEnvAsInt("PROJECT_CLIENT_RETRIES", 2),
+		ProjectClientRetryBackoffMS:    getEnvAsInt("PROJECT_CLIENT_RETRY_BACKOFF_MS", 200),
+		ProjectClientMaxBackoffMS:      getEnvAsInt("PROJECT_CLIENT_MAX_BACKOFF_MS", 3000),
+		ProjectCircuitFailureThreshold: getEnvAsInt("PROJECT_CIRCUIT_FAILURE_THRESHOLD", 5),
+		ProjectCircuitOpenSeconds:      getEnvAsInt("PROJECT_CIRCUIT_OPEN_SECONDS", 30),
+
+		SyncPollSeconds:       getEnvAsInt("SYNC_POLL_SECONDS", 30),
+		SyncWorkers:           getEnvAsInt("SYNC_WORKERS", 2),
+		SyncBatchSize:         getEnvAsInt("SYNC_BATCH_SIZE", 200),
+		SyncRunTimeoutMinutes: getEnvAsInt("SYNC_RUN_TIMEOUT_MINUTES", 60),
+
+		CDCTables:        getEnv("CDC_TABLES", "users,project_mappings,user_roles"),
+		CDCPollSeconds:   getEnvAsInt("CDC_POLL_SECONDS", 5),
+		CDCMaxRetries:    getEnvAsInt("CDC_MAX_RETRIES", 8),
+		CDCRetentionDays: getEnvAsInt("CDC_RETENTION_DAYS", 30),
+
+		SCIMBaseURL:    getEnv("SCIM_BASE_URL", "http://localhost:8080/scim/v2"),
+		SCIMMaxResults: getEnvAsInt("SCIM_MAX_RESULTS", 200),
+
+		ReconcilePollSeconds:   getEnvAsInt("RECONCILE_POLL_SECONDS", 15),
+		ReconcileBatchSize:     getEnvAsInt("RECONCILE_BATCH_SIZE", 100),
+		ReconcileRatePerSecond: getEnvAsInt("RECONCILE_RATE_PER_SECOND", 10),
+		ReconcileLeaseSeconds:  getEnvAsInt("RECONCILE_LEASE_SECONDS", 120),
+
+		CORSAllowedOrigins: getEnv("CORS_ALLOWED_ORIGINS", ""),
+
 		ServerPort: getEnv("PORT", "8080"),
 		ServerHost: getEnv("HOST", "0.0.0.0"),
+
+		UpstreamTimeoutMS: getEnvAsInt("UPSTREAM_HTTP_TIMEOUT_MS", 10000),
+		UpstreamRetries:   getEnvAsInt("UPSTREAM_HTTP_RETRIES", 2),
+		UpstreamProxy:     getEnv("UPSTREAM_HTTP_PROXY", ""),
+
+		SMSProviders:     getEnv("SMS_PROVIDERS", "mock"),
+		SMSRouting:       getEnv("SMS_ROUTING", "failover"),
+		SMSCallbackToken: getEnv("SMS_CALLBACK_TOKEN", ""),
+
+		SMSAliyunAccessKeyID:     getEnv("SMS_ALIYUN_ACCESS_KEY_ID", ""),
+		SMSAliyunAccessKeySecret: getEnv("SMS_ALIYUN_ACCESS_KEY_SECRET", ""),
+		SMSAliyunSignName:        getEnv("SMS_ALIYUN_SIGN_NAME", ""),
+		SMSAliyunTemplates:       getEnv("SMS_ALIYUN_TEMPLATES", ""),
+		SMSAliyunRegion:          getEnv("SMS_ALIYUN_REGION", ""),
+		SMSAliyunEndpoint:        getEnv("SMS_ALIYUN_ENDPOINT", ""),
+
+		SMSTencentSecretID:       getEnv("SMS_TENCENT_SECRET_ID", ""),
+		SMSTencentSecretKey:      getEnv("SMS_TENCENT_SECRET_KEY", ""),
+		SMSTencentSDKAppID:       getEnv("SMS_TENCENT_SDK_APP_ID", ""),
+		SMSTencentSignName:       getEnv("SMS_TENCENT_SIGN_NAME", ""),
+		SMSTencentTemplates:      getEnv("SMS_TENCENT_TEMPLATES", ""),
+		SMSTencentTemplateParams: getEnv("SMS_TENCENT_TEMPLATE_PARAMS", ""),
+		SMSTencentRegion:         getEnv("SMS_TENCENT_REGION", ""),
+		SMSTencentEndpoint:       getEnv("SMS_TENCENT_ENDPOINT", ""),
+
+		SMSTwilioAccountSID:          getEnv("SMS_TWILIO_ACCOUNT_SID", ""),
+		SMSTwilioAuthToken:           getEnv("SMS_TWILIO_AUTH_TOKEN", ""),
+		SMSTwilioFrom:                getEnv("SMS_TWILIO_FROM", ""),
+		SMSTwilioMessagingServiceSID: getEnv("SMS_TWILIO_MESSAGING_SERVICE_SID", ""),
+		SMSTwilioStatusCallback:      getEnv("SMS_TWILIO_STATUS_CALLBACK", ""),
+		SMSTwilioEndpoint:            getEnv("SMS_TWILIO_ENDPOINT", ""),
+
+		PhoneDefaultRegion: getEnv("PHONE_DEFAULT_REGION", "CN"),
+
+		VerifyCooldownSeconds: getEnvAsInt("VERIFY_COOLDOWN_SECONDS", 60),
+		VerifyDailyCap:        getEnvAsInt("VERIFY_DAILY_CAP", 10),
+		VerifyCaptchaAfter:    getEnvAsInt("VERIFY_CAPTCHA_AFTER", 3),
+		VerifyCaptchaIPHourly: getEnvAsInt("VERIFY_CAPTCHA_IP_HOURLY", 10),
+		SMSCountryBudgets:     getEnv("SMS_COUNTRY_BUDGETS", "CN:20000,*:200"),
+		SMSPrefixBudgets:      getEnv("SMS_PREFIX_BUDGETS", ""),
+		SMSCosts:              getEnv("SMS_COSTS", "CN:5,*:60"),
+		SMSDailySpendLimit:    getEnvAsInt("SMS_DAILY_SPEND_LIMIT", 0),
 	}
+	AppConfig.DataEncryptionKey = getEnv("DATA_ENCRYPTION_KEY", AppConfig.JWTSecret)
 }
 
 func getEnv(key, defaultValue string) string {
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+	"unit-auth/middleware"
 	"unit-auth/models"
 	"unit-auth/services"
 	"unit-auth/utils"
@@ -18,6 +21,7 @@ type AdminUserResponse struct {
 	ID            string     `json:"id"`
 	Email         string     `json:"email"`
 	Phone         string     `json:"phone"`
+	PhoneDisplay  string     `json:"phone_display,omitempty"`
 	Username      string     `json:"username"`
 	Nickname      string     `json:"nickname"`
 	Role          string     `json:"role"`
@@ -111,6 +115,7 @@ func GetUsers(db *gorm.DB) gin.HandlerFunc {
 			}
 			if user.Phone != nil {
 				userResponse.Phone = *user.Phone
+				userResponse.PhoneDisplay = utils.FormatPhoneDisplay(*user.Phone)
 			}
 
 			userResponses = append(userResponses, userResponse)
@@ -169,6 +174,7 @@ func GetUser(db *gorm.DB) gin.HandlerFunc {
 		}
 		if user.Phone != nil {
 			userResponse.Phone = *user.Phone
+			userResponse.PhoneDisplay = utils.FormatPhoneDisplay(*user.Phone)
 		}
 
 		c.JSON(http.StatusOK, models.Response{
@@ -179,8 +185,8 @@ func GetUser(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// UpdateUser 更新用户信息（管理员）
-func UpdateUser(db *gorm.DB) gin.HandlerFunc {
+// UpdateUser 更新用户信息（管理员）；修改邮箱 / 手机号时重置验证状态（除非显式指定），通知旧地址并推送到已映射项目
+func UpdateUser(db *gorm.DB, contactChanges *services.ContactChangeService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.Param("id")
 
@@ -201,6 +207,10 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 			})
 			return
 		}
+		before := user.ToResponse()
+		beforeEmailVerified, beforePhoneVerified := user.EmailVerified, user.PhoneVerified
+		middleware.SetAuditAction(c, "user.update")
+		middleware.SetAuditTarget(c, "users", user.ID)
 
 		// 更新字段
 		if req.Username != "" {
@@ -254,10 +264,23 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 				})
 				return
 			}
-			user.Email = &req.Email
+			if !strings.EqualFold(req.Email, before.Email) {
+				user.Email = &req.Email
+				user.EmailVerified = false
+			}
 		}
 
 		if req.Phone != "" {
+			phone, err := utils.NormalizePhone(req.Phone, utils.DefaultPhoneRegion())
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.Response{
+					Code:    400,
+					Message: "Invalid phone number format",
+				})
+				return
+			}
+			req.Phone = phone
+
 			// 检查手机号是否已存在
 			var existingUser models.User
 			if err := db.Where("phone = ? AND id != ?", req.Phone, userID).First(&existingUser).Error; err == nil {
@@ -267,7 +290,10 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 				})
 				return
 			}
-			user.Phone = &req.Phone
+			if req.Phone != before.Phone {
+				user.Phone = &req.Phone
+				user.PhoneVerified = false
+			}
 		}
 
 		if req.EmailVerified != nil {
@@ -282,7 +308,20 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 			user.SetMeta(req.Meta)
 		}
 
-		if err := db.Save(&user).Error; err != nil {
+		// 保存、事件与项目同步任务在同一事务中提交
+		actorID := c.GetString("user_id")
+		err := models.WithActor(db, actorID).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			services.PublishUserChanges(tx, before, &user, actorID)
+			if len(services.ChangedUserFields(before, user.ToResponse())) == 0 {
+				return nil
+			}
+			_, err := services.EnqueueUserSync(tx, models.ProvisioningUpdate, user.ID)
+			return err
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to update user",
@@ -290,10 +329,20 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		after := user.ToResponse()
+		middleware.SetAuditChange(c, before, after)
+
+		if after.Email != before.Email {
+			contactChanges.RecordAdminChange(c, user.ID, services.ContactChannelEmail, before.Email, after.Email, beforeEmailVerified, actorID)
+		}
+		if after.Phone != before.Phone {
+			contactChanges.RecordAdminChange(c, user.ID, services.ContactChannelPhone, before.Phone, after.Phone, beforePhoneVerified, actorID)
+		}
+
 		c.JSON(http.StatusOK, models.Response{
 			Code:    200,
 			Message: "User updated successfully",
-			Data:    user.ToResponse(),
+			Data:    after,
 		})
 	}
 }
@@ -311,9 +360,20 @@ func DeleteUser(db *gorm.DB) gin.HandlerFunc {
 			})
 			return
 		}
+		middleware.SetAuditAction(c, "user.delete")
+		middleware.SetAuditTarget(c, "users", user.ID)
+		middleware.SetAuditChange(c, user.ToResponse(), nil)
 
-		// 软删除用户
-		if err := db.Delete(&user).Error; err != nil {
+		// 软删除用户，并在同一事务中写入事件与各项目的删除任务
+		err := models.WithActor(db, c.GetString("user_id")).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&user).Error; err != nil {
+				return err
+			}
+			services.PublishUserEvent(tx, services.EventUserDeleted, &user, c.GetString("user_id"))
+			_, err := services.EnqueueUserSync(tx, models.ProvisioningDelete, user.ID)
+			return err
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to delete user",
@@ -321,18 +381,6 @@ func DeleteUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 删除后尝试对各项目做删除
-		var mappings []models.ProjectMapping
-		if err := db.Where("user_id = ?", user.ID).Find(&mappings).Error; err == nil {
-			for _, m := range mappings {
-				var p models.Project
-				if err := db.Where("`key` = ? AND enabled = ?", m.ProjectName, true).First(&p).Error; err == nil {
-					cli := services.NewProjectClient(p)
-					_ = cli.DeleteUser(c.Request.Context(), m.LocalUserID)
-				}
-			}
-		}
-
 		c.JSON(http.StatusOK, models.Response{
 			Code:    200,
 			Message: "User deleted successfully",
@@ -484,9 +532,13 @@ func BulkUpdateUsers(db *gorm.DB) gin.HandlerFunc {
 			})
 			return
 		}
+		middleware.SetAuditAction(c, "user.bulk_"+req.Action)
+		middleware.SetAuditTarget(c, "users", "")
+		middleware.AddAuditDetail(c, "user_ids", req.UserIDs)
 
 		// 开始事务
-		tx := db.Begin()
+		actorID := c.GetString("user_id")
+		tx := models.WithActor(db, actorID).Begin()
 		defer func() {
 			if r := recover(); r != nil {
 				tx.Rollback()
@@ -495,27 +547,36 @@ func BulkUpdateUsers(db *gorm.DB) gin.HandlerFunc {
 
 		var updatedCount int64
 		var deletedCount int64
+		changes := map[string]interface{}{}
 
 		for _, userID := range req.UserIDs {
 			var user models.User
 			if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
 				continue // 跳过不存在的用户
 			}
+			changes[user.ID] = map[string]interface{}{"status_before": user.Status}
+			before := user.ToResponse()
 
 			switch req.Action {
 			case "activate":
 				user.Status = "active"
 				if err := tx.Save(&user).Error; err == nil {
 					updatedCount++
+					services.PublishUserChanges(tx, before, &user, actorID)
 				}
 			case "deactivate":
 				user.Status = "inactive"
 				if err := tx.Save(&user).Error; err == nil {
 					updatedCount++
+					services.PublishUserChanges(tx, before, &user, actorID)
 				}
 			case "delete":
 				if err := tx.Delete(&user).Error; err == nil {
 					deletedCount++
+					services.PublishUserEvent(tx, services.EventUserDeleted, &user, actorID)
+					if _, err := services.EnqueueUserSync(tx, models.ProvisioningDelete, user.ID); err != nil {
+						log.Printf("Warning: failed to queue project deletion of user %s: %v", user.ID, err)
+					}
 				}
 			}
 		}
@@ -529,6 +590,10 @@ func BulkUpdateUsers(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		middleware.AddAuditDetail(c, "updated_count", updatedCount)
+		middleware.AddAuditDetail(c, "deleted_count", deletedCount)
+		middleware.AddAuditDetail(c, "changes", changes)
+
 		message := fmt.Sprintf("Bulk operation completed. Updated: %d, Deleted: %d", updatedCount, deletedCount)
 		c.JSON(http.StatusOK, models.Response{
 			Code:    200,
@@ -542,13 +607,14 @@ func BulkUpdateUsers(db *gorm.DB) gin.HandlerFunc {
 }
 
 // GetVerificationStats 获取验证码统计信息
-func GetVerificationStats(db *gorm.DB, cleanupService interface{}) gin.HandlerFunc {
+func GetVerificationStats(db *gorm.DB, cleanupService interface{}, throttle *services.VerificationThrottle) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var stats struct {
-			EmailVerifications int64 `json:"email_verifications"`
-			SMSVerifications   int64 `json:"sms_verifications"`
-			ExpiredCodes       int64 `json:"expired_codes"`
-			UsedCodes          int64 `json:"used_codes"`
+			EmailVerifications int64                  `json:"email_verifications"`
+			SMSVerifications   int64                  `json:"sms_verifications"`
+			ExpiredCodes       int64                  `json:"expired_codes"`
+			UsedCodes          int64                  `json:"used_codes"`
+			Throttle           map[string]interface{} `json:"throttle"` // 当日发送限制计数
 		}
 
 		// 邮箱验证码统计
@@ -559,6 +625,9 @@ func GetVerificationStats(db *gorm.DB, cleanupService interface{}) gin.HandlerFu
 		// 短信验证码统计
 		db.Model(&models.SMSVerification{}).Count(&stats.SMSVerifications)
 
+		// 发送限制：冷却/上限/预算拒绝次数、短信费用与熔断、人机验证
+		stats.Throttle = throttle.Stats()
+
 		c.JSON(http.StatusOK, models.Response{
 			Code:    200,
 			Message: "Verification stats retrieved successfully",
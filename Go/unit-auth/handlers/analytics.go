@@ -372,9 +372,9 @@ func GetUserBehaviorAnalytics(db *gorm.DB) gin.HandlerFunc {
 			Where("phone IS NOT NULL AND phone != ''").
 			Count(&phoneUsers)
 
-		// OAuth用户（有第三方ID的用户）
-		db.Model(&models.User{}).
-			Where("google_id IS NOT NULL OR git_hub_id IS NOT NULL OR we_chat_id IS NOT NULL").
+		// OAuth用户（绑定了第三方身份的用户）
+		db.Model(&models.UserIdentity{}).
+			Distinct("user_id").
 			Count(&oauthUsers)
 
 		if totalUsers > 0 {
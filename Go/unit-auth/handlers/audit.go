@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandler 审计日志处理器
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+// NewAuditHandler 创建审计日志处理器
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+// auditFilterFromQuery 从查询参数构造过滤条件
+func auditFilterFromQuery(c *gin.Context) services.AuditFilter {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	return services.AuditFilter{
+		UserID:     c.Query("user_id"),
+		Action:     c.Query("action"),
+		Resource:   c.Query("resource"),
+		ResourceID: c.Query("resource_id"),
+		Project:    c.Query("project"),
+		Status:     c.Query("status"),
+		RequestID:  c.Query("request_id"),
+		IPAddress:  c.Query("ip"),
+		StartDate:  c.Query("start_date"),
+		EndDate:    c.Query("end_date"),
+		Page:       page,
+		PageSize:   pageSize,
+	}
+}
+
+// GetAuditLogs 查询审计日志
+// GET /api/v1/admin/audit-logs
+func (h *AuditHandler) GetAuditLogs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := auditFilterFromQuery(c)
+		logs, total, err := h.auditService.List(filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to retrieve audit logs",
+			})
+			return
+		}
+
+		list := make([]models.AuditLogResponse, 0, len(logs))
+		for i := range logs {
+			list = append(list, logs[i].ToResponse())
+		}
+
+		if filter.Page < 1 {
+			filter.Page = 1
+		}
+		if filter.PageSize < 1 || filter.PageSize > 200 {
+			filter.PageSize = 20
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Audit logs retrieved successfully",
+			Data: gin.H{
+				"logs": list,
+				"pagination": gin.H{
+					"page":        filter.Page,
+					"page_size":   filter.PageSize,
+					"total":       total,
+					"total_pages": (total + int64(filter.PageSize) - 1) / int64(filter.PageSize),
+				},
+			},
+		})
+	}
+}
+
+// ExportAuditLogs 导出审计日志为CSV
+// GET /api/v1/admin/audit-logs/export
+func (h *AuditHandler) ExportAuditLogs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := auditFilterFromQuery(c)
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10000"))
+
+		filename := fmt.Sprintf("audit_logs_%s.csv", time.Now().Format("20060102_150405"))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+		c.Status(http.StatusOK)
+		if err := h.auditService.ExportCSV(c.Writer, filter, limit); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// VerifyAuditChain 校验审计日志哈希链完整性
+// GET /api/v1/admin/audit-logs/verify
+func (h *AuditHandler) VerifyAuditChain() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := h.auditService.VerifyChain()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to verify audit chain",
+			})
+			return
+		}
+
+		message := "Audit chain is intact"
+		if !report.Valid {
+			message = "Audit chain is broken"
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: message,
+			Data:    report,
+		})
+	}
+}
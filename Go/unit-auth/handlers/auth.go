@@ -78,7 +78,11 @@ func Register(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
 			StrictProjectMapping: projectKey != "",
 		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create user: " + err.Error()})
+			if errors.Is(err, services.ErrProvisioningPending) {
+				// 用户已创建，验证码同样作废
+				db.Model(&verification).Update("used", true)
+			}
+			respondRegistrationError(c, err)
 			return
 		}
 
@@ -143,6 +147,12 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 联系方式变更被撤销后需先重置密码
+		if user.PasswordResetRequired {
+			c.JSON(http.StatusForbidden, models.Response{Code: 403, Message: "Password reset required"})
+			return
+		}
+
 		// 生成紧凑JWT（含项目映射）
 		projectKey := ""
 		if keyVal, ok := c.Get(middleware.CtxProjectKey); ok {
@@ -183,7 +193,7 @@ func UnifiedLogin(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// 识别账号类型
-		accountType := utils.IdentifyAccountType(req.Account)
+		accountType, account := identifyLoginAccount(c, db, req.Account)
 		if accountType == utils.AccountTypeUnknown {
 			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid account format. Please use email, phone number, or username"})
 			return
@@ -194,11 +204,11 @@ func UnifiedLogin(db *gorm.DB) gin.HandlerFunc {
 		var queryErr error
 		switch accountType {
 		case utils.AccountTypeEmail:
-			queryErr = db.Where("email = ?", req.Account).First(&user).Error
+			queryErr = db.Where("email = ?", account).First(&user).Error
 		case utils.AccountTypePhone:
-			queryErr = db.Where("phone = ?", req.Account).First(&user).Error
+			queryErr = db.Where("phone = ?", account).First(&user).Error
 		case utils.AccountTypeUsername:
-			queryErr = db.Where("username = ?", req.Account).First(&user).Error
+			queryErr = db.Where("username = ?", account).First(&user).Error
 		}
 		if queryErr != nil {
 			c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: "Invalid account or password"})
@@ -217,6 +227,12 @@ func UnifiedLogin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 联系方式变更被撤销后需先重置密码
+		if user.PasswordResetRequired {
+			c.JSON(http.StatusForbidden, models.Response{Code: 403, Message: "Password reset required"})
+			return
+		}
+
 		// 读取项目Key并查找映射以注入 pid/luid
 		projectKey := ""
 		if keyVal, ok := c.Get(middleware.CtxProjectKey); ok {
@@ -254,7 +270,7 @@ func UnifiedLogin(db *gorm.DB) gin.HandlerFunc {
 }
 
 // 发送邮箱验证码
-func SendEmailCode(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
+func SendEmailCode(db *gorm.DB, mailer *utils.Mailer, throttle *services.VerificationThrottle) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.SendEmailCodeRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -276,6 +292,12 @@ func SendEmailCode(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
 			return
 		}
 
+		// 按接收方冷却、每日上限与人机验证限制发送
+		release, ok := acquireVerificationSend(c, throttle, services.VerificationChannelEmail, req.Email, req.CaptchaToken)
+		if !ok {
+			return
+		}
+
 		// 生成验证码
 		code := utils.GenerateVerificationCode()
 		expiresAt := time.Now().Add(10 * time.Minute)
@@ -290,6 +312,7 @@ func SendEmailCode(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
 		}
 
 		if err := db.Create(&verification).Error; err != nil {
+			release()
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to save verification code",
@@ -298,7 +321,8 @@ func SendEmailCode(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
 		}
 
 		// 发送邮件
-		if err := mailer.SendVerificationCode(req.Email, code, req.Type); err != nil {
+		if err := mailer.SendVerificationCode(services.EmailContextFor(db, c, req.Email), req.Email, code, req.Type); err != nil {
+			release()
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to send verification code",
@@ -405,7 +429,7 @@ func VerifyEmail(db *gorm.DB) gin.HandlerFunc {
 }
 
 // 忘记密码
-func ForgotPassword(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
+func ForgotPassword(db *gorm.DB, mailer *utils.Mailer, throttle *services.VerificationThrottle) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.ForgotPasswordRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -426,6 +450,11 @@ func ForgotPassword(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
 			return
 		}
 
+		release, ok := acquireVerificationSend(c, throttle, services.VerificationChannelEmail, req.Email, req.CaptchaToken)
+		if !ok {
+			return
+		}
+
 		// 发送重置密码验证码
 		code := utils.GenerateVerificationCode()
 		expiresAt := time.Now().Add(10 * time.Minute)
@@ -439,6 +468,7 @@ func ForgotPassword(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
 		}
 
 		if err := db.Create(&verification).Error; err != nil {
+			release()
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to save verification code",
@@ -446,7 +476,8 @@ func ForgotPassword(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
 			return
 		}
 
-		if err := mailer.SendVerificationCode(req.Email, code, "reset_password"); err != nil {
+		if err := mailer.SendVerificationCode(services.EmailContextFor(db, c, req.Email), req.Email, code, "reset_password"); err != nil {
+			release()
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to send verification code",
@@ -495,6 +526,7 @@ func ResetPassword(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		user.Password = req.Password
+		user.PasswordResetRequired = false
 		if err := user.HashPassword(); err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
@@ -503,13 +535,14 @@ func ResetPassword(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Save(&user).Error; err != nil {
+		if err := models.WithActor(db, user.ID).Save(&user).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to update password",
 			})
 			return
 		}
+		services.PublishUserEvent(db, services.EventUserPasswordChanged, &user, user.ID)
 
 		// 标记验证码为已使用
 		db.Model(&verification).Update("used", true)
@@ -522,12 +555,12 @@ func ResetPassword(db *gorm.DB) gin.HandlerFunc {
 }
 
 // PhoneLogin 手机号登录（使用与 PhoneDirectLogin 相同的完善逻辑）
-func PhoneLogin(db *gorm.DB) gin.HandlerFunc {
-	return PhoneDirectLogin(db)
+func PhoneLogin(db *gorm.DB, smsHandler *services.SMSHandler) gin.HandlerFunc {
+	return PhoneDirectLogin(db, smsHandler)
 }
 
-// SendPhoneCode 发送手机验证码
-func SendPhoneCode(db *gorm.DB) gin.HandlerFunc {
+// SendPhoneCode 发送手机验证码（经短信网关发送）
+func SendPhoneCode(db *gorm.DB, smsHandler *services.SMSHandler, throttle *services.VerificationThrottle) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.SendPhoneCodeRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -538,13 +571,25 @@ func SendPhoneCode(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 创建短信服务
-		smsService := services.NewMockSMSService(db)
-		smsHandler := services.NewSMSHandler(db, smsService)
+		phone, err := requestPhone(c, db, req.Phone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "Invalid phone number format",
+			})
+			return
+		}
+
+		// 按接收方、国家/号段预算与费用熔断限制发送
+		release, ok := acquireVerificationSend(c, throttle, services.VerificationChannelSMS, phone, req.CaptchaToken)
+		if !ok {
+			return
+		}
 
 		// 发送验证码
-		verification, err := smsHandler.SendVerificationCode(req.Phone, req.Type)
+		verification, err := smsHandler.SendVerificationCode(phone, req.Type)
 		if err != nil {
+			release()
 			c.JSON(http.StatusBadRequest, models.Response{
 				Code:    400,
 				Message: err.Error(),
@@ -556,9 +601,10 @@ func SendPhoneCode(db *gorm.DB) gin.HandlerFunc {
 			Code:    200,
 			Message: "Verification code sent successfully",
 			Data: gin.H{
-				"phone":      req.Phone,
-				"type":       req.Type,
-				"expires_at": verification.ExpiresAt,
+				"phone":         phone,
+				"phone_display": utils.FormatPhoneDisplay(phone),
+				"type":          req.Type,
+				"expires_at":    verification.ExpiresAt,
 			},
 		})
 	}
@@ -576,14 +622,16 @@ func PhoneResetPassword(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 验证手机号格式
-		if utils.IdentifyAccountType(req.Phone) != utils.AccountTypePhone {
+		// 验证手机号格式并规范化为 E.164
+		phone, err := requestPhone(c, db, req.Phone)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, models.Response{
 				Code:    400,
 				Message: "Invalid phone number format",
 			})
 			return
 		}
+		req.Phone = phone
 
 		// 验证重置密码验证码
 		var verification models.SMSVerification
@@ -608,6 +656,7 @@ func PhoneResetPassword(db *gorm.DB) gin.HandlerFunc {
 
 		// 更新用户密码
 		user.Password = req.Password
+		user.PasswordResetRequired = false
 		if err := user.HashPassword(); err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
@@ -616,13 +665,14 @@ func PhoneResetPassword(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Save(&user).Error; err != nil {
+		if err := models.WithActor(db, user.ID).Save(&user).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to update password",
 			})
 			return
 		}
+		services.PublishUserEvent(db, services.EventUserPasswordChanged, &user, user.ID)
 
 		// 标记验证码为已使用
 		db.Model(&verification).Update("used", true)
@@ -635,7 +685,7 @@ func PhoneResetPassword(db *gorm.DB) gin.HandlerFunc {
 }
 
 // PhoneDirectLogin 手机号验证码直接登录（自动注册）
-func PhoneDirectLogin(db *gorm.DB) gin.HandlerFunc {
+func PhoneDirectLogin(db *gorm.DB, smsHandler *services.SMSHandler) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.PhoneLoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -646,18 +696,16 @@ func PhoneDirectLogin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 验证手机号格式
-		if utils.IdentifyAccountType(req.Phone) != utils.AccountTypePhone {
+		// 验证手机号格式并规范化为 E.164
+		phone, err := requestPhone(c, db, req.Phone)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, models.Response{
 				Code:    400,
 				Message: "Invalid phone number format",
 			})
 			return
 		}
-
-		// 创建短信服务
-		smsService := services.NewMockSMSService(db)
-		smsHandler := services.NewSMSHandler(db, smsService)
+		req.Phone = phone
 
 		// 验证验证码
 		verification, err := smsHandler.VerifyCode(req.Phone, req.Code, "login")
@@ -691,7 +739,7 @@ func PhoneDirectLogin(db *gorm.DB) gin.HandlerFunc {
 				}
 				created, err := services.RegisterUser(tx, nil, services.RegistrationOptions{
 					Phone:                &req.Phone,
-					Username:             req.Phone,
+					Username:             utils.PhoneUsername(req.Phone),
 					Nickname:             "手机用户",
 					PhoneVerified:        true,
 					Role:                 "user",
@@ -812,6 +860,17 @@ func PhoneDirectLogin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 新用户的项目开通在事务提交后执行，取得项目侧用户ID后签发含项目Claims的Token
+		if isNewUser && projectKey != "" && localID == "" {
+			if err := services.FinishProjectProvisioning(c, db, projectKey, user.ID); err != nil {
+				respondRegistrationError(c, err)
+				return
+			}
+			if t, err := utils.GenerateTokenWithProject(user.ID, identifier, user.Role, projectKey, c.GetString("local_user_id")); err == nil {
+				token = t
+			}
+		}
+
 		// 记录登录日志
 		loginLog := models.LoginLog{
 			UserID:    user.ID,
@@ -878,7 +937,7 @@ func EmailCodeLogin(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
 					StrictProjectMapping: projectKey != "",
 				})
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create user"})
+					respondRegistrationError(c, err)
 					return
 				}
 				user = *created
@@ -943,3 +1002,18 @@ func EmailCodeLogin(db *gorm.DB, mailer *utils.Mailer) gin.HandlerFunc {
 		})
 	}
 }
+
+// respondRegistrationError 注册失败响应：项目开通仍在进行时返回 202（用户已创建，稍后重新登录即可）
+func respondRegistrationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrProvisioningPending):
+		c.JSON(http.StatusAccepted, models.Response{
+			Code:    202,
+			Message: "Account created; project account is still being provisioned, please sign in again shortly",
+		})
+	case errors.Is(err, services.ErrProvisioningFailed):
+		c.JSON(http.StatusBadGateway, models.Response{Code: 502, Message: "Failed to create user: " + err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create user: " + err.Error()})
+	}
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/plugins"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,63}$`)
+
+// AuthProviderHandler 第三方登录提供者配置管理（管理员）
+type AuthProviderHandler struct {
+	db            *gorm.DB
+	pluginManager *plugins.PluginManager
+}
+
+// NewAuthProviderHandler 创建提供者配置处理器
+func NewAuthProviderHandler(db *gorm.DB, pluginManager *plugins.PluginManager) *AuthProviderHandler {
+	return &AuthProviderHandler{db: db, pluginManager: pluginManager}
+}
+
+// ListProviderConfigs 获取提供者配置列表
+// GET /api/v1/admin/auth-providers
+func (h *AuthProviderHandler) ListProviderConfigs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var configs []models.AuthProviderConfig
+		if err := h.db.Order("id ASC").Find(&configs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve provider configs"})
+			return
+		}
+		list := make([]models.AuthProviderConfigResponse, 0, len(configs))
+		for i := range configs {
+			list = append(list, configs[i].ToResponse())
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Provider configs retrieved successfully", Data: list})
+	}
+}
+
+// CreateProviderConfig 新增提供者配置，保存后立即生效
+// POST /api/v1/admin/auth-providers
+func (h *AuthProviderHandler) CreateProviderConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.AuthProviderConfigRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+
+		cfg := models.AuthProviderConfig{Enabled: true}
+		applyProviderConfigRequest(&cfg, &req)
+		if msg := h.validateProviderConfig(&cfg, 0); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+
+		if err := h.db.Create(&cfg).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create provider config"})
+			return
+		}
+		h.reloadConfigProviders(c)
+
+		middleware.SetAuditAction(c, "auth_provider.create")
+		middleware.SetAuditTarget(c, "auth_providers", cfg.Name)
+		middleware.SetAuditChange(c, nil, cfg.ToResponse())
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Provider config created successfully", Data: cfg.ToResponse()})
+	}
+}
+
+// UpdateProviderConfig 更新提供者配置，保存后立即生效
+// PUT /api/v1/admin/auth-providers/:id
+func (h *AuthProviderHandler) UpdateProviderConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.AuthProviderConfigRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+
+		var cfg models.AuthProviderConfig
+		if err := h.db.Where("id = ?", c.Param("id")).First(&cfg).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "Provider config not found"})
+			return
+		}
+		before := cfg.ToResponse()
+
+		applyProviderConfigRequest(&cfg, &req)
+		if msg := h.validateProviderConfig(&cfg, cfg.ID); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+
+		if err := h.db.Save(&cfg).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to update provider config"})
+			return
+		}
+		h.reloadConfigProviders(c)
+
+		after := cfg.ToResponse()
+		middleware.SetAuditAction(c, "auth_provider.update")
+		middleware.SetAuditTarget(c, "auth_providers", cfg.Name)
+		middleware.SetAuditChange(c, before, after)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Provider config updated successfully", Data: after})
+	}
+}
+
+// DeleteProviderConfig 删除提供者配置（已绑定的身份保留）
+// DELETE /api/v1/admin/auth-providers/:id
+func (h *AuthProviderHandler) DeleteProviderConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var cfg models.AuthProviderConfig
+		if err := h.db.Where("id = ?", c.Param("id")).First(&cfg).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "Provider config not found"})
+			return
+		}
+		if err := h.db.Delete(&cfg).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to delete provider config"})
+			return
+		}
+		h.reloadConfigProviders(c)
+
+		middleware.SetAuditAction(c, "auth_provider.delete")
+		middleware.SetAuditTarget(c, "auth_providers", cfg.Name)
+		middleware.SetAuditChange(c, cfg.ToResponse(), nil)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Provider config deleted successfully"})
+	}
+}
+
+// ListProviders 获取全部已注册提供者的运行状态
+// GET /api/v1/admin/providers
+func (h *AuthProviderHandler) ListProviders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Providers retrieved successfully", Data: h.pluginManager.Statuses()})
+	}
+}
+
+// SetProviderEnabled 运行时启用/禁用提供者
+// POST /api/v1/admin/providers/:name/enable | /disable
+func (h *AuthProviderHandler) SetProviderEnabled(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		action := "auth_provider.disable"
+		if enabled {
+			action = "auth_provider.enable"
+		}
+		middleware.SetAuditAction(c, action)
+		middleware.SetAuditTarget(c, "providers", name)
+
+		if err := h.pluginManager.SetProviderEnabled(name, enabled); err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Provider updated successfully", Data: h.pluginManager.Statuses()})
+	}
+}
+
+// ReloadProviders 重新加载全部提供者配置（环境变量内置提供者 + 数据库配置）
+// POST /api/v1/admin/providers/reload
+func (h *AuthProviderHandler) ReloadProviders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := h.pluginManager.Reload(c.Request.Context())
+		middleware.SetAuditAction(c, "auth_provider.reload")
+		middleware.AddAuditDetail(c, "loaded", report.Loaded)
+		middleware.AddAuditDetail(c, "removed", report.Removed)
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Providers reloaded", Data: report})
+	}
+}
+
+// ProviderHealth 对提供者执行健康检查
+// GET /api/v1/admin/providers/health
+func (h *AuthProviderHandler) ProviderHealth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		results := h.pluginManager.HealthCheck(c.Request.Context())
+		healthy := true
+		health := make(map[string]gin.H, len(results))
+		for name, msg := range results {
+			health[name] = gin.H{"healthy": msg == "", "error": msg}
+			if msg != "" {
+				healthy = false
+			}
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Provider health checked", Data: gin.H{"healthy": healthy, "providers": health}})
+	}
+}
+
+// reloadConfigProviders 配置变更后重新加载数据库配置的提供者
+func (h *AuthProviderHandler) reloadConfigProviders(c *gin.Context) {
+	report, err := h.pluginManager.ReloadSource(c.Request.Context(), plugins.SourceConfig)
+	if err != nil {
+		log.Printf("Warning: failed to reload auth provider configs: %v", err)
+		return
+	}
+	for name, msg := range report.Errors {
+		log.Printf("Warning: auth provider %s: %s", name, msg)
+	}
+}
+
+func applyProviderConfigRequest(cfg *models.AuthProviderConfig, req *models.AuthProviderConfigRequest) {
+	if req.Name != "" {
+		cfg.Name = strings.ToLower(strings.TrimSpace(req.Name))
+	}
+	if req.DisplayName != "" {
+		cfg.DisplayName = req.DisplayName
+	}
+	if req.Issuer != "" {
+		cfg.Issuer = strings.TrimRight(req.Issuer, "/")
+	}
+	if req.AuthorizationURL != "" {
+		cfg.AuthorizationURL = req.AuthorizationURL
+	}
+	if req.TokenURL != "" {
+		cfg.TokenURL = req.TokenURL
+	}
+	if req.UserInfoURL != "" {
+		cfg.UserInfoURL = req.UserInfoURL
+	}
+	if req.JWKSURL != "" {
+		cfg.JWKSURL = req.JWKSURL
+	}
+	if req.ClientID != "" {
+		cfg.ClientID = req.ClientID
+	}
+	if req.ClientSecret != "" {
+		cfg.ClientSecret = req.ClientSecret
+	}
+	if req.RedirectURI != "" {
+		cfg.RedirectURI = req.RedirectURI
+	}
+	if req.Scopes != "" {
+		cfg.Scopes = req.Scopes
+	}
+	if req.ClaimMapping != nil {
+		_ = cfg.SetClaimMapping(req.ClaimMapping)
+	}
+	if req.Enabled != nil {
+		cfg.Enabled = *req.Enabled
+	}
+}
+
+// validateProviderConfig 校验配置，返回错误信息（空表示通过）
+func (h *AuthProviderHandler) validateProviderConfig(cfg *models.AuthProviderConfig, id uint) string {
+	if !providerNamePattern.MatchString(cfg.Name) {
+		return "Invalid provider name: use lowercase letters, digits, '-' or '_'"
+	}
+	// 不允许覆盖内置提供者
+	if existing, ok := h.pluginManager.GetProvider(cfg.Name); ok {
+		if _, isOIDC := existing.(*plugins.OIDCProvider); !isOIDC {
+			return "Provider name is reserved by a built-in provider"
+		}
+	}
+	var cnt int64
+	h.db.Model(&models.AuthProviderConfig{}).Where("name = ? AND id != ?", cfg.Name, id).Count(&cnt)
+	if cnt > 0 {
+		return "Provider name already exists"
+	}
+	if cfg.ClientID == "" {
+		return "client_id is required"
+	}
+	if cfg.RedirectURI == "" {
+		return "redirect_uri is required"
+	}
+	if cfg.Issuer == "" && (cfg.AuthorizationURL == "" || cfg.TokenURL == "") {
+		return "Either issuer or authorization_url and token_url are required"
+	}
+	for field := range cfg.GetClaimMapping() {
+		if !isClaimMappingField(field) {
+			return "Unsupported claim mapping field: " + field
+		}
+	}
+	return ""
+}
+
+func isClaimMappingField(field string) bool {
+	for _, f := range models.ClaimMappingFields() {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
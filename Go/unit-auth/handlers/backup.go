@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"time"
+	"unit-auth/middleware"
 	"unit-auth/models"
 
 	"github.com/gin-gonic/gin"
@@ -312,6 +313,11 @@ func (h *BackupHandler) ImportBackup() gin.HandlerFunc {
 			})
 			return
 		}
+		middleware.SetAuditAction(c, "backup.import")
+		middleware.SetAuditTarget(c, "backup", file.Filename)
+		middleware.AddAuditDetail(c, "version", backup.Version)
+		middleware.AddAuditDetail(c, "users", len(backup.Users))
+		middleware.AddAuditDetail(c, "login_logs", len(backup.LoginLogs))
 
 		// 开始事务
 		tx := h.db.Begin()
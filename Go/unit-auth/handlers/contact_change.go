@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ContactChangeHandler 用户自助修改邮箱 / 手机号：新地址验证码确认，旧地址可撤销
+type ContactChangeHandler struct {
+	db       *gorm.DB
+	service  *services.ContactChangeService
+	throttle *services.VerificationThrottle
+}
+
+// NewContactChangeHandler 创建邮箱 / 手机号变更处理器
+func NewContactChangeHandler(db *gorm.DB, service *services.ContactChangeService, throttle *services.VerificationThrottle) *ContactChangeHandler {
+	return &ContactChangeHandler{db: db, service: service, throttle: throttle}
+}
+
+// ChangeEmail 申请修改邮箱，验证码发送到新邮箱
+// POST /api/v1/user/change-email
+func (h *ContactChangeHandler) ChangeEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ChangeEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		h.start(c, services.ContactChannelEmail, strings.TrimSpace(req.NewEmail), req.Password, req.CaptchaToken)
+	}
+}
+
+// ChangePhone 申请修改手机号，验证码发送到新手机号
+// POST /api/v1/user/change-phone
+func (h *ContactChangeHandler) ChangePhone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ChangePhoneRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		phone, err := requestPhone(c, h.db, req.NewPhone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid phone number format"})
+			return
+		}
+		h.start(c, services.ContactChannelPhone, phone, req.Password, req.CaptchaToken)
+	}
+}
+
+// ConfirmEmail 以新邮箱收到的验证码确认修改
+// POST /api/v1/user/change-email/confirm
+func (h *ContactChangeHandler) ConfirmEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.confirm(c, services.ContactChannelEmail)
+	}
+}
+
+// ConfirmPhone 以新手机号收到的验证码确认修改
+// POST /api/v1/user/change-phone/confirm
+func (h *ContactChangeHandler) ConfirmPhone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.confirm(c, services.ContactChannelPhone)
+	}
+}
+
+// Revert 旧地址撤销变更（通知中的链接，无需登录）
+// GET  /api/v1/user/contact-change/revert?token=... 展示确认页（避免邮件安全扫描器访问链接即撤销）
+// POST /api/v1/user/contact-change/revert?token=... 执行撤销
+func (h *ContactChangeHandler) Revert() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			token = c.PostForm("token")
+		}
+
+		if c.Request.Method == http.MethodGet {
+			change, err := h.service.LookupRevert(token)
+			if err != nil {
+				c.Data(http.StatusBadRequest, "text/html; charset=utf-8", contactChangePage(`<p>链接无效或已过期 / This link is invalid or has expired.</p>`))
+				return
+			}
+			c.Data(http.StatusOK, "text/html; charset=utf-8", contactChangePage(
+				`<p>将撤销账户`+contactChannelLabel(change.Channel)+`的更换，恢复为 `+html.EscapeString(services.MaskContactValue(change.Channel, change.OldValue))+`。撤销后请立即重新设置密码。</p>`+
+					`<form method="post"><input type="hidden" name="token" value="`+html.EscapeString(token)+`"><button type="submit">确认撤销 / Revert</button></form>`))
+			return
+		}
+
+		change, err := h.service.Revert(c.Request.Context(), token)
+		if err != nil {
+			status, message := http.StatusInternalServerError, "Failed to revert change"
+			switch {
+			case errors.Is(err, services.ErrContactRevertInvalid):
+				status, message = http.StatusBadRequest, err.Error()
+			case errors.Is(err, services.ErrContactRevertSuperseded), errors.Is(err, services.ErrContactInUse):
+				status, message = http.StatusConflict, err.Error()
+			}
+			if strings.Contains(c.GetHeader("Accept"), "application/json") {
+				c.JSON(status, models.Response{Code: status, Message: message})
+				return
+			}
+			c.Data(status, "text/html; charset=utf-8", contactChangePage(`<p>撤销失败 / Revert failed: `+html.EscapeString(message)+`</p>`))
+			return
+		}
+
+		if strings.Contains(c.GetHeader("Accept"), "application/json") {
+			c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Change reverted successfully", Data: gin.H{"channel": change.Channel}})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", contactChangePage(
+			`<p>已撤销，账户`+contactChannelLabel(change.Channel)+`已恢复为 `+html.EscapeString(services.MaskContactValue(change.Channel, change.OldValue))+`。所有已登录的会话均已退出，请通过“忘记密码”重新设置密码后再登录。</p>`))
+	}
+}
+
+// start 校验当前密码与发送限制后发起变更
+func (h *ContactChangeHandler) start(c *gin.Context, channel, newValue, password, captchaToken string) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	// 已设置密码的账号需验证当前密码（仅第三方登录的账号没有密码）
+	if user.Password != "" && !user.CheckPassword(password) {
+		c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid password"})
+		return
+	}
+
+	throttleChannel := services.VerificationChannelEmail
+	if channel == services.ContactChannelPhone {
+		throttleChannel = services.VerificationChannelSMS
+	}
+	release, ok := acquireVerificationSend(c, h.throttle, throttleChannel, newValue, captchaToken)
+	if !ok {
+		return
+	}
+
+	change, err := h.service.Start(c, user, channel, newValue, c.ClientIP())
+	if err != nil {
+		release()
+		switch {
+		case errors.Is(err, services.ErrContactUnchanged):
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
+		case errors.Is(err, services.ErrContactInUse):
+			c.JSON(http.StatusConflict, models.Response{Code: 409, Message: contactChannelName(channel) + " " + err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to send verification code"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "Verification code sent successfully",
+		Data: gin.H{
+			"channel":    channel,
+			"new_value":  services.MaskContactValue(channel, change.NewValue),
+			"expires_at": change.ExpiresAt,
+		},
+	})
+}
+
+// confirm 校验验证码并使变更生效
+func (h *ContactChangeHandler) confirm(c *gin.Context, channel string) {
+	var req models.ConfirmContactChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.service.Confirm(c, user, channel, req.Code); err != nil {
+		switch {
+		case errors.Is(err, services.ErrContactChangeNotFound),
+			errors.Is(err, services.ErrContactChangeExpired),
+			errors.Is(err, services.ErrContactChangeInvalidCode),
+			errors.Is(err, services.ErrContactChangeTooManyAttempts):
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
+		case errors.Is(err, services.ErrContactInUse):
+			c.JSON(http.StatusConflict, models.Response{Code: 409, Message: contactChannelName(channel) + " " + err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to update " + contactChannelName(channel)})
+		}
+		return
+	}
+
+	if err := h.db.Where("id = ?", user.ID).First(user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to load user"})
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: contactChannelName(channel) + " changed successfully",
+		Data:    user.ToResponse(),
+	})
+}
+
+func (h *ContactChangeHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := h.db.Where("id = ?", c.GetString("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+func contactChannelName(channel string) string {
+	if channel == services.ContactChannelPhone {
+		return "Phone number"
+	}
+	return "Email"
+}
+
+func contactChannelLabel(channel string) string {
+	if channel == services.ContactChannelPhone {
+		return "手机号"
+	}
+	return "邮箱"
+}
+
+func contactChangePage(body string) []byte {
+	return []byte(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>Account change</title></head><body>` + body + `</body></html>`)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ChangeFeedHandler 数据变更记录管理（管理员）：按表、记录、操作者查询变更，重试处理失败的变更
+type ChangeFeedHandler struct {
+	db        *gorm.DB
+	processor *services.ChangeProcessor
+}
+
+// NewChangeFeedHandler 创建数据变更处理器
+func NewChangeFeedHandler(db *gorm.DB, processor *services.ChangeProcessor) *ChangeFeedHandler {
+	return &ChangeFeedHandler{db: db, processor: processor}
+}
+
+// ListChanges 查询数据变更，可按 table_name、record_id、change_type、sync_status、user_id、project 过滤，
+// since / until 为 RFC3339 时间；按时间倒序，order=asc 时正序（按记录回放）
+// GET /api/v1/admin/data-changes
+func (h *ChangeFeedHandler) ListChanges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, pageSize := syncPagination(c)
+
+		query := h.db.Model(&models.DataChange{})
+		for _, column := range []string{"table_name", "record_id", "change_type", "sync_status", "user_id", "project"} {
+			if v := c.Query(column); v != "" {
+				query = query.Where(column+" = ?", v)
+			}
+		}
+		if v := c.Query("since"); v != "" {
+			since, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "since must be an RFC3339 time"})
+				return
+			}
+			query = query.Where("created_at >= ?", since)
+		}
+		if v := c.Query("until"); v != "" {
+			until, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "until must be an RFC3339 time"})
+				return
+			}
+			query = query.Where("created_at < ?", until)
+		}
+		order := "id DESC"
+		if c.Query("order") == "asc" {
+			order = "id ASC"
+		}
+
+		var total int64
+		query.Count(&total)
+		var changes []models.DataChange
+		if err := query.Preload("User").Order(order).Offset((page - 1) * pageSize).Limit(pageSize).Find(&changes).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve data changes"})
+			return
+		}
+		items := make([]models.DataChangeResponse, 0, len(changes))
+		for i := range changes {
+			items = append(items, dataChangeResponse(&changes[i]))
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Data changes retrieved successfully",
+			Data: gin.H{
+				"changes":    items,
+				"pagination": syncPaginationData(page, pageSize, total),
+			},
+		})
+	}
+}
+
+// GetChange 数据变更详情（含处理错误）
+// GET /api/v1/admin/data-changes/:id
+func (h *ChangeFeedHandler) GetChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var change models.DataChange
+		if err := h.db.Preload("User").First(&change, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: services.ErrDataChangeNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Data change retrieved successfully",
+			Data: gin.H{
+				"change":        dataChangeResponse(&change),
+				"last_retry_at": change.LastRetryAt,
+				"next_retry_at": change.NextRetryAt,
+				"last_error":    change.LastError,
+			},
+		})
+	}
+}
+
+// RetryChange 将处理失败的变更重新放回队列
+// POST /api/v1/admin/data-changes/:id/retry
+func (h *ChangeFeedHandler) RetryChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid data change id"})
+			return
+		}
+		change, err := h.processor.Retry(uint(id))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrDataChangeNotFound):
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+			case errors.Is(err, services.ErrDataChangeNotRetryable):
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retry data change"})
+			}
+			return
+		}
+
+		middleware.SetAuditAction(c, "data_change.retry")
+		middleware.SetAuditTarget(c, change.TableName, change.RecordID)
+		middleware.AddAuditDetail(c, "change_id", change.ID)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Data change requeued successfully", Data: dataChangeResponse(change)})
+	}
+}
+
+func dataChangeResponse(dc *models.DataChange) models.DataChangeResponse {
+	resp := models.DataChangeResponse{
+		ID:         dc.ID,
+		TableName:  dc.TableName,
+		RecordID:   dc.RecordID,
+		ChangeType: dc.ChangeType,
+		Project:    dc.Project,
+		UserID:     dc.UserID,
+		Username:   dc.User.Username,
+		SyncStatus: dc.SyncStatus,
+		RetryCount: dc.RetryCount,
+		CreatedAt:  dc.CreatedAt,
+	}
+	resp.OldData, _ = dc.GetOldData()
+	resp.NewData, _ = dc.GetNewData()
+	return resp
+}
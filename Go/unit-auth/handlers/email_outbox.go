@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EmailOutboxHandler 邮件发件箱管理（管理员）：查询投递状态、队列统计、重投死信
+type EmailOutboxHandler struct {
+	db     *gorm.DB
+	outbox *services.EmailOutbox
+}
+
+// NewEmailOutboxHandler 创建发件箱处理器
+func NewEmailOutboxHandler(db *gorm.DB, outbox *services.EmailOutbox) *EmailOutboxHandler {
+	return &EmailOutboxHandler{db: db, outbox: outbox}
+}
+
+// ListMessages 查询发件箱消息（不返回正文）
+// GET /api/v1/admin/email-outbox
+func (h *EmailOutboxHandler) ListMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > 200 {
+			pageSize = 20
+		}
+
+		query := h.db.Model(&models.EmailOutbox{})
+		for param, column := range map[string]string{
+			"status":      "status",
+			"to":          "to_address",
+			"template":    "template",
+			"project_key": "project_key",
+			"message_id":  "message_id",
+		} {
+			if v := c.Query(param); v != "" {
+				query = query.Where(column+" = ?", v)
+			}
+		}
+
+		var total int64
+		query.Count(&total)
+		var messages []models.EmailOutbox
+		if err := query.Omit("html_body", "text_body").Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&messages).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to retrieve email outbox",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Email outbox retrieved successfully",
+			Data: gin.H{
+				"messages": messages,
+				"pagination": gin.H{
+					"page":        page,
+					"page_size":   pageSize,
+					"total":       total,
+					"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+				},
+			},
+		})
+	}
+}
+
+// GetStats 发件箱队列统计
+// GET /api/v1/admin/email-outbox/stats
+func (h *EmailOutboxHandler) GetStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := h.outbox.Stats()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve email outbox stats"})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Email outbox stats retrieved successfully", Data: stats})
+	}
+}
+
+// RetryMessage 将死信消息重新放回队列
+// POST /api/v1/admin/email-outbox/:id/retry
+func (h *EmailOutboxHandler) RetryMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid message id"})
+			return
+		}
+		msg, err := h.outbox.Retry(uint(id))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrEmailOutboxNotFound):
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+			case errors.Is(err, services.ErrEmailOutboxNotRetryable):
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retry email"})
+			}
+			return
+		}
+
+		middleware.SetAuditAction(c, "email_outbox.retry")
+		middleware.SetAuditTarget(c, "email_outboxes", msg.MessageID)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Email requeued successfully", Data: msg})
+	}
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+	"unit-auth/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EmailTemplateHandler 邮件模板管理（管理员）：内置模板、按项目/语言的覆盖、项目品牌与预览
+type EmailTemplateHandler struct {
+	db        *gorm.DB
+	templates *services.EmailTemplateService
+}
+
+// NewEmailTemplateHandler 创建邮件模板处理器
+func NewEmailTemplateHandler(db *gorm.DB, templates *services.EmailTemplateService) *EmailTemplateHandler {
+	return &EmailTemplateHandler{db: db, templates: templates}
+}
+
+// ListTemplates 内置模板、支持的语言与示例变量
+// GET /api/v1/admin/email-templates
+func (h *EmailTemplateHandler) ListTemplates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Email templates retrieved successfully",
+			Data: gin.H{
+				"templates":      utils.EmailTemplateList(),
+				"locales":        utils.EmailLocales(),
+				"default_locale": utils.MatchEmailLocale(),
+			},
+		})
+	}
+}
+
+// ListOverrides 模板覆盖列表，可按 project_key、template_key 过滤
+// GET /api/v1/admin/email-templates/overrides
+func (h *EmailTemplateHandler) ListOverrides() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := h.db.Where("type = ?", services.NotificationTypeEmail)
+		if projectKey, ok := c.GetQuery("project_key"); ok {
+			query = query.Where("project_key = ?", projectKey)
+		}
+		if key := c.Query("template_key"); key != "" {
+			query = query.Where("template_key = ?", key)
+		}
+		var overrides []models.NotificationTemplate
+		if err := query.Order("template_key ASC, project_key ASC, locale ASC").Find(&overrides).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve email template overrides"})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Email template overrides retrieved successfully", Data: overrides})
+	}
+}
+
+// CreateOverride 新增模板覆盖，保存前使用示例变量校验可渲染
+// POST /api/v1/admin/email-templates/overrides
+func (h *EmailTemplateHandler) CreateOverride() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.EmailTemplateOverrideRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+
+		tpl := models.NotificationTemplate{Type: services.NotificationTypeEmail, IsActive: true}
+		applyEmailTemplateOverrideRequest(&tpl, &req)
+		if msg := h.validateOverride(&tpl); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+
+		if err := h.db.Create(&tpl).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create email template override"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "email_template.create")
+		middleware.SetAuditTarget(c, "notification_templates", tpl.Name)
+		middleware.SetAuditChange(c, nil, tpl)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Email template override created successfully", Data: tpl})
+	}
+}
+
+// UpdateOverride 更新模板覆盖
+// PUT /api/v1/admin/email-templates/overrides/:id
+func (h *EmailTemplateHandler) UpdateOverride() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.EmailTemplateOverrideRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+
+		var tpl models.NotificationTemplate
+		if err := h.db.Where("id = ? AND type = ?", c.Param("id"), services.NotificationTypeEmail).First(&tpl).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "Email template override not found"})
+			return
+		}
+		before := tpl
+
+		applyEmailTemplateOverrideRequest(&tpl, &req)
+		if msg := h.validateOverride(&tpl); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+
+		if err := h.db.Save(&tpl).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to update email template override"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "email_template.update")
+		middleware.SetAuditTarget(c, "notification_templates", tpl.Name)
+		middleware.SetAuditChange(c, before, tpl)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Email template override updated successfully", Data: tpl})
+	}
+}
+
+// DeleteOverride 删除模板覆盖，恢复使用内置模板
+// DELETE /api/v1/admin/email-templates/overrides/:id
+func (h *EmailTemplateHandler) DeleteOverride() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var tpl models.NotificationTemplate
+		if err := h.db.Where("id = ? AND type = ?", c.Param("id"), services.NotificationTypeEmail).First(&tpl).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "Email template override not found"})
+			return
+		}
+		if err := h.db.Delete(&tpl).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to delete email template override"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "email_template.delete")
+		middleware.SetAuditTarget(c, "notification_templates", tpl.Name)
+		middleware.SetAuditChange(c, tpl, nil)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Email template override deleted successfully"})
+	}
+}
+
+// Preview 使用示例变量（可被 variables 覆盖）渲染模板，返回主题、HTML 与纯文本
+// POST /api/v1/admin/email-templates/preview
+func (h *EmailTemplateHandler) Preview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.EmailTemplatePreviewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		if !utils.IsEmailTemplateKey(req.TemplateKey) {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "Email template not found"})
+			return
+		}
+
+		var draft *utils.EmailTemplateOverride
+		if req.Subject != "" || req.Content != "" || req.TextContent != "" {
+			draft = &utils.EmailTemplateOverride{Subject: req.Subject, HTML: req.Content, Text: req.TextContent}
+		}
+		locale := req.Locale
+		if locale == "" {
+			locale = c.GetHeader("Accept-Language")
+		}
+		rendered, err := h.templates.Preview(utils.EmailContext{ProjectKey: req.ProjectKey, Locale: locale}, req.TemplateKey, draft, req.Variables)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Failed to render template: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Email template rendered successfully", Data: rendered})
+	}
+}
+
+// UpdateProjectBranding 更新项目的邮件品牌（名称、发件人名称、品牌色、Logo）
+// PUT /api/v1/admin/projects/:key/email-branding
+func (h *EmailTemplateHandler) UpdateProjectBranding() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ProjectEmailBrandingRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		if req.BrandColor != "" && !utils.IsValidEmailBrandColor(req.BrandColor) {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "brand_color must be #RGB or #RRGGBB"})
+			return
+		}
+
+		var project models.Project
+		if err := h.db.Where("`key` = ?", c.Param("key")).First(&project).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "Project not found"})
+			return
+		}
+		before := h.templates.Branding(project.Key)
+
+		updates := map[string]interface{}{
+			"email_brand_name":  strings.TrimSpace(req.BrandName),
+			"email_sender_name": strings.TrimSpace(req.SenderName),
+			"email_brand_color": req.BrandColor,
+			"email_logo_url":    req.LogoURL,
+		}
+		if err := h.db.Model(&project).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to update project branding"})
+			return
+		}
+		after := h.templates.Branding(project.Key)
+
+		middleware.SetAuditAction(c, "project.email_branding_update")
+		middleware.SetAuditTarget(c, "projects", project.Key)
+		middleware.SetAuditChange(c, before, after)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Project branding updated successfully", Data: after})
+	}
+}
+
+func applyEmailTemplateOverrideRequest(tpl *models.NotificationTemplate, req *models.EmailTemplateOverrideRequest) {
+	tpl.TemplateKey = req.TemplateKey
+	tpl.ProjectKey = strings.TrimSpace(req.ProjectKey)
+	tpl.Locale = strings.TrimSpace(req.Locale)
+	tpl.Name = strings.TrimSpace(req.Name)
+	if tpl.Name == "" {
+		tpl.Name = strings.Trim(strings.Join([]string{tpl.TemplateKey, tpl.ProjectKey, tpl.Locale}, ":"), ":")
+	}
+	tpl.Description = req.Description
+	tpl.Subject = req.Subject
+	tpl.Content = req.Content
+	tpl.TextContent = req.TextContent
+	if req.IsActive != nil {
+		tpl.IsActive = *req.IsActive
+	}
+}
+
+// validateOverride 校验模板 Key、语言、项目、作用域唯一，并用示例变量试渲染
+func (h *EmailTemplateHandler) validateOverride(tpl *models.NotificationTemplate) string {
+	if !utils.IsEmailTemplateKey(tpl.TemplateKey) {
+		return "Unknown template_key"
+	}
+	if tpl.Subject == "" && tpl.Content == "" && tpl.TextContent == "" {
+		return "At least one of subject, content or text_content is required"
+	}
+	if tpl.Locale != "" {
+		supported := false
+		for _, locale := range utils.EmailLocales() {
+			if locale == tpl.Locale {
+				supported = true
+			}
+		}
+		if !supported {
+			return "Unsupported locale, expected one of: " + strings.Join(utils.EmailLocales(), ", ")
+		}
+	}
+	if tpl.ProjectKey != "" {
+		var cnt int64
+		h.db.Model(&models.Project{}).Where("`key` = ?", tpl.ProjectKey).Count(&cnt)
+		if cnt == 0 {
+			return "Project not found"
+		}
+	}
+
+	var cnt int64
+	h.db.Model(&models.NotificationTemplate{}).
+		Where("type = ? AND template_key = ? AND project_key = ? AND locale = ? AND id <> ?",
+			tpl.Type, tpl.TemplateKey, tpl.ProjectKey, tpl.Locale, tpl.ID).
+		Count(&cnt)
+	if cnt > 0 {
+		return "An override for this template, project and locale already exists"
+	}
+
+	locale := tpl.Locale
+	if locale == "" {
+		locale = utils.MatchEmailLocale()
+	}
+	override := &utils.EmailTemplateOverride{Subject: tpl.Subject, HTML: tpl.Content, Text: tpl.TextContent}
+	if _, err := utils.RenderEmailTemplate(tpl.TemplateKey, locale, override, utils.DefaultEmailBranding(), utils.EmailTemplateSample(tpl.TemplateKey)); err != nil {
+		return "Invalid template: " + err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"strings"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EmailUnsubscribe 通知类邮件退订（List-Unsubscribe 链接）
+// GET  /api/v1/email/unsubscribe?token=... 展示确认页（避免邮件安全扫描器访问链接即退订）
+// POST /api/v1/email/unsubscribe?token=... 执行退订；正文为 List-Unsubscribe=One-Click 时为邮箱客户端的一键退订（RFC 8058）
+func EmailUnsubscribe(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			token = c.PostForm("token")
+		}
+		email, err := utils.ParseEmailUnsubscribeToken(token)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid unsubscribe token"})
+			return
+		}
+
+		if c.Request.Method == http.MethodGet {
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>Unsubscribe</title></head><body>`+
+				`<p>`+html.EscapeString(email)+` 将不再收到欢迎、登录提醒等通知邮件（验证码与账户安全邮件仍会发送）。</p>`+
+				`<form method="post"><input type="hidden" name="token" value="`+html.EscapeString(token)+`"><button type="submit">确认退订 / Unsubscribe</button></form>`+
+				`</body></html>`))
+			return
+		}
+
+		source := "link"
+		if c.PostForm("List-Unsubscribe") == "One-Click" {
+			source = "one_click"
+		}
+		record := models.EmailUnsubscribe{Email: strings.ToLower(email), Source: source}
+		if err := db.Where("email = ?", record.Email).FirstOrCreate(&record).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to unsubscribe"})
+			return
+		}
+
+		if source == "one_click" {
+			c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Unsubscribed successfully"})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>Unsubscribed</title></head><body>`+
+			`<p>已退订 / Unsubscribed: `+html.EscapeString(email)+`</p></body></html>`))
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"unit-auth/models"
+	"unit-auth/plugins"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IdentityHandler 已登录用户的第三方身份绑定管理
+type IdentityHandler struct {
+	db            *gorm.DB
+	pluginManager *plugins.PluginManager
+	oauthTx       *services.OAuthTransactionService
+}
+
+// NewIdentityHandler 创建身份绑定处理器
+func NewIdentityHandler(db *gorm.DB, pluginManager *plugins.PluginManager, oauthTx *services.OAuthTransactionService) *IdentityHandler {
+	return &IdentityHandler{db: db, pluginManager: pluginManager, oauthTx: oauthTx}
+}
+
+// ListIdentities 获取当前用户已绑定的第三方身份
+// GET /api/v1/user/identities
+func (h *IdentityHandler) ListIdentities() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identities, err := services.ListIdentities(h.db, c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve identities"})
+			return
+		}
+		list := make([]models.UserIdentityResponse, 0, len(identities))
+		for i := range identities {
+			list = append(list, identities[i].ToResponse())
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Identities retrieved successfully", Data: list})
+	}
+}
+
+// GetLinkURL 获取绑定第三方账号的授权URL
+// GET /api/v1/user/identities/:provider/link-url
+func (h *IdentityHandler) GetLinkURL() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := h.linkableProvider(c)
+		if !ok {
+			return
+		}
+		pkce, nonce := oauthCapabilities(provider)
+		oauthTx, err := h.oauthTx.Begin(services.BeginOAuthOptions{
+			Provider:  provider.GetName(),
+			Purpose:   models.OAuthPurposeLink,
+			UserID:    c.GetString("user_id"),
+			Binding:   oauthBinding(c, h.oauthTx.TTL()),
+			IP:        c.ClientIP(),
+			UserAgent: c.GetHeader("User-Agent"),
+			PKCE:      pkce,
+			Nonce:     nonce,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to start OAuth transaction"})
+			return
+		}
+		ctx := plugins.WithOAuthParams(c.Request.Context(), oauthParams(oauthTx))
+		authURL, err := provider.GetAuthURL(ctx, oauthTx.State)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to generate OAuth URL"})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "OAuth URL generated", Data: gin.H{"auth_url": authURL, "state": oauthTx.State, "expires_at": oauthTx.ExpiresAt}})
+	}
+}
+
+// LinkIdentity 使用授权码将第三方账号绑定到当前用户
+// POST /api/v1/user/identities/:provider/link
+func (h *IdentityHandler) LinkIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.LinkIdentityRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		provider, ok := h.linkableProvider(c)
+		if !ok {
+			return
+		}
+
+		binding, _ := c.Cookie(services.OAuthBindingCookie)
+		oauthTx, err := h.oauthTx.Consume(services.ConsumeOAuthOptions{
+			State:    req.State,
+			Provider: provider.GetName(),
+			Purpose:  models.OAuthPurposeLink,
+			UserID:   c.GetString("user_id"),
+			Binding:  binding,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
+			return
+		}
+
+		ctx := plugins.WithOAuthParams(c.Request.Context(), oauthParams(oauthTx))
+		ext, err := provider.(plugins.IdentityFetcher).FetchIdentity(ctx, req.Code, req.State)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: "Failed to verify provider account: " + err.Error()})
+			return
+		}
+
+		identity, err := services.LinkIdentity(h.db, c.GetString("user_id"), ext)
+		if err != nil {
+			if errors.Is(err, services.ErrIdentityAlreadyLinked) || errors.Is(err, services.ErrIdentityProviderLinked) {
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to link identity"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Identity linked successfully", Data: identity.ToResponse()})
+	}
+}
+
+// UnlinkIdentity 解绑第三方账号（不允许解绑最后一种登录方式）
+// DELETE /api/v1/user/identities/:provider
+func (h *IdentityHandler) UnlinkIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, err := services.UnlinkIdentity(h.db, c.GetString("user_id"), c.Param("provider"))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrIdentityNotFound):
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+			case errors.Is(err, services.ErrLastLoginMethod):
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to unlink identity"})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Identity unlinked successfully", Data: identity.ToResponse()})
+	}
+}
+
+// linkableProvider 获取支持绑定的提供者，失败时直接写入响应
+func (h *IdentityHandler) linkableProvider(c *gin.Context) (plugins.AuthProvider, bool) {
+	provider, err := h.pluginManager.GetEnabledProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "OAuth provider not available"})
+		return nil, false
+	}
+	if _, ok := provider.(plugins.IdentityFetcher); !ok {
+		c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Provider does not support account linking"})
+		return nil, false
+	}
+	return provider, true
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+	"unit-auth/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 模拟登录token默认有效期
+const defaultImpersonationTTL = 15 * time.Minute
+
+// StartImpersonation 管理员模拟登录指定用户
+// POST /api/v1/admin/users/:id/impersonate
+func StartImpersonation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID := c.GetString("user_id")
+		userID := c.Param("id")
+
+		var req models.ImpersonateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "Invalid request data: " + err.Error(),
+			})
+			return
+		}
+
+		middleware.SetAuditAction(c, "user.impersonate.start")
+		middleware.SetAuditTarget(c, "users", userID)
+		middleware.AddAuditDetail(c, "reason", req.Reason)
+
+		var user models.User
+		if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{
+				Code:    404,
+				Message: "User not found",
+			})
+			return
+		}
+
+		// 不允许模拟自己或其他管理员
+		if user.ID == adminID || user.Role == "admin" {
+			c.JSON(http.StatusForbidden, models.Response{
+				Code:    403,
+				Message: "Cannot impersonate this user",
+			})
+			return
+		}
+
+		localUserID := ""
+		if req.ProjectKey != "" {
+			var mapping models.ProjectMapping
+			if err := db.Where("user_id = ? AND project_name = ? AND is_active = ?", user.ID, req.ProjectKey, true).First(&mapping).Error; err != nil {
+				c.JSON(http.StatusBadRequest, models.Response{
+					Code:    400,
+					Message: "User has no mapping in project " + req.ProjectKey,
+				})
+				return
+			}
+			localUserID = mapping.LocalUserID
+		}
+
+		ttl := defaultImpersonationTTL
+		if req.TTLMinutes > 0 {
+			ttl = time.Duration(req.TTLMinutes) * time.Minute
+		}
+
+		identifier := user.Username
+		if user.Email != nil {
+			identifier = *user.Email
+		}
+		token, jti, expiresAt, err := utils.GenerateImpersonationToken(user.ID, identifier, user.Role, req.ProjectKey, localUserID, adminID, ttl)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to generate token",
+			})
+			return
+		}
+
+		visible := true
+		if req.VisibleToUser != nil {
+			visible = *req.VisibleToUser
+		}
+		session := models.ImpersonationSession{
+			ID:            uuid.New().String(),
+			AdminID:       adminID,
+			UserID:        user.ID,
+			TokenID:       jti,
+			ProjectKey:    req.ProjectKey,
+			Reason:        req.Reason,
+			IP:            c.ClientIP(),
+			UserAgent:     c.GetHeader("User-Agent"),
+			VisibleToUser: visible,
+			ExpiresAt:     expiresAt,
+		}
+		if err := db.Create(&session).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to create impersonation session",
+			})
+			return
+		}
+
+		middleware.AddAuditDetail(c, "session_id", session.ID)
+		middleware.AddAuditDetail(c, "project_key", req.ProjectKey)
+		middleware.AddAuditDetail(c, "expires_at", expiresAt.Format(time.RFC3339))
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Impersonation started",
+			Data: gin.H{
+				"session_id": session.ID,
+				"token":      token,
+				"token_type": "Bearer",
+				"expires_in": int64(ttl.Seconds()),
+				"expires_at": expiresAt,
+				"user":       user.ToResponse(),
+			},
+		})
+	}
+}
+
+// StopImpersonation 结束模拟登录会话，对应token立即失效
+// POST /api/v1/admin/impersonations/:id/stop
+func StopImpersonation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID := c.Param("id")
+		middleware.SetAuditAction(c, "user.impersonate.stop")
+		middleware.AddAuditDetail(c, "session_id", sessionID)
+
+		var session models.ImpersonationSession
+		if err := db.Where("id = ?", sessionID).First(&session).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{
+				Code:    404,
+				Message: "Impersonation session not found",
+			})
+			return
+		}
+		middleware.SetAuditTarget(c, "users", session.UserID)
+
+		if session.EndedAt != nil {
+			c.JSON(http.StatusOK, models.Response{
+				Code:    200,
+				Message: "Impersonation already stopped",
+				Data:    session,
+			})
+			return
+		}
+
+		now := time.Now()
+		session.EndedAt = &now
+		session.EndedBy = c.GetString("user_id")
+		if err := db.Model(&session).Updates(map[string]interface{}{
+			"ended_at": session.EndedAt,
+			"ended_by": session.EndedBy,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to stop impersonation",
+			})
+			return
+		}
+		services.Events.Publish(db, services.UserEvent{
+			Type:    services.EventSessionRevoked,
+			UserID:  session.UserID,
+			ActorID: session.EndedBy,
+			Data: map[string]interface{}{
+				"session_id": session.ID,
+				"reason":     "impersonation_stopped",
+			},
+		})
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Impersonation stopped",
+			Data:    session,
+		})
+	}
+}
+
+// ListImpersonations 查询模拟登录会话（管理员）
+// GET /api/v1/admin/impersonations
+func ListImpersonations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Model(&models.ImpersonationSession{})
+		if v := c.Query("user_id"); v != "" {
+			query = query.Where("user_id = ?", v)
+		}
+		if v := c.Query("admin_id"); v != "" {
+			query = query.Where("admin_id = ?", v)
+		}
+		if c.Query("active") == "true" {
+			query = query.Where("ended_at IS NULL AND expires_at > ?", time.Now())
+		}
+
+		var sessions []models.ImpersonationSession
+		if err := query.Order("created_at DESC").Limit(200).Find(&sessions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to retrieve impersonation sessions",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Impersonation sessions retrieved successfully",
+			Data:    sessions,
+		})
+	}
+}
+
+// GetMyImpersonations 当前用户查看被管理员模拟登录的记录
+// GET /api/v1/user/impersonations
+func GetMyImpersonations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+
+		var sessions []models.ImpersonationSession
+		if err := db.Where("user_id = ? AND visible_to_user = ?", userID, true).
+			Order("created_at DESC").Limit(50).Find(&sessions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to retrieve impersonation sessions",
+			})
+			return
+		}
+
+		list := make([]gin.H, 0, len(sessions))
+		for _, s := range sessions {
+			list = append(list, gin.H{
+				"id":         s.ID,
+				"reason":     s.Reason,
+				"active":     s.IsActive(),
+				"expires_at": s.ExpiresAt,
+				"ended_at":   s.EndedAt,
+				"created_at": s.CreatedAt,
+			})
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Impersonation sessions retrieved successfully",
+			Data:    list,
+		})
+	}
+}
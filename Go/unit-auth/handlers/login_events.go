@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"io"
+	"time"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SSE 心跳间隔，避免代理断开空闲连接
+	loginEventHeartbeat = 15 * time.Second
+	// 兜底轮询间隔：事件由其他实例发布（未接入共享消息中间件）时仍能感知状态变化
+	loginEventFallbackPoll = 5 * time.Second
+)
+
+// streamLoginEvents 以 Server-Sent Events 推送跨设备登录状态：先发送当前快照，
+// 之后推送订阅到的事件，直到终态、过期或客户端断开。
+// snapshot 从存储中读取当前状态，用于首次推送与兜底轮询。
+// 发布的 confirmed 事件不携带登录结果，收到后改为推送 snapshot（由 snapshot 领取只交付一次的 Token）。
+func streamLoginEvents(c *gin.Context, events <-chan services.LoginEvent, expiresAt time.Time, snapshot func() services.LoginEvent) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	last := snapshot()
+	sendLoginEvent(c, last)
+	if last.Terminal() {
+		return
+	}
+
+	heartbeat := time.NewTicker(loginEventHeartbeat)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(loginEventFallbackPoll)
+	defer poll.Stop()
+	expiry := time.NewTimer(time.Until(expiresAt))
+	defer expiry.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Status == services.LoginStatusConfirmed {
+				event = snapshot()
+			}
+			last = event
+			sendLoginEvent(c, event)
+			if event.Terminal() {
+				return
+			}
+		case <-poll.C:
+			if current := snapshot(); current.Status != last.Status {
+				last = current
+				sendLoginEvent(c, current)
+				if current.Terminal() {
+					return
+				}
+			}
+		case <-expiry.C:
+			sendLoginEvent(c, services.LoginEvent{Status: services.LoginStatusExpired, Message: "Login request expired", At: time.Now()})
+			return
+		case <-heartbeat.C:
+			io.WriteString(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+func sendLoginEvent(c *gin.Context, event services.LoginEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	c.SSEvent(event.Status, event)
+	c.Writer.Flush()
+}
@@ -44,6 +44,17 @@ func (h *MonitoringHandler) GetMetrics(c *gin.Context) {
 	})
 }
 
+// GetProjectClientStats 获取各项目接口调用统计
+func (h *MonitoringHandler) GetProjectClientStats(c *gin.Context) {
+	stats := h.monitoringService.GetProjectClientStats()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Project client stats retrieved successfully",
+		"data":    stats,
+	})
+}
+
 // GetUserActivityStats 获取用户活跃度统计
 func (h *MonitoringHandler) GetUserActivityStats(c *gin.Context) {
 	stats := h.monitoringService.GetActiveUsersStats()
@@ -49,8 +49,16 @@ func IntrospectToken() gin.HandlerFunc {
 			c.JSON(http.StatusOK, gin.H{"active": false})
 			return
 		}
+		if claims.IsImpersonation() && !models.IsImpersonationTokenActive(models.GetDB(), claims.ID) {
+			c.JSON(http.StatusOK, gin.H{"active": false})
+			return
+		}
+		if models.IsTokenRevoked(models.GetDB(), claims) {
+			c.JSON(http.StatusOK, gin.H{"active": false})
+			return
+		}
 		exp := claims.ExpiresAt.Time
-		c.JSON(http.StatusOK, gin.H{
+		resp := gin.H{
 			"active":        true,
 			"user_id":       claims.UserID,
 			"email":         claims.Email,
@@ -60,7 +68,11 @@ func IntrospectToken() gin.HandlerFunc {
 			"token_type":    claims.TokenType,
 			"exp":           exp.Unix(),
 			"expires_at":    exp.Format(time.RFC3339),
-		})
+		}
+		if claims.IsImpersonation() {
+			resp["act"] = gin.H{"sub": claims.ActorID}
+		}
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
@@ -80,6 +92,15 @@ func TokenExchange() gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: "invalid subject token"})
 			return
 		}
+		if models.IsTokenRevoked(models.GetDB(), claims) {
+			c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: "subject token has been revoked"})
+			return
+		}
+		// 模拟登录token不可换发为普通token，否则会丢失 act 声明
+		if claims.IsImpersonation() {
+			c.JSON(http.StatusForbidden, models.Response{Code: 403, Message: "impersonation token cannot be exchanged"})
+			return
+		}
 		// 生成一个更短期、指定受众的访问令牌（仍使用相同密钥示例）
 		token, err := utils.GenerateAccessTokenWithAudience(claims.UserID, claims.Email, claims.Role, req.Audience, claims.ProjectKey, claims.LocalUserID)
 		if err != nil {
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"unit-auth/middleware"
+	"unit-auth/services"
+	"unit-auth/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// requestPhone 按当前项目的默认地区将请求中的手机号规范化为 E.164
+func requestPhone(c *gin.Context, db *gorm.DB, raw string) (string, error) {
+	return services.NormalizeProjectPhone(db, c.GetString(middleware.CtxProjectKey), raw)
+}
+
+// identifyLoginAccount 识别登录账号类型；手机号按当前项目的默认地区规范化为 E.164 后返回
+func identifyLoginAccount(c *gin.Context, db *gorm.DB, account string) (utils.AccountType, string) {
+	region := services.ProjectPhoneRegion(db, c.GetString(middleware.CtxProjectKey))
+	accountType := utils.IdentifyAccountTypeInRegion(account, region)
+	if accountType == utils.AccountTypePhone {
+		if phone, err := utils.NormalizePhone(account, region); err == nil {
+			return accountType, phone
+		}
+	}
+	return accountType, account
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 	"unit-auth/middleware"
 	"unit-auth/models"
 	"unit-auth/plugins"
@@ -17,14 +19,16 @@ type PluginAuthHandler struct {
 	db            *gorm.DB
 	pluginManager *plugins.PluginManager
 	statsService  *services.StatsService
+	oauthTx       *services.OAuthTransactionService
 }
 
 // NewPluginAuthHandler 创建插件认证处理器
-func NewPluginAuthHandler(db *gorm.DB, pluginManager *plugins.PluginManager, statsService *services.StatsService) *PluginAuthHandler {
+func NewPluginAuthHandler(db *gorm.DB, pluginManager *plugins.PluginManager, statsService *services.StatsService, oauthTx *services.OAuthTransactionService) *PluginAuthHandler {
 	return &PluginAuthHandler{
 		db:            db,
 		pluginManager: pluginManager,
 		statsService:  statsService,
+		oauthTx:       oauthTx,
 	}
 }
 
@@ -38,13 +42,13 @@ func (h *PluginAuthHandler) Login() gin.HandlerFunc {
 		}
 		ip := c.ClientIP()
 		userAgent := c.GetHeader("User-Agent")
-		provider, exists := h.pluginManager.GetProvider("email")
-		if !exists {
-			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Email authentication provider not available"})
-			return
+		attempt := &plugins.AuthAttempt{
+			Provider:    "email",
+			Credentials: map[string]interface{}{"email": req.Email, "password": req.Password},
+			IP:          ip,
+			UserAgent:   userAgent,
 		}
-		credentials := map[string]interface{}{"email": req.Email, "password": req.Password}
-		user, err := provider.Authenticate(c.Request.Context(), credentials)
+		user, err := h.pluginManager.Authenticate(c.Request.Context(), attempt)
 		if err != nil {
 			h.statsService.RecordLoginLog("", "email", ip, userAgent, "", false, err.Error())
 			c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: err.Error()})
@@ -67,7 +71,7 @@ func (h *PluginAuthHandler) Login() gin.HandlerFunc {
 		if user.Email != nil {
 			identifier = *user.Email
 		}
-		token, err := utils.GenerateUnifiedToken(user.ID, identifier, user.Role, projectKey, localID)
+		token, err := utils.GenerateUnifiedTokenWithClaims(user.ID, identifier, user.Role, projectKey, localID, attempt.Claims)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to generate token"})
 			return
@@ -89,13 +93,13 @@ func (h *PluginAuthHandler) PhoneLogin() gin.HandlerFunc {
 		}
 		ip := c.ClientIP()
 		userAgent := c.GetHeader("User-Agent")
-		provider, exists := h.pluginManager.GetProvider("phone")
-		if !exists {
-			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Phone authentication provider not available"})
-			return
+		attempt := &plugins.AuthAttempt{
+			Provider:    "phone",
+			Credentials: map[string]interface{}{"phone": req.Phone, "code": req.Code},
+			IP:          ip,
+			UserAgent:   userAgent,
 		}
-		credentials := map[string]interface{}{"phone": req.Phone, "code": req.Code}
-		user, err := provider.Authenticate(c.Request.Context(), credentials)
+		user, err := h.pluginManager.Authenticate(c.Request.Context(), attempt)
 		if err != nil {
 			h.statsService.RecordLoginLog("", "phone", ip, userAgent, "", false, err.Error())
 			c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: err.Error()})
@@ -116,7 +120,7 @@ func (h *PluginAuthHandler) PhoneLogin() gin.HandlerFunc {
 				localID = pm.LocalUserID
 			}
 		}
-		token, err := utils.GenerateUnifiedToken(user.ID, identifier, user.Role, projectKey, localID)
+		token, err := utils.GenerateUnifiedTokenWithClaims(user.ID, identifier, user.Role, projectKey, localID, attempt.Claims)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to generate token"})
 			return
@@ -137,14 +141,47 @@ func (h *PluginAuthHandler) OAuthLogin() gin.HandlerFunc {
 		}
 		ip := c.ClientIP()
 		userAgent := c.GetHeader("User-Agent")
-		provider, exists := h.pluginManager.GetProvider(req.Provider)
-		if !exists {
-			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "OAuth provider not available"})
+		projectKey := ""
+		if v, ok := c.Get(middleware.CtxProjectKey); ok {
+			projectKey = v.(string)
+		}
+
+		// 校验并消费服务端 OAuth 事务（state 绑定浏览器、提供者与项目，一次性）
+		binding, _ := c.Cookie(services.OAuthBindingCookie)
+		oauthTx, err := h.oauthTx.Consume(services.ConsumeOAuthOptions{
+			State:      req.State,
+			Provider:   req.Provider,
+			ProjectKey: projectKey,
+			Binding:    binding,
+		})
+		if err != nil {
+			h.statsService.RecordLoginLog("", req.Provider, ip, userAgent, "", false, err.Error())
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
 			return
 		}
-		user, err := provider.HandleCallback(c, req.Code, req.State)
+		// OAuth 参数（code_verifier、nonce）附加在请求上下文上：gin.Context.Value 默认不回退到 Request.Context()
+		ctx := services.WithProjectKey(plugins.WithOAuthParams(c.Request.Context(), oauthParams(oauthTx)), projectKey)
+
+		attempt := &plugins.AuthAttempt{
+			Provider:  req.Provider,
+			Code:      req.Code,
+			State:     req.State,
+			IP:        ip,
+			UserAgent: userAgent,
+		}
+		user, err := h.pluginManager.HandleCallback(ctx, attempt)
 		if err != nil {
 			h.statsService.RecordLoginLog("", req.Provider, ip, userAgent, "", false, err.Error())
+			// 邮箱 / 手机号已被未验证账号占用：需登录后在账号设置中手动绑定
+			if errors.Is(err, services.ErrIdentityEmailConflict) || errors.Is(err, services.ErrIdentityPhoneConflict) {
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+				return
+			}
+			// 用户与身份已创建、项目账号仍在开通：与注册接口一致返回 202 / 502，客户端稍后重新登录
+			if errors.Is(err, services.ErrProvisioningPending) || errors.Is(err, services.ErrProvisioningFailed) {
+				respondRegistrationError(c, err)
+				return
+			}
 			c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: err.Error()})
 			return
 		}
@@ -154,10 +191,6 @@ func (h *PluginAuthHandler) OAuthLogin() gin.HandlerFunc {
 		} else if user.Phone != nil && *user.Phone != "" {
 			identifier = *user.Phone
 		}
-		projectKey := ""
-		if v, ok := c.Get(middleware.CtxProjectKey); ok {
-			projectKey = v.(string)
-		}
 		localID := ""
 		if projectKey != "" {
 			var pm models.ProjectMapping
@@ -166,25 +199,25 @@ func (h *PluginAuthHandler) OAuthLogin() gin.HandlerFunc {
 			}
 		}
 		// 一定要有 project_name
-		token, err := utils.GenerateUnifiedToken(user.ID, identifier, user.Role, projectKey, localID)
+		token, err := utils.GenerateUnifiedTokenWithClaims(user.ID, identifier, user.Role, projectKey, localID, attempt.Claims)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to generate token"})
 			return
 		}
 		h.statsService.UpdateUserLoginInfo(user.ID, ip, userAgent)
 		h.statsService.RecordLoginLog(user.ID, req.Provider, ip, userAgent, "", true, "")
-		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "OAuth login successful", Data: models.LoginResponse{User: user.ToResponse(), Token: token}})
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "OAuth login successful", Data: models.LoginResponse{User: user.ToResponse(), Token: token, RedirectURI: oauthTx.RedirectURI}})
 	}
 }
 
-// GetOAuthURL 获取OAuth认证URL
+// GetOAuthURL 获取OAuth认证URL（state 由服务端生成；可选 redirect_uri 须在项目白名单内）
 func (h *PluginAuthHandler) GetOAuthURL() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		providerName := c.Param("provider")
-		state := c.Query("state")
+		redirectURI := c.Query("redirect_uri")
 
-		provider, exists := h.pluginManager.GetProvider(providerName)
-		if !exists {
+		provider, err := h.pluginManager.GetEnabledProvider(providerName)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, models.Response{
 				Code:    400,
 				Message: "OAuth provider not available",
@@ -192,7 +225,43 @@ func (h *PluginAuthHandler) GetOAuthURL() gin.HandlerFunc {
 			return
 		}
 
-		authURL, err := provider.GetAuthURL(c.Request.Context(), state)
+		projectKey := ""
+		if v, ok := c.Get(middleware.CtxProjectKey); ok {
+			projectKey = v.(string)
+		}
+		if err := h.oauthTx.ValidateRedirectURI(projectKey, redirectURI); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		pkce, nonce := oauthCapabilities(provider)
+		oauthTx, err := h.oauthTx.Begin(services.BeginOAuthOptions{
+			Provider:    providerName,
+			Purpose:     models.OAuthPurposeLogin,
+			ProjectKey:  projectKey,
+			Binding:     oauthBinding(c, h.oauthTx.TTL()),
+			RedirectURI: redirectURI,
+			IP:          c.ClientIP(),
+			UserAgent:   c.GetHeader("User-Agent"),
+			PKCE:        pkce,
+			Nonce:       nonce,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to start OAuth transaction",
+			})
+			return
+		}
+
+		// 可选 scope：例如公众号网页授权按场景选择 snsapi_base（静默）或 snsapi_userinfo
+		params := oauthParams(oauthTx)
+		params.Scope = c.Query("scope")
+		ctx := plugins.WithOAuthParams(c.Request.Context(), params)
+		authURL, err := provider.GetAuthURL(ctx, oauthTx.State)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
@@ -205,7 +274,9 @@ func (h *PluginAuthHandler) GetOAuthURL() gin.HandlerFunc {
 			Code:    200,
 			Message: "OAuth URL generated",
 			Data: gin.H{
-				"auth_url": authURL,
+				"auth_url":   authURL,
+				"state":      oauthTx.State,
+				"expires_at": oauthTx.ExpiresAt,
 			},
 		})
 	}
@@ -231,3 +302,27 @@ func (h *PluginAuthHandler) GetAvailableProviders() gin.HandlerFunc {
 		})
 	}
 }
+
+// oauthBinding 读取或下发浏览器绑定 Cookie（每次发起授权都会刷新有效期）
+func oauthBinding(c *gin.Context, ttl time.Duration) string {
+	binding, err := c.Cookie(services.OAuthBindingCookie)
+	if err != nil || len(binding) < 32 {
+		binding = services.NewOAuthBinding()
+	}
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(services.OAuthBindingCookie, binding, int(ttl.Seconds()), "/api/v1", "", secure, true)
+	return binding
+}
+
+// oauthCapabilities 提供者是否支持 PKCE / nonce
+func oauthCapabilities(provider plugins.AuthProvider) (pkce bool, nonce bool) {
+	if caps, ok := provider.(plugins.OAuthCapabilities); ok {
+		return caps.SupportsPKCE(), caps.SupportsNonce()
+	}
+	return false, false
+}
+
+func oauthParams(tx *models.OAuthTransaction) plugins.OAuthParams {
+	return plugins.OAuthParams{State: tx.State, CodeVerifier: tx.CodeVerifier, Nonce: tx.Nonce}
+}
@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+	"unit-auth/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var projectKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,63}$`)
+
+// ProjectHandler 项目管理（管理员）：创建、修改、停用、删除项目，轮换凭据，连通性测试
+type ProjectHandler struct {
+	db *gorm.DB
+}
+
+// NewProjectHandler 创建项目管理处理器
+func NewProjectHandler(db *gorm.DB) *ProjectHandler {
+	return &ProjectHandler{db: db}
+}
+
+// ListProjects 项目列表，可按 search（key / 名称）与 enabled 过滤
+// GET /api/v1/admin/projects
+func (h *ProjectHandler) ListProjects() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > 200 {
+			pageSize = 20
+		}
+
+		query := h.db.Model(&models.Project{})
+		if search := strings.TrimSpace(c.Query("search")); search != "" {
+			query = query.Where("`key` LIKE ? OR name LIKE ?", "%"+search+"%", "%"+search+"%")
+		}
+		if enabled := c.Query("enabled"); enabled != "" {
+			query = query.Where("enabled = ?", enabled == "true" || enabled == "1")
+		}
+
+		var total int64
+		query.Count(&total)
+		var projects []models.Project
+		if err := query.Order("id ASC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&projects).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve projects"})
+			return
+		}
+		views := make([]models.ProjectAdminView, 0, len(projects))
+		for i := range projects {
+			views = append(views, projects[i].ToAdminView())
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Projects retrieved successfully",
+			Data: gin.H{
+				"projects": views,
+				"pagination": gin.H{
+					"page":        page,
+					"page_size":   pageSize,
+					"total":       total,
+					"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+				},
+			},
+		})
+	}
+}
+
+// GetProject 项目详情
+// GET /api/v1/admin/projects/:key
+func (h *ProjectHandler) GetProject() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := h.loadProject(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Project retrieved successfully", Data: project.ToAdminView()})
+	}
+}
+
+// CreateProject 新增项目；未提供凭据时按 auth_mode 生成，生成的凭据只在响应中返回一次
+// POST /api/v1/admin/projects
+func (h *ProjectHandler) CreateProject() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ProjectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		req.Key = strings.TrimSpace(req.Key)
+		if !projectKeyPattern.MatchString(req.Key) {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "key must be 2-64 lowercase letters, digits, '_' or '-'"})
+			return
+		}
+		if req.Name == nil || req.BaseURL == nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "name and base_url are required"})
+			return
+		}
+		var cnt int64
+		h.db.Model(&models.Project{}).Where("`key` = ?", req.Key).Count(&cnt)
+		if cnt > 0 {
+			c.JSON(http.StatusConflict, models.Response{Code: 409, Message: "Project key already exists"})
+			return
+		}
+
+		project := models.Project{Key: req.Key, AuthMode: models.ProjectAuthAPIKey, TimeoutMS: 5000, Enabled: true}
+		if msg := applyProjectRequest(&project, &req); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+
+		credentials, generated := req.Credentials, false
+		if credentials == "" && projectNeedsCredentials(project.AuthMode) {
+			var err error
+			if credentials, err = services.NewProjectCredentials(); err != nil {
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to generate project credentials"})
+				return
+			}
+			generated = true
+		}
+		if msg := setProjectCredentials(&project, credentials); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+		if err := h.db.Create(&project).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create project"})
+			return
+		}
+		services.Projects.Invalidate()
+
+		middleware.SetAuditAction(c, "project.create")
+		middleware.SetAuditTarget(c, "projects", project.Key)
+		middleware.SetAuditChange(c, nil, project.ToAdminView())
+
+		data := gin.H{"project": project.ToAdminView()}
+		if generated {
+			data["credentials"] = credentials
+		}
+		c.JSON(http.StatusCreated, models.Response{Code: 201, Message: "Project created successfully", Data: data})
+	}
+}
+
+// UpdateProject 更新项目配置（key 与凭据不在此修改）
+// PUT /api/v1/admin/projects/:key
+func (h *ProjectHandler) UpdateProject() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := h.loadProject(c)
+		if !ok {
+			return
+		}
+		var req models.ProjectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		if req.Key != "" && req.Key != project.Key {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Project key cannot be changed"})
+			return
+		}
+		if req.Credentials != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Use rotate-credentials to change credentials"})
+			return
+		}
+		before := project.ToAdminView()
+		if msg := applyProjectRequest(project, &req); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+		if projectNeedsCredentials(project.AuthMode) && project.CredentialsEnc == "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "auth_mode " + project.AuthMode + " requires credentials, call rotate-credentials first"})
+			return
+		}
+		if err := h.db.Save(project).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to update project"})
+			return
+		}
+		services.Projects.Invalidate()
+
+		middleware.SetAuditAction(c, "project.update")
+		middleware.SetAuditTarget(c, "projects", project.Key)
+		middleware.SetAuditChange(c, before, project.ToAdminView())
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Project updated successfully", Data: project.ToAdminView()})
+	}
+}
+
+// DeleteProject 删除项目；仍有用户映射的项目只能停用
+// DELETE /api/v1/admin/projects/:key
+func (h *ProjectHandler) DeleteProject() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := h.loadProject(c)
+		if !ok {
+			return
+		}
+		var mappings int64
+		h.db.Model(&models.ProjectMapping{}).Where("project_name = ?", project.Key).Count(&mappings)
+		if mappings > 0 {
+			c.JSON(http.StatusConflict, models.Response{
+				Code:    409,
+				Message: "Project still has user mappings, disable it instead",
+				Data:    gin.H{"mappings": mappings},
+			})
+			return
+		}
+
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			// 未执行的开通任务随项目取消，Webhook 订阅随项目删除
+			if err := tx.Model(&models.ProjectProvisioning{}).
+				Where("project_key = ? AND status IN ?", project.Key, []string{models.ProvisioningPending, models.ProvisioningDead}).
+				Update("status", models.ProvisioningCancelled).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("project_key = ?", project.Key).Delete(&models.WebhookSubscription{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(project).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to delete project"})
+			return
+		}
+		services.Projects.Invalidate()
+
+		middleware.SetAuditAction(c, "project.delete")
+		middleware.SetAuditTarget(c, "projects", project.Key)
+		middleware.SetAuditChange(c, project.ToAdminView(), nil)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Project deleted successfully"})
+	}
+}
+
+// RotateCredentials 设置新的项目凭据（留空自动生成），新凭据只在响应中返回一次；项目需同时更新其校验配置
+// POST /api/v1/admin/projects/:key/rotate-credentials
+func (h *ProjectHandler) RotateCredentials() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := h.loadProject(c)
+		if !ok {
+			return
+		}
+		var req models.ProjectCredentialsRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		credentials := strings.TrimSpace(req.Credentials)
+		generated := credentials == ""
+		if generated {
+			var err error
+			if credentials, err = services.NewProjectCredentials(); err != nil {
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to generate project credentials"})
+				return
+			}
+		}
+		if msg := setProjectCredentials(project, credentials); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+		if err := h.db.Model(project).Updates(map[string]interface{}{
+			"credentials_enc":        project.CredentialsEnc,
+			"credentials_rotated_at": project.CredentialsRotatedAt,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to rotate project credentials"})
+			return
+		}
+		services.Projects.Invalidate()
+
+		middleware.SetAuditAction(c, "project.credentials_rotate")
+		middleware.SetAuditTarget(c, "projects", project.Key)
+		middleware.AddAuditDetail(c, "generated", generated)
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Project credentials rotated successfully",
+			Data:    gin.H{"project": project.ToAdminView(), "credentials": credentials},
+		})
+	}
+}
+
+// TestConnection 用试运行用户依次调用项目的创建、更新、删除接口，返回每一步的结果
+// POST /api/v1/admin/projects/:key/test
+func (h *ProjectHandler) TestConnection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := h.loadProject(c)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		report := services.TestProjectConnection(ctx, *project)
+
+		middleware.SetAuditAction(c, "project.test_connection")
+		middleware.SetAuditTarget(c, "projects", project.Key)
+		middleware.AddAuditDetail(c, "ok", report.OK)
+
+		message := "Project connection test passed"
+		if !report.OK {
+			message = "Project connection test failed"
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: message, Data: report})
+	}
+}
+
+// GetIntegrationDocs 生成项目的对接文档（含未启用的项目，便于上线前对接）
+// GET /api/v1/admin/projects/:key/integration-docs
+func (h *ProjectHandler) GetIntegrationDocs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := h.loadProject(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "ok", Data: integrationDocs(c, project)})
+	}
+}
+
+func (h *ProjectHandler) loadProject(c *gin.Context) (*models.Project, bool) {
+	var project models.Project
+	if err := h.db.Where("`key` = ?", c.Param("key")).First(&project).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "Project not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve project"})
+		}
+		return nil, false
+	}
+	return &project, true
+}
+
+func projectNeedsCredentials(authMode string) bool {
+	return authMode == models.ProjectAuthAPIKey || authMode == models.ProjectAuthBearer || authMode == models.ProjectAuthHMAC
+}
+
+func setProjectCredentials(p *models.Project, credentials string) string {
+	if credentials != "" && len(credentials) < 16 {
+		return "credentials must be at least 16 characters"
+	}
+	enc, err := utils.EncryptString(credentials)
+	if err != nil {
+		return "Failed to encrypt credentials"
+	}
+	now := time.Now()
+	p.CredentialsEnc = enc
+	p.CredentialsRotatedAt = &now
+	return ""
+}
+
+// applyProjectRequest 校验并应用请求中提供的字段，返回错误信息
+func applyProjectRequest(p *models.Project, req *models.ProjectRequest) string {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 128 {
+			return "name must be 1-128 characters"
+		}
+		p.Name = name
+	}
+	if req.BaseURL != nil {
+		u, err := url.Parse(strings.TrimSpace(*req.BaseURL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return "base_url must be an absolute http(s) URL without query"
+		}
+		p.BaseURL = strings.TrimRight(u.String(), "/")
+	}
+	if req.AuthMode != nil {
+		if _, ok := projectAuthDocs[*req.AuthMode]; !ok {
+			return "auth_mode must be one of none, api_key, bearer, hmac, mtls"
+		}
+		p.AuthMode = *req.AuthMode
+	}
+	if req.TimeoutMS != nil {
+		if *req.TimeoutMS < 100 || *req.TimeoutMS > 60000 {
+			return "timeout_ms must be between 100 and 60000"
+		}
+		p.TimeoutMS = *req.TimeoutMS
+	}
+	if len(req.RetryPolicy) > 0 {
+		if string(req.RetryPolicy) == "null" {
+			p.RetryPolicy = nil
+		} else {
+			var policy map[string]int
+			if err := json.Unmarshal(req.RetryPolicy, &policy); err != nil {
+				return "retry_policy must be an object of max_retries, backoff_ms, max_backoff_ms"
+			}
+			for field, value := range policy {
+				if field != "max_retries" && field != "backoff_ms" && field != "max_backoff_ms" {
+					return "retry_policy supports only max_retries, backoff_ms, max_backoff_ms"
+				}
+				if value < 0 || (field == "max_retries" && value > 5) {
+					return "retry_policy.max_retries must be 0-5 and backoff values non-negative"
+				}
+			}
+			raw, _ := json.Marshal(policy)
+			p.RetryPolicy = models.JSON(raw)
+		}
+	}
+	if req.Enabled != nil {
+		p.Enabled = *req.Enabled
+	}
+	if req.ClientCertPEM != nil {
+		p.ClientCertPEM = strings.TrimSpace(*req.ClientCertPEM)
+	}
+	if req.ClientKeyPEM != nil {
+		enc, err := utils.EncryptString(strings.TrimSpace(*req.ClientKeyPEM))
+		if err != nil {
+			return "Failed to encrypt client key"
+		}
+		p.ClientKeyEnc = enc
+	}
+	if req.CACertPEM != nil {
+		p.CACertPEM = strings.TrimSpace(*req.CACertPEM)
+		if p.CACertPEM != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(p.CACertPEM)) {
+			return "ca_cert_pem is not a valid PEM certificate"
+		}
+	}
+	if p.AuthMode == models.ProjectAuthMTLS {
+		key, err := utils.DecryptStringOrPlain(p.ClientKeyEnc)
+		if err != nil || p.ClientCertPEM == "" || key == "" {
+			return "auth_mode mtls requires client_cert_pem and client_key_pem"
+		}
+		if _, err := tls.X509KeyPair([]byte(p.ClientCertPEM), []byte(key)); err != nil {
+			return "client_cert_pem and client_key_pem do not form a valid key pair"
+		}
+	}
+	if req.AllowedRedirectURIs != nil {
+		var uris []string
+		for _, item := range strings.FieldsFunc(*req.AllowedRedirectURIs, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			u, err := url.Parse(strings.TrimSuffix(item, "*"))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || u.Fragment != "" {
+				return "Invalid redirect URI: " + item
+			}
+			uris = append(uris, item)
+		}
+		p.AllowedRedirectURIs = strings.Join(uris, "\n")
+	}
+	if req.AllowedOrigins != nil {
+		var origins []string
+		for _, item := range strings.FieldsFunc(*req.AllowedOrigins, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if item = strings.TrimRight(strings.TrimSpace(item), "/"); item == "" {
+				continue
+			}
+			u, err := url.Parse(item)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+				return "Invalid origin (expected scheme://host[:port]): " + item
+			}
+			origins = append(origins, item)
+		}
+		p.AllowedOrigins = strings.Join(origins, "\n")
+	}
+	if req.DefaultPhoneRegion != nil {
+		region := strings.ToUpper(strings.TrimSpace(*req.DefaultPhoneRegion))
+		if region != "" && !utils.IsSupportedPhoneRegion(region) {
+			return "Unsupported default_phone_region"
+		}
+		p.DefaultPhoneRegion = region
+	}
+	if p.Name == "" || p.BaseURL == "" {
+		return "name and base_url are required"
+	}
+	return ""
+}
@@ -2,44 +2,140 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
+	"unit-auth/middleware"
 	"unit-auth/models"
+	"unit-auth/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// GetIntegrationDocs 返回第三方对接示例（便于快速集成）
-func GetIntegrationDocs() gin.HandlerFunc {
+// projectAuthDocs 各认证方式下 unit-auth 调用项目接口时携带的认证信息
+var projectAuthDocs = map[string]string{
+	models.ProjectAuthNone:   "不带认证信息（仅建议内网使用）",
+	models.ProjectAuthAPIKey: "X-Project-Token: <credentials>",
+	models.ProjectAuthBearer: "Authorization: Bearer <credentials>",
+	models.ProjectAuthHMAC:   "X-Unit-Auth-Project, X-Unit-Auth-Timestamp, X-Unit-Auth-Signature: v1=hex(HMAC-SHA256(credentials, timestamp.METHOD.path.body))",
+	models.ProjectAuthMTLS:   "TLS 客户端证书（client_cert_pem）",
+}
+
+// GetIntegrationDocs 返回第三方对接示例（便于快速集成）；
+// 通过 X-Genres-Type 请求头或 project 参数指定项目时，示例中填入该项目的实际配置（不含凭据）
+func GetIntegrationDocs(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		doc := gin.H{
-			"headers": gin.H{
-				"X-Genres-Type": "nature_trans",
-				"Authorization": "Bearer <token>",
+		key := c.Query("project")
+		if key == "" {
+			if v, ok := c.Get(middleware.CtxProjectKey); ok {
+				key = v.(string)
+			}
+		}
+		if key == "" {
+			c.JSON(http.StatusOK, models.Response{Code: 200, Message: "ok", Data: integrationDocs(c, nil)})
+			return
+		}
+		var p models.Project
+		if err := db.Where("`key` = ? AND enabled = ?", key, true).First(&p).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "project not found or disabled"})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "ok", Data: integrationDocs(c, &p)})
+	}
+}
+
+// integrationDocs 生成对接文档；p 为空时使用占位值
+func integrationDocs(c *gin.Context, p *models.Project) gin.H {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	authServer := scheme + "://" + c.Request.Host
+
+	projectKey, baseURL, redirectURI := "<project_key>", "<base_url>", "<redirect_uri>"
+	auth := gin.H{}
+	for mode, desc := range projectAuthDocs {
+		auth[mode] = desc
+	}
+	if p != nil {
+		projectKey, baseURL = p.Key, strings.TrimRight(p.BaseURL, "/")
+		if uris := p.GetAllowedRedirectURIs(); len(uris) > 0 {
+			redirectURI = strings.TrimSuffix(uris[0], "*")
+		}
+		auth = gin.H{p.AuthMode: projectAuthDocs[p.AuthMode]}
+	}
+
+	doc := gin.H{
+		"auth_server": authServer,
+		"headers": gin.H{
+			"X-Genres-Type": projectKey,
+			"Authorization": "Bearer <token>",
+		},
+		"endpoints": []gin.H{
+			{
+				"name":   "获取OAuth授权链接",
+				"method": "GET",
+				"path":   "/api/v1/auth/oauth/:provider/url?redirect_uri=" + redirectURI,
+			},
+			{
+				"name":   "OAuth登录",
+				"method": "POST",
+				"path":   "/api/v1/auth/oauth-login",
+				"body":   gin.H{"provider": "github", "code": "<code>", "state": "<state>"},
+			},
+			{
+				"name":   "邮箱验证码登录",
+				"method": "POST",
+				"path":   "/api/v1/auth/email-login",
+				"body":   gin.H{"email": "user@example.com", "code": "123456"},
+			},
+			{
+				"name":   "令牌交换（换取项目受众的令牌）",
+				"method": "POST",
+				"path":   "/api/v1/auth/token/exchange",
+				"body":   gin.H{"subject_token": "<center_jwt>", "audience": projectKey},
 			},
+			{
+				"name":   "JWKS 公钥",
+				"method": "GET",
+				"path":   "/api/v1/auth/.well-known/jwks.json",
+			},
+		},
+		"mapping": gin.H{
+			"description": "中心化用户与本地用户的映射在 project_mappings 中维护",
+			"fields":      []string{"project_name", "user_id", "local_user_id"},
+		},
+		"provisioning": gin.H{
+			"description": "项目需实现以下接口，由 unit-auth 后台调用并在失败时重试；同一操作重试时 Idempotency-Key 不变，项目应据此返回首次的结果",
 			"endpoints": []gin.H{
-				{
-					"name":   "获取OAuth授权链接",
-					"method": "GET",
-					"path":   "/api/v1/auth/oauth/:provider/url?state=<state>",
-				},
-				{
-					"name":   "OAuth登录",
-					"method": "POST",
-					"path":   "/api/v1/auth/oauth-login",
-					"body":   gin.H{"provider": "github", "code": "<code>", "state": "<state>"},
-				},
-				{
-					"name":   "邮箱验证码登录",
-					"method": "POST",
-					"path":   "/api/v1/auth/email-login",
-					"body":   gin.H{"email": "user@example.com", "code": "123456"},
-				},
+				{"method": "POST", "url": baseURL + "/api/v1/users", "response": gin.H{"user_id": "<local_user_id>"}},
+				{"method": "PUT", "url": baseURL + "/api/v1/users/:local_user_id"},
+				{"method": "DELETE", "url": baseURL + "/api/v1/users/:local_user_id"},
 			},
-			"mapping": gin.H{
-				"description": "中心化用户与本地用户的映射在 project_mappings 中维护",
-				"fields":      []string{"project_name", "user_id", "local_user_id"},
+			"headers": gin.H{
+				"Idempotency-Key":     "同一操作的所有重试相同",
+				"X-Unit-Auth-Dry-Run": "连通性测试时为 true，项目可不落库，但仍应按正常流程校验并返回",
 			},
+			"auth":   auth,
+			"errors": "非 2xx 响应体建议为 {\"code\": \"...\", \"message\": \"...\"}；408、425、429、5xx 视为可重试，其余 4xx 不再重试",
+		},
+	}
+
+	if p != nil {
+		region := p.DefaultPhoneRegion
+		if region == "" {
+			region = utils.DefaultPhoneRegion()
+		}
+		doc["project"] = gin.H{"key": p.Key, "name": p.Name, "base_url": p.BaseURL}
+		doc["redirect"] = gin.H{
+			"description":           "OAuth 等登录完成后只会跳转到以下地址；以 /* 结尾表示该路径前缀下均允许",
+			"allowed_redirect_uris": p.GetAllowedRedirectURIs(),
 		}
-		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "ok", Data: doc})
+		doc["cors"] = gin.H{"allowed_origins": p.GetAllowedOrigins()}
+		doc["phone"] = gin.H{"default_region": region}
+		provisioning := doc["provisioning"].(gin.H)
+		provisioning["timeout_ms"] = p.TimeoutMS
+		provisioning["retry_policy"] = p.GetRetryPolicy()
 	}
+	return doc
 }
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ProvisioningHandler 项目开通发件箱管理（管理员）：查询任务状态、重试死信
+type ProvisioningHandler struct {
+	db     *gorm.DB
+	outbox *services.ProvisioningOutbox
+}
+
+// NewProvisioningHandler 创建项目开通处理器
+func NewProvisioningHandler(db *gorm.DB, outbox *services.ProvisioningOutbox) *ProvisioningHandler {
+	return &ProvisioningHandler{db: db, outbox: outbox}
+}
+
+// ListJobs 查询开通任务，可按 project_key、user_id、operation、status 过滤
+// GET /api/v1/admin/provisioning
+func (h *ProvisioningHandler) ListJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > 200 {
+			pageSize = 20
+		}
+
+		query := h.db.Model(&models.ProjectProvisioning{})
+		for _, column := range []string{"project_key", "user_id", "operation", "status"} {
+			if v := c.Query(column); v != "" {
+				query = query.Where(column+" = ?", v)
+			}
+		}
+
+		var total int64
+		query.Count(&total)
+		var jobs []models.ProjectProvisioning
+		if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&jobs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve provisioning jobs"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Provisioning jobs retrieved successfully",
+			Data: gin.H{
+				"jobs": jobs,
+				"pagination": gin.H{
+					"page":        page,
+					"page_size":   pageSize,
+					"total":       total,
+					"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+				},
+			},
+		})
+	}
+}
+
+// RetryJob 将死信任务重新放回队列
+// POST /api/v1/admin/provisioning/:id/retry
+func (h *ProvisioningHandler) RetryJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid job id"})
+			return
+		}
+		job, err := h.outbox.Retry(uint(id))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrProvisioningNotFound):
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+			case errors.Is(err, services.ErrProvisioningNotRetryable):
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retry provisioning job"})
+			}
+			return
+		}
+
+		middleware.SetAuditAction(c, "provisioning.retry")
+		middleware.SetAuditTarget(c, "users", job.UserID)
+		middleware.AddAuditDetail(c, "job_id", job.ID)
+		middleware.AddAuditDetail(c, "project_key", job.ProjectKey)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Provisioning job requeued successfully", Data: job})
+	}
+}
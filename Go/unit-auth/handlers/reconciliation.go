@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReconciliationHandler 项目映射核对（管理员）：启动、查看进度与报告、暂停恢复取消
+type ReconciliationHandler struct {
+	db         *gorm.DB
+	reconciler *services.MappingReconciler
+}
+
+// NewReconciliationHandler 创建映射核对处理器
+func NewReconciliationHandler(db *gorm.DB, reconciler *services.MappingReconciler) *ReconciliationHandler {
+	return &ReconciliationHandler{db: db, reconciler: reconciler}
+}
+
+// ListRuns 项目的核对任务列表，可按 status 过滤
+// GET /api/v1/admin/projects/:key/reconciliations
+func (h *ReconciliationHandler) ListRuns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, pageSize := syncPagination(c)
+		query := h.db.Model(&models.ProjectReconciliation{}).Where("project_key = ?", c.Param("key"))
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		var total int64
+		query.Count(&total)
+		var runs []models.ProjectReconciliation
+		if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&runs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve reconciliations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Reconciliations retrieved successfully",
+			Data: gin.H{
+				"reconciliations": runs,
+				"pagination":      syncPaginationData(page, pageSize, total),
+			},
+		})
+	}
+}
+
+// StartRun 启动核对（后台执行）；dry_run 只生成报告，backfill 为没有映射的用户写入开通任务
+// POST /api/v1/admin/projects/:key/reconciliations
+func (h *ReconciliationHandler) StartRun() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.StartReconciliationRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+				return
+			}
+		}
+		run, err := h.reconciler.StartRun(c.Param("key"), req, c.GetString("user_id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrReconciliationProject):
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+			case errors.Is(err, services.ErrReconciliationActive):
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to start reconciliation"})
+			}
+			return
+		}
+
+		middleware.SetAuditAction(c, "project.reconcile_start")
+		middleware.SetAuditTarget(c, "projects", run.ProjectKey)
+		middleware.AddAuditDetail(c, "reconciliation_id", run.ID)
+		middleware.AddAuditDetail(c, "dry_run", run.DryRun)
+		middleware.AddAuditDetail(c, "backfill", run.Backfill)
+
+		c.JSON(http.StatusAccepted, models.Response{Code: 202, Message: "Reconciliation started", Data: run})
+	}
+}
+
+// GetRun 核对进度，summary 为报告条目按 kind、action 的计数
+// GET /api/v1/admin/projects/:key/reconciliations/:id
+func (h *ReconciliationHandler) GetRun() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, ok := h.loadRun(c)
+		if !ok {
+			return
+		}
+		var summary []struct {
+			Kind   string `json:"kind"`
+			Action string `json:"action"`
+			Count  int64  `json:"count"`
+		}
+		if err := h.db.Model(&models.ProjectReconciliationItem{}).Select("kind, action, COUNT(*) AS count").
+			Where("run_id = ?", run.ID).Group("kind, action").Order("kind, action").Scan(&summary).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve reconciliation summary"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Reconciliation retrieved successfully",
+			Data:    gin.H{"reconciliation": run, "summary": summary},
+		})
+	}
+}
+
+// GetReport 核对报告（试运行时即为将要执行的修改），可按 kind、action 过滤
+// GET /api/v1/admin/projects/:key/reconciliations/:id/report
+func (h *ReconciliationHandler) GetReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, ok := h.loadRun(c)
+		if !ok {
+			return
+		}
+		page, pageSize := syncPagination(c)
+		query := h.db.Model(&models.ProjectReconciliationItem{}).Where("run_id = ?", run.ID)
+		for _, column := range []string{"kind", "action"} {
+			if v := c.Query(column); v != "" {
+				query = query.Where(column+" = ?", v)
+			}
+		}
+
+		var total int64
+		query.Count(&total)
+		var items []models.ProjectReconciliationItem
+		if err := query.Order("id ASC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve reconciliation report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Reconciliation report retrieved successfully",
+			Data: gin.H{
+				"reconciliation": run,
+				"items":          items,
+				"pagination":     syncPaginationData(page, pageSize, total),
+			},
+		})
+	}
+}
+
+// PauseRun 暂停核对，当前批次不提交，恢复后从游标继续
+// POST /api/v1/admin/projects/:key/reconciliations/:id/pause
+func (h *ReconciliationHandler) PauseRun() gin.HandlerFunc {
+	return h.transition("project.reconcile_pause", "Reconciliation paused successfully", h.reconciler.Pause)
+}
+
+// ResumeRun 从游标继续已暂停或失败的核对
+// POST /api/v1/admin/projects/:key/reconciliations/:id/resume
+func (h *ReconciliationHandler) ResumeRun() gin.HandlerFunc {
+	return h.transition("project.reconcile_resume", "Reconciliation resumed successfully", h.reconciler.Resume)
+}
+
+// CancelRun 取消核对，已提交的批次不回滚
+// POST /api/v1/admin/projects/:key/reconciliations/:id/cancel
+func (h *ReconciliationHandler) CancelRun() gin.HandlerFunc {
+	return h.transition("project.reconcile_cancel", "Reconciliation cancelled successfully", h.reconciler.Cancel)
+}
+
+func (h *ReconciliationHandler) transition(action, message string, apply func(id uint) (*models.ProjectReconciliation, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, ok := h.loadRun(c)
+		if !ok {
+			return
+		}
+		updated, err := apply(run.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrReconciliationNotFound):
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+			case errors.Is(err, services.ErrReconciliationState):
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error(), Data: updated})
+			default:
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to update reconciliation"})
+			}
+			return
+		}
+
+		middleware.SetAuditAction(c, action)
+		middleware.SetAuditTarget(c, "projects", run.ProjectKey)
+		middleware.AddAuditDetail(c, "reconciliation_id", run.ID)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: message, Data: updated})
+	}
+}
+
+func (h *ReconciliationHandler) loadRun(c *gin.Context) (*models.ProjectReconciliation, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid reconciliation id"})
+		return nil, false
+	}
+	var run models.ProjectReconciliation
+	if err := h.db.Where("id = ? AND project_key = ?", id, c.Param("key")).First(&run).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: services.ErrReconciliationNotFound.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve reconciliation"})
+		}
+		return nil, false
+	}
+	return &run, true
+}
@@ -0,0 +1,588 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"unit-auth/config"
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+	"unit-auth/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const scimContentType = "application/scim+json"
+
+// ScimHandler SCIM 2.0 接口（RFC 7643 / 7644）：项目的身份提供方通过该项目的 SCIM 令牌开通用户与组
+type ScimHandler struct {
+	db *gorm.DB
+}
+
+// NewScimHandler 创建 SCIM 处理器
+func NewScimHandler(db *gorm.DB) *ScimHandler {
+	return &ScimHandler{db: db}
+}
+
+// ListUsers 用户列表，支持 filter、startIndex、count、attributes、excludedAttributes
+// GET /scim/v2/Users
+func (h *ScimHandler) ListUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startIndex, count := scimPaging(c)
+		list, err := h.service(c).ListUsers(c.Query("filter"), startIndex, count)
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+		writeScimList(c, list)
+	}
+}
+
+// GetUser 读取用户；If-None-Match 与当前版本相同时返回 304
+// GET /scim/v2/Users/:id
+func (h *ScimHandler) GetUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := h.service(c).GetUser(c.Param("id"))
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+		writeScimResource(c, http.StatusOK, user, user.Meta.Version)
+	}
+}
+
+// CreateUser 开通用户
+// POST /scim/v2/Users
+func (h *ScimHandler) CreateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ScimUser
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeScimError(c, &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+			return
+		}
+		user, err := h.service(c).CreateUser(&req)
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+
+		middleware.SetAuditAction(c, "scim.user_create")
+		middleware.SetAuditTarget(c, "users", user.ID)
+		middleware.AddAuditDetail(c, "user_name", user.UserName)
+		middleware.AddAuditDetail(c, "external_id", user.ExternalID)
+
+		c.Header("Location", user.Meta.Location)
+		writeScimResource(c, http.StatusCreated, user, user.Meta.Version)
+	}
+}
+
+// ReplaceUser 替换用户；If-Match 与当前版本不同时返回 412
+// PUT /scim/v2/Users/:id
+func (h *ScimHandler) ReplaceUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ScimUser
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeScimError(c, &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+			return
+		}
+		user, err := h.service(c).ReplaceUser(c.Param("id"), c.GetHeader("If-Match"), &req)
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+
+		middleware.SetAuditAction(c, "scim.user_replace")
+		middleware.SetAuditTarget(c, "users", user.ID)
+
+		writeScimResource(c, http.StatusOK, user, user.Meta.Version)
+	}
+}
+
+// PatchUser 修改用户
+// PATCH /scim/v2/Users/:id
+func (h *ScimHandler) PatchUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, ok := bindScimPatch(c)
+		if !ok {
+			return
+		}
+		user, err := h.service(c).PatchUser(c.Param("id"), c.GetHeader("If-Match"), req.Operations)
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+
+		middleware.SetAuditAction(c, "scim.user_patch")
+		middleware.SetAuditTarget(c, "users", user.ID)
+		middleware.AddAuditDetail(c, "operations", scimPatchSummary(req.Operations))
+
+		writeScimResource(c, http.StatusOK, user, user.Meta.Version)
+	}
+}
+
+// DeleteUser 删除用户
+// DELETE /scim/v2/Users/:id
+func (h *ScimHandler) DeleteUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := h.service(c).DeleteUser(c.Param("id"), c.GetHeader("If-Match")); err != nil {
+			writeScimError(c, err)
+			return
+		}
+
+		middleware.SetAuditAction(c, "scim.user_delete")
+		middleware.SetAuditTarget(c, "users", c.Param("id"))
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ListGroups 组列表；excludedAttributes=members 时不加载成员
+// GET /scim/v2/Groups
+func (h *ScimHandler) ListGroups() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startIndex, count := scimPaging(c)
+		withMembers := scimAttributeReturned(c, "members")
+		list, err := h.service(c).ListGroups(c.Query("filter"), startIndex, count, withMembers)
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+		writeScimList(c, list)
+	}
+}
+
+// GetGroup 读取组
+// GET /scim/v2/Groups/:id
+func (h *ScimHandler) GetGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, err := h.service(c).GetGroup(c.Param("id"))
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+		writeScimResource(c, http.StatusOK, group, group.Meta.Version)
+	}
+}
+
+// CreateGroup 创建组
+// POST /scim/v2/Groups
+func (h *ScimHandler) CreateGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ScimGroup
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeScimError(c, &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+			return
+		}
+		group, err := h.service(c).CreateGroup(&req)
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+
+		middleware.SetAuditAction(c, "scim.group_create")
+		middleware.SetAuditTarget(c, "roles", group.ID)
+		middleware.AddAuditDetail(c, "display_name", group.DisplayName)
+		middleware.AddAuditDetail(c, "members", len(group.Members))
+
+		c.Header("Location", group.Meta.Location)
+		writeScimResource(c, http.StatusCreated, group, group.Meta.Version)
+	}
+}
+
+// ReplaceGroup 替换组（名称与全部成员）
+// PUT /scim/v2/Groups/:id
+func (h *ScimHandler) ReplaceGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ScimGroup
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeScimError(c, &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+			return
+		}
+		group, err := h.service(c).ReplaceGroup(c.Param("id"), c.GetHeader("If-Match"), &req)
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+
+		middleware.SetAuditAction(c, "scim.group_replace")
+		middleware.SetAuditTarget(c, "roles", group.ID)
+		middleware.AddAuditDetail(c, "members", len(group.Members))
+
+		writeScimResource(c, http.StatusOK, group, group.Meta.Version)
+	}
+}
+
+// PatchGroup 修改组（成员增删、改名）
+// PATCH /scim/v2/Groups/:id
+func (h *ScimHandler) PatchGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, ok := bindScimPatch(c)
+		if !ok {
+			return
+		}
+		group, err := h.service(c).PatchGroup(c.Param("id"), c.GetHeader("If-Match"), req.Operations)
+		if err != nil {
+			writeScimError(c, err)
+			return
+		}
+
+		middleware.SetAuditAction(c, "scim.group_patch")
+		middleware.SetAuditTarget(c, "roles", group.ID)
+		middleware.AddAuditDetail(c, "operations", scimPatchSummary(req.Operations))
+
+		writeScimResource(c, http.StatusOK, group, group.Meta.Version)
+	}
+}
+
+// DeleteGroup 删除组
+// DELETE /scim/v2/Groups/:id
+func (h *ScimHandler) DeleteGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := h.service(c).DeleteGroup(c.Param("id"), c.GetHeader("If-Match")); err != nil {
+			writeScimError(c, err)
+			return
+		}
+
+		middleware.SetAuditAction(c, "scim.group_delete")
+		middleware.SetAuditTarget(c, "roles", c.Param("id"))
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ServiceProviderConfig 服务能力声明
+// GET /scim/v2/ServiceProviderConfig
+func (h *ScimHandler) ServiceProviderConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writeScimJSON(c, http.StatusOK, gin.H{
+			"schemas":        []string{models.ScimSchemaServiceProviderConfig},
+			"patch":          gin.H{"supported": true},
+			"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+			"filter":         gin.H{"supported": true, "maxResults": scimMaxResults()},
+			"changePassword": gin.H{"supported": false},
+			"sort":           gin.H{"supported": false},
+			"etag":           gin.H{"supported": true},
+			"authenticationSchemes": []gin.H{{
+				"type":        "oauthbearertoken",
+				"name":        "Bearer Token",
+				"description": "Per-project SCIM token issued by an administrator",
+				"primary":     true,
+			}},
+			"meta": gin.H{"resourceType": "ServiceProviderConfig", "location": scimBaseURL() + "/ServiceProviderConfig"},
+		})
+	}
+}
+
+// ListSchemas 资源 schema 列表
+// GET /scim/v2/Schemas
+func (h *ScimHandler) ListSchemas() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		schemas := scimSchemas()
+		resources := make([]interface{}, 0, len(schemas))
+		for _, s := range schemas {
+			resources = append(resources, s)
+		}
+		writeScimList(c, &models.ScimListResponse{
+			Schemas:      []string{models.ScimSchemaListResponse},
+			TotalResults: int64(len(resources)),
+			StartIndex:   1,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		})
+	}
+}
+
+// GetSchema 按 URN 读取 schema
+// GET /scim/v2/Schemas/:id
+func (h *ScimHandler) GetSchema() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, s := range scimSchemas() {
+			if strings.EqualFold(s["id"].(string), c.Param("id")) {
+				writeScimJSON(c, http.StatusOK, s)
+				return
+			}
+		}
+		writeScimError(c, &services.ScimError{Status: http.StatusNotFound, Detail: "Schema " + c.Param("id") + " not found"})
+	}
+}
+
+// ListResourceTypes 资源类型列表
+// GET /scim/v2/ResourceTypes
+func (h *ScimHandler) ListResourceTypes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		types := scimResourceTypes()
+		resources := make([]interface{}, 0, len(types))
+		for _, t := range types {
+			resources = append(resources, t)
+		}
+		writeScimList(c, &models.ScimListResponse{
+			Schemas:      []string{models.ScimSchemaListResponse},
+			TotalResults: int64(len(resources)),
+			StartIndex:   1,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		})
+	}
+}
+
+// GetResourceType 读取资源类型（User / Group）
+// GET /scim/v2/ResourceTypes/:id
+func (h *ScimHandler) GetResourceType() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, t := range scimResourceTypes() {
+			if strings.EqualFold(t["id"].(string), c.Param("id")) {
+				writeScimJSON(c, http.StatusOK, t)
+				return
+			}
+		}
+		writeScimError(c, &services.ScimError{Status: http.StatusNotFound, Detail: "ResourceType " + c.Param("id") + " not found"})
+	}
+}
+
+func (h *ScimHandler) service(c *gin.Context) *services.ScimService {
+	project, _ := c.Get(middleware.CtxScimProject)
+	p, _ := project.(models.Project)
+	return services.NewScimService(h.db, p)
+}
+
+func scimBaseURL() string {
+	return strings.TrimRight(config.AppConfig.SCIMBaseURL, "/")
+}
+
+func scimMaxResults() int {
+	if config.AppConfig.SCIMMaxResults > 0 {
+		return config.AppConfig.SCIMMaxResults
+	}
+	return 200
+}
+
+// scimPaging startIndex 从 1 开始；未指定 count 时返回最多 SCIM_MAX_RESULTS 条
+func scimPaging(c *gin.Context) (int, int) {
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(scimMaxResults())))
+	if err != nil {
+		count = scimMaxResults()
+	}
+	return startIndex, count
+}
+
+func bindScimPatch(c *gin.Context) (*models.ScimPatchRequest, bool) {
+	var req models.ScimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeScimError(c, &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return nil, false
+	}
+	if len(req.Schemas) > 0 {
+		found := false
+		for _, s := range req.Schemas {
+			found = found || s == models.ScimSchemaPatchOp
+		}
+		if !found {
+			writeScimError(c, &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: "schemas must contain " + models.ScimSchemaPatchOp})
+			return nil, false
+		}
+	}
+	return &req, true
+}
+
+// scimPatchSummary 审计用的操作摘要（不含值，避免记录密码）
+func scimPatchSummary(ops []models.ScimPatchOperation) []string {
+	out := make([]string, 0, len(ops))
+	for _, op := range ops {
+		out = append(out, strings.TrimSpace(strings.ToLower(op.Op)+" "+op.Path))
+	}
+	return out
+}
+
+func writeScimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, body)
+}
+
+func writeScimError(c *gin.Context, err error) {
+	var scimErr *services.ScimError
+	if !errors.As(err, &scimErr) {
+		log.Printf("Warning: SCIM request %s %s failed: %v", c.Request.Method, c.Request.URL.Path, err)
+		scimErr = &services.ScimError{Status: http.StatusInternalServerError, Detail: "Internal server error"}
+	}
+	_ = c.Error(err)
+	writeScimJSON(c, scimErr.Status, models.ScimError{
+		Schemas:  []string{models.ScimSchemaError},
+		Status:   strconv.Itoa(scimErr.Status),
+		ScimType: scimErr.ScimType,
+		Detail:   scimErr.Detail,
+	})
+}
+
+// writeScimResource 返回资源并设置 ETag；GET 时 If-None-Match 命中返回 304
+func writeScimResource(c *gin.Context, status int, resource interface{}, version string) {
+	if version != "" {
+		c.Header("ETag", version)
+		if c.Request.Method == http.MethodGet && c.GetHeader("If-None-Match") == version {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+	writeScimJSON(c, status, scimProjection(c, resource))
+}
+
+func writeScimList(c *gin.Context, list *models.ScimListResponse) {
+	for i, r := range list.Resources {
+		list.Resources[i] = scimProjection(c, r)
+	}
+	writeScimJSON(c, http.StatusOK, list)
+}
+
+// scimProjection 按 attributes / excludedAttributes 裁剪顶层属性；schemas、id 总是返回
+func scimProjection(c *gin.Context, resource interface{}) interface{} {
+	attributes := scimAttrList(c.Query("attributes"))
+	excluded := scimAttrList(c.Query("excludedAttributes"))
+	if len(attributes) == 0 && len(excluded) == 0 {
+		return resource
+	}
+	raw, err := json.Marshal(resource)
+	if err != nil {
+		return resource
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return resource
+	}
+	for key := range doc {
+		name := strings.ToLower(key)
+		if name == "schemas" || name == "id" {
+			continue
+		}
+		if (len(attributes) > 0 && !attributes[name]) || excluded[name] {
+			delete(doc, key)
+		}
+	}
+	return doc
+}
+
+func scimAttrList(value string) map[string]bool {
+	out := map[string]bool{}
+	for _, attr := range strings.Split(value, ",") {
+		attr = utils.NormalizeScimAttrPath(attr)
+		if attr == "" {
+			continue
+		}
+		// name.givenName 按顶层属性 name 处理
+		if dot := strings.Index(attr, "."); dot > 0 {
+			attr = attr[:dot]
+		}
+		out[attr] = true
+	}
+	return out
+}
+
+func scimAttributeReturned(c *gin.Context, attr string) bool {
+	if scimAttrList(c.Query("excludedAttributes"))[attr] {
+		return false
+	}
+	attributes := scimAttrList(c.Query("attributes"))
+	return len(attributes) == 0 || attributes[attr]
+}
+
+func scimAttribute(name, typ string, multi, required bool, mutability, uniqueness string, sub ...gin.H) gin.H {
+	attr := gin.H{
+		"name":        name,
+		"type":        typ,
+		"multiValued": multi,
+		"required":    required,
+		"caseExact":   false,
+		"mutability":  mutability,
+		"returned":    "default",
+		"uniqueness":  uniqueness,
+	}
+	if mutability == "writeOnly" {
+		attr["returned"] = "never"
+	}
+	if len(sub) > 0 {
+		attr["subAttributes"] = sub
+	}
+	return attr
+}
+
+func scimMultiValueAttribute(name, mutability string) gin.H {
+	return scimAttribute(name, "complex", true, false, mutability, "none",
+		scimAttribute("value", "string", false, false, mutability, "none"),
+		scimAttribute("display", "string", false, false, mutability, "none"),
+		scimAttribute("type", "string", false, false, mutability, "none"),
+		scimAttribute("primary", "boolean", false, false, mutability, "none"),
+	)
+}
+
+func scimSchemas() []gin.H {
+	return []gin.H{
+		{
+			"schemas":     []string{models.ScimSchemaSchema},
+			"id":          models.ScimSchemaUser,
+			"name":        "User",
+			"description": "User Account",
+			"attributes": []gin.H{
+				scimAttribute("userName", "string", false, true, "readWrite", "server"),
+				scimAttribute("name", "complex", false, false, "readWrite", "none",
+					scimAttribute("formatted", "string", false, false, "readWrite", "none"),
+					scimAttribute("familyName", "string", false, false, "readWrite", "none"),
+					scimAttribute("givenName", "string", false, false, "readWrite", "none"),
+				),
+				scimAttribute("displayName", "string", false, false, "readWrite", "none"),
+				scimAttribute("profileUrl", "reference", false, false, "readWrite", "none"),
+				scimAttribute("title", "string", false, false, "readWrite", "none"),
+				scimAttribute("locale", "string", false, false, "readWrite", "none"),
+				scimAttribute("timezone", "string", false, false, "readWrite", "none"),
+				scimAttribute("active", "boolean", false, false, "readWrite", "none"),
+				scimAttribute("password", "string", false, false, "writeOnly", "none"),
+				scimMultiValueAttribute("emails", "readWrite"),
+				scimMultiValueAttribute("phoneNumbers", "readWrite"),
+				scimMultiValueAttribute("photos", "readWrite"),
+				scimMultiValueAttribute("groups", "readOnly"),
+			},
+			"meta": gin.H{"resourceType": "Schema", "location": scimBaseURL() + "/Schemas/" + models.ScimSchemaUser},
+		},
+		{
+			"schemas":     []string{models.ScimSchemaSchema},
+			"id":          models.ScimSchemaGroup,
+			"name":        "Group",
+			"description": "Group",
+			"attributes": []gin.H{
+				scimAttribute("displayName", "string", false, true, "readWrite", "server"),
+				scimMultiValueAttribute("members", "readWrite"),
+			},
+			"meta": gin.H{"resourceType": "Schema", "location": scimBaseURL() + "/Schemas/" + models.ScimSchemaGroup},
+		},
+	}
+}
+
+func scimResourceTypes() []gin.H {
+	return []gin.H{
+		{
+			"schemas":     []string{models.ScimSchemaResourceType},
+			"id":          "User",
+			"name":        "User",
+			"endpoint":    "/Users",
+			"description": "User Account",
+			"schema":      models.ScimSchemaUser,
+			"meta":        gin.H{"resourceType": "ResourceType", "location": scimBaseURL() + "/ResourceTypes/User"},
+		},
+		{
+			"schemas":     []string{models.ScimSchemaResourceType},
+			"id":          "Group",
+			"name":        "Group",
+			"endpoint":    "/Groups",
+			"description": "Group",
+			"schema":      models.ScimSchemaGroup,
+			"meta":        gin.H{"resourceType": "ResourceType", "location": scimBaseURL() + "/ResourceTypes/Group"},
+		},
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListScimTokens 项目的 SCIM 令牌列表（不含明文）
+// GET /api/v1/admin/projects/:key/scim-tokens
+func (h *ProjectHandler) ListScimTokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := h.loadProject(c)
+		if !ok {
+			return
+		}
+		var tokens []models.ScimToken
+		if err := h.db.Where("project_key = ?", project.Key).Order("id DESC").Find(&tokens).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve SCIM tokens"})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "SCIM tokens retrieved successfully",
+			Data:    gin.H{"tokens": tokens, "scim_base_url": scimBaseURL()},
+		})
+	}
+}
+
+// CreateScimToken 为项目签发 SCIM 令牌，明文只在响应中返回一次
+// POST /api/v1/admin/projects/:key/scim-tokens
+func (h *ProjectHandler) CreateScimToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := h.loadProject(c)
+		if !ok {
+			return
+		}
+		var req models.CreateScimTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+		token, plain, err := services.CreateScimToken(h.db, project.Key, req.Name, c.GetString("user_id"), ttl)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create SCIM token"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "project.scim_token_create")
+		middleware.SetAuditTarget(c, "projects", project.Key)
+		middleware.AddAuditDetail(c, "token_id", token.ID)
+		middleware.AddAuditDetail(c, "name", token.Name)
+
+		c.JSON(http.StatusCreated, models.Response{
+			Code:    201,
+			Message: "SCIM token created successfully",
+			Data:    gin.H{"token": token, "secret": plain, "scim_base_url": scimBaseURL()},
+		})
+	}
+}
+
+// RevokeScimToken 吊销项目的 SCIM 令牌，立即失效
+// DELETE /api/v1/admin/projects/:key/scim-tokens/:id
+func (h *ProjectHandler) RevokeScimToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		project, ok := h.loadProject(c)
+		if !ok {
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid SCIM token id"})
+			return
+		}
+		var token models.ScimToken
+		if err := h.db.Where("id = ? AND project_key = ?", id, project.Key).First(&token).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "SCIM token not found"})
+			return
+		}
+		if token.RevokedAt == nil {
+			now := time.Now()
+			if err := h.db.Model(&token).Update("revoked_at", now).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to revoke SCIM token"})
+				return
+			}
+			token.RevokedAt = &now
+		}
+
+		middleware.SetAuditAction(c, "project.scim_token_revoke")
+		middleware.SetAuditTarget(c, "projects", project.Key)
+		middleware.AddAuditDetail(c, "token_id", token.ID)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "SCIM token revoked successfully", Data: token})
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SMSGatewayHandler 短信网关处理器：服务商状态回执与投递记录查询
+type SMSGatewayHandler struct {
+	db      *gorm.DB
+	gateway *services.SMSGateway
+}
+
+// NewSMSGatewayHandler 创建短信网关处理器
+func NewSMSGatewayHandler(db *gorm.DB, gateway *services.SMSGateway) *SMSGatewayHandler {
+	return &SMSGatewayHandler{db: db, gateway: gateway}
+}
+
+// StatusCallback 服务商投递状态回执（各服务商的签名 / token 校验由适配器完成）
+// POST /api/v1/sms/status/:vendor
+func (h *SMSGatewayHandler) StatusCallback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ack, err := h.gateway.HandleStatusReport(c.Param("vendor"), c.Request)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrSMSCallbackUnauthorized):
+				c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: err.Error()})
+			case errors.Is(err, services.ErrSMSVendorNotFound), errors.Is(err, services.ErrSMSStatusNotSupported):
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+			default:
+				c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid status report: " + err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, ack)
+	}
+}
+
+// ListDeliveries 查询短信投递记录
+// GET /api/v1/admin/sms/deliveries
+func (h *SMSGatewayHandler) ListDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > 200 {
+			pageSize = 20
+		}
+
+		query := h.db.Model(&models.SMSDelivery{})
+		for _, field := range []string{"phone", "vendor", "status", "template", "request_id", "message_id"} {
+			if v := c.Query(field); v != "" {
+				query = query.Where(field+" = ?", v)
+			}
+		}
+
+		var total int64
+		query.Count(&total)
+		var deliveries []models.SMSDelivery
+		if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "Failed to retrieve sms deliveries",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "SMS deliveries retrieved successfully",
+			Data: gin.H{
+				"deliveries": deliveries,
+				"pagination": gin.H{
+					"page":        page,
+					"page_size":   pageSize,
+					"total":       total,
+					"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+				},
+			},
+		})
+	}
+}
+
+// GetVendors 短信服务商路由状态
+// GET /api/v1/admin/sms/vendors
+func (h *SMSGatewayHandler) GetVendors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "SMS vendors retrieved successfully",
+			Data: gin.H{
+				"routing": h.gateway.Routing(),
+				"vendors": h.gateway.VendorStatus(),
+			},
+		})
+	}
+}
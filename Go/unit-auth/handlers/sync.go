@@ -0,0 +1,736 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+	"unit-auth/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SyncHandler 数据同步任务管理（管理员）：创建任务与映射、立即执行、暂停恢复、查看日志与冲突
+type SyncHandler struct {
+	db     *gorm.DB
+	engine *services.SyncEngine
+}
+
+// NewSyncHandler 创建数据同步处理器
+func NewSyncHandler(db *gorm.DB, engine *services.SyncEngine) *SyncHandler {
+	return &SyncHandler{db: db, engine: engine}
+}
+
+// ListTasks 同步任务列表，可按 status、source_project、target_project、is_active 过滤
+// GET /api/v1/admin/sync/tasks
+func (h *SyncHandler) ListTasks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, pageSize := syncPagination(c)
+
+		query := h.db.Model(&models.SyncTask{})
+		for _, column := range []string{"status", "source_project", "target_project"} {
+			if v := c.Query(column); v != "" {
+				query = query.Where(column+" = ?", v)
+			}
+		}
+		if active := c.Query("is_active"); active != "" {
+			query = query.Where("is_active = ?", active == "true" || active == "1")
+		}
+
+		var total int64
+		query.Count(&total)
+		var tasks []models.SyncTask
+		if err := query.Order("id ASC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&tasks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve sync tasks"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Sync tasks retrieved successfully",
+			Data: gin.H{
+				"tasks":      tasks,
+				"pagination": syncPaginationData(page, pageSize, total),
+			},
+		})
+	}
+}
+
+// GetTask 同步任务详情（含映射与检查点）
+// GET /api/v1/admin/sync/tasks/:id
+func (h *SyncHandler) GetTask() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		task, ok := h.loadTask(c)
+		if !ok {
+			return
+		}
+		var mappings []models.SyncMapping
+		h.db.Where("task_id = ?", task.ID).Order("id ASC").Find(&mappings)
+		var checkpoints []models.SyncCheckpoint
+		h.db.Where("task_id = ?", task.ID).Order("id ASC").Find(&checkpoints)
+
+		mappingViews := make([]gin.H, 0, len(mappings))
+		for i := range mappings {
+			mappingViews = append(mappingViews, syncMappingView(&mappings[i]))
+		}
+		checkpointViews := make([]gin.H, 0, len(checkpoints))
+		for _, cp := range checkpoints {
+			checkpointViews = append(checkpointViews, gin.H{
+				"table_name":   cp.TableName,
+				"checkpoint":   cp.Checkpoint,
+				"last_sync_id": cp.LastSyncID,
+				"updated_at":   cp.UpdatedAt,
+			})
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Sync task retrieved successfully",
+			Data:    gin.H{"task": task, "mappings": mappingViews, "checkpoints": checkpointViews},
+		})
+	}
+}
+
+// CreateTask 创建同步任务；源与目标为项目 key，unit-auth 表示本地库
+// POST /api/v1/admin/sync/tasks
+func (h *SyncHandler) CreateTask() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.CreateSyncTaskRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		task := models.SyncTask{
+			Name:          strings.TrimSpace(req.Name),
+			Description:   req.Description,
+			SourceProject: strings.TrimSpace(req.SourceProject),
+			TargetProject: strings.TrimSpace(req.TargetProject),
+			SyncType:      req.SyncType,
+			Schedule:      strings.TrimSpace(req.Schedule),
+			Status:        models.SyncStatusPending,
+			IsActive:      true,
+		}
+		if msg := validateSyncTask(h.db, &task, req.Config); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+		var cnt int64
+		h.db.Model(&models.SyncTask{}).Where("name = ?", task.Name).Count(&cnt)
+		if cnt > 0 {
+			c.JSON(http.StatusConflict, models.Response{Code: 409, Message: "Sync task name already exists"})
+			return
+		}
+		task.NextSyncAt = services.NextSyncTime(task.Schedule, time.Now())
+		if err := h.db.Create(&task).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create sync task"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "sync.task_create")
+		middleware.SetAuditTarget(c, "sync_tasks", strconv.FormatUint(uint64(task.ID), 10))
+		middleware.SetAuditChange(c, nil, task)
+
+		c.JSON(http.StatusCreated, models.Response{Code: 201, Message: "Sync task created successfully", Data: task})
+	}
+}
+
+// UpdateTask 修改同步任务；只修改提供的字段，修改 schedule 后重新计算下次执行时间
+// PUT /api/v1/admin/sync/tasks/:id
+func (h *SyncHandler) UpdateTask() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		task, ok := h.loadTask(c)
+		if !ok {
+			return
+		}
+		var req models.UpdateSyncTaskRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		if task.Status == models.SyncStatusRunning && task.LockedUntil != nil && task.LockedUntil.After(time.Now()) {
+			c.JSON(http.StatusConflict, models.Response{Code: 409, Message: services.ErrSyncTaskRunning.Error()})
+			return
+		}
+		before := *task
+
+		if req.Name != nil {
+			task.Name = strings.TrimSpace(*req.Name)
+		}
+		if req.Description != nil {
+			task.Description = *req.Description
+		}
+		if req.SyncType != nil {
+			task.SyncType = *req.SyncType
+		}
+		if req.Schedule != nil {
+			task.Schedule = strings.TrimSpace(*req.Schedule)
+		}
+		if req.IsActive != nil {
+			task.IsActive = *req.IsActive
+		}
+		var cfg map[string]interface{}
+		if req.Config != nil {
+			cfg = *req.Config
+		}
+		if msg := validateSyncTask(h.db, task, cfg); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+		if task.Name != before.Name {
+			var cnt int64
+			h.db.Model(&models.SyncTask{}).Where("name = ? AND id <> ?", task.Name, task.ID).Count(&cnt)
+			if cnt > 0 {
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: "Sync task name already exists"})
+				return
+			}
+		}
+		task.NextSyncAt = nil
+		if task.IsActive {
+			task.NextSyncAt = services.NextSyncTime(task.Schedule, time.Now())
+		}
+		if err := h.db.Model(task).Select("name", "description", "sync_type", "schedule", "config", "is_active", "next_sync_at").Updates(task).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to update sync task"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "sync.task_update")
+		middleware.SetAuditTarget(c, "sync_tasks", strconv.FormatUint(uint64(task.ID), 10))
+		middleware.SetAuditChange(c, before, task)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Sync task updated successfully", Data: task})
+	}
+}
+
+// CreateMapping 为任务添加表映射：field_mapping 为源字段 → 目标字段，transform_rule 以目标字段为键
+// POST /api/v1/admin/sync/mappings
+func (h *SyncHandler) CreateMapping() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.CreateSyncMappingRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		var task models.SyncTask
+		if err := h.db.First(&task, req.TaskID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: services.ErrSyncTaskNotFound.Error()})
+			return
+		}
+		if len(req.FieldMapping) == 0 {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "field_mapping must not be empty"})
+			return
+		}
+		if err := services.ValidateSyncTransformRules(req.TransformRule); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
+			return
+		}
+		mapping := models.SyncMapping{
+			TaskID:      task.ID,
+			SourceTable: strings.TrimSpace(req.SourceTable),
+			TargetTable: strings.TrimSpace(req.TargetTable),
+			IsActive:    true,
+		}
+		if err := services.ValidateSyncEndpoints(h.db, &task, &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
+			return
+		}
+		_ = mapping.SetFieldMapping(req.FieldMapping)
+		if req.TransformRule != nil {
+			_ = mapping.SetTransformRule(req.TransformRule)
+		}
+		if err := h.db.Create(&mapping).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create sync mapping"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "sync.mapping_create")
+		middleware.SetAuditTarget(c, "sync_tasks", strconv.FormatUint(uint64(task.ID), 10))
+		middleware.AddAuditDetail(c, "mapping_id", mapping.ID)
+		middleware.AddAuditDetail(c, "source_table", mapping.SourceTable)
+		middleware.AddAuditDetail(c, "target_table", mapping.TargetTable)
+
+		c.JSON(http.StatusCreated, models.Response{Code: 201, Message: "Sync mapping created successfully", Data: syncMappingView(&mapping)})
+	}
+}
+
+// DeleteMapping 删除表映射及其检查点
+// DELETE /api/v1/admin/sync/mappings/:id
+func (h *SyncHandler) DeleteMapping() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid mapping id"})
+			return
+		}
+		var mapping models.SyncMapping
+		if err := h.db.First(&mapping, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "Sync mapping not found"})
+			return
+		}
+		err = h.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("task_id = ? AND table_name = ?", mapping.TaskID, mapping.SourceTable+"->"+mapping.TargetTable).Delete(&models.SyncCheckpoint{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&mapping).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to delete sync mapping"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "sync.mapping_delete")
+		middleware.SetAuditTarget(c, "sync_tasks", strconv.FormatUint(uint64(mapping.TaskID), 10))
+		middleware.AddAuditDetail(c, "mapping_id", mapping.ID)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Sync mapping deleted successfully"})
+	}
+}
+
+// RunTask 立即执行任务（后台执行），mode 可选 full、incremental，默认按任务的 sync_type
+// POST /api/v1/admin/sync/tasks/:id/run
+func (h *SyncHandler) RunTask() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid task id"})
+			return
+		}
+		mode := c.Query("mode")
+		if mode != "" && mode != models.SyncModeFull && mode != models.SyncModeIncremental {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "mode must be full or incremental"})
+			return
+		}
+		entry, err := h.engine.Run(uint(id), mode)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrSyncTaskNotFound):
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+			case errors.Is(err, services.ErrSyncTaskRunning):
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+			case errors.Is(err, services.ErrSyncEngineBusy):
+				c.JSON(http.StatusServiceUnavailable, models.Response{Code: 503, Message: err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to start sync task"})
+			}
+			return
+		}
+
+		middleware.SetAuditAction(c, "sync.task_run")
+		middleware.SetAuditTarget(c, "sync_tasks", c.Param("id"))
+		middleware.AddAuditDetail(c, "log_id", entry.ID)
+		middleware.AddAuditDetail(c, "mode", mode)
+
+		c.JSON(http.StatusAccepted, models.Response{Code: 202, Message: "Sync task started", Data: entry})
+	}
+}
+
+// PauseTask 暂停任务：不再调度，正在执行的同步在当前记录处理完后中断
+// POST /api/v1/admin/sync/tasks/:id/pause
+func (h *SyncHandler) PauseTask() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid task id"})
+			return
+		}
+		if err := h.engine.Pause(uint(id)); err != nil {
+			if errors.Is(err, services.ErrSyncTaskNotFound) {
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to pause sync task"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "sync.task_pause")
+		middleware.SetAuditTarget(c, "sync_tasks", c.Param("id"))
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Sync task paused successfully"})
+	}
+}
+
+// ResumeTask 恢复任务调度
+// POST /api/v1/admin/sync/tasks/:id/resume
+func (h *SyncHandler) ResumeTask() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid task id"})
+			return
+		}
+		task, err := h.engine.Resume(uint(id))
+		if err != nil {
+			if errors.Is(err, services.ErrSyncTaskNotFound) {
+				c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to resume sync task"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "sync.task_resume")
+		middleware.SetAuditTarget(c, "sync_tasks", c.Param("id"))
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Sync task resumed successfully", Data: task})
+	}
+}
+
+// ListLogs 同步日志，可按 task_id、status 过滤
+// GET /api/v1/admin/sync/logs
+func (h *SyncHandler) ListLogs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, pageSize := syncPagination(c)
+
+		query := h.db.Model(&models.SyncLog{})
+		for _, column := range []string{"task_id", "status"} {
+			if v := c.Query(column); v != "" {
+				query = query.Where(column+" = ?", v)
+			}
+		}
+
+		var total int64
+		query.Count(&total)
+		var logs []models.SyncLog
+		if err := query.Preload("Task").Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve sync logs"})
+			return
+		}
+		items := make([]models.SyncLogResponse, 0, len(logs))
+		for i := range logs {
+			items = append(items, syncLogResponse(&logs[i]))
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Sync logs retrieved successfully",
+			Data: gin.H{
+				"logs":       items,
+				"pagination": syncPaginationData(page, pageSize, total),
+			},
+		})
+	}
+}
+
+// GetLog 同步日志详情（含每个映射的统计与错误样例）
+// GET /api/v1/admin/sync/logs/:id
+func (h *SyncHandler) GetLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var entry models.SyncLog
+		if err := h.db.Preload("Task").First(&entry, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "Sync log not found"})
+			return
+		}
+		details, _ := entry.GetDetails()
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Sync log retrieved successfully",
+			Data:    gin.H{"log": syncLogResponse(&entry), "details": details},
+		})
+	}
+}
+
+// ListConflicts 同步冲突，可按 task_id、table_name、conflict_type、record_id、resolution、resolved（true / false）过滤；
+// 待处理队列用 resolved=false&order=asc 从最早的冲突开始处理
+// GET /api/v1/admin/sync/conflicts
+func (h *SyncHandler) ListConflicts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, pageSize := syncPagination(c)
+
+		query := h.db.Model(&models.SyncConflict{})
+		for _, column := range []string{"task_id", "table_name", "conflict_type", "record_id", "resolution"} {
+			if v := c.Query(column); v != "" {
+				query = query.Where(column+" = ?", v)
+			}
+		}
+		switch c.Query("resolved") {
+		case "true", "1":
+			query = query.Where("resolved_at IS NOT NULL")
+		case "false", "0":
+			query = query.Where("resolved_at IS NULL")
+		}
+		order := "id DESC"
+		if c.Query("order") == "asc" {
+			order = "id ASC"
+		}
+
+		var total int64
+		query.Count(&total)
+		var conflicts []models.SyncConflict
+		if err := query.Preload("Task").Order(order).Offset((page - 1) * pageSize).Limit(pageSize).Find(&conflicts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve sync conflicts"})
+			return
+		}
+		items := make([]models.SyncConflictResponse, 0, len(conflicts))
+		for i := range conflicts {
+			items = append(items, syncConflictResponse(&conflicts[i]))
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Sync conflicts retrieved successfully",
+			Data: gin.H{
+				"conflicts":  items,
+				"pagination": syncPaginationData(page, pageSize, total),
+			},
+		})
+	}
+}
+
+// GetConflict 冲突详情：逐字段对照源数据、冲突时与当前的目标值，并给出按 last_writer_wins 的胜出方
+// GET /api/v1/admin/sync/conflicts/:id
+func (h *SyncHandler) GetConflict() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var conflict models.SyncConflict
+		if err := h.db.Preload("Task").First(&conflict, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: services.ErrSyncConflictNotFound.Error()})
+			return
+		}
+		data := gin.H{"conflict": syncConflictResponse(&conflict)}
+		fields, err := h.engine.ConflictFields(c.Request.Context(), &conflict)
+		if err != nil {
+			// 目标不可读（任务已删除、项目已停用、记录不存在）时仍返回冲突本身
+			data["fields_error"] = err.Error()
+		} else {
+			data["fields"] = fields
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Sync conflict retrieved successfully", Data: data})
+	}
+}
+
+// ResolveConflict 处理冲突：source_wins 以源数据覆盖目标，target_wins 保留目标，ignore 直接关闭，
+// last_writer_wins 逐字段取较新的一方，manual 按 fields（字段 → source / target）与 data 写入目标
+// POST /api/v1/admin/sync/conflicts/:id/resolve
+func (h *SyncHandler) ResolveConflict() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid conflict id"})
+			return
+		}
+		var req models.ResolveSyncConflictRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		if len(req.Notes) > 500 {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "notes must be at most 500 characters"})
+			return
+		}
+
+		conflict, err := h.engine.ResolveConflict(c.Request.Context(), uint(id), req, c.GetString("user_id"))
+		if err != nil {
+			writeSyncConflictError(c, err)
+			return
+		}
+
+		middleware.SetAuditAction(c, "sync.conflict_resolve")
+		middleware.SetAuditTarget(c, "sync_conflicts", strconv.FormatUint(uint64(conflict.ID), 10))
+		middleware.AddAuditDetail(c, "task_id", conflict.TaskID)
+		middleware.AddAuditDetail(c, "record_id", conflict.RecordID)
+		middleware.AddAuditDetail(c, "resolution", conflict.Resolution)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Sync conflict resolved successfully", Data: syncConflictResponse(conflict)})
+	}
+}
+
+// BatchResolveConflicts 按同一处理方式批量处理冲突（不支持 manual），逐条返回结果
+// POST /api/v1/admin/sync/conflicts/resolve
+func (h *SyncHandler) BatchResolveConflicts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.BatchResolveSyncConflictsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		if len(req.Notes) > 500 {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "notes must be at most 500 characters"})
+			return
+		}
+
+		resolved := make([]uint, 0, len(req.IDs))
+		failed := make([]gin.H, 0)
+		for _, id := range req.IDs {
+			_, err := h.engine.ResolveConflict(c.Request.Context(), id, models.ResolveSyncConflictRequest{Resolution: req.Resolution, Notes: req.Notes}, c.GetString("user_id"))
+			if err != nil {
+				failed = append(failed, gin.H{"id": id, "error": err.Error()})
+				continue
+			}
+			resolved = append(resolved, id)
+		}
+
+		middleware.SetAuditAction(c, "sync.conflict_resolve_batch")
+		middleware.SetAuditTarget(c, "sync_conflicts", "")
+		middleware.AddAuditDetail(c, "resolution", req.Resolution)
+		middleware.AddAuditDetail(c, "resolved", resolved)
+		middleware.AddAuditDetail(c, "failed", len(failed))
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Sync conflicts processed",
+			Data:    gin.H{"resolved": resolved, "failed": failed},
+		})
+	}
+}
+
+func writeSyncConflictError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrSyncConflictNotFound):
+		c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+	case errors.Is(err, services.ErrSyncConflictResolved):
+		c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+	case errors.Is(err, services.ErrSyncResolutionInvalid):
+		c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
+	default:
+		// 写入目标失败（记录不存在、唯一键仍冲突、项目不可用），冲突保持未解决
+		c.JSON(http.StatusUnprocessableEntity, models.Response{Code: 422, Message: "Failed to resolve sync conflict: " + err.Error()})
+	}
+}
+
+func (h *SyncHandler) loadTask(c *gin.Context) (*models.SyncTask, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid task id"})
+		return nil, false
+	}
+	var task models.SyncTask
+	if err := h.db.First(&task, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: services.ErrSyncTaskNotFound.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve sync task"})
+		}
+		return nil, false
+	}
+	return &task, true
+}
+
+// validateSyncTask 校验名称、同步方式、cron 表达式、源与目标项目；cfg 非 nil 时写入任务配置
+func validateSyncTask(db *gorm.DB, task *models.SyncTask, cfg map[string]interface{}) string {
+	if task.Name == "" || len(task.Name) > 100 {
+		return "name must be 1-100 characters"
+	}
+	switch task.SyncType {
+	case models.SyncModeFull, models.SyncModeIncremental, models.SyncModeRealtime:
+	default:
+		return "sync_type must be full, incremental or realtime"
+	}
+	if task.Schedule != "" {
+		if _, err := utils.ParseCron(task.Schedule); err != nil {
+			return "invalid schedule: " + err.Error()
+		}
+	}
+	if task.SourceProject == task.TargetProject {
+		return "source_project and target_project must differ"
+	}
+	if err := services.ValidateSyncEndpoints(db, task, nil); err != nil {
+		return err.Error()
+	}
+	if cfg != nil {
+		if n, ok := cfg["batch_size"]; ok {
+			if f, ok := n.(float64); !ok || f <= 0 || f > 5000 {
+				return "config.batch_size must be between 1 and 5000"
+			}
+		}
+		if v, ok := cfg["conflict_strategy"]; ok {
+			switch v {
+			case models.SyncResolutionManual, models.SyncResolutionSourceWins, models.SyncResolutionTargetWins,
+				models.SyncResolutionIgnore, models.SyncResolutionLastWriterWins:
+			default:
+				return "config.conflict_strategy must be manual, source_wins, target_wins, ignore or last_writer_wins"
+			}
+		}
+		if err := task.SetConfig(cfg); err != nil {
+			return "invalid config"
+		}
+	}
+	return ""
+}
+
+func syncMappingView(m *models.SyncMapping) gin.H {
+	return gin.H{
+		"id":             m.ID,
+		"task_id":        m.TaskID,
+		"source_table":   m.SourceTable,
+		"target_table":   m.TargetTable,
+		"field_mapping":  m.FieldMapping,
+		"transform_rule": m.TransformRule,
+		"is_active":      m.IsActive,
+		"created_at":     m.CreatedAt,
+		"updated_at":     m.UpdatedAt,
+	}
+}
+
+func syncLogResponse(l *models.SyncLog) models.SyncLogResponse {
+	resp := models.SyncLogResponse{
+		ID:               l.ID,
+		TaskID:           l.TaskID,
+		TaskName:         l.Task.Name,
+		Status:           l.Status,
+		StartTime:        l.StartTime,
+		EndTime:          l.EndTime,
+		RecordsProcessed: l.RecordsProcessed,
+		RecordsSuccess:   l.RecordsSuccess,
+		RecordsFailed:    l.RecordsFailed,
+		ErrorMsg:         l.ErrorMsg,
+		CreatedAt:        l.CreatedAt,
+	}
+	if l.EndTime != nil {
+		resp.Duration = int64(l.EndTime.Sub(l.StartTime).Seconds())
+	}
+	if l.RecordsProcessed > 0 {
+		resp.SuccessRate = float64(l.RecordsSuccess) / float64(l.RecordsProcessed) * 100
+	}
+	return resp
+}
+
+func syncConflictResponse(sc *models.SyncConflict) models.SyncConflictResponse {
+	resp := models.SyncConflictResponse{
+		ID:           sc.ID,
+		TaskID:       sc.TaskID,
+		TaskName:     sc.Task.Name,
+		TableName:    sc.TableName,
+		RecordID:     sc.RecordID,
+		ConflictType: sc.ConflictType,
+		Resolution:   sc.Resolution,
+		ResolvedBy:   sc.ResolvedBy,
+		ResolvedAt:   sc.ResolvedAt,
+		Notes:        sc.Notes,
+		SourceTime:   sc.SourceTime,
+		TargetTime:   sc.TargetTime,
+		CreatedAt:    sc.CreatedAt,
+	}
+	if len(sc.SourceData) > 0 {
+		_ = json.Unmarshal(sc.SourceData, &resp.SourceData)
+	}
+	if len(sc.TargetData) > 0 {
+		_ = json.Unmarshal(sc.TargetData, &resp.TargetData)
+	}
+	return resp
+}
+
+func syncPagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+func syncPaginationData(page, pageSize int, total int64) gin.H {
+	return gin.H{
+		"page":        page,
+		"page_size":   pageSize,
+		"total":       total,
+		"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+	}
+}
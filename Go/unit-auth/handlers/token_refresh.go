@@ -47,6 +47,14 @@ func RefreshToken() gin.HandlerFunc {
 			return
 		}
 
+		if models.IsTokenRevoked(models.GetDB(), claims) {
+			c.JSON(http.StatusUnauthorized, models.Response{
+				Code:    401,
+				Message: "Token has been revoked",
+			})
+			return
+		}
+
 		// 检查token类型，只允许续签access和remember_me token
 		if claims.TokenType != "access" && claims.TokenType != "remember_me" {
 			c.JSON(http.StatusBadRequest, models.Response{
@@ -97,6 +105,15 @@ func RefreshTokenWithRefreshToken() gin.HandlerFunc {
 			return
 		}
 
+		// 会话吊销前签发的刷新token不可再续签
+		if claims, err := utils.ValidateEnhancedToken(req.RefreshToken); err == nil && models.IsTokenRevoked(models.GetDB(), claims) {
+			c.JSON(http.StatusUnauthorized, models.Response{
+				Code:    401,
+				Message: "Invalid refresh token: token has been revoked",
+			})
+			return
+		}
+
 		// 使用刷新token续签
 		tokenResponse, err := utils.RefreshAccessToken(req.RefreshToken)
 		if err != nil {
@@ -204,7 +221,7 @@ func LoginWithRememberMe(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// 识别账号类型
-		accountType := utils.IdentifyAccountType(req.Account)
+		accountType, account := identifyLoginAccount(c, db, req.Account)
 		if accountType == utils.AccountTypeUnknown {
 			c.JSON(http.StatusBadRequest, models.Response{
 				Code:    400,
@@ -219,11 +236,11 @@ func LoginWithRememberMe(db *gorm.DB) gin.HandlerFunc {
 
 		switch accountType {
 		case utils.AccountTypeEmail:
-			queryErr = db.Where("email = ?", req.Account).First(&user).Error
+			queryErr = db.Where("email = ?", account).First(&user).Error
 		case utils.AccountTypePhone:
-			queryErr = db.Where("phone = ?", req.Account).First(&user).Error
+			queryErr = db.Where("phone = ?", account).First(&user).Error
 		case utils.AccountTypeUsername:
-			queryErr = db.Where("username = ?", req.Account).First(&user).Error
+			queryErr = db.Where("username = ?", account).First(&user).Error
 		}
 
 		if queryErr != nil {
@@ -252,6 +269,15 @@ func LoginWithRememberMe(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 联系方式变更被撤销后需先重置密码
+		if user.PasswordResetRequired {
+			c.JSON(http.StatusForbidden, models.Response{
+				Code:    403,
+				Message: "Password reset required",
+			})
+			return
+		}
+
 		// 生成token
 		var identifier string
 		if user.Email != nil && *user.Email != "" {
@@ -312,7 +338,7 @@ func LoginWithTokenPair(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// 识别账号类型
-		accountType := utils.IdentifyAccountType(req.Account)
+		accountType, account := identifyLoginAccount(c, db, req.Account)
 		if accountType == utils.AccountTypeUnknown {
 			c.JSON(http.StatusBadRequest, models.Response{
 				Code:    400,
@@ -327,11 +353,11 @@ func LoginWithTokenPair(db *gorm.DB) gin.HandlerFunc {
 
 		switch accountType {
 		case utils.AccountTypeEmail:
-			queryErr = db.Where("email = ?", req.Account).First(&user).Error
+			queryErr = db.Where("email = ?", account).First(&user).Error
 		case utils.AccountTypePhone:
-			queryErr = db.Where("phone = ?", req.Account).First(&user).Error
+			queryErr = db.Where("phone = ?", account).First(&user).Error
 		case utils.AccountTypeUsername:
-			queryErr = db.Where("username = ?", req.Account).First(&user).Error
+			queryErr = db.Where("username = ?", account).First(&user).Error
 		}
 
 		if queryErr != nil {
@@ -360,6 +386,15 @@ func LoginWithTokenPair(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 联系方式变更被撤销后需先重置密码
+		if user.PasswordResetRequired {
+			c.JSON(http.StatusForbidden, models.Response{
+				Code:    403,
+				Message: "Password reset required",
+			})
+			return
+		}
+
 		// 生成双Token对
 		var identifier string
 		if user.Email != nil && *user.Email != "" {
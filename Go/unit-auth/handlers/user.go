@@ -3,7 +3,6 @@ package handlers
 import (
 	"fmt"
 	"net/http"
-	"unit-auth/middleware"
 	"unit-auth/models"
 	"unit-auth/services"
 
@@ -57,6 +56,8 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		before := user.ToResponse()
+
 		// 更新字段
 		if req.Nickname != "" {
 			user.Nickname = req.Nickname
@@ -65,7 +66,16 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 			user.SetMeta(req.Meta)
 		}
 
-		if err := db.Save(&user).Error; err != nil {
+		// 保存、事件与项目同步任务在同一事务中提交
+		err := models.WithActor(db, user.ID).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			services.PublishUserChanges(tx, before, &user, user.ID)
+			_, err := services.EnqueueUserSync(tx, models.ProvisioningUpdate, user.ID)
+			return err
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to update profile",
@@ -73,19 +83,6 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 若上下文存在项目映射，推送更新
-		if keyVal, ok := c.Get(middleware.CtxProjectKey); ok {
-			projectKey := keyVal.(string)
-			var p models.Project
-			if err := db.Where("`key` = ? AND enabled = ?", projectKey, true).First(&p).Error; err == nil {
-				var pm models.ProjectMapping
-				if err := db.Where("project_name = ? AND user_id = ?", projectKey, user.ID).First(&pm).Error; err == nil {
-					cli := services.NewProjectClient(p)
-					_ = cli.UpdateUser(c.Request.Context(), pm.LocalUserID, services.OutboundUser{UserID: user.ID, Email: user.ToResponse().Email, Username: user.Username, Nickname: user.Nickname, Avatar: user.GetAvatar()})
-				}
-			}
-		}
-
 		c.JSON(http.StatusOK, models.Response{
 			Code:    200,
 			Message: "Profile updated successfully",
@@ -128,6 +125,7 @@ func ChangePassword(db *gorm.DB) gin.HandlerFunc {
 
 		// 更新密码
 		user.Password = req.NewPassword
+		user.PasswordResetRequired = false
 		if err := user.HashPassword(); err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
@@ -136,13 +134,14 @@ func ChangePassword(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Save(&user).Error; err != nil {
+		if err := models.WithActor(db, user.ID).Save(&user).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
 				Message: "Failed to update password",
 			})
 			return
 		}
+		services.PublishUserEvent(db, services.EventUserPasswordChanged, &user, user.ID)
 
 		c.JSON(http.StatusOK, models.Response{
 			Code:    200,
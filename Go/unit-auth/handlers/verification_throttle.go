@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// acquireVerificationSend 占用一次验证码发送额度，被限制时写入响应并返回 false
+func acquireVerificationSend(c *gin.Context, throttle *services.VerificationThrottle, channel, recipient, captchaToken string) (func(), bool) {
+	release, err := throttle.Acquire(c.Request.Context(), services.VerificationAttempt{
+		Channel:      channel,
+		Recipient:    recipient,
+		IP:           c.ClientIP(),
+		CaptchaToken: captchaToken,
+	})
+	if err == nil {
+		return release, true
+	}
+
+	var throttled *services.ThrottleError
+	if !errors.As(err, &throttled) {
+		c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: err.Error()})
+		return nil, false
+	}
+	if throttled.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds()+0.5)))
+	}
+
+	status := http.StatusTooManyRequests
+	switch throttled.Reason {
+	case services.ThrottleReasonCaptchaRequired, services.ThrottleReasonCaptchaInvalid:
+		// 428：前端按 data.captcha 加载人机验证后携带 captcha_token 重试
+		status = http.StatusPreconditionRequired
+	case services.ThrottleReasonSpendLimit:
+		status = http.StatusServiceUnavailable
+	}
+	data := gin.H{"reason": throttled.Reason}
+	if throttled.RetryAfter > 0 {
+		data["retry_after"] = int(throttled.RetryAfter.Seconds() + 0.5)
+	}
+	if throttled.Captcha != nil {
+		data["captcha"] = throttled.Captcha
+	}
+	c.JSON(status, models.Response{Code: status, Message: throttled.Error(), Data: data})
+	return nil, false
+}
+
+// ResetSMSSpendBreaker 手动恢复因费用上限熔断的短信验证码发送
+func ResetSMSSpendBreaker(throttle *services.VerificationThrottle) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		middleware.SetAuditAction(c, "sms.spend_breaker_reset")
+		wasOpen := throttle.ResetSpendBreaker()
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "SMS spend breaker reset",
+			Data:    gin.H{"was_open": wasOpen},
+		})
+	}
+}
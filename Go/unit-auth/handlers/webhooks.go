@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unit-auth/middleware"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// WebhookHandler 用户事件 Webhook 管理（管理员）：按项目订阅、投递记录、重放
+type WebhookHandler struct {
+	db         *gorm.DB
+	dispatcher *services.WebhookDispatcher
+}
+
+// NewWebhookHandler 创建 Webhook 管理处理器
+func NewWebhookHandler(db *gorm.DB, dispatcher *services.WebhookDispatcher) *WebhookHandler {
+	return &WebhookHandler{db: db, dispatcher: dispatcher}
+}
+
+// ListEventTypes 可订阅的事件类型
+// GET /api/v1/admin/webhooks/event-types
+func (h *WebhookHandler) ListEventTypes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Webhook event types retrieved successfully", Data: services.UserEventTypes})
+	}
+}
+
+// ListSubscriptions 订阅列表，可按 project_key 过滤
+// GET /api/v1/admin/webhooks/subscriptions
+func (h *WebhookHandler) ListSubscriptions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := h.db.Model(&models.WebhookSubscription{})
+		if projectKey := c.Query("project_key"); projectKey != "" {
+			query = query.Where("project_key = ?", projectKey)
+		}
+		var subs []models.WebhookSubscription
+		if err := query.Order("id ASC").Find(&subs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve webhook subscriptions"})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Webhook subscriptions retrieved successfully", Data: subs})
+	}
+}
+
+// CreateSubscription 新增订阅，签名密钥只在响应中返回一次
+// POST /api/v1/admin/webhooks/subscriptions
+func (h *WebhookHandler) CreateSubscription() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.WebhookSubscriptionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		var project models.Project
+		if err := h.db.Where("`key` = ?", req.ProjectKey).First(&project).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Project not found"})
+			return
+		}
+
+		sub := models.WebhookSubscription{ProjectKey: project.Key, Enabled: true}
+		if msg := applyWebhookSubscriptionRequest(&sub, &req); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+		secret, err := services.RotateWebhookSecret(&sub)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to generate webhook secret"})
+			return
+		}
+		if err := h.db.Create(&sub).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to create webhook subscription"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "webhook.subscription.create")
+		middleware.SetAuditTarget(c, "webhook_subscriptions", strconv.FormatUint(uint64(sub.ID), 10))
+		middleware.SetAuditChange(c, nil, sub)
+
+		c.JSON(http.StatusCreated, models.Response{
+			Code:    201,
+			Message: "Webhook subscription created successfully",
+			Data:    gin.H{"subscription": sub, "secret": secret},
+		})
+	}
+}
+
+// UpdateSubscription 更新订阅的地址、事件、描述与启用状态
+// PUT /api/v1/admin/webhooks/subscriptions/:id
+func (h *WebhookHandler) UpdateSubscription() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, ok := h.loadSubscription(c)
+		if !ok {
+			return
+		}
+		var req models.WebhookSubscriptionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		before := *sub
+		if req.URL == "" {
+			req.URL = sub.URL
+		}
+		if msg := applyWebhookSubscriptionRequest(sub, &req); msg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: msg})
+			return
+		}
+		if err := h.db.Save(sub).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to update webhook subscription"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "webhook.subscription.update")
+		middleware.SetAuditTarget(c, "webhook_subscriptions", c.Param("id"))
+		middleware.SetAuditChange(c, before, sub)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Webhook subscription updated successfully", Data: sub})
+	}
+}
+
+// DeleteSubscription 删除订阅（未完成的投递在下次尝试时进入死信）
+// DELETE /api/v1/admin/webhooks/subscriptions/:id
+func (h *WebhookHandler) DeleteSubscription() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, ok := h.loadSubscription(c)
+		if !ok {
+			return
+		}
+		if err := h.db.Delete(sub).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to delete webhook subscription"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "webhook.subscription.delete")
+		middleware.SetAuditTarget(c, "webhook_subscriptions", c.Param("id"))
+		middleware.SetAuditChange(c, sub, nil)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Webhook subscription deleted successfully"})
+	}
+}
+
+// RotateSecret 轮换签名密钥：新密钥只返回一次，旧密钥 24 小时内仍会附在签名头中
+// POST /api/v1/admin/webhooks/subscriptions/:id/rotate-secret
+func (h *WebhookHandler) RotateSecret() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, ok := h.loadSubscription(c)
+		if !ok {
+			return
+		}
+		secret, err := services.RotateWebhookSecret(sub)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to generate webhook secret"})
+			return
+		}
+		if err := h.db.Save(sub).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to rotate webhook secret"})
+			return
+		}
+
+		middleware.SetAuditAction(c, "webhook.subscription.rotate_secret")
+		middleware.SetAuditTarget(c, "webhook_subscriptions", c.Param("id"))
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Webhook secret rotated successfully",
+			Data:    gin.H{"subscription": sub, "secret": secret},
+		})
+	}
+}
+
+// TestSubscription 向订阅投递一条 webhook.test 事件
+// POST /api/v1/admin/webhooks/subscriptions/:id/test
+func (h *WebhookHandler) TestSubscription() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid subscription id"})
+			return
+		}
+		delivery, err := h.dispatcher.SendTest(uint(id))
+		if err != nil {
+			h.respondError(c, err, "Failed to queue test event")
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Test event queued", Data: delivery})
+	}
+}
+
+// ReplayEvents 将时间范围内的事件重新投递到订阅（单次最多 1000 条，truncated 时带 after_id 继续）
+// POST /api/v1/admin/webhooks/subscriptions/:id/replay
+func (h *WebhookHandler) ReplayEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid subscription id"})
+			return
+		}
+		var req models.WebhookReplayRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		if req.Until.IsZero() {
+			req.Until = time.Now()
+		}
+		if req.Until.Before(req.Since) {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "until must not be before since"})
+			return
+		}
+		for _, t := range req.EventTypes {
+			if !services.IsUserEventType(t) {
+				c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Unknown event type: " + t})
+				return
+			}
+		}
+
+		result, err := h.dispatcher.ReplayEvents(uint(id), req.Since, req.Until, req.EventTypes, req.AfterID)
+		if err != nil {
+			h.respondError(c, err, "Failed to replay webhook events")
+			return
+		}
+
+		middleware.SetAuditAction(c, "webhook.subscription.replay")
+		middleware.SetAuditTarget(c, "webhook_subscriptions", c.Param("id"))
+		middleware.AddAuditDetail(c, "since", req.Since)
+		middleware.AddAuditDetail(c, "until", req.Until)
+		middleware.AddAuditDetail(c, "after_id", req.AfterID)
+		middleware.AddAuditDetail(c, "queued", result.Queued)
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Webhook events queued for replay", Data: result})
+	}
+}
+
+// ListDeliveries 投递记录（不返回载荷），可按 subscription_id、project_key、status、event_type、event_id 过滤
+// GET /api/v1/admin/webhooks/deliveries
+func (h *WebhookHandler) ListDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > 200 {
+			pageSize = 20
+		}
+
+		query := h.db.Model(&models.WebhookDelivery{})
+		for param, column := range map[string]string{
+			"subscription_id": "subscription_id",
+			"project_key":     "project_key",
+			"status":          "status",
+			"event_type":      "event_type",
+			"event_id":        "event_id",
+		} {
+			if v := c.Query(param); v != "" {
+				query = query.Where(column+" = ?", v)
+			}
+		}
+
+		var total int64
+		query.Count(&total)
+		var deliveries []models.WebhookDelivery
+		if err := query.Omit("payload").Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to retrieve webhook deliveries"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "Webhook deliveries retrieved successfully",
+			Data: gin.H{
+				"deliveries": deliveries,
+				"pagination": gin.H{
+					"page":        page,
+					"page_size":   pageSize,
+					"total":       total,
+					"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+				},
+			},
+		})
+	}
+}
+
+// GetDelivery 投递详情（含载荷与最后一次响应）
+// GET /api/v1/admin/webhooks/deliveries/:id
+func (h *WebhookHandler) GetDelivery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var delivery models.WebhookDelivery
+		if err := h.db.First(&delivery, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: services.ErrWebhookDeliveryNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Webhook delivery retrieved successfully", Data: delivery})
+	}
+}
+
+// ReplayDelivery 重放一次投递（成功或死信的均可），事件ID不变
+// POST /api/v1/admin/webhooks/deliveries/:id/replay
+func (h *WebhookHandler) ReplayDelivery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid delivery id"})
+			return
+		}
+		delivery, err := h.dispatcher.Replay(uint(id))
+		if err != nil {
+			h.respondError(c, err, "Failed to replay webhook delivery")
+			return
+		}
+
+		middleware.SetAuditAction(c, "webhook.delivery.replay")
+		middleware.SetAuditTarget(c, "webhook_deliveries", c.Param("id"))
+
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Webhook delivery queued for replay", Data: delivery})
+	}
+}
+
+func (h *WebhookHandler) loadSubscription(c *gin.Context) (*models.WebhookSubscription, bool) {
+	var sub models.WebhookSubscription
+	if err := h.db.First(&sub, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: services.ErrWebhookSubscriptionNotFound.Error()})
+		return nil, false
+	}
+	return &sub, true
+}
+
+func (h *WebhookHandler) respondError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrWebhookSubscriptionNotFound), errors.Is(err, services.ErrWebhookDeliveryNotFound):
+		c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: err.Error()})
+	case errors.Is(err, services.ErrWebhookDeliveryInProgress):
+		c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: fallback})
+	}
+}
+
+// applyWebhookSubscriptionRequest 校验并写入订阅字段，返回错误信息
+func applyWebhookSubscriptionRequest(sub *models.WebhookSubscription, req *models.WebhookSubscriptionRequest) string {
+	target, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return "url must be an absolute http(s) URL"
+	}
+	for _, e := range req.Events {
+		if e != "*" && !services.IsUserEventType(e) {
+			return "Unknown event type: " + e
+		}
+	}
+	sub.URL = target.String()
+	sub.Events = strings.Join(req.Events, ",")
+	sub.Description = req.Description
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+	return ""
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"net/http"
 	"time"
 	"unit-auth/middleware"
@@ -15,19 +16,24 @@ import (
 	"gorm.io/gorm"
 )
 
+// wechatQRBindingTTL 扫码登录下发浏览器绑定 Cookie 的有效期；与第三方授权事务共用同一个 Cookie，不短于其有效期
+const wechatQRBindingTTL = 10 * time.Minute
+
 // WeChatAuthHandler 微信认证处理器
 type WeChatAuthHandler struct {
-	db             *gorm.DB
-	wechatProvider *plugins.WeChatProvider
-	statsService   *services.StatsService
+	db            *gorm.DB
+	pluginManager *plugins.PluginManager
+	statsService  *services.StatsService
+	events        services.LoginEventBroker
 }
 
-// NewWeChatAuthHandler 创建微信认证处理器
-func NewWeChatAuthHandler(db *gorm.DB, wechatProvider *plugins.WeChatProvider, statsService *services.StatsService) *WeChatAuthHandler {
+// NewWeChatAuthHandler 创建微信认证处理器（events 用于向等待中的网页推送扫码状态）
+func NewWeChatAuthHandler(db *gorm.DB, pluginManager *plugins.PluginManager, statsService *services.StatsService, events services.LoginEventBroker) *WeChatAuthHandler {
 	return &WeChatAuthHandler{
-		db:             db,
-		wechatProvider: wechatProvider,
-		statsService:   statsService,
+		db:            db,
+		pluginManager: pluginManager,
+		statsService:  statsService,
+		events:        events,
 	}
 }
 
@@ -37,8 +43,17 @@ func (h *WeChatAuthHandler) GetQRCode() gin.HandlerFunc {
 		// 生成随机state
 		state := generateRandomState()
 
+		provider, err := h.pluginManager.GetEnabledProvider("wechat")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: err.Error(),
+			})
+			return
+		}
+
 		// 获取微信授权URL
-		authURL, err := h.wechatProvider.GetAuthURL(c.Request.Context(), state)
+		authURL, err := provider.GetAuthURL(c.Request.Context(), state)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
@@ -47,13 +62,14 @@ func (h *WeChatAuthHandler) GetQRCode() gin.HandlerFunc {
 			return
 		}
 
-		// 保存state到数据库（用于验证回调）
+		// 保存state到数据库（用于验证回调）；会话绑定到生成二维码的浏览器，只有它能查询状态、领取 Token
 		qrSession := models.WeChatQRSession{
-			State:     state,
-			IP:        c.ClientIP(),
-			UserAgent: c.GetHeader("User-Agent"),
-			ExpiresAt: time.Now().Add(5 * time.Minute), // 5分钟过期
-			CreatedAt: time.Now(),
+			State:       state,
+			IP:          c.ClientIP(),
+			UserAgent:   c.GetHeader("User-Agent"),
+			BindingHash: services.HashOAuthBinding(oauthBinding(c, wechatQRBindingTTL)),
+			ExpiresAt:   time.Now().Add(5 * time.Minute), // 5分钟过期
+			CreatedAt:   time.Now(),
 		}
 
 		if err := h.db.Create(&qrSession).Error; err != nil {
@@ -100,14 +116,24 @@ func (h *WeChatAuthHandler) HandleCallback() gin.HandlerFunc {
 			return
 		}
 
-		// 标记state为已使用
-		h.db.Model(&qrSession).Update("used", true)
+		// 标记state为已使用（扫码确认后微信才会回调，此时通知网页端已扫码）
+		h.db.Model(&qrSession).Updates(map[string]interface{}{"scanned": true, "used": true})
+		channel := services.LoginChannel(services.LoginChannelWeChatQR, state)
+		h.events.Publish(channel, services.LoginEvent{Status: services.LoginStatusScanned, Message: "QR code scanned"})
 
 		// 处理OAuth回调
-		user, err := h.wechatProvider.HandleCallback(c.Request.Context(), code, state)
+		attempt := &plugins.AuthAttempt{
+			Provider:  "wechat",
+			Code:      code,
+			State:     state,
+			IP:        qrSession.IP,
+			UserAgent: qrSession.UserAgent,
+		}
+		user, err := h.pluginManager.HandleCallback(c.Request.Context(), attempt)
 		if err != nil {
 			// 记录失败的登录日志
 			h.statsService.RecordLoginLog("", "wechat", qrSession.IP, qrSession.UserAgent, "", false, err.Error())
+			h.events.Publish(channel, services.LoginEvent{Status: services.LoginStatusFailed, Message: "WeChat login failed"})
 
 			c.JSON(http.StatusUnauthorized, models.Response{
 				Code:    401,
@@ -116,12 +142,12 @@ func (h *WeChatAuthHandler) HandleCallback() gin.HandlerFunc {
 			return
 		}
 
-		// 生成JWT Token
-		var identifier string
-		if user.WeChatID != nil {
-			identifier = *user.WeChatID
-		} else {
-			identifier = user.ID
+		// 生成JWT Token（标识使用微信 openid）
+		identifier := user.ID
+		var identity models.UserIdentity
+		if err := h.db.Where("user_id = ? AND provider = ?", user.ID, "wechat").First(&identity).Error; err == nil {
+			identifier = identity.Subject
+			h.db.Model(&qrSession).Update("WeChatID", identity.Subject)
 		}
 
 		projectKey := ""
@@ -135,7 +161,7 @@ func (h *WeChatAuthHandler) HandleCallback() gin.HandlerFunc {
 				localID = pm.LocalUserID
 			}
 		}
-		token, err := utils.GenerateUnifiedToken(user.ID, identifier, user.Role, projectKey, localID)
+		token, err := utils.GenerateUnifiedTokenWithClaims(user.ID, identifier, user.Role, projectKey, localID, attempt.Claims)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
@@ -150,18 +176,22 @@ func (h *WeChatAuthHandler) HandleCallback() gin.HandlerFunc {
 		// 记录成功的登录日志
 		h.statsService.RecordLoginLog(user.ID, "wechat", qrSession.IP, qrSession.UserAgent, "", true, "")
 
+		loginResp := models.LoginResponse{
+			User:  user.ToResponse(),
+			Token: token,
+		}
+		// 事件不携带 Token：等待中的网页收到后通过 qrLoginEvent 领取，任何知道 state 的订阅者都拿不到登录结果
+		h.events.Publish(channel, services.LoginEvent{Status: services.LoginStatusConfirmed, Message: "Login successful"})
+
 		c.JSON(http.StatusOK, models.Response{
 			Code:    200,
 			Message: "WeChat login successful",
-			Data: models.LoginResponse{
-				User:  user.ToResponse(),
-				Token: token,
-			},
+			Data:    loginResp,
 		})
 	}
 }
 
-// CheckLoginStatus 检查扫码登录状态
+// CheckLoginStatus 检查扫码登录状态（轮询方式；推荐使用 StreamLoginStatus）
 func (h *WeChatAuthHandler) CheckLoginStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		state := c.Param("state")
@@ -170,8 +200,8 @@ func (h *WeChatAuthHandler) CheckLoginStatus() gin.HandlerFunc {
 			return
 		}
 
-		var qrSession models.WeChatQRSession
-		if err := h.db.Where("state = ?", state).First(&qrSession).Error; err != nil {
+		qrSession, ok := h.boundQRSession(c, state)
+		if !ok {
 			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "QR session not found"})
 			return
 		}
@@ -180,36 +210,246 @@ func (h *WeChatAuthHandler) CheckLoginStatus() gin.HandlerFunc {
 			return
 		}
 
-		if qrSession.Used {
-			var user models.User
-			if err := h.db.Where("wechat_id = ?", qrSession.WeChatID).First(&user).Error; err == nil {
-				identifier := user.ID
-				if user.WeChatID != nil {
-					identifier = *user.WeChatID
-				}
-				projectKey := ""
-				if v, ok := c.Get(middleware.CtxProjectKey); ok {
-					projectKey = v.(string)
-				}
-				localID := ""
-				if projectKey != "" {
-					var pm models.ProjectMapping
-					if err := h.db.Where("project_name = ? AND user_id = ?", projectKey, user.ID).First(&pm).Error; err == nil {
-						localID = pm.LocalUserID
-					}
-				}
-				token, err := utils.GenerateUnifiedToken(user.ID, identifier, user.Role, projectKey, localID)
-				if err == nil {
-					c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Login successful", Data: models.LoginResponse{User: user.ToResponse(), Token: token}})
-					return
-				}
-			}
+		event := h.qrLoginEvent(c, qrSession)
+		switch {
+		case event.Status == services.LoginStatusConfirmed && event.Data != nil:
+			c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Login successful", Data: event.Data})
+			return
+		case event.Status == services.LoginStatusConfirmed:
+			c.JSON(http.StatusOK, models.Response{Code: 200, Message: event.Message, Data: gin.H{"status": event.Status, "scanned": true, "used": true}})
+			return
+		case event.Status == services.LoginStatusFailed:
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: event.Message})
+			return
 		}
 
 		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "QR code scanned, waiting for confirmation", Data: gin.H{"status": "pending", "scanned": qrSession.Scanned, "used": qrSession.Used}})
 	}
 }
 
+// StreamLoginStatus 通过 Server-Sent Events 推送扫码登录状态：pending → scanned → confirmed / expired / failed，
+// confirmed 事件携带登录结果（token，只交付一次），推送终态后关闭连接
+// GET /api/v1/auth/wechat/events/:state
+func (h *WeChatAuthHandler) StreamLoginStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := c.Param("state")
+
+		// 先订阅再读取快照，避免两者之间发布的事件丢失
+		events, cancel := h.events.Subscribe(services.LoginChannel(services.LoginChannelWeChatQR, state))
+		defer cancel()
+
+		qrSession, ok := h.boundQRSession(c, state)
+		if !ok {
+			c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "QR session not found"})
+			return
+		}
+
+		snapshot := func() services.LoginEvent {
+			var current models.WeChatQRSession
+			if err := h.db.Where("state = ?", state).First(&current).Error; err != nil {
+				return services.LoginEvent{Status: services.LoginStatusFailed, Message: "QR session not found"}
+			}
+			return h.qrLoginEvent(c, &current)
+		}
+
+		streamLoginEvents(c, events, qrSession.ExpiresAt, snapshot)
+	}
+}
+
+// boundQRSession 读取扫码会话，并校验请求来自生成二维码的浏览器（oauth_binding Cookie）；
+// 不匹配时与会话不存在同样处理，不暴露 state 是否有效
+func (h *WeChatAuthHandler) boundQRSession(c *gin.Context, state string) (*models.WeChatQRSession, bool) {
+	var qrSession models.WeChatQRSession
+	if err := h.db.Where("state = ?", state).First(&qrSession).Error; err != nil {
+		return nil, false
+	}
+	binding, _ := c.Cookie(services.OAuthBindingCookie)
+	if !services.OAuthBindingMatches(qrSession.BindingHash, binding) {
+		return nil, false
+	}
+	return &qrSession, true
+}
+
+// qrLoginEvent 扫码会话的当前状态；已确认时领取登录结果：
+// 条件更新 delivered_at，只有第一次领取的请求得到 Token，之后只返回 confirmed
+func (h *WeChatAuthHandler) qrLoginEvent(c *gin.Context, qrSession *models.WeChatQRSession) services.LoginEvent {
+	switch {
+	case qrSession.Used && qrSession.WeChatID != "":
+		delivered := services.LoginEvent{Status: services.LoginStatusConfirmed, Message: "Login already completed"}
+		if qrSession.DeliveredAt != nil {
+			return delivered
+		}
+		loginResp, err := h.qrLoginResponse(c, qrSession)
+		if err != nil {
+			return services.LoginEvent{Status: services.LoginStatusFailed, Message: "Failed to generate token"}
+		}
+		res := h.db.Model(&models.WeChatQRSession{}).
+			Where("id = ? AND delivered_at IS NULL", qrSession.ID).
+			Update("delivered_at", time.Now())
+		if res.Error != nil {
+			return services.LoginEvent{Status: services.LoginStatusFailed, Message: "Failed to generate token"}
+		}
+		if res.RowsAffected == 0 {
+			return delivered
+		}
+		return services.LoginEvent{Status: services.LoginStatusConfirmed, Message: "Login successful", Data: *loginResp}
+	case qrSession.ExpiresAt.Before(time.Now()):
+		return services.LoginEvent{Status: services.LoginStatusExpired, Message: "QR code expired"}
+	case qrSession.Scanned:
+		return services.LoginEvent{Status: services.LoginStatusScanned, Message: "QR code scanned"}
+	}
+	return services.LoginEvent{Status: services.LoginStatusPending, Message: "Waiting for scan"}
+}
+
+// qrLoginResponse 为已确认的扫码会话签发登录结果
+func (h *WeChatAuthHandler) qrLoginResponse(c *gin.Context, qrSession *models.WeChatQRSession) (*models.LoginResponse, error) {
+	user, _, err := services.FindUserByIdentity(h.db, "wechat", qrSession.WeChatID)
+	if err != nil {
+		return nil, err
+	}
+	projectKey := ""
+	if v, ok := c.Get(middleware.CtxProjectKey); ok {
+		projectKey = v.(string)
+	}
+	localID := ""
+	if projectKey != "" {
+		var pm models.ProjectMapping
+		if err := h.db.Where("project_name = ? AND user_id = ?", projectKey, user.ID).First(&pm).Error; err == nil {
+			localID = pm.LocalUserID
+		}
+	}
+	token, err := utils.GenerateUnifiedToken(user.ID, qrSession.WeChatID, user.Role, projectKey, localID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResponse{User: user.ToResponse(), Token: token}, nil
+}
+
+// MiniProgramLogin 微信小程序登录（code2session；可同时提交 getPhoneNumber 的加密数据绑定手机号）
+// POST /api/v1/auth/wechat/mini-login
+func (h *WeChatAuthHandler) MiniProgramLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.WeChatMiniLoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		ip := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+		attempt := &plugins.AuthAttempt{
+			Provider: "wechat_mini",
+			Credentials: map[string]interface{}{
+				"code":           req.Code,
+				"encrypted_data": req.EncryptedData,
+				"iv":             req.IV,
+				"nickname":       req.Nickname,
+				"avatar":         req.Avatar,
+			},
+			IP:        ip,
+			UserAgent: userAgent,
+		}
+		// 传入 gin.Context 以便注册时读取项目Key
+		user, err := h.pluginManager.Authenticate(c, attempt)
+		if err != nil {
+			h.statsService.RecordLoginLog("", "wechat_mini", ip, userAgent, "", false, err.Error())
+			switch {
+			case errors.Is(err, services.ErrIdentityEmailConflict), errors.Is(err, services.ErrIdentityPhoneConflict):
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+			case errors.Is(err, plugins.ErrWeChatDecryptFailed), errors.Is(err, plugins.ErrWeChatAppIDMismatch):
+				c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
+			default:
+				c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: "WeChat mini program login failed: " + err.Error()})
+			}
+			return
+		}
+
+		// 标识使用小程序 openid
+		identifier := user.ID
+		var identity models.UserIdentity
+		if err := h.db.Where("user_id = ? AND provider = ?", user.ID, "wechat_mini").First(&identity).Error; err == nil {
+			identifier = identity.Subject
+		}
+		projectKey := ""
+		if v, ok := c.Get(middleware.CtxProjectKey); ok {
+			projectKey = v.(string)
+		}
+		localID := ""
+		if projectKey != "" {
+			var pm models.ProjectMapping
+			if err := h.db.Where("project_name = ? AND user_id = ?", projectKey, user.ID).First(&pm).Error; err == nil {
+				localID = pm.LocalUserID
+			}
+		}
+		token, err := utils.GenerateUnifiedTokenWithClaims(user.ID, identifier, user.Role, projectKey, localID, attempt.Claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to generate token"})
+			return
+		}
+
+		h.statsService.UpdateUserLoginInfo(user.ID, ip, userAgent)
+		h.statsService.RecordLoginLog(user.ID, "wechat_mini", ip, userAgent, "", true, "")
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "WeChat mini program login successful", Data: models.LoginResponse{User: user.ToResponse(), Token: token}})
+	}
+}
+
+// BindMiniProgramPhone 已登录用户通过小程序 getPhoneNumber 绑定手机号（小程序身份须属于当前用户）
+// POST /api/v1/user/wechat/mini-phone
+func (h *WeChatAuthHandler) BindMiniProgramPhone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.WeChatMiniPhoneRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid request data: " + err.Error()})
+			return
+		}
+		provider, err := h.pluginManager.GetEnabledProvider("wechat_mini")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
+			return
+		}
+		mini, ok := provider.(*plugins.WeChatMiniProgramProvider)
+		if !ok {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "WeChat mini program provider not available"})
+			return
+		}
+
+		session, err := mini.Code2Session(c.Request.Context(), req.Code)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, models.Response{Code: 401, Message: "Failed to verify mini program session: " + err.Error()})
+			return
+		}
+		userID := c.GetString("user_id")
+		if owner, _, err := services.FindUserByIdentity(h.db, "wechat_mini", session.OpenID); err != nil || owner.ID != userID {
+			c.JSON(http.StatusForbidden, models.Response{Code: 403, Message: "Mini program account is not linked to the current user"})
+			return
+		}
+
+		info, err := mini.DecryptPhoneNumber(session.SessionKey, req.EncryptedData, req.IV)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: err.Error()})
+			return
+		}
+		phone := plugins.WeChatPhone(info)
+		if phone == "" {
+			c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "WeChat returned an empty phone number"})
+			return
+		}
+		user, err := services.AttachVerifiedPhone(h.db, userID, phone)
+		if err != nil {
+			if errors.Is(err, services.ErrPhoneInUse) {
+				c.JSON(http.StatusConflict, models.Response{Code: 409, Message: err.Error()})
+				return
+			}
+			if errors.Is(err, utils.ErrInvalidPhone) {
+				c.JSON(http.StatusBadRequest, models.Response{Code: 400, Message: "Invalid phone number format"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: "Failed to bind phone"})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{Code: 200, Message: "Phone bound successfully", Data: user.ToResponse()})
+	}
+}
+
 // generateRandomState 生成随机state
 func generateRandomState() string {
 	bytes := make([]byte, 16)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"unit-auth/config"
@@ -31,8 +32,41 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// 初始化邮件服务
+	// 初始化邮件服务（模板支持按项目/语言覆盖与项目品牌）
 	mailer := utils.NewMailer()
+	emailTemplates := services.NewEmailTemplateService(db)
+	mailer.SetTemplateResolver(emailTemplates)
+
+	// 邮件发件箱：请求中只入队，后台 worker 按 MAIL_TRANSPORT 投递并重试
+	emailOutbox := services.NewEmailOutboxFromConfig(db, mailer.Transport())
+	mailer.SetQueue(emailOutbox)
+	emailOutbox.Start()
+	defer emailOutbox.Stop()
+
+	// 用户事件 Webhook：事件随业务事务写入投递表，后台 worker 签名投递并重试
+	webhookDispatcher := services.NewWebhookDispatcherFromConfig(db)
+	webhookDispatcher.Start()
+	defer webhookDispatcher.Stop()
+
+	// 项目开通发件箱：在项目中创建 / 更新 / 删除用户的调用随业务事务写入，后台 worker 带幂等键执行
+	provisioningOutbox := services.NewProvisioningOutboxFromConfig(db)
+	provisioningOutbox.Start()
+	defer provisioningOutbox.Stop()
+
+	// 数据同步引擎：按任务 cron 调度全量 / 增量同步，字段映射与转换后写入目标，记录冲突与日志
+	syncEngine := services.NewSyncEngineFromConfig(db)
+	syncEngine.Start()
+	defer syncEngine.Stop()
+
+	// 数据变更处理：CDC 回调写入的 data_changes 交给订阅者（同步引擎等），失败按退避重试
+	changeProcessor := services.NewChangeProcessorFromConfig(db)
+	changeProcessor.Start()
+	defer changeProcessor.Stop()
+
+	// 项目映射核对：核对已有映射、按项目用户补建映射、为缺少映射的用户写入开通任务，按游标分批执行
+	reconciler := services.NewMappingReconcilerFromConfig(db)
+	reconciler.Start()
+	defer reconciler.Stop()
 
 	// 初始化统计服务
 	statsService := services.NewStatsService(db)
@@ -43,33 +77,38 @@ func main() {
 	// 启动验证码清理调度器
 	cleanupService.StartCleanupScheduler()
 
+	// 初始化审计服务
+	auditService := services.NewAuditService(db)
+
+	// 初始化OAuth授权事务服务（state / PKCE / nonce）
+	oauthTxService := services.NewOAuthTransactionService(db)
+
+	// 跨设备登录状态推送（进程内发布订阅：扫码登录、魔法链接等）
+	loginEvents := services.NewMemoryLoginEventBroker()
+
+	// 短信网关（按 SMS_PROVIDERS / SMS_ROUTING 选择服务商，故障转移并记录投递状态）
+	smsGateway := services.NewSMSGatewayFromConfig(db)
+	smsHandler := services.NewSMSHandler(db, smsGateway)
+	smsGatewayHandler := handlers.NewSMSGatewayHandler(db, smsGateway)
+
+	// 验证码发送限制（按接收方冷却/每日上限、国家与号段预算、短信费用熔断、人机验证）
+	verificationThrottle := services.NewVerificationThrottleFromEnv(db)
+
+	// 邮箱 / 手机号变更（新地址验证、旧地址撤销、推送到已映射项目）
+	contactChangeService := services.NewContactChangeService(db, mailer, smsGateway)
+	contactChangeHandler := handlers.NewContactChangeHandler(db, contactChangeService, verificationThrottle)
+
 	// 初始化插件管理器
 	pluginManager := plugins.NewPluginManager()
 
-	// 注册认证提供者
-	emailProvider := plugins.NewEmailProvider(db, mailer)
-	phoneProvider := plugins.NewPhoneProvider(db)
-
-	// 注册Google OAuth提供者
-	googleProvider := plugins.NewGoogleProvider(
-		db,
-		os.Getenv("GOOGLE_CLIENT_ID"),
-		os.Getenv("GOOGLE_CLIENT_SECRET"),
-		os.Getenv("GOOGLE_REDIRECT_URI"),
-	)
-
-	// 注册微信OAuth提供者
-	wechatProvider := plugins.NewWeChatProvider(
-		db,
-		os.Getenv("WECHAT_APP_ID"),
-		os.Getenv("WECHAT_APP_SECRET"),
-		os.Getenv("WECHAT_REDIRECT_URI"),
-	)
-
-	pluginManager.RegisterProvider(emailProvider)
-	pluginManager.RegisterProvider(phoneProvider)
-	pluginManager.RegisterProvider(googleProvider)
-	pluginManager.RegisterProvider(wechatProvider)
+	// 注册认证提供者：内置提供者 + 数据库配置的通用 OIDC/OAuth2 提供者，支持管理接口热重载
+	pluginManager.AddLoader(plugins.SourceBuiltin, plugins.BuiltinLoader(db, mailer))
+	pluginManager.AddLoader(plugins.SourceConfig, plugins.OIDCConfigLoader(db))
+	reloadReport := pluginManager.Reload(context.Background())
+	for name, msg := range reloadReport.Errors {
+		log.Printf("Warning: auth provider %s: %s", name, msg)
+	}
+	defer pluginManager.Close()
 
 	// 设置Gin模式
 	if os.Getenv("GIN_MODE") == "release" {
@@ -80,7 +119,7 @@ func main() {
 	r := gin.Default()
 
 	// 添加中间件
-	r.Use(middleware.CORS())
+	r.Use(middleware.CORS(db))
 	r.Use(middleware.Logger())
 	r.Use(middleware.RequestID())
 	r.Use(middleware.RateLimit())
@@ -112,7 +151,18 @@ func main() {
 		api.GET("/projects/current", handlers.GetCurrentProject(db))
 
 		// 公开的第三方接入示例
-		api.GET("/projects/integration-docs", handlers.GetIntegrationDocs())
+		api.GET("/projects/integration-docs", handlers.GetIntegrationDocs(db))
+
+		// 通知类邮件退订（List-Unsubscribe 链接与一键退订）
+		api.GET("/email/unsubscribe", handlers.EmailUnsubscribe(db))
+		api.POST("/email/unsubscribe", handlers.EmailUnsubscribe(db))
+
+		// 邮箱 / 手机号变更撤销（旧地址收到的通知链接，无需登录）
+		api.GET("/user/contact-change/revert", contactChangeHandler.Revert())
+		api.POST("/user/contact-change/revert", contactChangeHandler.Revert())
+
+		// 短信服务商投递状态回执
+		api.POST("/sms/status/:vendor", smsGatewayHandler.StatusCallback())
 
 		// 认证相关路由
 		auth := api.Group("/auth")
@@ -123,35 +173,35 @@ func main() {
 			auth.POST("/token/exchange", handlers.TokenExchange())
 
 			// 插件认证处理器
-			// 注册 GitHub Provider
-			pluginManager.RegisterProvider(plugins.NewGitHubProvider(db))
-			pluginAuthHandler := handlers.NewPluginAuthHandler(db, pluginManager, statsService)
+			pluginAuthHandler := handlers.NewPluginAuthHandler(db, pluginManager, statsService, oauthTxService)
 
 			auth.POST("/oauth-login", pluginAuthHandler.OAuthLogin())
 			auth.GET("/oauth/:provider/url", pluginAuthHandler.GetOAuthURL())
 			auth.GET("/providers", pluginAuthHandler.GetAvailableProviders())
 
 			// 微信扫码登录专用路由
-			wechatAuthHandler := handlers.NewWeChatAuthHandler(db, wechatProvider, statsService)
+			wechatAuthHandler := handlers.NewWeChatAuthHandler(db, pluginManager, statsService, loginEvents)
 			auth.GET("/wechat/qr-code", wechatAuthHandler.GetQRCode())
 			auth.GET("/wechat/callback", wechatAuthHandler.HandleCallback())
 			auth.GET("/wechat/status/:state", wechatAuthHandler.CheckLoginStatus())
+			auth.GET("/wechat/events/:state", wechatAuthHandler.StreamLoginStatus())
+			auth.POST("/wechat/mini-login", wechatAuthHandler.MiniProgramLogin())
 
 			// 传统认证接口（保持兼容性）
 			auth.POST("/register", handlers.Register(db, mailer))
-			auth.POST("/send-email-code", handlers.SendEmailCode(db, mailer))
-			auth.POST("/send-sms-code", handlers.SendPhoneCode(db))
+			auth.POST("/send-email-code", handlers.SendEmailCode(db, mailer, verificationThrottle))
+			auth.POST("/send-sms-code", handlers.SendPhoneCode(db, smsHandler, verificationThrottle))
 			auth.POST("/email-login", handlers.EmailCodeLogin(db, mailer))
 			auth.POST("/verify-email", handlers.VerifyEmail(db))
-			auth.POST("/forgot-password", handlers.ForgotPassword(db, mailer))
+			auth.POST("/forgot-password", handlers.ForgotPassword(db, mailer, verificationThrottle))
 			auth.POST("/reset-password", handlers.ResetPassword(db))
 
 			// 统一登录接口
 			auth.POST("/login", handlers.UnifiedLogin(db))
 
 			// 手机号认证接口
-			auth.POST("/phone-login", handlers.PhoneLogin(db))
-			auth.POST("/phone-direct-login", handlers.PhoneDirectLogin(db)) // 直接登录（自动注册）
+			auth.POST("/phone-login", handlers.PhoneLogin(db, smsHandler))
+			auth.POST("/phone-direct-login", handlers.PhoneDirectLogin(db, smsHandler)) // 直接登录（自动注册）
 			auth.POST("/phone-reset-password", handlers.PhoneResetPassword(db))
 
 			auth.POST("/refresh-token", handlers.RefreshToken())                              // 简单续签
@@ -167,7 +217,22 @@ func main() {
 		{
 			protected.GET("/profile", handlers.GetProfile(db))
 			protected.PUT("/profile", handlers.UpdateProfile(db))
-			protected.POST("/change-password", handlers.ChangePassword(db))
+			protected.GET("/impersonations", handlers.GetMyImpersonations(db))
+
+			// 敏感操作：禁止模拟登录token访问
+			protected.POST("/change-password", middleware.DenyImpersonation(), handlers.ChangePassword(db))
+			protected.POST("/change-email", middleware.DenyImpersonation(), contactChangeHandler.ChangeEmail())
+			protected.POST("/change-email/confirm", middleware.DenyImpersonation(), contactChangeHandler.ConfirmEmail())
+			protected.POST("/change-phone", middleware.DenyImpersonation(), contactChangeHandler.ChangePhone())
+			protected.POST("/change-phone/confirm", middleware.DenyImpersonation(), contactChangeHandler.ConfirmPhone())
+
+			// 第三方身份绑定
+			identityHandler := handlers.NewIdentityHandler(db, pluginManager, oauthTxService)
+			protected.GET("/identities", identityHandler.ListIdentities())
+			protected.GET("/identities/:provider/link-url", middleware.DenyImpersonation(), identityHandler.GetLinkURL())
+			protected.POST("/identities/:provider/link", middleware.DenyImpersonation(), identityHandler.LinkIdentity())
+			protected.DELETE("/identities/:provider", middleware.DenyImpersonation(), identityHandler.UnlinkIdentity())
+			protected.POST("/wechat/mini-phone", middleware.DenyImpersonation(), handlers.NewWeChatAuthHandler(db, pluginManager, statsService, loginEvents).BindMiniProgramPhone())
 		}
 
 		// 统计相关路由
@@ -187,18 +252,25 @@ func main() {
 			stats.GET("/daily-enhanced", statsHandler.GetDailyStatsEnhanced())
 		}
 
-		// 管理接口（需要管理员权限）
+		// 管理接口（需要管理员权限）；审计中间件注册在鉴权之前，被拒绝的写操作也以 denied 记录
 		admin := api.Group("/admin")
+		admin.Use(middleware.AuditMiddleware(auditService))
 		admin.Use(middleware.AuthMiddleware())
+		admin.Use(middleware.DenyImpersonation())
 		admin.Use(middleware.AdminMiddleware())
 		{
 			// 用户管理
 			admin.GET("/users", handlers.GetUsers(db))
 			admin.GET("/users/:id", handlers.GetUser(db))
-			admin.PUT("/users/:id", handlers.UpdateUser(db))
+			admin.PUT("/users/:id", handlers.UpdateUser(db, contactChangeService))
 			admin.DELETE("/users/:id", handlers.DeleteUser(db))
 			admin.POST("/users/bulk-update", handlers.BulkUpdateUsers(db))
 
+			// 模拟登录
+			admin.POST("/users/:id/impersonate", handlers.StartImpersonation(db))
+			admin.GET("/impersonations", handlers.ListImpersonations(db))
+			admin.POST("/impersonations/:id/stop", handlers.StopImpersonation(db))
+
 			// 统计分析
 			admin.GET("/stats/users", handlers.GetUserStats(db))
 			admin.GET("/stats/login-logs", handlers.GetLoginLogs(db))
@@ -218,18 +290,151 @@ func main() {
 			admin.GET("/charts/dashboard", handlers.GetDashboardCharts(db))
 
 			// 系统管理
-			admin.GET("/verification-stats", handlers.GetVerificationStats(db, cleanupService))
+			admin.GET("/verification-stats", handlers.GetVerificationStats(db, cleanupService, verificationThrottle))
 			admin.POST("/cleanup-verifications", handlers.CleanupVerifications(db, cleanupService))
 
+			// 短信网关
+			admin.GET("/sms/vendors", smsGatewayHandler.GetVendors())
+			admin.GET("/sms/deliveries", smsGatewayHandler.ListDeliveries())
+			admin.POST("/sms/spend-breaker/reset", handlers.ResetSMSSpendBreaker(verificationThrottle))
+
+			// 邮件发件箱
+			emailOutboxHandler := handlers.NewEmailOutboxHandler(db, emailOutbox)
+			admin.GET("/email-outbox", emailOutboxHandler.ListMessages())
+			admin.GET("/email-outbox/stats", emailOutboxHandler.GetStats())
+			admin.POST("/email-outbox/:id/retry", emailOutboxHandler.RetryMessage())
+
+			// 项目管理
+			projectHandler := handlers.NewProjectHandler(db)
+			admin.GET("/projects", projectHandler.ListProjects())
+			admin.POST("/projects", projectHandler.CreateProject())
+			admin.GET("/projects/:key", projectHandler.GetProject())
+			admin.PUT("/projects/:key", projectHandler.UpdateProject())
+			admin.DELETE("/projects/:key", projectHandler.DeleteProject())
+			admin.POST("/projects/:key/rotate-credentials", projectHandler.RotateCredentials())
+			admin.POST("/projects/:key/test", projectHandler.TestConnection())
+			admin.GET("/projects/:key/integration-docs", projectHandler.GetIntegrationDocs())
+			admin.GET("/projects/:key/scim-tokens", projectHandler.ListScimTokens())
+			admin.POST("/projects/:key/scim-tokens", projectHandler.CreateScimToken())
+			admin.DELETE("/projects/:key/scim-tokens/:id", projectHandler.RevokeScimToken())
+
+			// 项目映射核对
+			reconciliationHandler := handlers.NewReconciliationHandler(db, reconciler)
+			admin.GET("/projects/:key/reconciliations", reconciliationHandler.ListRuns())
+			admin.POST("/projects/:key/reconciliations", reconciliationHandler.StartRun())
+			admin.GET("/projects/:key/reconciliations/:id", reconciliationHandler.GetRun())
+			admin.GET("/projects/:key/reconciliations/:id/report", reconciliationHandler.GetReport())
+			admin.POST("/projects/:key/reconciliations/:id/pause", reconciliationHandler.PauseRun())
+			admin.POST("/projects/:key/reconciliations/:id/resume", reconciliationHandler.ResumeRun())
+			admin.POST("/projects/:key/reconciliations/:id/cancel", reconciliationHandler.CancelRun())
+
+			// 项目开通发件箱
+			provisioningHandler := handlers.NewProvisioningHandler(db, provisioningOutbox)
+			admin.GET("/provisioning", provisioningHandler.ListJobs())
+			admin.POST("/provisioning/:id/retry", provisioningHandler.RetryJob())
+
+			// 数据同步
+			syncHandler := handlers.NewSyncHandler(db, syncEngine)
+			admin.GET("/sync/tasks", syncHandler.ListTasks())
+			admin.POST("/sync/tasks", syncHandler.CreateTask())
+			admin.GET("/sync/tasks/:id", syncHandler.GetTask())
+			admin.PUT("/sync/tasks/:id", syncHandler.UpdateTask())
+			admin.POST("/sync/tasks/:id/run", syncHandler.RunTask())
+			admin.POST("/sync/tasks/:id/pause", syncHandler.PauseTask())
+			admin.POST("/sync/tasks/:id/resume", syncHandler.ResumeTask())
+			admin.POST("/sync/mappings", syncHandler.CreateMapping())
+			admin.DELETE("/sync/mappings/:id", syncHandler.DeleteMapping())
+			admin.GET("/sync/logs", syncHandler.ListLogs())
+			admin.GET("/sync/logs/:id", syncHandler.GetLog())
+			admin.GET("/sync/conflicts", syncHandler.ListConflicts())
+			admin.POST("/sync/conflicts/resolve", syncHandler.BatchResolveConflicts())
+			admin.GET("/sync/conflicts/:id", syncHandler.GetConflict())
+			admin.POST("/sync/conflicts/:id/resolve", syncHandler.ResolveConflict())
+
+			// 数据变更记录
+			changeFeedHandler := handlers.NewChangeFeedHandler(db, changeProcessor)
+			admin.GET("/data-changes", changeFeedHandler.ListChanges())
+			admin.GET("/data-changes/:id", changeFeedHandler.GetChange())
+			admin.POST("/data-changes/:id/retry", changeFeedHandler.RetryChange())
+
+			// 用户事件 Webhook
+			webhookHandler := handlers.NewWebhookHandler(db, webhookDispatcher)
+			admin.GET("/webhooks/event-types", webhookHandler.ListEventTypes())
+			admin.GET("/webhooks/subscriptions", webhookHandler.ListSubscriptions())
+			admin.POST("/webhooks/subscriptions", webhookHandler.CreateSubscription())
+			admin.PUT("/webhooks/subscriptions/:id", webhookHandler.UpdateSubscription())
+			admin.DELETE("/webhooks/subscriptions/:id", webhookHandler.DeleteSubscription())
+			admin.POST("/webhooks/subscriptions/:id/rotate-secret", webhookHandler.RotateSecret())
+			admin.POST("/webhooks/subscriptions/:id/test", webhookHandler.TestSubscription())
+			admin.POST("/webhooks/subscriptions/:id/replay", webhookHandler.ReplayEvents())
+			admin.GET("/webhooks/deliveries", webhookHandler.ListDeliveries())
+			admin.GET("/webhooks/deliveries/:id", webhookHandler.GetDelivery())
+			admin.POST("/webhooks/deliveries/:id/replay", webhookHandler.ReplayDelivery())
+
+			// 邮件模板
+			emailTemplateHandler := handlers.NewEmailTemplateHandler(db, emailTemplates)
+			admin.GET("/email-templates", emailTemplateHandler.ListTemplates())
+			admin.GET("/email-templates/overrides", emailTemplateHandler.ListOverrides())
+			admin.POST("/email-templates/overrides", emailTemplateHandler.CreateOverride())
+			admin.PUT("/email-templates/overrides/:id", emailTemplateHandler.UpdateOverride())
+			admin.DELETE("/email-templates/overrides/:id", emailTemplateHandler.DeleteOverride())
+			admin.POST("/email-templates/preview", emailTemplateHandler.Preview())
+			admin.PUT("/projects/:key/email-branding", emailTemplateHandler.UpdateProjectBranding())
+
 			// 数据备份和恢复
 			backupHandler := handlers.NewBackupHandler(db)
 			admin.POST("/backup/export", backupHandler.ExportBackup())
 			admin.POST("/backup/import", backupHandler.ImportBackup())
 			admin.GET("/backup/info", backupHandler.GetBackupInfo())
 			admin.POST("/backup/validate", backupHandler.ValidateBackup())
+
+			// 第三方登录提供者配置
+			authProviderHandler := handlers.NewAuthProviderHandler(db, pluginManager)
+			admin.GET("/auth-providers", authProviderHandler.ListProviderConfigs())
+			admin.POST("/auth-providers", authProviderHandler.CreateProviderConfig())
+			admin.PUT("/auth-providers/:id", authProviderHandler.UpdateProviderConfig())
+			admin.DELETE("/auth-providers/:id", authProviderHandler.DeleteProviderConfig())
+			admin.GET("/providers", authProviderHandler.ListProviders())
+			admin.GET("/providers/health", authProviderHandler.ProviderHealth())
+			admin.POST("/providers/reload", authProviderHandler.ReloadProviders())
+			admin.POST("/providers/:name/enable", authProviderHandler.SetProviderEnabled(true))
+			admin.POST("/providers/:name/disable", authProviderHandler.SetProviderEnabled(false))
+
+			// 审计日志
+			auditHandler := handlers.NewAuditHandler(auditService)
+			admin.GET("/audit-logs", auditHandler.GetAuditLogs())
+			admin.GET("/audit-logs/export", auditHandler.ExportAuditLogs())
+			admin.GET("/audit-logs/verify", auditHandler.VerifyAuditChain())
 		}
 	}
 
+	// SCIM 2.0 开通接口（项目 SCIM 令牌认证，写操作记录审计）
+	scimHandler := handlers.NewScimHandler(db)
+	scim := r.Group("/scim/v2")
+	scim.Use(middleware.AuditMiddleware(auditService))
+	scim.Use(middleware.ScimAuth(db))
+	{
+		scim.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig())
+		scim.GET("/Schemas", scimHandler.ListSchemas())
+		scim.GET("/Schemas/:id", scimHandler.GetSchema())
+		scim.GET("/ResourceTypes", scimHandler.ListResourceTypes())
+		scim.GET("/ResourceTypes/:id", scimHandler.GetResourceType())
+
+		scim.GET("/Users", scimHandler.ListUsers())
+		scim.POST("/Users", scimHandler.CreateUser())
+		scim.GET("/Users/:id", scimHandler.GetUser())
+		scim.PUT("/Users/:id", scimHandler.ReplaceUser())
+		scim.PATCH("/Users/:id", scimHandler.PatchUser())
+		scim.DELETE("/Users/:id", scimHandler.DeleteUser())
+
+		scim.GET("/Groups", scimHandler.ListGroups())
+		scim.POST("/Groups", scimHandler.CreateGroup())
+		scim.GET("/Groups/:id", scimHandler.GetGroup())
+		scim.PUT("/Groups/:id", scimHandler.ReplaceGroup())
+		scim.PATCH("/Groups/:id", scimHandler.PatchGroup())
+		scim.DELETE("/Groups/:id", scimHandler.DeleteGroup())
+	}
+
 	// 启动服务器
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计上下文键：处理器可通过下列辅助函数补充审计信息
+const (
+	ctxAuditAction     = "audit_action"
+	ctxAuditResource   = "audit_resource"
+	ctxAuditResourceID = "audit_resource_id"
+	ctxAuditBefore     = "audit_before"
+	ctxAuditAfter      = "audit_after"
+	ctxAuditDetails    = "audit_details"
+	ctxAuditSkip       = "audit_skip"
+)
+
+// SetAuditAction 覆盖默认推导的审计动作名
+func SetAuditAction(c *gin.Context, action string) {
+	c.Set(ctxAuditAction, action)
+}
+
+// SetAuditTarget 设置审计目标资源
+func SetAuditTarget(c *gin.Context, resource, resourceID string) {
+	c.Set(ctxAuditResource, resource)
+	c.Set(ctxAuditResourceID, resourceID)
+}
+
+// SetAuditChange 设置变更前后快照，审计日志会据此生成字段级差异
+func SetAuditChange(c *gin.Context, before, after interface{}) {
+	if before != nil {
+		c.Set(ctxAuditBefore, before)
+	}
+	if after != nil {
+		c.Set(ctxAuditAfter, after)
+	}
+}
+
+// AddAuditDetail 追加审计详情字段
+func AddAuditDetail(c *gin.Context, key string, value interface{}) {
+	details, _ := c.Get(ctxAuditDetails)
+	m, ok := details.(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+		c.Set(ctxAuditDetails, m)
+	}
+	m[key] = value
+}
+
+// SkipAudit 本次请求不记录审计（例如处理器已显式调用 AuditService.Record）
+func SkipAudit(c *gin.Context) {
+	c.Set(ctxAuditSkip, true)
+}
+
+// AuditMiddleware 管理接口审计中间件：在请求结束后记录写操作的操作者、目标、差异与结果
+func AuditMiddleware(auditService *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		if auditService == nil || c.GetBool(ctxAuditSkip) {
+			return
+		}
+
+		entry := BuildAuditEntry(c)
+		entry.Action = c.GetString(ctxAuditAction)
+		if entry.Action == "" {
+			entry.Action = strings.ToLower(c.Request.Method) + " " + c.FullPath()
+		}
+		entry.Resource = c.GetString(ctxAuditResource)
+		if entry.Resource == "" {
+			entry.Resource = resourceFromPath(c.FullPath())
+		}
+		entry.ResourceID = c.GetString(ctxAuditResourceID)
+		if entry.ResourceID == "" {
+			entry.ResourceID = c.Param("id")
+		}
+
+		status := c.Writer.Status()
+		switch {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			entry.Status = "denied"
+		case status >= http.StatusBadRequest:
+			entry.Status = "failed"
+		default:
+			entry.Status = "success"
+		}
+		if entry.Status != "success" {
+			entry.ErrorMsg = http.StatusText(status)
+			if len(c.Errors) > 0 {
+				entry.ErrorMsg = c.Errors.String()
+			}
+		}
+
+		entry.Before, _ = c.Get(ctxAuditBefore)
+		entry.After, _ = c.Get(ctxAuditAfter)
+		if details, ok := c.Get(ctxAuditDetails); ok {
+			entry.Details, _ = details.(map[string]interface{})
+		}
+		if entry.Details == nil {
+			entry.Details = map[string]interface{}{}
+		}
+		entry.Details["http_status"] = status
+		entry.Details["method"] = c.Request.Method
+		entry.Details["path"] = c.Request.URL.Path
+
+		if _, err := auditService.Record(entry); err != nil {
+			log.Printf("Warning: failed to record audit log: %v", err)
+		}
+	}
+}
+
+// BuildAuditEntry 从请求上下文中提取操作者、请求ID、IP等公共审计字段
+func BuildAuditEntry(c *gin.Context) services.AuditEntry {
+	project := ""
+	if v, ok := c.Get(CtxProjectKey); ok {
+		project, _ = v.(string)
+	}
+	// 模拟登录期间，真实操作者为管理员
+	actorID := c.GetString("actor_id")
+	if actorID == "" {
+		actorID = c.GetString("user_id")
+	}
+	return services.AuditEntry{
+		ActorID:   actorID,
+		Project:   project,
+		RequestID: c.GetString("request_id"),
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+	}
+}
+
+// resourceFromPath 由路由模板推导资源名，例如 /api/v1/admin/users/:id -> users
+func resourceFromPath(fullPath string) string {
+	segments := strings.Split(strings.Trim(fullPath, "/"), "/")
+	for i, seg := range segments {
+		if seg == "admin" && i+1 < len(segments) {
+			return segments[i+1]
+		}
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i] != "" && !strings.HasPrefix(segments[i], ":") {
+			return segments[i]
+		}
+	}
+	return "unknown"
+}
@@ -48,6 +48,26 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 模拟登录token：会话结束或过期后立即失效
+		if claims.IsImpersonation() && !models.IsImpersonationTokenActive(models.GetDB(), claims.ID) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": "Impersonation session has ended",
+			})
+			c.Abort()
+			return
+		}
+
+		// 会话已吊销（如联系方式变更被撤销）：之前签发的token全部失效
+		if models.IsTokenRevoked(models.GetDB(), claims) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": "Token has been revoked",
+			})
+			c.Abort()
+			return
+		}
+
 		// log.Println("token :::::: ", token)
 		// log.Println("claims :::::: ", claims.UserID, claims.LocalUserID, claims.Email, claims.Role)
 
@@ -56,15 +76,48 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Set("local_user_id", claims.LocalUserID)
 		c.Set("email", claims.Email)
 		c.Set("role", claims.Role)
+		if claims.IsImpersonation() {
+			c.Set("actor_id", claims.ActorID)
+			c.Set("impersonation_token_id", claims.ID)
+		}
 
 		c.Next()
 	}
 }
 
+// DenyImpersonation 拒绝模拟登录token访问敏感接口（改密、MFA、删除账号、管理接口等）
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("actor_id") != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "This operation is not allowed while impersonating",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // CORS中间件
-func CORS() gin.HandlerFunc {
+func CORS(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
+		// 配置了来源白名单（CORS_ALLOWED_ORIGINS 或项目 allowed_origins）时只回显白名单内的来源
+		if origin := c.GetHeader("Origin"); origin != "" {
+			allowed, restricted := services.Projects.IsOriginAllowed(db, origin)
+			if !restricted {
+				c.Header("Access-Control-Allow-Origin", "*")
+			} else {
+				c.Writer.Header().Add("Vary", "Origin")
+				if allowed {
+					c.Header("Access-Control-Allow-Origin", origin)
+					c.Header("Access-Control-Allow-Credentials", "true")
+				}
+			}
+		} else {
+			c.Header("Access-Control-Allow-Origin", "*")
+		}
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Genres-Type, Authorization")
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"unit-auth/models"
 	"unit-auth/utils"
 
 	"github.com/gin-gonic/gin"
@@ -35,6 +36,12 @@ func AutoRefreshMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 已吊销的token不续签
+		if claims, err := utils.ValidateEnhancedToken(token); err != nil || models.IsTokenRevoked(models.GetDB(), claims) {
+			c.Next()
+			return
+		}
+
 		// 自动续签token
 		tokenResponse, err := utils.ExtendToken(token)
 		if err != nil {
@@ -163,6 +170,15 @@ func EnhancedAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if models.IsTokenRevoked(models.GetDB(), claims) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": "Token has been revoked",
+			})
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存储到上下文中
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
@@ -197,8 +213,8 @@ func RefreshTokenMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 只对access token进行自动续签
-		if claims.TokenType != "access" {
+		// 只对未吊销的access token进行自动续签
+		if claims.TokenType != "access" || models.IsTokenRevoked(models.GetDB(), claims) {
 			c.Next()
 			return
 		}
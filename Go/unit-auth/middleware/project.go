@@ -20,7 +20,7 @@ func ProjectKeyMiddleware() gin.HandlerFunc {
 			return
 		}
 		c.Set(CtxProjectKey, key)
-		c.Header("Vary", "X-Genres-Type")
+		c.Writer.Header().Add("Vary", "X-Genres-Type")
 		c.Next()
 	}
 }
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SCIM 上下文键
+const (
+	CtxScimProject = "scim_project"
+	CtxScimToken   = "scim_token"
+)
+
+// ScimAuth SCIM 接口认证：Authorization: Bearer <项目 SCIM 令牌>，通过后在上下文中设置项目与令牌
+func ScimAuth(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		plain := ""
+		if parts := strings.SplitN(authHeader, " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+			plain = strings.TrimSpace(parts[1])
+		}
+		if plain == "" {
+			scimUnauthorized(c, "Authorization header with a SCIM bearer token is required")
+			return
+		}
+		token, project, err := services.AuthenticateScimToken(db, plain)
+		if err != nil {
+			scimUnauthorized(c, err.Error())
+			return
+		}
+
+		c.Set(CtxScimProject, *project)
+		c.Set(CtxScimToken, token)
+		c.Set(CtxProjectKey, project.Key)
+		AddAuditDetail(c, "scim_token_id", token.ID)
+		c.Next()
+	}
+}
+
+func scimUnauthorized(c *gin.Context, detail string) {
+	c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+	c.Header("Content-Type", "application/scim+json")
+	c.AbortWithStatusJSON(http.StatusUnauthorized, models.ScimError{
+		Schemas: []string{models.ScimSchemaError},
+		Status:  strconv.Itoa(http.StatusUnauthorized),
+		Detail:  detail,
+	})
+}
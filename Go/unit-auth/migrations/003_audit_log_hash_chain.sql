@@ -0,0 +1,9 @@
+-- 数据库迁移脚本：审计日志哈希链
+-- 审计日志只追加写入，每条记录保存上一条的哈希，用于检测篡改与删除
+
+ALTER TABLE audit_logs
+    ADD COLUMN request_id VARCHAR(64) COMMENT '请求ID' AFTER error_msg,
+    ADD COLUMN prev_hash VARCHAR(64) COMMENT '上一条记录哈希' AFTER request_id,
+    ADD COLUMN hash VARCHAR(64) COMMENT '本条记录哈希' AFTER prev_hash,
+    ADD KEY idx_request_id (request_id),
+    ADD KEY idx_hash (hash);
@@ -0,0 +1,33 @@
+-- 数据库迁移脚本：第三方身份绑定表
+-- 每个第三方身份（provider + subject）独立一行，令牌加密存储；旧版 users.google_id/git_hub_id/we_chat_id 迁移至此表
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL COMMENT '用户ID',
+    provider VARCHAR(64) NOT NULL COMMENT '提供者名称',
+    subject VARCHAR(255) NOT NULL COMMENT '第三方用户标识',
+    email VARCHAR(255) COMMENT '第三方邮箱',
+    email_verified BOOLEAN DEFAULT FALSE COMMENT '第三方邮箱是否已验证',
+    raw_profile JSON COMMENT '第三方原始资料',
+    access_token_enc TEXT COMMENT '访问令牌（加密）',
+    refresh_token_enc TEXT COMMENT '刷新令牌（加密）',
+    token_expires_at DATETIME(3) NULL COMMENT '访问令牌过期时间',
+    last_login_at DATETIME(3) NULL COMMENT '最后一次通过该身份登录',
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    UNIQUE KEY idx_provider_subject (provider, subject),
+    KEY idx_user_identities_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 迁移旧版第三方ID
+INSERT IGNORE INTO user_identities (user_id, provider, subject, email, email_verified, created_at, updated_at)
+SELECT id, 'google', google_id, COALESCE(email, ''), email_verified, NOW(), NOW()
+FROM users WHERE google_id IS NOT NULL AND google_id != '' AND deleted_at IS NULL;
+
+INSERT IGNORE INTO user_identities (user_id, provider, subject, email, email_verified, created_at, updated_at)
+SELECT id, 'github', git_hub_id, COALESCE(email, ''), FALSE, NOW(), NOW()
+FROM users WHERE git_hub_id IS NOT NULL AND git_hub_id != '' AND deleted_at IS NULL;
+
+INSERT IGNORE INTO user_identities (user_id, provider, subject, email, email_verified, created_at, updated_at)
+SELECT id, 'wechat', we_chat_id, COALESCE(email, ''), FALSE, NOW(), NOW()
+FROM users WHERE we_chat_id IS NOT NULL AND we_chat_id != '' AND deleted_at IS NULL;
@@ -0,0 +1,26 @@
+-- 数据库迁移脚本：服务端 OAuth 授权事务
+-- state 由服务端生成并绑定浏览器 Cookie、提供者与项目，一次性使用；支持 PKCE 与 OIDC nonce
+
+CREATE TABLE IF NOT EXISTS o_auth_transactions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    state VARCHAR(64) NOT NULL COMMENT '服务端生成的state',
+    provider VARCHAR(64) NOT NULL COMMENT '提供者名称',
+    purpose VARCHAR(16) NOT NULL DEFAULT 'login' COMMENT '用途：login/link',
+    project_key VARCHAR(64) COMMENT '发起授权的项目',
+    user_id VARCHAR(36) COMMENT '绑定流程的发起用户',
+    binding_hash VARCHAR(64) NOT NULL COMMENT '浏览器绑定Cookie哈希',
+    redirect_uri TEXT COMMENT '登录完成后的跳转地址',
+    code_verifier_enc TEXT COMMENT 'PKCE code_verifier（加密）',
+    nonce VARCHAR(64) COMMENT 'OIDC nonce',
+    ip VARCHAR(45),
+    user_agent VARCHAR(500),
+    expires_at DATETIME(3) NOT NULL,
+    used_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    UNIQUE KEY idx_o_auth_transactions_state (state),
+    KEY idx_o_auth_transactions_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 项目级登录后跳转白名单
+ALTER TABLE projects
+    ADD COLUMN allowed_redirect_uris TEXT COMMENT '登录后允许跳转的地址（逗号或换行分隔，/* 结尾表示前缀）' AFTER enabled;
@@ -0,0 +1,22 @@
+-- 数据库迁移脚本：微信 UnionID 身份合并
+-- 网站应用（wechat）、公众号（wechat_oa）、小程序（wechat_mini）各自的 openid 不同，
+-- 同一开放平台下 UnionID 相同；登录时按 UnionID 将新应用的身份合并到已有用户
+
+ALTER TABLE user_identities
+    ADD COLUMN union_id VARCHAR(100) NULL COMMENT '微信UnionID' AFTER email_verified;
+
+CREATE INDEX idx_user_identities_union_id ON user_identities (union_id);
+
+-- 从已保存的原始资料补全 union_id
+UPDATE user_identities
+SET union_id = JSON_UNQUOTE(JSON_EXTRACT(raw_profile, '$.unionid'))
+WHERE provider LIKE 'wechat%'
+  AND (union_id IS NULL OR union_id = '')
+  AND JSON_UNQUOTE(JSON_EXTRACT(raw_profile, '$.unionid')) != '';
+
+-- 排查历史上已因缺少 UnionID 被拆分为多个用户的微信账号（需人工确认后合并）
+-- SELECT union_id, GROUP_CONCAT(DISTINCT user_id) AS user_ids
+-- FROM user_identities
+-- WHERE union_id IS NOT NULL AND union_id != ''
+-- GROUP BY union_id
+-- HAVING COUNT(DISTINCT user_id) > 1;
@@ -0,0 +1,24 @@
+-- 数据库迁移脚本：短信投递记录
+-- 短信网关每次向服务商（阿里云 / 腾讯云 / Twilio）提交记录一条，
+-- 故障转移时同一 request_id 下有多条；服务商状态回执按 vendor + message_id 回写
+
+CREATE TABLE IF NOT EXISTS sms_deliveries (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    request_id VARCHAR(64) NOT NULL COMMENT '网关请求ID',
+    phone VARCHAR(32) NOT NULL COMMENT '手机号',
+    template VARCHAR(50) NULL COMMENT '模板类型',
+    vendor VARCHAR(32) NOT NULL COMMENT '服务商',
+    message_id VARCHAR(128) NULL COMMENT '服务商消息ID',
+    attempt INT NOT NULL DEFAULT 1 COMMENT '第几次尝试',
+    status VARCHAR(20) NOT NULL COMMENT 'sent / failed / delivered / undelivered',
+    error_code VARCHAR(64) NULL,
+    error VARCHAR(500) NULL,
+    latency_ms BIGINT NOT NULL DEFAULT 0,
+    delivered_at DATETIME(3) NULL COMMENT '回执时间',
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    INDEX idx_sms_deliveries_request_id (request_id),
+    INDEX idx_sms_deliveries_phone (phone),
+    INDEX idx_sms_deliveries_vendor_message (vendor, message_id),
+    INDEX idx_sms_deliveries_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='短信投递记录表';
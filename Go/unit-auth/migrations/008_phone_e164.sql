@@ -0,0 +1,39 @@
+-- 数据库迁移脚本：手机号统一为 E.164 格式
+-- 历史数据中手机号为原始输入（如 13800138000、+86 138 0013 8000、008613800138000），
+-- 登录与验证码查询改为按 E.164（+8613800138000）匹配；项目可配置不带区号号码的默认地区
+-- 服务启动时 normalizeUserPhones 会按号码规则再补全一次（覆盖其他国家/地区的本地写法）
+
+ALTER TABLE projects
+    ADD COLUMN default_phone_region VARCHAR(2) NULL COMMENT '不带区号手机号的默认国家/地区（ISO 3166-1）' AFTER allowed_redirect_uris;
+
+-- 排查规范化后会冲突的号码（同一号码被不同写法注册为多个用户，需人工确认后合并）
+-- SELECT CONCAT('+86', RIGHT(REPLACE(REPLACE(REPLACE(phone, ' ', ''), '-', ''), '+', ''), 11)) AS e164,
+--        GROUP_CONCAT(id) AS user_ids
+-- FROM users
+-- WHERE REPLACE(REPLACE(REPLACE(phone, ' ', ''), '-', ''), '+', '') REGEXP '^(0086|86)?1[3-9][0-9]{9}$'
+-- GROUP BY e164
+-- HAVING COUNT(*) > 1;
+
+-- 去除分隔符（冲突的行保持原样，由启动时的规范化记录日志）
+UPDATE IGNORE users
+SET phone = REPLACE(REPLACE(REPLACE(REPLACE(phone, ' ', ''), '-', ''), '(', ''), ')', '')
+WHERE phone REGEXP '[ ()-]';
+
+-- 中国大陆本地号码
+UPDATE IGNORE users
+SET phone = CONCAT('+86', phone)
+WHERE phone REGEXP '^1[3-9][0-9]{9}$';
+
+-- 00 国际前缀与省略 + 的 86 前缀
+UPDATE IGNORE users
+SET phone = CONCAT('+', SUBSTRING(phone, 3))
+WHERE phone REGEXP '^00[1-9][0-9]{6,14}$';
+
+UPDATE IGNORE users
+SET phone = CONCAT('+', phone)
+WHERE phone REGEXP '^861[3-9][0-9]{9}$';
+
+-- 未过期的验证码同样改为 E.164，避免升级时正在进行的登录失败
+UPDATE sms_verifications
+SET phone = CONCAT('+86', phone)
+WHERE phone REGEXP '^1[3-9][0-9]{9}$' AND expires_at > NOW();
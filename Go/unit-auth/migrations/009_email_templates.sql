@@ -0,0 +1,20 @@
+-- 数据库迁移脚本：邮件模板注册表
+-- 内置模板随程序发布（utils/templates/email），notification_templates 中 type=email 的记录
+-- 按 template_key + project_key + locale 覆盖内置模板（project_key、locale 为空表示不限）；
+-- 项目可配置邮件品牌（名称、发件人名称、品牌色、Logo）
+
+ALTER TABLE notification_templates
+    ADD COLUMN template_key VARCHAR(64) NOT NULL DEFAULT '' COMMENT '内置模板Key' AFTER type,
+    ADD COLUMN project_key VARCHAR(64) NOT NULL DEFAULT '' COMMENT '项目Key，空为全局' AFTER template_key,
+    ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT '' COMMENT '语言，空为不限' AFTER project_key,
+    ADD COLUMN text_content TEXT NULL COMMENT '纯文本正文' AFTER content;
+
+-- 名称不再唯一；同一作用域只允许一条覆盖由管理接口校验（其他类型的通知模板没有 template_key）
+DROP INDEX idx_notification_templates_name ON notification_templates;
+CREATE INDEX idx_notification_template_scope ON notification_templates (type, template_key, project_key, locale);
+
+ALTER TABLE projects
+    ADD COLUMN email_brand_name VARCHAR(128) NULL COMMENT '邮件品牌名称' AFTER default_phone_region,
+    ADD COLUMN email_sender_name VARCHAR(128) NULL COMMENT '发件人名称' AFTER email_brand_name,
+    ADD COLUMN email_brand_color VARCHAR(16) NULL COMMENT '品牌色 #RRGGBB' AFTER email_sender_name,
+    ADD COLUMN email_logo_url TEXT NULL COMMENT 'Logo 地址' AFTER email_brand_color;
@@ -0,0 +1,29 @@
+-- 数据库迁移脚本：邮件发件箱
+-- 请求中只写入一条待投递记录，由后台 worker 领取（status=sending 并设置租约 locked_until）后投递，
+-- 失败按指数退避设置 next_attempt_at 重试，超过 MAIL_MAX_ATTEMPTS 或不可重试的错误进入死信（status=dead）
+
+CREATE TABLE IF NOT EXISTS email_outboxes (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    message_id VARCHAR(64) NOT NULL COMMENT '消息ID（传输幂等键）',
+    project_key VARCHAR(64) NULL COMMENT '所属项目',
+    template VARCHAR(64) NULL COMMENT '模板Key',
+    from_address VARCHAR(255) NULL,
+    from_name VARCHAR(100) NULL,
+    to_address VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NULL,
+    html_body LONGTEXT NULL,
+    text_body TEXT NULL,
+    status VARCHAR(20) NOT NULL COMMENT 'pending / sending / sent / dead',
+    attempts INT NOT NULL DEFAULT 0 COMMENT '已投递次数',
+    next_attempt_at DATETIME(3) NULL COMMENT '下次投递时间',
+    locked_until DATETIME(3) NULL COMMENT 'worker 租约到期时间',
+    transport VARCHAR(20) NULL COMMENT 'smtp / file / http / log',
+    last_error VARCHAR(500) NULL,
+    sent_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_email_outboxes_message_id (message_id),
+    INDEX idx_email_outboxes_project_key (project_key),
+    INDEX idx_email_outboxes_to_address (to_address),
+    INDEX idx_email_outbox_due (status, next_attempt_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='邮件发件箱表';
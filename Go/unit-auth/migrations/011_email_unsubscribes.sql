@@ -0,0 +1,11 @@
+-- 数据库迁移脚本：通知类邮件退订
+-- 欢迎、登录提醒等通知类邮件附带 List-Unsubscribe / List-Unsubscribe-Post 头，
+-- 收件人退订后发件箱入队时直接跳过；验证码与账户安全邮件不受影响
+
+CREATE TABLE IF NOT EXISTS email_unsubscribes (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    email VARCHAR(255) NOT NULL COMMENT '退订邮箱（小写）',
+    source VARCHAR(20) NULL COMMENT 'one_click / link',
+    created_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_email_unsubscribes_email (email)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='邮件退订表';
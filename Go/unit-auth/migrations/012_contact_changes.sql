@@ -0,0 +1,29 @@
+-- 数据库迁移脚本：邮箱 / 手机号变更记录
+-- 用户自助修改时先向新地址发送验证码（code_hash），确认后生效并标记为已验证；
+-- 旧地址收到带撤销链接的通知（revert_token_hash，CONTACT_CHANGE_REVERT_DAYS 天内有效），
+-- 管理员直接修改时同样记录并通知（source = admin）
+
+CREATE TABLE IF NOT EXISTS contact_changes (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    channel VARCHAR(10) NOT NULL COMMENT 'email / phone',
+    old_value VARCHAR(255) NULL,
+    new_value VARCHAR(255) NOT NULL,
+    old_verified TINYINT(1) NULL COMMENT '变更前的验证状态，撤销时恢复',
+    source VARCHAR(10) NOT NULL COMMENT 'self / admin',
+    actor_id VARCHAR(36) NULL,
+    status VARCHAR(20) NOT NULL COMMENT 'pending / completed / reverted / cancelled',
+    code_hash VARCHAR(64) NULL,
+    attempts BIGINT NULL DEFAULT 0,
+    expires_at DATETIME(3) NULL,
+    completed_at DATETIME(3) NULL,
+    revert_token_hash VARCHAR(64) NULL,
+    revert_expires_at DATETIME(3) NULL,
+    reverted_at DATETIME(3) NULL,
+    ip_address VARCHAR(45) NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    INDEX idx_contact_changes_user_id (user_id),
+    INDEX idx_contact_changes_status (status),
+    INDEX idx_contact_changes_revert_token_hash (revert_token_hash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='邮箱/手机号变更记录表';
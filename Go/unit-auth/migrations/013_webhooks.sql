@@ -0,0 +1,60 @@
+-- 数据库迁移脚本：用户事件 Webhook
+-- 用户创建 / 更新 / 删除 / 状态变更 / 密码修改 / 会话撤销时写入 webhook_events，
+-- 并为用户已映射项目下匹配的订阅各写入一条 webhook_deliveries（与业务变更同一事务），
+-- 后台 worker 以 HMAC-SHA256 签名 POST 到订阅地址，失败按指数退避重试
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    project_key VARCHAR(64) NOT NULL,
+    url TEXT NOT NULL,
+    events TEXT NULL COMMENT '逗号分隔的事件类型，留空或 * 表示全部',
+    description VARCHAR(255) NULL,
+    enabled TINYINT(1) NULL DEFAULT 1,
+    secret_enc TEXT NOT NULL COMMENT '签名密钥（加密存储）',
+    previous_secret_enc TEXT NULL COMMENT '轮换前的密钥，过期前继续参与签名',
+    previous_secret_expires_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    INDEX idx_webhook_subscriptions_project_key (project_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='Webhook订阅表';
+
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    event_id VARCHAR(64) NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    user_id VARCHAR(36) NULL,
+    actor_id VARCHAR(36) NULL,
+    data JSON NULL,
+    created_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_webhook_events_event_id (event_id),
+    INDEX idx_webhook_events_type (type),
+    INDEX idx_webhook_events_user_id (user_id),
+    INDEX idx_webhook_events_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='Webhook事件表';
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    delivery_id VARCHAR(64) NOT NULL,
+    subscription_id BIGINT UNSIGNED NOT NULL,
+    project_key VARCHAR(64) NULL,
+    event_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload MEDIUMTEXT NULL,
+    status VARCHAR(20) NOT NULL COMMENT 'pending / sending / succeeded / dead',
+    attempts BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME(3) NULL,
+    locked_until DATETIME(3) NULL,
+    response_status BIGINT NULL,
+    response_body VARCHAR(1000) NULL,
+    last_error VARCHAR(500) NULL,
+    duration_ms BIGINT NULL,
+    delivered_at DATETIME(3) NULL,
+    replay_of BIGINT UNSIGNED NULL COMMENT '重放时指向原投递',
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_webhook_deliveries_delivery_id (delivery_id),
+    INDEX idx_webhook_deliveries_subscription_id (subscription_id),
+    INDEX idx_webhook_deliveries_project_key (project_key),
+    INDEX idx_webhook_deliveries_event_id (event_id),
+    INDEX idx_webhook_delivery_due (status, next_attempt_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='Webhook投递记录表';
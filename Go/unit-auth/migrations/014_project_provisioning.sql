@@ -0,0 +1,24 @@
+-- 数据库迁移脚本：项目开通发件箱
+-- 注册、资料修改、删除用户时，对项目的创建 / 更新 / 删除用户调用不再在数据库事务中同步发起，
+-- 而是与业务变更在同一事务写入 project_provisionings，由后台 worker 带 Idempotency-Key 执行并重试；
+-- 同一项目同一用户的任务按 id 顺序执行
+
+CREATE TABLE IF NOT EXISTS project_provisionings (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    idempotency_key VARCHAR(64) NOT NULL,
+    project_key VARCHAR(64) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    operation VARCHAR(10) NOT NULL COMMENT 'create / update / delete',
+    local_user_id VARCHAR(128) NULL COMMENT 'update / delete 的目标；create 成功后回填',
+    status VARCHAR(20) NOT NULL COMMENT 'pending / sending / succeeded / dead / cancelled',
+    attempts BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME(3) NULL,
+    locked_until DATETIME(3) NULL,
+    last_error VARCHAR(500) NULL,
+    completed_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_project_provisionings_idempotency_key (idempotency_key),
+    INDEX idx_provisioning_subject (project_key, user_id),
+    INDEX idx_provisioning_due (status, next_attempt_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='项目开通发件箱表';
@@ -0,0 +1,9 @@
+-- 数据库迁移脚本：项目客户端重试策略与 mTLS
+-- retry_policy: {"max_retries": 2, "backoff_ms": 200, "max_backoff_ms": 3000}，留空使用 PROJECT_CLIENT_* 默认值
+-- auth_mode 新增 hmac / mtls；mtls 使用 client_cert_pem 与 client_key_enc（utils.EncryptString 加密），ca_cert_pem 用于校验项目服务端证书
+
+ALTER TABLE projects
+    ADD COLUMN retry_policy JSON NULL AFTER timeout_ms,
+    ADD COLUMN client_cert_pem TEXT NULL AFTER enabled,
+    ADD COLUMN client_key_enc TEXT NULL AFTER client_cert_pem,
+    ADD COLUMN ca_cert_pem TEXT NULL AFTER client_key_enc;
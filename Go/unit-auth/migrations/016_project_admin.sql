@@ -0,0 +1,8 @@
+-- 数据库迁移脚本：项目管理
+-- allowed_origins: 允许跨域访问的来源（换行分隔），与 CORS_ALLOWED_ORIGINS 合并；均为空时不限制来源
+-- credentials_rotated_at: 最近一次设置 / 轮换凭据的时间
+-- 不再自动创建 nature_trans 项目，已有的项目保留；新项目通过 POST /api/v1/admin/projects 创建
+
+ALTER TABLE projects
+    ADD COLUMN allowed_origins TEXT NULL AFTER allowed_redirect_uris,
+    ADD COLUMN credentials_rotated_at DATETIME(3) NULL AFTER credentials_enc;
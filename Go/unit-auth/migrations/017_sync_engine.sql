@@ -0,0 +1,12 @@
+-- 数据库迁移脚本：数据同步引擎
+-- locked_until: 执行租约，任务执行中为 running，实例异常退出后租约过期可被重新领取
+-- last_error: 最近一次执行失败的原因
+-- 检查点 table_name 为 "源表->目标表"，checkpoint 为 {"updated_at", "key"} 游标；(task_id, table_name) 唯一索引见 002
+
+ALTER TABLE sync_tasks
+    ADD COLUMN locked_until DATETIME(3) NULL AFTER is_active,
+    ADD COLUMN last_error VARCHAR(1000) NULL AFTER locked_until,
+    ADD KEY idx_sync_tasks_next_sync_at (is_active, next_sync_at);
+
+ALTER TABLE sync_conflicts
+    ADD KEY idx_sync_conflicts_record (task_id, table_name, record_id);
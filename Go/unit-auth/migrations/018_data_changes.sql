@@ -0,0 +1,10 @@
+-- 数据库迁移脚本：数据变更捕获
+-- data_changes 由 GORM 回调写入（CDC_TABLES 中的表），user_id 为操作者，系统操作为 NULL
+-- next_retry_at: 下次处理时间，处理中时为租约到期时间；last_error: 最近一次处理失败的原因
+-- sync_status: pending → synced，超过 CDC_MAX_RETRIES 次失败后为 failed
+
+ALTER TABLE data_changes
+    ADD COLUMN next_retry_at DATETIME(3) NULL AFTER last_retry_at,
+    ADD COLUMN last_error VARCHAR(1000) NULL AFTER next_retry_at,
+    ADD KEY idx_data_changes_next_retry_at (next_retry_at),
+    ADD KEY idx_data_changes_record (table_name, record_id, sync_status);
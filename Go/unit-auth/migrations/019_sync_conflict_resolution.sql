@@ -0,0 +1,7 @@
+-- 数据库迁移脚本：同步冲突处理
+-- source_time / target_time: 冲突发生时源与目标记录的 updated_at，用于 last_writer_wins 逐字段比较
+-- resolution: source_wins / target_wins / manual / ignore / last_writer_wins；按任务 config.conflict_strategy 自动处理时 resolved_by 为空
+
+ALTER TABLE sync_conflicts
+    ADD COLUMN source_time DATETIME(3) NULL AFTER notes,
+    ADD COLUMN target_time DATETIME(3) NULL AFTER source_time;
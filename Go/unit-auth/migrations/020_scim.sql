@@ -0,0 +1,41 @@
+-- 数据库迁移脚本：SCIM 2.0 开通接口
+-- scim_tokens: 项目 SCIM 接口的 Bearer 令牌，只保存 SHA-256 摘要
+-- scim_user_links: 通过项目 SCIM 接口开通的用户，项目的 IdP 只能看到自己开通的用户
+-- scim_group_links: 项目 SCIM 接口可见的角色；owned 为该项目创建的角色，成员为 project 等于项目 key 的 user_roles
+
+CREATE TABLE IF NOT EXISTS scim_tokens (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    project_key VARCHAR(64) NOT NULL,
+    name VARCHAR(100) NULL,
+    token_hash VARCHAR(64) NOT NULL COMMENT '令牌 SHA-256 摘要',
+    token_prefix VARCHAR(16) NULL COMMENT '明文前缀，便于识别',
+    created_by VARCHAR(36) NULL,
+    expires_at DATETIME(3) NULL,
+    last_used_at DATETIME(3) NULL,
+    revoked_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_scim_tokens_token_hash (token_hash),
+    INDEX idx_scim_tokens_project_key (project_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='SCIM 令牌表';
+
+CREATE TABLE IF NOT EXISTS scim_user_links (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    project_key VARCHAR(64) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    external_id VARCHAR(255) NULL COMMENT 'IdP 侧的 externalId',
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    UNIQUE INDEX uk_scim_user (project_key, user_id),
+    INDEX idx_scim_user_external (project_key, external_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='SCIM 开通用户表';
+
+CREATE TABLE IF NOT EXISTS scim_group_links (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    project_key VARCHAR(64) NOT NULL,
+    role_id BIGINT UNSIGNED NOT NULL,
+    external_id VARCHAR(255) NULL,
+    owned TINYINT(1) NULL DEFAULT 0 COMMENT '该项目通过 SCIM 创建的角色',
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    UNIQUE INDEX uk_scim_group (project_key, role_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='SCIM 组表';
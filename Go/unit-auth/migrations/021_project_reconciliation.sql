@@ -0,0 +1,50 @@
+-- 数据库迁移脚本：项目映射核对
+-- project_mappings.orphaned_at: 核对时项目侧已找不到该用户，再次核对通过时清除
+-- project_reconciliations: 核对任务，按阶段（verify、remote、backfill）分批执行，cursor 为当前阶段的游标
+-- project_reconciliation_items: 核对报告，每条为一个问题及采取的处理（试运行时 action 为 none）
+
+ALTER TABLE project_mappings ADD COLUMN orphaned_at DATETIME(3) NULL COMMENT '项目侧已不存在的时间';
+
+CREATE TABLE IF NOT EXISTS project_reconciliations (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    project_key VARCHAR(64) NOT NULL,
+    dry_run TINYINT(1) NULL DEFAULT 0,
+    backfill TINYINT(1) NULL DEFAULT 0 COMMENT '为没有映射的用户写入 create 开通任务',
+    batch_size BIGINT NULL,
+    rate_per_second BIGINT NULL,
+    status VARCHAR(20) NOT NULL COMMENT 'pending, running, paused, completed, failed, cancelled',
+    phase VARCHAR(20) NULL COMMENT 'verify, remote, backfill, done',
+    `cursor` VARCHAR(255) NULL,
+    checked BIGINT NULL DEFAULT 0,
+    verified BIGINT NULL DEFAULT 0,
+    local_orphans BIGINT NULL DEFAULT 0,
+    mismatches BIGINT NULL DEFAULT 0,
+    remote_scanned BIGINT NULL DEFAULT 0,
+    remote_orphans BIGINT NULL DEFAULT 0,
+    linked BIGINT NULL DEFAULT 0,
+    missing BIGINT NULL DEFAULT 0,
+    enqueued BIGINT NULL DEFAULT 0,
+    errors BIGINT NULL DEFAULT 0,
+    last_error VARCHAR(1000) NULL,
+    locked_until DATETIME(3) NULL,
+    created_by VARCHAR(36) NULL,
+    started_at DATETIME(3) NULL,
+    finished_at DATETIME(3) NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    INDEX idx_project_reconciliations_project_key (project_key),
+    INDEX idx_project_reconciliations_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='项目映射核对任务表';
+
+CREATE TABLE IF NOT EXISTS project_reconciliation_items (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    run_id BIGINT UNSIGNED NOT NULL,
+    kind VARCHAR(20) NOT NULL COMMENT 'local_orphan, remote_orphan, mismatch, missing, error',
+    user_id VARCHAR(36) NULL,
+    local_user_id VARCHAR(128) NULL,
+    mapping_id BIGINT UNSIGNED NULL,
+    action VARCHAR(20) NULL COMMENT 'none, flagged, linked, enqueued',
+    detail VARCHAR(500) NULL,
+    created_at DATETIME(3) NULL,
+    INDEX idx_reconcile_item_run (run_id, kind)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='项目映射核对报告表';
@@ -0,0 +1,7 @@
+-- 数据库迁移脚本：用户会话吊销
+-- users.tokens_revoked_at: 此时间之前签发的令牌全部失效（联系方式变更被撤销时设置）
+-- users.password_reset_required: 需重置密码后才能使用密码登录，重置或修改密码时清除
+
+ALTER TABLE users
+    ADD COLUMN tokens_revoked_at DATETIME(3) NULL COMMENT '会话吊销时间',
+    ADD COLUMN password_reset_required TINYINT(1) NULL DEFAULT 0 COMMENT '需重置密码';
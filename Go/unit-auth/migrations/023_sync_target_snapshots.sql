@@ -0,0 +1,18 @@
+-- 数据库迁移脚本：同步目标快照
+-- sync_target_snapshots: 同步最近一次写入项目的用户字段（写入后按项目读取的实际值）。
+-- 目标为项目时，项目当前值与快照不一致且与本次要写入的值不同，记为 data_inconsistency 冲突
+-- idx_sync_conflicts_record: 同步时按批读取每条记录最近一次的处理方式（target_wins 的记录跳过）
+
+CREATE TABLE IF NOT EXISTS sync_target_snapshots (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    project_key VARCHAR(64) NOT NULL,
+    table_name VARCHAR(100) NOT NULL,
+    record_id VARCHAR(100) NOT NULL COMMENT 'unit-auth 用户ID',
+    data JSON NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    UNIQUE KEY uk_sync_snapshot_record (project_key, table_name, record_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='同步目标快照表';
+
+-- 按记录查找未解决的冲突、以及每条记录最近一次的处理方式
+CREATE INDEX idx_sync_conflicts_record ON sync_conflicts (task_id, table_name, record_id);
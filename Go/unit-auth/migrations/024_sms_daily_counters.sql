@@ -0,0 +1,11 @@
+-- 数据库迁移脚本：短信每日共享计数
+-- sms_daily_counters: 国家/号段预算、短信费用与费用熔断的当日计数，多实例共享。
+-- 发送前按条件自增（value + n <= 上限），失败即拒绝，计数不会因实例数量成倍放大
+
+CREATE TABLE IF NOT EXISTS sms_daily_counters (
+    day VARCHAR(10) NOT NULL COMMENT '自然日 2006-01-02',
+    counter_key VARCHAR(64) NOT NULL COMMENT 'spend、breaker、country:CN、prefix:+8617',
+    value BIGINT NOT NULL DEFAULT 0 COMMENT 'breaker 为熔断时间（Unix 秒），0 为未熔断',
+    updated_at DATETIME(3) NULL,
+    PRIMARY KEY (day, counter_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='短信每日共享计数表';
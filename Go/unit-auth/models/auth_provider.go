@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// AuthProviderConfig 通用 OIDC/OAuth2 登录提供者配置
+// issuer 非空时优先通过 {issuer}/.well-known/openid-configuration 发现端点，
+// 手动填写的端点会覆盖发现结果（用于 GitHub、飞书等非标准 OIDC 的 OAuth2 服务）
+type AuthProviderConfig struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	Name             string    `json:"name" gorm:"uniqueIndex;size:64;not null"` // 提供者标识，例如 keycloak
+	DisplayName      string    `json:"display_name" gorm:"size:128"`
+	Issuer           string    `json:"issuer" gorm:"size:255"`
+	AuthorizationURL string    `json:"authorization_url" gorm:"size:500"`
+	TokenURL         string    `json:"token_url" gorm:"size:500"`
+	UserInfoURL      string    `json:"userinfo_url" gorm:"size:500"`
+	JWKSURL          string    `json:"jwks_url" gorm:"size:500"`
+	ClientID         string    `json:"client_id" gorm:"size:255;not null"`
+	ClientSecret     string    `json:"-" gorm:"type:text"`
+	RedirectURI      string    `json:"redirect_uri" gorm:"size:500"`
+	Scopes           string    `json:"scopes" gorm:"size:500"`         // 空格分隔，默认 openid email profile
+	ClaimMapping     JSON      `json:"claim_mapping" gorm:"type:json"` // {"email": "email", "nickname": "name", ...}
+	Enabled          bool      `json:"enabled" gorm:"default:true"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// 可映射到用户的字段及其默认声明（OIDC 标准声明）
+var defaultClaimMapping = map[string]string{
+	"subject":        "sub",
+	"email":          "email",
+	"email_verified": "email_verified",
+	"username":       "preferred_username",
+	"nickname":       "name",
+	"avatar":         "picture",
+}
+
+// ClaimMappingFields 支持的声明映射字段
+func ClaimMappingFields() []string {
+	return []string{"subject", "email", "email_verified", "username", "nickname", "avatar"}
+}
+
+// GetClaimMapping 获取声明映射（未配置的字段使用默认值）
+func (pc *AuthProviderConfig) GetClaimMapping() map[string]string {
+	mapping := make(map[string]string, len(defaultClaimMapping))
+	for k, v := range defaultClaimMapping {
+		mapping[k] = v
+	}
+	if len(pc.ClaimMapping) == 0 {
+		return mapping
+	}
+	var custom map[string]string
+	if err := json.Unmarshal(pc.ClaimMapping, &custom); err != nil {
+		return mapping
+	}
+	for k, v := range custom {
+		if strings.TrimSpace(v) != "" {
+			mapping[k] = v
+		}
+	}
+	return mapping
+}
+
+// SetClaimMapping 设置声明映射
+func (pc *AuthProviderConfig) SetClaimMapping(mapping map[string]string) error {
+	if len(mapping) == 0 {
+		pc.ClaimMapping = nil
+		return nil
+	}
+	data, err := json.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+	pc.ClaimMapping = JSON(data)
+	return nil
+}
+
+// GetScopes 获取授权范围
+func (pc *AuthProviderConfig) GetScopes() []string {
+	scopes := strings.Fields(strings.ReplaceAll(pc.Scopes, ",", " "))
+	if len(scopes) == 0 {
+		return []string{"openid", "email", "profile"}
+	}
+	return scopes
+}
+
+// ToResponse 转换为响应格式（不返回密钥）
+func (pc *AuthProviderConfig) ToResponse() AuthProviderConfigResponse {
+	return AuthProviderConfigResponse{
+		AuthProviderConfig:    *pc,
+		EffectiveClaimMapping: pc.GetClaimMapping(),
+		HasClientSecret:       pc.ClientSecret != "",
+	}
+}
+
+// AuthProviderConfigResponse 提供者配置响应
+type AuthProviderConfigResponse struct {
+	AuthProviderConfig
+	EffectiveClaimMapping map[string]string `json:"effective_claim_mapping"`
+	HasClientSecret       bool              `json:"has_client_secret"`
+}
+
+// AuthProviderConfigRequest 创建/更新提供者配置请求
+type AuthProviderConfigRequest struct {
+	Name             string            `json:"name" binding:"omitempty,min=2,max=64"`
+	DisplayName      string            `json:"display_name"`
+	Issuer           string            `json:"issuer" binding:"omitempty,url"`
+	AuthorizationURL string            `json:"authorization_url" binding:"omitempty,url"`
+	TokenURL         string            `json:"token_url" binding:"omitempty,url"`
+	UserInfoURL      string            `json:"userinfo_url" binding:"omitempty,url"`
+	JWKSURL          string            `json:"jwks_url" binding:"omitempty,url"`
+	ClientID         string            `json:"client_id"`
+	ClientSecret     string            `json:"client_secret"`
+	RedirectURI      string            `json:"redirect_uri" binding:"omitempty,url"`
+	Scopes           string            `json:"scopes"`
+	ClaimMapping     map[string]string `json:"claim_mapping"`
+	Enabled          *bool             `json:"enabled"`
+}
@@ -0,0 +1,419 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 数据变更类型
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// 数据变更处理状态
+const (
+	ChangeSyncPending = "pending"
+	ChangeSyncSynced  = "synced"
+	ChangeSyncFailed  = "failed"
+)
+
+type actorContextKey struct{}
+
+// ContextWithActor 在 context 中记录操作者ID；经 WithContext 传入 GORM 后写入 data_changes.user_id
+func ContextWithActor(ctx context.Context, actorID string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actorID)
+}
+
+// ActorFromContext 读取 context 中的操作者ID
+func ActorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actorID, _ := ctx.Value(actorContextKey{}).(string)
+	return actorID
+}
+
+// WithActor 返回带操作者的会话，之后（包括其上开启的事务中）的写操作记录该操作者
+func WithActor(db *gorm.DB, actorID string) *gorm.DB {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return db.WithContext(ContextWithActor(ctx, actorID))
+}
+
+// changeCaptureSpec 表的变更捕获选项
+type changeCaptureSpec struct {
+	project string   // 项目列，写入 data_changes.project
+	redact  []string // 快照中以 [REDACTED] 代替的列（变化仍会记录）
+	ignore  []string // 只有这些列（及 updated_at）变化时不记录
+}
+
+var changeCaptureSpecs = map[string]changeCaptureSpec{
+	"users":            {redact: []string{"password"}, ignore: []string{"login_count", "last_login_at", "last_login_ip", "last_login_user_agent"}},
+	"project_mappings": {project: "project_name"},
+	"user_roles":       {project: "project"},
+}
+
+const (
+	changeCaptureMaxRows  = 1000 // 单条语句最多捕获的行数，超出部分不记录
+	changeCaptureRedacted = "[REDACTED]"
+	changeCaptureBefore   = "cdc:before"
+)
+
+type changeCapture struct {
+	tables map[string]bool
+}
+
+// RegisterChangeCapture 为指定的表注册 GORM 回调：create、update、delete 成功后把行快照写入 data_changes
+// （新增与删除记录整行，更新只记录变化的列），与业务写入在同一事务中。Exec / Raw 执行的原生 SQL 不会被捕获。
+// After 回调默认排在 gorm:commit_or_rollback_transaction 之后，需显式排在提交之前
+func RegisterChangeCapture(db *gorm.DB, tables ...string) error {
+	cc := &changeCapture{tables: map[string]bool{}}
+	for _, t := range tables {
+		if t = strings.TrimSpace(t); t != "" && t != "data_changes" {
+			cc.tables[t] = true
+		}
+	}
+	if len(cc.tables) == 0 {
+		return nil
+	}
+
+	if err := db.Callback().Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("cdc:after_create", cc.afterCreate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("cdc:before_update", cc.before); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("cdc:after_update", cc.afterUpdate); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("cdc:before_delete", cc.before); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("cdc:after_delete", cc.afterDelete)
+}
+
+func (cc *changeCapture) table(tx *gorm.DB) (string, bool) {
+	table := tx.Statement.Table
+	if table == "" && tx.Statement.Schema != nil {
+		table = tx.Statement.Schema.Table
+	}
+	return table, cc.tables[table]
+}
+
+func (cc *changeCapture) keyColumn(stmt *gorm.Statement) string {
+	if stmt.Schema != nil && stmt.Schema.PrioritizedPrimaryField != nil {
+		return stmt.Schema.PrioritizedPrimaryField.DBName
+	}
+	return "id"
+}
+
+// before 更新、删除前读取受影响行的快照
+func (cc *changeCapture) before(tx *gorm.DB) {
+	if tx.Error != nil {
+		return
+	}
+	table, ok := cc.table(tx)
+	if !ok || onlyIgnoredColumns(tx.Statement, changeCaptureSpecs[table]) {
+		return
+	}
+	rows, err := cc.snapshot(tx, table)
+	if err != nil {
+		log.Printf("Warning: failed to capture %s rows before change: %v", table, err)
+		return
+	}
+	if len(rows) > 0 {
+		tx.InstanceSet(changeCaptureBefore, rows)
+	}
+}
+
+// snapshot 按语句的 WHERE 条件与模型主键读取受影响的行
+func (cc *changeCapture) snapshot(tx *gorm.DB, table string) ([]map[string]interface{}, error) {
+	query := cc.session(tx).Table(table)
+	conditioned := false
+	if c, ok := tx.Statement.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			query = query.Clauses(clause.Where{Exprs: where.Exprs})
+			conditioned = true
+		}
+	}
+	if keys := modelKeys(tx.Statement); len(keys) > 0 {
+		query = query.Where(cc.keyColumn(tx.Statement)+" IN ?", keys)
+		conditioned = true
+	}
+	// 没有条件的语句会被 GORM 拒绝（除非显式允许全表操作）
+	if !conditioned && !tx.Statement.AllowGlobalUpdate {
+		return nil, nil
+	}
+	return cc.load(tx, query, table)
+}
+
+func (cc *changeCapture) load(tx *gorm.DB, query *gorm.DB, table string) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	if err := query.Limit(changeCaptureMaxRows + 1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) > changeCaptureMaxRows {
+		log.Printf("Warning: change capture on %s limited to %d rows", table, changeCaptureMaxRows)
+		rows = rows[:changeCaptureMaxRows]
+	}
+	for _, row := range rows {
+		normalizeChangeRow(tx.Statement, row)
+	}
+	return rows, nil
+}
+
+func (cc *changeCapture) reload(tx *gorm.DB, table string, keys []interface{}) ([]map[string]interface{}, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return cc.load(tx, cc.session(tx).Table(table).Where(cc.keyColumn(tx.Statement)+" IN ?", keys), table)
+}
+
+// session 与业务语句共用连接（事务），不触发模型钩子
+func (cc *changeCapture) session(tx *gorm.DB) *gorm.DB {
+	return tx.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+}
+
+func (cc *changeCapture) afterCreate(tx *gorm.DB) {
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return
+	}
+	table, ok := cc.table(tx)
+	if !ok {
+		return
+	}
+	rows, err := cc.reload(tx, table, modelKeys(tx.Statement))
+	if err != nil {
+		log.Printf("Warning: failed to capture inserted %s rows: %v", table, err)
+		return
+	}
+	changes := make([]DataChange, 0, len(rows))
+	for _, row := range rows {
+		changes = append(changes, cc.change(tx.Statement, table, ChangeInsert, row, nil, row))
+	}
+	cc.record(tx, table, changes)
+}
+
+func (cc *changeCapture) afterUpdate(tx *gorm.DB) {
+	before, ok := tx.InstanceGet(changeCaptureBefore)
+	if !ok || tx.Error != nil || tx.RowsAffected == 0 {
+		return
+	}
+	table, _ := cc.table(tx)
+	oldRows := before.([]map[string]interface{})
+	key := cc.keyColumn(tx.Statement)
+	keys := make([]interface{}, 0, len(oldRows))
+	for _, row := range oldRows {
+		keys = append(keys, row[key])
+	}
+	newRows, err := cc.reload(tx, table, keys)
+	if err != nil {
+		log.Printf("Warning: failed to capture updated %s rows: %v", table, err)
+		return
+	}
+	byKey := make(map[string]map[string]interface{}, len(newRows))
+	for _, row := range newRows {
+		byKey[fmt.Sprint(row[key])] = row
+	}
+
+	spec := changeCaptureSpecs[table]
+	changes := make([]DataChange, 0, len(oldRows))
+	for _, oldRow := range oldRows {
+		newRow, ok := byKey[fmt.Sprint(oldRow[key])]
+		if !ok {
+			continue
+		}
+		oldDiff, newDiff := map[string]interface{}{}, map[string]interface{}{}
+		significant := false
+		for column, value := range newRow {
+			if changeValuesEqual(oldRow[column], value) {
+				continue
+			}
+			oldDiff[column], newDiff[column] = oldRow[column], value
+			if column != "updated_at" && !containsString(spec.ignore, column) {
+				significant = true
+			}
+		}
+		if !significant {
+			continue
+		}
+		changes = append(changes, cc.change(tx.Statement, table, ChangeUpdate, newRow, oldDiff, newDiff))
+	}
+	cc.record(tx, table, changes)
+}
+
+func (cc *changeCapture) afterDelete(tx *gorm.DB) {
+	before, ok := tx.InstanceGet(changeCaptureBefore)
+	if !ok || tx.Error != nil || tx.RowsAffected == 0 {
+		return
+	}
+	table, _ := cc.table(tx)
+	oldRows := before.([]map[string]interface{})
+	// 软删除只影响尚未删除的行
+	if tx.Statement.Schema != nil && tx.Statement.Schema.LookUpField("deleted_at") != nil && !tx.Statement.Unscoped {
+		alive := oldRows[:0]
+		for _, row := range oldRows {
+			if row["deleted_at"] == nil {
+				alive = append(alive, row)
+			}
+		}
+		oldRows = alive
+	}
+	changes := make([]DataChange, 0, len(oldRows))
+	for _, row := range oldRows {
+		changes = append(changes, cc.change(tx.Statement, table, ChangeDelete, row, row, nil))
+	}
+	cc.record(tx, table, changes)
+}
+
+func (cc *changeCapture) change(stmt *gorm.Statement, table, changeType string, row, oldData, newData map[string]interface{}) DataChange {
+	spec := changeCaptureSpecs[table]
+	change := DataChange{
+		TableName:  table,
+		RecordID:   fmt.Sprint(row[cc.keyColumn(stmt)]),
+		ChangeType: changeType,
+		UserID:     ActorFromContext(stmt.Context),
+		SyncStatus: ChangeSyncPending,
+	}
+	if spec.project != "" {
+		if project, ok := row[spec.project].(string); ok && len(project) <= 50 {
+			change.Project = project
+		}
+	}
+	if oldData != nil {
+		_ = change.SetOldData(redactChangeRow(spec, oldData))
+	}
+	if newData != nil {
+		_ = change.SetNewData(redactChangeRow(spec, newData))
+	}
+	return change
+}
+
+// record 写入变更记录；失败只记录日志，不影响业务写入
+func (cc *changeCapture) record(tx *gorm.DB, table string, changes []DataChange) {
+	if len(changes) == 0 {
+		return
+	}
+	query := cc.session(tx).Omit(clause.Associations)
+	// 没有操作者（系统任务、注册等）时 user_id 为 NULL
+	if ActorFromContext(tx.Statement.Context) == "" {
+		query = query.Omit("UserID", clause.Associations)
+	}
+	if err := query.Create(&changes).Error; err != nil {
+		log.Printf("Warning: failed to record %d data changes for %s: %v", len(changes), table, err)
+	}
+}
+
+// modelKeys 语句模型（结构体或切片）中非零的主键值
+func modelKeys(stmt *gorm.Statement) []interface{} {
+	if stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil || !stmt.ReflectValue.IsValid() {
+		return nil
+	}
+	field := stmt.Schema.PrioritizedPrimaryField
+	ctx := stmt.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var keys []interface{}
+	add := func(v reflect.Value) {
+		v = reflect.Indirect(v)
+		if v.Kind() != reflect.Struct || v.Type() != stmt.Schema.ModelType {
+			return
+		}
+		if value, zero := field.ValueOf(ctx, v); !zero {
+			keys = append(keys, value)
+		}
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			add(stmt.ReflectValue.Index(i))
+		}
+	default:
+		add(stmt.ReflectValue)
+	}
+	return keys
+}
+
+// onlyIgnoredColumns 以 map 更新且只涉及忽略的列（如登录时间）时跳过捕获，避免额外查询
+func onlyIgnoredColumns(stmt *gorm.Statement, spec changeCaptureSpec) bool {
+	updates, ok := stmt.Dest.(map[string]interface{})
+	if !ok || len(updates) == 0 {
+		return false
+	}
+	for name := range updates {
+		column := name
+		if stmt.Schema != nil {
+			if field := stmt.Schema.LookUpField(name); field != nil {
+				column = field.DBName
+			}
+		}
+		if column != "updated_at" && !containsString(spec.ignore, column) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeChangeRow 驱动返回的 []byte 转为字符串，JSON 列保留为 JSON
+func normalizeChangeRow(stmt *gorm.Statement, row map[string]interface{}) {
+	for column, value := range row {
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		if s, ok := value.(string); ok && stmt.Schema != nil {
+			if field := stmt.Schema.LookUpField(column); field != nil && strings.EqualFold(string(field.DataType), "json") && json.Valid([]byte(s)) {
+				value = json.RawMessage(s)
+			}
+		}
+		row[column] = value
+	}
+}
+
+func redactChangeRow(spec changeCaptureSpec, row map[string]interface{}) map[string]interface{} {
+	if len(spec.redact) == 0 {
+		return row
+	}
+	out := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		if value != nil && containsString(spec.redact, column) {
+			value = changeCaptureRedacted
+		}
+		out[column] = value
+	}
+	return out
+}
+
+func changeValuesEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case time.Time:
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	case json.RawMessage:
+		y, ok := b.(json.RawMessage)
+		return ok && bytes.Equal(x, y)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -3,7 +3,9 @@ package models
 import (
 	"fmt"
 	"log"
+	"strings"
 	"unit-auth/config"
+	"unit-auth/utils"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -31,19 +33,37 @@ func InitDB() (*gorm.DB, error) {
 	// 自动迁移数据库表 - 包含所有扩展功能
 	err = db.AutoMigrate(
 		// 核心用户表
-		&User{},              // 核心用户表
-		&EmailVerification{}, // 邮箱验证表
-		&PasswordReset{},     // 密码重置表
-		&SMSVerification{},   // 短信验证表
-		&UserStats{},         // 用户统计表
-		&LoginLog{},          // 登录日志表
-		&WeChatQRSession{},   // 微信二维码会话表
+		&User{},                 // 核心用户表
+		&EmailVerification{},    // 邮箱验证表
+		&PasswordReset{},        // 密码重置表
+		&SMSVerification{},      // 短信验证表
+		&SMSDelivery{},          // 短信投递记录表
+		&SMSDailyCounter{},      // 短信每日共享计数表
+		&EmailOutbox{},          // 邮件发件箱表
+		&EmailUnsubscribe{},     // 邮件退订表
+		&ContactChange{},        // 邮箱/手机号变更记录表
+		&WebhookSubscription{},  // Webhook订阅表
+		&WebhookEvent{},         // Webhook事件表
+		&WebhookDelivery{},      // Webhook投递记录表
+		&ProjectProvisioning{},  // 项目开通发件箱表
+		&UserStats{},            // 用户统计表
+		&LoginLog{},             // 登录日志表
+		&WeChatQRSession{},      // 微信二维码会话表
+		&OAuthTransaction{},     // OAuth授权事务表
+		&ImpersonationSession{}, // 模拟登录会话表
 
 		// 中心化用户管理
-		&Project{},         // 第三方项目表
-		&ProjectMapping{},  // 项目映射表
-		&GlobalUserStats{}, // 全局用户统计表
-		&AuthLog{},         // 认证日志表
+		&Project{},                   // 第三方项目表
+		&ProjectMapping{},            // 项目映射表
+		&UserIdentity{},              // 第三方身份绑定表
+		&AuthProviderConfig{},        // 第三方登录提供者配置表
+		&GlobalUserStats{},           // 全局用户统计表
+		&AuthLog{},                   // 认证日志表
+		&ScimToken{},                 // 项目 SCIM 令牌表
+		&ScimUserLink{},              // SCIM 开通用户表
+		&ScimGroupLink{},             // SCIM 组（角色）表
+		&ProjectReconciliation{},     // 项目映射核对任务表
+		&ProjectReconciliationItem{}, // 项目映射核对报告表
 
 		// 用户画像系统
 		&UserProfile{},        // 用户画像表
@@ -63,12 +83,13 @@ func InitDB() (*gorm.DB, error) {
 		&AuditLog{},            // 审计日志表
 
 		// 数据同步机制
-		&SyncTask{},       // 同步任务表
-		&SyncLog{},        // 同步日志表
-		&DataChange{},     // 数据变更记录表
-		&SyncMapping{},    // 同步映射表
-		&SyncConflict{},   // 同步冲突表
-		&SyncCheckpoint{}, // 同步检查点表
+		&SyncTask{},           // 同步任务表
+		&SyncLog{},            // 同步日志表
+		&DataChange{},         // 数据变更记录表
+		&SyncMapping{},        // 同步映射表
+		&SyncConflict{},       // 同步冲突表
+		&SyncCheckpoint{},     // 同步检查点表
+		&SyncTargetSnapshot{}, // 同步写入项目的用户快照
 
 		// 监控告警系统
 		&Metric{},               // 指标表
@@ -84,13 +105,20 @@ func InitDB() (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to migrate database: %v", err)
 	}
 
-	// 默认种子：nature_trans 项目（若不存在）
-	var cnt int64
-	db.Model(&Project{}).Where("`key` = ?", "nature_trans").Count(&cnt)
-	if cnt == 0 {
-		seed := Project{Key: "nature_trans", Name: "Nature Translate", BaseURL: "http://localhost:9001", AuthMode: "none", CredentialsEnc: "", Enabled: true}
-		if err := db.Create(&seed).Error; err != nil {
-			log.Printf("Warning: failed to seed default project: %v", err)
+	// 旧版第三方ID字段迁移至身份绑定表
+	if err := migrateLegacyIdentities(db); err != nil {
+		log.Printf("Warning: failed to migrate legacy identities: %v", err)
+	}
+	if err := backfillIdentityUnionIDs(db); err != nil {
+		log.Printf("Warning: failed to backfill wechat union ids: %v", err)
+	}
+	if err := normalizeUserPhones(db); err != nil {
+		log.Printf("Warning: failed to normalize user phones: %v", err)
+	}
+	// 通知模板改为按项目与语言覆盖，名称不再唯一
+	if db.Migrator().HasIndex(&NotificationTemplate{}, "idx_notification_templates_name") {
+		if err := db.Migrator().DropIndex(&NotificationTemplate{}, "idx_notification_templates_name"); err != nil {
+			log.Printf("Warning: failed to drop notification template name index: %v", err)
 		}
 	}
 
@@ -118,11 +146,87 @@ func InitDB() (*gorm.DB, error) {
 		log.Printf("Warning: failed to create monitoring stats view: %v", err)
 	}
 
+	// 变更捕获：迁移与数据修正完成后再注册，启动时的批量修正不写入 data_changes
+	if err := RegisterChangeCapture(db, strings.Split(config.AppConfig.CDCTables, ",")...); err != nil {
+		log.Printf("Warning: failed to register change capture callbacks: %v", err)
+	}
+
 	DB = db
 	log.Println("Database connected and migrated successfully")
 	return db, nil
 }
 
+// migrateLegacyIdentities 将 users 表上的 google/github/wechat ID 写入 user_identities（幂等）
+func migrateLegacyIdentities(db *gorm.DB) error {
+	legacy := []struct {
+		provider string
+		field    string
+	}{
+		{"google", "GoogleID"},
+		{"github", "GitHubID"},
+		{"wechat", "WeChatID"},
+	}
+	for _, l := range legacy {
+		if !db.Migrator().HasColumn(&User{}, l.field) {
+			continue
+		}
+		column := db.NamingStrategy.ColumnName("", l.field)
+		// google 历史上以邮箱匹配并记录了 verified_email，沿用用户表的验证状态
+		emailVerified := "FALSE"
+		if l.provider == "google" {
+			emailVerified = "u.email_verified"
+		}
+		sql := fmt.Sprintf(`
+		INSERT IGNORE INTO user_identities (user_id, provider, subject, email, email_verified, created_at, updated_at)
+		SELECT u.id, ?, u.%[1]s, COALESCE(u.email, ''), %[2]s, NOW(), NOW()
+		FROM users u
+		WHERE u.%[1]s IS NOT NULL AND u.%[1]s != '' AND u.deleted_at IS NULL`, column, emailVerified)
+		if err := db.Exec(sql, l.provider).Error; err != nil {
+			return fmt.Errorf("%s: %v", l.provider, err)
+		}
+	}
+	return nil
+}
+
+// backfillIdentityUnionIDs 从已保存的微信原始资料中补全 union_id（幂等）
+func backfillIdentityUnionIDs(db *gorm.DB) error {
+	return db.Exec(`
+	UPDATE user_identities
+	SET union_id = JSON_UNQUOTE(JSON_EXTRACT(raw_profile, '$.unionid'))
+	WHERE provider LIKE 'wechat%'
+	  AND (union_id IS NULL OR union_id = '')
+	  AND JSON_UNQUOTE(JSON_EXTRACT(raw_profile, '$.unionid')) != ''`).Error
+}
+
+// normalizeUserPhones 将历史手机号规范化为 E.164（幂等）；
+// 规范化后与其他用户冲突或无法解析的号码保持原样并记录日志，需人工处理
+func normalizeUserPhones(db *gorm.DB) error {
+	var users []User
+	if err := db.Select("id", "phone").
+		Where("phone IS NOT NULL AND phone != '' AND phone NOT REGEXP '^[+][1-9][0-9]{6,14}$'").
+		Find(&users).Error; err != nil {
+		return err
+	}
+	region := utils.DefaultPhoneRegion()
+	for _, u := range users {
+		phone, err := utils.NormalizePhone(*u.Phone, region)
+		if err != nil {
+			log.Printf("Warning: user %s has unparseable phone %q, left unchanged", u.ID, *u.Phone)
+			continue
+		}
+		var cnt int64
+		db.Model(&User{}).Where("phone = ? AND id != ?", phone, u.ID).Count(&cnt)
+		if cnt > 0 {
+			log.Printf("Warning: user %s phone %q normalizes to %s which belongs to another user, left unchanged", u.ID, *u.Phone, phone)
+			continue
+		}
+		if err := db.Model(&User{}).Where("id = ?", u.ID).Update("phone", phone).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // 创建跨项目统计视图
 func createCrossProjectStatsView(db *gorm.DB) error {
 	viewSQL := `
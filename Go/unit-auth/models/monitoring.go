@@ -95,14 +95,19 @@ type Notification struct {
 }
 
 // NotificationTemplate 通知模板表
+// 邮件模板以 TemplateKey（如 welcome）标识，按 ProjectKey、Locale 覆盖内置模板，留空表示对所有项目/语言生效
 type NotificationTemplate struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name" gorm:"not null;size:100;uniqueIndex"`
+	Name        string    `json:"name" gorm:"not null;size:100"`
 	Description string    `json:"description" gorm:"size:500"`
-	Type        string    `json:"type" gorm:"not null;size:20"` // email, sms, webhook, slack
+	Type        string    `json:"type" gorm:"not null;size:20;index:idx_notification_template_scope"` // email, sms, webhook, slack
+	TemplateKey string    `json:"template_key" gorm:"size:64;index:idx_notification_template_scope"`
+	ProjectKey  string    `json:"project_key" gorm:"size:64;index:idx_notification_template_scope"`
+	Locale      string    `json:"locale" gorm:"size:16;index:idx_notification_template_scope"`
 	Subject     string    `json:"subject" gorm:"size:200"`
-	Content     string    `json:"content" gorm:"type:text"`
-	Variables   JSON      `json:"variables" gorm:"type:json"` // 模板变量
+	Content     string    `json:"content" gorm:"type:text"`      // 邮件为 HTML 正文（套用统一布局），留空使用内置模板
+	TextContent string    `json:"text_content" gorm:"type:text"` // 纯文本正文，留空时由 HTML 正文生成
+	Variables   JSON      `json:"variables" gorm:"type:json"`    // 模板变量
 	IsActive    bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -198,6 +203,38 @@ type CreateNotificationTemplateRequest struct {
 	Variables   map[string]interface{} `json:"variables,omitempty"`
 }
 
+// EmailTemplateOverrideRequest 创建/更新邮件模板覆盖请求（template_key 为内置模板 Key，project_key、locale 留空表示不限）
+type EmailTemplateOverrideRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	TemplateKey string `json:"template_key" binding:"required"`
+	ProjectKey  string `json:"project_key"`
+	Locale      string `json:"locale"`
+	Subject     string `json:"subject"`
+	Content     string `json:"content"`
+	TextContent string `json:"text_content"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+// EmailTemplatePreviewRequest 邮件模板预览请求；subject/content/text_content 任一非空时预览草稿
+type EmailTemplatePreviewRequest struct {
+	TemplateKey string                 `json:"template_key" binding:"required"`
+	ProjectKey  string                 `json:"project_key"`
+	Locale      string                 `json:"locale"`
+	Subject     string                 `json:"subject"`
+	Content     string                 `json:"content"`
+	TextContent string                 `json:"text_content"`
+	Variables   map[string]interface{} `json:"variables"`
+}
+
+// ProjectEmailBrandingRequest 项目邮件品牌请求（留空表示使用全局配置）
+type ProjectEmailBrandingRequest struct {
+	BrandName  string `json:"brand_name" binding:"max=128"`
+	SenderName string `json:"sender_name" binding:"max=128"`
+	BrandColor string `json:"brand_color"`
+	LogoURL    string `json:"logo_url" binding:"omitempty,url"`
+}
+
 // MetricResponse 指标响应
 type MetricResponse struct {
 	ID          uint              `json:"id"`
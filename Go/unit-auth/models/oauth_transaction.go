@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// OAuth 事务用途
+const (
+	OAuthPurposeLogin = "login" // 第三方登录
+	OAuthPurposeLink  = "link"  // 已登录用户绑定第三方账号
+)
+
+// OAuthTransaction 服务端 OAuth 授权事务：state 由服务端生成，绑定浏览器与项目，一次性使用
+type OAuthTransaction struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	State       string `json:"state" gorm:"size:64;uniqueIndex;not null"`
+	Provider    string `json:"provider" gorm:"size:64;not null"`
+	Purpose     string `json:"purpose" gorm:"size:16;not null;default:'login'"`
+	ProjectKey  string `json:"project_key" gorm:"size:64"`
+	UserID      string `json:"user_id" gorm:"size:36"` // 绑定流程的发起用户
+	BindingHash string `json:"-" gorm:"size:64;not null"`
+	RedirectURI string `json:"redirect_uri" gorm:"type:text"`
+
+	// PKCE code_verifier（加密存储）与 OIDC nonce
+	CodeVerifierEnc string `json:"-" gorm:"type:text"`
+	Nonce           string `json:"-" gorm:"size:64"`
+
+	IP        string     `json:"ip" gorm:"size:45"`
+	UserAgent string     `json:"user_agent" gorm:"size:500"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// CodeVerifier 解密后的 code_verifier（不落库）
+	CodeVerifier string `json:"-" gorm:"-"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -119,12 +120,18 @@ type AuditLog struct {
 	UserAgent  string    `json:"user_agent" gorm:"size:500"`
 	Status     string    `json:"status" gorm:"size:20"` // success, failed, denied
 	ErrorMsg   string    `json:"error_msg" gorm:"size:500"`
+	RequestID  string    `json:"request_id" gorm:"size:64;index"`
+	PrevHash   string    `json:"prev_hash" gorm:"size:64"`  // 上一条记录的哈希（哈希链）
+	Hash       string    `json:"hash" gorm:"size:64;index"` // 本条记录的哈希
 	CreatedAt  time.Time `json:"created_at"`
 
 	// 关联
 	User User `json:"user" gorm:"foreignKey:UserID"`
 }
 
+// ErrAuditLogImmutable 审计日志只允许追加
+var ErrAuditLogImmutable = errors.New("audit logs are append-only")
+
 // 请求和响应结构体
 
 // CreateRoleRequest 创建角色请求
@@ -212,16 +219,21 @@ type UserPermissionResponse struct {
 
 // AuditLogResponse 审计日志响应
 type AuditLogResponse struct {
-	ID         uint      `json:"id"`
-	UserID     string    `json:"user_id"`
-	Username   string    `json:"username"`
-	Action     string    `json:"action"`
-	Resource   string    `json:"resource"`
-	ResourceID string    `json:"resource_id"`
-	Project    string    `json:"project"`
-	Status     string    `json:"status"`
-	IPAddress  string    `json:"ip_address"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         uint                   `json:"id"`
+	UserID     string                 `json:"user_id"`
+	Username   string                 `json:"username"`
+	Action     string                 `json:"action"`
+	Resource   string                 `json:"resource"`
+	ResourceID string                 `json:"resource_id"`
+	Project    string                 `json:"project"`
+	Status     string                 `json:"status"`
+	ErrorMsg   string                 `json:"error_msg,omitempty"`
+	IPAddress  string                 `json:"ip_address"`
+	UserAgent  string                 `json:"user_agent,omitempty"`
+	RequestID  string                 `json:"request_id"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Hash       string                 `json:"hash"`
+	CreatedAt  time.Time              `json:"created_at"`
 }
 
 // 方法实现
@@ -284,6 +296,38 @@ func (al *AuditLog) SetDetails(details map[string]interface{}) error {
 	return nil
 }
 
+// BeforeUpdate 禁止修改审计日志
+func (al *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// BeforeDelete 禁止删除审计日志
+func (al *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// ToResponse 转换为响应格式
+func (al *AuditLog) ToResponse() AuditLogResponse {
+	details, _ := al.GetDetails()
+	return AuditLogResponse{
+		ID:         al.ID,
+		UserID:     al.UserID,
+		Username:   al.User.Username,
+		Action:     al.Action,
+		Resource:   al.Resource,
+		ResourceID: al.ResourceID,
+		Project:    al.Project,
+		Status:     al.Status,
+		ErrorMsg:   al.ErrorMsg,
+		IPAddress:  al.IPAddress,
+		UserAgent:  al.UserAgent,
+		RequestID:  al.RequestID,
+		Details:    details,
+		Hash:       al.Hash,
+		CreatedAt:  al.CreatedAt,
+	}
+}
+
 // HasPermission 检查用户是否有指定权限
 func (u *User) HasPermission(db *gorm.DB, resource, action, project string) (bool, error) {
 	// 检查用户角色权限
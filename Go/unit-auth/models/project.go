@@ -1,27 +1,207 @@
 package models
 
 import (
+	"encoding/json"
+	"net/url"
+	"strings"
 	"time"
+	"unit-auth/config"
+)
+
+// 项目调用认证方式
+const (
+	ProjectAuthNone   = "none"
+	ProjectAuthAPIKey = "api_key" // X-Project-Token: <credentials>
+	ProjectAuthBearer = "bearer"  // Authorization: Bearer <credentials>
+	ProjectAuthHMAC   = "hmac"    // 以 credentials 为密钥对请求签名
+	ProjectAuthMTLS   = "mtls"    // 客户端证书（client_cert_pem / client_key_enc）
 )
 
 // Project 第三方项目配置
-// credentials_enc 建议加密存储，当前作为占位字段
-// auth_mode: api_key | bearer | none
+// credentials_enc: api_key / bearer 的令牌或 hmac 的密钥，支持 utils.EncryptString 加密存储（兼容明文）
+// auth_mode: none | api_key | bearer | hmac | mtls
 // base_url: 例如 http://localhost:9001
 // key: 例如 nature_trans
 // name: 展示名称
 // enabled: 开关
-// timeout_ms / retry_policy: 可扩展
+// timeout_ms: 单次请求超时；retry_policy: 重试策略（JSON，留空使用 PROJECT_CLIENT_* 默认值）
 
 type Project struct {
-	ID             uint      `json:"id" gorm:"primaryKey"`
-	Key            string    `json:"key" gorm:"uniqueIndex;size:64;not null"`
-	Name           string    `json:"name" gorm:"size:128;not null"`
-	BaseURL        string    `json:"base_url" gorm:"type:text;not null"`
-	AuthMode       string    `json:"auth_mode" gorm:"size:32;not null;default:api_key"`
-	CredentialsEnc string    `json:"credentials_enc" gorm:"type:text;not null"`
-	TimeoutMS      int       `json:"timeout_ms" gorm:"default:5000"`
-	Enabled        bool      `json:"enabled" gorm:"default:true"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	Key            string `json:"key" gorm:"uniqueIndex;size:64;not null"`
+	Name           string `json:"name" gorm:"size:128;not null"`
+	BaseURL        string `json:"base_url" gorm:"type:text;not null"`
+	AuthMode       string `json:"auth_mode" gorm:"size:32;not null;default:api_key"`
+	CredentialsEnc string `json:"-" gorm:"type:text;not null"`
+	// 最近一次设置 / 轮换凭据的时间
+	CredentialsRotatedAt *time.Time `json:"credentials_rotated_at,omitempty"`
+	TimeoutMS            int        `json:"timeout_ms" gorm:"default:5000"`
+	RetryPolicy          JSON       `json:"retry_policy,omitempty" gorm:"type:json"`
+	Enabled              bool       `json:"enabled" gorm:"default:true"`
+	// mTLS：客户端证书（PEM）、私钥（加密存储）与校验项目服务端证书的 CA（留空使用系统根证书）
+	ClientCertPEM string `json:"client_cert_pem,omitempty" gorm:"type:text"`
+	ClientKeyEnc  string `json:"-" gorm:"type:text"`
+	CACertPEM     string `json:"ca_cert_pem,omitempty" gorm:"type:text"`
+	// 登录完成后允许跳转的地址（逗号或换行分隔）；以 /* 结尾表示该路径前缀下均允许
+	AllowedRedirectURIs string `json:"allowed_redirect_uris" gorm:"type:text"`
+	// 允许跨域访问的来源（scheme://host[:port]，逗号或换行分隔）；所有项目都未配置时不限制来源
+	AllowedOrigins string `json:"allowed_origins" gorm:"type:text"`
+	// 不带区号的手机号按该国家/地区解析（ISO 3166-1 二位代码），留空使用 PHONE_DEFAULT_REGION
+	DefaultPhoneRegion string `json:"default_phone_region" gorm:"size:2"`
+	// 邮件品牌（留空使用 MAIL_* 全局配置）
+	EmailBrandName  string    `json:"email_brand_name" gorm:"size:128"`
+	EmailSenderName string    `json:"email_sender_name" gorm:"size:128"`
+	EmailBrandColor string    `json:"email_brand_color" gorm:"size:16"`
+	EmailLogoURL    string    `json:"email_logo_url" gorm:"type:text"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// GetAllowedRedirectURIs 获取允许的跳转地址列表
+func (p *Project) GetAllowedRedirectURIs() []string {
+	var list []string
+	for _, item := range strings.FieldsFunc(p.AllowedRedirectURIs, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// GetAllowedOrigins 获取允许的跨域来源列表
+func (p *Project) GetAllowedOrigins() []string {
+	var list []string
+	for _, item := range strings.FieldsFunc(p.AllowedOrigins, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimRight(strings.TrimSpace(item), "/"); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// IsRedirectURIAllowed 判断登录后跳转地址是否在白名单内
+func (p *Project) IsRedirectURIAllowed(redirectURI string) bool {
+	target, err := url.Parse(redirectURI)
+	if err != nil || target.Scheme == "" || target.Host == "" || target.User != nil || strings.Contains(target.Path, "..") {
+		return false
+	}
+	for _, allowed := range p.GetAllowedRedirectURIs() {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			base, err := url.Parse(prefix)
+			if err != nil {
+				continue
+			}
+			if strings.EqualFold(base.Scheme, target.Scheme) && strings.EqualFold(base.Host, target.Host) &&
+				(target.Path == base.Path || strings.HasPrefix(target.Path, strings.TrimSuffix(base.Path, "/")+"/")) {
+				return true
+			}
+			continue
+		}
+		if redirectURI == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectRequest 管理员创建 / 更新项目请求（更新时未提供的字段保持不变，key 不可修改）
+type ProjectRequest struct {
+	Key                 string  `json:"key"`
+	Name                *string `json:"name"`
+	BaseURL             *string `json:"base_url"`
+	AuthMode            *string `json:"auth_mode"`
+	Credentials         string  `json:"credentials"` // 仅创建时使用，轮换见 rotate-credentials；留空时按 auth_mode 自动生成
+	TimeoutMS           *int    `json:"timeout_ms"`
+	RetryPolicy         JSON    `json:"retry_policy"` // null 表示恢复默认策略
+	Enabled             *bool   `json:"enabled"`
+	ClientCertPEM       *string `json:"client_cert_pem"`
+	ClientKeyPEM        *string `json:"client_key_pem"` // 加密后存入 client_key_enc
+	CACertPEM           *string `json:"ca_cert_pem"`
+	AllowedRedirectURIs *string `json:"allowed_redirect_uris"`
+	AllowedOrigins      *string `json:"allowed_origins"`
+	DefaultPhoneRegion  *string `json:"default_phone_region"`
+}
+
+// ProjectCredentialsRequest 轮换项目凭据请求（留空自动生成）
+type ProjectCredentialsRequest struct {
+	Credentials string `json:"credentials"`
+}
+
+// ProjectAdminView 管理员查看的项目信息（不含凭据与私钥）
+type ProjectAdminView struct {
+	Project
+	HasCredentials bool `json:"has_credentials"`
+	HasClientKey   bool `json:"has_client_key"`
+}
+
+// ToAdminView 转换为管理员视图
+func (p *Project) ToAdminView() ProjectAdminView {
+	return ProjectAdminView{Project: *p, HasCredentials: p.CredentialsEnc != "", HasClientKey: p.ClientKeyEnc != ""}
+}
+
+// ProjectRetryPolicy 项目调用重试策略：网络错误、408、429、5xx 时按指数退避（带抖动）重试，
+// 只重试幂等请求（GET / PUT / DELETE，或携带 Idempotency-Key 的 POST）
+type ProjectRetryPolicy struct {
+	MaxRetries   int `json:"max_retries"`
+	BackoffMS    int `json:"backoff_ms"`
+	MaxBackoffMS int `json:"max_backoff_ms"`
+}
+
+// GetRetryPolicy 解析项目重试策略，未配置的字段使用 PROJECT_CLIENT_* 默认值
+func (p *Project) GetRetryPolicy() ProjectRetryPolicy {
+	policy := ProjectRetryPolicy{MaxRetries: -1}
+	if len(p.RetryPolicy) > 0 {
+		_ = json.Unmarshal(p.RetryPolicy, &policy)
+	}
+	if policy.MaxRetries < 0 {
+		policy.MaxRetries = config.AppConfig.ProjectClientRetries
+	}
+	if policy.MaxRetries > 5 {
+		policy.MaxRetries = 5
+	}
+	if policy.BackoffMS <= 0 {
+		policy.BackoffMS = config.AppConfig.ProjectClientRetryBackoffMS
+	}
+	if policy.MaxBackoffMS < policy.BackoffMS {
+		policy.MaxBackoffMS = config.AppConfig.ProjectClientMaxBackoffMS
+		if policy.MaxBackoffMS < policy.BackoffMS {
+			policy.MaxBackoffMS = policy.BackoffMS
+		}
+	}
+	return policy
+}
+
+// 项目开通操作
+const (
+	ProvisioningCreate = "create"
+	ProvisioningUpdate = "update"
+	ProvisioningDelete = "delete"
+)
+
+// 项目开通任务状态
+const (
+	ProvisioningPending   = "pending"   // 等待执行（含等待重试）
+	ProvisioningSending   = "sending"   // 已被 worker 领取
+	ProvisioningSucceeded = "succeeded" // 项目接口已成功返回
+	ProvisioningDead      = "dead"      // 超过最大重试次数
+	ProvisioningCancelled = "cancelled" // 同步等待失败后注册已撤销，不再执行
+)
+
+// ProjectProvisioning 项目开通发件箱：对项目的创建 / 更新 / 删除用户调用与业务变更在同一事务写入，
+// 由后台 worker 带幂等键执行；同一项目同一用户的任务按写入顺序执行
+type ProjectProvisioning struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	IdempotencyKey string     `json:"idempotency_key" gorm:"size:64;not null;uniqueIndex"`
+	ProjectKey     string     `json:"project_key" gorm:"size:64;not null;index:idx_provisioning_subject"`
+	UserID         string     `json:"user_id" gorm:"size:36;not null;index:idx_provisioning_subject"`
+	Operation      string     `json:"operation" gorm:"size:10;not null"`
+	LocalUserID    string     `json:"local_user_id,omitempty" gorm:"size:128"` // update / delete 的目标；create 成功后回填
+	Status         string     `json:"status" gorm:"size:20;not null;index:idx_provisioning_due"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_provisioning_due"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`
+	LastError      string     `json:"last_error,omitempty" gorm:"size:500"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 }
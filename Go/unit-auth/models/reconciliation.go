@@ -0,0 +1,92 @@
+package models
+
+import "time"
+
+// 映射核对任务状态
+const (
+	ReconcilePending   = "pending"   // 等待执行（含恢复后等待继续）
+	ReconcileRunning   = "running"   // 执行中，locked_until 为租约到期时间
+	ReconcilePaused    = "paused"    // 管理员暂停，保留游标
+	ReconcileCompleted = "completed" // 三个阶段均已完成
+	ReconcileFailed    = "failed"    // 项目不可用等原因中断，可从游标恢复
+	ReconcileCancelled = "cancelled" // 已取消，不再执行
+)
+
+// 映射核对阶段，按顺序执行
+const (
+	ReconcilePhaseVerify   = "verify"   // 逐个读取项目用户，核对已有映射
+	ReconcilePhaseRemote   = "remote"   // 分页列出项目用户，找出没有映射的一侧
+	ReconcilePhaseBackfill = "backfill" // 为没有映射的本地用户写入 create 开通任务
+	ReconcilePhaseDone     = "done"
+)
+
+// 核对发现的问题
+const (
+	ReconcileLocalOrphan  = "local_orphan"  // 有映射，项目侧用户已不存在
+	ReconcileRemoteOrphan = "remote_orphan" // 项目用户没有对应的 unit-auth 用户或映射
+	ReconcileMismatch     = "mismatch"      // 项目用户的 user_id 与映射的用户不一致
+	ReconcileMissing      = "missing"       // 本地用户在项目中没有映射
+	ReconcileError        = "error"         // 读取单个项目用户失败
+)
+
+// 核对对问题采取的处理
+const (
+	ReconcileActionNone     = "none"     // 只记录（试运行或无法自动处理）
+	ReconcileActionFlagged  = "flagged"  // 映射标记 orphaned_at
+	ReconcileActionLinked   = "linked"   // 按项目用户的 user_id 补建映射
+	ReconcileActionEnqueued = "enqueued" // 已写入 create 开通任务
+)
+
+// ProjectReconciliation 项目映射核对任务：核对已有映射、列出项目用户补建映射、为缺少映射的用户开通；
+// 每批处理后保存游标与计数，中断后从游标继续
+type ProjectReconciliation struct {
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	ProjectKey    string `json:"project_key" gorm:"not null;size:64;index"`
+	DryRun        bool   `json:"dry_run" gorm:"default:false"`
+	Backfill      bool   `json:"backfill" gorm:"default:false"` // 为没有映射的正常用户写入 create 开通任务
+	BatchSize     int    `json:"batch_size"`
+	RatePerSecond int    `json:"rate_per_second"` // 项目调用与开通任务写入的速率上限
+	Status        string `json:"status" gorm:"size:20;not null;index"`
+	Phase         string `json:"phase" gorm:"size:20"`
+	Cursor        string `json:"cursor" gorm:"size:255"` // verify 为映射ID，remote 为项目返回的 next_cursor，backfill 为用户ID
+
+	Checked       int64 `json:"checked"`        // 已核对的映射
+	Verified      int64 `json:"verified"`       // 项目侧存在且一致的映射
+	LocalOrphans  int64 `json:"local_orphans"`  // 项目侧已不存在的映射
+	Mismatches    int64 `json:"mismatches"`     // user_id 不一致的映射
+	RemoteScanned int64 `json:"remote_scanned"` // 已列出的项目用户
+	RemoteOrphans int64 `json:"remote_orphans"` // 没有对应 unit-auth 用户的项目用户
+	Linked        int64 `json:"linked"`         // 按项目用户补建的映射
+	Missing       int64 `json:"missing"`        // 没有映射的本地用户
+	Enqueued      int64 `json:"enqueued"`       // 写入的 create 开通任务
+	Errors        int64 `json:"errors"`
+
+	LastError   string     `json:"last_error,omitempty" gorm:"size:1000"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	CreatedBy   string     `json:"created_by" gorm:"size:36"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ProjectReconciliationItem 核对报告中的一条问题
+type ProjectReconciliationItem struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	RunID       uint      `json:"run_id" gorm:"not null;index:idx_reconcile_item_run"`
+	Kind        string    `json:"kind" gorm:"size:20;not null;index:idx_reconcile_item_run"`
+	UserID      string    `json:"user_id,omitempty" gorm:"size:36"`
+	LocalUserID string    `json:"local_user_id,omitempty" gorm:"size:128"`
+	MappingID   uint      `json:"mapping_id,omitempty"`
+	Action      string    `json:"action" gorm:"size:20"`
+	Detail      string    `json:"detail,omitempty" gorm:"size:500"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// StartReconciliationRequest 启动映射核对请求
+type StartReconciliationRequest struct {
+	DryRun        bool `json:"dry_run"`
+	Backfill      bool `json:"backfill"`
+	BatchSize     int  `json:"batch_size" binding:"omitempty,min=1,max=1000"`
+	RatePerSecond int  `json:"rate_per_second" binding:"omitempty,min=1,max=1000"`
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SCIM 2.0 schema 与消息 URN
+const (
+	ScimSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimSchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ScimSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ScimSchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	ScimSchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+// ScimToken 项目 SCIM 接口的 Bearer 令牌（只保存 SHA-256 摘要，明文只在创建时返回一次）
+type ScimToken struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	ProjectKey  string     `json:"project_key" gorm:"not null;size:64;index"`
+	Name        string     `json:"name" gorm:"size:100"`
+	TokenHash   string     `json:"-" gorm:"not null;size:64;uniqueIndex"`
+	TokenPrefix string     `json:"token_prefix" gorm:"size:16"` // 明文前缀，便于识别
+	CreatedBy   string     `json:"created_by" gorm:"size:36"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ScimUserLink 通过项目 SCIM 接口开通的用户；项目的 IdP 只能看到并管理自己开通的用户
+type ScimUserLink struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ProjectKey string    `json:"project_key" gorm:"not null;size:64;uniqueIndex:uk_scim_user;index:idx_scim_user_external"`
+	UserID     string    `json:"user_id" gorm:"not null;size:36;uniqueIndex:uk_scim_user"`
+	ExternalID string    `json:"external_id" gorm:"size:255;index:idx_scim_user_external"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ScimGroupLink 项目 SCIM 接口可见的角色；Owned 为该项目通过 SCIM 创建的角色（可改名、删除），
+// 否则为关联的已有角色（只管理该项目内的成员）。成员为 Project 等于项目 key 的 user_roles
+type ScimGroupLink struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ProjectKey string    `json:"project_key" gorm:"not null;size:64;uniqueIndex:uk_scim_group"`
+	RoleID     uint      `json:"role_id" gorm:"not null;uniqueIndex:uk_scim_group"`
+	ExternalID string    `json:"external_id" gorm:"size:255"`
+	Owned      bool      `json:"owned" gorm:"default:false"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// 关联
+	Role Role `json:"role" gorm:"foreignKey:RoleID"`
+}
+
+// ScimMeta 资源元数据
+type ScimMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+	Version      string     `json:"version,omitempty"`
+}
+
+// ScimName 用户姓名
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+}
+
+// ScimMultiValue 多值属性（emails、phoneNumbers、photos、groups、members）
+type ScimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// ScimUser SCIM User 资源；password 只写不读，groups 只读
+type ScimUser struct {
+	Schemas      []string         `json:"schemas"`
+	ID           string           `json:"id,omitempty"`
+	ExternalID   string           `json:"externalId,omitempty"`
+	UserName     string           `json:"userName"`
+	Name         *ScimName        `json:"name,omitempty"`
+	DisplayName  string           `json:"displayName,omitempty"`
+	ProfileURL   string           `json:"profileUrl,omitempty"`
+	Title        string           `json:"title,omitempty"`
+	Locale       string           `json:"locale,omitempty"`
+	Timezone     string           `json:"timezone,omitempty"`
+	Active       *bool            `json:"active,omitempty"`
+	Password     string           `json:"password,omitempty"`
+	Emails       []ScimMultiValue `json:"emails,omitempty"`
+	PhoneNumbers []ScimMultiValue `json:"phoneNumbers,omitempty"`
+	Photos       []ScimMultiValue `json:"photos,omitempty"`
+	Groups       []ScimMultiValue `json:"groups,omitempty"`
+	Meta         *ScimMeta        `json:"meta,omitempty"`
+}
+
+// ScimGroup SCIM Group 资源
+type ScimGroup struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []ScimMultiValue `json:"members"`
+	Meta        *ScimMeta        `json:"meta,omitempty"`
+}
+
+// ScimListResponse 列表响应
+type ScimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int64         `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// ScimError 错误响应（status 为字符串）
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// ScimPatchRequest PATCH 请求
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+// ScimPatchOperation PATCH 操作：add / replace / remove
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// CreateScimTokenRequest 创建 SCIM 令牌请求
+type CreateScimTokenRequest struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	ExpiresInDays int    `json:"expires_in_days,omitempty" binding:"omitempty,min=1,max=3650"` // 留空不过期
+}
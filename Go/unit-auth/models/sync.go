@@ -19,6 +19,8 @@ type SyncTask struct {
 	LastSyncAt    *time.Time `json:"last_sync_at"`
 	NextSyncAt    *time.Time `json:"next_sync_at"`
 	IsActive      bool       `json:"is_active" gorm:"default:true"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"` // 执行租约，实例异常退出后过期可被重新执行
+	LastError     string     `json:"last_error,omitempty" gorm:"size:1000"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
 }
@@ -27,7 +29,7 @@ type SyncTask struct {
 type SyncLog struct {
 	ID               uint       `json:"id" gorm:"primaryKey"`
 	TaskID           uint       `json:"task_id" gorm:"not null"`
-	Status           string     `json:"status" gorm:"not null;size:20"` // success, failed, partial
+	Status           string     `json:"status" gorm:"not null;size:20"` // running, success, failed, partial
 	StartTime        time.Time  `json:"start_time"`
 	EndTime          *time.Time `json:"end_time"`
 	RecordsProcessed int64      `json:"records_processed" gorm:"default:0"`
@@ -44,16 +46,18 @@ type SyncLog struct {
 // DataChange 数据变更记录表
 type DataChange struct {
 	ID          uint       `json:"id" gorm:"primaryKey"`
-	TableName   string     `json:"table_name" gorm:"not null;size:100"`
-	RecordID    string     `json:"record_id" gorm:"not null;size:100"`
+	TableName   string     `json:"table_name" gorm:"not null;size:100;index:idx_data_changes_record,priority:1"`
+	RecordID    string     `json:"record_id" gorm:"not null;size:100;index:idx_data_changes_record,priority:2"`
 	ChangeType  string     `json:"change_type" gorm:"not null;size:20"` // insert, update, delete
 	OldData     JSON       `json:"old_data" gorm:"type:json"`
 	NewData     JSON       `json:"new_data" gorm:"type:json"`
 	Project     string     `json:"project" gorm:"size:50"`
-	UserID      string     `json:"user_id" gorm:"size:36"`
-	SyncStatus  string     `json:"sync_status" gorm:"default:'pending';size:20"` // pending, synced, failed
+	UserID      string     `json:"user_id" gorm:"size:36"`                                                                // 操作者ID，系统操作为空
+	SyncStatus  string     `json:"sync_status" gorm:"default:'pending';size:20;index:idx_data_changes_record,priority:3"` // pending, synced, failed
 	RetryCount  int        `json:"retry_count" gorm:"default:0"`
 	LastRetryAt *time.Time `json:"last_retry_at"`
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty" gorm:"index"` // 下次处理时间，处理中时为租约到期时间
+	LastError   string     `json:"last_error,omitempty" gorm:"size:1000"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 
@@ -80,16 +84,18 @@ type SyncMapping struct {
 // SyncConflict 同步冲突表
 type SyncConflict struct {
 	ID           uint       `json:"id" gorm:"primaryKey"`
-	TaskID       uint       `json:"task_id" gorm:"not null"`
-	TableName    string     `json:"table_name" gorm:"not null;size:100"`
-	RecordID     string     `json:"record_id" gorm:"not null;size:100"`
+	TaskID       uint       `json:"task_id" gorm:"not null;index:idx_sync_conflicts_record,priority:1"`
+	TableName    string     `json:"table_name" gorm:"not null;size:100;index:idx_sync_conflicts_record,priority:2"`
+	RecordID     string     `json:"record_id" gorm:"not null;size:100;index:idx_sync_conflicts_record,priority:3"`
 	ConflictType string     `json:"conflict_type" gorm:"not null;size:50"` // duplicate_key, constraint_violation, data_inconsistency
 	SourceData   JSON       `json:"source_data" gorm:"type:json"`
 	TargetData   JSON       `json:"target_data" gorm:"type:json"`
-	Resolution   string     `json:"resolution" gorm:"size:20"` // source_wins, target_wins, manual, ignore
-	ResolvedBy   string     `json:"resolved_by" gorm:"size:36"`
+	Resolution   string     `json:"resolution" gorm:"size:20"`  // source_wins, target_wins, manual, ignore, last_writer_wins
+	ResolvedBy   string     `json:"resolved_by" gorm:"size:36"` // 处理的管理员ID，按任务策略自动处理时为空
 	ResolvedAt   *time.Time `json:"resolved_at"`
 	Notes        string     `json:"notes" gorm:"size:1000"`
+	SourceTime   *time.Time `json:"source_time"` // 源记录的 updated_at
+	TargetTime   *time.Time `json:"target_time"` // 冲突发生时目标记录的 updated_at
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
 
@@ -100,9 +106,9 @@ type SyncConflict struct {
 // SyncCheckpoint 同步检查点表
 type SyncCheckpoint struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
-	TaskID     uint      `json:"task_id" gorm:"not null"`
-	TableName  string    `json:"table_name" gorm:"not null;size:100"`
-	Checkpoint JSON      `json:"checkpoint" gorm:"type:json"` // 检查点数据
+	TaskID     uint      `json:"task_id" gorm:"not null;uniqueIndex:uk_task_table"`
+	TableName  string    `json:"table_name" gorm:"not null;size:100;uniqueIndex:uk_task_table"` // 源表->目标表
+	Checkpoint JSON      `json:"checkpoint" gorm:"type:json"`                                   // 检查点数据
 	LastSyncID string    `json:"last_sync_id" gorm:"size:100"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
@@ -111,6 +117,57 @@ type SyncCheckpoint struct {
 	Task SyncTask `json:"task" gorm:"foreignKey:TaskID"`
 }
 
+// SyncTargetSnapshot 同步最近一次写入项目的用户字段（按项目读取的实际值），
+// 目标为项目时与项目当前值比较，发现两次同步之间项目侧的修改
+type SyncTargetSnapshot struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ProjectKey string    `json:"project_key" gorm:"not null;size:64;uniqueIndex:uk_sync_snapshot_record"`
+	TableName  string    `json:"table_name" gorm:"not null;size:100;uniqueIndex:uk_sync_snapshot_record"`
+	RecordID   string    `json:"record_id" gorm:"not null;size:100;uniqueIndex:uk_sync_snapshot_record"` // unit-auth 用户ID
+	Data       JSON      `json:"data" gorm:"type:json"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// 同步任务状态
+const (
+	SyncStatusPending   = "pending"
+	SyncStatusRunning   = "running"
+	SyncStatusCompleted = "completed"
+	SyncStatusFailed    = "failed"
+)
+
+// 同步模式
+const (
+	SyncModeFull        = "full"
+	SyncModeIncremental = "incremental"
+	SyncModeRealtime    = "realtime" // 不设 Schedule 时按调度间隔持续增量同步
+)
+
+// 同步日志状态
+const (
+	SyncLogRunning = "running"
+	SyncLogSuccess = "success"
+	SyncLogFailed  = "failed"
+	SyncLogPartial = "partial" // 部分记录失败或产生冲突
+)
+
+// 同步冲突类型
+const (
+	SyncConflictDuplicateKey        = "duplicate_key"
+	SyncConflictConstraintViolation = "constraint_violation"
+	SyncConflictDataInconsistency   = "data_inconsistency" // 目标记录在上次同步后被修改，且与源数据不一致
+)
+
+// 同步冲突处理方式（任务 config.conflict_strategy 与手动处理）
+const (
+	SyncResolutionSourceWins     = "source_wins"      // 以源数据覆盖目标
+	SyncResolutionTargetWins     = "target_wins"      // 保留目标数据，源记录再次变更前不再覆盖
+	SyncResolutionManual         = "manual"           // 管理员逐字段选择或填写
+	SyncResolutionIgnore         = "ignore"           // 不做处理
+	SyncResolutionLastWriterWins = "last_writer_wins" // 逐字段比较修改时间，较新的一方胜出
+)
+
 // 请求和响应结构体
 
 // CreateSyncTaskRequest 创建同步任务请求
@@ -143,6 +200,21 @@ type CreateSyncMappingRequest struct {
 	TransformRule map[string]interface{} `json:"transform_rule,omitempty"`
 }
 
+// ResolveSyncConflictRequest 处理同步冲突请求；manual 时 fields 为字段 → source / target，data 为直接写入目标的值
+type ResolveSyncConflictRequest struct {
+	Resolution string                 `json:"resolution" binding:"required,oneof=source_wins target_wins manual ignore last_writer_wins"`
+	Fields     map[string]string      `json:"fields,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	Notes      string                 `json:"notes,omitempty"`
+}
+
+// BatchResolveSyncConflictsRequest 批量处理同步冲突请求（不支持 manual）
+type BatchResolveSyncConflictsRequest struct {
+	IDs        []uint `json:"ids" binding:"required,min=1,max=200"`
+	Resolution string `json:"resolution" binding:"required,oneof=source_wins target_wins ignore last_writer_wins"`
+	Notes      string `json:"notes,omitempty"`
+}
+
 // SyncTaskResponse 同步任务响应
 type SyncTaskResponse struct {
 	ID            uint                   `json:"id"`
@@ -207,9 +279,23 @@ type SyncConflictResponse struct {
 	ResolvedBy   string                 `json:"resolved_by"`
 	ResolvedAt   *time.Time             `json:"resolved_at"`
 	Notes        string                 `json:"notes"`
+	SourceTime   *time.Time             `json:"source_time"`
+	TargetTime   *time.Time             `json:"target_time"`
 	CreatedAt    time.Time              `json:"created_at"`
 }
 
+// SyncConflictField 冲突字段的源与目标对照
+type SyncConflictField struct {
+	Field      string      `json:"field"`
+	Source     interface{} `json:"source"`
+	Target     interface{} `json:"target"`            // 冲突发生时的目标值
+	Current    interface{} `json:"current,omitempty"` // 当前目标值（目标为本地库时）
+	Differs    bool        `json:"differs"`           // 源与当前目标值不一致
+	SourceTime *time.Time  `json:"source_time"`
+	TargetTime *time.Time  `json:"target_time"` // 目标字段最近一次修改时间（来自 data_changes，缺省为记录的 updated_at）
+	Winner     string      `json:"winner"`      // 按 last_writer_wins 胜出的一方：source / target
+}
+
 // 方法实现
 
 // GetConfig 获取同步任务配置
@@ -328,6 +414,34 @@ func (dc *DataChange) SetNewData(newData map[string]interface{}) error {
 	return nil
 }
 
+// GetSourceData 获取冲突的源数据
+func (sc *SyncConflict) GetSourceData() (map[string]interface{}, error) {
+	if len(sc.SourceData) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	var sourceData map[string]interface{}
+	err := json.Unmarshal(sc.SourceData, &sourceData)
+	if err != nil {
+		return nil, err
+	}
+	return sourceData, nil
+}
+
+// GetTargetData 获取冲突时的目标数据
+func (sc *SyncConflict) GetTargetData() (map[string]interface{}, error) {
+	if len(sc.TargetData) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	var targetData map[string]interface{}
+	err := json.Unmarshal(sc.TargetData, &targetData)
+	if err != nil {
+		return nil, err
+	}
+	return targetData, nil
+}
+
 // GetFieldMapping 获取字段映射
 func (sm *SyncMapping) GetFieldMapping() (map[string]string, error) {
 	if len(sm.FieldMapping) == 0 {
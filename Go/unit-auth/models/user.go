@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"time"
+	"unit-auth/utils"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -55,6 +56,10 @@ type User struct {
 	LastLoginIP        string     `json:"last_login_ip" gorm:"size:45"`
 	LastLoginUserAgent string     `json:"last_login_user_agent" gorm:"size:500"`
 
+	// 会话吊销：此时间之前签发的令牌全部失效；需重置密码时不允许密码登录
+	TokensRevokedAt       *time.Time `json:"-"`
+	PasswordResetRequired bool       `json:"password_reset_required" gorm:"default:false"`
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
@@ -104,19 +109,95 @@ func (j *JSON) UnmarshalJSON(data []byte) error {
 
 // ProjectMapping 项目映射表 - 用于中心化用户管理
 type ProjectMapping struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	UserID      string    `json:"user_id" gorm:"not null;size:36;index:idx_project_user,unique"`
-	ProjectName string    `json:"project_name" gorm:"not null;size:64;index:idx_project_user,unique;index:idx_project_local,unique"`
-	LocalUserID string    `json:"local_user_id" gorm:"not null;size:128;index:idx_project_local,unique"` // 项目本地的用户ID
-	MappingType string    `json:"mapping_type" gorm:"default:'direct';size:20"`                          // direct, alias, federated
-	IsActive    bool      `json:"is_active" gorm:"default:true"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      string     `json:"user_id" gorm:"not null;size:36;index:idx_project_user,unique"`
+	ProjectName string     `json:"project_name" gorm:"not null;size:64;index:idx_project_user,unique;index:idx_project_local,unique"`
+	LocalUserID string     `json:"local_user_id" gorm:"not null;size:128;index:idx_project_local,unique"` // 项目本地的用户ID
+	MappingType string     `json:"mapping_type" gorm:"default:'direct';size:20"`                          // direct, alias, federated
+	IsActive    bool       `json:"is_active" gorm:"default:true"`
+	OrphanedAt  *time.Time `json:"orphaned_at,omitempty"` // 映射核对时项目侧已找不到该用户
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 
 	// 关联用户
 	User User `json:"user" gorm:"foreignKey:UserID"`
 }
 
+// UserIdentity 第三方身份绑定表（provider + subject 唯一）
+type UserIdentity struct {
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	UserID        string `json:"user_id" gorm:"not null;size:36;index"`
+	Provider      string `json:"provider" gorm:"not null;size:64;uniqueIndex:idx_provider_subject"`
+	Subject       string `json:"subject" gorm:"not null;size:255;uniqueIndex:idx_provider_subject"`
+	Email         string `json:"email" gorm:"size:255"`
+	EmailVerified bool   `json:"email_verified" gorm:"default:false"`
+
+	// 微信 UnionID：同一开放平台下网站应用、公众号、小程序的 openid 不同但 UnionID 相同，用于合并为同一用户
+	UnionID string `json:"union_id,omitempty" gorm:"size:100;index"`
+
+	// 第三方返回的原始资料
+	RawProfile JSON `json:"-" gorm:"type:json"`
+
+	// 第三方令牌（AES-GCM 加密存储，见 utils.EncryptString）
+	AccessTokenEnc  string     `json:"-" gorm:"type:text"`
+	RefreshTokenEnc string     `json:"-" gorm:"type:text"`
+	TokenExpiresAt  *time.Time `json:"-"`
+
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// UserIdentityResponse 身份绑定响应
+type UserIdentityResponse struct {
+	ID            uint       `json:"id"`
+	Provider      string     `json:"provider"`
+	Subject       string     `json:"subject"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	Nickname      string     `json:"nickname,omitempty"`
+	Avatar        string     `json:"avatar,omitempty"`
+	LastLoginAt   *time.Time `json:"last_login_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ToResponse 转换为响应（从原始资料中提取昵称、头像用于展示）
+func (i *UserIdentity) ToResponse() UserIdentityResponse {
+	resp := UserIdentityResponse{
+		ID:            i.ID,
+		Provider:      i.Provider,
+		Subject:       i.Subject,
+		Email:         i.Email,
+		EmailVerified: i.EmailVerified,
+		LastLoginAt:   i.LastLoginAt,
+		CreatedAt:     i.CreatedAt,
+	}
+	if len(i.RawProfile) > 0 {
+		var profile map[string]interface{}
+		if err := json.Unmarshal(i.RawProfile, &profile); err == nil {
+			for _, k := range []string{"name", "nickname", "login"} {
+				if v, ok := profile[k].(string); ok && v != "" {
+					resp.Nickname = v
+					break
+				}
+			}
+			for _, k := range []string{"picture", "avatar_url", "headimgurl"} {
+				if v, ok := profile[k].(string); ok && v != "" {
+					resp.Avatar = v
+					break
+				}
+			}
+		}
+	}
+	return resp
+}
+
+// LinkIdentityRequest 绑定第三方身份请求
+type LinkIdentityRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
 // GlobalUserStats 全局用户统计表
 type GlobalUserStats struct {
 	ID             uint       `json:"id" gorm:"primaryKey"`
@@ -183,6 +264,110 @@ type SMSVerification struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// 短信投递状态
+const (
+	SMSDeliverySent        = "sent"        // 服务商已受理
+	SMSDeliveryFailed      = "failed"      // 提交失败（已尝试故障转移）
+	SMSDeliveryDelivered   = "delivered"   // 回执：用户已接收
+	SMSDeliveryUndelivered = "undelivered" // 回执：投递失败
+)
+
+// SMSDelivery 短信投递记录（每次向服务商提交一条，故障转移时同一 RequestID 下有多条）
+type SMSDelivery struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	RequestID   string     `json:"request_id" gorm:"size:64;not null;index"`
+	Phone       string     `json:"phone" gorm:"size:32;not null;index"`
+	Template    string     `json:"template" gorm:"size:50"` // login, register, reset_password, notification
+	Vendor      string     `json:"vendor" gorm:"size:32;not null;index:idx_sms_deliveries_vendor_message"`
+	MessageID   string     `json:"message_id" gorm:"size:128;index:idx_sms_deliveries_vendor_message"` // 服务商消息ID（BizId / SerialNo / Sid）
+	Attempt     int        `json:"attempt" gorm:"not null;default:1"`
+	Status      string     `json:"status" gorm:"size:20;not null;index"`
+	ErrorCode   string     `json:"error_code,omitempty" gorm:"size:64"`
+	Error       string     `json:"error,omitempty" gorm:"size:500"`
+	LatencyMS   int64      `json:"latency_ms"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"` // 回执时间
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// SMSDailyCounter 短信每日共享计数：国家/号段预算、费用与费用熔断，多实例部署时按条件更新保证全局生效
+type SMSDailyCounter struct {
+	Day        string    `json:"day" gorm:"primaryKey;size:10"`         // 自然日 2006-01-02
+	CounterKey string    `json:"counter_key" gorm:"primaryKey;size:64"` // spend、breaker、country:CN、prefix:+8617
+	Value      int64     `json:"value" gorm:"not null;default:0"`       // breaker 为熔断时间（Unix 秒），0 为未熔断
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// 邮件发件箱状态
+const (
+	EmailOutboxPending = "pending" // 等待投递（含等待重试）
+	EmailOutboxSending = "sending" // 已被 worker 领取
+	EmailOutboxSent    = "sent"    // 传输已受理
+	EmailOutboxDead    = "dead"    // 死信：超过最大重试次数或不可重试的错误
+)
+
+// EmailOutbox 邮件发件箱：请求中只写入一条记录，由后台 worker 投递、失败按退避重试
+type EmailOutbox struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	MessageID     string     `json:"message_id" gorm:"size:64;not null;uniqueIndex"`
+	ProjectKey    string     `json:"project_key" gorm:"size:64;index"`
+	Template      string     `json:"template" gorm:"size:64"`
+	FromAddress   string     `json:"from_address" gorm:"size:255"`
+	FromName      string     `json:"from_name" gorm:"size:100"`
+	ToAddress     string     `json:"to_address" gorm:"size:255;not null;index"`
+	Subject       string     `json:"subject" gorm:"size:255"`
+	HTMLBody      string     `json:"-" gorm:"type:longtext"`
+	TextBody      string     `json:"-" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"size:20;not null;index:idx_email_outbox_due"`
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index:idx_email_outbox_due"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"` // worker 租约，过期未完成视为 worker 崩溃，重新领取
+	Transport     string     `json:"transport,omitempty" gorm:"size:20"`
+	LastError     string     `json:"last_error,omitempty" gorm:"size:500"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// EmailUnsubscribe 通知类邮件退订（邮件中的 List-Unsubscribe 链接或一键退订），事务类邮件不受影响
+type EmailUnsubscribe struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Email     string    `json:"email" gorm:"size:255;not null;uniqueIndex"`
+	Source    string    `json:"source" gorm:"size:20"` // one_click, link
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 邮箱 / 手机号变更状态
+const (
+	ContactChangePending   = "pending"   // 已向新地址发送验证码，等待确认
+	ContactChangeCompleted = "completed" // 已生效，旧地址可在撤销期内撤销
+	ContactChangeReverted  = "reverted"  // 已由旧地址撤销
+	ContactChangeCancelled = "cancelled" // 被新的变更申请取代，或验证码错误次数过多
+)
+
+// ContactChange 邮箱 / 手机号变更记录：新地址验证码确认后生效，旧地址收到带撤销链接的通知
+type ContactChange struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          string     `json:"user_id" gorm:"size:36;not null;index"`
+	Channel         string     `json:"channel" gorm:"size:10;not null"` // email, phone
+	OldValue        string     `json:"old_value" gorm:"size:255"`
+	NewValue        string     `json:"new_value" gorm:"size:255;not null"`
+	OldVerified     bool       `json:"old_verified"`                   // 变更前的验证状态，撤销时恢复
+	Source          string     `json:"source" gorm:"size:10;not null"` // self, admin
+	ActorID         string     `json:"actor_id,omitempty" gorm:"size:36"`
+	Status          string     `json:"status" gorm:"size:20;not null;index"`
+	CodeHash        string     `json:"-" gorm:"size:64"`
+	Attempts        int        `json:"attempts"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	RevertTokenHash string     `json:"-" gorm:"size:64;index"`
+	RevertExpiresAt *time.Time `json:"revert_expires_at,omitempty"`
+	RevertedAt      *time.Time `json:"reverted_at,omitempty"`
+	IPAddress       string     `json:"ip_address" gorm:"size:45"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
 // PasswordReset 密码重置表
 type PasswordReset struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
@@ -220,15 +405,63 @@ type LoginLog struct {
 
 // WeChatQRSession 微信二维码会话表
 type WeChatQRSession struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	State     string    `json:"state" gorm:"type:varchar(100);uniqueIndex;not null"`
-	WeChatID  string    `json:"wechat_id" gorm:"size:100"`
-	IP        string    `json:"ip" gorm:"size:45"`
-	UserAgent string    `json:"user_agent" gorm:"size:500"`
-	Scanned   bool      `json:"scanned" gorm:"default:false"`
-	Used      bool      `json:"used" gorm:"default:false"`
-	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	State       string     `json:"state" gorm:"type:varchar(100);uniqueIndex;not null"`
+	WeChatID    string     `json:"wechat_id" gorm:"size:100"`
+	IP          string     `json:"ip" gorm:"size:45"`
+	UserAgent   string     `json:"user_agent" gorm:"size:500"`
+	BindingHash string     `json:"-" gorm:"size:64"` // 生成二维码的浏览器绑定 Cookie 的哈希
+	Scanned     bool       `json:"scanned" gorm:"default:false"`
+	Used        bool       `json:"used" gorm:"default:false"`
+	DeliveredAt *time.Time `json:"delivered_at"` // Token 交付给网页端的时间，只交付一次
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ImpersonationSession 管理员模拟登录会话表
+type ImpersonationSession struct {
+	ID            string     `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	AdminID       string     `json:"admin_id" gorm:"type:varchar(36);index;not null"`
+	UserID        string     `json:"user_id" gorm:"type:varchar(36);index;not null"`
+	TokenID       string     `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"` // 对应token的jti
+	ProjectKey    string     `json:"project_key" gorm:"size:50"`
+	Reason        string     `json:"reason" gorm:"size:500"`
+	IP            string     `json:"ip" gorm:"size:45"`
+	UserAgent     string     `json:"user_agent" gorm:"size:500"`
+	VisibleToUser bool       `json:"visible_to_user" gorm:"default:true"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null"`
+	EndedAt       *time.Time `json:"ended_at"`
+	EndedBy       string     `json:"ended_by" gorm:"type:varchar(36)"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// IsActive 会话是否仍然有效
+func (s *ImpersonationSession) IsActive() bool {
+	return s.EndedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// IsImpersonationTokenActive 根据token的jti检查模拟登录会话是否仍然有效（结束后token立即失效）
+func IsImpersonationTokenActive(db *gorm.DB, tokenID string) bool {
+	if db == nil || tokenID == "" {
+		return false
+	}
+	var session ImpersonationSession
+	if err := db.Where("token_id = ?", tokenID).First(&session).Error; err != nil {
+		return false
+	}
+	return session.IsActive()
+}
+
+// IsTokenRevoked 检查令牌是否签发于用户会话吊销之前（签发时间只精确到秒，按秒比较）
+func IsTokenRevoked(db *gorm.DB, claims *utils.EnhancedClaims) bool {
+	if db == nil || claims == nil || claims.UserID == "" {
+		return false
+	}
+	var user User
+	if err := db.Select("id", "tokens_revoked_at").Where("id = ?", claims.UserID).First(&user).Error; err != nil || user.TokensRevokedAt == nil {
+		return false
+	}
+	return claims.IssuedAt == nil || claims.IssuedAt.Time.Before(user.TokensRevokedAt.Truncate(time.Second))
 }
 
 // 请求和响应结构体
@@ -249,6 +482,14 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// ImpersonateRequest 管理员模拟登录请求
+type ImpersonateRequest struct {
+	Reason        string `json:"reason" binding:"required,max=500"`
+	TTLMinutes    int    `json:"ttl_minutes" binding:"omitempty,min=1,max=60"` // 默认15分钟
+	ProjectKey    string `json:"project_key"`
+	VisibleToUser *bool  `json:"visible_to_user"` // 默认对用户可见
+}
+
 // UnifiedLoginRequest 统一登录请求
 type UnifiedLoginRequest struct {
 	Account  string `json:"account" binding:"required"`  // 账号（邮箱/用户名/手机号）
@@ -270,21 +511,23 @@ type PhoneResetPasswordRequest struct {
 
 // SendPhoneCodeRequest 发送手机验证码请求
 type SendPhoneCodeRequest struct {
-	Phone string `json:"phone" binding:"required"`
-	Type  string `json:"type" binding:"required,oneof=login reset_password"`
+	Phone        string `json:"phone" binding:"required"`
+	Type         string `json:"type" binding:"required,oneof=login reset_password"`
+	CaptchaToken string `json:"captcha_token"` // 发送受限并返回 428 时需携带人机验证 token
 }
 
 // OAuthLoginRequest OAuth登录请求
 type OAuthLoginRequest struct {
 	Provider string `json:"provider" binding:"required"` // google, github, wechat
 	Code     string `json:"code" binding:"required"`
-	State    string `json:"state"`
+	State    string `json:"state" binding:"required"` // 由 GET /auth/oauth/:provider/url 下发
 }
 
 // SendEmailCodeRequest 发送邮件验证码请求
 type SendEmailCodeRequest struct {
-	Email string `json:"email" binding:"required,email"`
-	Type  string `json:"type" binding:"required,oneof=register reset_password login"`
+	Email        string `json:"email" binding:"required,email"`
+	Type         string `json:"type" binding:"required,oneof=register reset_password login"`
+	CaptchaToken string `json:"captcha_token"` // 发送受限并返回 428 时需携带人机验证 token
 }
 
 // EmailLoginRequest 邮箱验证码登录请求
@@ -307,7 +550,8 @@ type VerifyEmailRequest struct {
 
 // ForgotPasswordRequest 忘记密码请求
 type ForgotPasswordRequest struct {
-	Email string `json:"email" binding:"required,email"`
+	Email        string `json:"email" binding:"required,email"`
+	CaptchaToken string `json:"captcha_token"`
 }
 
 // ResetPasswordRequest 重置密码请求
@@ -323,6 +567,25 @@ type ChangePasswordRequest struct {
 	NewPassword string `json:"new_password" binding:"required,min=6"`
 }
 
+// ChangeEmailRequest 修改邮箱请求（验证码发送到新邮箱）
+type ChangeEmailRequest struct {
+	Password     string `json:"password"` // 已设置密码的账号必填
+	NewEmail     string `json:"new_email" binding:"required,email"`
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// ChangePhoneRequest 修改手机号请求（验证码发送到新手机号）
+type ChangePhoneRequest struct {
+	Password     string `json:"password"` // 已设置密码的账号必填
+	NewPhone     string `json:"new_phone" binding:"required"`
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// ConfirmContactChangeRequest 确认邮箱 / 手机号变更请求
+type ConfirmContactChangeRequest struct {
+	Code string `json:"code" binding:"required,len=6"`
+}
+
 // UpdateProfileRequest 更新用户信息请求
 type UpdateProfileRequest struct {
 	Nickname string    `json:"nickname" binding:"min=2,max=50"`
@@ -333,7 +596,8 @@ type UpdateProfileRequest struct {
 type UserResponse struct {
 	ID            string     `json:"id"`
 	Email         string     `json:"email"`
-	Phone         string     `json:"phone"`
+	Phone         string     `json:"phone"`                   // E.164
+	PhoneDisplay  string     `json:"phone_display,omitempty"` // 展示格式，如 +86 138 0013 8000
 	Username      string     `json:"username"`
 	Nickname      string     `json:"nickname"`
 	Meta          *UserMeta  `json:"meta,omitempty"`
@@ -348,8 +612,9 @@ type UserResponse struct {
 
 // LoginResponse 登录响应
 type LoginResponse struct {
-	User  UserResponse `json:"user"`
-	Token string       `json:"token"`
+	User        UserResponse `json:"user"`
+	Token       string       `json:"token"`
+	RedirectURI string       `json:"redirect_uri,omitempty"` // OAuth 登录完成后的跳转地址（已按项目白名单校验）
 }
 
 // UserStatsResponse 用户统计响应
@@ -372,6 +637,22 @@ type WeChatLoginRequest struct {
 	State string `json:"state" binding:"required"`
 }
 
+// WeChatMiniLoginRequest 微信小程序登录请求（code 来自 wx.login，encrypted_data / iv 来自 getPhoneNumber，可选）
+type WeChatMiniLoginRequest struct {
+	Code          string `json:"code" binding:"required"`
+	EncryptedData string `json:"encrypted_data"`
+	IV            string `json:"iv"`
+	Nickname      string `json:"nickname"`
+	Avatar        string `json:"avatar"`
+}
+
+// WeChatMiniPhoneRequest 小程序绑定手机号请求（需重新 wx.login 获取 code 以得到新的 session_key）
+type WeChatMiniPhoneRequest struct {
+	Code          string `json:"code" binding:"required"`
+	EncryptedData string `json:"encrypted_data" binding:"required"`
+	IV            string `json:"iv" binding:"required"`
+}
+
 // WeChatQRStatusResponse 微信扫码状态响应
 type WeChatQRStatusResponse struct {
 	Status  string        `json:"status"` // pending, scanned, confirmed, expired
@@ -486,6 +767,7 @@ func (u *User) ToResponse() UserResponse {
 		ID:            u.ID,
 		Email:         email,
 		Phone:         phone,
+		PhoneDisplay:  utils.FormatPhoneDisplay(phone),
 		Username:      u.Username,
 		Nickname:      u.Nickname,
 		Meta:          meta,
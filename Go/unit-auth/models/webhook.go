@@ -0,0 +1,106 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Webhook 投递状态
+const (
+	WebhookDeliveryPending   = "pending"   // 等待投递（含等待重试）
+	WebhookDeliverySending   = "sending"   // 已被 worker 领取
+	WebhookDeliverySucceeded = "succeeded" // 对方返回 2xx
+	WebhookDeliveryDead      = "dead"      // 超过最大重试次数
+)
+
+// WebhookSubscription 项目的 Webhook 订阅：用户生命周期事件签名后 POST 到 URL
+type WebhookSubscription struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	ProjectKey  string `json:"project_key" gorm:"size:64;not null;index"`
+	URL         string `json:"url" gorm:"type:text;not null"`
+	Events      string `json:"events" gorm:"type:text"` // 逗号分隔的事件类型，留空或 * 表示全部
+	Description string `json:"description" gorm:"size:255"`
+	Enabled     bool   `json:"enabled" gorm:"default:true"`
+	// 签名密钥（加密存储）；轮换后旧密钥在 PreviousSecretExpiresAt 前继续参与签名
+	SecretEnc               string     `json:"-" gorm:"type:text;not null"`
+	PreviousSecretEnc       string     `json:"-" gorm:"type:text"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+}
+
+// GetEvents 订阅的事件类型列表，为空表示全部
+func (s *WebhookSubscription) GetEvents() []string {
+	var list []string
+	for _, item := range strings.Split(s.Events, ",") {
+		if item = strings.TrimSpace(item); item != "" && item != "*" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Wants 是否订阅了该事件类型
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	events := s.GetEvents()
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent 已发布的用户事件（用于重放）
+type WebhookEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	EventID   string    `json:"event_id" gorm:"size:64;not null;uniqueIndex"`
+	Type      string    `json:"type" gorm:"size:64;not null;index"`
+	UserID    string    `json:"user_id" gorm:"size:36;index"`
+	ActorID   string    `json:"actor_id,omitempty" gorm:"size:36"`
+	Data      JSON      `json:"data" gorm:"type:json"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// WebhookDelivery Webhook 投递记录：每个事件对每个匹配的订阅一条，失败按退避重试
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	DeliveryID     string     `json:"delivery_id" gorm:"size:64;not null;uniqueIndex"`
+	SubscriptionID uint       `json:"subscription_id" gorm:"not null;index"`
+	ProjectKey     string     `json:"project_key" gorm:"size:64;index"`
+	EventID        string     `json:"event_id" gorm:"size:64;not null;index"`
+	EventType      string     `json:"event_type" gorm:"size:64;not null"`
+	Payload        string     `json:"payload,omitempty" gorm:"type:mediumtext"`
+	Status         string     `json:"status" gorm:"size:20;not null;index:idx_webhook_delivery_due"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_webhook_delivery_due"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `json:"response_body,omitempty" gorm:"size:1000"`
+	LastError      string     `json:"last_error,omitempty" gorm:"size:500"`
+	DurationMS     int64      `json:"duration_ms"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	ReplayOf       *uint      `json:"replay_of,omitempty"` // 由管理员重放时指向原投递
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// WebhookSubscriptionRequest 创建 / 更新 Webhook 订阅请求
+type WebhookSubscriptionRequest struct {
+	ProjectKey  string   `json:"project_key"` // 仅创建时使用
+	URL         string   `json:"url"`
+	Events      []string `json:"events"` // 留空表示全部事件
+	Description string   `json:"description"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// WebhookReplayRequest 按时间范围重放事件请求
+type WebhookReplayRequest struct {
+	Since      time.Time `json:"since" binding:"required"`
+	Until      time.Time `json:"until"`       // 默认当前时间
+	EventTypes []string  `json:"event_types"` // 留空表示订阅的全部事件
+	AfterID    uint      `json:"after_id"`    // 上次响应的 next_after_id，用于继续重放
+}
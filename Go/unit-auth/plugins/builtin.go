@@ -0,0 +1,60 @@
+package plugins
+
+import (
+	"context"
+	"os"
+	"unit-auth/utils"
+
+	"gorm.io/gorm"
+)
+
+// BuiltinLoader 内置提供者：邮箱、手机号、Google、微信（网站应用、公众号、小程序）、GitHub（第三方凭据与端点覆盖读取自环境变量）
+func BuiltinLoader(db *gorm.DB, mailer *utils.Mailer) ProviderLoader {
+	return func(ctx context.Context) ([]AuthProvider, error) {
+		return []AuthProvider{
+			NewEmailProvider(db, mailer),
+			NewPhoneProvider(db),
+			NewGoogleProvider(
+				db,
+				os.Getenv("GOOGLE_CLIENT_ID"),
+				os.Getenv("GOOGLE_CLIENT_SECRET"),
+				os.Getenv("GOOGLE_REDIRECT_URI"),
+				baseURLOptionsFromEnv(map[string]string{
+					"GOOGLE_ACCOUNTS_BASE_URL": GoogleBaseAccounts,
+					"GOOGLE_OAUTH2_BASE_URL":   GoogleBaseOAuth2,
+					"GOOGLE_API_BASE_URL":      GoogleBaseAPI,
+				})...,
+			),
+			NewWeChatProvider(
+				db,
+				os.Getenv("WECHAT_APP_ID"),
+				os.Getenv("WECHAT_APP_SECRET"),
+				os.Getenv("WECHAT_REDIRECT_URI"),
+				baseURLOptionsFromEnv(map[string]string{
+					"WECHAT_OPEN_BASE_URL": WeChatBaseOpen,
+					"WECHAT_API_BASE_URL":  WeChatBaseAPI,
+				})...,
+			),
+			NewWeChatOfficialAccountProvider(
+				db,
+				os.Getenv("WECHAT_OA_APP_ID"),
+				os.Getenv("WECHAT_OA_APP_SECRET"),
+				os.Getenv("WECHAT_OA_REDIRECT_URI"),
+				os.Getenv("WECHAT_OA_SCOPE"),
+				baseURLOptionsFromEnv(map[string]string{
+					"WECHAT_OPEN_BASE_URL": WeChatBaseOpen,
+					"WECHAT_API_BASE_URL":  WeChatBaseAPI,
+				})...,
+			),
+			NewWeChatMiniProgramProvider(
+				db,
+				os.Getenv("WECHAT_MINI_APP_ID"),
+				os.Getenv("WECHAT_MINI_APP_SECRET"),
+				baseURLOptionsFromEnv(map[string]string{
+					"WECHAT_API_BASE_URL": WeChatBaseAPI,
+				})...,
+			),
+			NewGitHubProvider(db),
+		}, nil
+	}
+}
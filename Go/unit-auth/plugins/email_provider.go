@@ -64,6 +64,9 @@ func (ep *EmailProvider) Authenticate(ctx context.Context, credentials map[strin
 	if !user.CheckPassword(password) {
 		return nil, errors.New("invalid email or password")
 	}
+	if user.PasswordResetRequired {
+		return nil, errors.New("password reset required")
+	}
 
 	// 更新最后登录时间
 	now := time.Now()
@@ -0,0 +1,558 @@
+// Package fakeprovider 本地 fake OAuth 服务，模拟 Google、GitHub、微信与通用 OIDC 的授权、令牌与用户信息端点，
+// 配合各提供者的基础地址覆盖即可在无外网环境下完整跑通 OAuth 登录流程。
+package fakeprovider
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 授权码与访问令牌有效期
+const (
+	codeTTL  = 5 * time.Minute
+	tokenTTL = time.Hour
+)
+
+// User fake 服务返回的第三方用户
+type User struct {
+	ID            int64
+	Login         string
+	Name          string
+	Email         string
+	EmailVerified bool
+	Picture       string
+	OpenID        string // 微信 openid，留空时按 appid + ID 生成（与微信一致：不同应用 openid 不同）
+	UnionID       string // 微信 unionid，同一用户在所有应用下相同
+}
+
+// Subject 字符串形式的用户 ID（Google / OIDC 的 sub）
+func (u User) Subject() string {
+	return strconv.FormatInt(u.ID, 10)
+}
+
+func (u User) openID(appID string) string {
+	if u.OpenID != "" {
+		return u.OpenID
+	}
+	return "fake-openid-" + appID + "-" + u.Subject()
+}
+
+// grant 已签发的授权码
+type grant struct {
+	user          User
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	scope         string
+	expiresAt     time.Time
+}
+
+// Server fake OAuth 服务
+type Server struct {
+	mu         sync.Mutex
+	user       User
+	baseURL    string
+	codes      map[string]*grant
+	tokens     map[string]User
+	key        *rsa.PrivateKey
+	kid        string
+	sessionKey []byte // 小程序 session_key
+}
+
+// New 创建 fake 服务，默认用户为已验证邮箱的 fake@example.com
+func New() *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return &Server{
+		user: User{
+			ID:            10001,
+			Login:         "fakeuser",
+			Name:          "Fake User",
+			Email:         "fake@example.com",
+			EmailVerified: true,
+			Picture:       "https://example.com/avatar.png",
+			UnionID:       "fake-unionid-10001",
+		},
+		codes:      map[string]*grant{},
+		tokens:     map[string]User{},
+		key:        key,
+		kid:        "fake-" + randomToken(6),
+		sessionKey: randomBytes(16),
+	}
+}
+
+// SetUser 设置后续授权返回的用户
+func (s *Server) SetUser(u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = u
+}
+
+// SetBaseURL 指定对外地址（OIDC issuer 基于此生成），未设置时按请求 Host 推断
+func (s *Server) SetBaseURL(baseURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// Handler 返回 fake 服务的全部路由
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// Google
+	mux.HandleFunc("/o/oauth2/v2/auth", s.authorize("client_id"))
+	mux.HandleFunc("/token", s.token(s.writeGoogleToken))
+	mux.HandleFunc("/oauth2/v2/userinfo", s.userinfo(googleProfile))
+
+	// GitHub（API 同时挂在根路径与 GitHub Enterprise 的 /api/v3 下）
+	mux.HandleFunc("/login/oauth/authorize", s.authorize("client_id"))
+	mux.HandleFunc("/login/oauth/access_token", s.token(s.writeGitHubToken))
+	for _, prefix := range []string{"", "/api/v3"} {
+		mux.HandleFunc(prefix+"/user", s.userinfo(githubProfile))
+		mux.HandleFunc(prefix+"/user/emails", s.userinfo(githubEmails))
+	}
+
+	// 微信开放平台（网站应用扫码、公众号网页授权、小程序登录）
+	mux.HandleFunc("/connect/qrconnect", s.authorize("appid"))
+	mux.HandleFunc("/connect/oauth2/authorize", s.authorize("appid"))
+	mux.HandleFunc("/sns/jscode2session", s.jscode2session)
+	mux.HandleFunc("/sns/oauth2/access_token", s.token(s.writeWeChatToken))
+	mux.HandleFunc("/sns/oauth2/refresh_token", s.wechatRefresh)
+	mux.HandleFunc("/sns/userinfo", s.userinfo(wechatProfile))
+	mux.HandleFunc("/sns/auth", s.userinfo(func(User, *http.Request) interface{} {
+		return map[string]interface{}{"errcode": 0, "errmsg": "ok"}
+	}))
+
+	// 通用 OIDC（issuer = {base}/oidc）
+	mux.HandleFunc("/oidc/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/oidc/jwks", s.jwks)
+	mux.HandleFunc("/oidc/authorize", s.authorize("client_id"))
+	mux.HandleFunc("/oidc/token", s.token(s.writeOIDCToken))
+	mux.HandleFunc("/oidc/userinfo", s.userinfo(oidcProfile))
+
+	return mux
+}
+
+// ListenAndServe 在指定地址启动 fake 服务
+func (s *Server) ListenAndServe(addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// Start 以 httptest 方式启动 fake 服务（调用方负责 Close）
+func (s *Server) Start() *httptest.Server {
+	ts := httptest.NewServer(s.Handler())
+	s.SetBaseURL(ts.URL)
+	return ts
+}
+
+// Issuer 通用 OIDC 的 issuer 地址
+func (s *Server) Issuer(r *http.Request) string {
+	return s.base(r) + "/oidc"
+}
+
+// Authorize 模拟浏览器访问授权地址，返回回调中的 code 与 state（不跟随重定向）
+func Authorize(client *http.Client, authURL string) (code, state string, err error) {
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := c.Get(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	loc, err := resp.Location()
+	if err != nil {
+		return "", "", err
+	}
+	q := loc.Query()
+	if e := q.Get("error"); e != "" {
+		return "", "", fmt.Errorf("authorize failed: %s", e)
+	}
+	return q.Get("code"), q.Get("state"), nil
+}
+
+func (s *Server) base(r *http.Request) string {
+	s.mu.Lock()
+	base := s.baseURL
+	s.mu.Unlock()
+	if base != "" {
+		return base
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// authorize 自动同意授权，重定向回 redirect_uri 并带上 code / state
+func (s *Server) authorize(clientParam string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		redirectURI := q.Get("redirect_uri")
+		target, err := url.Parse(redirectURI)
+		if redirectURI == "" || err != nil || !target.IsAbs() {
+			http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+			return
+		}
+		if q.Get("code_challenge") != "" && q.Get("code_challenge_method") != "S256" {
+			http.Error(w, "only S256 code_challenge_method is supported", http.StatusBadRequest)
+			return
+		}
+
+		code := randomToken(16)
+		s.mu.Lock()
+		s.codes[code] = &grant{
+			user:          s.user,
+			clientID:      q.Get(clientParam),
+			redirectURI:   redirectURI,
+			codeChallenge: q.Get("code_challenge"),
+			nonce:         q.Get("nonce"),
+			scope:         q.Get("scope"),
+			expiresAt:     time.Now().Add(codeTTL),
+		}
+		s.mu.Unlock()
+
+		values := target.Query()
+		values.Set("code", code)
+		values.Set("state", q.Get("state"))
+		target.RawQuery = values.Encode()
+		// 微信授权地址以 #wechat_redirect 结尾，回调不应带 fragment
+		target.Fragment = ""
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	}
+}
+
+// token 校验授权码（一次性、redirect_uri、PKCE）后交由各提供者格式输出令牌
+func (s *Server) token(write func(http.ResponseWriter, *http.Request, *grant, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, "invalid_request", err.Error())
+			return
+		}
+		code := r.Form.Get("code")
+
+		s.mu.Lock()
+		g, ok := s.codes[code]
+		delete(s.codes, code)
+		s.mu.Unlock()
+
+		switch {
+		case !ok || time.Now().After(g.expiresAt):
+			writeOAuthError(w, "invalid_grant", "authorization code is invalid, expired or already used")
+			return
+		case r.Form.Get("redirect_uri") != "" && r.Form.Get("redirect_uri") != g.redirectURI:
+			writeOAuthError(w, "invalid_grant", "redirect_uri mismatch")
+			return
+		case g.codeChallenge != "" && !verifyPKCE(g.codeChallenge, r.Form.Get("code_verifier")):
+			writeOAuthError(w, "invalid_grant", "code_verifier mismatch")
+			return
+		}
+
+		accessToken := randomToken(24)
+		s.mu.Lock()
+		s.tokens[accessToken] = g.user
+		s.mu.Unlock()
+		write(w, r, g, accessToken)
+	}
+}
+
+func (s *Server) writeGoogleToken(w http.ResponseWriter, r *http.Request, g *grant, accessToken string) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"refresh_token": randomToken(24),
+		"expires_in":    int(tokenTTL.Seconds()),
+		"token_type":    "Bearer",
+		"scope":         "openid email profile",
+	})
+}
+
+func (s *Server) writeGitHubToken(w http.ResponseWriter, r *http.Request, g *grant, accessToken string) {
+	body := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "bearer",
+		"scope":        "read:user,user:email",
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "json") {
+		// 与 GitHub 一致：未声明 Accept: application/json 时返回表单编码
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		w.Write([]byte(url.Values{
+			"access_token": {accessToken},
+			"token_type":   {"bearer"},
+			"scope":        {"read:user,user:email"},
+		}.Encode()))
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Server) writeWeChatToken(w http.ResponseWriter, r *http.Request, g *grant, accessToken string) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"expires_in":    7200,
+		"refresh_token": randomToken(24),
+		"openid":        g.user.openID(g.clientID),
+		"scope":         g.scope,
+		"unionid":       g.user.UnionID,
+	})
+}
+
+// jscode2session 小程序登录：任意非空 js_code 均视为当前用户
+func (s *Server) jscode2session(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("js_code") == "" || q.Get("appid") == "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"errcode": 40029, "errmsg": "invalid code"})
+		return
+	}
+	s.mu.Lock()
+	user := s.user
+	sessionKey := base64.StdEncoding.EncodeToString(s.sessionKey)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"openid":      user.openID(q.Get("appid")),
+		"session_key": sessionKey,
+		"unionid":     user.UnionID,
+	})
+}
+
+// MiniProgramPhone 按小程序 getPhoneNumber 的格式加密手机号（AES-128-CBC，session_key 为密钥），
+// 返回 base64 编码的 encryptedData 与 iv
+func (s *Server) MiniProgramPhone(appID, countryCode, purePhone string) (encryptedData, iv string, err error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"phoneNumber":     "+" + countryCode + purePhone,
+		"purePhoneNumber": purePhone,
+		"countryCode":     countryCode,
+		"watermark":       map[string]interface{}{"appid": appID, "timestamp": time.Now().Unix()},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	s.mu.Lock()
+	key := s.sessionKey
+	s.mu.Unlock()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", "", err
+	}
+	pad := aes.BlockSize - len(payload)%aes.BlockSize
+	payload = append(payload, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	ivBytes := randomBytes(aes.BlockSize)
+	out := make([]byte, len(payload))
+	cipher.NewCBCEncrypter(block, ivBytes).CryptBlocks(out, payload)
+	return base64.StdEncoding.EncodeToString(out), base64.StdEncoding.EncodeToString(ivBytes), nil
+}
+
+func (s *Server) writeOIDCToken(w http.ResponseWriter, r *http.Request, g *grant, accessToken string) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.Issuer(r),
+		"sub":            g.user.Subject(),
+		"aud":            g.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(tokenTTL).Unix(),
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"name":           g.user.Name,
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		writeOAuthError(w, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"refresh_token": randomToken(24),
+		"expires_in":    int(tokenTTL.Seconds()),
+		"token_type":    "Bearer",
+		"id_token":      idToken,
+	})
+}
+
+func (s *Server) wechatRefresh(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	user := s.user
+	accessToken := randomToken(24)
+	s.tokens[accessToken] = user
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"expires_in":    7200,
+		"refresh_token": r.URL.Query().Get("refresh_token"),
+		"openid":        user.openID(r.URL.Query().Get("appid")),
+		"scope":         "snsapi_login",
+	})
+}
+
+// userinfo 按访问令牌（Bearer 头或 access_token 参数）返回用户信息
+func (s *Server) userinfo(render func(User, *http.Request) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			if i := strings.IndexByte(auth, ' '); i > 0 {
+				token = auth[i+1:]
+			}
+		}
+		s.mu.Lock()
+		user, ok := s.tokens[token]
+		s.mu.Unlock()
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"error": "invalid_token", "errcode": 40001, "errmsg": "invalid access_token",
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, render(user, r))
+	}
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := s.Issuer(r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": s.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func googleProfile(u User, _ *http.Request) interface{} {
+	return map[string]interface{}{
+		"id":             u.Subject(),
+		"email":          u.Email,
+		"verified_email": u.EmailVerified,
+		"name":           u.Name,
+		"given_name":     u.Name,
+		"picture":        u.Picture,
+	}
+}
+
+func githubProfile(u User, _ *http.Request) interface{} {
+	return map[string]interface{}{
+		"id":         u.ID,
+		"login":      u.Login,
+		"name":       u.Name,
+		"avatar_url": u.Picture,
+		"email":      nil,
+	}
+}
+
+func githubEmails(u User, _ *http.Request) interface{} {
+	return []map[string]interface{}{{
+		"email":    u.Email,
+		"primary":  true,
+		"verified": u.EmailVerified,
+	}}
+}
+
+// wechatProfile openid 因应用而异，与微信一致原样返回请求中的 openid
+func wechatProfile(u User, r *http.Request) interface{} {
+	return map[string]interface{}{
+		"openid":     r.URL.Query().Get("openid"),
+		"nickname":   u.Name,
+		"sex":        0,
+		"province":   "",
+		"city":       "",
+		"country":    "CN",
+		"headimgurl": u.Picture,
+		"privilege":  []string{},
+		"unionid":    u.UnionID,
+	}
+}
+
+func oidcProfile(u User, _ *http.Request) interface{} {
+	return map[string]interface{}{
+		"sub":                u.Subject(),
+		"email":              u.Email,
+		"email_verified":     u.EmailVerified,
+		"name":               u.Name,
+		"preferred_username": u.Login,
+		"picture":            u.Picture,
+	}
+}
+
+func verifyPKCE(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func writeOAuthError(w http.ResponseWriter, code, desc string) {
+	// errcode / errmsg 兼容微信的错误格式
+	writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":             code,
+		"error_description": desc,
+		"errcode":           40029,
+		"errmsg":            desc,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomToken(n int) string {
+	return base64.RawURLEncoding.EncodeToString(randomBytes(n))
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
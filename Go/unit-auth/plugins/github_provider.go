@@ -11,7 +11,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	"unit-auth/models"
@@ -27,9 +26,30 @@ type GitHubProvider struct {
 	Secret   string
 	Redirect string
 	DB       *gorm.DB
+
+	opts *providerOptions
 }
 
-func NewGitHubProvider(db *gorm.DB) *GitHubProvider {
+// GitHub 端点组（可通过 WithBaseURL 覆盖，例如 GitHub Enterprise、出口代理或本地 fake 服务）
+const (
+	GitHubBaseWeb = "web" // 授权页与令牌交换
+	GitHubBaseAPI = "api" // REST API
+)
+
+// NewGitHubProvider 创建 GitHub 提供者；GITHUB_BASE_URL / GITHUB_API_BASE_URL 可覆盖默认地址，
+// 仅设置 GITHUB_BASE_URL 时按 GitHub Enterprise 约定使用 <base>/api/v3
+func NewGitHubProvider(db *gorm.DB, opts ...ProviderOption) *GitHubProvider {
+	defaults := map[string]string{
+		GitHubBaseWeb: "https://github.com",
+		GitHubBaseAPI: "https://api.github.com",
+	}
+	if base := strings.TrimRight(os.Getenv("GITHUB_BASE_URL"), "/"); base != "" {
+		defaults[GitHubBaseWeb] = base
+		defaults[GitHubBaseAPI] = base + "/api/v3"
+	}
+	if api := strings.TrimRight(os.Getenv("GITHUB_API_BASE_URL"), "/"); api != "" {
+		defaults[GitHubBaseAPI] = api
+	}
 	return &GitHubProvider{
 		Name:     "github",
 		Type:     "oauth",
@@ -38,6 +58,7 @@ func NewGitHubProvider(db *gorm.DB) *GitHubProvider {
 		Secret:   os.Getenv("GITHUB_CLIENT_SECRET"),
 		Redirect: os.Getenv("GITHUB_REDIRECT_URI"),
 		DB:       db,
+		opts:     newProviderOptions(defaults, opts),
 	}
 }
 
@@ -59,78 +80,62 @@ func (p *GitHubProvider) GetAuthURL(ctx context.Context, state string) (string,
 	params.Set("redirect_uri", p.Redirect)
 	params.Set("scope", "read:user user:email")
 	params.Set("state", state)
-	return fmt.Sprintf("https://github.com/login/oauth/authorize?%s", params.Encode()), nil
+	setAuthRequestParams(ctx, params)
+	return fmt.Sprintf("%s/login/oauth/authorize?%s", p.opts.baseURLs[GitHubBaseWeb], params.Encode()), nil
 }
 
+// SupportsPKCE GitHub OAuth App 支持 PKCE（S256）
+func (p *GitHubProvider) SupportsPKCE() bool { return true }
+
+// SupportsNonce GitHub 不是 OIDC 提供者
+func (p *GitHubProvider) SupportsNonce() bool { return false }
+
 func (p *GitHubProvider) HandleCallback(ctx context.Context, code string, state string) (*models.User, error) {
+	ext, err := p.FetchIdentity(ctx, code, state)
+	if err != nil {
+		return nil, err
+	}
+	// 邮箱仅在 GitHub 标记为 primary + verified 时返回，ResolveExternalIdentity 不会按未验证邮箱关联已有账号
+	return services.ResolveExternalIdentity(ctx, p.DB, ext)
+}
+
+// FetchIdentity 交换授权码并获取 GitHub 用户身份
+func (p *GitHubProvider) FetchIdentity(ctx context.Context, code string, state string) (*services.ExternalIdentity, error) {
 	if !p.IsEnabled() {
 		return nil, errors.New("github oauth not configured")
 	}
 
 	// 1) 交换 access_token
-	tokenResp, err := p.exchangeToken(code)
+	tokenResp, err := p.exchangeToken(ctx, code)
 	if err != nil {
 		return nil, err
 	}
 
 	// 2) 获取用户信息
-	ghUser, ghEmail, err := p.fetchGitHubUser(tokenResp.AccessToken)
+	ghUser, ghEmail, err := p.fetchGitHubUser(ctx, tokenResp.AccessToken)
 	if err != nil {
 		return nil, err
 	}
-	idStr := strconv.FormatInt(ghUser.ID, 10)
-
-	// 3) 用 github_id 或 email 查找/创建用户
-	var user models.User
-	if err := p.DB.Where("github_id = ?", idStr).First(&user).Error; err == nil {
-		return &user, nil
-	}
-
-	// 若未绑定，尝试用邮箱匹配
-	if ghEmail != "" {
-		if err := p.DB.Where("email = ?", ghEmail).First(&user).Error; err == nil {
-			user.GitHubID = ptr(idStr)
-			p.DB.Save(&user)
-			return &user, nil
-		}
-	}
-
-	// 创建用户（统一注册 + 可选项目映射）
-	emailPtr := (*string)(nil)
-	if ghEmail != "" {
-		emailPtr = &ghEmail
-	}
-	username := ghUser.Login
-
-	// 尝试从 gin context 读取项目Key（若存在）
-	ginCtx, _ := ctx.(*gin.Context)
-	projectKey := ""
-	if ginCtx != nil {
-		if v, ok := ginCtx.Get("project_key"); ok {
-			if s, ok2 := v.(string); ok2 {
-				projectKey = s
-			}
-		}
-	}
-
-	created, err := services.RegisterUser(p.DB, nil, services.RegistrationOptions{
-		Email:                emailPtr,
-		Username:             username,
-		Nickname:             ghUser.NameOrLogin(),
-		Role:                 "user",
-		Status:               "active",
-		SendWelcome:          false,
-		ProjectKey:           projectKey,
-		GinContext:           ginCtx,
-		StrictProjectMapping: projectKey != "",
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	created.GitHubID = ptr(idStr)
-	p.DB.Save(created)
-	return created, nil
+	if ghUser.ID == 0 {
+		return nil, errors.New("failed to get user info from github")
+	}
+
+	return &services.ExternalIdentity{
+		Provider:      p.Name,
+		Subject:       strconv.FormatInt(ghUser.ID, 10),
+		Email:         ghEmail,
+		EmailVerified: ghEmail != "",
+		Username:      ghUser.Login,
+		Nickname:      ghUser.NameOrLogin(),
+		Avatar:        ghUser.AvatarURL,
+		Profile: map[string]interface{}{
+			"id":         ghUser.ID,
+			"login":      ghUser.Login,
+			"name":       ghUser.Name,
+			"avatar_url": ghUser.AvatarURL,
+		},
+		AccessToken: tokenResp.AccessToken,
+	}, nil
 }
 
 // --- GitHub API helpers ---
@@ -142,9 +147,10 @@ type githubTokenResp struct {
 }
 
 type githubUserResp struct {
-	ID    int64  `json:"id"`
-	Login string `json:"login"`
-	Name  string `json:"name"`
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
 }
 
 func (g githubUserResp) NameOrLogin() string {
@@ -154,18 +160,19 @@ func (g githubUserResp) NameOrLogin() string {
 	return g.Login
 }
 
-func (p *GitHubProvider) exchangeToken(code string) (*githubTokenResp, error) {
+func (p *GitHubProvider) exchangeToken(ctx context.Context, code string) (*githubTokenResp, error) {
 	data := url.Values{}
 	data.Set("client_id", p.ClientID)
 	data.Set("client_secret", p.Secret)
 	data.Set("code", code)
 	data.Set("redirect_uri", p.Redirect)
+	setTokenRequestParams(ctx, data)
 
-	req, _ := http.NewRequest(http.MethodPost, "https://github.com/login/oauth/access_token", strings.NewReader(data.Encode()))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, p.opts.baseURLs[GitHubBaseWeb]+"/login/oauth/access_token", strings.NewReader(data.Encode()))
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.opts.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -181,11 +188,12 @@ func (p *GitHubProvider) exchangeToken(code string) (*githubTokenResp, error) {
 	return &tr, nil
 }
 
-func (p *GitHubProvider) fetchGitHubUser(token string) (githubUserResp, string, error) {
+func (p *GitHubProvider) fetchGitHubUser(ctx context.Context, token string) (githubUserResp, string, error) {
 	// user profile
-	req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/user", nil)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, p.opts.baseURLs[GitHubBaseAPI]+"/user", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err := http.DefaultClient.Do(req)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := p.opts.client.Do(req)
 	if err != nil {
 		return githubUserResp{}, "", err
 	}
@@ -196,9 +204,10 @@ func (p *GitHubProvider) fetchGitHubUser(token string) (githubUserResp, string,
 	}
 
 	// primary email
-	req2, _ := http.NewRequest(http.MethodGet, "https://api.github.com/user/emails", nil)
+	req2, _ := http.NewRequestWithContext(ctx, http.MethodGet, p.opts.baseURLs[GitHubBaseAPI]+"/user/emails", nil)
 	req2.Header.Set("Authorization", "Bearer "+token)
-	resp2, err := http.DefaultClient.Do(req2)
+	req2.Header.Set("Accept", "application/vnd.github+json")
+	resp2, err := p.opts.client.Do(req2)
 	if err != nil {
 		return githubUserResp{}, "", err
 	}
@@ -218,5 +227,3 @@ func (p *GitHubProvider) fetchGitHubUser(token string) (githubUserResp, string,
 	}
 	return gu, primary, nil
 }
-
-func ptr[T any](v T) *T { return &v }
@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 	"unit-auth/models"
+	"unit-auth/services"
 
 	"gorm.io/gorm"
 )
@@ -20,6 +22,20 @@ type GoogleProvider struct {
 	clientSecret string
 	redirectURI  string
 	enabled      bool
+	opts         *providerOptions
+}
+
+// Google 端点组（可通过 WithBaseURL 覆盖，用于出口代理或本地 fake 服务）
+const (
+	GoogleBaseAccounts = "accounts" // 授权页
+	GoogleBaseOAuth2   = "oauth2"   // 令牌交换
+	GoogleBaseAPI      = "api"      // 用户信息
+)
+
+var googleDefaultBaseURLs = map[string]string{
+	GoogleBaseAccounts: "https://accounts.google.com",
+	GoogleBaseOAuth2:   "https://oauth2.googleapis.com",
+	GoogleBaseAPI:      "https://www.googleapis.com",
 }
 
 // GoogleUserInfo Google用户信息
@@ -34,13 +50,14 @@ type GoogleUserInfo struct {
 }
 
 // NewGoogleProvider 创建Google认证提供者
-func NewGoogleProvider(db *gorm.DB, clientID, clientSecret, redirectURI string) *GoogleProvider {
+func NewGoogleProvider(db *gorm.DB, clientID, clientSecret, redirectURI string, opts ...ProviderOption) *GoogleProvider {
 	return &GoogleProvider{
 		db:           db,
 		clientID:     clientID,
 		clientSecret: clientSecret,
 		redirectURI:  redirectURI,
 		enabled:      clientID != "" && clientSecret != "",
+		opts:         newProviderOptions(googleDefaultBaseURLs, opts),
 	}
 }
 
@@ -61,33 +78,49 @@ func (gp *GoogleProvider) Authenticate(ctx context.Context, credentials map[stri
 }
 
 func (gp *GoogleProvider) GetAuthURL(ctx context.Context, state string) (string, error) {
-	url := fmt.Sprintf(
-		"https://accounts.google.com/o/oauth2/v2/auth?client_id=%s&redirect_uri=%s&response_type=code&scope=openid%%20email%%20profile&state=%s",
-		gp.clientID,
-		gp.redirectURI,
-		state,
-	)
-	return url, nil
+	params := url.Values{}
+	params.Set("client_id", gp.clientID)
+	params.Set("redirect_uri", gp.redirectURI)
+	params.Set("response_type", "code")
+	params.Set("scope", "openid email profile")
+	params.Set("state", state)
+	setAuthRequestParams(ctx, params)
+	return gp.opts.baseURLs[GoogleBaseAccounts] + "/o/oauth2/v2/auth?" + params.Encode(), nil
 }
 
+// SupportsPKCE Google 支持 PKCE
+func (gp *GoogleProvider) SupportsPKCE() bool { return true }
+
+// SupportsNonce 用户信息取自 userinfo 接口而非 ID Token，不使用 nonce
+func (gp *GoogleProvider) SupportsNonce() bool { return false }
+
 func (gp *GoogleProvider) HandleCallback(ctx context.Context, code string, state string) (*models.User, error) {
+	ext, err := gp.FetchIdentity(ctx, code, state)
+	if err != nil {
+		return nil, err
+	}
+	return services.ResolveExternalIdentity(ctx, gp.db, ext)
+}
+
+// FetchIdentity 交换授权码并获取 Google 用户身份
+func (gp *GoogleProvider) FetchIdentity(ctx context.Context, code string, state string) (*services.ExternalIdentity, error) {
 	// 交换授权码获取访问令牌
-	tokenURL := "https://oauth2.googleapis.com/token"
-	// data := fmt.Sprintf(
-	// 	"client_id=%s&client_secret=%s&code=%s&grant_type=authorization_code&redirect_uri=%s",
-	// 	gp.clientID,
-	// 	gp.clientSecret,
-	// 	code,
-	// 	gp.redirectURI,
-	// )
-
-	resp, err := http.PostForm(tokenURL, map[string][]string{
+	tokenURL := gp.opts.baseURLs[GoogleBaseOAuth2] + "/token"
+	form := url.Values{
 		"client_id":     {gp.clientID},
 		"client_secret": {gp.clientSecret},
 		"code":          {code},
 		"grant_type":    {"authorization_code"},
 		"redirect_uri":  {gp.redirectURI},
-	})
+	}
+	setTokenRequestParams(ctx, form)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := gp.opts.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -98,96 +131,73 @@ func (gp *GoogleProvider) HandleCallback(ctx context.Context, code string, state
 		return nil, err
 	}
 
-	var tokenResp map[string]interface{}
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
 	if err := json.Unmarshal(body, &tokenResp); err != nil {
 		return nil, err
 	}
-
-	accessToken, ok := tokenResp["access_token"].(string)
-	if !ok {
+	if tokenResp.AccessToken == "" {
 		return nil, errors.New("failed to get access token")
 	}
 
 	// 获取用户信息
-	userInfo, err := gp.getUserInfo(accessToken)
+	userInfo, raw, err := gp.getUserInfo(ctx, tokenResp.AccessToken)
 	if err != nil {
 		return nil, err
 	}
+	if userInfo.ID == "" {
+		return nil, errors.New("failed to get user info from google")
+	}
 
-	// 查找或创建用户
-	var user models.User
-	if err := gp.db.Where("google_id = ? OR email = ?", userInfo.ID, userInfo.Email).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// 创建新用户
-			user = models.User{
-				GoogleID:      &userInfo.ID,
-				Email:         &userInfo.Email,
-				Username:      userInfo.Email,
-				Nickname:      userInfo.Name,
-				EmailVerified: userInfo.VerifiedEmail,
-				Role:          "user",
-				Status:        "active",
-			}
-
-			// 设置头像到元数据
-			meta := &models.UserMeta{
-				Avatar: userInfo.Picture,
-			}
-			user.SetMeta(meta)
-			if err := gp.db.Create(&user).Error; err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
-	} else {
-		// 更新现有用户信息
-		user.GoogleID = &userInfo.ID
-		user.Nickname = userInfo.Name
-		user.EmailVerified = userInfo.VerifiedEmail
-
-		// 更新头像到元数据
-		meta, _ := user.GetMeta()
-		if meta == nil {
-			meta = &models.UserMeta{}
-		}
-		meta.Avatar = userInfo.Picture
-		user.SetMeta(meta)
-
-		gp.db.Save(&user)
-	}
-
-	// 更新最后登录时间
-	now := time.Now()
-	gp.db.Model(&user).Update("last_login_at", &now)
-
-	return &user, nil
+	ext := &services.ExternalIdentity{
+		Provider:      gp.GetName(),
+		Subject:       userInfo.ID,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.VerifiedEmail,
+		Nickname:      userInfo.Name,
+		Avatar:        userInfo.Picture,
+		Profile:       raw,
+		AccessToken:   tokenResp.AccessToken,
+		RefreshToken:  tokenResp.RefreshToken,
+	}
+	if userInfo.Email != "" {
+		ext.Username = strings.Split(userInfo.Email, "@")[0]
+	}
+	if tokenResp.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+		ext.ExpiresAt = &expiresAt
+	}
+	return ext, nil
 }
 
-func (gp *GoogleProvider) getUserInfo(accessToken string) (*GoogleUserInfo, error) {
-	req, err := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
+func (gp *GoogleProvider) getUserInfo(ctx context.Context, accessToken string) (*GoogleUserInfo, map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", gp.opts.baseURLs[GoogleBaseAPI]+"/oauth2/v2/userinfo", nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := gp.opts.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var userInfo GoogleUserInfo
 	if err := json.Unmarshal(body, &userInfo); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	var raw map[string]interface{}
+	_ = json.Unmarshal(body, &raw)
 
-	return &userInfo, nil
+	return &userInfo, raw, nil
 }
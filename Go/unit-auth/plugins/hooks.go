@@ -0,0 +1,100 @@
+package plugins
+
+import (
+	"context"
+	"unit-auth/models"
+)
+
+// 认证流程
+const (
+	FlowCredentials = "credentials" // Authenticate（账号密码、验证码等）
+	FlowCallback    = "callback"    // HandleCallback（OAuth回调）
+)
+
+// AuthAttempt 一次认证尝试，钩子可读取请求信息并写入附加声明
+type AuthAttempt struct {
+	Provider    string
+	Flow        string
+	Credentials map[string]interface{}
+	Code        string
+	State       string
+	IP          string
+	UserAgent   string
+
+	// Claims 后置钩子写入的附加声明（claim enrichment），由调用方写入签发的token
+	Claims map[string]interface{}
+}
+
+// SetClaim 写入附加声明
+func (a *AuthAttempt) SetClaim(key string, value interface{}) {
+	if a.Claims == nil {
+		a.Claims = map[string]interface{}{}
+	}
+	a.Claims[key] = value
+}
+
+// PreAuthHook 认证前钩子：返回错误即拒绝本次认证（例如风控、IP黑名单）
+type PreAuthHook func(ctx context.Context, attempt *AuthAttempt) error
+
+// PostAuthHook 认证后钩子：可补充声明；返回错误即拒绝本次登录（例如账号状态检查）
+type PostAuthHook func(ctx context.Context, attempt *AuthAttempt, user *models.User) error
+
+// UsePreAuth 追加认证前钩子（按注册顺序执行）
+func (pm *PluginManager) UsePreAuth(hooks ...PreAuthHook) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.preAuth = append(pm.preAuth, hooks...)
+}
+
+// UsePostAuth 追加认证后钩子（按注册顺序执行）
+func (pm *PluginManager) UsePostAuth(hooks ...PostAuthHook) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.postAuth = append(pm.postAuth, hooks...)
+}
+
+// Authenticate 经钩子链调用提供者的 Authenticate
+func (pm *PluginManager) Authenticate(ctx context.Context, attempt *AuthAttempt) (*models.User, error) {
+	attempt.Flow = FlowCredentials
+	return pm.runAuth(ctx, attempt, func(p AuthProvider) (*models.User, error) {
+		return p.Authenticate(ctx, attempt.Credentials)
+	})
+}
+
+// HandleCallback 经钩子链调用提供者的 HandleCallback
+func (pm *PluginManager) HandleCallback(ctx context.Context, attempt *AuthAttempt) (*models.User, error) {
+	attempt.Flow = FlowCallback
+	return pm.runAuth(ctx, attempt, func(p AuthProvider) (*models.User, error) {
+		return p.HandleCallback(ctx, attempt.Code, attempt.State)
+	})
+}
+
+func (pm *PluginManager) runAuth(ctx context.Context, attempt *AuthAttempt, call func(AuthProvider) (*models.User, error)) (*models.User, error) {
+	provider, err := pm.GetEnabledProvider(attempt.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.RLock()
+	preAuth := append([]PreAuthHook(nil), pm.preAuth...)
+	postAuth := append([]PostAuthHook(nil), pm.postAuth...)
+	pm.mu.RUnlock()
+
+	for _, hook := range preAuth {
+		if err := hook(ctx, attempt); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := call(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range postAuth {
+		if err := hook(ctx, attempt, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
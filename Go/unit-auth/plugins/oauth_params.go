@@ -0,0 +1,63 @@
+package plugins
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+)
+
+// OAuthParams 服务端 OAuth 事务参数（PKCE code_verifier、OIDC nonce），经 context 传给提供者
+type OAuthParams struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+	Scope        string // 调用方指定的授权范围（仅部分提供者支持，例如公众号 snsapi_base / snsapi_userinfo）
+}
+
+// OAuthCapabilities 可选能力：声明提供者支持的授权增强参数
+type OAuthCapabilities interface {
+	SupportsPKCE() bool
+	SupportsNonce() bool
+}
+
+type oauthParamsKey struct{}
+
+// WithOAuthParams 将事务参数写入 context
+func WithOAuthParams(ctx context.Context, params OAuthParams) context.Context {
+	return context.WithValue(ctx, oauthParamsKey{}, params)
+}
+
+// OAuthParamsFromContext 读取事务参数（未设置时返回零值）
+func OAuthParamsFromContext(ctx context.Context) OAuthParams {
+	if ctx == nil {
+		return OAuthParams{}
+	}
+	params, _ := ctx.Value(oauthParamsKey{}).(OAuthParams)
+	return params
+}
+
+// PKCEChallenge 计算 S256 code_challenge
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// setAuthRequestParams 向授权请求追加 code_challenge / nonce
+func setAuthRequestParams(ctx context.Context, values url.Values) {
+	params := OAuthParamsFromContext(ctx)
+	if params.CodeVerifier != "" {
+		values.Set("code_challenge", PKCEChallenge(params.CodeVerifier))
+		values.Set("code_challenge_method", "S256")
+	}
+	if params.Nonce != "" {
+		values.Set("nonce", params.Nonce)
+	}
+}
+
+// setTokenRequestParams 向令牌请求追加 code_verifier
+func setTokenRequestParams(ctx context.Context, values url.Values) {
+	if params := OAuthParamsFromContext(ctx); params.CodeVerifier != "" {
+		values.Set("code_verifier", params.CodeVerifier)
+	}
+}
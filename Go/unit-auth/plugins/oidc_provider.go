@@ -0,0 +1,569 @@
+package plugins
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"unit-auth/models"
+	"unit-auth/services"
+)
+
+// OIDCProvider 由 AuthProviderConfig 驱动的通用 OIDC/OAuth2 登录提供者
+type OIDCProvider struct {
+	db     *gorm.DB
+	config models.AuthProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	endpoints   *oidcEndpoints
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// oidcEndpoints 解析后的端点（发现结果 + 手动配置覆盖）
+type oidcEndpoints struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProfile 按声明映射提取后的用户资料
+type oidcProfile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Nickname      string
+	Avatar        string
+}
+
+type oidcTokenResp struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+	TokenType    string `json:"token_type"`
+	Error        string `json:"error"`
+	ErrorDesc    string `json:"error_description"`
+}
+
+// JWKS 刷新最小间隔，避免未知 kid 触发频繁拉取
+const jwksMinRefreshInterval = time.Minute
+
+// NewOIDCProvider 根据配置创建通用 OIDC 提供者
+func NewOIDCProvider(db *gorm.DB, config models.AuthProviderConfig, opts ...ProviderOption) *OIDCProvider {
+	return &OIDCProvider{
+		db:     db,
+		config: config,
+		client: newProviderOptions(nil, opts).client,
+	}
+}
+
+// OIDCConfigLoader 从数据库加载通用 OIDC/OAuth2 提供者配置
+func OIDCConfigLoader(db *gorm.DB) ProviderLoader {
+	return func(ctx context.Context) ([]AuthProvider, error) {
+		var configs []models.AuthProviderConfig
+		if err := db.WithContext(ctx).Find(&configs).Error; err != nil {
+			return nil, err
+		}
+		providers := make([]AuthProvider, 0, len(configs))
+		for _, cfg := range configs {
+			providers = append(providers, NewOIDCProvider(db, cfg))
+		}
+		return providers, nil
+	}
+}
+
+func (p *OIDCProvider) GetName() string { return p.config.Name }
+func (p *OIDCProvider) GetType() string { return "oauth" }
+
+func (p *OIDCProvider) IsEnabled() bool {
+	if !p.config.Enabled || p.config.ClientID == "" {
+		return false
+	}
+	return p.config.Issuer != "" || (p.config.AuthorizationURL != "" && p.config.TokenURL != "")
+}
+
+// Init 校验配置完整性（端点发现延迟到首次使用）
+func (p *OIDCProvider) Init(ctx context.Context) error {
+	if p.config.Enabled && !p.IsEnabled() {
+		return errors.New("client_id and issuer (or authorization/token endpoints) are required")
+	}
+	return nil
+}
+
+// HealthCheck 重新拉取发现文档与 JWKS，检查上游可达
+func (p *OIDCProvider) HealthCheck(ctx context.Context) error {
+	p.mu.Lock()
+	p.endpoints = nil
+	p.mu.Unlock()
+
+	ep, err := p.resolveEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+	if ep.JWKSURI != "" {
+		var set struct {
+			Keys []jwk `json:"keys"`
+		}
+		if err := p.getJSON(ctx, ep.JWKSURI, "", &set); err != nil {
+			return fmt.Errorf("fetch jwks failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close 不关闭 HTTP 客户端：客户端是共享的 utils.UpstreamHTTPClient 或由调用方注入，
+// 重新加载配置时关闭它会断开其他提供者与上游调用正在复用的连接
+func (p *OIDCProvider) Close() error {
+	return nil
+}
+
+// Config 返回提供者配置
+func (p *OIDCProvider) Config() models.AuthProviderConfig {
+	return p.config
+}
+
+func (p *OIDCProvider) Authenticate(ctx context.Context, credentials map[string]interface{}) (*models.User, error) {
+	return nil, fmt.Errorf("%s provider requires OAuth flow", p.config.Name)
+}
+
+func (p *OIDCProvider) GetAuthURL(ctx context.Context, state string) (string, error) {
+	if !p.IsEnabled() {
+		return "", fmt.Errorf("%s oauth not configured", p.config.Name)
+	}
+	ep, err := p.resolveEndpoints(ctx)
+	if err != nil {
+		return "", err
+	}
+	if ep.AuthorizationEndpoint == "" {
+		return "", errors.New("authorization endpoint not configured")
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURI)
+	params.Set("scope", strings.Join(p.config.GetScopes(), " "))
+	params.Set("state", state)
+	setAuthRequestParams(ctx, params)
+
+	sep := "?"
+	if strings.Contains(ep.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return ep.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// SupportsPKCE 通用提供者始终发送 PKCE（不支持的服务端会忽略该参数）
+func (p *OIDCProvider) SupportsPKCE() bool { return true }
+
+// SupportsNonce 请求 openid scope 时使用 nonce 绑定 ID Token
+func (p *OIDCProvider) SupportsNonce() bool {
+	for _, scope := range p.config.GetScopes() {
+		if scope == "openid" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *OIDCProvider) HandleCallback(ctx context.Context, code string, state string) (*models.User, error) {
+	ext, err := p.FetchIdentity(ctx, code, state)
+	if err != nil {
+		return nil, err
+	}
+	return services.ResolveExternalIdentity(ctx, p.db, ext)
+}
+
+// FetchIdentity 交换授权码、校验 ID Token 并按声明映射返回第三方身份
+func (p *OIDCProvider) FetchIdentity(ctx context.Context, code string, state string) (*services.ExternalIdentity, error) {
+	if !p.IsEnabled() {
+		return nil, fmt.Errorf("%s oauth not configured", p.config.Name)
+	}
+	ep, err := p.resolveEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1) 交换 token
+	tokenResp, err := p.exchangeCode(ctx, ep, code)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2) 校验 ID Token（若返回），再用 userinfo 补全声明；发起授权时带了 nonce 则必须返回 ID Token，
+	// 否则只剩 access_token + userinfo，nonce 绑定形同虚设
+	claims := map[string]interface{}{}
+	if tokenResp.IDToken == "" && OAuthParamsFromContext(ctx).Nonce != "" {
+		return nil, errors.New("missing id_token: nonce was requested")
+	}
+	if tokenResp.IDToken != "" {
+		idClaims, err := p.VerifyIDToken(ctx, tokenResp.IDToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id_token: %w", err)
+		}
+		// 发起授权时带了 nonce，ID Token 必须原样返回
+		if nonce := OAuthParamsFromContext(ctx).Nonce; nonce != "" {
+			if got, _ := idClaims["nonce"].(string); subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+				return nil, errors.New("invalid id_token: nonce mismatch")
+			}
+		}
+		claims = idClaims
+	}
+	if ep.UserinfoEndpoint != "" && tokenResp.AccessToken != "" {
+		info, err := p.fetchUserInfo(ctx, ep, tokenResp.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		// userinfo 的 sub 必须与 ID Token 一致
+		if sub, ok := claims["sub"]; ok {
+			if infoSub, ok := info["sub"]; ok && fmt.Sprint(infoSub) != fmt.Sprint(sub) {
+				return nil, errors.New("userinfo subject does not match id_token")
+			}
+		}
+		for k, v := range info {
+			if _, exists := claims[k]; !exists {
+				claims[k] = v
+			}
+		}
+	}
+	if len(claims) == 0 {
+		return nil, errors.New("provider returned neither id_token nor userinfo")
+	}
+
+	profile := p.mapProfile(claims)
+	if profile.Subject == "" {
+		return nil, errors.New("subject claim not found")
+	}
+
+	ext := &services.ExternalIdentity{
+		Provider:      p.config.Name,
+		Subject:       profile.Subject,
+		Email:         profile.Email,
+		EmailVerified: profile.EmailVerified,
+		Username:      profile.Username,
+		Nickname:      profile.Nickname,
+		Avatar:        profile.Avatar,
+		Profile:       claims,
+		AccessToken:   tokenResp.AccessToken,
+		RefreshToken:  tokenResp.RefreshToken,
+	}
+	if tokenResp.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+		ext.ExpiresAt = &expiresAt
+	}
+	return ext, nil
+}
+
+// VerifyIDToken 使用提供者 JWKS 校验 ID Token 的签名、iss、aud 与 exp
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken string) (map[string]interface{}, error) {
+	ep, err := p.resolveEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ep.JWKSURI == "" {
+		return nil, errors.New("jwks endpoint not configured")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithLeeway(time.Minute),
+	}
+	if ep.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(ep.Issuer))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.lookupKey(ctx, ep.JWKSURI, kid)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("id_token missing exp")
+	}
+	return claims, nil
+}
+
+// resolveEndpoints 解析端点：发现文档结果缓存，手动配置优先
+func (p *OIDCProvider) resolveEndpoints(ctx context.Context) (*oidcEndpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	ep := &oidcEndpoints{}
+	if p.config.Issuer != "" {
+		discoveryURL := strings.TrimRight(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := p.getJSON(ctx, discoveryURL, "", ep); err != nil {
+			// 手动端点齐全时允许发现失败
+			if p.config.AuthorizationURL == "" || p.config.TokenURL == "" {
+				return nil, fmt.Errorf("oidc discovery failed: %w", err)
+			}
+			ep = &oidcEndpoints{Issuer: p.config.Issuer}
+		}
+		if ep.Issuer == "" {
+			ep.Issuer = p.config.Issuer
+		}
+	}
+	if p.config.AuthorizationURL != "" {
+		ep.AuthorizationEndpoint = p.config.AuthorizationURL
+	}
+	if p.config.TokenURL != "" {
+		ep.TokenEndpoint = p.config.TokenURL
+	}
+	if p.config.UserInfoURL != "" {
+		ep.UserinfoEndpoint = p.config.UserInfoURL
+	}
+	if p.config.JWKSURL != "" {
+		ep.JWKSURI = p.config.JWKSURL
+	}
+	if ep.TokenEndpoint == "" {
+		return nil, errors.New("token endpoint not configured")
+	}
+
+	p.endpoints = ep
+	return ep, nil
+}
+
+func (p *OIDCProvider) exchangeCode(ctx context.Context, ep *oidcEndpoints, code string) (*oidcTokenResp, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", p.config.RedirectURI)
+	data.Set("client_id", p.config.ClientID)
+	data.Set("client_secret", p.config.ClientSecret)
+	setTokenRequestParams(ctx, data)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.TokenEndpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var tr oidcTokenResp
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if tr.Error != "" {
+		return nil, fmt.Errorf("token exchange failed: %s %s", tr.Error, tr.ErrorDesc)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("token exchange failed: status %d", resp.StatusCode)
+	}
+	if tr.AccessToken == "" && tr.IDToken == "" {
+		return nil, errors.New("empty access token")
+	}
+	return &tr, nil
+}
+
+func (p *OIDCProvider) fetchUserInfo(ctx context.Context, ep *oidcEndpoints, accessToken string) (map[string]interface{}, error) {
+	var info map[string]interface{}
+	if err := p.getJSON(ctx, ep.UserinfoEndpoint, accessToken, &info); err != nil {
+		return nil, fmt.Errorf("userinfo request failed: %w", err)
+	}
+	return info, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint, bearer string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d from %s", resp.StatusCode, endpoint)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// lookupKey 按 kid 查找公钥；未命中时刷新 JWKS（受最小间隔限制）
+func (p *OIDCProvider) lookupKey(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+	if !p.keysFetched.IsZero() && time.Since(p.keysFetched) < jwksMinRefreshInterval {
+		return nil, fmt.Errorf("signing key %q not found", kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, "", &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks failed: %w", err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("signing key %q not found", kid)
+}
+
+func (p *OIDCProvider) findKey(kid string) (interface{}, bool) {
+	if key, ok := p.keys[kid]; ok {
+		return key, true
+	}
+	// 未携带 kid 且只有一把密钥时直接使用
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// jwk JSON Web Key（仅支持 RSA 与 EC 公钥）
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// mapProfile 按声明映射提取用户资料，支持 a.b.c 形式的嵌套路径
+func (p *OIDCProvider) mapProfile(claims map[string]interface{}) *oidcProfile {
+	mapping := p.config.GetClaimMapping()
+	str := func(field string) string {
+		v := lookupClaim(claims, mapping[field])
+		switch val := v.(type) {
+		case nil:
+			return ""
+		case string:
+			return strings.TrimSpace(val)
+		case float64:
+			return fmt.Sprintf("%.0f", val)
+		default:
+			return fmt.Sprint(val)
+		}
+	}
+	verified := false
+	switch v := lookupClaim(claims, mapping["email_verified"]).(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+	return &oidcProfile{
+		Subject:       str("subject"),
+		Email:         strings.ToLower(str("email")),
+		EmailVerified: verified,
+		Username:      str("username"),
+		Nickname:      str("nickname"),
+		Avatar:        str("avatar"),
+	}
+}
+
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	var cur interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
@@ -0,0 +1,58 @@
+package plugins
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"unit-auth/utils"
+)
+
+// ProviderOption 内置 OAuth 提供者的可选配置（HTTP 客户端、端点基础地址）
+type ProviderOption func(*providerOptions)
+
+type providerOptions struct {
+	client   *http.Client
+	baseURLs map[string]string
+}
+
+// WithHTTPClient 指定提供者使用的 HTTP 客户端（默认 utils.UpstreamHTTPClient）
+func WithHTTPClient(client *http.Client) ProviderOption {
+	return func(o *providerOptions) {
+		o.client = client
+	}
+}
+
+// WithBaseURL 覆盖提供者某一端点组的基础地址（key 由各提供者定义，例如 github 的 "web" / "api"）
+func WithBaseURL(key, baseURL string) ProviderOption {
+	return func(o *providerOptions) {
+		if baseURL != "" {
+			o.baseURLs[key] = strings.TrimRight(baseURL, "/")
+		}
+	}
+}
+
+// newProviderOptions 合并默认基础地址与调用方覆盖
+func newProviderOptions(defaults map[string]string, opts []ProviderOption) *providerOptions {
+	o := &providerOptions{baseURLs: map[string]string{}}
+	for k, v := range defaults {
+		o.baseURLs[k] = v
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.client == nil {
+		o.client = utils.UpstreamHTTPClient()
+	}
+	return o
+}
+
+// baseURLOptionsFromEnv 从环境变量读取基础地址覆盖（env 名 -> 端点组 key）
+func baseURLOptionsFromEnv(envs map[string]string) []ProviderOption {
+	var opts []ProviderOption
+	for env, key := range envs {
+		if v := os.Getenv(env); v != "" {
+			opts = append(opts, WithBaseURL(key, v))
+		}
+	}
+	return opts
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"time"
 	"unit-auth/models"
+	"unit-auth/services"
+	"unit-auth/utils"
 
 	"gorm.io/gorm"
 )
@@ -45,6 +47,10 @@ func (pp *PhoneProvider) Authenticate(ctx context.Context, credentials map[strin
 	if !ok {
 		return nil, errors.New("verification code is required")
 	}
+	phone, err := services.NormalizeProjectPhone(pp.db, services.ProjectKeyFromContext(ctx), phone)
+	if err != nil {
+		return nil, err
+	}
 
 	// 验证短信验证码
 	var verification models.SMSVerification
@@ -60,7 +66,7 @@ func (pp *PhoneProvider) Authenticate(ctx context.Context, credentials map[strin
 			// 创建新用户
 			user = models.User{
 				Phone:         &phone,
-				Username:      phone,
+				Username:      utils.PhoneUsername(phone),
 				Nickname:      "手机用户",
 				PhoneVerified: true,
 				Role:          "user",
@@ -70,6 +76,7 @@ func (pp *PhoneProvider) Authenticate(ctx context.Context, credentials map[strin
 			if err := pp.db.Create(&user).Error; err != nil {
 				return nil, err
 			}
+			services.PublishUserEvent(pp.db, services.EventUserCreated, &user, "")
 		} else {
 			return nil, err
 		}
@@ -2,7 +2,14 @@ package plugins
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
 	"unit-auth/models"
+	"unit-auth/services"
 )
 
 // AuthProvider 认证提供者接口
@@ -26,41 +33,333 @@ type AuthProvider interface {
 	HandleCallback(ctx context.Context, code string, state string) (*models.User, error)
 }
 
-// PluginManager 插件管理器
+// Initializer 可选生命周期：注册时初始化
+type Initializer interface {
+	Init(ctx context.Context) error
+}
+
+// HealthChecker 可选生命周期：健康检查（例如上游可达性）
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// Closer 可选生命周期：被替换或移除时释放资源
+type Closer interface {
+	Close() error
+}
+
+// IdentityFetcher 可选能力：仅完成 OAuth 交换并返回第三方身份（不查找/创建用户），
+// 用于已登录用户显式绑定第三方账号
+type IdentityFetcher interface {
+	FetchIdentity(ctx context.Context, code string, state string) (*services.ExternalIdentity, error)
+}
+
+// 提供者来源
+const (
+	SourceStatic  = "static"  // 通过 RegisterProvider 直接注册
+	SourceBuiltin = "builtin" // 内置提供者（BuiltinLoader）
+	SourceConfig  = "config"  // 数据库提供者配置（OIDCConfigLoader）
+)
+
+// ProviderLoader 提供者加载器：返回某一来源的全部提供者，用于启动与热重载
+type ProviderLoader func(ctx context.Context) ([]AuthProvider, error)
+
+var (
+	ErrProviderNotFound = errors.New("authentication provider not available")
+	ErrProviderDisabled = errors.New("authentication provider is disabled")
+)
+
+// ProviderStatus 提供者运行状态
+type ProviderStatus struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Source     string `json:"source"`
+	Configured bool   `json:"configured"` // 提供者自身配置是否完整
+	Disabled   bool   `json:"disabled"`   // 运行时被管理员禁用
+	Enabled    bool   `json:"enabled"`    // 最终是否可用
+	InitError  string `json:"init_error,omitempty"`
+}
+
+// ReloadReport 重载结果
+type ReloadReport struct {
+	Loaded  []string          `json:"loaded"`
+	Removed []string          `json:"removed"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+type providerEntry struct {
+	provider  AuthProvider
+	source    string
+	initError string
+}
+
+// PluginManager 插件管理器（并发安全）
 type PluginManager struct {
-	providers map[string]AuthProvider
+	mu        sync.RWMutex
+	providers map[string]*providerEntry
+	disabled  map[string]bool
+	loaders   map[string]ProviderLoader
+	preAuth   []PreAuthHook
+	postAuth  []PostAuthHook
 }
 
 // NewPluginManager 创建新的插件管理器
 func NewPluginManager() *PluginManager {
 	return &PluginManager{
-		providers: make(map[string]AuthProvider),
+		providers: make(map[string]*providerEntry),
+		disabled:  make(map[string]bool),
+		loaders:   make(map[string]ProviderLoader),
 	}
 }
 
-// RegisterProvider 注册认证提供者
+// RegisterProvider 注册认证提供者（同名提供者会被替换并关闭）
 func (pm *PluginManager) RegisterProvider(provider AuthProvider) {
-	pm.providers[provider.GetName()] = provider
+	pm.registerProvider(provider, SourceStatic)
 }
 
-// GetProvider 获取认证提供者
+func (pm *PluginManager) registerProvider(provider AuthProvider, source string) string {
+	entry := &providerEntry{provider: provider, source: source}
+	if init, ok := provider.(Initializer); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := init.Init(ctx); err != nil {
+			entry.initError = err.Error()
+			log.Printf("Warning: provider %s init failed: %v", provider.GetName(), err)
+		}
+		cancel()
+	}
+
+	pm.mu.Lock()
+	old := pm.providers[provider.GetName()]
+	pm.providers[provider.GetName()] = entry
+	pm.mu.Unlock()
+
+	if old != nil && old.provider != provider {
+		closeProvider(old.provider)
+	}
+	return entry.initError
+}
+
+// UnregisterProvider 移除认证提供者
+func (pm *PluginManager) UnregisterProvider(name string) {
+	pm.mu.Lock()
+	old := pm.providers[name]
+	delete(pm.providers, name)
+	pm.mu.Unlock()
+
+	if old != nil {
+		closeProvider(old.provider)
+	}
+}
+
+// GetProvider 获取认证提供者（不论是否启用）
 func (pm *PluginManager) GetProvider(name string) (AuthProvider, bool) {
-	provider, exists := pm.providers[name]
-	return provider, exists
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	entry, exists := pm.providers[name]
+	if !exists {
+		return nil, false
+	}
+	return entry.provider, true
 }
 
-// GetEnabledProviders 获取所有启用的提供者
+// GetEnabledProvider 获取可用的认证提供者
+func (pm *PluginManager) GetEnabledProvider(name string) (AuthProvider, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	entry, exists := pm.providers[name]
+	if !exists {
+		return nil, ErrProviderNotFound
+	}
+	if pm.disabled[name] || !entry.provider.IsEnabled() {
+		return nil, ErrProviderDisabled
+	}
+	return entry.provider, nil
+}
+
+// GetEnabledProviders 获取所有启用的提供者（按名称排序）
 func (pm *PluginManager) GetEnabledProviders() []AuthProvider {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	var enabled []AuthProvider
-	for _, provider := range pm.providers {
-		if provider.IsEnabled() {
-			enabled = append(enabled, provider)
+	for name, entry := range pm.providers {
+		if !pm.disabled[name] && entry.provider.IsEnabled() {
+			enabled = append(enabled, entry.provider)
 		}
 	}
+	sort.Slice(enabled, func(i, j int) bool { return enabled[i].GetName() < enabled[j].GetName() })
 	return enabled
 }
 
-// GetAllProviders 获取所有提供者
+// GetAllProviders 获取所有提供者（返回副本）
 func (pm *PluginManager) GetAllProviders() map[string]AuthProvider {
-	return pm.providers
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	all := make(map[string]AuthProvider, len(pm.providers))
+	for name, entry := range pm.providers {
+		all[name] = entry.provider
+	}
+	return all
+}
+
+// SetProviderEnabled 运行时启用/禁用提供者
+func (pm *PluginManager) SetProviderEnabled(name string, enabled bool) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if _, exists := pm.providers[name]; !exists {
+		return ErrProviderNotFound
+	}
+	if enabled {
+		delete(pm.disabled, name)
+	} else {
+		pm.disabled[name] = true
+	}
+	return nil
+}
+
+// Statuses 获取所有提供者状态（按名称排序）
+func (pm *PluginManager) Statuses() []ProviderStatus {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	list := make([]ProviderStatus, 0, len(pm.providers))
+	for name, entry := range pm.providers {
+		configured := entry.provider.IsEnabled()
+		list = append(list, ProviderStatus{
+			Name:       name,
+			Type:       entry.provider.GetType(),
+			Source:     entry.source,
+			Configured: configured,
+			Disabled:   pm.disabled[name],
+			Enabled:    configured && !pm.disabled[name],
+			InitError:  entry.initError,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// HealthCheck 对实现了 HealthChecker 的提供者执行健康检查，返回 名称->错误信息（空表示健康）
+func (pm *PluginManager) HealthCheck(ctx context.Context) map[string]string {
+	providers := pm.GetAllProviders()
+	results := make(map[string]string, len(providers))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, provider := range providers {
+		checker, ok := provider.(HealthChecker)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, checker HealthChecker) {
+			defer wg.Done()
+			msg := ""
+			if err := checker.HealthCheck(ctx); err != nil {
+				msg = err.Error()
+			}
+			mu.Lock()
+			results[name] = msg
+			mu.Unlock()
+		}(name, checker)
+	}
+	wg.Wait()
+	return results
+}
+
+// AddLoader 注册提供者加载器
+func (pm *PluginManager) AddLoader(source string, loader ProviderLoader) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.loaders[source] = loader
+}
+
+// Reload 重新执行所有加载器
+func (pm *PluginManager) Reload(ctx context.Context) *ReloadReport {
+	pm.mu.RLock()
+	sources := make([]string, 0, len(pm.loaders))
+	for source := range pm.loaders {
+		sources = append(sources, source)
+	}
+	pm.mu.RUnlock()
+	sort.Strings(sources)
+
+	report := &ReloadReport{Errors: map[string]string{}}
+	for _, source := range sources {
+		r, err := pm.ReloadSource(ctx, source)
+		if err != nil {
+			report.Errors[source] = err.Error()
+			continue
+		}
+		report.Loaded = append(report.Loaded, r.Loaded...)
+		report.Removed = append(report.Removed, r.Removed...)
+		for k, v := range r.Errors {
+			report.Errors[k] = v
+		}
+	}
+	return report
+}
+
+// ReloadSource 重新执行指定来源的加载器：新增/替换其返回的提供者，移除该来源已不存在的提供者
+func (pm *PluginManager) ReloadSource(ctx context.Context, source string) (*ReloadReport, error) {
+	pm.mu.RLock()
+	loader, ok := pm.loaders[source]
+	pm.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown provider source %q", source)
+	}
+
+	providers, err := loader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReloadReport{Errors: map[string]string{}}
+	loaded := make(map[string]bool, len(providers))
+	for _, provider := range providers {
+		name := provider.GetName()
+		// 不允许覆盖其他来源的同名提供者
+		pm.mu.RLock()
+		existing := pm.providers[name]
+		pm.mu.RUnlock()
+		if existing != nil && existing.source != source {
+			report.Errors[name] = fmt.Sprintf("name already registered by source %q", existing.source)
+			continue
+		}
+		if initErr := pm.registerProvider(provider, source); initErr != "" {
+			report.Errors[name] = initErr
+		}
+		loaded[name] = true
+		report.Loaded = append(report.Loaded, name)
+	}
+
+	pm.mu.RLock()
+	var stale []string
+	for name, entry := range pm.providers {
+		if entry.source == source && !loaded[name] {
+			stale = append(stale, name)
+		}
+	}
+	pm.mu.RUnlock()
+	for _, name := range stale {
+		pm.UnregisterProvider(name)
+		report.Removed = append(report.Removed, name)
+	}
+	return report, nil
+}
+
+// Close 关闭所有提供者
+func (pm *PluginManager) Close() {
+	pm.mu.Lock()
+	providers := pm.providers
+	pm.providers = make(map[string]*providerEntry)
+	pm.mu.Unlock()
+	for _, entry := range providers {
+		closeProvider(entry.provider)
+	}
+}
+
+func closeProvider(provider AuthProvider) {
+	if closer, ok := provider.(Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Warning: provider %s close failed: %v", provider.GetName(), err)
+		}
+	}
 }
@@ -0,0 +1,213 @@
+package plugins
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"unit-auth/models"
+	"unit-auth/services"
+
+	"gorm.io/gorm"
+)
+
+// WeChatMiniProgramProvider 微信小程序登录（wx.login 的 code 经 code2session 换取 openid / unionid）
+type WeChatMiniProgramProvider struct {
+	db        *gorm.DB
+	appID     string
+	appSecret string
+	enabled   bool
+	opts      *providerOptions
+}
+
+// WeChatSession code2session 返回的会话信息（session_key 仅用于解密，不下发给客户端也不落库）
+type WeChatSession struct {
+	OpenID     string `json:"openid"`
+	UnionID    string `json:"unionid"`
+	SessionKey string `json:"session_key"`
+}
+
+// WeChatPhoneInfo getPhoneNumber 解密后的手机号
+type WeChatPhoneInfo struct {
+	PhoneNumber     string `json:"phoneNumber"`     // 带区号的手机号（境外号码有区号）
+	PurePhoneNumber string `json:"purePhoneNumber"` // 不带区号的手机号
+	CountryCode     string `json:"countryCode"`
+	Watermark       struct {
+		AppID     string `json:"appid"`
+		Timestamp int64  `json:"timestamp"`
+	} `json:"watermark"`
+}
+
+var (
+	ErrWeChatDecryptFailed = errors.New("failed to decrypt wechat data")
+	ErrWeChatAppIDMismatch = errors.New("wechat data watermark does not match app id")
+)
+
+// NewWeChatMiniProgramProvider 创建小程序登录提供者
+func NewWeChatMiniProgramProvider(db *gorm.DB, appID, appSecret string, opts ...ProviderOption) *WeChatMiniProgramProvider {
+	return &WeChatMiniProgramProvider{
+		db:        db,
+		appID:     appID,
+		appSecret: appSecret,
+		enabled:   appID != "" && appSecret != "",
+		opts:      newProviderOptions(wechatDefaultBaseURLs, opts),
+	}
+}
+
+func (p *WeChatMiniProgramProvider) GetName() string { return "wechat_mini" }
+func (p *WeChatMiniProgramProvider) GetType() string { return "miniprogram" }
+func (p *WeChatMiniProgramProvider) IsEnabled() bool { return p.enabled }
+
+// Authenticate credentials: code（wx.login），可选 encrypted_data + iv（getPhoneNumber）
+func (p *WeChatMiniProgramProvider) Authenticate(ctx context.Context, credentials map[string]interface{}) (*models.User, error) {
+	code, _ := credentials["code"].(string)
+	if code == "" {
+		return nil, errors.New("code is required")
+	}
+	session, err := p.Code2Session(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := &services.ExternalIdentity{
+		Provider: p.GetName(),
+		Subject:  session.OpenID,
+		Username: session.OpenID,
+		UnionID:  session.UnionID,
+		Profile: map[string]interface{}{
+			"openid":  session.OpenID,
+			"unionid": session.UnionID,
+		},
+	}
+	if nickname, _ := credentials["nickname"].(string); nickname != "" {
+		ext.Nickname = nickname
+		ext.Profile["nickname"] = nickname
+	}
+	if avatar, _ := credentials["avatar"].(string); avatar != "" {
+		ext.Avatar = avatar
+		ext.Profile["headimgurl"] = avatar
+	}
+
+	encryptedData, _ := credentials["encrypted_data"].(string)
+	iv, _ := credentials["iv"].(string)
+	if encryptedData != "" && iv != "" {
+		phone, err := p.DecryptPhoneNumber(session.SessionKey, encryptedData, iv)
+		if err != nil {
+			return nil, err
+		}
+		ext.Phone = WeChatPhone(phone)
+		ext.PhoneVerified = ext.Phone != ""
+	}
+
+	return services.ResolveExternalIdentity(ctx, p.db, ext)
+}
+
+func (p *WeChatMiniProgramProvider) GetAuthURL(ctx context.Context, state string) (string, error) {
+	return "", errors.New("wechat mini program login does not use an authorization URL")
+}
+
+func (p *WeChatMiniProgramProvider) HandleCallback(ctx context.Context, code string, state string) (*models.User, error) {
+	return nil, errors.New("wechat mini program login does not use OAuth callback; use Authenticate")
+}
+
+// Code2Session 使用 wx.login 返回的 code 换取 openid / unionid / session_key
+func (p *WeChatMiniProgramProvider) Code2Session(ctx context.Context, code string) (*WeChatSession, error) {
+	params := url.Values{}
+	params.Set("appid", p.appID)
+	params.Set("secret", p.appSecret)
+	params.Set("js_code", code)
+	params.Set("grant_type", "authorization_code")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.opts.baseURLs[WeChatBaseAPI]+"/sns/jscode2session?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.opts.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if err := wechatAPIError(body); err != nil {
+		return nil, err
+	}
+	var session WeChatSession
+	if err := json.Unmarshal(body, &session); err != nil {
+		return nil, err
+	}
+	if session.OpenID == "" || session.SessionKey == "" {
+		return nil, errors.New("failed to get session from wechat")
+	}
+	return &session, nil
+}
+
+// DecryptPhoneNumber 解密 getPhoneNumber 返回的 encryptedData 并校验水印中的 appid
+func (p *WeChatMiniProgramProvider) DecryptPhoneNumber(sessionKey, encryptedData, iv string) (*WeChatPhoneInfo, error) {
+	plain, err := DecryptWeChatData(sessionKey, encryptedData, iv)
+	if err != nil {
+		return nil, err
+	}
+	var info WeChatPhoneInfo
+	if err := json.Unmarshal(plain, &info); err != nil {
+		return nil, ErrWeChatDecryptFailed
+	}
+	if info.Watermark.AppID != p.appID {
+		return nil, ErrWeChatAppIDMismatch
+	}
+	return &info, nil
+}
+
+// DecryptWeChatData 小程序开放数据解密：AES-128-CBC，key 为 session_key，PKCS#7 填充，均为 base64 编码
+func DecryptWeChatData(sessionKey, encryptedData, iv string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil || len(key) != 16 {
+		return nil, ErrWeChatDecryptFailed
+	}
+	ivBytes, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil || len(ivBytes) != aes.BlockSize {
+		return nil, ErrWeChatDecryptFailed
+	}
+	data, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, ErrWeChatDecryptFailed
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrWeChatDecryptFailed
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, ivBytes).CryptBlocks(plain, data)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(plain) {
+		return nil, ErrWeChatDecryptFailed
+	}
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			return nil, ErrWeChatDecryptFailed
+		}
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+// WeChatPhone 转换为本系统存储的 E.164 手机号（+区号+号码）
+func WeChatPhone(info *WeChatPhoneInfo) string {
+	if info.PurePhoneNumber == "" {
+		return info.PhoneNumber
+	}
+	countryCode := info.CountryCode
+	if countryCode == "" {
+		countryCode = "86"
+	}
+	return fmt.Sprintf("+%s%s", countryCode, info.PurePhoneNumber)
+}
@@ -8,19 +8,44 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 	"unit-auth/models"
+	"unit-auth/services"
 
 	"gorm.io/gorm"
 )
 
-// WeChatProvider 微信OAuth认证提供者
+// WeChatProvider 微信OAuth认证提供者（网站应用扫码登录；公众号网页授权共用同一实现）
 type WeChatProvider struct {
 	db          *gorm.DB
+	name        string
 	appID       string
 	appSecret   string
 	redirectURI string
+	authPath    string // 授权页路径
+	scope       string // 默认授权范围
+	scopes      []string
 	enabled     bool
+	opts        *providerOptions
+}
+
+// 微信授权范围
+const (
+	WeChatScopeLogin    = "snsapi_login"    // 网站应用扫码登录
+	WeChatScopeBase     = "snsapi_base"     // 公众号静默授权，仅返回 openid（及已绑定开放平台时的 unionid）
+	WeChatScopeUserInfo = "snsapi_userinfo" // 公众号用户确认授权，可获取昵称头像
+)
+
+// 微信端点组（可通过 WithBaseURL 覆盖，用于出口代理或本地 fake 服务）
+const (
+	WeChatBaseOpen = "open" // 开放平台扫码授权页
+	WeChatBaseAPI  = "api"  // 接口服务
+)
+
+var wechatDefaultBaseURLs = map[string]string{
+	WeChatBaseOpen: "https://open.weixin.qq.com",
+	WeChatBaseAPI:  "https://api.weixin.qq.com",
 }
 
 // WeChatAccessToken 微信访问令牌响应
@@ -55,18 +80,43 @@ type WeChatQRCode struct {
 }
 
 // NewWeChatProvider 创建微信认证提供者
-func NewWeChatProvider(db *gorm.DB, appID, appSecret, redirectURI string) *WeChatProvider {
+func NewWeChatProvider(db *gorm.DB, appID, appSecret, redirectURI string, opts ...ProviderOption) *WeChatProvider {
 	return &WeChatProvider{
 		db:          db,
+		name:        "wechat",
 		appID:       appID,
 		appSecret:   appSecret,
 		redirectURI: redirectURI,
+		authPath:    "/connect/qrconnect",
+		scope:       WeChatScopeLogin,
+		scopes:      []string{WeChatScopeLogin},
 		enabled:     appID != "" && appSecret != "",
+		opts:        newProviderOptions(wechatDefaultBaseURLs, opts),
+	}
+}
+
+// NewWeChatOfficialAccountProvider 创建公众号网页授权提供者（微信内 H5），
+// scope 为默认授权范围，发起授权时可通过 OAuthParams.Scope 按次切换 snsapi_base / snsapi_userinfo
+func NewWeChatOfficialAccountProvider(db *gorm.DB, appID, appSecret, redirectURI, scope string, opts ...ProviderOption) *WeChatProvider {
+	if scope != WeChatScopeBase {
+		scope = WeChatScopeUserInfo
+	}
+	return &WeChatProvider{
+		db:          db,
+		name:        "wechat_oa",
+		appID:       appID,
+		appSecret:   appSecret,
+		redirectURI: redirectURI,
+		authPath:    "/connect/oauth2/authorize",
+		scope:       scope,
+		scopes:      []string{WeChatScopeBase, WeChatScopeUserInfo},
+		enabled:     appID != "" && appSecret != "",
+		opts:        newProviderOptions(wechatDefaultBaseURLs, opts),
 	}
 }
 
 func (wp *WeChatProvider) GetName() string {
-	return "wechat"
+	return wp.name
 }
 
 func (wp *WeChatProvider) GetType() string {
@@ -83,89 +133,98 @@ func (wp *WeChatProvider) Authenticate(ctx context.Context, credentials map[stri
 
 func (wp *WeChatProvider) GetAuthURL(ctx context.Context, state string) (string, error) {
 	// 微信OAuth2.0授权URL
-	authURL := "https://open.weixin.qq.com/connect/qrconnect"
+	authURL := wp.opts.baseURLs[WeChatBaseOpen] + wp.authPath
+	scope := wp.scope
+	if requested := OAuthParamsFromContext(ctx).Scope; requested != "" {
+		if !containsString(wp.scopes, requested) {
+			return "", fmt.Errorf("unsupported scope %q for %s", requested, wp.name)
+		}
+		scope = requested
+	}
 	params := url.Values{}
 	params.Set("appid", wp.appID)
 	params.Set("redirect_uri", wp.redirectURI)
 	params.Set("response_type", "code")
-	params.Set("scope", "snsapi_login")
+	params.Set("scope", scope)
 	params.Set("state", state)
 
 	return fmt.Sprintf("%s?%s#wechat_redirect", authURL, params.Encode()), nil
 }
 
+// SupportsPKCE 微信开放平台不支持 PKCE
+func (wp *WeChatProvider) SupportsPKCE() bool { return false }
+
+// SupportsNonce 微信不是 OIDC 提供者
+func (wp *WeChatProvider) SupportsNonce() bool { return false }
+
 func (wp *WeChatProvider) HandleCallback(ctx context.Context, code string, state string) (*models.User, error) {
-	// 1. 使用授权码获取访问令牌
-	accessToken, err := wp.getAccessToken(code)
+	ext, err := wp.FetchIdentity(ctx, code, state)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %v", err)
+		return nil, err
 	}
+	return services.ResolveExternalIdentity(ctx, wp.db, ext)
+}
 
-	// 2. 使用访问令牌获取用户信息
-	userInfo, err := wp.getUserInfo(accessToken.AccessToken, accessToken.OpenID)
+// FetchIdentity 交换授权码并获取微信用户身份（以 openid 作为 subject，unionid 用于跨应用合并）
+func (wp *WeChatProvider) FetchIdentity(ctx context.Context, code string, state string) (*services.ExternalIdentity, error) {
+	// 1. 使用授权码获取访问令牌
+	accessToken, err := wp.getAccessToken(ctx, code)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user info: %v", err)
+		return nil, fmt.Errorf("failed to get access token: %v", err)
 	}
 
-	// 3. 查找或创建用户
-	var user models.User
-	if err := wp.db.Where("wechat_id = ?", userInfo.OpenID).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// 创建新用户
-			user = models.User{
-				WeChatID:      &userInfo.OpenID,
-				Username:      userInfo.OpenID,
-				Nickname:      userInfo.Nickname,
-				EmailVerified: false,
-				PhoneVerified: false,
-				Role:          "user",
-				Status:        "active",
-			}
-
-			// 设置头像到元数据
-			meta := &models.UserMeta{
-				Avatar: userInfo.HeadImgURL,
-			}
-			user.SetMeta(meta)
-			if err := wp.db.Create(&user).Error; err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
+	// 2. 使用访问令牌获取用户信息（公众号静默授权无权调用 userinfo，仅有 openid / unionid）
+	userInfo := &WeChatUserInfo{OpenID: accessToken.OpenID, UnionID: accessToken.UnionID}
+	if !strings.Contains(accessToken.Scope, WeChatScopeBase) || strings.Contains(accessToken.Scope, WeChatScopeUserInfo) {
+		userInfo, err = wp.getUserInfo(ctx, accessToken.AccessToken, accessToken.OpenID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user info: %v", err)
 		}
-	} else {
-		// 更新现有用户信息
-		user.WeChatID = &userInfo.OpenID
-		user.Nickname = userInfo.Nickname
-
-		// 更新头像到元数据
-		meta, _ := user.GetMeta()
-		if meta == nil {
-			meta = &models.UserMeta{}
+		if userInfo.UnionID == "" {
+			userInfo.UnionID = accessToken.UnionID
 		}
-		meta.Avatar = userInfo.HeadImgURL
-		user.SetMeta(meta)
-
-		wp.db.Save(&user)
+	}
+	if userInfo.OpenID == "" {
+		return nil, errors.New("wechat returned an empty openid")
 	}
 
-	// 4. 更新最后登录时间
-	now := time.Now()
-	wp.db.Model(&user).Update("last_login_at", &now)
-
-	return &user, nil
+	ext := &services.ExternalIdentity{
+		Provider: wp.GetName(),
+		Subject:  userInfo.OpenID,
+		Username: userInfo.OpenID,
+		Nickname: userInfo.Nickname,
+		Avatar:   userInfo.HeadImgURL,
+		UnionID:  userInfo.UnionID,
+		Profile: map[string]interface{}{
+			"openid":     userInfo.OpenID,
+			"unionid":    userInfo.UnionID,
+			"nickname":   userInfo.Nickname,
+			"headimgurl": userInfo.HeadImgURL,
+			"province":   userInfo.Province,
+			"city":       userInfo.City,
+			"country":    userInfo.Country,
+			"scope":      accessToken.Scope,
+		},
+		AccessToken:  accessToken.AccessToken,
+		RefreshToken: accessToken.RefreshToken,
+	}
+	if accessToken.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(accessToken.ExpiresIn) * time.Second)
+		ext.ExpiresAt = &expiresAt
+	}
+	return ext, nil
 }
 
 // getAccessToken 获取微信访问令牌
-func (wp *WeChatProvider) getAccessToken(code string) (*WeChatAccessToken, error) {
-	tokenURL := "https://api.weixin.qq.com/sns/oauth2/access_token"
+func (wp *WeChatProvider) getAccessToken(ctx context.Context, code string) (*WeChatAccessToken, error) {
+	tokenURL := wp.opts.baseURLs[WeChatBaseAPI] + "/sns/oauth2/access_token"
 	params := url.Values{}
 	params.Set("appid", wp.appID)
 	params.Set("secret", wp.appSecret)
 	params.Set("code", code)
 	params.Set("grant_type", "authorization_code")
 
-	resp, err := http.PostForm(tokenURL, params)
+	resp, err := wp.postForm(ctx, tokenURL, params)
 	if err != nil {
 		return nil, err
 	}
@@ -198,14 +257,14 @@ func (wp *WeChatProvider) getAccessToken(code string) (*WeChatAccessToken, error
 }
 
 // getUserInfo 获取微信用户信息
-func (wp *WeChatProvider) getUserInfo(accessToken, openID string) (*WeChatUserInfo, error) {
-	userInfoURL := "https://api.weixin.qq.com/sns/userinfo"
+func (wp *WeChatProvider) getUserInfo(ctx context.Context, accessToken, openID string) (*WeChatUserInfo, error) {
+	userInfoURL := wp.opts.baseURLs[WeChatBaseAPI] + "/sns/userinfo"
 	params := url.Values{}
 	params.Set("access_token", accessToken)
 	params.Set("openid", openID)
 	params.Set("lang", "zh_CN")
 
-	resp, err := http.Get(userInfoURL + "?" + params.Encode())
+	resp, err := wp.get(ctx, userInfoURL+"?"+params.Encode())
 	if err != nil {
 		return nil, err
 	}
@@ -239,13 +298,13 @@ func (wp *WeChatProvider) getUserInfo(accessToken, openID string) (*WeChatUserIn
 
 // RefreshAccessToken 刷新访问令牌
 func (wp *WeChatProvider) RefreshAccessToken(refreshToken string) (*WeChatAccessToken, error) {
-	refreshURL := "https://api.weixin.qq.com/sns/oauth2/refresh_token"
+	refreshURL := wp.opts.baseURLs[WeChatBaseAPI] + "/sns/oauth2/refresh_token"
 	params := url.Values{}
 	params.Set("appid", wp.appID)
 	params.Set("grant_type", "refresh_token")
 	params.Set("refresh_token", refreshToken)
 
-	resp, err := http.PostForm(refreshURL, params)
+	resp, err := wp.postForm(context.Background(), refreshURL, params)
 	if err != nil {
 		return nil, err
 	}
@@ -270,12 +329,12 @@ func (wp *WeChatProvider) RefreshAccessToken(refreshToken string) (*WeChatAccess
 
 // CheckAccessToken 检查访问令牌是否有效
 func (wp *WeChatProvider) CheckAccessToken(accessToken, openID string) (bool, error) {
-	checkURL := "https://api.weixin.qq.com/sns/auth"
+	checkURL := wp.opts.baseURLs[WeChatBaseAPI] + "/sns/auth"
 	params := url.Values{}
 	params.Set("access_token", accessToken)
 	params.Set("openid", openID)
 
-	resp, err := http.Get(checkURL + "?" + params.Encode())
+	resp, err := wp.get(context.Background(), checkURL+"?"+params.Encode())
 	if err != nil {
 		return false, err
 	}
@@ -297,3 +356,41 @@ func (wp *WeChatProvider) CheckAccessToken(accessToken, openID string) (bool, er
 
 	return false, errors.New("invalid response from wechat API")
 }
+
+// wechatAPIError 解析微信接口的 errcode / errmsg（无错误时返回 nil）
+func wechatAPIError(body []byte) error {
+	var errorResp struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.ErrCode != 0 {
+		return fmt.Errorf("wechat API error: %d - %s", errorResp.ErrCode, errorResp.ErrMsg)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (wp *WeChatProvider) get(ctx context.Context, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	return wp.opts.client.Do(req)
+}
+
+func (wp *WeChatProvider) postForm(ctx context.Context, endpoint string, data url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return wp.opts.client.Do(req)
+}
@@ -26,6 +26,9 @@ func SetupMonitoringRoutes(r *gin.Engine, monitoringService *services.Monitoring
 		monitoring.GET("/user-activity/monthly", monitoringHandler.GetMonthlyActiveUsers)
 		monitoring.GET("/user-activity/top", monitoringHandler.GetTopActiveUsers)
 
+		// 项目接口调用统计
+		monitoring.GET("/projects", monitoringHandler.GetProjectClientStats)
+
 		// 系统健康状态
 		monitoring.GET("/health", monitoringHandler.GetSystemHealth)
 		monitoring.GET("/summary", monitoringHandler.GetMetricsSummary)
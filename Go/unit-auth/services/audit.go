@@ -0,0 +1,358 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unit-auth/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuditEntry 一条待记录的审计事件
+type AuditEntry struct {
+	ActorID    string // 操作者用户ID
+	Action     string // 动作，例如 user.update
+	Resource   string // 资源类型，例如 users
+	ResourceID string // 目标资源ID
+	Project    string
+	RequestID  string
+	IPAddress  string
+	UserAgent  string
+	Status     string // success, failed, denied
+	ErrorMsg   string
+	Before     interface{}            // 变更前快照（可选）
+	After      interface{}            // 变更后快照（可选）
+	Details    map[string]interface{} // 额外信息（可选）
+}
+
+// AuditFilter 审计日志查询条件
+type AuditFilter struct {
+	UserID     string
+	Action     string
+	Resource   string
+	ResourceID string
+	Project    string
+	Status     string
+	RequestID  string
+	IPAddress  string
+	StartDate  string
+	EndDate    string
+	Page       int
+	PageSize   int
+}
+
+// AuditChainReport 哈希链校验结果
+type AuditChainReport struct {
+	Valid        bool   `json:"valid"`
+	Checked      int64  `json:"checked"`
+	BrokenAtID   uint   `json:"broken_at_id,omitempty"`
+	BrokenReason string `json:"broken_reason,omitempty"`
+	LastHash     string `json:"last_hash"`
+}
+
+// AuditService 审计服务：只追加写入并维护哈希链
+type AuditService struct {
+	db *gorm.DB
+	mu sync.Mutex
+}
+
+// NewAuditService 创建审计服务
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record 写入一条审计日志
+func (s *AuditService) Record(entry AuditEntry) (*models.AuditLog, error) {
+	details := map[string]interface{}{}
+	for k, v := range entry.Details {
+		details[k] = v
+	}
+	if entry.Before != nil || entry.After != nil {
+		before := toAuditMap(entry.Before)
+		after := toAuditMap(entry.After)
+		if before != nil {
+			details["before"] = before
+		}
+		if after != nil {
+			details["after"] = after
+		}
+		if changes := DiffSnapshots(before, after); len(changes) > 0 {
+			details["changes"] = changes
+		}
+	}
+
+	status := entry.Status
+	if status == "" {
+		status = "success"
+	}
+
+	record := models.AuditLog{
+		UserID:     truncate(entry.ActorID, 36),
+		Action:     truncate(entry.Action, 100),
+		Resource:   truncate(entry.Resource, 100),
+		ResourceID: truncate(entry.ResourceID, 100),
+		Project:    truncate(entry.Project, 50),
+		IPAddress:  truncate(entry.IPAddress, 45),
+		UserAgent:  truncate(entry.UserAgent, 500),
+		Status:     truncate(status, 20),
+		ErrorMsg:   truncate(entry.ErrorMsg, 500),
+		RequestID:  truncate(entry.RequestID, 64),
+		// 数据库 created_at 可能只有秒级精度，哈希需与落库值一致
+		CreatedAt: time.Now().Truncate(time.Second),
+	}
+	if len(details) > 0 {
+		if err := record.SetDetails(details); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var last models.AuditLog
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "hash").Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		record.PrevHash = last.Hash
+		record.Hash = ComputeAuditHash(&record)
+		return tx.Omit("User").Create(&record).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ComputeAuditHash 计算审计日志哈希：sha256(prev_hash | 规范化字段)
+func ComputeAuditHash(l *models.AuditLog) string {
+	parts := []string{
+		l.PrevHash,
+		l.UserID,
+		l.Action,
+		l.Resource,
+		l.ResourceID,
+		l.Project,
+		canonicalJSON(l.Details),
+		l.IPAddress,
+		l.UserAgent,
+		l.Status,
+		l.ErrorMsg,
+		l.RequestID,
+		strconv.FormatInt(l.CreatedAt.Unix(), 10),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChain 按ID顺序校验整条哈希链，返回第一处断裂
+func (s *AuditService) VerifyChain() (*AuditChainReport, error) {
+	report := &AuditChainReport{Valid: true}
+	prev := ""
+	var batch []models.AuditLog
+	err := s.db.Model(&models.AuditLog{}).Order("id ASC").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			l := &batch[i]
+			report.Checked++
+			if l.PrevHash != prev {
+				report.Valid = false
+				report.BrokenAtID = l.ID
+				report.BrokenReason = "prev_hash mismatch (record removed or reordered)"
+				return errStopChain
+			}
+			if ComputeAuditHash(l) != l.Hash {
+				report.Valid = false
+				report.BrokenAtID = l.ID
+				report.BrokenReason = "hash mismatch (record modified)"
+				return errStopChain
+			}
+			prev = l.Hash
+		}
+		return nil
+	}).Error
+	if err != nil && err != errStopChain {
+		return nil, err
+	}
+	report.LastHash = prev
+	return report, nil
+}
+
+var errStopChain = errors.New("audit chain broken")
+
+// List 分页查询审计日志
+func (s *AuditService) List(f AuditFilter) ([]models.AuditLog, int64, error) {
+	query := s.applyFilter(s.db.Model(&models.AuditLog{}), f)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.PageSize < 1 || f.PageSize > 200 {
+		f.PageSize = 20
+	}
+
+	var logs []models.AuditLog
+	err := query.Preload("User").Order("id DESC").
+		Offset((f.Page - 1) * f.PageSize).Limit(f.PageSize).Find(&logs).Error
+	return logs, total, err
+}
+
+// ExportCSV 按条件导出审计日志为CSV（最多 limit 条）
+func (s *AuditService) ExportCSV(w io.Writer, f AuditFilter, limit int) error {
+	if limit <= 0 || limit > 100000 {
+		limit = 10000
+	}
+	var logs []models.AuditLog
+	if err := s.applyFilter(s.db.Model(&models.AuditLog{}), f).Order("id ASC").Limit(limit).Find(&logs).Error; err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	header := []string{"id", "created_at", "user_id", "action", "resource", "resource_id", "project",
+		"status", "error_msg", "ip_address", "user_agent", "request_id", "details", "prev_hash", "hash"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, l := range logs {
+		row := []string{
+			strconv.FormatUint(uint64(l.ID), 10),
+			l.CreatedAt.Format(time.RFC3339),
+			l.UserID,
+			l.Action,
+			l.Resource,
+			l.ResourceID,
+			l.Project,
+			l.Status,
+			l.ErrorMsg,
+			l.IPAddress,
+			l.UserAgent,
+			l.RequestID,
+			canonicalJSON(l.Details),
+			l.PrevHash,
+			l.Hash,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (s *AuditService) applyFilter(query *gorm.DB, f AuditFilter) *gorm.DB {
+	if f.UserID != "" {
+		query = query.Where("user_id = ?", f.UserID)
+	}
+	if f.Action != "" {
+		query = query.Where("action = ?", f.Action)
+	}
+	if f.Resource != "" {
+		query = query.Where("resource = ?", f.Resource)
+	}
+	if f.ResourceID != "" {
+		query = query.Where("resource_id = ?", f.ResourceID)
+	}
+	if f.Project != "" {
+		query = query.Where("project = ?", f.Project)
+	}
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.RequestID != "" {
+		query = query.Where("request_id = ?", f.RequestID)
+	}
+	if f.IPAddress != "" {
+		query = query.Where("ip_address = ?", f.IPAddress)
+	}
+	if f.StartDate != "" {
+		query = query.Where("created_at >= ?", f.StartDate)
+	}
+	if f.EndDate != "" {
+		query = query.Where("created_at <= ?", f.EndDate)
+	}
+	return query
+}
+
+// DiffSnapshots 比较两份快照，返回 {字段: {from, to}}
+func DiffSnapshots(before, after map[string]interface{}) map[string]interface{} {
+	changes := map[string]interface{}{}
+	for k, old := range before {
+		nv, ok := after[k]
+		if !ok {
+			if after != nil {
+				changes[k] = map[string]interface{}{"from": old, "to": nil}
+			}
+			continue
+		}
+		if !reflect.DeepEqual(old, nv) {
+			changes[k] = map[string]interface{}{"from": old, "to": nv}
+		}
+	}
+	for k, nv := range after {
+		if _, ok := before[k]; !ok && before != nil {
+			changes[k] = map[string]interface{}{"from": nil, "to": nv}
+		}
+	}
+	return changes
+}
+
+// toAuditMap 将任意结构体快照转为 map（走 JSON 序列化，尊重 json:"-"）
+func toAuditMap(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		return m
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// canonicalJSON 规范化JSON（键排序、数字格式统一），避免数据库JSON列重排导致哈希不一致
+func canonicalJSON(raw models.JSON) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return string(raw)
+	}
+	return string(data)
+}
+
+func truncate(s string, n int) string {
+	if len([]rune(s)) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unit-auth/utils"
+)
+
+// ErrCaptchaInvalid CAPTCHA 校验未通过
+var ErrCaptchaInvalid = errors.New("captcha verification failed")
+
+// CaptchaVerifier 人机验证（可插拔：hCaptcha、Cloudflare Turnstile、reCAPTCHA 等）
+type CaptchaVerifier interface {
+	// Provider 提供方名称，返回给前端以加载对应组件
+	Provider() string
+	// SiteKey 前端组件使用的公开 key
+	SiteKey() string
+	// Verify 校验前端提交的 token，失败时返回 ErrCaptchaInvalid
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// captchaVerifyURLs 兼容 siteverify 协议的服务商校验地址
+var captchaVerifyURLs = map[string]string{
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+}
+
+// SiteVerifyCaptcha siteverify 协议（表单提交 secret/response/remoteip，返回 success）的 CAPTCHA 校验
+type SiteVerifyCaptcha struct {
+	provider   string
+	siteKey    string
+	secret     string
+	verifyURL  string
+	httpClient *http.Client
+}
+
+// NewSiteVerifyCaptcha 创建 siteverify 协议的 CAPTCHA 校验器，verifyURL 为空时按 provider 选择
+func NewSiteVerifyCaptcha(provider, siteKey, secret, verifyURL string) (*SiteVerifyCaptcha, error) {
+	if verifyURL == "" {
+		verifyURL = captchaVerifyURLs[provider]
+	}
+	if verifyURL == "" {
+		return nil, fmt.Errorf("unknown captcha provider: %s", provider)
+	}
+	if secret == "" {
+		return nil, errors.New("captcha secret is required")
+	}
+	return &SiteVerifyCaptcha{
+		provider:   provider,
+		siteKey:    siteKey,
+		secret:     secret,
+		verifyURL:  verifyURL,
+		httpClient: utils.UpstreamHTTPClient(),
+	}, nil
+}
+
+// NewCaptchaVerifierFromEnv 按 CAPTCHA_PROVIDER 创建校验器，未配置时返回 nil（不做人机验证）
+func NewCaptchaVerifierFromEnv() CaptchaVerifier {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("CAPTCHA_PROVIDER")))
+	if provider == "" || provider == "none" {
+		return nil
+	}
+	verifier, err := NewSiteVerifyCaptcha(provider, os.Getenv("CAPTCHA_SITE_KEY"), os.Getenv("CAPTCHA_SECRET"), os.Getenv("CAPTCHA_VERIFY_URL"))
+	if err != nil {
+		log.Printf("Warning: captcha disabled: %v", err)
+		return nil
+	}
+	return verifier
+}
+
+func (v *SiteVerifyCaptcha) Provider() string { return v.provider }
+
+func (v *SiteVerifyCaptcha) SiteKey() string { return v.siteKey }
+
+// Verify 调用服务商 siteverify 接口
+func (v *SiteVerifyCaptcha) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrCaptchaInvalid
+	}
+	form := url.Values{}
+	form.Set("secret", v.secret)
+	form.Set("response", token)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("captcha siteverify returned %s", resp.Status)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("invalid captcha siteverify response: %w", err)
+	}
+	if !result.Success {
+		return ErrCaptchaInvalid
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"unit-auth/config"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDataChangeNotFound     = errors.New("data change not found")
+	ErrDataChangeNotRetryable = errors.New("only failed data changes can be retried")
+)
+
+var dataChangesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "data_changes_processed_total",
+	Help: "Total number of processed data changes by result (synced, retry, failed)",
+}, []string{"result"})
+
+// DataChangeHandler 处理一条数据变更（data_changes）；返回错误时整条变更按退避重试，处理器需保证幂等
+type DataChangeHandler func(ctx context.Context, db *gorm.DB, change *models.DataChange) error
+
+type dataChangeSubscriber struct {
+	name    string
+	table   string
+	handler DataChangeHandler
+}
+
+var (
+	dataChangeMu          sync.RWMutex
+	dataChangeSubscribers []dataChangeSubscriber
+)
+
+// OnDataChange 注册数据变更处理器；table 为空时处理所有表的变更
+func OnDataChange(name, table string, handler DataChangeHandler) {
+	dataChangeMu.Lock()
+	defer dataChangeMu.Unlock()
+	dataChangeSubscribers = append(dataChangeSubscribers, dataChangeSubscriber{name: name, table: table, handler: handler})
+}
+
+func dataChangeHandlers(table string) []dataChangeSubscriber {
+	dataChangeMu.RLock()
+	defer dataChangeMu.RUnlock()
+	var out []dataChangeSubscriber
+	for _, s := range dataChangeSubscribers {
+		if s.table == "" || s.table == table {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ChangeProcessorConfig 变更处理配置
+type ChangeProcessorConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxRetries   int           // 失败达到该次数后标记为 failed
+	RetryBase    time.Duration // 第 n 次失败后等待 RetryBase*2^(n-1)（带抖动），不超过 RetryMax
+	RetryMax     time.Duration
+	Lease        time.Duration // 处理中的变更在租约到期后可被重新领取
+	Retention    time.Duration // 已处理（synced）的变更保留时长，0 为不清理
+}
+
+// ChangeProcessor 数据变更处理：按 id 顺序领取 pending 的变更交给已注册的处理器，全部成功后标记为 synced，
+// 失败按指数退避重试，超过最大重试次数标记为 failed；同一记录存在更早未处理的变更时，后面的变更等待
+type ChangeProcessor struct {
+	db  *gorm.DB
+	cfg ChangeProcessorConfig
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// NewChangeProcessor 创建变更处理器
+func NewChangeProcessor(db *gorm.DB, cfg ChangeProcessorConfig) *ChangeProcessor {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 1
+	}
+	if cfg.RetryBase <= 0 {
+		cfg.RetryBase = 10 * time.Second
+	}
+	if cfg.RetryMax < cfg.RetryBase {
+		cfg.RetryMax = cfg.RetryBase
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 5 * time.Minute
+	}
+	return &ChangeProcessor{db: db, cfg: cfg, stop: make(chan struct{})}
+}
+
+// NewChangeProcessorFromConfig 按 CDC_* 配置创建变更处理器
+func NewChangeProcessorFromConfig(db *gorm.DB) *ChangeProcessor {
+	return NewChangeProcessor(db, ChangeProcessorConfig{
+		PollInterval: time.Duration(config.AppConfig.CDCPollSeconds) * time.Second,
+		MaxRetries:   config.AppConfig.CDCMaxRetries,
+		RetryMax:     time.Hour,
+		Retention:    time.Duration(config.AppConfig.CDCRetentionDays) * 24 * time.Hour,
+	})
+}
+
+// Start 启动处理协程
+func (p *ChangeProcessor) Start() {
+	log.Printf("🧾 启动数据变更处理: poll=%s max_retries=%d", p.cfg.PollInterval, p.cfg.MaxRetries)
+	p.wg.Add(1)
+	go p.run()
+}
+
+// Stop 停止领取新变更，等待当前变更处理完成
+func (p *ChangeProcessor) Stop() {
+	p.once.Do(func() { close(p.stop) })
+	p.wg.Wait()
+}
+
+func (p *ChangeProcessor) run() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		// 一批处理满时立即处理下一批
+		for p.processBatch() == p.cfg.BatchSize {
+			select {
+			case <-p.stop:
+				return
+			default:
+			}
+		}
+		if p.cfg.Retention > 0 && time.Since(lastCleanup) > time.Hour {
+			p.cleanup()
+			lastCleanup = time.Now()
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processBatch 处理一批到期的变更，返回读取到的条数
+func (p *ChangeProcessor) processBatch() int {
+	now := time.Now()
+	var changes []models.DataChange
+	err := p.db.Where("sync_status = ? AND (next_retry_at IS NULL OR next_retry_at <= ?)", models.ChangeSyncPending, now).
+		Where("NOT EXISTS (SELECT 1 FROM data_changes e WHERE e.table_name = data_changes.table_name AND e.record_id = data_changes.record_id AND e.sync_status = ? AND e.id < data_changes.id)", models.ChangeSyncPending).
+		Order("id ASC").Limit(p.cfg.BatchSize).Find(&changes).Error
+	if err != nil {
+		log.Printf("Warning: failed to query pending data changes: %v", err)
+		return 0
+	}
+	for i := range changes {
+		select {
+		case <-p.stop:
+			return 0
+		default:
+		}
+		if p.claim(&changes[i], now) {
+			p.process(&changes[i])
+		}
+	}
+	return len(changes)
+}
+
+// claim 条件更新领取变更（多实例部署时只有一个实例处理），租约期间不会被再次领取
+func (p *ChangeProcessor) claim(change *models.DataChange, now time.Time) bool {
+	res := p.db.Model(&models.DataChange{}).
+		Where("id = ? AND sync_status = ? AND (next_retry_at IS NULL OR next_retry_at <= ?)", change.ID, models.ChangeSyncPending, now).
+		Updates(map[string]interface{}{"last_retry_at": now, "next_retry_at": now.Add(p.cfg.Lease)})
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+func (p *ChangeProcessor) process(change *models.DataChange) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Lease)
+	defer cancel()
+
+	var failure error
+	for _, s := range dataChangeHandlers(change.TableName) {
+		if err := p.invoke(ctx, s, change); err != nil {
+			failure = fmt.Errorf("%s: %w", s.name, err)
+			break
+		}
+	}
+
+	if failure == nil {
+		dataChangesProcessed.WithLabelValues(models.ChangeSyncSynced).Inc()
+		if err := p.db.Model(change).Updates(map[string]interface{}{"sync_status": models.ChangeSyncSynced, "next_retry_at": nil, "last_error": ""}).Error; err != nil {
+			log.Printf("Warning: failed to mark data change %d synced: %v", change.ID, err)
+		}
+		return
+	}
+
+	retries := change.RetryCount + 1
+	updates := map[string]interface{}{"retry_count": retries, "last_error": truncate(failure.Error(), 1000)}
+	if retries >= p.cfg.MaxRetries {
+		dataChangesProcessed.WithLabelValues(models.ChangeSyncFailed).Inc()
+		updates["sync_status"] = models.ChangeSyncFailed
+		updates["next_retry_at"] = nil
+		log.Printf("Warning: data change %d (%s %s) failed after %d attempts: %v", change.ID, change.TableName, change.RecordID, retries, failure)
+	} else {
+		dataChangesProcessed.WithLabelValues("retry").Inc()
+		updates["next_retry_at"] = time.Now().Add(utils.ExpBackoffJitter(p.cfg.RetryBase, p.cfg.RetryMax, retries))
+	}
+	if err := p.db.Model(change).Updates(updates).Error; err != nil {
+		log.Printf("Warning: failed to update data change %d: %v", change.ID, err)
+	}
+}
+
+// invoke 调用处理器，处理器 panic 视为失败
+func (p *ChangeProcessor) invoke(ctx context.Context, s dataChangeSubscriber, change *models.DataChange) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.handler(ctx, p.db, change)
+}
+
+// cleanup 删除超过保留期的已处理变更（每次最多 5000 条）
+func (p *ChangeProcessor) cleanup() {
+	cutoff := time.Now().Add(-p.cfg.Retention)
+	res := p.db.Exec("DELETE FROM data_changes WHERE sync_status = ? AND created_at < ? LIMIT 5000", models.ChangeSyncSynced, cutoff)
+	if res.Error != nil {
+		log.Printf("Warning: failed to clean up data changes: %v", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("🧹 清理已处理的数据变更 %d 条", res.RowsAffected)
+	}
+}
+
+// Retry 将 failed 的变更重新放回队列
+func (p *ChangeProcessor) Retry(id uint) (*models.DataChange, error) {
+	res := p.db.Model(&models.DataChange{}).Where("id = ? AND sync_status = ?", id, models.ChangeSyncFailed).
+		Updates(map[string]interface{}{"sync_status": models.ChangeSyncPending, "retry_count": 0, "next_retry_at": nil})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	var change models.DataChange
+	if err := p.db.First(&change, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDataChangeNotFound
+		}
+		return nil, err
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrDataChangeNotRetryable
+	}
+	return &change, nil
+}
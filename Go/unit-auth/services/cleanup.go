@@ -3,6 +3,7 @@ package services
 import (
 	"log"
 	"time"
+	"unit-auth/config"
 	"unit-auth/models"
 
 	"gorm.io/gorm"
@@ -110,6 +111,13 @@ func (cs *CleanupService) CleanupExpiredVerifications() {
 		}
 	}
 
+	// 清理过期或已使用的OAuth授权事务
+	if oauthCount, err := NewOAuthTransactionService(cs.db).PurgeExpired(); err != nil {
+		log.Printf("❌ 清理过期OAuth授权事务失败: %v", err)
+	} else if oauthCount > 0 {
+		log.Printf("✅ 清理了 %d 条过期OAuth授权事务", oauthCount)
+	}
+
 	// 清理30天前的登录日志
 	var logCount int64
 	thirtyDaysAgo := time.Now().AddDate(0, 0, -30)
@@ -129,6 +137,50 @@ func (cs *CleanupService) CleanupExpiredVerifications() {
 		}
 	}
 
+	// 清理7天前已发送、30天前进入死信的发件箱消息（正文含验证码，不长期保留）
+	outboxResult := cs.db.Where("(status = ? AND sent_at < ?) OR (status = ? AND updated_at < ?)",
+		models.EmailOutboxSent, time.Now().AddDate(0, 0, -7), models.EmailOutboxDead, thirtyDaysAgo).
+		Delete(&models.EmailOutbox{})
+	if outboxResult.Error != nil {
+		log.Printf("❌ 清理邮件发件箱失败: %v", outboxResult.Error)
+	} else if outboxResult.RowsAffected > 0 {
+		log.Printf("✅ 清理了 %d 条邮件发件箱消息", outboxResult.RowsAffected)
+	}
+
+	// 清理30天前未完成的邮箱/手机号变更申请（已生效、已撤销的记录保留用于追溯）
+	contactResult := cs.db.Where("status IN ? AND created_at < ?",
+		[]string{models.ContactChangePending, models.ContactChangeCancelled}, thirtyDaysAgo).
+		Delete(&models.ContactChange{})
+	if contactResult.Error != nil {
+		log.Printf("❌ 清理邮箱/手机号变更申请失败: %v", contactResult.Error)
+	} else if contactResult.RowsAffected > 0 {
+		log.Printf("✅ 清理了 %d 条邮箱/手机号变更申请", contactResult.RowsAffected)
+	}
+
+	// 清理超过保留期的 Webhook 事件与已结束的投递记录（待投递的保留）
+	webhookBefore := time.Now().AddDate(0, 0, -config.AppConfig.WebhookRetentionDays)
+	webhookResult := cs.db.Where("status IN ? AND created_at < ?",
+		[]string{models.WebhookDeliverySucceeded, models.WebhookDeliveryDead}, webhookBefore).
+		Delete(&models.WebhookDelivery{})
+	if webhookResult.Error != nil {
+		log.Printf("❌ 清理 Webhook 投递记录失败: %v", webhookResult.Error)
+	} else if webhookResult.RowsAffected > 0 {
+		log.Printf("✅ 清理了 %d 条 Webhook 投递记录", webhookResult.RowsAffected)
+	}
+	if err := cs.db.Where("created_at < ?", webhookBefore).Delete(&models.WebhookEvent{}).Error; err != nil {
+		log.Printf("❌ 清理 Webhook 事件失败: %v", err)
+	}
+
+	// 清理30天前已完成或已撤销的项目开通任务（死信保留，需管理员处理）
+	provisioningResult := cs.db.Where("status IN ? AND updated_at < ?",
+		[]string{models.ProvisioningSucceeded, models.ProvisioningCancelled}, thirtyDaysAgo).
+		Delete(&models.ProjectProvisioning{})
+	if provisioningResult.Error != nil {
+		log.Printf("❌ 清理项目开通任务失败: %v", provisioningResult.Error)
+	} else if provisioningResult.RowsAffected > 0 {
+		log.Printf("✅ 清理了 %d 条项目开通任务", provisioningResult.RowsAffected)
+	}
+
 	log.Println("🧹 验证码清理完成")
 }
 
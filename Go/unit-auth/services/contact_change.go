@@ -0,0 +1,388 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"unit-auth/config"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"gorm.io/gorm"
+)
+
+// 变更渠道与来源
+const (
+	ContactChannelEmail = "email"
+	ContactChannelPhone = "phone"
+
+	ContactChangeSourceSelf  = "self"
+	ContactChangeSourceAdmin = "admin"
+)
+
+const (
+	contactChangeCodeTTL      = 10 * time.Minute
+	contactChangeMaxAttempts  = 5
+	contactChangeSMSCodeType  = "change_phone"
+	contactChangeMailCodeType = "change_email"
+)
+
+var (
+	ErrContactUnchanged             = errors.New("new value is the same as the current one")
+	ErrContactInUse                 = errors.New("already bound to another account")
+	ErrContactChangeNotFound        = errors.New("no pending change, request a new code")
+	ErrContactChangeExpired         = errors.New("verification code expired, request a new code")
+	ErrContactChangeInvalidCode     = errors.New("invalid verification code")
+	ErrContactChangeTooManyAttempts = errors.New("too many invalid attempts, request a new code")
+	ErrContactRevertInvalid         = errors.New("invalid or expired revert link")
+	ErrContactRevertSuperseded      = errors.New("the account has changed since, contact support to revert")
+)
+
+// ContactChangeService 邮箱 / 手机号变更：新地址验证码确认后生效并标记为已验证，
+// 旧地址收到带撤销链接的通知，变更结果推送到用户已映射的项目
+type ContactChangeService struct {
+	db     *gorm.DB
+	mailer *utils.Mailer
+	sms    SMSService
+}
+
+// NewContactChangeService 创建邮箱 / 手机号变更服务
+func NewContactChangeService(db *gorm.DB, mailer *utils.Mailer, sms SMSService) *ContactChangeService {
+	return &ContactChangeService{db: db, mailer: mailer, sms: sms}
+}
+
+// Start 发起变更：取消该渠道未完成的申请，向新地址发送验证码（newValue 需已规范化）
+func (s *ContactChangeService) Start(ctx context.Context, user *models.User, channel, newValue, ip string) (*models.ContactChange, error) {
+	oldValue, oldVerified := contactValue(user, channel)
+	if sameContact(channel, oldValue, newValue) {
+		return nil, ErrContactUnchanged
+	}
+	if s.contactInUse(s.db, channel, newValue, user.ID) {
+		return nil, ErrContactInUse
+	}
+
+	code := utils.GenerateVerificationCode()
+	change := &models.ContactChange{
+		UserID:      user.ID,
+		Channel:     channel,
+		OldValue:    oldValue,
+		NewValue:    newValue,
+		OldVerified: oldVerified,
+		Source:      ContactChangeSourceSelf,
+		ActorID:     user.ID,
+		Status:      models.ContactChangePending,
+		CodeHash:    hashContactSecret(code),
+		ExpiresAt:   time.Now().Add(contactChangeCodeTTL),
+		IPAddress:   ip,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ContactChange{}).
+			Where("user_id = ? AND channel = ? AND status = ?", user.ID, channel, models.ContactChangePending).
+			Update("status", models.ContactChangeCancelled).Error; err != nil {
+			return err
+		}
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if channel == ContactChannelEmail {
+		err = s.mailer.SendVerificationCode(EmailContextFor(s.db, ctx, oldValue), newValue, code, contactChangeMailCodeType)
+	} else {
+		err = s.sms.SendVerificationCode(newValue, code, contactChangeSMSCodeType)
+	}
+	if err != nil {
+		s.db.Model(change).Update("status", models.ContactChangeCancelled)
+		return nil, fmt.Errorf("failed to send verification code: %w", err)
+	}
+	return change, nil
+}
+
+// Confirm 校验新地址收到的验证码，通过后更新用户并通知旧地址
+func (s *ContactChangeService) Confirm(ctx context.Context, user *models.User, channel, code string) (*models.ContactChange, error) {
+	var change models.ContactChange
+	if err := s.db.Where("user_id = ? AND channel = ? AND status = ?", user.ID, channel, models.ContactChangePending).
+		Order("id DESC").First(&change).Error; err != nil {
+		return nil, ErrContactChangeNotFound
+	}
+	if time.Now().After(change.ExpiresAt) {
+		return nil, ErrContactChangeExpired
+	}
+	// 先原子占用一次尝试次数再比对验证码，并发请求也无法超过上限
+	res := s.db.Model(&models.ContactChange{}).
+		Where("id = ? AND status = ? AND attempts < ?", change.ID, models.ContactChangePending, contactChangeMaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrContactChangeTooManyAttempts
+	}
+	if subtle.ConstantTimeCompare([]byte(hashContactSecret(code)), []byte(change.CodeHash)) != 1 {
+		// 次数用尽时作废申请
+		if s.db.Model(&models.ContactChange{}).
+			Where("id = ? AND status = ? AND attempts >= ?", change.ID, models.ContactChangePending, contactChangeMaxAttempts).
+			UpdateColumn("status", models.ContactChangeCancelled).RowsAffected > 0 {
+			return nil, ErrContactChangeTooManyAttempts
+		}
+		return nil, ErrContactChangeInvalidCode
+	}
+
+	token, err := newRevertToken()
+	if err != nil {
+		return nil, err
+	}
+	err = models.WithActor(s.db, user.ID).Transaction(func(tx *gorm.DB) error {
+		// 只有仍处于 pending 的申请可以完成，避免并发确认重复生效
+		res := tx.Model(&change).Where("status = ?", models.ContactChangePending).
+			Updates(completedChangeUpdates(token))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrContactChangeNotFound
+		}
+		if s.contactInUse(tx, channel, change.NewValue, user.ID) {
+			return ErrContactInUse
+		}
+		before := user.ToResponse()
+		if err := tx.Model(user).Updates(contactUpdates(channel, change.NewValue, true)).Error; err != nil {
+			return err
+		}
+		return publishContactChange(tx, before, user.ID, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.First(&change, change.ID).Error; err != nil {
+		return nil, err
+	}
+
+	s.afterChange(ctx, user.ID, &change, token)
+	return &change, nil
+}
+
+// RecordAdminChange 记录管理员直接修改的邮箱 / 手机号（用户已保存、项目同步已由调用方写入），通知旧地址
+func (s *ContactChangeService) RecordAdminChange(ctx context.Context, userID, channel, oldValue, newValue string, oldVerified bool, actorID string) {
+	token, err := newRevertToken()
+	if err != nil {
+		log.Printf("Warning: failed to record %s change for user %s: %v", channel, userID, err)
+		return
+	}
+	now := time.Now()
+	revertExpiresAt := now.AddDate(0, 0, config.AppConfig.ContactChangeRevertDays)
+	change := &models.ContactChange{
+		UserID:          userID,
+		Channel:         channel,
+		OldValue:        oldValue,
+		NewValue:        newValue,
+		OldVerified:     oldVerified,
+		Source:          ContactChangeSourceAdmin,
+		ActorID:         actorID,
+		Status:          models.ContactChangeCompleted,
+		ExpiresAt:       now,
+		CompletedAt:     &now,
+		RevertTokenHash: hashContactSecret(token),
+		RevertExpiresAt: &revertExpiresAt,
+	}
+	if err := s.db.Create(change).Error; err != nil {
+		log.Printf("Warning: failed to record %s change for user %s: %v", channel, userID, err)
+		return
+	}
+	s.afterChange(ctx, userID, change, token)
+}
+
+// LookupRevert 查找撤销令牌对应的变更（用于展示确认页）
+func (s *ContactChangeService) LookupRevert(token string) (*models.ContactChange, error) {
+	var change models.ContactChange
+	if token == "" || s.db.Where("revert_token_hash = ? AND status = ?", hashContactSecret(token), models.ContactChangeCompleted).
+		First(&change).Error != nil {
+		return nil, ErrContactRevertInvalid
+	}
+	if change.RevertExpiresAt == nil || time.Now().After(*change.RevertExpiresAt) {
+		return nil, ErrContactRevertInvalid
+	}
+	return &change, nil
+}
+
+// Revert 由旧地址撤销变更：恢复旧值与原验证状态，取消该渠道未完成的申请，吊销用户的全部会话并要求重置密码
+func (s *ContactChangeService) Revert(ctx context.Context, token string) (*models.ContactChange, error) {
+	change, err := s.LookupRevert(token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", change.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		// 变更后又被修改过时不自动撤销，避免覆盖更新的数据
+		if current, _ := contactValue(&user, change.Channel); current != change.NewValue {
+			return ErrContactRevertSuperseded
+		}
+		if change.OldValue != "" && s.contactInUse(tx, change.Channel, change.OldValue, user.ID) {
+			return ErrContactInUse
+		}
+
+		now := time.Now()
+		res := tx.Model(change).Where("status = ?", models.ContactChangeCompleted).
+			Updates(map[string]interface{}{"status": models.ContactChangeReverted, "reverted_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrContactRevertInvalid
+		}
+		if err := tx.Model(&models.ContactChange{}).
+			Where("user_id = ? AND channel = ? AND status = ?", user.ID, change.Channel, models.ContactChangePending).
+			Update("status", models.ContactChangeCancelled).Error; err != nil {
+			return err
+		}
+		before := user.ToResponse()
+		updates := contactUpdates(change.Channel, change.OldValue, change.OldVerified)
+		// 变更可能来自盗用的账号：吊销所有已签发的令牌，并要求重置密码后才能密码登录
+		updates["tokens_revoked_at"] = now
+		updates["password_reset_required"] = true
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		Events.Publish(tx, UserEvent{Type: EventSessionRevoked, UserID: user.ID, Data: map[string]interface{}{
+			"reason": "contact_change_reverted",
+		}})
+		return publishContactChange(tx, before, user.ID, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// afterChange 变更生效后通知旧地址：邮箱变更通知旧邮箱；手机号变更短信通知旧号码并邮件通知账户邮箱
+func (s *ContactChangeService) afterChange(ctx context.Context, userID string, change *models.ContactChange, token string) {
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		log.Printf("Warning: failed to load user %s after %s change: %v", userID, change.Channel, err)
+		return
+	}
+
+	revertURL := ContactChangeRevertURL(token)
+	days := config.AppConfig.ContactChangeRevertDays
+	oldMasked, newMasked := MaskContactValue(change.Channel, change.OldValue), MaskContactValue(change.Channel, change.NewValue)
+
+	notifyEmail := change.OldValue
+	if change.Channel == ContactChannelPhone {
+		notifyEmail = user.ToResponse().Email
+		if change.OldValue != "" {
+			message := fmt.Sprintf("您的账户手机号已更换为 %s，如非本人操作请在 %d 天内撤销：%s", newMasked, days, revertURL)
+			if err := s.sms.SendNotification(change.OldValue, message); err != nil {
+				log.Printf("Warning: failed to notify old phone of user %s: %v", userID, err)
+			}
+		}
+	}
+	if notifyEmail != "" {
+		if err := s.mailer.SendContactChangedEmail(EmailContextFor(s.db, ctx, notifyEmail), notifyEmail, user.Username,
+			change.Channel, oldMasked, newMasked, revertURL, days); err != nil {
+			log.Printf("Warning: failed to send %s change notice for user %s: %v", change.Channel, userID, err)
+		}
+	}
+}
+
+// publishContactChange 在变更事务内发布 user.updated 并写入各项目的同步任务（重新读取用户以得到更新后的快照）
+func publishContactChange(tx *gorm.DB, before models.UserResponse, userID, actorID string) error {
+	var user models.User
+	if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	PublishUserChanges(tx, before, &user, actorID)
+	_, err := EnqueueUserSync(tx, models.ProvisioningUpdate, userID)
+	return err
+}
+
+// contactInUse 新地址是否已被其他账号使用
+func (s *ContactChangeService) contactInUse(db *gorm.DB, channel, value, userID string) bool {
+	var count int64
+	db.Model(&models.User{}).Where(channel+" = ? AND id != ?", value, userID).Count(&count)
+	return count > 0
+}
+
+// ContactChangeRevertURL 撤销链接（CONTACT_CHANGE_REVERT_URL?token=...）
+func ContactChangeRevertURL(token string) string {
+	base := config.AppConfig.ContactChangeRevertURL
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
+
+func contactValue(user *models.User, channel string) (string, bool) {
+	resp := user.ToResponse()
+	if channel == ContactChannelEmail {
+		return resp.Email, user.EmailVerified
+	}
+	return resp.Phone, user.PhoneVerified
+}
+
+func sameContact(channel, a, b string) bool {
+	if channel == ContactChannelEmail {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// contactUpdates 更新用户邮箱 / 手机号列与对应的验证状态，空值写为 NULL
+func contactUpdates(channel, value string, verified bool) map[string]interface{} {
+	var column interface{}
+	if value != "" {
+		column = value
+	}
+	return map[string]interface{}{channel: column, channel + "_verified": verified}
+}
+
+func completedChangeUpdates(token string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"status":            models.ContactChangeCompleted,
+		"completed_at":      now,
+		"code_hash":         "",
+		"revert_token_hash": hashContactSecret(token),
+		"revert_expires_at": now.AddDate(0, 0, config.AppConfig.ContactChangeRevertDays),
+	}
+}
+
+// MaskContactValue 邮箱 / 手机号脱敏展示，空值显示为 -
+func MaskContactValue(channel, value string) string {
+	if value == "" {
+		return "-"
+	}
+	if channel == ContactChannelEmail {
+		return utils.MaskEmail(value)
+	}
+	return utils.MaskPhone(value)
+}
+
+func newRevertToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashContactSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
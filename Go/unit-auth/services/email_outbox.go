@@ -0,0 +1,376 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unit-auth/config"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailOutboxNotFound     = errors.New("email outbox message not found")
+	ErrEmailOutboxNotRetryable = errors.New("only dead-lettered messages can be retried")
+)
+
+var (
+	emailOutboxEnqueuedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "email_outbox_enqueued_total",
+		Help: "Total number of emails written to the outbox",
+	})
+	emailSendTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_send_total",
+		Help: "Total number of email delivery attempts by transport and result (success, retry, dead)",
+	}, []string{"transport", "result"})
+	emailSendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "email_send_duration_seconds",
+		Help:    "Email transport send duration in seconds",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"transport"})
+	emailOutboxSuppressedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "email_outbox_suppressed_total",
+		Help: "Total number of notification emails skipped because the recipient unsubscribed",
+	})
+	emailOutboxDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "email_outbox_depth",
+		Help: "Number of outbox messages by status",
+	}, []string{"status"})
+	emailOutboxOldestPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "email_outbox_oldest_pending_seconds",
+		Help: "Age in seconds of the oldest pending outbox message",
+	})
+)
+
+// EmailOutboxConfig 发件箱 worker 与重试配置
+type EmailOutboxConfig struct {
+	Workers      int
+	MaxAttempts  int           // 达到后转入死信
+	RetryBase    time.Duration // 第 n 次失败后等待 RetryBase*2^(n-1)（带抖动），不超过 RetryMax
+	RetryMax     time.Duration
+	PollInterval time.Duration
+	Lease        time.Duration // worker 领取后的租约，超时未完成由其他 worker 重新领取
+	SendTimeout  time.Duration
+}
+
+// EmailOutbox 持久化邮件队列（实现 utils.EmailQueue）：请求中只写库，后台 worker 领取投递，
+// 失败按指数退避重试，超过次数或不可重试的错误进入死信；多实例部署时通过条件更新领取，不会重复投递
+type EmailOutbox struct {
+	db        *gorm.DB
+	transport utils.EmailTransport
+	cfg       EmailOutboxConfig
+
+	wake chan struct{}
+	jobs chan uint
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+
+	depthRefreshedAt time.Time
+}
+
+// NewEmailOutbox 创建发件箱
+func NewEmailOutbox(db *gorm.DB, transport utils.EmailTransport, cfg EmailOutboxConfig) *EmailOutbox {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.RetryBase <= 0 {
+		cfg.RetryBase = 30 * time.Second
+	}
+	if cfg.RetryMax < cfg.RetryBase {
+		cfg.RetryMax = cfg.RetryBase
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 2 * time.Minute
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = time.Minute
+	}
+	return &EmailOutbox{
+		db:        db,
+		transport: transport,
+		cfg:       cfg,
+		wake:      make(chan struct{}, 1),
+		jobs:      make(chan uint, cfg.Workers),
+		stop:      make(chan struct{}),
+	}
+}
+
+// NewEmailOutboxFromConfig 按 MAIL_QUEUE_WORKERS / MAIL_MAX_ATTEMPTS / MAIL_RETRY_* 创建发件箱
+func NewEmailOutboxFromConfig(db *gorm.DB, transport utils.EmailTransport) *EmailOutbox {
+	return NewEmailOutbox(db, transport, EmailOutboxConfig{
+		Workers:     config.AppConfig.MailQueueWorkers,
+		MaxAttempts: config.AppConfig.MailMaxAttempts,
+		RetryBase:   time.Duration(config.AppConfig.MailRetryBaseSeconds) * time.Second,
+		RetryMax:    time.Duration(config.AppConfig.MailRetryMaxSeconds) * time.Second,
+	})
+}
+
+// Enqueue 写入发件箱并唤醒调度，立即返回；收件人已退订的通知类邮件直接跳过
+func (o *EmailOutbox) Enqueue(ctx context.Context, email *utils.OutgoingEmail) error {
+	if email.MessageID == "" {
+		email.MessageID = uuid.NewString()
+	}
+	if !utils.IsTransactionalEmailTemplate(email.Template) {
+		var cnt int64
+		o.db.WithContext(ctx).Model(&models.EmailUnsubscribe{}).Where("email = ?", strings.ToLower(email.To)).Count(&cnt)
+		if cnt > 0 {
+			emailOutboxSuppressedTotal.Inc()
+			log.Printf("📭 %s 已退订通知邮件，跳过 %s", email.To, email.Template)
+			return nil
+		}
+	}
+	row := models.EmailOutbox{
+		MessageID:     email.MessageID,
+		ProjectKey:    email.ProjectKey,
+		Template:      email.Template,
+		FromAddress:   email.From,
+		FromName:      email.FromName,
+		ToAddress:     email.To,
+		Subject:       truncate(email.Subject, 255),
+		HTMLBody:      email.HTML,
+		TextBody:      email.Text,
+		Status:        models.EmailOutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := o.db.WithContext(ctx).Create(&row).Error; err != nil {
+		return err
+	}
+	emailOutboxEnqueuedTotal.Inc()
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start 启动调度协程与 worker
+func (o *EmailOutbox) Start() {
+	log.Printf("📮 启动邮件发件箱: transport=%s workers=%d max_attempts=%d", o.transport.Name(), o.cfg.Workers, o.cfg.MaxAttempts)
+	for i := 0; i < o.cfg.Workers; i++ {
+		o.wg.Add(1)
+		go o.worker()
+	}
+	o.wg.Add(1)
+	go o.dispatch()
+}
+
+// Stop 停止领取新消息，等待进行中的投递完成
+func (o *EmailOutbox) Stop() {
+	o.once.Do(func() { close(o.stop) })
+	o.wg.Wait()
+}
+
+func (o *EmailOutbox) dispatch() {
+	defer o.wg.Done()
+	defer close(o.jobs)
+
+	ticker := time.NewTicker(o.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		o.refreshDepth()
+		for _, id := range o.claim() {
+			select {
+			case o.jobs <- id:
+			case <-o.stop:
+				return
+			}
+		}
+		select {
+		case <-o.stop:
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+func (o *EmailOutbox) worker() {
+	defer o.wg.Done()
+	for id := range o.jobs {
+		o.deliver(id)
+	}
+}
+
+// dueCondition 到期的待投递消息，以及租约已过期的投递中消息（worker 异常退出）
+func (o *EmailOutbox) dueCondition(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)",
+		models.EmailOutboxPending, now, models.EmailOutboxSending, now)
+}
+
+// claim 领取一批到期消息：逐条条件更新为 sending，更新成功才算领取到
+func (o *EmailOutbox) claim() []uint {
+	now := time.Now()
+	var ids []uint
+	if err := o.dueCondition(o.db.Model(&models.EmailOutbox{}), now).
+		Order("next_attempt_at ASC").Limit(o.cfg.Workers*2).Pluck("id", &ids).Error; err != nil {
+		log.Printf("Warning: failed to poll email outbox: %v", err)
+		return nil
+	}
+
+	lockedUntil := now.Add(o.cfg.Lease)
+	claimed := ids[:0]
+	for _, id := range ids {
+		res := o.dueCondition(o.db.Model(&models.EmailOutbox{}).Where("id = ?", id), now).
+			Updates(map[string]interface{}{"status": models.EmailOutboxSending, "locked_until": lockedUntil})
+		if res.Error != nil {
+			log.Printf("Warning: failed to claim email outbox message %d: %v", id, res.Error)
+			continue
+		}
+		if res.RowsAffected == 1 {
+			claimed = append(claimed, id)
+		}
+	}
+	return claimed
+}
+
+func (o *EmailOutbox) deliver(id uint) {
+	var row models.EmailOutbox
+	if err := o.db.First(&row, id).Error; err != nil {
+		log.Printf("Warning: failed to load email outbox message %d: %v", id, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.cfg.SendTimeout)
+	defer cancel()
+	name := o.transport.Name()
+	start := time.Now()
+	err := o.transport.Send(ctx, &utils.OutgoingEmail{
+		MessageID:  row.MessageID,
+		ProjectKey: row.ProjectKey,
+		Template:   row.Template,
+		From:       row.FromAddress,
+		FromName:   row.FromName,
+		To:         row.ToAddress,
+		Subject:    row.Subject,
+		HTML:       row.HTMLBody,
+		Text:       row.TextBody,
+	})
+	emailSendDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"attempts":     row.Attempts + 1,
+		"transport":    name,
+		"locked_until": nil,
+	}
+	result := "success"
+	switch {
+	case err == nil:
+		updates["status"] = models.EmailOutboxSent
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+	case utils.IsPermanentEmailError(err) || row.Attempts+1 >= o.cfg.MaxAttempts:
+		result = "dead"
+		updates["status"] = models.EmailOutboxDead
+		updates["last_error"] = truncate(err.Error(), 500)
+		log.Printf("Warning: email %s to %s dead-lettered after %d attempts: %v", row.MessageID, row.ToAddress, row.Attempts+1, err)
+	default:
+		result = "retry"
+		delay := utils.ExpBackoffJitter(o.cfg.RetryBase, o.cfg.RetryMax, row.Attempts+1)
+		updates["status"] = models.EmailOutboxPending
+		updates["next_attempt_at"] = now.Add(delay)
+		updates["last_error"] = truncate(err.Error(), 500)
+		log.Printf("Warning: email %s to %s failed (attempt %d), retrying in %s: %v", row.MessageID, row.ToAddress, row.Attempts+1, delay.Round(time.Second), err)
+	}
+	emailSendTotal.WithLabelValues(name, result).Inc()
+
+	// 仅在仍持有租约时回写，避免覆盖租约过期后被其他 worker 重新领取的结果
+	if err := o.db.Model(&models.EmailOutbox{}).
+		Where("id = ? AND status = ? AND attempts = ?", row.ID, models.EmailOutboxSending, row.Attempts).
+		Updates(updates).Error; err != nil {
+		log.Printf("Warning: failed to update email outbox message %d: %v", row.ID, err)
+	}
+}
+
+// refreshDepth 更新队列深度指标（最多每 15 秒查询一次）
+func (o *EmailOutbox) refreshDepth() {
+	if time.Since(o.depthRefreshedAt) < 15*time.Second {
+		return
+	}
+	o.depthRefreshedAt = time.Now()
+	if _, err := o.Stats(); err != nil {
+		log.Printf("Warning: failed to refresh email outbox metrics: %v", err)
+	}
+}
+
+// Stats 各状态消息数与最早待投递消息的等待时间，同时刷新队列深度指标
+func (o *EmailOutbox) Stats() (map[string]interface{}, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := o.db.Model(&models.EmailOutbox{}).Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{
+		models.EmailOutboxPending: 0,
+		models.EmailOutboxSending: 0,
+		models.EmailOutboxSent:    0,
+		models.EmailOutboxDead:    0,
+	}
+	for _, r := range rows {
+		counts[r.Status] = r.Count
+	}
+	for _, status := range []string{models.EmailOutboxPending, models.EmailOutboxSending, models.EmailOutboxDead} {
+		emailOutboxDepth.WithLabelValues(status).Set(float64(counts[status]))
+	}
+
+	oldestPending := 0.0
+	var oldest models.EmailOutbox
+	if err := o.db.Select("created_at").Where("status = ?", models.EmailOutboxPending).Order("created_at ASC").Limit(1).Find(&oldest).Error; err == nil && !oldest.CreatedAt.IsZero() {
+		oldestPending = time.Since(oldest.CreatedAt).Seconds()
+	}
+	emailOutboxOldestPending.Set(oldestPending)
+
+	return map[string]interface{}{
+		"transport":              o.transport.Name(),
+		"workers":                o.cfg.Workers,
+		"max_attempts":           o.cfg.MaxAttempts,
+		"counts":                 counts,
+		"oldest_pending_seconds": int64(oldestPending),
+	}, nil
+}
+
+// Retry 将死信消息重新放回队列（重置重试次数）
+func (o *EmailOutbox) Retry(id uint) (*models.EmailOutbox, error) {
+	var row models.EmailOutbox
+	if err := o.db.First(&row, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEmailOutboxNotFound
+		}
+		return nil, err
+	}
+	if row.Status != models.EmailOutboxDead {
+		return nil, ErrEmailOutboxNotRetryable
+	}
+	now := time.Now()
+	res := o.db.Model(&models.EmailOutbox{}).Where("id = ? AND status = ?", id, models.EmailOutboxDead).
+		Updates(map[string]interface{}{"status": models.EmailOutboxPending, "attempts": 0, "next_attempt_at": now})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrEmailOutboxNotRetryable
+	}
+	row.Status, row.Attempts, row.NextAttemptAt = models.EmailOutboxPending, 0, now
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return &row, nil
+}
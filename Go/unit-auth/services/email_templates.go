@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"log"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NotificationTypeEmail 邮件通知模板类型
+const NotificationTypeEmail = "email"
+
+// EmailTemplateService 邮件模板覆盖与项目品牌（实现 utils.EmailTemplateResolver）
+type EmailTemplateService struct {
+	db *gorm.DB
+}
+
+// NewEmailTemplateService 创建邮件模板服务
+func NewEmailTemplateService(db *gorm.DB) *EmailTemplateService {
+	return &EmailTemplateService{db: db}
+}
+
+// ResolveEmailTemplate 查找最匹配的启用覆盖：项目优先于全局，语言精确匹配优先于不限语言
+func (s *EmailTemplateService) ResolveEmailTemplate(ec utils.EmailContext, key, locale string) (*utils.EmailTemplateOverride, utils.EmailBranding) {
+	brand := s.Branding(ec.ProjectKey)
+
+	var rows []models.NotificationTemplate
+	if err := s.db.Where("type = ? AND template_key = ? AND is_active = ? AND project_key IN ? AND locale IN ?",
+		NotificationTypeEmail, key, true, []string{ec.ProjectKey, ""}, []string{locale, ""}).
+		Find(&rows).Error; err != nil {
+		log.Printf("Warning: failed to load email template overrides for %s: %v", key, err)
+		return nil, brand
+	}
+	var best *models.NotificationTemplate
+	bestScore := -1
+	for i := range rows {
+		score := 0
+		if rows[i].ProjectKey != "" {
+			score += 2
+		}
+		if rows[i].Locale != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = &rows[i], score
+		}
+	}
+	if best == nil {
+		return nil, brand
+	}
+	return &utils.EmailTemplateOverride{Subject: best.Subject, HTML: best.Content, Text: best.TextContent}, brand
+}
+
+// Branding 项目品牌，未配置的字段使用全局配置
+func (s *EmailTemplateService) Branding(projectKey string) utils.EmailBranding {
+	brand := utils.DefaultEmailBranding()
+	if projectKey == "" {
+		return brand
+	}
+	var project models.Project
+	if err := s.db.Where("`key` = ?", projectKey).First(&project).Error; err != nil {
+		return brand
+	}
+	if project.EmailBrandName != "" {
+		brand.Name = project.EmailBrandName
+	}
+	if project.EmailSenderName != "" {
+		brand.SenderName = project.EmailSenderName
+	}
+	if project.EmailBrandColor != "" {
+		brand.Color = project.EmailBrandColor
+	}
+	if project.EmailLogoURL != "" {
+		brand.LogoURL = project.EmailLogoURL
+	}
+	return brand
+}
+
+// Preview 使用示例变量渲染模板；draft 非空时预览未保存的覆盖，否则预览当前生效的覆盖
+func (s *EmailTemplateService) Preview(ec utils.EmailContext, key string, draft *utils.EmailTemplateOverride, vars map[string]interface{}) (*utils.RenderedEmail, error) {
+	locale := utils.MatchEmailLocale(ec.Locale)
+	override, brand := s.ResolveEmailTemplate(ec, key, locale)
+	if draft != nil {
+		override = draft
+	}
+	data := utils.EmailTemplateSample(key)
+	for k, v := range vars {
+		data[k] = v
+	}
+	return utils.RenderEmailTemplate(key, locale, override, brand, data)
+}
+
+// EmailContextFor 邮件上下文：请求所属项目；语言优先取收件用户的 UserMeta.Language，其次为请求的 Accept-Language
+func EmailContextFor(db *gorm.DB, ctx context.Context, email string) utils.EmailContext {
+	ec := utils.EmailContext{ProjectKey: ProjectKeyFromContext(ctx)}
+	if email != "" {
+		var user models.User
+		if err := db.Select("meta").Where("email = ?", email).First(&user).Error; err == nil {
+			if meta, err := user.GetMeta(); err == nil && meta.Language != "" {
+				ec.Locale = meta.Language
+			}
+		}
+	}
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		if acceptLanguage := ginCtx.GetHeader("Accept-Language"); acceptLanguage != "" {
+			if ec.Locale != "" {
+				ec.Locale += ","
+			}
+			ec.Locale += acceptLanguage
+		}
+	}
+	return ec
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unit-auth/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 用户生命周期事件类型
+const (
+	EventUserCreated         = "user.created"
+	EventUserUpdated         = "user.updated"
+	EventUserDeleted         = "user.deleted"
+	EventUserStatusChanged   = "user.status_changed"
+	EventUserPasswordChanged = "user.password_changed"
+	EventSessionRevoked      = "session.revoked"
+	EventWebhookTest         = "webhook.test" // 仅用于管理员测试订阅，不会由总线发布
+)
+
+// UserEventTypes 可订阅的事件类型
+var UserEventTypes = []string{
+	EventUserCreated,
+	EventUserUpdated,
+	EventUserDeleted,
+	EventUserStatusChanged,
+	EventUserPasswordChanged,
+	EventSessionRevoked,
+}
+
+// IsUserEventType 是否为可订阅的事件类型
+func IsUserEventType(eventType string) bool {
+	for _, t := range UserEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// UserEvent 用户生命周期事件
+type UserEvent struct {
+	ID         string
+	Type       string
+	UserID     string
+	ActorID    string // 操作者（用户本人或管理员），系统触发时为空
+	OccurredAt time.Time
+	Data       map[string]interface{} // 作为 payload.data 下发
+}
+
+// EventUser 事件中的用户快照
+type EventUser struct {
+	ID            string `json:"id"`
+	Email         string `json:"email,omitempty"`
+	Phone         string `json:"phone,omitempty"` // E.164
+	Username      string `json:"username"`
+	Nickname      string `json:"nickname"`
+	Avatar        string `json:"avatar,omitempty"`
+	Status        string `json:"status"`
+	EmailVerified bool   `json:"email_verified"`
+	PhoneVerified bool   `json:"phone_verified"`
+}
+
+// NewEventUser 由用户生成事件快照
+func NewEventUser(user *models.User) EventUser {
+	resp := user.ToResponse()
+	return EventUser{
+		ID:            user.ID,
+		Email:         resp.Email,
+		Phone:         resp.Phone,
+		Username:      user.Username,
+		Nickname:      user.Nickname,
+		Avatar:        user.GetAvatar(),
+		Status:        user.Status,
+		EmailVerified: user.EmailVerified,
+		PhoneVerified: user.PhoneVerified,
+	}
+}
+
+// EventHandler 事件处理函数；db 为发布方的数据库句柄（可能是事务），处理函数的写入随发布方一起提交
+type EventHandler func(db *gorm.DB, event UserEvent) error
+
+// EventBus 进程内事件总线：发布时同步调用各处理函数（处理函数只应写库或入队，不应做网络请求）
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers []EventHandler
+}
+
+// NewEventBus 创建事件总线
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Events 默认事件总线（WebhookDispatcher 在启动时订阅）
+var Events = NewEventBus()
+
+// Subscribe 注册处理函数
+func (b *EventBus) Subscribe(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish 发布事件；处理失败只记录日志，不影响发布方
+func (b *EventBus) Publish(db *gorm.DB, event UserEvent) {
+	if event.ID == "" {
+		event.ID = "evt_" + uuid.NewString()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, handler := range handlers {
+		if err := handler(db, event); err != nil {
+			log.Printf("Warning: failed to handle event %s (%s) for user %s: %v", event.ID, event.Type, event.UserID, err)
+		}
+	}
+}
+
+// PublishUserEvent 发布携带用户快照的事件；changes 为变更的字段名（user.updated 时使用）
+func PublishUserEvent(db *gorm.DB, eventType string, user *models.User, actorID string, changes ...string) {
+	data := map[string]interface{}{"user": NewEventUser(user)}
+	if len(changes) > 0 {
+		data["changes"] = changes
+	}
+	Events.Publish(db, UserEvent{Type: eventType, UserID: user.ID, ActorID: actorID, Data: data})
+}
+
+// PublishUserChanges 比较变更前后的用户：状态变化发布 user.status_changed，其他字段变化发布 user.updated
+func PublishUserChanges(db *gorm.DB, before models.UserResponse, user *models.User, actorID string) {
+	after := user.ToResponse()
+	if before.Status != after.Status {
+		Events.Publish(db, UserEvent{Type: EventUserStatusChanged, UserID: user.ID, ActorID: actorID, Data: map[string]interface{}{
+			"user":            NewEventUser(user),
+			"previous_status": before.Status,
+		}})
+	}
+	if changes := ChangedUserFields(before, after); len(changes) > 0 {
+		PublishUserEvent(db, EventUserUpdated, user, actorID, changes...)
+	}
+}
+
+// ChangedUserFields 变更前后用户响应中不同的字段（json 名称，不含状态与登录统计）
+func ChangedUserFields(before, after models.UserResponse) []string {
+	var changes []string
+	bv, av := reflect.ValueOf(before), reflect.ValueOf(after)
+	t := bv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonFieldName(t.Field(i))
+		switch name {
+		case "", "status", "phone_display", "login_count", "last_login_at", "created_at":
+			continue
+		}
+		if !reflect.DeepEqual(bv.Field(i).Interface(), av.Field(i).Interface()) {
+			changes = append(changes, name)
+		}
+	}
+	return changes
+}
+
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"unit-auth/models"
+	"unit-auth/utils"
+)
+
+// ExternalIdentity 第三方提供者返回的身份信息（尚未关联本地用户）
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool // 提供者声明邮箱已验证
+	Username      string
+	Nickname      string
+	Avatar        string
+	Profile       map[string]interface{} // 原始资料
+
+	// 微信 UnionID（跨网站应用、公众号、小程序合并身份）
+	UnionID string
+	// 提供者返回的手机号（如小程序 getPhoneNumber 解密结果）
+	Phone         string
+	PhoneVerified bool
+
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    *time.Time
+}
+
+var (
+	ErrIdentityEmailConflict  = errors.New("an account with this email already exists; sign in and link this provider from your account settings")
+	ErrIdentityPhoneConflict  = errors.New("an account with this phone number already exists; sign in and link this provider from your account settings")
+	ErrPhoneInUse             = errors.New("phone number is already used by another account")
+	ErrIdentityAlreadyLinked  = errors.New("this provider account is already linked to another user")
+	ErrIdentityProviderLinked = errors.New("another account from this provider is already linked")
+	ErrIdentityNotFound       = errors.New("identity not found")
+	ErrLastLoginMethod        = errors.New("cannot unlink the last remaining sign-in method")
+)
+
+// 旧版用户表上的第三方ID字段（仅用于解绑时清理）
+var legacyIdentityFields = map[string]string{
+	"google": "GoogleID",
+	"github": "GitHubID",
+	"wechat": "WeChatID",
+}
+
+// FindUserByIdentity 按 provider + subject 查找已绑定的用户
+func FindUserByIdentity(db *gorm.DB, provider, subject string) (*models.User, *models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, nil, err
+	}
+	var user models.User
+	if err := db.Where("id = ?", identity.UserID).First(&user).Error; err != nil {
+		return nil, nil, err
+	}
+	return &user, &identity, nil
+}
+
+// FindUserByUnionID 按微信 UnionID 查找已绑定任一微信应用的用户
+func FindUserByUnionID(db *gorm.DB, unionID string) (*models.User, error) {
+	var identity models.UserIdentity
+	if err := db.Where("union_id = ?", unionID).Order("id ASC").First(&identity).Error; err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := db.Where("id = ?", identity.UserID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ResolveExternalIdentity 第三方登录：已绑定身份直接登录；
+// 微信 UnionID 已绑定到其他微信应用时合并到同一用户；
+// 邮箱 / 手机号已被占用时，仅当提供者与本地账号双方均已验证才自动绑定，否则要求用户登录后手动绑定；
+// 其余情况注册新用户并绑定身份
+func ResolveExternalIdentity(ctx context.Context, db *gorm.DB, ext *ExternalIdentity) (*models.User, error) {
+	if ext.Provider == "" || ext.Subject == "" {
+		return nil, errors.New("provider returned an empty subject")
+	}
+	ext.Email = strings.ToLower(strings.TrimSpace(ext.Email))
+	if ext.Phone != "" {
+		phone, err := NormalizeProjectPhone(db, ProjectKeyFromContext(ctx), ext.Phone)
+		if err != nil {
+			log.Printf("Warning: ignore invalid phone from %s: %v", ext.Provider, err)
+			ext.Phone, ext.PhoneVerified = "", false
+		} else {
+			ext.Phone = phone
+		}
+	}
+
+	// 1) 已绑定
+	user, identity, err := FindUserByIdentity(db, ext.Provider, ext.Subject)
+	if err == nil {
+		applyExternalIdentity(identity, ext)
+		if err := db.Save(identity).Error; err != nil {
+			log.Printf("Warning: failed to update identity %s/%s: %v", ext.Provider, ext.Subject, err)
+		}
+		attachProviderPhone(db, user, ext)
+		return user, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 1.1) 同一开放平台下的其他微信应用已绑定：合并到该用户
+	if ext.UnionID != "" {
+		if existing, err := FindUserByUnionID(db, ext.UnionID); err == nil {
+			identity := &models.UserIdentity{UserID: existing.ID}
+			applyExternalIdentity(identity, ext)
+			if err := db.Create(identity).Error; err != nil {
+				return nil, err
+			}
+			attachProviderPhone(db, existing, ext)
+			return existing, nil
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	// 2) 邮箱已存在：按验证状态决定是否自动绑定
+	if ext.Email != "" {
+		var existing models.User
+		if err := db.Where("email = ?", ext.Email).First(&existing).Error; err == nil {
+			if !ext.EmailVerified || !existing.EmailVerified {
+				return nil, ErrIdentityEmailConflict
+			}
+			identity := &models.UserIdentity{UserID: existing.ID}
+			applyExternalIdentity(identity, ext)
+			if err := db.Create(identity).Error; err != nil {
+				return nil, err
+			}
+			return &existing, nil
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	// 2.1) 手机号已存在：同样要求双方均已验证
+	if ext.Phone != "" {
+		var existing models.User
+		if err := db.Where("phone = ?", ext.Phone).First(&existing).Error; err == nil {
+			if !ext.PhoneVerified || !existing.PhoneVerified {
+				return nil, ErrIdentityPhoneConflict
+			}
+			identity := &models.UserIdentity{UserID: existing.ID}
+			applyExternalIdentity(identity, ext)
+			if err := db.Create(identity).Error; err != nil {
+				return nil, err
+			}
+			return &existing, nil
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	// 3) 注册新用户（统一注册 + 可选项目映射）
+	ginCtx, _ := ctx.(*gin.Context)
+	projectKey := ProjectKeyFromContext(ctx)
+
+	// 未验证的邮箱不写入用户表，避免占用他人邮箱
+	var emailPtr *string
+	if ext.Email != "" && ext.EmailVerified {
+		email := ext.Email
+		emailPtr = &email
+	}
+	var phonePtr *string
+	if ext.Phone != "" && ext.PhoneVerified {
+		phone := ext.Phone
+		phonePtr = &phone
+	}
+
+	var created *models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		user, err := RegisterUser(tx, nil, RegistrationOptions{
+			Email:                emailPtr,
+			Phone:                phonePtr,
+			Username:             ext.Username,
+			Nickname:             ext.Nickname,
+			EmailVerified:        emailPtr != nil,
+			PhoneVerified:        phonePtr != nil,
+			Role:                 "user",
+			Status:               "active",
+			SendWelcome:          false,
+			ProjectKey:           projectKey,
+			GinContext:           ginCtx,
+			StrictProjectMapping: projectKey != "",
+		})
+		if err != nil {
+			return err
+		}
+		if ext.Avatar != "" {
+			_ = user.SetAvatar(ext.Avatar)
+			if err := tx.Model(user).Update("meta", user.Meta).Error; err != nil {
+				return err
+			}
+		}
+		identity := &models.UserIdentity{UserID: user.ID}
+		applyExternalIdentity(identity, ext)
+		if err := tx.Create(identity).Error; err != nil {
+			return err
+		}
+		created = user
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 外层事务提交后才能等待开通结果（RegisterUser 在调用方事务内不会等待）
+	if projectKey != "" && !inTransaction(db) {
+		if err := FinishProjectProvisioning(ginCtx, db, projectKey, created.ID); err != nil {
+			return nil, err
+		}
+	}
+	return created, nil
+}
+
+// LinkIdentity 已登录用户显式绑定第三方身份（双方账号均已由用户证明持有，无需邮箱匹配）
+func LinkIdentity(db *gorm.DB, userID string, ext *ExternalIdentity) (*models.UserIdentity, error) {
+	if ext.Provider == "" || ext.Subject == "" {
+		return nil, errors.New("provider returned an empty subject")
+	}
+	ext.Email = strings.ToLower(strings.TrimSpace(ext.Email))
+
+	var identity models.UserIdentity
+	err := db.Where("provider = ? AND subject = ?", ext.Provider, ext.Subject).First(&identity).Error
+	if err == nil {
+		if identity.UserID != userID {
+			return nil, ErrIdentityAlreadyLinked
+		}
+		applyExternalIdentity(&identity, ext)
+		if err := db.Save(&identity).Error; err != nil {
+			return nil, err
+		}
+		return &identity, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var cnt int64
+	db.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, ext.Provider).Count(&cnt)
+	if cnt > 0 {
+		return nil, ErrIdentityProviderLinked
+	}
+	// UnionID 已属于其他用户：同一个微信用户不能分属两个账号
+	if ext.UnionID != "" {
+		if owner, err := FindUserByUnionID(db, ext.UnionID); err == nil && owner.ID != userID {
+			return nil, ErrIdentityAlreadyLinked
+		}
+	}
+
+	identity = models.UserIdentity{UserID: userID}
+	applyExternalIdentity(&identity, ext)
+	if err := db.Create(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// UnlinkIdentity 解绑第三方身份；若解绑后用户没有任何登录方式则拒绝
+func UnlinkIdentity(db *gorm.DB, userID, provider string) (*models.UserIdentity, error) {
+	var removed models.UserIdentity
+	err := models.WithActor(db, userID).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND provider = ?", userID, provider).First(&removed).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrIdentityNotFound
+			}
+			return err
+		}
+
+		var others int64
+		tx.Model(&models.UserIdentity{}).Where("user_id = ? AND id != ?", userID, removed.ID).Count(&others)
+		hasPassword := user.Password != ""
+		hasVerifiedEmail := user.Email != nil && *user.Email != "" && user.EmailVerified
+		hasVerifiedPhone := user.Phone != nil && *user.Phone != "" && user.PhoneVerified
+		if others == 0 && !hasPassword && !hasVerifiedEmail && !hasVerifiedPhone {
+			return ErrLastLoginMethod
+		}
+
+		if err := tx.Delete(&removed).Error; err != nil {
+			return err
+		}
+		if field, ok := legacyIdentityFields[provider]; ok {
+			if err := tx.Model(&models.User{}).Where("id = ?", userID).Update(field, nil).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &removed, nil
+}
+
+// AttachVerifiedPhone 为用户设置已由第三方验证的手机号（例如小程序 getPhoneNumber）
+func AttachVerifiedPhone(db *gorm.DB, userID, phone string) (*models.User, error) {
+	phone, err := utils.NormalizePhone(phone, utils.DefaultPhoneRegion())
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	err = models.WithActor(db, userID).Transaction(func(tx *gorm.DB) error {
+		var cnt int64
+		if err := tx.Model(&models.User{}).Where("phone = ? AND id != ?", phone, userID).Count(&cnt).Error; err != nil {
+			return err
+		}
+		if cnt > 0 {
+			return ErrPhoneInUse
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"phone": phone, "phone_verified": true}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", userID).First(&user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// attachProviderPhone 登录时补全尚未设置的手机号（失败仅记录日志）
+func attachProviderPhone(db *gorm.DB, user *models.User, ext *ExternalIdentity) {
+	if ext.Phone == "" || !ext.PhoneVerified || (user.Phone != nil && *user.Phone != "") {
+		return
+	}
+	updated, err := AttachVerifiedPhone(db, user.ID, ext.Phone)
+	if err != nil {
+		log.Printf("Warning: failed to attach %s phone to user %s: %v", ext.Provider, user.ID, err)
+		return
+	}
+	*user = *updated
+}
+
+// ListIdentities 获取用户已绑定的第三方身份
+func ListIdentities(db *gorm.DB, userID string) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	err := db.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error
+	return identities, err
+}
+
+// applyExternalIdentity 将第三方返回的资料与令牌写入身份记录（令牌加密）
+func applyExternalIdentity(identity *models.UserIdentity, ext *ExternalIdentity) {
+	now := time.Now()
+	identity.Provider = ext.Provider
+	identity.Subject = ext.Subject
+	if ext.Email != "" {
+		identity.Email = ext.Email
+		identity.EmailVerified = ext.EmailVerified
+	}
+	if ext.UnionID != "" {
+		identity.UnionID = ext.UnionID
+	}
+	if ext.Profile != nil {
+		if raw, err := json.Marshal(ext.Profile); err == nil {
+			identity.RawProfile = models.JSON(raw)
+		}
+	}
+	if ext.AccessToken != "" {
+		if enc, err := utils.EncryptString(ext.AccessToken); err == nil {
+			identity.AccessTokenEnc = enc
+			identity.TokenExpiresAt = ext.ExpiresAt
+		} else {
+			log.Printf("Warning: failed to encrypt %s access token: %v", ext.Provider, err)
+		}
+	}
+	if ext.RefreshToken != "" {
+		if enc, err := utils.EncryptString(ext.RefreshToken); err == nil {
+			identity.RefreshTokenEnc = enc
+		} else {
+			log.Printf("Warning: failed to encrypt %s refresh token: %v", ext.Provider, err)
+		}
+	}
+	identity.LastLoginAt = &now
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// 跨设备登录状态
+const (
+	LoginStatusPending   = "pending"   // 等待扫码 / 点击链接
+	LoginStatusScanned   = "scanned"   // 已扫码，等待确认
+	LoginStatusConfirmed = "confirmed" // 已确认，事件携带登录结果（token）
+	LoginStatusExpired   = "expired"   // 已过期
+	LoginStatusFailed    = "failed"    // 登录失败
+)
+
+// 跨设备登录频道类型
+const (
+	LoginChannelWeChatQR  = "wechat_qr"  // 微信扫码登录，id 为 state
+	LoginChannelMagicLink = "magic_link" // 邮件魔法链接登录，id 为链接令牌的会话标识
+)
+
+// LoginEvent 跨设备登录状态事件（例如电脑端等待手机扫码确认）
+type LoginEvent struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"` // confirmed 时为 models.LoginResponse
+	At      time.Time   `json:"at"`
+}
+
+// Terminal 是否为终态（确认、过期、失败后不再有新事件）
+func (e LoginEvent) Terminal() bool {
+	switch e.Status {
+	case LoginStatusConfirmed, LoginStatusExpired, LoginStatusFailed:
+		return true
+	}
+	return false
+}
+
+// LoginChannel 生成频道名
+func LoginChannel(kind, id string) string {
+	return kind + ":" + id
+}
+
+// LoginEventBroker 登录事件发布订阅；默认进程内实现，多实例部署时可替换为 Redis 等消息中间件
+type LoginEventBroker interface {
+	Publish(channel string, event LoginEvent)
+	// Subscribe 订阅频道，返回事件通道与取消函数（取消后通道关闭）
+	Subscribe(channel string) (<-chan LoginEvent, func())
+}
+
+// 每个订阅者的缓冲事件数，慢消费者超出后丢弃
+const loginEventBuffer = 8
+
+// MemoryLoginEventBroker 进程内登录事件发布订阅
+type MemoryLoginEventBroker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan LoginEvent]struct{}
+}
+
+// NewMemoryLoginEventBroker 创建进程内发布订阅
+func NewMemoryLoginEventBroker() *MemoryLoginEventBroker {
+	return &MemoryLoginEventBroker{subs: map[string]map[chan LoginEvent]struct{}{}}
+}
+
+// Publish 向频道的所有订阅者发布事件（不阻塞）
+func (b *MemoryLoginEventBroker) Publish(channel string, event LoginEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[channel] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Warning: login event subscriber on %s is full, dropping %s event", channel, event.Status)
+		}
+	}
+}
+
+// Subscribe 订阅频道
+func (b *MemoryLoginEventBroker) Subscribe(channel string) (<-chan LoginEvent, func()) {
+	ch := make(chan LoginEvent, loginEventBuffer)
+	b.mu.Lock()
+	if b.subs[channel] == nil {
+		b.subs[channel] = map[chan LoginEvent]struct{}{}
+	}
+	b.subs[channel][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[channel], ch)
+			if len(b.subs[channel]) == 0 {
+				delete(b.subs, channel)
+			}
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
@@ -1,16 +1,14 @@
 package services
 
 import (
-	"context"
-
 	"unit-auth/models"
 
 	"gorm.io/gorm"
 )
 
-// EnsureProjectMapping 确保为用户在指定项目下存在映射；不存在则创建远端用户并写入映射
-// 返回 localUserID（若成功获取或创建），否则返回空字符串
-func EnsureProjectMapping(ctx context.Context, db *gorm.DB, projectKey string, user *models.User, explicitEmail string) (string, error) {
+// EnsureProjectMapping 确保用户在指定项目下有映射：已有映射返回 localUserID；
+// 否则在 db（通常为注册事务）中写入 create 开通任务并返回空字符串，远端调用由开通 worker 执行
+func EnsureProjectMapping(db *gorm.DB, projectKey string, user *models.User) (string, error) {
 	if projectKey == "" || user == nil {
 		return "", nil
 	}
@@ -27,23 +25,8 @@ func EnsureProjectMapping(ctx context.Context, db *gorm.DB, projectKey string, u
 		return pm.LocalUserID, nil
 	}
 
-	// 组装对外用户数据
-	email := explicitEmail
-	if email == "" && user.Email != nil {
-		email = *user.Email
-	}
-	cli := NewProjectClient(p)
-	localID, err := cli.CreateUser(ctx, OutboundUser{
-		UserID:   user.ID,
-		Email:    email,
-		Username: user.Username,
-		Nickname: user.Nickname,
-		Avatar:   user.GetAvatar(),
-	})
-	if err != nil {
+	if _, err := EnqueueProvisioning(db, models.ProvisioningCreate, projectKey, user.ID, ""); err != nil {
 		return "", err
 	}
-
-	_ = db.Create(&models.ProjectMapping{UserID: user.ID, ProjectName: projectKey, LocalUserID: localID}).Error
-	return localID, nil
+	return "", nil
 }
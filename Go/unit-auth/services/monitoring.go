@@ -288,9 +288,15 @@ func (ms *MonitoringService) GetMetrics() map[string]interface{} {
 			"total_users": stats["total_users"],
 			"valid_users": stats["valid_users"],
 		},
+		"project_clients": ms.GetProjectClientStats(),
 	}
 }
 
+// GetProjectClientStats 获取各项目接口调用统计（请求数、错误率、平均延迟、熔断状态）
+func (ms *MonitoringService) GetProjectClientStats() []ProjectClientStat {
+	return ProjectClientStats()
+}
+
 // getCounterValue 获取计数器值（这里简化处理，实际应该从Prometheus registry获取）
 func (ms *MonitoringService) getCounterValue(counter prometheus.Counter) interface{} {
 	// 注意：这里返回的是计数器类型，实际值需要从Prometheus registry获取
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"unit-auth/models"
+	"unit-auth/utils"
+)
+
+// OAuthBindingCookie 浏览器绑定 Cookie：授权事务只能由发起授权的浏览器完成
+const OAuthBindingCookie = "oauth_binding"
+
+// OAuth 事务默认有效期
+const defaultOAuthTransactionTTL = 10 * time.Minute
+
+var (
+	ErrOAuthStateInvalid     = errors.New("invalid oauth state")
+	ErrOAuthStateExpired     = errors.New("oauth state expired")
+	ErrOAuthStateUsed        = errors.New("oauth state already used")
+	ErrOAuthStateMismatch    = errors.New("oauth state was issued for a different browser, provider or project")
+	ErrRedirectURINotAllowed = errors.New("redirect_uri is not allowed for this project")
+)
+
+// OAuthTransactionService 服务端 OAuth 事务存储（state / PKCE / nonce）
+type OAuthTransactionService struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+// NewOAuthTransactionService 创建 OAuth 事务服务
+func NewOAuthTransactionService(db *gorm.DB) *OAuthTransactionService {
+	return &OAuthTransactionService{db: db, ttl: defaultOAuthTransactionTTL}
+}
+
+// TTL 事务有效期
+func (s *OAuthTransactionService) TTL() time.Duration {
+	return s.ttl
+}
+
+// BeginOAuthOptions 发起授权参数
+type BeginOAuthOptions struct {
+	Provider    string
+	Purpose     string // login | link
+	ProjectKey  string
+	UserID      string // 绑定流程的当前用户
+	Binding     string // 浏览器绑定值（明文，仅保存哈希）
+	RedirectURI string // 登录完成后的跳转地址（需已校验）
+	IP          string
+	UserAgent   string
+	PKCE        bool // 生成 code_verifier
+	Nonce       bool // 生成 OIDC nonce
+}
+
+// ConsumeOAuthOptions 完成授权时的校验参数
+type ConsumeOAuthOptions struct {
+	State      string
+	Provider   string
+	Purpose    string
+	ProjectKey string
+	UserID     string
+	Binding    string
+}
+
+// Begin 创建授权事务，返回的记录包含明文 CodeVerifier
+func (s *OAuthTransactionService) Begin(opts BeginOAuthOptions) (*models.OAuthTransaction, error) {
+	if opts.Binding == "" {
+		return nil, errors.New("missing browser binding")
+	}
+	purpose := opts.Purpose
+	if purpose == "" {
+		purpose = models.OAuthPurposeLogin
+	}
+	tx := &models.OAuthTransaction{
+		State:       randomURLToken(24),
+		Provider:    opts.Provider,
+		Purpose:     purpose,
+		ProjectKey:  opts.ProjectKey,
+		UserID:      opts.UserID,
+		BindingHash: HashOAuthBinding(opts.Binding),
+		RedirectURI: opts.RedirectURI,
+		IP:          opts.IP,
+		UserAgent:   truncate(opts.UserAgent, 500),
+		ExpiresAt:   time.Now().Add(s.ttl),
+	}
+	if opts.PKCE {
+		tx.CodeVerifier = randomURLToken(32)
+		enc, err := utils.EncryptString(tx.CodeVerifier)
+		if err != nil {
+			return nil, err
+		}
+		tx.CodeVerifierEnc = enc
+	}
+	if opts.Nonce {
+		tx.Nonce = randomURLToken(16)
+	}
+	if err := s.db.Create(tx).Error; err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Consume 校验并一次性消费授权事务
+func (s *OAuthTransactionService) Consume(opts ConsumeOAuthOptions) (*models.OAuthTransaction, error) {
+	if opts.State == "" {
+		return nil, ErrOAuthStateInvalid
+	}
+	if opts.Binding == "" {
+		return nil, ErrOAuthStateMismatch
+	}
+	var tx models.OAuthTransaction
+	if err := s.db.Where("state = ?", opts.State).First(&tx).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOAuthStateInvalid
+		}
+		return nil, err
+	}
+	if tx.UsedAt != nil {
+		return nil, ErrOAuthStateUsed
+	}
+	if time.Now().After(tx.ExpiresAt) {
+		return nil, ErrOAuthStateExpired
+	}
+	purpose := opts.Purpose
+	if purpose == "" {
+		purpose = models.OAuthPurposeLogin
+	}
+	if tx.Provider != opts.Provider || tx.Purpose != purpose || tx.ProjectKey != opts.ProjectKey || tx.UserID != opts.UserID ||
+		!OAuthBindingMatches(tx.BindingHash, opts.Binding) {
+		return nil, ErrOAuthStateMismatch
+	}
+
+	// 条件更新保证并发下只有一次消费成功
+	now := time.Now()
+	res := s.db.Model(&models.OAuthTransaction{}).Where("id = ? AND used_at IS NULL", tx.ID).Update("used_at", &now)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, ErrOAuthStateUsed
+	}
+	tx.UsedAt = &now
+
+	if tx.CodeVerifierEnc != "" {
+		verifier, err := utils.DecryptString(tx.CodeVerifierEnc)
+		if err != nil {
+			return nil, err
+		}
+		tx.CodeVerifier = verifier
+	}
+	return &tx, nil
+}
+
+// ValidateRedirectURI 校验登录后跳转地址：站内相对路径始终允许，绝对地址须在项目白名单内
+func (s *OAuthTransactionService) ValidateRedirectURI(projectKey, redirectURI string) error {
+	if redirectURI == "" {
+		return nil
+	}
+	if strings.HasPrefix(redirectURI, "/") && !strings.HasPrefix(redirectURI, "//") && !strings.HasPrefix(redirectURI, "/\\") {
+		return nil
+	}
+	if projectKey == "" {
+		return ErrRedirectURINotAllowed
+	}
+	var project models.Project
+	if err := s.db.Where("`key` = ? AND enabled = ?", projectKey, true).First(&project).Error; err != nil {
+		return ErrRedirectURINotAllowed
+	}
+	if !project.IsRedirectURIAllowed(redirectURI) {
+		return ErrRedirectURINotAllowed
+	}
+	return nil
+}
+
+// PurgeExpired 清理过期或已使用的事务
+func (s *OAuthTransactionService) PurgeExpired() (int64, error) {
+	res := s.db.Where("expires_at < ? OR used_at IS NOT NULL", time.Now()).Delete(&models.OAuthTransaction{})
+	return res.RowsAffected, res.Error
+}
+
+// NewOAuthBinding 生成新的浏览器绑定值
+func NewOAuthBinding() string {
+	return randomURLToken(32)
+}
+
+// HashOAuthBinding 浏览器绑定值的哈希（数据库只保存哈希）
+func HashOAuthBinding(binding string) string {
+	sum := sha256.Sum256([]byte(binding))
+	return hex.EncodeToString(sum[:])
+}
+
+// OAuthBindingMatches 浏览器绑定值是否与保存的哈希一致（常量时间比较）
+func OAuthBindingMatches(hash, binding string) bool {
+	return hash != "" && binding != "" &&
+		subtle.ConstantTimeCompare([]byte(hash), []byte(HashOAuthBinding(binding))) == 1
+}
+
+func randomURLToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ProjectPhoneRegion 项目的默认手机号地区，未配置或项目不存在时使用全局默认
+func ProjectPhoneRegion(db *gorm.DB, projectKey string) string {
+	if projectKey != "" {
+		var project models.Project
+		if err := db.Select("default_phone_region").Where("`key` = ?", projectKey).First(&project).Error; err == nil &&
+			utils.IsSupportedPhoneRegion(project.DefaultPhoneRegion) {
+			return project.DefaultPhoneRegion
+		}
+	}
+	return utils.DefaultPhoneRegion()
+}
+
+// NormalizeProjectPhone 按项目默认地区将手机号规范化为 E.164（入库与查询统一使用）
+func NormalizeProjectPhone(db *gorm.DB, projectKey, raw string) (string, error) {
+	return utils.NormalizePhone(raw, ProjectPhoneRegion(db, projectKey))
+}
+
+type projectKeyCtx struct{}
+
+// WithProjectKey 为请求上下文附加项目 Key（调用方传入 c.Request.Context() 而不是 gin.Context 时使用）
+func WithProjectKey(ctx context.Context, projectKey string) context.Context {
+	return context.WithValue(ctx, projectKeyCtx{}, projectKey)
+}
+
+// ProjectKeyFromContext 读取请求上下文中的项目 Key（gin.Context 由项目中间件写入 project_key，其他上下文由 WithProjectKey 附加）
+func ProjectKeyFromContext(ctx context.Context) string {
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		return ginCtx.GetString("project_key")
+	}
+	projectKey, _ := ctx.Value(projectKeyCtx{}).(string)
+	return projectKey
+}
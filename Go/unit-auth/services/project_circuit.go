@@ -0,0 +1,241 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"unit-auth/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 熔断状态
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+var (
+	projectClientRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "project_client_requests_total",
+		Help: "Total number of project API calls by project, operation and result (success, http_<status>, timeout, network, circuit_open, config, invalid_response)",
+	}, []string{"project", "operation", "result"})
+	projectClientRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "project_client_request_duration_seconds",
+		Help:    "Project API call duration in seconds (per attempt)",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"project", "operation"})
+	projectClientRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "project_client_retries_total",
+		Help: "Total number of project API call retries",
+	}, []string{"project", "operation"})
+	projectClientCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "project_client_circuit_state",
+		Help: "Project circuit breaker state (0 closed, 1 half-open, 2 open)",
+	}, []string{"project"})
+)
+
+// circuitBreaker 项目熔断器：连续失败达到阈值后打开，open 时长结束后放行一个探测请求（half_open），
+// 探测成功关闭、失败重新打开
+type circuitBreaker struct {
+	mu       sync.Mutex
+	project  string
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+var (
+	projectBreakersMu sync.Mutex
+	projectBreakers   = map[string]*circuitBreaker{}
+)
+
+func projectBreaker(projectKey string) *circuitBreaker {
+	projectBreakersMu.Lock()
+	defer projectBreakersMu.Unlock()
+	b, ok := projectBreakers[projectKey]
+	if !ok {
+		b = &circuitBreaker{project: projectKey, state: CircuitClosed}
+		projectBreakers[projectKey] = b
+		projectClientCircuitState.WithLabelValues(projectKey).Set(0)
+	}
+	return b
+}
+
+func (b *circuitBreaker) allow() bool {
+	if config.AppConfig.ProjectCircuitFailureThreshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < time.Duration(config.AppConfig.ProjectCircuitOpenSeconds)*time.Second {
+			return false
+		}
+		b.setState(CircuitHalfOpen)
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// record 记录一次调用结果；ok 为 false 表示项目不可用（网络错误、超时、429、5xx）
+func (b *circuitBreaker) record(ok bool) {
+	threshold := config.AppConfig.ProjectCircuitFailureThreshold
+	if threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		b.failures = 0
+		if b.state != CircuitClosed {
+			log.Printf("Project %s circuit closed", b.project)
+			b.setState(CircuitClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= threshold) {
+		log.Printf("Warning: project %s circuit opened after %d consecutive failures", b.project, b.failures)
+		b.openedAt = time.Now()
+		b.setState(CircuitOpen)
+	}
+}
+
+func (b *circuitBreaker) setState(state string) {
+	b.state = state
+	value := 0.0
+	switch state {
+	case CircuitHalfOpen:
+		value = 1
+	case CircuitOpen:
+		value = 2
+	}
+	projectClientCircuitState.WithLabelValues(b.project).Set(value)
+}
+
+func (b *circuitBreaker) snapshot() (string, int, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.failures, b.openedAt
+}
+
+// ProjectClientStat 项目调用统计（进程内，自启动起累计）
+type ProjectClientStat struct {
+	Project         string     `json:"project"`
+	Requests        int64      `json:"requests"`
+	Errors          int64      `json:"errors"`
+	Retries         int64      `json:"retries"`
+	ErrorRate       float64    `json:"error_rate"`
+	AvgLatencyMS    float64    `json:"avg_latency_ms"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+	CircuitState    string     `json:"circuit_state"`
+	CircuitFailures int        `json:"consecutive_failures"`
+	CircuitOpenedAt *time.Time `json:"circuit_opened_at,omitempty"`
+	totalLatency    time.Duration
+	latencySamples  int64
+}
+
+var (
+	projectStatsMu sync.Mutex
+	projectStats   = map[string]*ProjectClientStat{}
+)
+
+// recordProjectCall 记录一次调用（duration 为 0 表示请求未发出）
+func recordProjectCall(projectKey, operation string, perr *ProjectError, duration time.Duration) {
+	result := "success"
+	if perr != nil {
+		result = perr.Kind
+		if perr.StatusCode != 0 {
+			result = "http_" + strconv.Itoa(perr.StatusCode)
+		}
+	}
+	projectClientRequestsTotal.WithLabelValues(projectKey, operation, result).Inc()
+	if duration > 0 {
+		projectClientRequestDuration.WithLabelValues(projectKey, operation).Observe(duration.Seconds())
+	}
+
+	projectStatsMu.Lock()
+	defer projectStatsMu.Unlock()
+	stat := projectStatFor(projectKey)
+	stat.Requests++
+	if duration > 0 {
+		stat.totalLatency += duration
+		stat.latencySamples++
+	}
+	if perr != nil {
+		stat.Errors++
+		// 熔断拒绝的请求不覆盖最近错误，保留导致熔断的原始错误
+		if !errors.Is(perr, ErrProjectCircuitOpen) {
+			now := time.Now()
+			stat.LastError = perr.Error()
+			stat.LastErrorAt = &now
+		}
+	}
+}
+
+func recordProjectRetry(projectKey, operation string) {
+	projectClientRetriesTotal.WithLabelValues(projectKey, operation).Inc()
+	projectStatsMu.Lock()
+	projectStatFor(projectKey).Retries++
+	projectStatsMu.Unlock()
+}
+
+func projectStatFor(projectKey string) *ProjectClientStat {
+	stat, ok := projectStats[projectKey]
+	if !ok {
+		stat = &ProjectClientStat{Project: projectKey}
+		projectStats[projectKey] = stat
+	}
+	return stat
+}
+
+// ProjectClientStats 各项目的调用统计与熔断状态，按项目 key 排序
+func ProjectClientStats() []ProjectClientStat {
+	projectStatsMu.Lock()
+	stats := make([]ProjectClientStat, 0, len(projectStats))
+	for _, stat := range projectStats {
+		s := *stat
+		if s.Requests > 0 {
+			s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+		}
+		if s.latencySamples > 0 {
+			s.AvgLatencyMS = float64(s.totalLatency.Microseconds()) / float64(s.latencySamples) / 1000
+		}
+		stats = append(stats, s)
+	}
+	projectStatsMu.Unlock()
+
+	for i := range stats {
+		stats[i].CircuitState = CircuitClosed
+		projectBreakersMu.Lock()
+		b, ok := projectBreakers[stats[i].Project]
+		projectBreakersMu.Unlock()
+		if ok {
+			state, failures, openedAt := b.snapshot()
+			stats[i].CircuitState = state
+			stats[i].CircuitFailures = failures
+			if state != CircuitClosed {
+				stats[i].CircuitOpenedAt = &openedAt
+			}
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Project < stats[j].Project })
+	return stats
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"unit-auth/models"
+	"unit-auth/utils"
+)
+
+// ErrProjectCircuitOpen 项目熔断中，请求未发出
+var ErrProjectCircuitOpen = errors.New("project circuit breaker is open")
+
+// 项目调用错误类型
+const (
+	ProjectErrorHTTP            = "http"             // 项目返回非 2xx
+	ProjectErrorNetwork         = "network"          // 连接失败、连接被重置等
+	ProjectErrorTimeout         = "timeout"          // 超过 timeout_ms 或调用方 context 到期
+	ProjectErrorCircuitOpen     = "circuit_open"     // 熔断中
+	ProjectErrorConfig          = "config"           // 项目认证或证书配置错误
+	ProjectErrorInvalidResponse = "invalid_response" // 2xx 但响应体无法解析
+)
+
+// ProjectError 项目接口调用失败的结构化错误；Code / Message 解析自项目的错误响应体
+type ProjectError struct {
+	Project    string `json:"project"`
+	Operation  string `json:"operation"`
+	Kind       string `json:"kind"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Retryable  bool   `json:"retryable"` // 稍后重试可能成功（网络错误、超时、408、425、429、5xx、熔断）
+	Err        error  `json:"-"`
+
+	retryAfter time.Duration
+}
+
+func (e *ProjectError) Error() string {
+	msg := fmt.Sprintf("project %s %s failed", e.Project, e.Operation)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(": HTTP %d", e.StatusCode)
+	} else {
+		msg += ": " + e.Kind
+	}
+	if e.Code != "" {
+		msg += " [" + e.Code + "]"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *ProjectError) Unwrap() error { return e.Err }
+
+// IsRetryableProjectError 错误是否值得稍后重试；非 ProjectError 的错误按可重试处理
+func IsRetryableProjectError(err error) bool {
+	var perr *ProjectError
+	if errors.As(err, &perr) {
+		return perr.Retryable
+	}
+	return true
+}
+
+// ProjectClient 调用第三方项目的用户接口：按项目的 timeout_ms 与 retry_policy 超时和重试，
+// 按 auth_mode 认证，每个项目独立熔断，失败返回 *ProjectError
+type ProjectClient struct {
+	Project models.Project
+	HTTP    *http.Client
+
+	policy    models.ProjectRetryPolicy
+	breaker   *circuitBreaker
+	configErr error
+}
+
+type OutboundUser struct {
+	UserID   string `json:"user_id"`
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"` // E.164
+	Username string `json:"username"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+}
+
+type CreateUserResp struct {
+	UserID any `json:"user_id"`
+}
+
+// RemoteUser 项目用户接口返回的用户：id 为项目本地用户ID，user_id 为创建时传入的 unit-auth 用户ID
+type RemoteUser struct {
+	ID       any    `json:"id"`
+	UserID   string `json:"user_id"`
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Username string `json:"username,omitempty"`
+	Nickname string `json:"nickname,omitempty"`
+	Avatar   string `json:"avatar,omitempty"`
+}
+
+// LocalUserID 项目本地用户ID（数字ID规范化为字符串）
+func (u *RemoteUser) LocalUserID() string {
+	return projectUserID(u.ID)
+}
+
+// RemoteUserPage 用户列表的一页；next_cursor 为空表示已到末尾
+type RemoteUserPage struct {
+	Users      []RemoteUser `json:"users"`
+	NextCursor string       `json:"next_cursor"`
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey 为项目调用附加幂等键（Idempotency-Key 请求头），同一操作重试时项目可据此去重；
+// 携带幂等键的 POST 才会被自动重试
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+type dryRunCtx struct{}
+
+// WithDryRun 标记为连通性测试：请求携带 X-Unit-Auth-Dry-Run: true，不重试、不受熔断限制，结果不计入熔断（仍计入统计）
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunCtx{}, true)
+}
+
+// NewProjectClient 创建项目客户端（同一项目复用连接池与熔断器）
+func NewProjectClient(p models.Project) *ProjectClient {
+	httpClient, err := projectHTTPClient(p)
+	return &ProjectClient{
+		Project:   p,
+		HTTP:      httpClient,
+		policy:    p.GetRetryPolicy(),
+		breaker:   projectBreaker(p.Key),
+		configErr: err,
+	}
+}
+
+/**
+* 说明：
+	创建用户，用于第三方项目对接
+* 接口示例
+	curl -X POST http://localhost:9001/api/v1/users -H "Content-Type: application/json" -H "Idempotency-Key: prov_..." -d '{"user_id": "1234567890", "email": "test@example.com", "username": "test", "nickname": "test", "avatar": "https://example.com/avatar.png"}'
+* 请求参数：
+	user_id: 用户ID
+	email: 邮箱
+	username: 用户名
+	nickname: 昵称
+	avatar: 头像
+* 响应参数：
+	user_id: 用户ID
+* 错误响应（可选，解析为 ProjectError.Code / Message）：
+	{"code": "email_taken", "message": "..."}
+*/
+
+func (c *ProjectClient) CreateUser(ctx context.Context, u OutboundUser) (string, error) {
+	var r CreateUserResp
+	if err := c.do(ctx, "create_user", http.MethodPost, "/api/v1/users", u, &r); err != nil {
+		return "", err
+	}
+	id := projectUserID(r.UserID)
+	if id == "" {
+		return "", &ProjectError{Project: c.Project.Key, Operation: "create_user", Kind: ProjectErrorInvalidResponse, Message: "empty local user id"}
+	}
+	return id, nil
+}
+
+func (c *ProjectClient) UpdateUser(ctx context.Context, localUserID string, u OutboundUser) error {
+	return c.do(ctx, "update_user", http.MethodPut, "/api/v1/users/"+url.PathEscape(localUserID), u, nil)
+}
+
+func (c *ProjectClient) DeleteUser(ctx context.Context, localUserID string) error {
+	return c.do(ctx, "delete_user", http.MethodDelete, "/api/v1/users/"+url.PathEscape(localUserID), nil, nil)
+}
+
+/**
+* 说明：
+	分页列出项目用户，用于映射核对
+* 接口示例
+	curl "http://localhost:9001/api/v1/users?limit=100&cursor=..."
+* 响应参数：
+	users: [{"id": 项目用户ID, "user_id": unit-auth 用户ID, "email", "phone", "username", "nickname", "avatar"}]
+	next_cursor: 下一页游标，为空表示已到末尾
+*/
+
+func (c *ProjectClient) ListUsers(ctx context.Context, cursor string, limit int) (*RemoteUserPage, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	var page RemoteUserPage
+	if err := c.do(ctx, "list_users", http.MethodGet, "/api/v1/users?"+query.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetUser 读取项目用户；不存在时返回 StatusCode 为 404 的 *ProjectError
+func (c *ProjectClient) GetUser(ctx context.Context, localUserID string) (*RemoteUser, error) {
+	var u RemoteUser
+	if err := c.do(ctx, "get_user", http.MethodGet, "/api/v1/users/"+url.PathEscape(localUserID), nil, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// projectUserID 项目返回的用户ID规范化为字符串
+func projectUserID(v any) string {
+	switch id := v.(type) {
+	case string:
+		return id
+	case float64:
+		return strconv.FormatInt(int64(id), 10)
+	case json.Number:
+		if iv, err := id.Int64(); err == nil {
+			return strconv.FormatInt(iv, 10)
+		}
+		return id.String()
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", id)
+	}
+}
+
+// do 发送请求并按重试策略重试；out 非空时解析 2xx 响应体
+func (c *ProjectClient) do(ctx context.Context, operation, method, path string, payload, out interface{}) error {
+	if c.configErr != nil {
+		perr := &ProjectError{Project: c.Project.Key, Operation: operation, Kind: ProjectErrorConfig, Message: c.configErr.Error(), Err: c.configErr}
+		recordProjectCall(c.Project.Key, operation, perr, 0)
+		return perr
+	}
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	idempotencyKey, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	idempotent := method != http.MethodPost || idempotencyKey != ""
+	dryRun, _ := ctx.Value(dryRunCtx{}).(bool)
+
+	for attempt := 0; ; attempt++ {
+		if !dryRun && !c.breaker.allow() {
+			perr := &ProjectError{Project: c.Project.Key, Operation: operation, Kind: ProjectErrorCircuitOpen,
+				Message: "too many recent failures, requests are paused", Retryable: true, Err: ErrProjectCircuitOpen}
+			recordProjectCall(c.Project.Key, operation, perr, 0)
+			return perr
+		}
+
+		start := time.Now()
+		perr, raw := c.send(ctx, operation, method, path, body, idempotencyKey)
+		duration := time.Since(start)
+		// 4xx 说明项目本身可用，不计入熔断；连通性测试不影响熔断状态
+		if !dryRun {
+			c.breaker.record(perr == nil || !perr.Retryable)
+		}
+		recordProjectCall(c.Project.Key, operation, perr, duration)
+
+		if perr == nil {
+			if out != nil && len(bytes.TrimSpace(raw)) > 0 {
+				if err := json.Unmarshal(raw, out); err != nil {
+					return &ProjectError{Project: c.Project.Key, Operation: operation, Kind: ProjectErrorInvalidResponse, Message: err.Error(), Err: err}
+				}
+			}
+			return nil
+		}
+		if dryRun || !perr.Retryable || !idempotent || attempt >= c.policy.MaxRetries || ctx.Err() != nil {
+			return perr
+		}
+
+		timer := time.NewTimer(c.backoff(attempt, perr.retryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return perr
+		case <-timer.C:
+		}
+		recordProjectRetry(c.Project.Key, operation)
+	}
+}
+
+// send 发送一次请求，返回错误（nil 表示 2xx）与响应体
+func (c *ProjectClient) send(ctx context.Context, operation, method, path string, body []byte, idempotencyKey string) (*ProjectError, []byte) {
+	fail := func(kind string, err error) *ProjectError {
+		return &ProjectError{Project: c.Project.Key, Operation: operation, Kind: kind, Message: err.Error(), Retryable: kind != ProjectErrorConfig, Err: err}
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.Project.BaseURL, "/")+path, reader)
+	if err != nil {
+		return fail(ProjectErrorConfig, err), nil
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", "unit-auth-project-client/1.0")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	if dryRun, _ := ctx.Value(dryRunCtx{}).(bool); dryRun {
+		req.Header.Set("X-Unit-Auth-Dry-Run", "true")
+	}
+	if err := c.authorize(req, body); err != nil {
+		return fail(ProjectErrorConfig, err), nil
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return fail(ProjectErrorTimeout, err), nil
+		}
+		return fail(ProjectErrorNetwork, err), nil
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil, raw
+	}
+
+	perr := &ProjectError{Project: c.Project.Key, Operation: operation, Kind: ProjectErrorHTTP, StatusCode: resp.StatusCode}
+	perr.Code, perr.Message = parseProjectErrorBody(raw)
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooEarly,
+		resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		perr.Retryable = true
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		perr.retryAfter = time.Duration(seconds) * time.Second
+	}
+	return perr, raw
+}
+
+// authorize 按 auth_mode 为请求添加认证信息（mtls 的证书在传输层配置）
+func (c *ProjectClient) authorize(req *http.Request, body []byte) error {
+	mode := c.Project.AuthMode
+	if mode != models.ProjectAuthAPIKey && mode != models.ProjectAuthBearer && mode != models.ProjectAuthHMAC {
+		return nil
+	}
+	credential, err := utils.DecryptStringOrPlain(c.Project.CredentialsEnc)
+	if err != nil {
+		return fmt.Errorf("decrypt project credentials: %w", err)
+	}
+	if credential == "" {
+		if mode == models.ProjectAuthHMAC {
+			return errors.New("hmac auth requires credentials")
+		}
+		return nil
+	}
+	switch mode {
+	case models.ProjectAuthAPIKey:
+		req.Header.Set("X-Project-Token", credential)
+	case models.ProjectAuthBearer:
+		req.Header.Set("Authorization", "Bearer "+credential)
+	case models.ProjectAuthHMAC:
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Unit-Auth-Project", c.Project.Key)
+		req.Header.Set("X-Unit-Auth-Timestamp", timestamp)
+		req.Header.Set("X-Unit-Auth-Signature", "v1="+SignProjectRequest(credential, timestamp, req.Method, req.URL.RequestURI(), body))
+	}
+	return nil
+}
+
+// SignProjectRequest hmac 认证签名：hex(HMAC-SHA256(secret, timestamp + "." + METHOD + "." + path?query + "." + body))
+func SignProjectRequest(secret, timestamp, method, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + method + "." + requestURI + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff 第 n 次重试前的等待：backoff_ms*2^n 取其 50%~100% 的随机值，不超过 max_backoff_ms；项目给出 Retry-After 时取较大者（同样受上限约束）
+func (c *ProjectClient) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	limit := time.Duration(c.policy.MaxBackoffMS) * time.Millisecond
+	wait := utils.ExpBackoffJitter(time.Duration(c.policy.BackoffMS)*time.Millisecond, limit, attempt+1)
+	if retryAfter > wait {
+		wait = retryAfter
+		if wait > limit {
+			wait = limit
+		}
+	}
+	return wait
+}
+
+// parseProjectErrorBody 解析常见的错误响应格式：
+// {"code","message"}、{"error","error_description"}、{"error":{"code","message"}}、本仓库的 {"code","message"} 响应
+func parseProjectErrorBody(raw []byte) (string, string) {
+	var body map[string]interface{}
+	if err := json.Unmarshal(raw, &body); err == nil {
+		if nested, ok := body["error"].(map[string]interface{}); ok {
+			body = nested
+		}
+		code := firstString(body, "code", "error_code", "error")
+		message := firstString(body, "message", "error_description", "msg", "detail")
+		if code != "" || message != "" {
+			return code, truncate(message, 300)
+		}
+	}
+	return "", truncate(strings.TrimSpace(string(raw)), 300)
+}
+
+func firstString(body map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := body[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// projectTransport 按项目缓存的连接池；项目配置更新（updated_at 变化）后重建
+type projectTransport struct {
+	version   int64
+	transport *http.Transport
+	err       error
+}
+
+var (
+	projectTransportsMu sync.Mutex
+	projectTransports   = map[string]*projectTransport{}
+)
+
+func projectHTTPClient(p models.Project) (*http.Client, error) {
+	timeout := time.Duration(p.TimeoutMS) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	projectTransportsMu.Lock()
+	defer projectTransportsMu.Unlock()
+	cached, ok := projectTransports[p.Key]
+	if !ok || cached.version != p.UpdatedAt.UnixNano() {
+		if ok && cached.transport != nil {
+			cached.transport.CloseIdleConnections()
+		}
+		transport := &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+			MaxIdleConnsPerHost: 10,
+		}
+		tlsConfig, err := projectTLSConfig(p)
+		transport.TLSClientConfig = tlsConfig
+		cached = &projectTransport{version: p.UpdatedAt.UnixNano(), transport: transport, err: err}
+		projectTransports[p.Key] = cached
+	}
+	return &http.Client{Timeout: timeout, Transport: cached.transport}, cached.err
+}
+
+// projectTLSConfig 自定义 CA 与 mtls 客户端证书
+func projectTLSConfig(p models.Project) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if strings.TrimSpace(p.CACertPEM) != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(p.CACertPEM)) {
+			return cfg, errors.New("invalid ca_cert_pem")
+		}
+		cfg.RootCAs = pool
+	}
+	if p.AuthMode == models.ProjectAuthMTLS {
+		key, err := utils.DecryptStringOrPlain(p.ClientKeyEnc)
+		if err != nil {
+			return cfg, fmt.Errorf("decrypt client key: %w", err)
+		}
+		cert, err := tls.X509KeyPair([]byte(p.ClientCertPEM), []byte(key))
+		if err != nil {
+			return cfg, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"unit-auth/models"
+
+	"github.com/google/uuid"
+)
+
+// NewProjectCredentials 生成项目凭据（api_key / bearer 令牌或 hmac 密钥）
+func NewProjectCredentials() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "psk_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// ProjectConnectionStep 连通性测试的一步
+type ProjectConnectionStep struct {
+	Operation   string        `json:"operation"`
+	Method      string        `json:"method"`
+	Path        string        `json:"path"`
+	OK          bool          `json:"ok"`
+	LatencyMS   int64         `json:"latency_ms"`
+	LocalUserID string        `json:"local_user_id,omitempty"`
+	Error       *ProjectError `json:"error,omitempty"`
+	Skipped     bool          `json:"skipped,omitempty"`
+}
+
+// ProjectConnectionReport 连通性测试结果
+type ProjectConnectionReport struct {
+	Project      string                  `json:"project"`
+	BaseURL      string                  `json:"base_url"`
+	AuthMode     string                  `json:"auth_mode"`
+	OK           bool                    `json:"ok"`
+	DryRunUserID string                  `json:"dry_run_user_id"`
+	Steps        []ProjectConnectionStep `json:"steps"`
+	TestedAt     time.Time               `json:"tested_at"`
+}
+
+// TestProjectConnection 用一个试运行用户依次调用项目的创建、更新、删除接口，检查对接约定（地址、认证、响应格式）；
+// 请求携带 X-Unit-Auth-Dry-Run: true，项目可据此不落库；不写入映射，不重试
+func TestProjectConnection(ctx context.Context, p models.Project) *ProjectConnectionReport {
+	userID := "dryrun_" + uuid.New().String()
+	report := &ProjectConnectionReport{Project: p.Key, BaseURL: p.BaseURL, AuthMode: p.AuthMode, DryRunUserID: userID, TestedAt: time.Now()}
+	outbound := OutboundUser{
+		UserID:   userID,
+		Email:    userID + "@unit-auth.invalid",
+		Username: "unit_auth_dry_run",
+		Nickname: "Unit Auth Dry Run",
+	}
+	client := NewProjectClient(p)
+	ctx = WithDryRun(ctx)
+
+	run := func(operation, method, path string, call func() (string, error)) bool {
+		step := ProjectConnectionStep{Operation: operation, Method: method, Path: path}
+		start := time.Now()
+		localUserID, err := call()
+		step.LatencyMS = time.Since(start).Milliseconds()
+		step.LocalUserID = localUserID
+		if err != nil {
+			var perr *ProjectError
+			if !errors.As(err, &perr) {
+				perr = &ProjectError{Project: p.Key, Operation: operation, Kind: ProjectErrorConfig, Message: err.Error(), Err: err}
+			}
+			step.Error = perr
+		} else {
+			step.OK = true
+		}
+		report.Steps = append(report.Steps, step)
+		return step.OK
+	}
+
+	var localUserID string
+	created := run("create_user", "POST", "/api/v1/users", func() (string, error) {
+		var err error
+		localUserID, err = client.CreateUser(WithIdempotencyKey(ctx, userID), outbound)
+		return localUserID, err
+	})
+	if !created {
+		report.Steps = append(report.Steps,
+			ProjectConnectionStep{Operation: "update_user", Method: "PUT", Path: "/api/v1/users/:local_user_id", Skipped: true},
+			ProjectConnectionStep{Operation: "delete_user", Method: "DELETE", Path: "/api/v1/users/:local_user_id", Skipped: true})
+		return report
+	}
+
+	outbound.Nickname = "Unit Auth Dry Run (updated)"
+	updated := run("update_user", "PUT", "/api/v1/users/"+localUserID, func() (string, error) {
+		return localUserID, client.UpdateUser(ctx, localUserID, outbound)
+	})
+	deleted := run("delete_user", "DELETE", "/api/v1/users/"+localUserID, func() (string, error) {
+		return localUserID, client.DeleteUser(ctx, localUserID)
+	})
+	report.OK = updated && deleted
+	return report
+}
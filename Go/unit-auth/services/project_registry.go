@@ -1,23 +1,28 @@
 package services
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"errors"
-	"fmt"
 	"net/http"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"unit-auth/config"
 	"unit-auth/models"
 
 	"gorm.io/gorm"
 )
 
+// projectRegistryTTL 启用项目缓存的有效期；本实例修改项目时立即失效，其他实例最多延迟该时长
+const projectRegistryTTL = 30 * time.Second
+
+// Projects 全局项目缓存（CORS 等每个请求都要读取项目配置的场景使用）
+var Projects = NewProjectRegistry()
+
 // ProjectRegistry caches projects by key
 type ProjectRegistry struct {
+	mu       sync.RWMutex
 	projects map[string]models.Project
+	loadedAt time.Time
 	client   *http.Client
 }
 
@@ -36,117 +41,60 @@ func (r *ProjectRegistry) GetByKey(db *gorm.DB, key string) (*models.Project, er
 	return &p, nil
 }
 
-// ProjectClient provides minimal operations with third-party project
-type ProjectClient struct {
-	Project models.Project
-	HTTP    *http.Client
-}
-
-type OutboundUser struct {
-	UserID   string `json:"user_id"`
-	Email    string `json:"email,omitempty"`
-	Username string `json:"username"`
-	Nickname string `json:"nickname"`
-	Avatar   string `json:"avatar"`
-}
-
-type CreateUserResp struct {
-	UserID any `json:"user_id"`
-}
-
-func NewProjectClient(p models.Project) *ProjectClient {
-	return &ProjectClient{Project: p, HTTP: &http.Client{Timeout: 5 * time.Second}}
+// Invalidate 使缓存失效（项目创建、修改、删除后调用）
+func (r *ProjectRegistry) Invalidate() {
+	r.mu.Lock()
+	r.loadedAt = time.Time{}
+	r.mu.Unlock()
 }
 
-/**
-* 说明：
-	创建用户，用于第三方项目对接
-* 接口示例
-	curl -X POST http://localhost:9001/api/v1/users -H "Content-Type: application/json" -d '{"user_id": "1234567890", "email": "test@example.com", "username": "test", "nickname": "test", "avatar": "https://example.com/avatar.png"}'
-* 请求参数：
-	user_id: 用户ID
-	email: 邮箱
-	username: 用户名
-	nickname: 昵称
-	avatar: 头像
-* 响应参数：
-	user_id: 用户ID
-*/
-
-func (c *ProjectClient) CreateUser(ctx context.Context, u OutboundUser) (string, error) {
-	url := fmt.Sprintf("%s/api/v1/users", c.Project.BaseURL)
-	body, _ := json.Marshal(u)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
-	req.Header.Set("Content-Type", "application/json")
-	if c.Project.AuthMode == "api_key" && c.Project.CredentialsEnc != "" {
-		req.Header.Set("X-Project-Token", c.Project.CredentialsEnc)
-	}
-	resp, err := c.HTTP.Do(req)
-	if err != nil {
-		return "", err
+// Enabled 返回缓存的启用项目，过期时从数据库重新加载；加载失败时沿用旧缓存
+func (r *ProjectRegistry) Enabled(db *gorm.DB) map[string]models.Project {
+	r.mu.RLock()
+	if time.Since(r.loadedAt) < projectRegistryTTL {
+		defer r.mu.RUnlock()
+		return r.projects
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		return "", errors.New("remote create user failed")
-	}
-	var r CreateUserResp
-	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
-		return "", err
-	}
-	// normalize user_id to string
-	var id string
-	switch v := r.UserID.(type) {
-	case string:
-		id = v
-	case float64:
-		id = strconv.FormatInt(int64(v), 10)
-	case json.Number:
-		if iv, err := v.Int64(); err == nil {
-			id = strconv.FormatInt(iv, 10)
-		} else {
-			id = v.String()
-		}
-	default:
-		id = fmt.Sprintf("%v", v)
-	}
-	if id == "" {
-		return "", errors.New("empty local user id")
-	}
-	return id, nil
-}
+	r.mu.RUnlock()
 
-func (c *ProjectClient) UpdateUser(ctx context.Context, localUserID string, u OutboundUser) error {
-	url := fmt.Sprintf("%s/api/v1/users/%s", c.Project.BaseURL, localUserID)
-	body, _ := json.Marshal(u)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
-	req.Header.Set("Content-Type", "application/json")
-	if c.Project.AuthMode == "api_key" && c.Project.CredentialsEnc != "" {
-		req.Header.Set("X-Project-Token", c.Project.CredentialsEnc)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.loadedAt) < projectRegistryTTL {
+		return r.projects
 	}
-	resp, err := c.HTTP.Do(req)
-	if err != nil {
-		return err
+	var list []models.Project
+	if err := db.Where("enabled = ?", true).Find(&list).Error; err != nil {
+		// 避免数据库故障时每个请求都重试加载
+		r.loadedAt = time.Now().Add(-projectRegistryTTL + 5*time.Second)
+		return r.projects
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		return errors.New("remote update user failed")
+	projects := make(map[string]models.Project, len(list))
+	for _, p := range list {
+		projects[p.Key] = p
 	}
-	return nil
+	r.projects = projects
+	r.loadedAt = time.Now()
+	return r.projects
 }
 
-func (c *ProjectClient) DeleteUser(ctx context.Context, localUserID string) error {
-	url := fmt.Sprintf("%s/api/v1/users/%s", c.Project.BaseURL, localUserID)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
-	if c.Project.AuthMode == "api_key" && c.Project.CredentialsEnc != "" {
-		req.Header.Set("X-Project-Token", c.Project.CredentialsEnc)
-	}
-	resp, err := c.HTTP.Do(req)
-	if err != nil {
-		return err
+// IsOriginAllowed 判断跨域来源是否被允许；restricted 为 false 表示未配置任何来源限制（CORS_ALLOWED_ORIGINS 与项目 allowed_origins 均为空）
+func (r *ProjectRegistry) IsOriginAllowed(db *gorm.DB, origin string) (allowed bool, restricted bool) {
+	origin = strings.TrimRight(origin, "/")
+	for _, item := range strings.Split(config.AppConfig.CORSAllowedOrigins, ",") {
+		if item = strings.TrimRight(strings.TrimSpace(item), "/"); item != "" {
+			restricted = true
+			if strings.EqualFold(item, origin) {
+				return true, true
+			}
+		}
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		return errors.New("remote delete user failed")
+	for _, p := range r.Enabled(db) {
+		for _, item := range p.GetAllowedOrigins() {
+			restricted = true
+			if strings.EqualFold(item, origin) {
+				return true, true
+			}
+		}
 	}
-	return nil
+	return false, restricted
 }
@@ -0,0 +1,483 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"unit-auth/config"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProvisioningNotFound     = errors.New("provisioning job not found")
+	ErrProvisioningNotRetryable = errors.New("only dead-lettered provisioning jobs can be retried")
+	// ErrProvisioningFailed 强制映射注册在同步等待内开通失败，注册已撤销
+	ErrProvisioningFailed = errors.New("project provisioning failed")
+	// ErrProvisioningPending 强制映射注册在同步等待内未得到结果，用户已创建，开通在后台继续
+	ErrProvisioningPending = errors.New("project provisioning is still in progress")
+)
+
+var (
+	provisioningTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "project_provisioning_total",
+		Help: "Total number of project provisioning attempts by operation and result (success, retry, dead)",
+	}, []string{"operation", "result"})
+	provisioningDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "project_provisioning_duration_seconds",
+		Help:    "Project provisioning call duration in seconds",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+)
+
+// ProjectMappedHook 开通 worker 为用户新建项目映射后调用
+type ProjectMappedHook func(db *gorm.DB, userID, projectKey, localUserID string)
+
+var (
+	projectMappedMu    sync.RWMutex
+	projectMappedHooks []ProjectMappedHook
+)
+
+// OnProjectMapped 注册映射建立后的回调（WebhookDispatcher 借此向该项目补发 user.created）
+func OnProjectMapped(hook ProjectMappedHook) {
+	projectMappedMu.Lock()
+	defer projectMappedMu.Unlock()
+	projectMappedHooks = append(projectMappedHooks, hook)
+}
+
+func runProjectMappedHooks(db *gorm.DB, userID, projectKey, localUserID string) {
+	projectMappedMu.RLock()
+	hooks := projectMappedHooks
+	projectMappedMu.RUnlock()
+	for _, hook := range hooks {
+		hook(db, userID, projectKey, localUserID)
+	}
+}
+
+// provisioningWake 唤醒开通 worker（任务随业务事务写入，写入方不持有 worker 实例）
+var provisioningWake = make(chan struct{}, 1)
+
+func notifyProvisioning() {
+	select {
+	case provisioningWake <- struct{}{}:
+	default:
+	}
+}
+
+// EnqueueProvisioning 在 db（可为事务）中写入一条开通任务；事务回滚时任务一同回滚，不会产生远端调用
+func EnqueueProvisioning(db *gorm.DB, operation, projectKey, userID, localUserID string) (*models.ProjectProvisioning, error) {
+	job := models.ProjectProvisioning{
+		IdempotencyKey: "prov_" + uuid.NewString(),
+		ProjectKey:     projectKey,
+		UserID:         userID,
+		Operation:      operation,
+		LocalUserID:    localUserID,
+		Status:         models.ProvisioningPending,
+		NextAttemptAt:  time.Now(),
+	}
+	if err := db.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	notifyProvisioning()
+	return &job, nil
+}
+
+// EnqueueUserSync 为用户在所有启用项目中的有效映射写入 update / delete 任务，返回任务数
+func EnqueueUserSync(db *gorm.DB, operation, userID string) (int, error) {
+	var mappings []models.ProjectMapping
+	if err := db.Where("user_id = ? AND is_active = ?", userID, true).Find(&mappings).Error; err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, pm := range mappings {
+		var cnt int64
+		if err := db.Model(&models.Project{}).Where("`key` = ? AND enabled = ?", pm.ProjectName, true).Count(&cnt).Error; err != nil {
+			return count, err
+		}
+		if cnt == 0 {
+			continue
+		}
+		if _, err := EnqueueProvisioning(db, operation, pm.ProjectName, userID, pm.LocalUserID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// AwaitProjectProvisioning 等待用户在项目下的 create 任务首次执行结果（在写入任务的事务提交后调用）：
+// 成功返回 localUserID；首次执行即被项目拒绝（不可重试）或 worker 尚未领取时撤销任务并删除刚注册的用户，返回 ErrProvisioningFailed；
+// 可重试的失败（超时、5xx 等，项目可能已创建用户）或任务仍在执行中时返回 ErrProvisioningPending（用户保留，开通在后台带同一幂等键继续）
+func AwaitProjectProvisioning(ctx context.Context, db *gorm.DB, projectKey, userID string) (string, error) {
+	var pm models.ProjectMapping
+	if err := db.Where("project_name = ? AND user_id = ?", projectKey, userID).First(&pm).Error; err == nil {
+		return pm.LocalUserID, nil
+	}
+	var job models.ProjectProvisioning
+	if err := db.Where("project_key = ? AND user_id = ? AND operation = ? AND status <> ?",
+		projectKey, userID, models.ProvisioningCreate, models.ProvisioningCancelled).
+		Order("id DESC").First(&job).Error; err != nil {
+		return "", ErrProvisioningNotFound
+	}
+
+	notifyProvisioning()
+	wait := time.Duration(config.AppConfig.ProvisioningSyncWaitMS) * time.Millisecond
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if err := db.First(&job, job.ID).Error; err != nil {
+			return "", err
+		}
+		switch {
+		case job.Status == models.ProvisioningSucceeded:
+			return job.LocalUserID, nil
+		case job.Status == models.ProvisioningDead && provisioningRejected(&job):
+			return "", cancelRegistration(db, &job)
+		case job.Status == models.ProvisioningDead,
+			job.Status == models.ProvisioningPending && job.Attempts > 0:
+			return "", ErrProvisioningPending
+		}
+		select {
+		case <-ctx.Done():
+			return "", cancelRegistration(db, &job)
+		case <-timer.C:
+			return "", cancelRegistration(db, &job)
+		case <-ticker.C:
+		}
+	}
+}
+
+// provisioningRejected 死信任务只执行过一次且未达到重试上限，说明首次调用即被判定为不可重试（项目拒绝、项目或用户已不存在），
+// 项目侧没有创建用户
+func provisioningRejected(job *models.ProjectProvisioning) bool {
+	return job.Attempts == 1 && config.AppConfig.ProvisioningMaxAttempts > 1
+}
+
+// cancelRegistration 撤销从未发出（尚未被领取）或首次即被项目拒绝的 create 任务并删除刚注册的用户；
+// 任务已被领取或重试中时无法确认远端结果，保留用户
+func cancelRegistration(db *gorm.DB, job *models.ProjectProvisioning) error {
+	query := db.Model(&models.ProjectProvisioning{}).Where("id = ?", job.ID)
+	if job.Status == models.ProvisioningDead {
+		query = query.Where("status = ? AND attempts = ?", models.ProvisioningDead, job.Attempts)
+	} else {
+		query = query.Where("status = ? AND attempts = 0", models.ProvisioningPending)
+	}
+	res := query.Update("status", models.ProvisioningCancelled)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return ErrProvisioningPending
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", job.UserID).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", job.UserID).Delete(&models.ProjectMapping{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id = ?", job.UserID).Delete(&models.User{}).Error
+	})
+	if err != nil {
+		log.Printf("Warning: failed to roll back registration of user %s after provisioning failure: %v", job.UserID, err)
+	}
+	if job.LastError != "" {
+		return fmt.Errorf("%w: %s", ErrProvisioningFailed, job.LastError)
+	}
+	return ErrProvisioningFailed
+}
+
+// ProvisioningOutboxConfig 开通 worker 与重试配置
+type ProvisioningOutboxConfig struct {
+	Workers      int
+	MaxAttempts  int           // 达到后转入死信
+	RetryBase    time.Duration // 第 n 次失败后等待 RetryBase*2^(n-1)（带抖动），不超过 RetryMax
+	RetryMax     time.Duration
+	PollInterval time.Duration
+	Lease        time.Duration
+	CallTimeout  time.Duration
+}
+
+// ProvisioningOutbox 项目开通 worker：领取到期任务，带幂等键调用项目接口，失败按指数退避重试；
+// 同一项目同一用户存在更早未完成的任务时，后面的任务等待，保证 create → update → delete 的顺序
+type ProvisioningOutbox struct {
+	db  *gorm.DB
+	cfg ProvisioningOutboxConfig
+
+	jobs chan uint
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// NewProvisioningOutbox 创建开通 worker
+func NewProvisioningOutbox(db *gorm.DB, cfg ProvisioningOutboxConfig) *ProvisioningOutbox {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.RetryBase <= 0 {
+		cfg.RetryBase = 15 * time.Second
+	}
+	if cfg.RetryMax < cfg.RetryBase {
+		cfg.RetryMax = cfg.RetryBase
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	if cfg.CallTimeout <= 0 {
+		cfg.CallTimeout = 30 * time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = cfg.CallTimeout + time.Minute
+	}
+	return &ProvisioningOutbox{
+		db:   db,
+		cfg:  cfg,
+		jobs: make(chan uint, cfg.Workers),
+		stop: make(chan struct{}),
+	}
+}
+
+// NewProvisioningOutboxFromConfig 按 PROVISIONING_* 配置创建开通 worker
+func NewProvisioningOutboxFromConfig(db *gorm.DB) *ProvisioningOutbox {
+	return NewProvisioningOutbox(db, ProvisioningOutboxConfig{
+		Workers:     config.AppConfig.ProvisioningWorkers,
+		MaxAttempts: config.AppConfig.ProvisioningMaxAttempts,
+		RetryBase:   time.Duration(config.AppConfig.ProvisioningRetryBaseSeconds) * time.Second,
+		RetryMax:    time.Duration(config.AppConfig.ProvisioningRetryMaxSeconds) * time.Second,
+	})
+}
+
+// Start 启动调度协程与 worker
+func (o *ProvisioningOutbox) Start() {
+	log.Printf("🔗 启动项目开通发件箱: workers=%d max_attempts=%d", o.cfg.Workers, o.cfg.MaxAttempts)
+	for i := 0; i < o.cfg.Workers; i++ {
+		o.wg.Add(1)
+		go o.worker()
+	}
+	o.wg.Add(1)
+	go o.dispatch()
+}
+
+// Stop 停止领取新任务，等待进行中的调用完成
+func (o *ProvisioningOutbox) Stop() {
+	o.once.Do(func() { close(o.stop) })
+	o.wg.Wait()
+}
+
+func (o *ProvisioningOutbox) dispatch() {
+	defer o.wg.Done()
+	defer close(o.jobs)
+
+	ticker := time.NewTicker(o.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for _, id := range o.claim() {
+			select {
+			case o.jobs <- id:
+			case <-o.stop:
+				return
+			}
+		}
+		select {
+		case <-o.stop:
+			return
+		case <-ticker.C:
+		case <-provisioningWake:
+		}
+	}
+}
+
+func (o *ProvisioningOutbox) worker() {
+	defer o.wg.Done()
+	for id := range o.jobs {
+		o.execute(id)
+	}
+}
+
+// dueCondition 到期的待执行任务，以及租约已过期的执行中任务（worker 异常退出）
+func (o *ProvisioningOutbox) dueCondition(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)",
+		models.ProvisioningPending, now, models.ProvisioningSending, now)
+}
+
+// claim 领取一批到期任务：跳过前面还有未完成任务的用户，逐条条件更新为 sending
+func (o *ProvisioningOutbox) claim() []uint {
+	now := time.Now()
+	var due []models.ProjectProvisioning
+	if err := o.dueCondition(o.db.Model(&models.ProjectProvisioning{}), now).
+		Select("id", "project_key", "user_id").Order("id ASC").Limit(o.cfg.Workers * 4).Find(&due).Error; err != nil {
+		log.Printf("Warning: failed to poll provisioning outbox: %v", err)
+		return nil
+	}
+
+	lockedUntil := now.Add(o.cfg.Lease)
+	var claimed []uint
+	seen := map[string]bool{}
+	for _, job := range due {
+		subject := job.ProjectKey + "\x00" + job.UserID
+		if seen[subject] || len(claimed) >= o.cfg.Workers*2 {
+			continue
+		}
+		seen[subject] = true
+
+		var earlier int64
+		o.db.Model(&models.ProjectProvisioning{}).
+			Where("project_key = ? AND user_id = ? AND id < ? AND status IN ?", job.ProjectKey, job.UserID, job.ID,
+				[]string{models.ProvisioningPending, models.ProvisioningSending}).
+			Count(&earlier)
+		if earlier > 0 {
+			continue
+		}
+
+		res := o.dueCondition(o.db.Model(&models.ProjectProvisioning{}).Where("id = ?", job.ID), now).
+			Updates(map[string]interface{}{"status": models.ProvisioningSending, "locked_until": lockedUntil})
+		if res.Error != nil {
+			log.Printf("Warning: failed to claim provisioning job %d: %v", job.ID, res.Error)
+			continue
+		}
+		if res.RowsAffected == 1 {
+			claimed = append(claimed, job.ID)
+		}
+	}
+	return claimed
+}
+
+func (o *ProvisioningOutbox) execute(id uint) {
+	var job models.ProjectProvisioning
+	if err := o.db.First(&job, id).Error; err != nil {
+		log.Printf("Warning: failed to load provisioning job %d: %v", id, err)
+		return
+	}
+
+	start := time.Now()
+	localUserID, permanent, err := o.call(&job)
+	provisioningDuration.WithLabelValues(job.Operation).Observe(time.Since(start).Seconds())
+
+	now := time.Now()
+	updates := map[string]interface{}{"attempts": job.Attempts + 1, "locked_until": nil}
+	result := "success"
+	switch {
+	case err == nil:
+		updates["status"] = models.ProvisioningSucceeded
+		updates["completed_at"] = now
+		updates["last_error"] = ""
+		updates["local_user_id"] = localUserID
+	case permanent || job.Attempts+1 >= o.cfg.MaxAttempts:
+		result = "dead"
+		updates["status"] = models.ProvisioningDead
+		updates["last_error"] = truncate(err.Error(), 500)
+		log.Printf("Warning: %s of user %s in project %s dead-lettered after %d attempts: %v", job.Operation, job.UserID, job.ProjectKey, job.Attempts+1, err)
+	default:
+		result = "retry"
+		delay := utils.ExpBackoffJitter(o.cfg.RetryBase, o.cfg.RetryMax, job.Attempts+1)
+		updates["status"] = models.ProvisioningPending
+		updates["next_attempt_at"] = now.Add(delay)
+		updates["last_error"] = truncate(err.Error(), 500)
+		log.Printf("Warning: %s of user %s in project %s failed (attempt %d), retrying in %s: %v", job.Operation, job.UserID, job.ProjectKey, job.Attempts+1, delay.Round(time.Second), err)
+	}
+	provisioningTotal.WithLabelValues(job.Operation, result).Inc()
+
+	// 仅在仍持有租约时回写
+	if err := o.db.Model(&models.ProjectProvisioning{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, models.ProvisioningSending, job.Attempts).
+		Updates(updates).Error; err != nil {
+		log.Printf("Warning: failed to update provisioning job %d: %v", job.ID, err)
+	}
+}
+
+// call 执行一次项目调用，返回项目侧用户ID；permanent 表示重试无意义（项目或用户已不存在、项目返回不可重试的 4xx）
+func (o *ProvisioningOutbox) call(job *models.ProjectProvisioning) (string, bool, error) {
+	var p models.Project
+	if err := o.db.Where("`key` = ? AND enabled = ?", job.ProjectKey, true).First(&p).Error; err != nil {
+		return "", true, fmt.Errorf("project %s not found or disabled", job.ProjectKey)
+	}
+	ctx, cancel := context.WithTimeout(WithIdempotencyKey(context.Background(), job.IdempotencyKey), o.cfg.CallTimeout)
+	defer cancel()
+	client := NewProjectClient(p)
+
+	if job.Operation == models.ProvisioningDelete {
+		// 项目侧用户已不存在视为删除成功
+		var perr *ProjectError
+		if err := client.DeleteUser(ctx, job.LocalUserID); err != nil && !(errors.As(err, &perr) && perr.StatusCode == http.StatusNotFound) {
+			return "", !IsRetryableProjectError(err), err
+		}
+		if err := o.db.Model(&models.ProjectMapping{}).Where("project_name = ? AND user_id = ?", job.ProjectKey, job.UserID).
+			Update("is_active", false).Error; err != nil {
+			log.Printf("Warning: failed to deactivate mapping of user %s in project %s: %v", job.UserID, job.ProjectKey, err)
+		}
+		return job.LocalUserID, false, nil
+	}
+
+	var user models.User
+	if err := o.db.Where("id = ?", job.UserID).First(&user).Error; err != nil {
+		return "", true, fmt.Errorf("user %s not found", job.UserID)
+	}
+	resp := user.ToResponse()
+	outbound := OutboundUser{UserID: user.ID, Email: resp.Email, Phone: resp.Phone, Username: user.Username, Nickname: user.Nickname, Avatar: user.GetAvatar()}
+
+	if job.Operation == models.ProvisioningUpdate {
+		localUserID := job.LocalUserID
+		if localUserID == "" {
+			var pm models.ProjectMapping
+			if err := o.db.Where("project_name = ? AND user_id = ?", job.ProjectKey, job.UserID).First(&pm).Error; err != nil {
+				return "", true, fmt.Errorf("user %s has no mapping in project %s", job.UserID, job.ProjectKey)
+			}
+			localUserID = pm.LocalUserID
+		}
+		if err := client.UpdateUser(ctx, localUserID, outbound); err != nil {
+			return "", !IsRetryableProjectError(err), err
+		}
+		return localUserID, false, nil
+	}
+
+	// create：已有映射时不再调用项目
+	var pm models.ProjectMapping
+	if err := o.db.Where("project_name = ? AND user_id = ?", job.ProjectKey, job.UserID).First(&pm).Error; err == nil {
+		return pm.LocalUserID, false, nil
+	}
+	localUserID, err := client.CreateUser(ctx, outbound)
+	if err != nil {
+		return "", !IsRetryableProjectError(err), err
+	}
+	if err := o.db.Create(&models.ProjectMapping{UserID: user.ID, ProjectName: job.ProjectKey, LocalUserID: localUserID}).Error; err != nil {
+		// 项目已创建成功，重试时凭幂等键取回同一用户
+		return "", false, fmt.Errorf("save mapping: %w", err)
+	}
+	runProjectMappedHooks(o.db, user.ID, job.ProjectKey, localUserID)
+	return localUserID, false, nil
+}
+
+// Retry 将死信任务重新放回队列（重置重试次数）
+func (o *ProvisioningOutbox) Retry(id uint) (*models.ProjectProvisioning, error) {
+	var job models.ProjectProvisioning
+	if err := o.db.First(&job, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProvisioningNotFound
+		}
+		return nil, err
+	}
+	now := time.Now()
+	res := o.db.Model(&models.ProjectProvisioning{}).Where("id = ? AND status = ?", id, models.ProvisioningDead).
+		Updates(map[string]interface{}{"status": models.ProvisioningPending, "attempts": 0, "next_attempt_at": now})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrProvisioningNotRetryable
+	}
+	job.Status, job.Attempts, job.NextAttemptAt = models.ProvisioningPending, 0, now
+	notifyProvisioning()
+	return &job, nil
+}
@@ -0,0 +1,671 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"unit-auth/config"
+	"unit-auth/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReconciliationNotFound = errors.New("reconciliation not found")
+	ErrReconciliationActive   = errors.New("a reconciliation of this project is already pending, running or paused")
+	ErrReconciliationState    = errors.New("reconciliation cannot be changed in its current state")
+	ErrReconciliationProject  = errors.New("project not found or disabled")
+
+	// errReconcileStopped 任务已被暂停或取消（保存进度的条件更新未命中），当前批次不提交
+	errReconcileStopped = errors.New("reconciliation stopped")
+)
+
+var reconcileItemsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "project_reconcile_items_total",
+	Help: "Total number of issues found by project mapping reconciliation by kind and action",
+}, []string{"project", "kind", "action"})
+
+// MappingReconcilerConfig 映射核对配置
+type MappingReconcilerConfig struct {
+	PollInterval  time.Duration
+	Lease         time.Duration
+	BatchSize     int
+	RatePerSecond int
+}
+
+// MappingReconciler 项目映射核对：按阶段核对已有映射（verify）、列出项目用户补建映射（remote）、
+// 为没有映射的正常用户写入 create 开通任务（backfill）。每批的写入与游标在同一事务中提交，
+// 中断（暂停、项目不可用、实例退出）后从游标继续；试运行只记录报告，不做任何修改
+type MappingReconciler struct {
+	db  *gorm.DB
+	cfg MappingReconcilerConfig
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wake    chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+// NewMappingReconciler 创建映射核对器
+func NewMappingReconciler(db *gorm.DB, cfg MappingReconcilerConfig) *MappingReconciler {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 15 * time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 2 * time.Minute
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.RatePerSecond <= 0 {
+		cfg.RatePerSecond = 10
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MappingReconciler{
+		db:      db,
+		cfg:     cfg,
+		running: map[uint]context.CancelFunc{},
+		ctx:     ctx,
+		cancel:  cancel,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+}
+
+// NewMappingReconcilerFromConfig 按 RECONCILE_* 配置创建映射核对器
+func NewMappingReconcilerFromConfig(db *gorm.DB) *MappingReconciler {
+	return NewMappingReconciler(db, MappingReconcilerConfig{
+		PollInterval:  time.Duration(config.AppConfig.ReconcilePollSeconds) * time.Second,
+		Lease:         time.Duration(config.AppConfig.ReconcileLeaseSeconds) * time.Second,
+		BatchSize:     config.AppConfig.ReconcileBatchSize,
+		RatePerSecond: config.AppConfig.ReconcileRatePerSecond,
+	})
+}
+
+// Start 启动调度协程
+func (r *MappingReconciler) Start() {
+	log.Printf("🔍 启动项目映射核对: batch=%d rate=%d/s poll=%s", r.cfg.BatchSize, r.cfg.RatePerSecond, r.cfg.PollInterval)
+	r.wg.Add(1)
+	go r.schedule()
+}
+
+// Stop 停止调度；执行中的任务释放租约，下次（或其他实例）从游标继续
+func (r *MappingReconciler) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+		r.cancel()
+	})
+	r.wg.Wait()
+}
+
+func (r *MappingReconciler) schedule() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		r.runDue()
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+func (r *MappingReconciler) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runDue 依次执行等待中的任务，以及租约已过期（实例异常退出）的执行中任务
+func (r *MappingReconciler) runDue() {
+	now := time.Now()
+	var runs []models.ProjectReconciliation
+	if err := r.db.Where("status = ? OR (status = ? AND (locked_until IS NULL OR locked_until < ?))",
+		models.ReconcilePending, models.ReconcileRunning, now).
+		Order("id ASC").Limit(10).Find(&runs).Error; err != nil {
+		log.Printf("Warning: failed to query due reconciliations: %v", err)
+		return
+	}
+	for i := range runs {
+		if r.ctx.Err() != nil {
+			return
+		}
+		if r.claim(&runs[i]) {
+			r.execute(&runs[i])
+		}
+	}
+}
+
+// claim 条件更新为 running 并设置租约，未领取到（已被其他实例领取或状态已变）返回 false
+func (r *MappingReconciler) claim(run *models.ProjectReconciliation) bool {
+	now := time.Now()
+	lockedUntil := now.Add(r.cfg.Lease)
+	updates := map[string]interface{}{"status": models.ReconcileRunning, "locked_until": lockedUntil, "last_error": ""}
+	if run.StartedAt == nil {
+		updates["started_at"] = now
+		run.StartedAt = &now
+	}
+	res := r.db.Model(&models.ProjectReconciliation{}).
+		Where("id = ? AND (status = ? OR (status = ? AND (locked_until IS NULL OR locked_until < ?)))",
+			run.ID, models.ReconcilePending, models.ReconcileRunning, now).
+		Updates(updates)
+	if res.Error != nil {
+		log.Printf("Warning: failed to claim reconciliation %d: %v", run.ID, res.Error)
+		return false
+	}
+	if res.RowsAffected == 0 {
+		return false
+	}
+	run.Status, run.LockedUntil, run.LastError = models.ReconcileRunning, &lockedUntil, ""
+	return true
+}
+
+// StartRun 为项目创建核对任务；同一项目同时只能有一个未结束（等待、执行中、暂停）的任务
+func (r *MappingReconciler) StartRun(projectKey string, req models.StartReconciliationRequest, actorID string) (*models.ProjectReconciliation, error) {
+	var project models.Project
+	if err := r.db.Where("`key` = ? AND enabled = ?", projectKey, true).First(&project).Error; err != nil {
+		return nil, ErrReconciliationProject
+	}
+	var active int64
+	if err := r.db.Model(&models.ProjectReconciliation{}).
+		Where("project_key = ? AND status IN ?", projectKey, []string{models.ReconcilePending, models.ReconcileRunning, models.ReconcilePaused}).
+		Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if active > 0 {
+		return nil, ErrReconciliationActive
+	}
+
+	run := &models.ProjectReconciliation{
+		ProjectKey:    projectKey,
+		DryRun:        req.DryRun,
+		Backfill:      req.Backfill,
+		BatchSize:     req.BatchSize,
+		RatePerSecond: req.RatePerSecond,
+		Status:        models.ReconcilePending,
+		Phase:         models.ReconcilePhaseVerify,
+		CreatedBy:     actorID,
+	}
+	if run.BatchSize <= 0 {
+		run.BatchSize = r.cfg.BatchSize
+	}
+	if run.RatePerSecond <= 0 {
+		run.RatePerSecond = r.cfg.RatePerSecond
+	}
+	if err := r.db.Create(run).Error; err != nil {
+		return nil, err
+	}
+	r.notify()
+	return run, nil
+}
+
+// Pause 暂停任务，保留游标
+func (r *MappingReconciler) Pause(id uint) (*models.ProjectReconciliation, error) {
+	return r.transition(id, []string{models.ReconcilePending, models.ReconcileRunning},
+		map[string]interface{}{"status": models.ReconcilePaused, "locked_until": nil})
+}
+
+// Resume 从游标继续已暂停或失败的任务
+func (r *MappingReconciler) Resume(id uint) (*models.ProjectReconciliation, error) {
+	run, err := r.transition(id, []string{models.ReconcilePaused, models.ReconcileFailed},
+		map[string]interface{}{"status": models.ReconcilePending, "last_error": ""})
+	if err == nil {
+		r.notify()
+	}
+	return run, err
+}
+
+// Cancel 取消未结束的任务，已提交的批次不回滚
+func (r *MappingReconciler) Cancel(id uint) (*models.ProjectReconciliation, error) {
+	return r.transition(id, []string{models.ReconcilePending, models.ReconcileRunning, models.ReconcilePaused, models.ReconcileFailed},
+		map[string]interface{}{"status": models.ReconcileCancelled, "locked_until": nil, "finished_at": time.Now()})
+}
+
+// transition 条件更新任务状态；执行中的任务在本实例时立即中断，在其他实例时于当前批次提交前停止
+func (r *MappingReconciler) transition(id uint, from []string, updates map[string]interface{}) (*models.ProjectReconciliation, error) {
+	res := r.db.Model(&models.ProjectReconciliation{}).Where("id = ? AND status IN ?", id, from).Updates(updates)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	var run models.ProjectReconciliation
+	if err := r.db.First(&run, id).Error; err != nil {
+		return nil, ErrReconciliationNotFound
+	}
+	if res.RowsAffected == 0 {
+		return &run, ErrReconciliationState
+	}
+	r.mu.Lock()
+	if cancel, ok := r.running[id]; ok {
+		cancel()
+	}
+	r.mu.Unlock()
+	return &run, nil
+}
+
+// reconcileStats 一个批次的计数增量
+type reconcileStats struct {
+	checked, verified, localOrphans, mismatches, remoteScanned, remoteOrphans, linked, missing, enqueued, errors int64
+}
+
+// reconcileBatch 一个批次的结果：报告条目、写入（试运行时为空）与新游标
+type reconcileBatch struct {
+	stats  reconcileStats
+	items  []models.ProjectReconciliationItem
+	writes []func(tx *gorm.DB) error
+	cursor string
+	done   bool
+}
+
+func (b *reconcileBatch) add(kind, action, userID, localUserID string, mappingID uint, detail string) {
+	b.items = append(b.items, models.ProjectReconciliationItem{
+		Kind: kind, Action: action, UserID: userID, LocalUserID: localUserID, MappingID: mappingID, Detail: truncate(detail, 500),
+	})
+}
+
+// reconcileLimiter 按固定间隔放行项目调用（每秒 rate 次）
+type reconcileLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newReconcileLimiter(rate int) *reconcileLimiter {
+	if rate <= 0 {
+		rate = 1
+	}
+	return &reconcileLimiter{interval: time.Second / time.Duration(rate)}
+}
+
+func (l *reconcileLimiter) wait(ctx context.Context) error {
+	now := time.Now()
+	if l.next.After(now) {
+		timer := time.NewTimer(l.next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		now = l.next
+	}
+	l.next = now.Add(l.interval)
+	return nil
+}
+
+func (r *MappingReconciler) execute(run *models.ProjectReconciliation) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.mu.Lock()
+	r.running[run.ID] = cancel
+	r.mu.Unlock()
+	defer func() {
+		cancel()
+		r.mu.Lock()
+		delete(r.running, run.ID)
+		r.mu.Unlock()
+	}()
+
+	// 单个批次可能超过租约（速率较低时），执行期间定期续租
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.cfg.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.db.Model(&models.ProjectReconciliation{}).Where("id = ? AND status = ?", run.ID, models.ReconcileRunning).
+					Update("locked_until", time.Now().Add(r.cfg.Lease))
+			}
+		}
+	}()
+
+	err := r.run(ctx, run)
+	now := time.Now()
+	running := r.db.Model(&models.ProjectReconciliation{}).Where("id = ? AND status = ?", run.ID, models.ReconcileRunning)
+	switch {
+	case err == nil:
+		running.Updates(map[string]interface{}{"status": models.ReconcileCompleted, "phase": models.ReconcilePhaseDone, "locked_until": nil, "finished_at": now})
+		log.Printf("Project %s reconciliation %d completed: checked=%d local_orphans=%d remote_orphans=%d linked=%d missing=%d enqueued=%d",
+			run.ProjectKey, run.ID, run.Checked, run.LocalOrphans, run.RemoteOrphans, run.Linked, run.Missing, run.Enqueued)
+	case errors.Is(err, errReconcileStopped):
+		// 已被暂停或取消
+	case ctx.Err() != nil:
+		// 实例退出或被暂停 / 取消：仍为 running 时释放租约，稍后从游标继续
+		running.Updates(map[string]interface{}{"status": models.ReconcilePending, "locked_until": nil})
+	default:
+		log.Printf("Warning: project %s reconciliation %d failed in phase %s: %v", run.ProjectKey, run.ID, run.Phase, err)
+		running.Updates(map[string]interface{}{"status": models.ReconcileFailed, "locked_until": nil, "last_error": truncate(err.Error(), 1000)})
+	}
+}
+
+// run 按阶段逐批执行，每批提交后推进游标
+func (r *MappingReconciler) run(ctx context.Context, run *models.ProjectReconciliation) error {
+	var project models.Project
+	if err := r.db.Where("`key` = ? AND enabled = ?", run.ProjectKey, true).First(&project).Error; err != nil {
+		return ErrReconciliationProject
+	}
+	client := NewProjectClient(project)
+	limiter := newReconcileLimiter(run.RatePerSecond)
+	batchSize := run.BatchSize
+	if batchSize <= 0 {
+		batchSize = r.cfg.BatchSize
+	}
+
+	for run.Phase != models.ReconcilePhaseDone {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var batch *reconcileBatch
+		var err error
+		switch run.Phase {
+		case models.ReconcilePhaseVerify:
+			batch, err = r.verifyBatch(ctx, run, client, limiter, batchSize)
+		case models.ReconcilePhaseRemote:
+			batch, err = r.remoteBatch(ctx, run, client, limiter, batchSize)
+		case models.ReconcilePhaseBackfill:
+			batch, err = r.backfillBatch(ctx, run, limiter, batchSize)
+		default:
+			return fmt.Errorf("unknown phase %q", run.Phase)
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.commit(run, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit 在一个事务中执行批次的写入、保存报告条目并推进游标；任务已不是 running 时整批回滚
+func (r *MappingReconciler) commit(run *models.ProjectReconciliation, batch *reconcileBatch) error {
+	next := *run
+	s := batch.stats
+	next.Checked += s.checked
+	next.Verified += s.verified
+	next.LocalOrphans += s.localOrphans
+	next.Mismatches += s.mismatches
+	next.RemoteScanned += s.remoteScanned
+	next.RemoteOrphans += s.remoteOrphans
+	next.Linked += s.linked
+	next.Missing += s.missing
+	next.Enqueued += s.enqueued
+	next.Errors += s.errors
+	next.Cursor = batch.cursor
+	if batch.done {
+		next.Phase, next.Cursor = nextReconcilePhase(run.Phase), ""
+	}
+	lockedUntil := time.Now().Add(r.cfg.Lease)
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.ProjectReconciliation{}).Where("id = ? AND status = ?", run.ID, models.ReconcileRunning).
+			Updates(map[string]interface{}{
+				"phase": next.Phase, "cursor": next.Cursor, "locked_until": lockedUntil,
+				"checked": next.Checked, "verified": next.Verified, "local_orphans": next.LocalOrphans, "mismatches": next.Mismatches,
+				"remote_scanned": next.RemoteScanned, "remote_orphans": next.RemoteOrphans, "linked": next.Linked,
+				"missing": next.Missing, "enqueued": next.Enqueued, "errors": next.Errors,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errReconcileStopped
+		}
+		for _, write := range batch.writes {
+			if err := write(tx); err != nil {
+				return err
+			}
+		}
+		if len(batch.items) == 0 {
+			return nil
+		}
+		for i := range batch.items {
+			batch.items[i].RunID = run.ID
+		}
+		return tx.CreateInBatches(batch.items, 100).Error
+	})
+	if err != nil {
+		return err
+	}
+	next.LockedUntil = &lockedUntil
+	*run = next
+	for _, item := range batch.items {
+		reconcileItemsTotal.WithLabelValues(run.ProjectKey, item.Kind, item.Action).Inc()
+	}
+	return nil
+}
+
+func nextReconcilePhase(phase string) string {
+	switch phase {
+	case models.ReconcilePhaseVerify:
+		return models.ReconcilePhaseRemote
+	case models.ReconcilePhaseRemote:
+		return models.ReconcilePhaseBackfill
+	}
+	return models.ReconcilePhaseDone
+}
+
+// projectUnavailable 项目不可用或认证配置错误：中断任务（失败后可从游标恢复），而不是逐条记为错误
+func projectUnavailable(err error) bool {
+	var perr *ProjectError
+	if !errors.As(err, &perr) {
+		return true
+	}
+	if perr.Retryable || perr.Kind == ProjectErrorConfig {
+		return true
+	}
+	switch perr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	return false
+}
+
+func isProjectNotFound(err error) bool {
+	var perr *ProjectError
+	return errors.As(err, &perr) && perr.StatusCode == http.StatusNotFound
+}
+
+// verifyBatch 逐个读取已有映射对应的项目用户：不存在时标记映射 orphaned_at，user_id 不一致时记录；
+// 之前标记过的映射再次核对通过时清除标记
+func (r *MappingReconciler) verifyBatch(ctx context.Context, run *models.ProjectReconciliation, client *ProjectClient, limiter *reconcileLimiter, batchSize int) (*reconcileBatch, error) {
+	afterID, _ := strconv.ParseUint(run.Cursor, 10, 64)
+	var mappings []models.ProjectMapping
+	if err := r.db.Where("project_name = ? AND is_active = ? AND id > ?", run.ProjectKey, true, afterID).
+		Order("id ASC").Limit(batchSize).Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+	batch := &reconcileBatch{cursor: run.Cursor, done: len(mappings) < batchSize}
+	now := time.Now()
+	for i := range mappings {
+		pm := mappings[i]
+		if err := limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		remote, err := client.GetUser(ctx, pm.LocalUserID)
+		switch {
+		case isProjectNotFound(err):
+			batch.stats.localOrphans++
+			action := models.ReconcileActionFlagged
+			if run.DryRun {
+				action = models.ReconcileActionNone
+			} else if pm.OrphanedAt == nil {
+				batch.writes = append(batch.writes, func(tx *gorm.DB) error {
+					return tx.Model(&models.ProjectMapping{}).Where("id = ?", pm.ID).Update("orphaned_at", now).Error
+				})
+			}
+			batch.add(models.ReconcileLocalOrphan, action, pm.UserID, pm.LocalUserID, pm.ID, "project user not found")
+		case err != nil && projectUnavailable(err):
+			return nil, err
+		case err != nil:
+			batch.stats.errors++
+			batch.add(models.ReconcileError, models.ReconcileActionNone, pm.UserID, pm.LocalUserID, pm.ID, err.Error())
+		case remote.UserID != "" && remote.UserID != pm.UserID:
+			batch.stats.mismatches++
+			batch.add(models.ReconcileMismatch, models.ReconcileActionNone, pm.UserID, pm.LocalUserID, pm.ID,
+				"project user belongs to unit-auth user "+remote.UserID)
+		default:
+			batch.stats.verified++
+			if pm.OrphanedAt != nil && !run.DryRun {
+				batch.writes = append(batch.writes, func(tx *gorm.DB) error {
+					return tx.Model(&models.ProjectMapping{}).Where("id = ?", pm.ID).Update("orphaned_at", nil).Error
+				})
+			}
+		}
+		batch.stats.checked++
+		batch.cursor = strconv.FormatUint(uint64(pm.ID), 10)
+	}
+	return batch, nil
+}
+
+// remoteBatch 列出一页项目用户：有 user_id 且该用户尚无映射时补建映射，找不到对应用户或映射已停用时记为项目侧孤立用户。
+// 项目不支持列表接口（404 / 405 / 501）时跳过该阶段
+func (r *MappingReconciler) remoteBatch(ctx context.Context, run *models.ProjectReconciliation, client *ProjectClient, limiter *reconcileLimiter, batchSize int) (*reconcileBatch, error) {
+	if err := limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	page, err := client.ListUsers(ctx, run.Cursor, batchSize)
+	if err != nil {
+		var perr *ProjectError
+		if errors.As(err, &perr) && (perr.StatusCode == http.StatusNotFound || perr.StatusCode == http.StatusMethodNotAllowed || perr.StatusCode == http.StatusNotImplemented) {
+			batch := &reconcileBatch{done: true}
+			batch.add(models.ReconcileError, models.ReconcileActionNone, "", "", 0, "project does not support listing users, remote phase skipped: "+err.Error())
+			return batch, nil
+		}
+		return nil, err
+	}
+	batch := &reconcileBatch{cursor: page.NextCursor, done: page.NextCursor == "" || page.NextCursor == run.Cursor || len(page.Users) == 0}
+
+	localIDs := make([]string, 0, len(page.Users))
+	userIDs := make([]string, 0, len(page.Users))
+	for i := range page.Users {
+		if id := page.Users[i].LocalUserID(); id != "" {
+			localIDs = append(localIDs, id)
+		}
+		if page.Users[i].UserID != "" {
+			userIDs = append(userIDs, page.Users[i].UserID)
+		}
+	}
+	byLocal := map[string]models.ProjectMapping{}
+	byUser := map[string]models.ProjectMapping{}
+	if len(localIDs) > 0 || len(userIDs) > 0 {
+		var mappings []models.ProjectMapping
+		if err := r.db.Where("project_name = ? AND (local_user_id IN ? OR user_id IN ?)", run.ProjectKey, append(localIDs, ""), append(userIDs, "")).
+			Find(&mappings).Error; err != nil {
+			return nil, err
+		}
+		for _, pm := range mappings {
+			byLocal[pm.LocalUserID] = pm
+			byUser[pm.UserID] = pm
+		}
+	}
+	existing := map[string]bool{}
+	if len(userIDs) > 0 {
+		var ids []string
+		if err := r.db.Model(&models.User{}).Where("id IN ?", userIDs).Pluck("id", &ids).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			existing[id] = true
+		}
+	}
+
+	for i := range page.Users {
+		u := page.Users[i]
+		batch.stats.remoteScanned++
+		localID := u.LocalUserID()
+		if localID == "" {
+			batch.stats.errors++
+			batch.add(models.ReconcileError, models.ReconcileActionNone, u.UserID, "", 0, "project user has no id")
+			continue
+		}
+		if pm, ok := byLocal[localID]; ok {
+			if !pm.IsActive {
+				batch.stats.remoteOrphans++
+				batch.add(models.ReconcileRemoteOrphan, models.ReconcileActionNone, pm.UserID, localID, pm.ID, "mapping is inactive but the project user still exists")
+			}
+			continue // 有效映射已在 verify 阶段核对
+		}
+		switch {
+		case u.UserID == "":
+			batch.stats.remoteOrphans++
+			batch.add(models.ReconcileRemoteOrphan, models.ReconcileActionNone, "", localID, 0, "project user has no unit-auth user_id")
+		case !existing[u.UserID]:
+			batch.stats.remoteOrphans++
+			batch.add(models.ReconcileRemoteOrphan, models.ReconcileActionNone, u.UserID, localID, 0, "unit-auth user not found or deleted")
+		default:
+			if pm, ok := byUser[u.UserID]; ok {
+				batch.stats.remoteOrphans++
+				batch.add(models.ReconcileRemoteOrphan, models.ReconcileActionNone, u.UserID, localID, pm.ID, "user is already mapped to project user "+pm.LocalUserID)
+				continue
+			}
+			batch.stats.linked++
+			pm := models.ProjectMapping{UserID: u.UserID, ProjectName: run.ProjectKey, LocalUserID: localID, IsActive: true}
+			byUser[u.UserID] = pm // 同一页中重复的 user_id 只补建一次
+			if run.DryRun {
+				batch.add(models.ReconcileMissing, models.ReconcileActionNone, u.UserID, localID, 0, "mapping would be created from the project user")
+				continue
+			}
+			batch.writes = append(batch.writes, func(tx *gorm.DB) error {
+				return tx.Create(&pm).Error
+			})
+			batch.add(models.ReconcileMissing, models.ReconcileActionLinked, u.UserID, localID, 0, "mapping created from the project user")
+		}
+	}
+	return batch, nil
+}
+
+// backfillBatch 为没有映射（也没有进行中的 create 任务）的正常用户写入 create 开通任务，由开通 worker 带幂等键创建项目用户；
+// 写入按速率限制，避免开通 worker 一次积压大量任务。未开启 backfill 时跳过该阶段
+func (r *MappingReconciler) backfillBatch(ctx context.Context, run *models.ProjectReconciliation, limiter *reconcileLimiter, batchSize int) (*reconcileBatch, error) {
+	if !run.Backfill {
+		return &reconcileBatch{done: true}, nil
+	}
+	var users []models.User
+	err := r.db.Select("id", "username").
+		Where("status = ? AND id > ?", "active", run.Cursor).
+		Where("NOT EXISTS (SELECT 1 FROM project_mappings pm WHERE pm.user_id = users.id AND pm.project_name = ?)", run.ProjectKey).
+		Where("NOT EXISTS (SELECT 1 FROM project_provisionings pp WHERE pp.user_id = users.id AND pp.project_key = ? AND pp.operation = ? AND pp.status IN ?)",
+			run.ProjectKey, models.ProvisioningCreate, []string{models.ProvisioningPending, models.ProvisioningSending}).
+		Order("id ASC").Limit(batchSize).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	batch := &reconcileBatch{cursor: run.Cursor, done: len(users) < batchSize}
+	for i := range users {
+		user := users[i]
+		batch.stats.missing++
+		batch.cursor = user.ID
+		if run.DryRun {
+			batch.add(models.ReconcileMissing, models.ReconcileActionNone, user.ID, "", 0, "user "+user.Username+" has no mapping")
+			continue
+		}
+		if err := limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		batch.stats.enqueued++
+		batch.writes = append(batch.writes, func(tx *gorm.DB) error {
+			_, err := EnqueueProvisioning(tx, models.ProvisioningCreate, run.ProjectKey, user.ID, "")
+			return err
+		})
+		batch.add(models.ReconcileMissing, models.ReconcileActionEnqueued, user.ID, "", 0, "create provisioning job queued")
+	}
+	return batch, nil
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
@@ -52,7 +53,7 @@ func RegisterUser(db *gorm.DB, mailer *utils.Mailer, opts RegistrationOptions) (
 			if opts.Email != nil && *opts.Email != "" {
 				username = strings.Split(*opts.Email, "@")[0]
 			} else if opts.Phone != nil && *opts.Phone != "" {
-				username = *opts.Phone
+				username = utils.PhoneUsername(*opts.Phone)
 			} else {
 				username = fmt.Sprintf("user_%d", time.Now().Unix())
 			}
@@ -99,25 +100,20 @@ func RegisterUser(db *gorm.DB, mailer *utils.Mailer, opts RegistrationOptions) (
 			return err
 		}
 
-		// 强制项目映射（可选）
+		// 项目映射（可选）：只写入开通任务，远端调用在事务提交后由开通 worker 执行
 		if strings.TrimSpace(opts.ProjectKey) != "" {
-			var ctx context.Context = context.Background()
-			if opts.GinContext != nil {
-				ctx = opts.GinContext.Request.Context()
-			}
-			email := ""
-			if opts.Email != nil {
-				email = *opts.Email
-			}
-			localID, mapErr := EnsureProjectMapping(ctx, tx, opts.ProjectKey, user, email)
+			localID, mapErr := EnsureProjectMapping(tx, opts.ProjectKey, user)
 			if mapErr != nil && opts.StrictProjectMapping {
 				return mapErr
 			}
-			if mapErr == nil && opts.GinContext != nil {
+			if localID != "" && opts.GinContext != nil {
 				opts.GinContext.Set("local_user_id", localID)
 			}
 		}
 
+		// 用户尚无项目映射，开通成功后由 WebhookDispatcher 向项目补发
+		PublishUserEvent(tx, EventUserCreated, user, "")
+
 		returnUser = user
 		return nil
 	})
@@ -125,10 +121,49 @@ func RegisterUser(db *gorm.DB, mailer *utils.Mailer, opts RegistrationOptions) (
 		return nil, err
 	}
 
+	// 强制映射：事务提交后等待首次开通结果；db 本身是调用方事务时由调用方提交后调用 FinishProjectProvisioning
+	if opts.StrictProjectMapping && strings.TrimSpace(opts.ProjectKey) != "" && !inTransaction(db) {
+		if err := FinishProjectProvisioning(opts.GinContext, db, opts.ProjectKey, returnUser.ID); err != nil {
+			return nil, err
+		}
+	}
+
 	// 发送欢迎邮件（可选、非事务）
 	if opts.SendWelcome && opts.Email != nil && *opts.Email != "" {
-		go mailer.SendWelcomeEmail(*opts.Email, returnUser.Username)
+		var ctx context.Context = context.Background()
+		if opts.GinContext != nil {
+			ctx = opts.GinContext
+		}
+		ec := EmailContextFor(db, ctx, *opts.Email)
+		if opts.ProjectKey != "" {
+			ec.ProjectKey = opts.ProjectKey
+		}
+		if err := mailer.SendWelcomeEmail(ec, *opts.Email, returnUser.Username); err != nil {
+			log.Printf("Warning: failed to enqueue welcome email for %s: %v", *opts.Email, err)
+		}
 	}
 
 	return returnUser, nil
 }
+
+// FinishProjectProvisioning 等待注册时写入的 create 开通任务（见 AwaitProjectProvisioning），成功后 Set("local_user_id", ...)
+func FinishProjectProvisioning(ginCtx *gin.Context, db *gorm.DB, projectKey, userID string) error {
+	var ctx context.Context = context.Background()
+	if ginCtx != nil {
+		ctx = ginCtx.Request.Context()
+	}
+	localID, err := AwaitProjectProvisioning(ctx, db, projectKey, userID)
+	if err != nil {
+		return err
+	}
+	if ginCtx != nil {
+		ginCtx.Set("local_user_id", localID)
+	}
+	return nil
+}
+
+// inTransaction db 是否为调用方开启的事务（事务内写入的开通任务在提交前对 worker 不可见）
+func inTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
@@ -0,0 +1,959 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"unit-auth/config"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+var ErrScimTokenInvalid = errors.New("invalid or expired SCIM token")
+
+// ScimError SCIM 接口错误：HTTP 状态与 scimType（RFC 7644 3.12）
+type ScimError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *ScimError) Error() string { return e.Detail }
+
+func scimError(status int, scimType, format string, args ...interface{}) *ScimError {
+	return &ScimError{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+// NewScimToken 生成 SCIM 令牌明文
+func NewScimToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "scim_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashScimToken 令牌摘要（SHA-256 十六进制）
+func HashScimToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateScimToken 为项目创建 SCIM 令牌，返回记录与明文（明文不落库）
+func CreateScimToken(db *gorm.DB, projectKey, name, createdBy string, ttl time.Duration) (*models.ScimToken, string, error) {
+	plain, err := NewScimToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := &models.ScimToken{
+		ProjectKey:  projectKey,
+		Name:        name,
+		TokenHash:   HashScimToken(plain),
+		TokenPrefix: plain[:12],
+		CreatedBy:   createdBy,
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		token.ExpiresAt = &expires
+	}
+	if err := db.Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, plain, nil
+}
+
+// AuthenticateScimToken 校验令牌（未吊销、未过期、项目已启用），返回令牌与项目
+func AuthenticateScimToken(db *gorm.DB, plain string) (*models.ScimToken, *models.Project, error) {
+	var token models.ScimToken
+	if err := db.Where("token_hash = ? AND revoked_at IS NULL", HashScimToken(plain)).First(&token).Error; err != nil {
+		return nil, nil, ErrScimTokenInvalid
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(now) {
+		return nil, nil, ErrScimTokenInvalid
+	}
+	var project models.Project
+	if err := db.Where("`key` = ? AND enabled = ?", token.ProjectKey, true).First(&project).Error; err != nil {
+		return nil, nil, ErrScimTokenInvalid
+	}
+	// 最近使用时间按分钟更新，避免每个请求都写库
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > time.Minute {
+		if err := db.Model(&token).Update("last_used_at", now).Error; err != nil {
+			log.Printf("Warning: failed to update SCIM token %d last_used_at: %v", token.ID, err)
+		}
+	}
+	return &token, &project, nil
+}
+
+// ScimETag 资源版本：不含 meta.version 的资源 JSON 摘要（弱 ETag）
+func ScimETag(resource interface{}) string {
+	raw, _ := json.Marshal(resource)
+	sum := sha256.Sum256(raw)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// scimPreconditionOK 校验 If-Match：为空或 * 时通过，否则须与当前版本之一相同
+func scimPreconditionOK(ifMatch, version string) bool {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+	for _, v := range strings.Split(ifMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(v), "W/") == strings.TrimPrefix(version, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ScimService 项目的 SCIM 资源：User 对应 users（资料字段在 meta），Group 对应 roles，成员为该项目的 user_roles
+type ScimService struct {
+	db      *gorm.DB
+	project models.Project
+	baseURL string
+}
+
+// NewScimService 创建项目的 SCIM 服务
+func NewScimService(db *gorm.DB, project models.Project) *ScimService {
+	return &ScimService{db: db, project: project, baseURL: strings.TrimRight(config.AppConfig.SCIMBaseURL, "/")}
+}
+
+// scimPage 规范化分页参数：startIndex 从 1 开始，count 不超过 SCIM_MAX_RESULTS
+func scimPage(startIndex, count int) (int, int) {
+	maxResults := config.AppConfig.SCIMMaxResults
+	if maxResults <= 0 {
+		maxResults = 200
+	}
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > maxResults {
+		count = maxResults
+	}
+	return startIndex, count
+}
+
+func scimList(total int64, startIndex int, resources []interface{}) *models.ScimListResponse {
+	return &models.ScimListResponse{
+		Schemas:      []string{models.ScimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// ---------- Users ----------
+
+// ListUsers 按过滤条件分页列出该项目开通的用户
+func (s *ScimService) ListUsers(filter string, startIndex, count int) (*models.ScimListResponse, error) {
+	startIndex, count = scimPage(startIndex, count)
+	query := s.db.Model(&models.User{}).
+		Joins("JOIN scim_user_links l ON l.user_id = users.id AND l.project_key = ?", s.project.Key)
+	if filter != "" {
+		where, args, err := s.filterSQL(filter, s.userColumns())
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(where, args...)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	resources := make([]interface{}, 0, count)
+	if count == 0 {
+		return scimList(total, startIndex, resources), nil
+	}
+
+	var users []models.User
+	if err := query.Select("users.*").Order("users.created_at ASC, users.id ASC").Offset(startIndex - 1).Limit(count).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	var links []models.ScimUserLink
+	s.db.Where("project_key = ? AND user_id IN ?", s.project.Key, ids).Find(&links)
+	linkByUser := make(map[string]*models.ScimUserLink, len(links))
+	for i := range links {
+		linkByUser[links[i].UserID] = &links[i]
+	}
+	groups := s.userGroups(ids)
+	for i := range users {
+		link := linkByUser[users[i].ID]
+		if link == nil {
+			link = &models.ScimUserLink{}
+		}
+		resources = append(resources, s.userResource(&users[i], link, groups[users[i].ID]))
+	}
+	return scimList(total, startIndex, resources), nil
+}
+
+// GetUser 读取用户
+func (s *ScimService) GetUser(id string) (*models.ScimUser, error) {
+	user, link, err := s.loadUser(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.userResource(user, link, s.userGroups([]string{id})[id]), nil
+}
+
+// CreateUser 创建用户并记录开通关系；用户名、邮箱、手机号已被占用时返回 409（不接管已有账号）。
+// 同一事务内写入 user.created 事件与该项目的开通任务
+func (s *ScimService) CreateUser(in *models.ScimUser) (*models.ScimUser, error) {
+	user := &models.User{Role: "user", Status: "active"}
+	link := &models.ScimUserLink{ProjectKey: s.project.Key}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.applyUser(tx, user, link, in); err != nil {
+			return err
+		}
+		if user.GetAvatar() == "" {
+			_ = user.SetAvatar(utils.GetDefaultAvatar(user.Username))
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return scimWriteError(err)
+		}
+		link.UserID = user.ID
+		if err := tx.Create(link).Error; err != nil {
+			return scimWriteError(err)
+		}
+		if _, err := EnsureProjectMapping(tx, s.project.Key, user); err != nil {
+			log.Printf("Warning: failed to enqueue provisioning for SCIM user %s: %v", user.ID, err)
+		}
+		PublishUserEvent(tx, EventUserCreated, user, "")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.userResource(user, link, nil), nil
+}
+
+// ReplaceUser PUT：以请求替换用户的全部可写属性（未提供的 emails / phoneNumbers 视为清空）
+func (s *ScimService) ReplaceUser(id, ifMatch string, in *models.ScimUser) (*models.ScimUser, error) {
+	var out *models.ScimUser
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, link, err := s.loadUser(tx, id)
+		if err != nil {
+			return err
+		}
+		current := s.userResource(user, link, s.userGroups([]string{id})[id])
+		if !scimPreconditionOK(ifMatch, current.Meta.Version) {
+			return scimError(http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+		}
+		out, err = s.saveUser(tx, user, link, in)
+		return err
+	})
+	return out, err
+}
+
+// PatchUser PATCH：在当前资源上依次执行操作后按 PUT 保存
+func (s *ScimService) PatchUser(id, ifMatch string, ops []models.ScimPatchOperation) (*models.ScimUser, error) {
+	var out *models.ScimUser
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, link, err := s.loadUser(tx, id)
+		if err != nil {
+			return err
+		}
+		current := s.userResource(user, link, s.userGroups([]string{id})[id])
+		if !scimPreconditionOK(ifMatch, current.Meta.Version) {
+			return scimError(http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+		}
+		current.Meta, current.Groups = nil, nil
+		doc, err := scimDocument(current)
+		if err != nil {
+			return err
+		}
+		if err := applyScimPatch(doc, ops, scimUserAttrs, "groups"); err != nil {
+			return err
+		}
+		// 部分 IdP 以字符串 "True" / "False" 传 active
+		if v, ok := doc["active"].(string); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return scimError(http.StatusBadRequest, "invalidValue", "active must be a boolean")
+			}
+			doc["active"] = b
+		}
+		var in models.ScimUser
+		if err := scimDecode(doc, &in); err != nil {
+			return err
+		}
+		out, err = s.saveUser(tx, user, link, &in)
+		return err
+	})
+	return out, err
+}
+
+// DeleteUser 软删除用户，移除其在该项目的组成员关系，并写入 user.deleted 事件与各项目的删除任务
+func (s *ScimService) DeleteUser(id, ifMatch string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		user, link, err := s.loadUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if ifMatch != "" {
+			current := s.userResource(user, link, s.userGroups([]string{id})[id])
+			if !scimPreconditionOK(ifMatch, current.Meta.Version) {
+				return scimError(http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+			}
+		}
+		if err := tx.Where("user_id = ? AND project = ?", user.ID, s.project.Key).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(link).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+		PublishUserEvent(tx, EventUserDeleted, user, "")
+		_, err = EnqueueUserSync(tx, models.ProvisioningDelete, user.ID)
+		return err
+	})
+}
+
+func (s *ScimService) loadUser(db *gorm.DB, id string) (*models.User, *models.ScimUserLink, error) {
+	var link models.ScimUserLink
+	if err := db.Where("project_key = ? AND user_id = ?", s.project.Key, id).First(&link).Error; err != nil {
+		return nil, nil, scimError(http.StatusNotFound, "", "User %s not found", id)
+	}
+	var user models.User
+	if err := db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, nil, scimError(http.StatusNotFound, "", "User %s not found", id)
+	}
+	return &user, &link, nil
+}
+
+// saveUser 应用 PUT / PATCH 结果，资料有变化时发布 user.updated 并同步到已映射的项目
+func (s *ScimService) saveUser(tx *gorm.DB, user *models.User, link *models.ScimUserLink, in *models.ScimUser) (*models.ScimUser, error) {
+	before := user.ToResponse()
+	if err := s.applyUser(tx, user, link, in); err != nil {
+		return nil, err
+	}
+	if err := tx.Save(user).Error; err != nil {
+		return nil, scimWriteError(err)
+	}
+	if err := tx.Save(link).Error; err != nil {
+		return nil, err
+	}
+	PublishUserChanges(tx, before, user, "")
+	if len(ChangedUserFields(before, user.ToResponse())) > 0 {
+		if _, err := EnqueueUserSync(tx, models.ProvisioningUpdate, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return s.userResource(user, link, s.userGroupsTx(tx, []string{user.ID})[user.ID]), nil
+}
+
+// applyUser 校验并把 SCIM User 写到用户模型：userName → username，displayName → nickname，
+// 主邮箱 / 手机号 → email / phone（变更后需重新验证），active → status，其余资料写入 meta
+func (s *ScimService) applyUser(tx *gorm.DB, user *models.User, link *models.ScimUserLink, in *models.ScimUser) error {
+	username := strings.TrimSpace(in.UserName)
+	if username == "" || len(username) > 50 {
+		return scimError(http.StatusBadRequest, "invalidValue", "userName is required and must be at most 50 characters")
+	}
+	if username != user.Username {
+		var count int64
+		tx.Unscoped().Model(&models.User{}).Where("username = ? AND id <> ?", username, user.ID).Count(&count)
+		if count > 0 {
+			return scimError(http.StatusConflict, "uniqueness", "userName %s is already taken", username)
+		}
+	}
+	if len(in.ExternalID) > 255 {
+		return scimError(http.StatusBadRequest, "invalidValue", "externalId must be at most 255 characters")
+	}
+
+	meta, err := user.GetMeta()
+	if err != nil {
+		meta = &models.UserMeta{}
+	}
+	nickname := strings.TrimSpace(in.DisplayName)
+	if in.Name != nil {
+		formatted := strings.TrimSpace(in.Name.Formatted)
+		if formatted == "" {
+			formatted = strings.TrimSpace(strings.TrimSpace(in.Name.GivenName) + " " + strings.TrimSpace(in.Name.FamilyName))
+		}
+		meta.RealName = formatted
+		if meta.Custom == nil {
+			meta.Custom = map[string]interface{}{}
+		}
+		meta.Custom["given_name"] = in.Name.GivenName
+		meta.Custom["family_name"] = in.Name.FamilyName
+		if nickname == "" {
+			nickname = formatted
+		}
+	} else {
+		meta.RealName = ""
+		delete(meta.Custom, "given_name")
+		delete(meta.Custom, "family_name")
+	}
+	if nickname == "" {
+		nickname = username
+	}
+	if len([]rune(nickname)) > 100 {
+		return scimError(http.StatusBadRequest, "invalidValue", "displayName must be at most 100 characters")
+	}
+	meta.JobTitle = in.Title
+	meta.Language = in.Locale
+	meta.Timezone = in.Timezone
+	meta.Website = in.ProfileURL
+	if photo := scimPrimaryValue(in.Photos); photo != "" {
+		meta.Avatar = photo
+	}
+
+	email := strings.ToLower(strings.TrimSpace(scimPrimaryValue(in.Emails)))
+	if email != "" && (len(email) > 255 || !strings.Contains(email, "@")) {
+		return scimError(http.StatusBadRequest, "invalidValue", "invalid email %s", email)
+	}
+	currentEmail := ""
+	if user.Email != nil {
+		currentEmail = *user.Email
+	}
+	if !strings.EqualFold(email, currentEmail) {
+		if email == "" {
+			user.Email = nil
+		} else {
+			var count int64
+			tx.Unscoped().Model(&models.User{}).Where("email = ? AND id <> ?", email, user.ID).Count(&count)
+			if count > 0 {
+				return scimError(http.StatusConflict, "uniqueness", "email %s is already taken", email)
+			}
+			user.Email = &email
+		}
+		user.EmailVerified = false
+	}
+
+	phone := strings.TrimSpace(scimPrimaryValue(in.PhoneNumbers))
+	if phone != "" {
+		normalized, err := utils.NormalizePhone(phone, ProjectPhoneRegion(tx, s.project.Key))
+		if err != nil {
+			return scimError(http.StatusBadRequest, "invalidValue", "invalid phone number %s", phone)
+		}
+		phone = normalized
+	}
+	currentPhone := ""
+	if user.Phone != nil {
+		currentPhone = *user.Phone
+	}
+	if phone != currentPhone {
+		if phone == "" {
+			user.Phone = nil
+		} else {
+			var count int64
+			tx.Unscoped().Model(&models.User{}).Where("phone = ? AND id <> ?", phone, user.ID).Count(&count)
+			if count > 0 {
+				return scimError(http.StatusConflict, "uniqueness", "phone number %s is already taken", phone)
+			}
+			user.Phone = &phone
+		}
+		user.PhoneVerified = false
+	}
+
+	if in.Active != nil {
+		if *in.Active {
+			user.Status = "active"
+		} else {
+			user.Status = "inactive"
+		}
+	}
+	if in.Password != "" {
+		if len(in.Password) < 6 {
+			return scimError(http.StatusBadRequest, "invalidValue", "password must be at least 6 characters")
+		}
+		user.Password = in.Password
+		if err := user.HashPassword(); err != nil {
+			return err
+		}
+	}
+
+	user.Username = username
+	user.Nickname = nickname
+	if err := user.SetMeta(meta); err != nil {
+		return err
+	}
+	link.ExternalID = strings.TrimSpace(in.ExternalID)
+	return nil
+}
+
+func (s *ScimService) userResource(user *models.User, link *models.ScimUserLink, groups []models.ScimMultiValue) *models.ScimUser {
+	meta, _ := user.GetMeta()
+	if meta == nil {
+		meta = &models.UserMeta{}
+	}
+	active := user.Status == "active"
+	res := &models.ScimUser{
+		Schemas:     []string{models.ScimSchemaUser},
+		ID:          user.ID,
+		ExternalID:  link.ExternalID,
+		UserName:    user.Username,
+		DisplayName: user.Nickname,
+		ProfileURL:  meta.Website,
+		Title:       meta.JobTitle,
+		Locale:      meta.Language,
+		Timezone:    meta.Timezone,
+		Active:      &active,
+		Groups:      groups,
+	}
+	given, _ := meta.Custom["given_name"].(string)
+	family, _ := meta.Custom["family_name"].(string)
+	if meta.RealName != "" || given != "" || family != "" {
+		res.Name = &models.ScimName{Formatted: meta.RealName, GivenName: given, FamilyName: family}
+	}
+	if user.Email != nil && *user.Email != "" {
+		res.Emails = []models.ScimMultiValue{{Value: *user.Email, Type: "work", Primary: true}}
+	}
+	if user.Phone != nil && *user.Phone != "" {
+		res.PhoneNumbers = []models.ScimMultiValue{{Value: *user.Phone, Type: "mobile", Primary: true}}
+	}
+	if meta.Avatar != "" {
+		res.Photos = []models.ScimMultiValue{{Value: meta.Avatar, Type: "photo", Primary: true}}
+	}
+	created, modified := user.CreatedAt, user.UpdatedAt
+	res.Meta = &models.ScimMeta{ResourceType: "User", Created: &created, LastModified: &modified, Location: s.baseURL + "/Users/" + user.ID}
+	res.Meta.Version = ScimETag(res)
+	return res
+}
+
+// userGroups 用户在该项目可见组中的成员关系
+func (s *ScimService) userGroups(userIDs []string) map[string][]models.ScimMultiValue {
+	return s.userGroupsTx(s.db, userIDs)
+}
+
+func (s *ScimService) userGroupsTx(db *gorm.DB, userIDs []string) map[string][]models.ScimMultiValue {
+	out := map[string][]models.ScimMultiValue{}
+	if len(userIDs) == 0 {
+		return out
+	}
+	var rows []struct {
+		UserID string
+		RoleID uint
+		Name   string
+	}
+	err := db.Table("user_roles ur").Select("ur.user_id, ur.role_id, r.name").
+		Joins("JOIN roles r ON r.id = ur.role_id").
+		Joins("JOIN scim_group_links g ON g.role_id = ur.role_id AND g.project_key = ?", s.project.Key).
+		Where("ur.project = ? AND ur.is_active = ? AND ur.user_id IN ?", s.project.Key, true, userIDs).
+		Order("ur.role_id ASC").Scan(&rows).Error
+	if err != nil {
+		log.Printf("Warning: failed to load SCIM groups for users: %v", err)
+		return out
+	}
+	for _, r := range rows {
+		id := strconv.FormatUint(uint64(r.RoleID), 10)
+		out[r.UserID] = append(out[r.UserID], models.ScimMultiValue{Value: id, Display: r.Name, Type: "direct", Ref: s.baseURL + "/Groups/" + id})
+	}
+	return out
+}
+
+// ---------- Groups ----------
+
+// ListGroups 按过滤条件分页列出该项目可见的组；withMembers 为 false 时不加载成员（excludedAttributes=members）
+func (s *ScimService) ListGroups(filter string, startIndex, count int, withMembers bool) (*models.ScimListResponse, error) {
+	startIndex, count = scimPage(startIndex, count)
+	query := s.db.Model(&models.Role{}).
+		Joins("JOIN scim_group_links g ON g.role_id = roles.id AND g.project_key = ?", s.project.Key)
+	if filter != "" {
+		where, args, err := s.filterSQL(filter, s.groupColumns())
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(where, args...)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	resources := make([]interface{}, 0, count)
+	if count == 0 {
+		return scimList(total, startIndex, resources), nil
+	}
+
+	var roles []models.Role
+	if err := query.Select("roles.*").Order("roles.id ASC").Offset(startIndex - 1).Limit(count).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	roleIDs := make([]uint, 0, len(roles))
+	for _, r := range roles {
+		roleIDs = append(roleIDs, r.ID)
+	}
+	var links []models.ScimGroupLink
+	s.db.Where("project_key = ? AND role_id IN ?", s.project.Key, roleIDs).Find(&links)
+	linkByRole := make(map[uint]*models.ScimGroupLink, len(links))
+	for i := range links {
+		linkByRole[links[i].RoleID] = &links[i]
+	}
+	var members map[uint][]models.ScimMultiValue
+	if withMembers {
+		members = s.groupMembers(s.db, roleIDs)
+	}
+	for i := range roles {
+		link := linkByRole[roles[i].ID]
+		if link == nil {
+			link = &models.ScimGroupLink{}
+		}
+		res := s.groupResource(&roles[i], link, members[roles[i].ID])
+		if !withMembers {
+			// 未加载成员时版本不完整，不返回
+			res.Meta.Version = ""
+			res.Members = nil
+		}
+		resources = append(resources, res)
+	}
+	return scimList(total, startIndex, resources), nil
+}
+
+// GetGroup 读取组
+func (s *ScimService) GetGroup(id string) (*models.ScimGroup, error) {
+	role, link, err := s.loadGroup(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.groupResource(role, link, s.groupMembers(s.db, []uint{role.ID})[role.ID]), nil
+}
+
+// CreateGroup 创建组：已有同名的非系统角色时关联该角色（只管理本项目内的成员），否则创建角色
+func (s *ScimService) CreateGroup(in *models.ScimGroup) (*models.ScimGroup, error) {
+	var out *models.ScimGroup
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		name := strings.TrimSpace(in.DisplayName)
+		if name == "" || len(name) > 50 {
+			return scimError(http.StatusBadRequest, "invalidValue", "displayName is required and must be at most 50 characters")
+		}
+		link := &models.ScimGroupLink{ProjectKey: s.project.Key}
+		var role models.Role
+		err := tx.Where("name = ?", name).First(&role).Error
+		switch {
+		case err == nil && role.IsSystem:
+			return scimError(http.StatusConflict, "uniqueness", "group %s is reserved", name)
+		case err == nil:
+			var count int64
+			tx.Model(&models.ScimGroupLink{}).Where("project_key = ? AND role_id = ?", s.project.Key, role.ID).Count(&count)
+			if count > 0 {
+				return scimError(http.StatusConflict, "uniqueness", "group %s already exists", name)
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			role = models.Role{Name: name, Description: "SCIM group (" + s.project.Key + ")", IsActive: true}
+			if err := tx.Create(&role).Error; err != nil {
+				return scimWriteError(err)
+			}
+			link.Owned = true
+		default:
+			return err
+		}
+		link.RoleID = role.ID
+		link.ExternalID = strings.TrimSpace(in.ExternalID)
+		if len(link.ExternalID) > 255 {
+			return scimError(http.StatusBadRequest, "invalidValue", "externalId must be at most 255 characters")
+		}
+		if err := tx.Create(link).Error; err != nil {
+			return scimWriteError(err)
+		}
+		if err := s.setMembers(tx, &role, in.Members); err != nil {
+			return err
+		}
+		out = s.groupResource(&role, link, s.groupMembers(tx, []uint{role.ID})[role.ID])
+		return nil
+	})
+	return out, err
+}
+
+// ReplaceGroup PUT：替换名称、externalId 与成员
+func (s *ScimService) ReplaceGroup(id, ifMatch string, in *models.ScimGroup) (*models.ScimGroup, error) {
+	var out *models.ScimGroup
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		role, link, err := s.loadGroup(tx, id)
+		if err != nil {
+			return err
+		}
+		current := s.groupResource(role, link, s.groupMembers(tx, []uint{role.ID})[role.ID])
+		if !scimPreconditionOK(ifMatch, current.Meta.Version) {
+			return scimError(http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+		}
+		out, err = s.saveGroup(tx, role, link, in)
+		return err
+	})
+	return out, err
+}
+
+// PatchGroup PATCH：成员增删（members[value eq "..."]）、改名
+func (s *ScimService) PatchGroup(id, ifMatch string, ops []models.ScimPatchOperation) (*models.ScimGroup, error) {
+	var out *models.ScimGroup
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		role, link, err := s.loadGroup(tx, id)
+		if err != nil {
+			return err
+		}
+		current := s.groupResource(role, link, s.groupMembers(tx, []uint{role.ID})[role.ID])
+		if !scimPreconditionOK(ifMatch, current.Meta.Version) {
+			return scimError(http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+		}
+		current.Meta = nil
+		doc, err := scimDocument(current)
+		if err != nil {
+			return err
+		}
+		if err := applyScimPatch(doc, ops, scimGroupAttrs); err != nil {
+			return err
+		}
+		var in models.ScimGroup
+		if err := scimDecode(doc, &in); err != nil {
+			return err
+		}
+		out, err = s.saveGroup(tx, role, link, &in)
+		return err
+	})
+	return out, err
+}
+
+// DeleteGroup 移除该项目的成员关系与关联；该项目创建且不再被使用的角色一并删除
+func (s *ScimService) DeleteGroup(id, ifMatch string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		role, link, err := s.loadGroup(tx, id)
+		if err != nil {
+			return err
+		}
+		if ifMatch != "" {
+			current := s.groupResource(role, link, s.groupMembers(tx, []uint{role.ID})[role.ID])
+			if !scimPreconditionOK(ifMatch, current.Meta.Version) {
+				return scimError(http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+			}
+		}
+		if err := tx.Where("role_id = ? AND project = ?", role.ID, s.project.Key).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(link).Error; err != nil {
+			return err
+		}
+		if !link.Owned {
+			return nil
+		}
+		var inUse int64
+		tx.Model(&models.UserRole{}).Where("role_id = ?", role.ID).Count(&inUse)
+		if inUse == 0 {
+			tx.Model(&models.ScimGroupLink{}).Where("role_id = ?", role.ID).Count(&inUse)
+		}
+		if inUse > 0 {
+			return nil
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+}
+
+func (s *ScimService) loadGroup(db *gorm.DB, id string) (*models.Role, *models.ScimGroupLink, error) {
+	roleID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, nil, scimError(http.StatusNotFound, "", "Group %s not found", id)
+	}
+	var link models.ScimGroupLink
+	if err := db.Preload("Role").Where("project_key = ? AND role_id = ?", s.project.Key, roleID).First(&link).Error; err != nil || link.Role.ID == 0 {
+		return nil, nil, scimError(http.StatusNotFound, "", "Group %s not found", id)
+	}
+	role := link.Role
+	return &role, &link, nil
+}
+
+// saveGroup 改名只允许该项目创建的角色；成员按请求整体替换
+func (s *ScimService) saveGroup(tx *gorm.DB, role *models.Role, link *models.ScimGroupLink, in *models.ScimGroup) (*models.ScimGroup, error) {
+	name := strings.TrimSpace(in.DisplayName)
+	if name == "" || len(name) > 50 {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "displayName is required and must be at most 50 characters")
+	}
+	if name != role.Name {
+		if !link.Owned {
+			return nil, scimError(http.StatusBadRequest, "mutability", "displayName of shared group %s cannot be changed", role.Name)
+		}
+		var count int64
+		tx.Model(&models.Role{}).Where("name = ? AND id <> ?", name, role.ID).Count(&count)
+		if count > 0 {
+			return nil, scimError(http.StatusConflict, "uniqueness", "group %s already exists", name)
+		}
+		if err := tx.Model(role).Update("name", name).Error; err != nil {
+			return nil, scimWriteError(err)
+		}
+	}
+	externalID := strings.TrimSpace(in.ExternalID)
+	if len(externalID) > 255 {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "externalId must be at most 255 characters")
+	}
+	if err := s.setMembers(tx, role, in.Members); err != nil {
+		return nil, err
+	}
+	// 成员变化也更新关联的修改时间，作为组的 lastModified
+	if err := tx.Model(link).Updates(map[string]interface{}{"external_id": externalID, "updated_at": time.Now()}).Error; err != nil {
+		return nil, err
+	}
+	return s.groupResource(role, link, s.groupMembers(tx, []uint{role.ID})[role.ID]), nil
+}
+
+// setMembers 把组在该项目的成员替换为 members；成员须为该项目开通的用户，不支持嵌套组。
+// 非 SCIM 开通用户的成员关系（如管理员授予）不受影响
+func (s *ScimService) setMembers(tx *gorm.DB, role *models.Role, members []models.ScimMultiValue) error {
+	want := map[string]bool{}
+	for _, m := range members {
+		if strings.EqualFold(m.Type, "Group") {
+			return scimError(http.StatusBadRequest, "invalidValue", "nested groups are not supported")
+		}
+		if m.Value = strings.TrimSpace(m.Value); m.Value != "" {
+			want[m.Value] = true
+		}
+	}
+	if len(want) > 0 {
+		ids := make([]string, 0, len(want))
+		for id := range want {
+			ids = append(ids, id)
+		}
+		var linked []string
+		tx.Model(&models.ScimUserLink{}).
+			Joins("JOIN users ON users.id = scim_user_links.user_id AND users.deleted_at IS NULL").
+			Where("scim_user_links.project_key = ? AND scim_user_links.user_id IN ?", s.project.Key, ids).
+			Pluck("scim_user_links.user_id", &linked)
+		if len(linked) != len(ids) {
+			found := map[string]bool{}
+			for _, id := range linked {
+				found[id] = true
+			}
+			for _, id := range ids {
+				if !found[id] {
+					return scimError(http.StatusBadRequest, "invalidValue", "member %s is not a user of this project", id)
+				}
+			}
+		}
+	}
+
+	var current []models.UserRole
+	if err := tx.Where("role_id = ? AND project = ? AND user_id IN (?)", role.ID, s.project.Key,
+		tx.Model(&models.ScimUserLink{}).Select("user_id").Where("project_key = ?", s.project.Key)).Find(&current).Error; err != nil {
+		return err
+	}
+	for _, ur := range current {
+		if want[ur.UserID] && ur.IsActive {
+			delete(want, ur.UserID)
+			continue
+		}
+		if err := tx.Delete(&ur).Error; err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	for userID := range want {
+		if err := tx.Create(&models.UserRole{UserID: userID, RoleID: role.ID, Project: s.project.Key, GrantedAt: now, IsActive: true}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ScimService) groupResource(role *models.Role, link *models.ScimGroupLink, members []models.ScimMultiValue) *models.ScimGroup {
+	id := strconv.FormatUint(uint64(role.ID), 10)
+	if members == nil {
+		members = []models.ScimMultiValue{}
+	}
+	created, modified := role.CreatedAt, role.UpdatedAt
+	if link.UpdatedAt.After(modified) {
+		modified = link.UpdatedAt
+	}
+	res := &models.ScimGroup{
+		Schemas:     []string{models.ScimSchemaGroup},
+		ID:          id,
+		ExternalID:  link.ExternalID,
+		DisplayName: role.Name,
+		Members:     members,
+		Meta:        &models.ScimMeta{ResourceType: "Group", Created: &created, LastModified: &modified, Location: s.baseURL + "/Groups/" + id},
+	}
+	res.Meta.Version = ScimETag(res)
+	return res
+}
+
+// groupMembers 组在该项目的成员（仅 SCIM 开通的用户）
+func (s *ScimService) groupMembers(db *gorm.DB, roleIDs []uint) map[uint][]models.ScimMultiValue {
+	out := map[uint][]models.ScimMultiValue{}
+	if len(roleIDs) == 0 {
+		return out
+	}
+	var rows []struct {
+		RoleID   uint
+		UserID   string
+		Username string
+	}
+	err := db.Table("user_roles ur").Select("ur.role_id, ur.user_id, u.username").
+		Joins("JOIN users u ON u.id = ur.user_id AND u.deleted_at IS NULL").
+		Joins("JOIN scim_user_links l ON l.user_id = ur.user_id AND l.project_key = ?", s.project.Key).
+		Where("ur.project = ? AND ur.is_active = ? AND ur.role_id IN ?", s.project.Key, true, roleIDs).
+		Order("ur.id ASC").Scan(&rows).Error
+	if err != nil {
+		log.Printf("Warning: failed to load SCIM group members: %v", err)
+		return out
+	}
+	for _, r := range rows {
+		out[r.RoleID] = append(out[r.RoleID], models.ScimMultiValue{Value: r.UserID, Display: r.Username, Type: "User", Ref: s.baseURL + "/Users/" + r.UserID})
+	}
+	return out
+}
+
+// ---------- helpers ----------
+
+func scimPrimaryValue(values []models.ScimMultiValue) string {
+	for _, v := range values {
+		if v.Primary {
+			return v.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// scimWriteError 唯一键冲突转换为 409 uniqueness
+func scimWriteError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return scimError(http.StatusConflict, "uniqueness", "%s", mysqlErr.Message)
+	}
+	return err
+}
+
+func scimDocument(resource interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func scimDecode(doc map[string]interface{}, out interface{}) error {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return scimError(http.StatusBadRequest, "invalidValue", "invalid resource after patch: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,533 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"unit-auth/models"
+	"unit-auth/utils"
+)
+
+// scimColumn 过滤属性对应的 SQL 表达式；exists 不为空时条件放在该子查询的 EXISTS 中（多值属性）
+type scimColumn struct {
+	expr   string
+	kind   string // string, bool, datetime, active
+	exists string
+	args   []interface{}
+}
+
+// userColumns User 可过滤的属性（查询已关联 scim_user_links l）
+func (s *ScimService) userColumns() map[string]scimColumn {
+	metaField := func(path string) scimColumn {
+		return scimColumn{expr: "JSON_UNQUOTE(JSON_EXTRACT(users.meta, '" + path + "'))", kind: "string"}
+	}
+	return map[string]scimColumn{
+		"id":                 {expr: "users.id", kind: "string"},
+		"externalid":         {expr: "l.external_id", kind: "string"},
+		"username":           {expr: "users.username", kind: "string"},
+		"displayname":        {expr: "users.nickname", kind: "string"},
+		"name.formatted":     metaField("$.real_name"),
+		"name.givenname":     metaField("$.custom.given_name"),
+		"name.familyname":    metaField("$.custom.family_name"),
+		"title":              metaField("$.job_title"),
+		"locale":             metaField("$.language"),
+		"timezone":           metaField("$.timezone"),
+		"emails":             {expr: "users.email", kind: "string"},
+		"emails.value":       {expr: "users.email", kind: "string"},
+		"phonenumbers":       {expr: "users.phone", kind: "string"},
+		"phonenumbers.value": {expr: "users.phone", kind: "string"},
+		"active":             {expr: "users.status", kind: "active"},
+		"meta.created":       {expr: "users.created_at", kind: "datetime"},
+		"meta.lastmodified":  {expr: "users.updated_at", kind: "datetime"},
+	}
+}
+
+// groupColumns Group 可过滤的属性（查询已关联 scim_group_links g）
+func (s *ScimService) groupColumns() map[string]scimColumn {
+	members := "SELECT 1 FROM user_roles ur " +
+		"JOIN scim_user_links ul ON ul.user_id = ur.user_id AND ul.project_key = ? " +
+		"JOIN users u ON u.id = ur.user_id AND u.deleted_at IS NULL " +
+		"WHERE ur.role_id = roles.id AND ur.project = ? AND ur.is_active = 1"
+	args := []interface{}{s.project.Key, s.project.Key}
+	return map[string]scimColumn{
+		"id":                {expr: "roles.id", kind: "string"},
+		"externalid":        {expr: "g.external_id", kind: "string"},
+		"displayname":       {expr: "roles.name", kind: "string"},
+		"members":           {expr: "ur.user_id", kind: "string", exists: members, args: args},
+		"members.value":     {expr: "ur.user_id", kind: "string", exists: members, args: args},
+		"members.display":   {expr: "u.username", kind: "string", exists: members, args: args},
+		"meta.created":      {expr: "roles.created_at", kind: "datetime"},
+		"meta.lastmodified": {expr: "roles.updated_at", kind: "datetime"},
+	}
+}
+
+// filterSQL 把 SCIM 过滤表达式转换为 WHERE 条件；不支持的属性或比较返回 400 invalidFilter
+func (s *ScimService) filterSQL(filter string, columns map[string]scimColumn) (string, []interface{}, error) {
+	f, err := utils.ParseScimFilter(filter)
+	if err != nil {
+		return "", nil, scimError(http.StatusBadRequest, "invalidFilter", "invalid filter: %v", err)
+	}
+	return scimFilterSQL(f, columns, "")
+}
+
+func scimFilterSQL(f utils.ScimFilter, columns map[string]scimColumn, prefix string) (string, []interface{}, error) {
+	switch x := f.(type) {
+	case utils.ScimLogicalExpr:
+		left, leftArgs, err := scimFilterSQL(x.Left, columns, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := scimFilterSQL(x.Right, columns, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + left + " " + strings.ToUpper(x.Op) + " " + right + ")", append(leftArgs, rightArgs...), nil
+	case utils.ScimNotExpr:
+		inner, args, err := scimFilterSQL(x.Expr, columns, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + inner + ")", args, nil
+	case utils.ScimValuePathExpr:
+		// emails[value ew "@example.com"] 按 emails.value 处理
+		return scimFilterSQL(x.Filter, columns, prefix+x.Path+".")
+	case utils.ScimAttrExpr:
+		path := prefix + x.Path
+		col, ok := columns[path]
+		if !ok {
+			return "", nil, scimError(http.StatusBadRequest, "invalidFilter", "filtering on %s is not supported", path)
+		}
+		if col.exists != "" {
+			args := append([]interface{}{}, col.args...)
+			if x.Op == "pr" {
+				return "EXISTS (" + col.exists + ")", args, nil
+			}
+			cond, condArgs, err := scimCondition(col, x)
+			if err != nil {
+				return "", nil, err
+			}
+			return "EXISTS (" + col.exists + " AND " + cond + ")", append(args, condArgs...), nil
+		}
+		return scimCondition(col, x)
+	}
+	return "", nil, scimError(http.StatusBadRequest, "invalidFilter", "invalid filter")
+}
+
+var scimSQLOps = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+func scimCondition(col scimColumn, x utils.ScimAttrExpr) (string, []interface{}, error) {
+	invalid := scimError(http.StatusBadRequest, "invalidFilter", "invalid comparison %s %s", x.Path, x.Op)
+	if x.Op == "pr" {
+		if col.kind == "string" {
+			return "(" + col.expr + " IS NOT NULL AND " + col.expr + " <> '')", nil, nil
+		}
+		return col.expr + " IS NOT NULL", nil, nil
+	}
+
+	switch col.kind {
+	case "active":
+		b, ok := x.Value.(bool)
+		if !ok || (x.Op != "eq" && x.Op != "ne") {
+			return "", nil, invalid
+		}
+		if b == (x.Op == "eq") {
+			return col.expr + " = ?", []interface{}{"active"}, nil
+		}
+		return col.expr + " <> ?", []interface{}{"active"}, nil
+	case "bool":
+		b, ok := x.Value.(bool)
+		if !ok || (x.Op != "eq" && x.Op != "ne") {
+			return "", nil, invalid
+		}
+		return col.expr + " " + scimSQLOps[x.Op] + " ?", []interface{}{b}, nil
+	case "datetime":
+		v, ok := x.Value.(string)
+		op, supported := scimSQLOps[x.Op]
+		if !ok || !supported {
+			return "", nil, invalid
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return "", nil, scimError(http.StatusBadRequest, "invalidFilter", "%s must be an RFC3339 time", x.Path)
+		}
+		return col.expr + " " + op + " ?", []interface{}{t}, nil
+	}
+
+	if x.Value == nil {
+		switch x.Op {
+		case "eq":
+			return col.expr + " IS NULL", nil, nil
+		case "ne":
+			return col.expr + " IS NOT NULL", nil, nil
+		}
+		return "", nil, invalid
+	}
+	var v string
+	switch value := x.Value.(type) {
+	case string:
+		v = value
+	case float64:
+		v = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return "", nil, invalid
+	}
+	switch x.Op {
+	case "co":
+		return col.expr + " LIKE ?", []interface{}{"%" + escapeLike(v) + "%"}, nil
+	case "sw":
+		return col.expr + " LIKE ?", []interface{}{escapeLike(v) + "%"}, nil
+	case "ew":
+		return col.expr + " LIKE ?", []interface{}{"%" + escapeLike(v)}, nil
+	case "ne":
+		return "(" + col.expr + " IS NULL OR " + col.expr + " <> ?)", []interface{}{v}, nil
+	}
+	return col.expr + " " + scimSQLOps[x.Op] + " ?", []interface{}{v}, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// ---------- PATCH ----------
+
+// scimUserAttrs / scimGroupAttrs 可 PATCH 的属性（小写 → 资源 JSON 字段名）
+var scimUserAttrs = map[string]string{
+	"externalid":   "externalId",
+	"username":     "userName",
+	"name":         "name",
+	"displayname":  "displayName",
+	"profileurl":   "profileUrl",
+	"title":        "title",
+	"locale":       "locale",
+	"timezone":     "timezone",
+	"active":       "active",
+	"password":     "password",
+	"emails":       "emails",
+	"phonenumbers": "phoneNumbers",
+	"photos":       "photos",
+	"groups":       "groups",
+}
+
+var scimGroupAttrs = map[string]string{
+	"externalid":  "externalId",
+	"displayname": "displayName",
+	"members":     "members",
+}
+
+var scimMultiValuedAttrs = map[string]bool{"emails": true, "phoneNumbers": true, "photos": true, "groups": true, "members": true}
+
+var scimSubAttrs = map[string]string{
+	"formatted":  "formatted",
+	"givenname":  "givenName",
+	"familyname": "familyName",
+	"value":      "value",
+	"display":    "display",
+	"type":       "type",
+	"primary":    "primary",
+	"$ref":       "$ref",
+}
+
+// applyScimPatch 依次对资源 JSON 执行 PATCH 操作；readOnly 中的属性不可修改，扩展 schema 的属性忽略
+func applyScimPatch(doc map[string]interface{}, ops []models.ScimPatchOperation, attrs map[string]string, readOnly ...string) error {
+	if len(ops) == 0 {
+		return scimError(http.StatusBadRequest, "invalidSyntax", "Operations is required")
+	}
+	for _, op := range ops {
+		kind := strings.ToLower(op.Op)
+		if kind != "add" && kind != "replace" && kind != "remove" {
+			return scimError(http.StatusBadRequest, "invalidSyntax", "unsupported op %q", op.Op)
+		}
+		var value interface{}
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return scimError(http.StatusBadRequest, "invalidValue", "invalid value: %v", err)
+			}
+		}
+
+		if strings.TrimSpace(op.Path) == "" {
+			if kind == "remove" {
+				return scimError(http.StatusBadRequest, "noTarget", "remove requires a path")
+			}
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				return scimError(http.StatusBadRequest, "invalidValue", "value must be an object when path is omitted")
+			}
+			for key, v := range obj {
+				path, err := utils.ParseScimPath(key)
+				if err != nil {
+					return scimError(http.StatusBadRequest, "invalidPath", "invalid attribute %q", key)
+				}
+				if err := patchScimAttr(doc, kind, path, v, attrs, readOnly); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		path, err := utils.ParseScimPath(op.Path)
+		if err != nil {
+			return scimError(http.StatusBadRequest, "invalidPath", "invalid path %q: %v", op.Path, err)
+		}
+		if kind != "remove" && value == nil {
+			return scimError(http.StatusBadRequest, "invalidValue", "value is required for %s", kind)
+		}
+		if err := patchScimAttr(doc, kind, path, value, attrs, readOnly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func patchScimAttr(doc map[string]interface{}, kind string, path *utils.ScimPath, value interface{}, attrs map[string]string, readOnly []string) error {
+	if strings.HasPrefix(path.Attr, "urn:") || path.Attr == "schemas" {
+		return nil
+	}
+	if path.Attr == "id" || path.Attr == "meta" {
+		return scimError(http.StatusBadRequest, "mutability", "%s is read-only", path.Attr)
+	}
+	for _, attr := range readOnly {
+		if path.Attr == attr {
+			return scimError(http.StatusBadRequest, "mutability", "%s is read-only", path.Attr)
+		}
+	}
+	key, ok := attrs[path.Attr]
+	if !ok {
+		return scimError(http.StatusBadRequest, "invalidPath", "unknown attribute %s", path.Attr)
+	}
+	sub := ""
+	if path.Sub != "" {
+		if sub, ok = scimSubAttrs[path.Sub]; !ok {
+			return scimError(http.StatusBadRequest, "invalidPath", "unknown attribute %s.%s", path.Attr, path.Sub)
+		}
+	}
+
+	if !scimMultiValuedAttrs[key] {
+		if path.Filter != nil {
+			return scimError(http.StatusBadRequest, "invalidPath", "%s is not multi-valued", key)
+		}
+		if sub == "" {
+			switch {
+			case kind == "remove":
+				delete(doc, key)
+			case kind == "add":
+				current, _ := doc[key].(map[string]interface{})
+				incoming, isObj := value.(map[string]interface{})
+				if current != nil && isObj {
+					for k, v := range incoming {
+						current[k] = v
+					}
+				} else {
+					doc[key] = value
+				}
+			default:
+				doc[key] = value
+			}
+			return nil
+		}
+		current, _ := doc[key].(map[string]interface{})
+		if current == nil {
+			if kind == "remove" {
+				return nil
+			}
+			current = map[string]interface{}{}
+			doc[key] = current
+		}
+		if kind == "remove" {
+			delete(current, sub)
+		} else {
+			current[sub] = value
+		}
+		return nil
+	}
+
+	list, _ := doc[key].([]interface{})
+	switch {
+	case path.Filter == nil && sub == "":
+		incoming := scimValueList(value)
+		switch kind {
+		case "remove":
+			if len(incoming) == 0 {
+				list = []interface{}{}
+			} else {
+				// members 以 value 列表删除（{"op":"remove","path":"members","value":[{"value":"..."}]}）
+				list = scimWithout(list, incoming)
+			}
+		case "add":
+			list = append(scimWithout(list, incoming), incoming...)
+		default:
+			list = incoming
+		}
+	case path.Filter == nil:
+		// emails.value：作用于主值（没有时为全部），列表为空时新建一个主值
+		if len(list) == 0 {
+			if kind == "remove" {
+				return nil
+			}
+			list = []interface{}{map[string]interface{}{sub: value, "primary": true}}
+			break
+		}
+		targets := scimPrimaryItems(list)
+		for _, item := range targets {
+			if kind == "remove" {
+				delete(item, sub)
+			} else {
+				item[sub] = value
+			}
+		}
+	default:
+		var matched []int
+		for i, item := range list {
+			if m, ok := item.(map[string]interface{}); ok && utils.MatchScimFilter(path.Filter, m) {
+				matched = append(matched, i)
+			}
+		}
+		if kind == "remove" {
+			if sub != "" {
+				for _, i := range matched {
+					delete(list[i].(map[string]interface{}), sub)
+				}
+				break
+			}
+			kept := make([]interface{}, 0, len(list))
+			for i, item := range list {
+				if !containsInt(matched, i) {
+					kept = append(kept, item)
+				}
+			}
+			list = kept
+			break
+		}
+		if len(matched) == 0 {
+			// 没有匹配时按过滤条件中的 eq 新建元素（emails[type eq "work"].value）
+			item, ok := scimItemFromFilter(path.Filter)
+			if !ok {
+				return scimError(http.StatusBadRequest, "noTarget", "no %s matched the filter", key)
+			}
+			list = append(list, item)
+			matched = []int{len(list) - 1}
+		}
+		for _, i := range matched {
+			item := list[i].(map[string]interface{})
+			if sub != "" {
+				item[sub] = value
+				continue
+			}
+			incoming, ok := value.(map[string]interface{})
+			if !ok {
+				return scimError(http.StatusBadRequest, "invalidValue", "value for %s must be an object", key)
+			}
+			if kind == "replace" {
+				list[i] = incoming
+				continue
+			}
+			for k, v := range incoming {
+				item[k] = v
+			}
+		}
+	}
+	doc[key] = list
+	return nil
+}
+
+func scimValueList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		return []interface{}{v}
+	default:
+		return []interface{}{map[string]interface{}{"value": v}}
+	}
+}
+
+func scimItemValue(item interface{}) string {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, "value") {
+			s, _ := v.(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// scimWithout 去掉 value 与 remove 中相同的元素
+func scimWithout(list, remove []interface{}) []interface{} {
+	values := map[string]bool{}
+	for _, item := range remove {
+		if v := scimItemValue(item); v != "" {
+			values[strings.ToLower(v)] = true
+		}
+	}
+	out := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		if !values[strings.ToLower(scimItemValue(item))] {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func scimPrimaryItems(list []interface{}) []map[string]interface{} {
+	var primary, all []map[string]interface{}
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		all = append(all, m)
+		if p, _ := m["primary"].(bool); p {
+			primary = append(primary, m)
+		}
+	}
+	if len(primary) > 0 {
+		return primary
+	}
+	return all
+}
+
+// scimItemFromFilter 过滤条件只由 eq 比较（and 连接）组成时，据此构造新元素
+func scimItemFromFilter(f utils.ScimFilter) (map[string]interface{}, bool) {
+	switch x := f.(type) {
+	case utils.ScimAttrExpr:
+		sub, ok := scimSubAttrs[x.Path]
+		if !ok || x.Op != "eq" {
+			return nil, false
+		}
+		return map[string]interface{}{sub: x.Value}, true
+	case utils.ScimLogicalExpr:
+		if x.Op != "and" {
+			return nil, false
+		}
+		left, ok := scimItemFromFilter(x.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := scimItemFromFilter(x.Right)
+		if !ok {
+			return nil, false
+		}
+		for k, v := range right {
+			left[k] = v
+		}
+		return left, true
+	}
+	return nil, false
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -2,7 +2,6 @@ package services
 
 import (
 	"fmt"
-	"log"
 	"time"
 	"unit-auth/models"
 	"unit-auth/utils"
@@ -10,50 +9,15 @@ import (
 	"gorm.io/gorm"
 )
 
-// SMSService 短信服务接口
+// SMSService 短信服务接口（由 SMSGateway 实现）
 type SMSService interface {
+	// SendVerificationCode template 为模板类型：login、register、reset_password
 	SendVerificationCode(phone, code, template string) error
 	SendNotification(phone, message string) error
 }
 
-// MockSMSService 模拟短信服务实现
-type MockSMSService struct {
-	db *gorm.DB
-}
-
-// NewMockSMSService 创建模拟短信服务
-func NewMockSMSService(db *gorm.DB) *MockSMSService {
-	return &MockSMSService{
-		db: db,
-	}
-}
-
-// SendVerificationCode 发送验证码
-func (s *MockSMSService) SendVerificationCode(phone, code, template string) error {
-	// 模拟发送延迟
-	time.Sleep(100 * time.Millisecond)
-
-	// 记录发送日志
-	log.Printf("📱 [模拟] 发送短信到 %s: 验证码 %s", phone, code)
-
-	// 这里可以集成真实的短信服务，比如阿里云、腾讯云等
-	// 示例：
-	// return s.sendViaAliyun(phone, code, template)
-	// return s.sendViaTencent(phone, code, template)
-
-	return nil
-}
-
-// SendNotification 发送通知消息
-func (s *MockSMSService) SendNotification(phone, message string) error {
-	// 模拟发送延迟
-	time.Sleep(100 * time.Millisecond)
-
-	// 记录发送日志
-	log.Printf("📱 [模拟] 发送通知到 %s: %s", phone, message)
-
-	return nil
-}
+// 验证码有效期（分钟）
+const smsCodeTTLMinutes = 10
 
 // SMSHandler 短信处理器
 type SMSHandler struct {
@@ -71,8 +35,9 @@ func NewSMSHandler(db *gorm.DB, smsService SMSService) *SMSHandler {
 
 // SendVerificationCode 发送验证码
 func (h *SMSHandler) SendVerificationCode(phone, codeType string) (*models.SMSVerification, error) {
-	// 验证手机号格式
-	if utils.IdentifyAccountType(phone) != utils.AccountTypePhone {
+	// 验证手机号格式（调用方应已按项目地区规范化，这里兜底按全局默认地区处理）
+	phone, err := utils.NormalizePhone(phone, utils.DefaultPhoneRegion())
+	if err != nil {
 		return nil, fmt.Errorf("invalid phone number format")
 	}
 
@@ -85,7 +50,7 @@ func (h *SMSHandler) SendVerificationCode(phone, codeType string) (*models.SMSVe
 
 	// 生成验证码
 	code := utils.GenerateVerificationCode()
-	expiresAt := time.Now().Add(10 * time.Minute)
+	expiresAt := time.Now().Add(smsCodeTTLMinutes * time.Minute)
 
 	// 保存验证码到数据库
 	verification := models.SMSVerification{
@@ -101,8 +66,7 @@ func (h *SMSHandler) SendVerificationCode(phone, codeType string) (*models.SMSVe
 	}
 
 	// 发送短信
-	template := h.getSMSTemplate(codeType)
-	if err := h.smsService.SendVerificationCode(phone, code, template); err != nil {
+	if err := h.smsService.SendVerificationCode(phone, code, codeType); err != nil {
 		// 发送失败，删除验证码记录
 		h.db.Delete(&verification)
 		return nil, fmt.Errorf("failed to send SMS: %w", err)
@@ -113,6 +77,9 @@ func (h *SMSHandler) SendVerificationCode(phone, codeType string) (*models.SMSVe
 
 // VerifyCode 验证验证码
 func (h *SMSHandler) VerifyCode(phone, code, codeType string) (*models.SMSVerification, error) {
+	if normalized, err := utils.NormalizePhone(phone, utils.DefaultPhoneRegion()); err == nil {
+		phone = normalized
+	}
 	var verification models.SMSVerification
 	if err := h.db.Where("phone = ? AND code = ? AND type = ? AND used = ? AND expires_at > ?",
 		phone, code, codeType, false, time.Now()).First(&verification).Error; err != nil {
@@ -127,21 +94,6 @@ func (h *SMSHandler) MarkCodeAsUsed(verification *models.SMSVerification) error
 	return h.db.Model(verification).Update("used", true).Error
 }
 
-// getSMSTemplate 获取短信模板
-func (h *SMSHandler) getSMSTemplate(codeType string) string {
-	templates := map[string]string{
-		"login":          "您的登录验证码是：{code}，10分钟内有效。",
-		"register":       "您的注册验证码是：{code}，10分钟内有效。",
-		"reset_password": "您的密码重置验证码是：{code}，10分钟内有效。",
-	}
-
-	if template, exists := templates[codeType]; exists {
-		return template
-	}
-
-	return "您的验证码是：{code}，10分钟内有效。"
-}
-
 // CleanupExpiredCodes 清理过期验证码
 func (h *SMSHandler) CleanupExpiredCodes() error {
 	return h.db.Where("expires_at < ?", time.Now()).Delete(&models.SMSVerification{}).Error
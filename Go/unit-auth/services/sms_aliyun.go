@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/google/uuid"
+)
+
+// AliyunSMSEndpoint 阿里云短信服务默认端点
+const AliyunSMSEndpoint = "https://dysmsapi.aliyuncs.com"
+
+// AliyunSMSConfig 阿里云短信配置
+type AliyunSMSConfig struct {
+	AccessKeyID     string
+	AccessKeySecret string
+	SignName        string
+	Templates       map[string]string // 模板类型 -> 模板 CODE（如 SMS_123456），变量按 SMSMessage.Params 传递
+	RegionID        string            // 默认 cn-hangzhou
+	Endpoint        string            // 默认 AliyunSMSEndpoint
+	CallbackToken   string            // 状态回执推送地址上的 token 参数
+	HTTPClient      *http.Client
+}
+
+// AliyunSMSVendor 阿里云短信（RPC 风格 API，HMAC-SHA1 签名）
+type AliyunSMSVendor struct {
+	cfg AliyunSMSConfig
+}
+
+// NewAliyunSMSVendor 创建阿里云短信适配器
+func NewAliyunSMSVendor(cfg AliyunSMSConfig) (*AliyunSMSVendor, error) {
+	if cfg.AccessKeyID == "" || cfg.AccessKeySecret == "" || cfg.SignName == "" {
+		return nil, errors.New("aliyun sms requires access key id, access key secret and sign name")
+	}
+	if cfg.RegionID == "" {
+		cfg.RegionID = "cn-hangzhou"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = AliyunSMSEndpoint
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = utils.UpstreamHTTPClient()
+	}
+	return &AliyunSMSVendor{cfg: cfg}, nil
+}
+
+func (v *AliyunSMSVendor) Name() string { return "aliyun" }
+
+// Send 调用 SendSms 接口
+func (v *AliyunSMSVendor) Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	templateCode, err := smsTemplateID(v.Name(), v.cfg.Templates, msg.Template)
+	if err != nil {
+		return nil, err
+	}
+	templateParam, err := json.Marshal(msg.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("AccessKeyId", v.cfg.AccessKeyID)
+	params.Set("Action", "SendSms")
+	params.Set("Format", "JSON")
+	params.Set("PhoneNumbers", aliyunPhone(msg.Phone))
+	params.Set("RegionId", v.cfg.RegionID)
+	params.Set("SignName", v.cfg.SignName)
+	params.Set("SignatureMethod", "HMAC-SHA1")
+	params.Set("SignatureNonce", uuid.NewString())
+	params.Set("SignatureVersion", "1.0")
+	params.Set("TemplateCode", templateCode)
+	params.Set("TemplateParam", string(templateParam))
+	params.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	params.Set("Version", "2017-05-25")
+	params.Set("Signature", AliyunRPCSignature(http.MethodPost, params, v.cfg.AccessKeySecret))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(v.cfg.Endpoint, "/")+"/", strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readSMSResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Code      string `json:"Code"`
+		Message   string `json:"Message"`
+		BizID     string `json:"BizId"`
+		RequestID string `json:"RequestId"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, &SMSVendorError{Vendor: v.Name(), Code: resp.Status, Message: "invalid response"}
+	}
+	if result.Code != "OK" {
+		return nil, &SMSVendorError{Vendor: v.Name(), Code: result.Code, Message: result.Message}
+	}
+	return &SMSSendResult{MessageID: result.BizID}, nil
+}
+
+// ParseStatusReports 解析短信回执（SmsReport 推送，JSON 数组）；推送地址需带 ?token=SMS_CALLBACK_TOKEN
+func (v *AliyunSMSVendor) ParseStatusReports(r *http.Request) ([]SMSStatusReport, error) {
+	if !smsCallbackTokenValid(v.cfg.CallbackToken, r) {
+		return nil, ErrSMSCallbackUnauthorized
+	}
+	var items []struct {
+		PhoneNumber string `json:"phone_number"`
+		Success     bool   `json:"success"`
+		BizID       string `json:"biz_id"`
+		ErrCode     string `json:"err_code"`
+		ErrMsg      string `json:"err_msg"`
+		ReportTime  string `json:"report_time"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+	reports := make([]SMSStatusReport, 0, len(items))
+	for _, item := range items {
+		report := SMSStatusReport{
+			MessageID: item.BizID,
+			Phone:     item.PhoneNumber,
+			Status:    models.SMSDeliveryDelivered,
+		}
+		if !item.Success {
+			report.Status = models.SMSDeliveryUndelivered
+			report.ErrorCode = item.ErrCode
+			report.Error = item.ErrMsg
+		}
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", item.ReportTime, chinaTimeZone); err == nil {
+			report.At = t
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// StatusAck 阿里云要求回执接口返回 code=0
+func (v *AliyunSMSVendor) StatusAck() interface{} {
+	return map[string]interface{}{"code": 0, "msg": "成功"}
+}
+
+// AliyunRPCSignature 阿里云 RPC 风格 API 签名（SignatureVersion 1.0）：
+// 按参数名排序拼接规范化查询串，StringToSign = Method&%2F&percentEncode(query)，HMAC-SHA1(secret+"&")
+func AliyunRPCSignature(method string, params url.Values, secret string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "Signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, aliyunPercentEncode(k)+"="+aliyunPercentEncode(params.Get(k)))
+	}
+	stringToSign := method + "&" + aliyunPercentEncode("/") + "&" + aliyunPercentEncode(strings.Join(pairs, "&"))
+
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func aliyunPercentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+// aliyunPhone 阿里云号码格式：中国大陆号码不带区号，其余为 00+区号+号码；无法规范化的号码原样提交，由服务商拒绝
+func aliyunPhone(phone string) string {
+	e164 := smsE164(phone)
+	switch {
+	case strings.HasPrefix(e164, "+86"):
+		return e164[3:]
+	case strings.HasPrefix(e164, "+"):
+		return "00" + e164[1:]
+	}
+	return e164
+}
+
+// smsCallbackTokenValid 校验不带签名机制的回执推送地址上的 token 参数（未配置 token 时拒绝回执）
+func smsCallbackTokenValid(expected string, r *http.Request) bool {
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(expected)) == 1
+}
+
+// 服务商回执中的时间为北京时间
+var chinaTimeZone = time.FixedZone("CST", 8*3600)
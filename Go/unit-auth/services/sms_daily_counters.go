@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+	"unit-auth/models"
+
+	"gorm.io/gorm"
+)
+
+// sms_daily_counters 计数键
+const (
+	smsCounterSpend   = "spend"    // 当日费用
+	smsCounterBreaker = "breaker"  // 费用熔断时间（Unix 秒），0 为未熔断
+	smsCounterCountry = "country:" // 国家/地区预算计数前缀
+	smsCounterPrefix  = "prefix:"  // 号段预算计数前缀
+)
+
+var errSMSCounterExceeded = errors.New("sms daily counter exceeded")
+
+// smsCounterDelta 一次发送在某个共享计数上的占用
+type smsCounterDelta struct {
+	key     string
+	delta   int64
+	limit   int64
+	limited bool
+	reason  string // 超出时的拒绝原因
+}
+
+// smsCounterDeltas 发送到 dest 需要占用的共享计数：国家/地区、号段、费用
+func (t *VerificationThrottle) smsCounterDeltas(dest smsDestination) []smsCounterDelta {
+	country := smsCounterDelta{key: smsCounterCountry + dest.country, delta: 1, reason: ThrottleReasonCountryBudget}
+	if limit, ok := t.countryBudget(dest); ok {
+		country.limit, country.limited = int64(limit), true
+	}
+	deltas := []smsCounterDelta{country}
+	if dest.prefix != "" {
+		deltas = append(deltas, smsCounterDelta{
+			key: smsCounterPrefix + dest.prefix, delta: 1, limit: int64(t.cfg.PrefixBudgets[dest.prefix]), limited: true,
+			reason: ThrottleReasonPrefixBudget,
+		})
+	}
+	if dest.cost > 0 {
+		deltas = append(deltas, smsCounterDelta{
+			key: smsCounterSpend, delta: int64(dest.cost), limit: int64(t.cfg.DailySpendLimit), limited: t.cfg.DailySpendLimit > 0,
+			reason: ThrottleReasonSpendLimit,
+		})
+	}
+	return deltas
+}
+
+// reserveShared 在 sms_daily_counters 中按条件自增（value + n <= 上限）占用当日国家/号段预算与费用，
+// 任一项超出时整体回滚并拒绝，费用超出时打开全局熔断。数据库出错时只记录警告，不阻断发送
+func (t *VerificationThrottle) reserveShared(day string, dest smsDestination, now time.Time) ([]smsCounterDelta, *ThrottleError) {
+	deltas := t.smsCounterDeltas(dest)
+	var rejected *ThrottleError
+	var spend []int64
+	err := t.db.Transaction(func(tx *gorm.DB) error {
+		var breaker []int64
+		if err := tx.Model(&models.SMSDailyCounter{}).
+			Where("day = ? AND counter_key = ?", day, smsCounterBreaker).
+			Pluck("value", &breaker).Error; err != nil {
+			return err
+		}
+		if len(breaker) > 0 && breaker[0] > 0 {
+			rejected = &ThrottleError{Channel: VerificationChannelSMS, Reason: ThrottleReasonSpendLimit, RetryAfter: untilTomorrow(now)}
+			return errSMSCounterExceeded
+		}
+		for _, d := range deltas {
+			ok, err := incrementSMSCounter(tx, day, d)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				rejected = &ThrottleError{Channel: VerificationChannelSMS, Reason: d.reason, RetryAfter: untilTomorrow(now)}
+				return errSMSCounterExceeded
+			}
+		}
+		return tx.Model(&models.SMSDailyCounter{}).
+			Where("day = ? AND counter_key = ?", day, smsCounterSpend).
+			Pluck("value", &spend).Error
+	})
+	switch {
+	case rejected != nil:
+		if rejected.Reason == ThrottleReasonSpendLimit {
+			t.openSharedBreaker(day, now)
+		}
+		return nil, rejected
+	case err != nil:
+		log.Printf("Warning: failed to reserve shared sms counters: %v", err)
+		return nil, nil
+	}
+	if len(spend) > 0 {
+		smsSpendToday.Set(float64(spend[0]))
+	}
+	return deltas, nil
+}
+
+// releaseShared 发送失败时归还共享计数
+func (t *VerificationThrottle) releaseShared(day string, deltas []smsCounterDelta) {
+	for _, d := range deltas {
+		if err := t.db.Model(&models.SMSDailyCounter{}).
+			Where("day = ? AND counter_key = ? AND value >= ?", day, d.key, d.delta).
+			Update("value", gorm.Expr("value - ?", d.delta)).Error; err != nil {
+			log.Printf("Warning: failed to release sms counter %s: %v", d.key, err)
+		}
+	}
+}
+
+// openSharedBreaker 打开当日费用熔断（已打开时保留最初的熔断时间）
+func (t *VerificationThrottle) openSharedBreaker(day string, now time.Time) {
+	if err := ensureSMSCounter(t.db, day, smsCounterBreaker); err != nil {
+		log.Printf("Warning: failed to open sms spend breaker: %v", err)
+		return
+	}
+	res := t.db.Model(&models.SMSDailyCounter{}).
+		Where("day = ? AND counter_key = ? AND value = 0", day, smsCounterBreaker).
+		Update("value", now.Unix())
+	if res.Error != nil {
+		log.Printf("Warning: failed to open sms spend breaker: %v", res.Error)
+		return
+	}
+	if res.RowsAffected == 1 {
+		log.Printf("Warning: sms spend limit reached (limit %d), sms verification codes are suspended until tomorrow", t.cfg.DailySpendLimit)
+	}
+}
+
+// resetSharedBreaker 关闭当日费用熔断，返回此前是否处于熔断
+func (t *VerificationThrottle) resetSharedBreaker(day string) bool {
+	res := t.db.Model(&models.SMSDailyCounter{}).
+		Where("day = ? AND counter_key = ? AND value > 0", day, smsCounterBreaker).
+		Update("value", 0)
+	if res.Error != nil {
+		log.Printf("Warning: failed to reset sms spend breaker: %v", res.Error)
+		return false
+	}
+	return res.RowsAffected > 0
+}
+
+// sharedCounters 当日全部共享计数，读取失败时返回 nil（统计退回进程内计数）
+func (t *VerificationThrottle) sharedCounters(day string) map[string]int64 {
+	var rows []models.SMSDailyCounter
+	if err := t.db.Where("day = ?", day).Find(&rows).Error; err != nil {
+		log.Printf("Warning: failed to load sms daily counters: %v", err)
+		return nil
+	}
+	counters := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counters[row.CounterKey] = row.Value
+	}
+	return counters
+}
+
+// incrementSMSCounter 按条件自增一项计数，超出上限时返回 false
+func incrementSMSCounter(tx *gorm.DB, day string, d smsCounterDelta) (bool, error) {
+	if err := ensureSMSCounter(tx, day, d.key); err != nil {
+		return false, err
+	}
+	q := tx.Model(&models.SMSDailyCounter{}).Where("day = ? AND counter_key = ?", day, d.key)
+	if d.limited {
+		q = q.Where("value + ? <= ?", d.delta, d.limit)
+	}
+	res := q.Update("value", gorm.Expr("value + ?", d.delta))
+	return res.RowsAffected == 1, res.Error
+}
+
+// ensureSMSCounter 创建当日计数行（已存在时忽略，多实例并发创建不冲突）
+func ensureSMSCounter(db *gorm.DB, day, key string) error {
+	return db.Exec("INSERT IGNORE INTO sms_daily_counters (day, counter_key, value, updated_at) VALUES (?, ?, 0, ?)",
+		day, key, time.Now()).Error
+}
@@ -0,0 +1,519 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unit-auth/config"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+// 短信路由策略
+const (
+	SMSRoutingFailover = "failover" // 按配置顺序依次尝试
+	SMSRoutingWeighted = "weighted" // 按权重随机选择首选服务商，失败后按权重从高到低故障转移
+)
+
+// 服务商熔断：连续失败达到阈值后，冷却期内排到路由末尾（所有服务商都熔断时仍会尝试）
+const (
+	smsVendorFailureThreshold = 3
+	smsVendorCooldown         = time.Minute
+)
+
+var (
+	ErrNoSMSVendor             = errors.New("no sms vendor configured")
+	ErrSMSVendorNotFound       = errors.New("sms vendor not found")
+	ErrSMSStatusNotSupported   = errors.New("sms vendor does not support status reports")
+	ErrSMSCallbackUnauthorized = errors.New("sms status callback signature verification failed")
+)
+
+var (
+	smsSendTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sms_send_total",
+		Help: "Total number of SMS submissions by vendor and result",
+	}, []string{"vendor", "result"})
+	smsSendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sms_send_duration_seconds",
+		Help:    "SMS vendor submission duration in seconds",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"vendor"})
+	smsStatusReportsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sms_status_reports_total",
+		Help: "Total number of SMS delivery reports by vendor and status",
+	}, []string{"vendor", "status"})
+)
+
+// SMSMessage 待发送的短信
+type SMSMessage struct {
+	Phone    string
+	Template string            // 模板类型：login、register、reset_password、notification
+	Params   map[string]string // 模板变量：code、minutes、content
+	Content  string            // 渲染后的正文，供不使用服务商模板的通道（Twilio 等）直接发送
+}
+
+// SMSSendResult 服务商受理结果
+type SMSSendResult struct {
+	Vendor    string `json:"vendor"`
+	MessageID string `json:"message_id"`
+}
+
+// SMSVendor 短信服务商适配器
+type SMSVendor interface {
+	Name() string
+	Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error)
+}
+
+// SMSStatusReport 服务商推送的投递回执
+type SMSStatusReport struct {
+	MessageID string
+	Phone     string
+	Status    string // models.SMSDeliveryDelivered / models.SMSDeliveryUndelivered
+	ErrorCode string
+	Error     string
+	At        time.Time
+}
+
+// SMSStatusReceiver 支持状态回执推送的服务商
+type SMSStatusReceiver interface {
+	// ParseStatusReports 校验并解析回执请求，校验失败返回 ErrSMSCallbackUnauthorized
+	ParseStatusReports(r *http.Request) ([]SMSStatusReport, error)
+	// StatusAck 回执接口的响应体（各服务商要求的格式不同）
+	StatusAck() interface{}
+}
+
+// SMSVendorError 服务商返回的业务错误
+type SMSVendorError struct {
+	Vendor  string
+	Code    string
+	Message string
+}
+
+func (e *SMSVendorError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.Vendor, e.Message, e.Code)
+}
+
+// SMSRoute 网关中的一个服务商及其权重
+type SMSRoute struct {
+	Vendor SMSVendor
+	Weight int
+}
+
+type smsRouteState struct {
+	SMSRoute
+	failures  int
+	openUntil time.Time
+}
+
+// SMSGateway 短信网关：在多个服务商之间路由与故障转移，并记录每次提交的投递状态
+type SMSGateway struct {
+	db      *gorm.DB
+	routing string
+	mu      sync.Mutex
+	routes  []*smsRouteState
+	rnd     *rand.Rand
+}
+
+// NewSMSGateway 创建短信网关
+func NewSMSGateway(db *gorm.DB, routing string, routes ...SMSRoute) *SMSGateway {
+	if routing != SMSRoutingWeighted {
+		routing = SMSRoutingFailover
+	}
+	g := &SMSGateway{
+		db:      db,
+		routing: routing,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, r := range routes {
+		if r.Weight <= 0 {
+			r.Weight = 1
+		}
+		g.routes = append(g.routes, &smsRouteState{SMSRoute: r})
+	}
+	return g
+}
+
+// NewSMSGatewayFromConfig 按 config.AppConfig 创建网关：SMSProviders（如 "aliyun:3,tencent:1,twilio"，冒号后为权重）
+// 与 SMSRouting 决定服务商与路由策略，凭据、模板与端点取自 SMS<Vendor>* 配置项；配置不完整的服务商跳过，
+// 均不可用时网关的 Send 返回 ErrNoSMSVendor（模拟服务商只在显式配置 mock 时使用）
+func NewSMSGatewayFromConfig(db *gorm.DB) *SMSGateway {
+	cfg := config.AppConfig
+	var routes []SMSRoute
+	for _, item := range strings.Split(cfg.SMSProviders, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, weight := item, 1
+		if i := strings.Index(item, ":"); i >= 0 {
+			name = strings.TrimSpace(item[:i])
+			if w, err := strconv.Atoi(strings.TrimSpace(item[i+1:])); err == nil {
+				weight = w
+			}
+		}
+		vendor, err := smsVendorFromConfig(cfg, strings.ToLower(name))
+		if err != nil {
+			log.Printf("Warning: skip sms vendor %s: %v", name, err)
+			continue
+		}
+		routes = append(routes, SMSRoute{Vendor: vendor, Weight: weight})
+	}
+	if len(routes) == 0 {
+		// 不回退到模拟服务商：配置错误时验证码必须发送失败，而不是"发送成功"却只写进日志
+		log.Printf("Warning: no sms vendor available from SMS_PROVIDERS=%q, sms sending will fail with %v", cfg.SMSProviders, ErrNoSMSVendor)
+	}
+	return NewSMSGateway(db, cfg.SMSRouting, routes...)
+}
+
+func smsVendorFromConfig(cfg config.Config, name string) (SMSVendor, error) {
+	switch name {
+	case "mock":
+		return NewMockSMSVendor(), nil
+	case "aliyun":
+		return NewAliyunSMSVendor(AliyunSMSConfig{
+			AccessKeyID:     cfg.SMSAliyunAccessKeyID,
+			AccessKeySecret: cfg.SMSAliyunAccessKeySecret,
+			SignName:        cfg.SMSAliyunSignName,
+			Templates:       ParseSMSTemplates(cfg.SMSAliyunTemplates),
+			RegionID:        cfg.SMSAliyunRegion,
+			Endpoint:        cfg.SMSAliyunEndpoint,
+			CallbackToken:   cfg.SMSCallbackToken,
+		})
+	case "tencent":
+		return NewTencentSMSVendor(TencentSMSConfig{
+			SecretID:       cfg.SMSTencentSecretID,
+			SecretKey:      cfg.SMSTencentSecretKey,
+			SDKAppID:       cfg.SMSTencentSDKAppID,
+			SignName:       cfg.SMSTencentSignName,
+			Templates:      ParseSMSTemplates(cfg.SMSTencentTemplates),
+			TemplateParams: splitSMSList(cfg.SMSTencentTemplateParams),
+			Region:         cfg.SMSTencentRegion,
+			Endpoint:       cfg.SMSTencentEndpoint,
+			CallbackToken:  cfg.SMSCallbackToken,
+		})
+	case "twilio":
+		return NewTwilioSMSVendor(TwilioSMSConfig{
+			AccountSID:          cfg.SMSTwilioAccountSID,
+			AuthToken:           cfg.SMSTwilioAuthToken,
+			From:                cfg.SMSTwilioFrom,
+			MessagingServiceSID: cfg.SMSTwilioMessagingServiceSID,
+			StatusCallback:      cfg.SMSTwilioStatusCallback,
+			Endpoint:            cfg.SMSTwilioEndpoint,
+		})
+	}
+	return nil, fmt.Errorf("unknown sms vendor %q", name)
+}
+
+// ParseSMSTemplates 解析模板映射，如 "login:SMS_001,register:SMS_002,default:SMS_000"
+func ParseSMSTemplates(spec string) map[string]string {
+	templates := map[string]string{}
+	for _, item := range splitSMSList(spec) {
+		if i := strings.Index(item, ":"); i > 0 {
+			templates[strings.TrimSpace(item[:i])] = strings.TrimSpace(item[i+1:])
+		}
+	}
+	return templates
+}
+
+func splitSMSList(spec string) []string {
+	var list []string
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// smsTemplateID 查找模板类型对应的服务商模板，未配置时使用 default
+func smsTemplateID(vendor string, templates map[string]string, template string) (string, error) {
+	if id := templates[template]; id != "" {
+		return id, nil
+	}
+	if id := templates["default"]; id != "" {
+		return id, nil
+	}
+	return "", &SMSVendorError{Vendor: vendor, Code: "TemplateNotConfigured", Message: "no template configured for " + template}
+}
+
+// Send 按路由策略发送短信，失败时故障转移到下一个服务商；每次提交写入一条投递记录
+func (g *SMSGateway) Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	routes := g.plan()
+	if len(routes) == 0 {
+		return nil, ErrNoSMSVendor
+	}
+
+	requestID := uuid.NewString()
+	var lastErr error
+	for i, route := range routes {
+		name := route.Vendor.Name()
+		start := time.Now()
+		result, err := route.Vendor.Send(ctx, msg)
+		elapsed := time.Since(start)
+
+		smsSendDuration.WithLabelValues(name).Observe(elapsed.Seconds())
+		g.recordDelivery(requestID, i+1, name, msg, result, err, elapsed)
+		g.reportResult(route, err)
+
+		if err == nil {
+			smsSendTotal.WithLabelValues(name, "success").Inc()
+			result.Vendor = name
+			return result, nil
+		}
+		smsSendTotal.WithLabelValues(name, "failure").Inc()
+		log.Printf("Warning: sms vendor %s failed to send to %s: %v", name, msg.Phone, err)
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("all sms vendors failed: %w", lastErr)
+}
+
+// plan 本次发送的服务商尝试顺序（熔断中的服务商排在最后）
+func (g *SMSGateway) plan() []*smsRouteState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var healthy, open []*smsRouteState
+	for _, r := range g.routes {
+		if now.Before(r.openUntil) {
+			open = append(open, r)
+		} else {
+			healthy = append(healthy, r)
+		}
+	}
+
+	if g.routing == SMSRoutingWeighted && len(healthy) > 1 {
+		total := 0
+		for _, r := range healthy {
+			total += r.Weight
+		}
+		pick := g.rnd.Intn(total)
+		first := 0
+		for i, r := range healthy {
+			if pick < r.Weight {
+				first = i
+				break
+			}
+			pick -= r.Weight
+		}
+		rest := make([]*smsRouteState, 0, len(healthy)-1)
+		rest = append(rest, healthy[:first]...)
+		rest = append(rest, healthy[first+1:]...)
+		sort.SliceStable(rest, func(i, j int) bool { return rest[i].Weight > rest[j].Weight })
+		healthy = append([]*smsRouteState{healthy[first]}, rest...)
+	}
+	return append(healthy, open...)
+}
+
+func (g *SMSGateway) reportResult(route *smsRouteState, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err == nil {
+		route.failures = 0
+		route.openUntil = time.Time{}
+		return
+	}
+	route.failures++
+	if route.failures >= smsVendorFailureThreshold {
+		route.openUntil = time.Now().Add(smsVendorCooldown)
+		log.Printf("Warning: sms vendor %s failed %d times in a row, deprioritized for %s", route.Vendor.Name(), route.failures, smsVendorCooldown)
+	}
+}
+
+func (g *SMSGateway) recordDelivery(requestID string, attempt int, vendor string, msg *SMSMessage, result *SMSSendResult, sendErr error, elapsed time.Duration) {
+	if g.db == nil {
+		return
+	}
+	delivery := models.SMSDelivery{
+		RequestID: requestID,
+		Phone:     msg.Phone,
+		Template:  msg.Template,
+		Vendor:    vendor,
+		Attempt:   attempt,
+		Status:    models.SMSDeliverySent,
+		LatencyMS: elapsed.Milliseconds(),
+	}
+	if result != nil {
+		delivery.MessageID = result.MessageID
+	}
+	if sendErr != nil {
+		delivery.Status = models.SMSDeliveryFailed
+		delivery.Error = truncateSMSError(sendErr.Error())
+		var vendorErr *SMSVendorError
+		if errors.As(sendErr, &vendorErr) {
+			delivery.ErrorCode = vendorErr.Code
+		}
+	}
+	if err := g.db.Create(&delivery).Error; err != nil {
+		log.Printf("Warning: failed to record sms delivery: %v", err)
+	}
+}
+
+// HandleStatusReport 处理服务商推送的投递回执，按服务商消息 ID 回写投递状态，返回服务商要求的响应体
+func (g *SMSGateway) HandleStatusReport(vendor string, r *http.Request) (interface{}, error) {
+	var found SMSVendor
+	for _, route := range g.routes {
+		if route.Vendor.Name() == vendor {
+			found = route.Vendor
+			break
+		}
+	}
+	if found == nil {
+		return nil, ErrSMSVendorNotFound
+	}
+	receiver, ok := found.(SMSStatusReceiver)
+	if !ok {
+		return nil, ErrSMSStatusNotSupported
+	}
+
+	reports, err := receiver.ParseStatusReports(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, report := range reports {
+		smsStatusReportsTotal.WithLabelValues(vendor, report.Status).Inc()
+		if report.MessageID == "" || g.db == nil {
+			continue
+		}
+		at := report.At
+		if at.IsZero() {
+			at = time.Now()
+		}
+		updates := map[string]interface{}{
+			"status":       report.Status,
+			"delivered_at": at,
+		}
+		if report.Status != models.SMSDeliveryDelivered {
+			updates["error_code"] = report.ErrorCode
+			updates["error"] = truncateSMSError(report.Error)
+		}
+		if err := g.db.Model(&models.SMSDelivery{}).
+			Where("vendor = ? AND message_id = ?", vendor, report.MessageID).
+			Updates(updates).Error; err != nil {
+			log.Printf("Warning: failed to update sms delivery %s/%s: %v", vendor, report.MessageID, err)
+		}
+	}
+	return receiver.StatusAck(), nil
+}
+
+// VendorStatus 各服务商的路由状态（管理后台展示）
+func (g *SMSGateway) VendorStatus() []map[string]interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	list := make([]map[string]interface{}, 0, len(g.routes))
+	for _, r := range g.routes {
+		item := map[string]interface{}{
+			"name":                 r.Vendor.Name(),
+			"weight":               r.Weight,
+			"consecutive_failures": r.failures,
+			"healthy":              !now.Before(r.openUntil),
+		}
+		if now.Before(r.openUntil) {
+			item["deprioritized_until"] = r.openUntil
+		}
+		_, item["status_reports"] = r.Vendor.(SMSStatusReceiver)
+		list = append(list, item)
+	}
+	return list
+}
+
+// Routing 路由策略
+func (g *SMSGateway) Routing() string {
+	return g.routing
+}
+
+// SendVerificationCode 实现 SMSService：template 为模板类型（login、register、reset_password）
+func (g *SMSGateway) SendVerificationCode(phone, code, template string) error {
+	minutes := strconv.Itoa(smsCodeTTLMinutes)
+	_, err := g.Send(context.Background(), &SMSMessage{
+		Phone:    phone,
+		Template: template,
+		Params:   map[string]string{"code": code, "minutes": minutes},
+		Content:  renderSMSContent(template, map[string]string{"code": code, "minutes": minutes}),
+	})
+	return err
+}
+
+// SendNotification 实现 SMSService：发送通知短信（模板类服务商需配置 notification 模板，变量 content）
+func (g *SMSGateway) SendNotification(phone, message string) error {
+	_, err := g.Send(context.Background(), &SMSMessage{
+		Phone:    phone,
+		Template: "notification",
+		Params:   map[string]string{"content": message},
+		Content:  message,
+	})
+	return err
+}
+
+// smsContentTemplates 短信正文模板（服务商模板之外的纯文本通道使用）
+var smsContentTemplates = map[string]string{
+	"login":          "您的登录验证码是：{code}，{minutes}分钟内有效。",
+	"register":       "您的注册验证码是：{code}，{minutes}分钟内有效。",
+	"reset_password": "您的密码重置验证码是：{code}，{minutes}分钟内有效。",
+}
+
+func renderSMSContent(template string, params map[string]string) string {
+	content, ok := smsContentTemplates[template]
+	if !ok {
+		content = "您的验证码是：{code}，{minutes}分钟内有效。"
+	}
+	for k, v := range params {
+		content = strings.ReplaceAll(content, "{"+k+"}", v)
+	}
+	return content
+}
+
+func truncateSMSError(msg string) string {
+	if len(msg) > 500 {
+		return msg[:500]
+	}
+	return msg
+}
+
+// readSMSResponse 读取服务商响应体（限制大小）
+func readSMSResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// smsE164 转为 E.164 格式（不带区号的号码按全局默认地区解析）
+func smsE164(phone string) string {
+	if e164, err := utils.NormalizePhone(phone, utils.DefaultPhoneRegion()); err == nil {
+		return e164
+	}
+	return phone
+}
+
+// MockSMSVendor 模拟服务商：只记录日志，用于开发环境
+type MockSMSVendor struct{}
+
+// NewMockSMSVendor 创建模拟服务商
+func NewMockSMSVendor() *MockSMSVendor {
+	return &MockSMSVendor{}
+}
+
+func (v *MockSMSVendor) Name() string { return "mock" }
+
+// Send 记录短信内容并返回模拟消息 ID
+func (v *MockSMSVendor) Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	log.Printf("📱 [模拟] 发送短信到 %s: %s", msg.Phone, msg.Content)
+	return &SMSSendResult{MessageID: "mock-" + uuid.NewString()}, nil
+}
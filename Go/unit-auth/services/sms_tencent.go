@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unit-auth/models"
+	"unit-auth/utils"
+)
+
+// TencentSMSEndpoint 腾讯云短信默认端点
+const TencentSMSEndpoint = "https://sms.tencentcloudapi.com"
+
+// TencentSMSConfig 腾讯云短信配置
+type TencentSMSConfig struct {
+	SecretID       string
+	SecretKey      string
+	SDKAppID       string            // 短信应用 SdkAppId
+	SignName       string            // 签名内容
+	Templates      map[string]string // 模板类型 -> 模板 ID
+	TemplateParams []string          // 模板变量顺序（腾讯云模板变量按位置传递），默认 code,minutes,content
+	Region         string            // 默认 ap-guangzhou
+	Endpoint       string            // 默认 TencentSMSEndpoint
+	CallbackToken  string            // 状态回执推送地址上的 token 参数
+	HTTPClient     *http.Client
+}
+
+// TencentSMSVendor 腾讯云短信（API 3.0，TC3-HMAC-SHA256 签名）
+type TencentSMSVendor struct {
+	cfg TencentSMSConfig
+}
+
+// NewTencentSMSVendor 创建腾讯云短信适配器
+func NewTencentSMSVendor(cfg TencentSMSConfig) (*TencentSMSVendor, error) {
+	if cfg.SecretID == "" || cfg.SecretKey == "" || cfg.SDKAppID == "" || cfg.SignName == "" {
+		return nil, errors.New("tencent sms requires secret id, secret key, sdk app id and sign name")
+	}
+	if len(cfg.TemplateParams) == 0 {
+		cfg.TemplateParams = []string{"code", "minutes", "content"}
+	}
+	if cfg.Region == "" {
+		cfg.Region = "ap-guangzhou"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = TencentSMSEndpoint
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = utils.UpstreamHTTPClient()
+	}
+	return &TencentSMSVendor{cfg: cfg}, nil
+}
+
+func (v *TencentSMSVendor) Name() string { return "tencent" }
+
+// Send 调用 SendSms 接口（版本 2021-01-11）
+func (v *TencentSMSVendor) Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	templateID, err := smsTemplateID(v.Name(), v.cfg.Templates, msg.Template)
+	if err != nil {
+		return nil, err
+	}
+	templateParams := []string{}
+	for _, name := range v.cfg.TemplateParams {
+		if value, ok := msg.Params[name]; ok {
+			templateParams = append(templateParams, value)
+		}
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"PhoneNumberSet":   []string{smsE164(msg.Phone)},
+		"SmsSdkAppId":      v.cfg.SDKAppID,
+		"SignName":         v.cfg.SignName,
+		"TemplateId":       templateID,
+		"TemplateParamSet": templateParams,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := url.Parse(v.cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	path := endpoint.Path
+	if path == "" {
+		path = "/"
+	}
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Scheme+"://"+endpoint.Host+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", tencentContentType)
+	req.Header.Set("X-TC-Action", "SendSms")
+	req.Header.Set("X-TC-Version", "2021-01-11")
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-TC-Region", v.cfg.Region)
+	req.Header.Set("Authorization", TencentTC3Authorization(v.cfg.SecretID, v.cfg.SecretKey, "sms", endpoint.Host, path, payload, timestamp))
+
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readSMSResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Response struct {
+			Error *struct {
+				Code    string `json:"Code"`
+				Message string `json:"Message"`
+			} `json:"Error"`
+			SendStatusSet []struct {
+				SerialNo string `json:"SerialNo"`
+				Code     string `json:"Code"`
+				Message  string `json:"Message"`
+			} `json:"SendStatusSet"`
+		} `json:"Response"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, &SMSVendorError{Vendor: v.Name(), Code: resp.Status, Message: "invalid response"}
+	}
+	if e := result.Response.Error; e != nil {
+		return nil, &SMSVendorError{Vendor: v.Name(), Code: e.Code, Message: e.Message}
+	}
+	if len(result.Response.SendStatusSet) == 0 {
+		return nil, &SMSVendorError{Vendor: v.Name(), Code: "EmptyResponse", Message: "no send status returned"}
+	}
+	status := result.Response.SendStatusSet[0]
+	if status.Code != "Ok" {
+		return nil, &SMSVendorError{Vendor: v.Name(), Code: status.Code, Message: status.Message}
+	}
+	return &SMSSendResult{MessageID: status.SerialNo}, nil
+}
+
+// ParseStatusReports 解析短信下发状态回调（JSON 数组）；回调地址需带 ?token=SMS_CALLBACK_TOKEN
+func (v *TencentSMSVendor) ParseStatusReports(r *http.Request) ([]SMSStatusReport, error) {
+	if !smsCallbackTokenValid(v.cfg.CallbackToken, r) {
+		return nil, ErrSMSCallbackUnauthorized
+	}
+	var items []struct {
+		UserReceiveTime string `json:"user_receive_time"`
+		NationCode      string `json:"nationcode"`
+		Mobile          string `json:"mobile"`
+		ReportStatus    string `json:"report_status"`
+		ErrMsg          string `json:"errmsg"`
+		Description     string `json:"description"`
+		SID             string `json:"sid"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+	reports := make([]SMSStatusReport, 0, len(items))
+	for _, item := range items {
+		report := SMSStatusReport{
+			MessageID: item.SID,
+			Phone:     item.Mobile,
+			Status:    models.SMSDeliveryDelivered,
+		}
+		if item.ReportStatus != "SUCCESS" {
+			report.Status = models.SMSDeliveryUndelivered
+			report.ErrorCode = item.ErrMsg
+			report.Error = item.Description
+		}
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", item.UserReceiveTime, chinaTimeZone); err == nil {
+			report.At = t
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// StatusAck 腾讯云要求回调接口返回 result=0
+func (v *TencentSMSVendor) StatusAck() interface{} {
+	return map[string]interface{}{"result": 0, "errmsg": "OK"}
+}
+
+const tencentContentType = "application/json; charset=utf-8"
+
+// TencentTC3Authorization 腾讯云 API 3.0 签名（TC3-HMAC-SHA256），签名头为 content-type;host
+func TencentTC3Authorization(secretID, secretKey, service, host, path string, payload []byte, timestamp int64) string {
+	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		http.MethodPost,
+		path,
+		"",
+		"content-type:" + tencentContentType + "\nhost:" + host + "\n",
+		"content-type;host",
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + service + "/tc3_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(timestamp, 10) + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	secretDate := hmacSHA256([]byte("TC3"+secretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+
+	return "TC3-HMAC-SHA256 Credential=" + secretID + "/" + scope + ", SignedHeaders=content-type;host, Signature=" + signature
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unit-auth/models"
+	"unit-auth/utils"
+)
+
+// TwilioSMSEndpoint Twilio 默认端点
+const TwilioSMSEndpoint = "https://api.twilio.com"
+
+// TwilioSMSConfig Twilio 风格 HTTP 短信配置（Basic 认证 + 表单提交正文，不使用服务商模板）
+type TwilioSMSConfig struct {
+	AccountSID          string
+	AuthToken           string
+	From                string // 发送号码，与 MessagingServiceSID 二选一
+	MessagingServiceSID string
+	StatusCallback      string // 状态回调的公网完整地址，同时用于校验 X-Twilio-Signature
+	Endpoint            string // 默认 TwilioSMSEndpoint
+	HTTPClient          *http.Client
+}
+
+// TwilioSMSVendor Twilio 短信
+type TwilioSMSVendor struct {
+	cfg TwilioSMSConfig
+}
+
+// NewTwilioSMSVendor 创建 Twilio 短信适配器
+func NewTwilioSMSVendor(cfg TwilioSMSConfig) (*TwilioSMSVendor, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" || (cfg.From == "" && cfg.MessagingServiceSID == "") {
+		return nil, errors.New("twilio sms requires account sid, auth token and a from number or messaging service sid")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = TwilioSMSEndpoint
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = utils.UpstreamHTTPClient()
+	}
+	return &TwilioSMSVendor{cfg: cfg}, nil
+}
+
+func (v *TwilioSMSVendor) Name() string { return "twilio" }
+
+// Send 调用 Messages 接口发送正文
+func (v *TwilioSMSVendor) Send(ctx context.Context, msg *SMSMessage) (*SMSSendResult, error) {
+	if msg.Content == "" {
+		return nil, &SMSVendorError{Vendor: v.Name(), Code: "EmptyBody", Message: "message content is empty"}
+	}
+	form := url.Values{}
+	form.Set("To", smsE164(msg.Phone))
+	form.Set("Body", msg.Content)
+	if v.cfg.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", v.cfg.MessagingServiceSID)
+	} else {
+		form.Set("From", v.cfg.From)
+	}
+	if v.cfg.StatusCallback != "" {
+		form.Set("StatusCallback", v.cfg.StatusCallback)
+	}
+
+	endpoint := strings.TrimRight(v.cfg.Endpoint, "/") + "/2010-04-01/Accounts/" + url.PathEscape(v.cfg.AccountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(v.cfg.AccountSID, v.cfg.AuthToken)
+
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readSMSResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		SID     string `json:"sid"`
+		Status  string `json:"status"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, &SMSVendorError{Vendor: v.Name(), Code: resp.Status, Message: "invalid response"}
+	}
+	if resp.StatusCode >= 300 || result.SID == "" {
+		code := strconv.Itoa(resp.StatusCode)
+		if result.Code != 0 {
+			code = strconv.Itoa(result.Code)
+		}
+		return nil, &SMSVendorError{Vendor: v.Name(), Code: code, Message: result.Message}
+	}
+	return &SMSSendResult{MessageID: result.SID}, nil
+}
+
+// ParseStatusReports 解析状态回调（表单）并校验 X-Twilio-Signature；只处理 delivered / undelivered / failed 终态
+func (v *TwilioSMSVendor) ParseStatusReports(r *http.Request) ([]SMSStatusReport, error) {
+	if v.cfg.StatusCallback == "" {
+		return nil, ErrSMSCallbackUnauthorized
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	expected := TwilioSignature(v.cfg.AuthToken, v.cfg.StatusCallback, r.PostForm)
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Twilio-Signature")), []byte(expected)) != 1 {
+		return nil, ErrSMSCallbackUnauthorized
+	}
+
+	report := SMSStatusReport{
+		MessageID: r.PostForm.Get("MessageSid"),
+		Phone:     r.PostForm.Get("To"),
+	}
+	switch r.PostForm.Get("MessageStatus") {
+	case "delivered":
+		report.Status = models.SMSDeliveryDelivered
+	case "undelivered", "failed":
+		report.Status = models.SMSDeliveryUndelivered
+		report.ErrorCode = r.PostForm.Get("ErrorCode")
+		report.Error = r.PostForm.Get("ErrorMessage")
+	default:
+		return nil, nil
+	}
+	return []SMSStatusReport{report}, nil
+}
+
+// StatusAck Twilio 只要求 2xx
+func (v *TwilioSMSVendor) StatusAck() interface{} {
+	return map[string]interface{}{}
+}
+
+// TwilioSignature 回调签名：完整 URL 后按参数名排序拼接 key+value，HMAC-SHA1(auth token) 后 base64
+func TwilioSignature(authToken, callbackURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(callbackURL)
+	for _, k := range keys {
+		for _, value := range params[k] {
+			b.WriteString(k)
+			b.WriteString(value)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
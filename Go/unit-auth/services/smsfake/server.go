@@ -0,0 +1,326 @@
+// Package smsfake 本地 fake 短信服务，模拟阿里云、腾讯云与 Twilio 的发送接口并校验各自的请求签名，
+// 配合短信网关的端点覆盖即可在无外网环境下联调短信发送、故障转移与投递记录。
+package smsfake
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 服务商名称（与网关中的适配器名称一致）
+const (
+	VendorAliyun  = "aliyun"
+	VendorTencent = "tencent"
+	VendorTwilio  = "twilio"
+)
+
+// Credentials 各服务商的 fake 凭据，用于校验请求签名
+type Credentials struct {
+	AliyunAccessKeyID     string
+	AliyunAccessKeySecret string
+	TencentSecretID       string
+	TencentSecretKey      string
+	TwilioAccountSID      string
+	TwilioAuthToken       string
+}
+
+// DefaultCredentials 默认 fake 凭据（cmd/fake-sms 与联调脚本使用）
+var DefaultCredentials = Credentials{
+	AliyunAccessKeyID:     "fake-aliyun-key",
+	AliyunAccessKeySecret: "fake-aliyun-secret",
+	TencentSecretID:       "fake-tencent-id",
+	TencentSecretKey:      "fake-tencent-key",
+	TwilioAccountSID:      "ACfake",
+	TwilioAuthToken:       "fake-twilio-token",
+}
+
+// Message fake 服务收到的短信
+type Message struct {
+	Vendor   string            `json:"vendor"`
+	ID       string            `json:"id"`
+	Phone    string            `json:"phone"`
+	SignName string            `json:"sign_name,omitempty"`
+	Template string            `json:"template,omitempty"`
+	Params   map[string]string `json:"params,omitempty"` // 阿里云为变量名，腾讯云为位置序号
+	Body     string            `json:"body,omitempty"`
+	At       time.Time         `json:"at"`
+}
+
+// Server fake 短信服务
+type Server struct {
+	mu       sync.Mutex
+	creds    Credentials
+	messages []Message
+	failures map[string]int
+	seq      int
+}
+
+// New 创建 fake 短信服务
+func New(creds Credentials) *Server {
+	return &Server{creds: creds, failures: map[string]int{}}
+}
+
+// FailNext 令指定服务商接下来 n 次发送返回服务商错误（用于验证故障转移）
+func (s *Server) FailNext(vendor string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[vendor] = n
+}
+
+// Messages 已收到的短信
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Handler 路由：
+//
+//	POST /aliyun/                                        阿里云 SendSms
+//	POST /tencent/                                       腾讯云 SendSms
+//	POST /twilio/2010-04-01/Accounts/{sid}/Messages.json Twilio Messages
+//	GET  /_fake/messages                                 已收到的短信
+//	POST /_fake/fail?vendor=aliyun&count=2               注入失败
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/aliyun/", s.handleAliyun)
+	mux.HandleFunc("/tencent", s.handleTencent)
+	mux.HandleFunc("/tencent/", s.handleTencent)
+	mux.HandleFunc("/twilio/", s.handleTwilio)
+	mux.HandleFunc("/_fake/messages", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Messages())
+	})
+	mux.HandleFunc("/_fake/fail", func(w http.ResponseWriter, r *http.Request) {
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		if count == 0 {
+			count = 1
+		}
+		s.FailNext(r.URL.Query().Get("vendor"), count)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"vendor": r.URL.Query().Get("vendor"), "count": count})
+	})
+	return mux
+}
+
+// Start 在随机端口启动（测试用）
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s.Handler())
+}
+
+// ListenAndServe 在指定地址启动
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// shouldFail 消耗一次注入的失败
+func (s *Server) shouldFail(vendor string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures[vendor] > 0 {
+		s.failures[vendor]--
+		return true
+	}
+	return false
+}
+
+func (s *Server) record(m Message) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	m.ID = fmt.Sprintf("fake-%s-%d", m.Vendor, s.seq)
+	m.At = time.Now()
+	s.messages = append(s.messages, m)
+	return m.ID
+}
+
+func (s *Server) handleAliyun(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, aliyunError("InvalidParameter", err.Error()))
+		return
+	}
+	params := r.Form
+	if params.Get("AccessKeyId") != s.creds.AliyunAccessKeyID {
+		writeJSON(w, http.StatusNotFound, aliyunError("InvalidAccessKeyId.NotFound", "Specified access key is not found."))
+		return
+	}
+	if !hmac.Equal([]byte(params.Get("Signature")), []byte(aliyunSignature(r.Method, params, s.creds.AliyunAccessKeySecret))) {
+		writeJSON(w, http.StatusBadRequest, aliyunError("SignatureDoesNotMatch", "Specified signature is not matched with our calculation."))
+		return
+	}
+	if params.Get("Action") != "SendSms" {
+		writeJSON(w, http.StatusBadRequest, aliyunError("InvalidAction.NotFound", "Specified api is not found."))
+		return
+	}
+	if s.shouldFail(VendorAliyun) {
+		writeJSON(w, http.StatusOK, aliyunError("isv.BUSINESS_LIMIT_CONTROL", "触发分钟级流控Permits:1"))
+		return
+	}
+
+	templateParams := map[string]string{}
+	json.Unmarshal([]byte(params.Get("TemplateParam")), &templateParams)
+	id := s.record(Message{
+		Vendor:   VendorAliyun,
+		Phone:    params.Get("PhoneNumbers"),
+		SignName: params.Get("SignName"),
+		Template: params.Get("TemplateCode"),
+		Params:   templateParams,
+	})
+	writeJSON(w, http.StatusOK, map[string]string{"Code": "OK", "Message": "OK", "BizId": id, "RequestId": id})
+}
+
+func (s *Server) handleTencent(w http.ResponseWriter, r *http.Request) {
+	payload, _ := io.ReadAll(r.Body)
+	timestamp, _ := strconv.ParseInt(r.Header.Get("X-TC-Timestamp"), 10, 64)
+	expected := tencentAuthorization(s.creds.TencentSecretID, s.creds.TencentSecretKey, r.Header.Get("Content-Type"), r.Host, r.URL.Path, payload, timestamp)
+	if !hmac.Equal([]byte(r.Header.Get("Authorization")), []byte(expected)) {
+		writeJSON(w, http.StatusOK, tencentError("AuthFailure.SignatureFailure", "The provided credentials could not be validated."))
+		return
+	}
+	if r.Header.Get("X-TC-Action") != "SendSms" {
+		writeJSON(w, http.StatusOK, tencentError("InvalidAction", "The action is not found."))
+		return
+	}
+
+	var req struct {
+		PhoneNumberSet   []string `json:"PhoneNumberSet"`
+		SignName         string   `json:"SignName"`
+		TemplateID       string   `json:"TemplateId"`
+		TemplateParamSet []string `json:"TemplateParamSet"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil || len(req.PhoneNumberSet) == 0 {
+		writeJSON(w, http.StatusOK, tencentError("InvalidParameter", "invalid request body"))
+		return
+	}
+	if s.shouldFail(VendorTencent) {
+		writeJSON(w, http.StatusOK, tencentError("InternalError.Timeout", "请求下发短信超时"))
+		return
+	}
+
+	templateParams := map[string]string{}
+	for i, v := range req.TemplateParamSet {
+		templateParams[strconv.Itoa(i+1)] = v
+	}
+	id := s.record(Message{
+		Vendor:   VendorTencent,
+		Phone:    req.PhoneNumberSet[0],
+		SignName: req.SignName,
+		Template: req.TemplateID,
+		Params:   templateParams,
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Response": map[string]interface{}{
+			"SendStatusSet": []map[string]interface{}{{
+				"SerialNo":    id,
+				"PhoneNumber": req.PhoneNumberSet[0],
+				"Fee":         1,
+				"Code":        "Ok",
+				"Message":     "send success",
+			}},
+			"RequestId": id,
+		},
+	})
+}
+
+func (s *Server) handleTwilio(w http.ResponseWriter, r *http.Request) {
+	sid, token, ok := r.BasicAuth()
+	if !ok || sid != s.creds.TwilioAccountSID || token != s.creds.TwilioAuthToken {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"code": 20003, "message": "Authenticate", "status": 401})
+		return
+	}
+	if r.URL.Path != "/twilio/2010-04-01/Accounts/"+sid+"/Messages.json" {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"code": 20404, "message": "The requested resource was not found", "status": 404})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("To") == "" || r.PostForm.Get("Body") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"code": 21604, "message": "A 'To' phone number and 'Body' are required.", "status": 400})
+		return
+	}
+	if s.shouldFail(VendorTwilio) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"code": 20503, "message": "Service Unavailable", "status": 503})
+		return
+	}
+
+	id := s.record(Message{
+		Vendor: VendorTwilio,
+		Phone:  r.PostForm.Get("To"),
+		Body:   r.PostForm.Get("Body"),
+	})
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"sid":    id,
+		"status": "queued",
+		"to":     r.PostForm.Get("To"),
+		"body":   r.PostForm.Get("Body"),
+	})
+}
+
+func aliyunError(code, message string) map[string]string {
+	return map[string]string{"Code": code, "Message": message, "RequestId": "fake"}
+}
+
+func tencentError(code, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"Response": map[string]interface{}{
+			"Error":     map[string]string{"Code": code, "Message": message},
+			"RequestId": "fake",
+		},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// aliyunSignature 独立实现的阿里云 RPC 签名（与网关实现互相校验）
+func aliyunSignature(method string, params url.Values, secret string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "Signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	encode := func(s string) string {
+		return strings.NewReplacer("+", "%20", "*", "%2A", "%7E", "~").Replace(url.QueryEscape(s))
+	}
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, encode(k)+"="+encode(params.Get(k)))
+	}
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(method + "&" + encode("/") + "&" + encode(strings.Join(pairs, "&"))))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// tencentAuthorization 独立实现的腾讯云 TC3-HMAC-SHA256 签名
+func tencentAuthorization(secretID, secretKey, contentType, host, path string, payload []byte, timestamp int64) string {
+	sum := func(b []byte) string {
+		h := sha256.Sum256(b)
+		return hex.EncodeToString(h[:])
+	}
+	mac := func(key []byte, data string) []byte {
+		m := hmac.New(sha256.New, key)
+		m.Write([]byte(data))
+		return m.Sum(nil)
+	}
+	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+	canonical := "POST\n" + path + "\n\ncontent-type:" + contentType + "\nhost:" + host + "\n\ncontent-type;host\n" + sum(payload)
+	scope := date + "/sms/tc3_request"
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(timestamp, 10) + "\n" + scope + "\n" + sum([]byte(canonical))
+	key := mac(mac(mac([]byte("TC3"+secretKey), date), "sms"), "tc3_request")
+	return "TC3-HMAC-SHA256 Credential=" + secretID + "/" + scope + ", SignedHeaders=content-type;host, Signature=" + hex.EncodeToString(mac(key, stringToSign))
+}
@@ -0,0 +1,447 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"unit-auth/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSyncConflictNotFound  = errors.New("sync conflict not found")
+	ErrSyncConflictResolved  = errors.New("sync conflict is already resolved")
+	ErrSyncResolutionInvalid = errors.New("invalid conflict resolution")
+)
+
+// syncConflictStrategy 任务的冲突处理策略（config.conflict_strategy），默认 manual：记录冲突等待管理员处理
+func syncConflictStrategy(task *models.SyncTask) string {
+	cfg, err := task.GetConfig()
+	if err != nil {
+		return models.SyncResolutionManual
+	}
+	if strategy, ok := cfg["conflict_strategy"].(string); ok && strategy != "" {
+		return strategy
+	}
+	return models.SyncResolutionManual
+}
+
+// newSyncConflict 由写入时检测到的冲突构造冲突记录
+func newSyncConflict(taskID uint, table, recordID string, source map[string]interface{}, sourceTime time.Time, conflict *syncConflictError) *models.SyncConflict {
+	sc := &models.SyncConflict{
+		TaskID:       taskID,
+		TableName:    table,
+		RecordID:     recordID,
+		ConflictType: conflict.conflictType,
+		Notes:        truncate(conflict.reason, 1000),
+	}
+	sourceData, _ := json.Marshal(source)
+	sc.SourceData = models.JSON(sourceData)
+	if conflict.target != nil {
+		targetData, _ := json.Marshal(conflict.target)
+		sc.TargetData = models.JSON(targetData)
+		if t := syncTime(conflict.target["updated_at"]); !t.IsZero() {
+			sc.TargetTime = &t
+		}
+	}
+	if !sourceTime.IsZero() {
+		sc.SourceTime = &sourceTime
+	}
+	return sc
+}
+
+// handleConflict 按任务策略处理冲突：manual 或自动处理失败时记为待处理；
+// source_wins 与 last_writer_wins 只自动处理 data_inconsistency，唯一键与约束冲突重试写入仍会失败
+func (e *SyncEngine) handleConflict(ctx context.Context, task *models.SyncTask, target syncEndpoint, sc *models.SyncConflict, stats *syncMappingStats) {
+	strategy := syncConflictStrategy(task)
+	auto := strategy == models.SyncResolutionTargetWins || strategy == models.SyncResolutionIgnore ||
+		((strategy == models.SyncResolutionSourceWins || strategy == models.SyncResolutionLastWriterWins) && sc.ConflictType == models.SyncConflictDataInconsistency)
+	if auto {
+		summary, err := e.applyResolution(ctx, target, sc, strategy, nil, nil)
+		if err == nil {
+			now := time.Now()
+			sc.Resolution = strategy
+			sc.ResolvedAt = &now
+			sc.Notes = joinSyncNotes(sc.Notes, summary, "resolved by task conflict_strategy")
+			stats.Resolved++
+			syncRecordsTotal.WithLabelValues("resolved").Inc()
+		} else {
+			sc.Notes = joinSyncNotes(sc.Notes, strategy+" failed: "+err.Error())
+			auto = false
+		}
+	}
+	if !auto {
+		stats.Conflicts++
+		syncRecordsTotal.WithLabelValues("conflict").Inc()
+	}
+	if err := saveSyncConflict(e.db, sc); err != nil {
+		log.Printf("Warning: failed to record sync conflict for task %d record %s: %v", task.ID, sc.RecordID, err)
+	}
+}
+
+// saveSyncConflict 记录冲突；同一记录已有未解决的冲突时更新该条（自动处理时一并关闭）
+func saveSyncConflict(db *gorm.DB, sc *models.SyncConflict) error {
+	var existing models.SyncConflict
+	err := db.Where("task_id = ? AND table_name = ? AND record_id = ? AND resolved_at IS NULL", sc.TaskID, sc.TableName, sc.RecordID).First(&existing).Error
+	if err != nil {
+		return db.Create(sc).Error
+	}
+	sc.ID = existing.ID
+	return db.Model(&existing).Updates(map[string]interface{}{
+		"conflict_type": sc.ConflictType,
+		"source_data":   sc.SourceData,
+		"target_data":   sc.TargetData,
+		"source_time":   sc.SourceTime,
+		"target_time":   sc.TargetTime,
+		"resolution":    sc.Resolution,
+		"resolved_at":   sc.ResolvedAt,
+		"notes":         sc.Notes,
+	}).Error
+}
+
+// keptSyncRecords 本批记录中最近一次处理方式为 target_wins 的记录及当时的源数据
+func keptSyncRecords(db *gorm.DB, taskID uint, table string, recordIDs []string) map[string]map[string]interface{} {
+	if len(recordIDs) == 0 {
+		return nil
+	}
+	// 每条记录只取最近一次已解决的冲突
+	latest := db.Model(&models.SyncConflict{}).Select("MAX(id)").
+		Where("task_id = ? AND table_name = ? AND record_id IN ? AND resolved_at IS NOT NULL", taskID, table, recordIDs).
+		Group("record_id")
+	var conflicts []models.SyncConflict
+	if err := db.Select("id", "record_id", "source_data").
+		Where("id IN (?) AND resolution = ?", latest, models.SyncResolutionTargetWins).
+		Find(&conflicts).Error; err != nil {
+		log.Printf("Warning: failed to load resolved sync conflicts for task %d: %v", taskID, err)
+		return nil
+	}
+	kept := map[string]map[string]interface{}{}
+	for i := range conflicts {
+		if source, err := conflicts[i].GetSourceData(); err == nil {
+			kept[conflicts[i].RecordID] = source
+		}
+	}
+	return kept
+}
+
+// sameSyncRecord 比较映射后的记录与冲突中保存的源数据（二者都经过 JSON 编码）
+func sameSyncRecord(record, stored map[string]interface{}) bool {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return false
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil || len(decoded) != len(stored) {
+		return false
+	}
+	for k, v := range decoded {
+		other, ok := stored[k]
+		if !ok || !syncValuesEqual(v, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyResolution 按处理方式把源数据写入目标，返回处理说明；
+// winners 为 manual 时逐字段选择的一方（source / target），data 为直接写入目标的值
+func (e *SyncEngine) applyResolution(ctx context.Context, target syncEndpoint, sc *models.SyncConflict, resolution string, winners map[string]string, data map[string]interface{}) (string, error) {
+	switch resolution {
+	case models.SyncResolutionIgnore:
+		e.acceptProjectTarget(sc)
+		return "ignored", nil
+	case models.SyncResolutionTargetWins:
+		e.acceptProjectTarget(sc)
+		return "target kept", nil
+	}
+
+	source, err := sc.GetSourceData()
+	if err != nil {
+		return "", fmt.Errorf("invalid source data: %w", err)
+	}
+	current, err := e.currentTarget(ctx, target, sc)
+	if err != nil {
+		return "", err
+	}
+
+	switch resolution {
+	case models.SyncResolutionSourceWins:
+		winners = map[string]string{}
+	case models.SyncResolutionLastWriterWins:
+		winners = map[string]string{}
+		for _, f := range e.conflictFields(target, sc, source, current) {
+			if f.Differs {
+				winners[f.Field] = f.Winner
+			}
+		}
+	case models.SyncResolutionManual:
+		for field, side := range winners {
+			if _, ok := source[field]; !ok {
+				return "", fmt.Errorf("%w: field %s is not part of the source data", ErrSyncResolutionInvalid, field)
+			}
+			if side != "source" && side != "target" {
+				return "", fmt.Errorf("%w: field %s must be source or target", ErrSyncResolutionInvalid, field)
+			}
+		}
+		for field := range data {
+			if _, ok := source[field]; !ok {
+				return "", fmt.Errorf("%w: field %s is not part of the source data", ErrSyncResolutionInvalid, field)
+			}
+		}
+	default:
+		return "", fmt.Errorf("%w: %s", ErrSyncResolutionInvalid, resolution)
+	}
+
+	// manual 未选择的字段保留目标当前值（目标不支持读取且快照中没有该字段时取源数据）
+	record := make(map[string]interface{}, len(source))
+	for k, v := range source {
+		record[k] = v
+		if _, chosen := winners[k]; resolution == models.SyncResolutionManual && !chosen {
+			if cv, ok := current[k]; ok {
+				record[k] = cv
+			}
+		}
+	}
+	var sourceFields, targetFields []string
+	for field, side := range winners {
+		if side != "target" {
+			sourceFields = append(sourceFields, field)
+			continue
+		}
+		targetFields = append(targetFields, field)
+		if v, ok := current[field]; ok {
+			record[field] = v
+		} else {
+			delete(record, field)
+		}
+	}
+	var dataFields []string
+	for field, v := range data {
+		record[field] = v
+		dataFields = append(dataFields, field)
+	}
+
+	if err := target.apply(ctx, sc.TableName, sc.RecordID, record, false, nil); err != nil && !errors.Is(err, errSyncUnchanged) {
+		return "", err
+	}
+
+	if resolution == models.SyncResolutionSourceWins {
+		return "source data written", nil
+	}
+	sort.Strings(sourceFields)
+	sort.Strings(targetFields)
+	sort.Strings(dataFields)
+	var parts []string
+	if len(sourceFields) > 0 {
+		parts = append(parts, "source: "+strings.Join(sourceFields, ","))
+	}
+	if len(targetFields) > 0 {
+		parts = append(parts, "target: "+strings.Join(targetFields, ","))
+	}
+	if len(dataFields) > 0 {
+		parts = append(parts, "edited: "+strings.Join(dataFields, ","))
+	}
+	if len(parts) == 0 {
+		return "no field changes", nil
+	}
+	return strings.Join(parts, "; "), nil
+}
+
+// acceptProjectTarget 目标为项目且冲突为项目侧修改时，以冲突时的项目值作为新的快照，之后只有项目再次修改才视为冲突
+func (e *SyncEngine) acceptProjectTarget(sc *models.SyncConflict) {
+	if sc.ConflictType != models.SyncConflictDataInconsistency {
+		return
+	}
+	project := sc.Task.TargetProject
+	if project == "" {
+		var task models.SyncTask
+		if err := e.db.Select("target_project").First(&task, sc.TaskID).Error; err != nil {
+			return
+		}
+		project = task.TargetProject
+	}
+	if project == SyncCentralProject {
+		return
+	}
+	target, err := sc.GetTargetData()
+	if err != nil || len(target) == 0 {
+		return
+	}
+	if err := saveSyncTargetSnapshot(e.db, project, sc.TableName, sc.RecordID, nil, target); err != nil {
+		log.Printf("Warning: failed to save sync snapshot for conflict %d: %v", sc.ID, err)
+	}
+}
+
+// currentTarget 目标记录的当前值；目标不支持读取时使用冲突发生时的快照
+func (e *SyncEngine) currentTarget(ctx context.Context, target syncEndpoint, sc *models.SyncConflict) (map[string]interface{}, error) {
+	current, err := target.get(ctx, sc.TableName, sc.RecordID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return sc.GetTargetData()
+	}
+	return current, nil
+}
+
+// conflictFields 逐字段对照源数据与目标，并按 last_writer_wins 给出胜出方：
+// 源字段时间为源记录的 updated_at；目标为本地库时字段时间取 data_changes 中最近一次修改该字段的时间，否则为目标记录的 updated_at。
+// 时间相同或源时间未知时保留目标
+func (e *SyncEngine) conflictFields(target syncEndpoint, sc *models.SyncConflict, source, current map[string]interface{}) []models.SyncConflictField {
+	snapshot, _ := sc.GetTargetData()
+	var fieldTimes map[string]time.Time
+	if _, ok := target.(*centralSyncEndpoint); ok {
+		fieldTimes = syncFieldChangeTimes(e.db, sc.TableName, sc.RecordID)
+	}
+	rowTime := sc.TargetTime
+	if t := syncTime(current["updated_at"]); !t.IsZero() {
+		rowTime = &t
+	}
+
+	fields := make([]models.SyncConflictField, 0, len(source))
+	for field, v := range source {
+		f := models.SyncConflictField{
+			Field:      field,
+			Source:     v,
+			Target:     snapshot[field],
+			Current:    current[field],
+			Differs:    !syncValuesEqual(v, current[field]),
+			SourceTime: sc.SourceTime,
+			TargetTime: rowTime,
+			Winner:     "target",
+		}
+		if t, ok := fieldTimes[field]; ok {
+			t := t
+			f.TargetTime = &t
+		}
+		if f.SourceTime != nil && (f.TargetTime == nil || f.SourceTime.After(*f.TargetTime)) {
+			f.Winner = "source"
+		}
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return fields
+}
+
+// syncFieldChangeTimes 记录各字段最近一次被修改的时间（取最近 200 条变更）
+func syncFieldChangeTimes(db *gorm.DB, table, recordID string) map[string]time.Time {
+	var changes []models.DataChange
+	if err := db.Select("id", "new_data", "created_at").
+		Where("table_name = ? AND record_id = ? AND change_type IN ?", table, recordID, []string{models.ChangeInsert, models.ChangeUpdate}).
+		Order("id DESC").Limit(200).Find(&changes).Error; err != nil {
+		log.Printf("Warning: failed to load data changes for %s %s: %v", table, recordID, err)
+		return nil
+	}
+	times := map[string]time.Time{}
+	for i := range changes {
+		newData, err := changes[i].GetNewData()
+		if err != nil {
+			continue
+		}
+		for field := range newData {
+			if _, ok := times[field]; !ok {
+				times[field] = changes[i].CreatedAt
+			}
+		}
+	}
+	return times
+}
+
+// ConflictFields 冲突的逐字段对照（源、冲突时目标、当前目标）及 last_writer_wins 的胜出方
+func (e *SyncEngine) ConflictFields(ctx context.Context, sc *models.SyncConflict) ([]models.SyncConflictField, error) {
+	source, err := sc.GetSourceData()
+	if err != nil {
+		return nil, fmt.Errorf("invalid source data: %w", err)
+	}
+	target, err := e.endpoint(sc.Task.TargetProject)
+	if err != nil {
+		return nil, err
+	}
+	current, err := e.currentTarget(ctx, target, sc)
+	if err != nil {
+		return nil, err
+	}
+	return e.conflictFields(target, sc, source, current), nil
+}
+
+// ResolveConflict 处理一条未解决的冲突：按处理方式写入目标，记录处理方式、处理人与说明。
+// 目标写入带操作者，本地库的修改记入 data_changes
+func (e *SyncEngine) ResolveConflict(ctx context.Context, id uint, req models.ResolveSyncConflictRequest, actorID string) (*models.SyncConflict, error) {
+	var sc models.SyncConflict
+	if err := e.db.Preload("Task").First(&sc, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSyncConflictNotFound
+		}
+		return nil, err
+	}
+	if sc.ResolvedAt != nil {
+		return nil, ErrSyncConflictResolved
+	}
+	if req.Resolution == models.SyncResolutionLastWriterWins && sc.ConflictType != models.SyncConflictDataInconsistency {
+		return nil, fmt.Errorf("%w: last_writer_wins only applies to data_inconsistency conflicts", ErrSyncResolutionInvalid)
+	}
+	if req.Resolution != models.SyncResolutionManual && (len(req.Fields) > 0 || len(req.Data) > 0) {
+		return nil, fmt.Errorf("%w: fields and data are only allowed for manual resolution", ErrSyncResolutionInvalid)
+	}
+
+	// ignore 与 target_wins 不写入目标，任务或目标项目已不存在时也可关闭冲突
+	var target syncEndpoint
+	if req.Resolution != models.SyncResolutionIgnore && req.Resolution != models.SyncResolutionTargetWins {
+		var err error
+		if target, err = e.endpoint(sc.Task.TargetProject); err != nil {
+			return nil, err
+		}
+	}
+	// 写入目标前先认领冲突，并发处理同一冲突时只有一方写入目标
+	now := time.Now()
+	res := e.db.Model(&models.SyncConflict{}).Where("id = ? AND resolved_at IS NULL", sc.ID).Updates(map[string]interface{}{
+		"resolution":  req.Resolution,
+		"resolved_by": actorID,
+		"resolved_at": now,
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrSyncConflictResolved
+	}
+	summary, err := e.applyResolution(models.ContextWithActor(ctx, actorID), target, &sc, req.Resolution, req.Fields, req.Data)
+	if err != nil {
+		// 写入失败时释放认领，冲突保持未解决
+		if rerr := e.db.Model(&models.SyncConflict{}).Where("id = ?", sc.ID).Updates(map[string]interface{}{
+			"resolution":  "",
+			"resolved_by": "",
+			"resolved_at": nil,
+		}).Error; rerr != nil {
+			log.Printf("Warning: failed to release sync conflict %d: %v", sc.ID, rerr)
+		}
+		return nil, err
+	}
+
+	notes := joinSyncNotes(sc.Notes, summary, strings.TrimSpace(req.Notes))
+	if err := e.db.Model(&models.SyncConflict{}).Where("id = ?", sc.ID).Update("notes", notes).Error; err != nil {
+		log.Printf("Warning: failed to save notes for sync conflict %d: %v", sc.ID, err)
+	}
+	sc.Resolution = req.Resolution
+	sc.ResolvedBy = actorID
+	sc.ResolvedAt = &now
+	sc.Notes = notes
+	return &sc, nil
+}
+
+func joinSyncNotes(parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return truncate(strings.Join(out, "; "), 1000)
+}
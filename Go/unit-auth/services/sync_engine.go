@@ -0,0 +1,1021 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"unit-auth/config"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+// SyncCentralProject 同步任务中表示 unit-auth 本地库的项目名
+const SyncCentralProject = "unit-auth"
+
+var (
+	ErrSyncTaskNotFound = errors.New("sync task not found")
+	ErrSyncTaskRunning  = errors.New("sync task is already running")
+	ErrSyncTaskInactive = errors.New("sync task is paused")
+	ErrSyncEngineBusy   = errors.New("all sync workers are busy")
+)
+
+var (
+	syncRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_task_runs_total",
+		Help: "Total number of sync task runs by result (success, partial, failed)",
+	}, []string{"result"})
+	syncRecordsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sync_task_records_total",
+		Help: "Total number of synced records by result (success, failed, conflict, skipped)",
+	}, []string{"result"})
+)
+
+// errSyncUnchanged 目标记录已与源一致，无需写入
+var errSyncUnchanged = errors.New("unchanged")
+
+// syncConflictError 写入时检测到冲突，记录到 sync_conflicts 而非计为失败
+type syncConflictError struct {
+	conflictType string
+	target       map[string]interface{}
+	reason       string
+}
+
+func (e *syncConflictError) Error() string { return e.conflictType + ": " + e.reason }
+
+// syncCursor 增量同步游标：按 (updated_at, key) 升序推进
+type syncCursor struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	Key       string    `json:"key"`
+}
+
+// syncEndpoint 同步的一端：unit-auth 本地库或第三方项目
+type syncEndpoint interface {
+	// fetch 读取游标之后的记录（按 updated_at、主键升序）
+	fetch(ctx context.Context, table string, cursor syncCursor, limit int) ([]map[string]interface{}, error)
+	// keyField 表的主键字段
+	keyField(table string) string
+	// apply 写入一条记录；since 为上次成功同步的时间，目标记录在此之后被修改且与源不一致时返回冲突
+	apply(ctx context.Context, table, key string, record map[string]interface{}, deleted bool, since *time.Time) error
+	// get 读取记录的当前值，不支持读取时返回 nil
+	get(ctx context.Context, table, key string) (map[string]interface{}, error)
+	validate(table string, asSource bool) error
+}
+
+// syncTableSpec 本地库允许参与同步的表
+type syncTableSpec struct {
+	key      string
+	hidden   []string // 从不读出的列
+	writable []string // 允许同步写入的列，为空表示只读
+}
+
+// 写入本地用户只允许资料字段；创建用户、修改角色与状态须通过业务接口。
+// 有 deleted_at 的表读出已软删除的记录，目标侧按删除处理
+var centralSyncTables = map[string]syncTableSpec{
+	"users":            {key: "id", hidden: []string{"password"}, writable: []string{"username", "nickname", "meta"}},
+	"user_roles":       {key: "id"},
+	"roles":            {key: "id"},
+	"project_mappings": {key: "id"},
+}
+
+// SyncEngineConfig 同步引擎配置
+type SyncEngineConfig struct {
+	Workers      int
+	BatchSize    int
+	PollInterval time.Duration
+	RunTimeout   time.Duration
+}
+
+// SyncEngine 数据同步引擎：按任务的 cron Schedule 调度，全量或按检查点增量读取源表，
+// 经字段映射与转换规则写入目标，冲突记入 sync_conflicts，每次执行写一条 sync_logs
+type SyncEngine struct {
+	db  *gorm.DB
+	cfg SyncEngineConfig
+
+	slots   chan struct{}
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wake    chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+// NewSyncEngine 创建同步引擎
+func NewSyncEngine(db *gorm.DB, cfg SyncEngineConfig) *SyncEngine {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 200
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 30 * time.Second
+	}
+	if cfg.RunTimeout <= 0 {
+		cfg.RunTimeout = time.Hour
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SyncEngine{
+		db:      db,
+		cfg:     cfg,
+		slots:   make(chan struct{}, cfg.Workers),
+		running: map[uint]context.CancelFunc{},
+		ctx:     ctx,
+		cancel:  cancel,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+}
+
+// NewSyncEngineFromConfig 按 SYNC_* 配置创建同步引擎
+func NewSyncEngineFromConfig(db *gorm.DB) *SyncEngine {
+	return NewSyncEngine(db, SyncEngineConfig{
+		Workers:      config.AppConfig.SyncWorkers,
+		BatchSize:    config.AppConfig.SyncBatchSize,
+		PollInterval: time.Duration(config.AppConfig.SyncPollSeconds) * time.Second,
+		RunTimeout:   time.Duration(config.AppConfig.SyncRunTimeoutMinutes) * time.Minute,
+	})
+}
+
+// Start 订阅数据变更并启动调度协程
+func (e *SyncEngine) Start() {
+	OnDataChange("sync_engine", "", e.onDataChange)
+	log.Printf("🔄 启动数据同步引擎: workers=%d batch=%d poll=%s", e.cfg.Workers, e.cfg.BatchSize, e.cfg.PollInterval)
+	e.wg.Add(1)
+	go e.schedule()
+}
+
+// Stop 停止调度并中断进行中的任务（已处理的批次保留检查点）
+func (e *SyncEngine) Stop() {
+	e.once.Do(func() {
+		close(e.stop)
+		e.cancel()
+	})
+	e.wg.Wait()
+}
+
+func (e *SyncEngine) schedule() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		e.runDue()
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+	}
+}
+
+func (e *SyncEngine) notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// onDataChange 本地表有变更时，立即调度以该表为源的 realtime 任务（有 Schedule 的任务提前到现在执行）
+func (e *SyncEngine) onDataChange(ctx context.Context, db *gorm.DB, change *models.DataChange) error {
+	var taskIDs []uint
+	err := db.WithContext(ctx).Model(&models.SyncMapping{}).
+		Joins("JOIN sync_tasks ON sync_tasks.id = sync_mappings.task_id").
+		Where("sync_mappings.source_table = ? AND sync_mappings.is_active = ?", change.TableName, true).
+		Where("sync_tasks.source_project = ? AND sync_tasks.sync_type = ? AND sync_tasks.is_active = ?", SyncCentralProject, models.SyncModeRealtime, true).
+		Distinct().Pluck("sync_mappings.task_id", &taskIDs).Error
+	if err != nil || len(taskIDs) == 0 {
+		return err
+	}
+	now := time.Now()
+	if err := db.WithContext(ctx).Model(&models.SyncTask{}).
+		Where("id IN ? AND (next_sync_at IS NULL OR next_sync_at > ?)", taskIDs, now).
+		Update("next_sync_at", now).Error; err != nil {
+		return err
+	}
+	e.notify()
+	return nil
+}
+
+// runDue 执行到期的任务：next_sync_at 已到，或未设 Schedule 的 realtime 任务
+func (e *SyncEngine) runDue() {
+	now := time.Now()
+	var tasks []models.SyncTask
+	if err := e.db.Where("is_active = ? AND ((next_sync_at IS NOT NULL AND next_sync_at <= ?) OR (sync_type = ? AND (schedule = '' OR schedule IS NULL)))",
+		true, now, models.SyncModeRealtime).
+		Where("status <> ? OR locked_until < ?", models.SyncStatusRunning, now).
+		Order("next_sync_at ASC").Find(&tasks).Error; err != nil {
+		log.Printf("Warning: failed to query due sync tasks: %v", err)
+		return
+	}
+	for _, task := range tasks {
+		select {
+		case e.slots <- struct{}{}:
+		default:
+			return // 并发已满，下个周期再执行
+		}
+		if _, err := e.start(task.ID, "", "schedule"); err != nil {
+			<-e.slots
+			if !errors.Is(err, ErrSyncTaskRunning) {
+				log.Printf("Warning: failed to start sync task %d: %v", task.ID, err)
+			}
+		}
+	}
+}
+
+// Run 立即执行任务（管理员触发）；mode 为空时使用任务的 sync_type。任务在后台执行，返回本次执行的日志记录
+func (e *SyncEngine) Run(taskID uint, mode string) (*models.SyncLog, error) {
+	select {
+	case e.slots <- struct{}{}:
+	default:
+		return nil, ErrSyncEngineBusy
+	}
+	entry, err := e.start(taskID, mode, "manual")
+	if err != nil {
+		<-e.slots
+	}
+	return entry, err
+}
+
+// start 领取任务（条件更新为 running 并设置租约）并在后台执行；调用方已占用一个并发名额
+func (e *SyncEngine) start(taskID uint, mode, trigger string) (*models.SyncLog, error) {
+	var task models.SyncTask
+	if err := e.db.First(&task, taskID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSyncTaskNotFound
+		}
+		return nil, err
+	}
+	if trigger == "schedule" && !task.IsActive {
+		return nil, ErrSyncTaskInactive
+	}
+	if mode == "" {
+		mode = task.SyncType
+	}
+	if mode == models.SyncModeRealtime {
+		mode = models.SyncModeIncremental
+	}
+
+	now := time.Now()
+	lockedUntil := now.Add(e.cfg.RunTimeout)
+	res := e.db.Model(&models.SyncTask{}).
+		Where("id = ? AND (status <> ? OR locked_until IS NULL OR locked_until < ?)", task.ID, models.SyncStatusRunning, now).
+		Updates(map[string]interface{}{"status": models.SyncStatusRunning, "locked_until": lockedUntil})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrSyncTaskRunning
+	}
+
+	entry := models.SyncLog{TaskID: task.ID, Status: models.SyncLogRunning, StartTime: now}
+	_ = entry.SetDetails(map[string]interface{}{"mode": mode, "trigger": trigger})
+	if err := e.db.Create(&entry).Error; err != nil {
+		e.db.Model(&models.SyncTask{}).Where("id = ?", task.ID).Updates(map[string]interface{}{"status": models.SyncStatusFailed, "locked_until": nil})
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(e.ctx, e.cfg.RunTimeout)
+	e.mu.Lock()
+	e.running[task.ID] = cancel
+	e.mu.Unlock()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer func() { <-e.slots }()
+		defer func() {
+			cancel()
+			e.mu.Lock()
+			delete(e.running, task.ID)
+			e.mu.Unlock()
+		}()
+		e.execute(ctx, &task, &entry, mode, trigger)
+	}()
+	return &entry, nil
+}
+
+// Pause 停用任务（不再调度），并中断正在执行的本次同步
+func (e *SyncEngine) Pause(taskID uint) error {
+	res := e.db.Model(&models.SyncTask{}).Where("id = ?", taskID).Updates(map[string]interface{}{"is_active": false, "next_sync_at": nil})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrSyncTaskNotFound
+	}
+	e.mu.Lock()
+	if cancel, ok := e.running[taskID]; ok {
+		cancel()
+	}
+	e.mu.Unlock()
+	return nil
+}
+
+// Resume 重新启用任务并计算下次执行时间
+func (e *SyncEngine) Resume(taskID uint) (*models.SyncTask, error) {
+	var task models.SyncTask
+	if err := e.db.First(&task, taskID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSyncTaskNotFound
+		}
+		return nil, err
+	}
+	task.IsActive = true
+	task.NextSyncAt = NextSyncTime(task.Schedule, time.Now())
+	if err := e.db.Model(&task).Updates(map[string]interface{}{"is_active": true, "next_sync_at": task.NextSyncAt}).Error; err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// NextSyncTime 按 cron 表达式计算下次执行时间；未设置或无法解析时返回 nil（只能手动执行）
+func NextSyncTime(schedule string, from time.Time) *time.Time {
+	if strings.TrimSpace(schedule) == "" {
+		return nil
+	}
+	cron, err := utils.ParseCron(schedule)
+	if err != nil {
+		return nil
+	}
+	next := cron.Next(from)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// syncMappingStats 单个映射的执行统计（写入 sync_logs.details）
+type syncMappingStats struct {
+	MappingID   uint     `json:"mapping_id"`
+	SourceTable string   `json:"source_table"`
+	TargetTable string   `json:"target_table"`
+	Processed   int64    `json:"processed"`
+	Success     int64    `json:"success"`
+	Failed      int64    `json:"failed"`
+	Conflicts   int64    `json:"conflicts"` // 待处理的冲突
+	Resolved    int64    `json:"resolved"`  // 按任务冲突策略自动处理的冲突
+	Skipped     int64    `json:"skipped"`
+	Errors      []string `json:"errors,omitempty"` // 最多 20 条
+	Checkpoint  any      `json:"checkpoint,omitempty"`
+}
+
+func (e *SyncEngine) execute(ctx context.Context, task *models.SyncTask, entry *models.SyncLog, mode, trigger string) {
+	var stats []*syncMappingStats
+	runErr := e.runTask(ctx, task, mode, &stats)
+
+	var processed, success, failed, conflicts, resolved int64
+	for _, s := range stats {
+		processed += s.Processed
+		success += s.Success
+		failed += s.Failed
+		conflicts += s.Conflicts
+		resolved += s.Resolved
+	}
+	status := models.SyncLogSuccess
+	switch {
+	case runErr != nil:
+		status = models.SyncLogFailed
+	case failed > 0 || conflicts > 0:
+		status = models.SyncLogPartial
+	}
+	syncRunsTotal.WithLabelValues(status).Inc()
+
+	end := time.Now()
+	errMsg := ""
+	if runErr != nil {
+		errMsg = truncate(runErr.Error(), 1000)
+		log.Printf("Warning: sync task %d (%s) failed: %v", task.ID, task.Name, runErr)
+	}
+	_ = entry.SetDetails(map[string]interface{}{"mode": mode, "trigger": trigger, "mappings": stats, "conflicts": conflicts, "resolved": resolved})
+	if err := e.db.Model(entry).Updates(map[string]interface{}{
+		"status":            status,
+		"end_time":          end,
+		"records_processed": processed,
+		"records_success":   success,
+		"records_failed":    failed,
+		"error_msg":         errMsg,
+		"details":           entry.Details,
+	}).Error; err != nil {
+		log.Printf("Warning: failed to update sync log %d: %v", entry.ID, err)
+	}
+
+	taskStatus := models.SyncStatusCompleted
+	if runErr != nil {
+		taskStatus = models.SyncStatusFailed
+	}
+	updates := map[string]interface{}{"status": taskStatus, "locked_until": nil, "last_error": errMsg}
+	// 以结束时间作为冲突判断基准：本次写入目标产生的修改不应在下次同步时被视为冲突
+	if runErr == nil || success > 0 {
+		updates["last_sync_at"] = end
+	}
+	// 暂停的任务不再计算下次执行时间
+	var current models.SyncTask
+	if e.db.Select("is_active", "schedule").First(&current, task.ID).Error == nil && current.IsActive {
+		updates["next_sync_at"] = NextSyncTime(current.Schedule, end)
+	}
+	if err := e.db.Model(&models.SyncTask{}).Where("id = ?", task.ID).Updates(updates).Error; err != nil {
+		log.Printf("Warning: failed to update sync task %d: %v", task.ID, err)
+	}
+}
+
+func (e *SyncEngine) runTask(ctx context.Context, task *models.SyncTask, mode string, stats *[]*syncMappingStats) error {
+	source, err := e.endpoint(task.SourceProject)
+	if err != nil {
+		return err
+	}
+	target, err := e.endpoint(task.TargetProject)
+	if err != nil {
+		return err
+	}
+	var mappings []models.SyncMapping
+	if err := e.db.Where("task_id = ? AND is_active = ?", task.ID, true).Order("id ASC").Find(&mappings).Error; err != nil {
+		return err
+	}
+	if len(mappings) == 0 {
+		return errors.New("task has no active mappings")
+	}
+	batchSize := e.cfg.BatchSize
+	if cfg, err := task.GetConfig(); err == nil {
+		if n, ok := cfg["batch_size"].(float64); ok && n > 0 && n <= 5000 {
+			batchSize = int(n)
+		}
+	}
+
+	for i := range mappings {
+		s := &syncMappingStats{MappingID: mappings[i].ID, SourceTable: mappings[i].SourceTable, TargetTable: mappings[i].TargetTable}
+		*stats = append(*stats, s)
+		if err := e.runMapping(ctx, task, &mappings[i], source, target, mode, batchSize, s); err != nil {
+			return fmt.Errorf("%s -> %s: %w", mappings[i].SourceTable, mappings[i].TargetTable, err)
+		}
+	}
+	return nil
+}
+
+func (e *SyncEngine) runMapping(ctx context.Context, task *models.SyncTask, mapping *models.SyncMapping, source, target syncEndpoint, mode string, batchSize int, stats *syncMappingStats) error {
+	if err := source.validate(mapping.SourceTable, true); err != nil {
+		return err
+	}
+	if err := target.validate(mapping.TargetTable, false); err != nil {
+		return err
+	}
+	fieldMap, err := mapping.GetFieldMapping()
+	if err != nil {
+		return fmt.Errorf("invalid field_mapping: %w", err)
+	}
+	rules, err := mapping.GetTransformRule()
+	if err != nil {
+		return fmt.Errorf("invalid transform_rule: %w", err)
+	}
+
+	checkpoint := models.SyncCheckpoint{TaskID: task.ID, TableName: mapping.SourceTable + "->" + mapping.TargetTable}
+	e.db.Where("task_id = ? AND table_name = ?", checkpoint.TaskID, checkpoint.TableName).FirstOrInit(&checkpoint)
+	var cursor syncCursor
+	if mode == models.SyncModeIncremental && len(checkpoint.Checkpoint) > 0 {
+		if err := json.Unmarshal(checkpoint.Checkpoint, &cursor); err != nil {
+			return fmt.Errorf("invalid checkpoint: %w", err)
+		}
+	}
+	// 冲突判断的基准：上次成功同步的时间（全量同步同样检测目标侧的修改）
+	since := task.LastSyncAt
+
+	sourceKey := source.keyField(mapping.SourceTable)
+	targetKey := target.keyField(mapping.TargetTable)
+	// saved 为写入检查点的位置，出现失败的记录后不再前移
+	saved, blocked := cursor, false
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("interrupted: %w", err)
+		}
+		rows, err := source.fetch(ctx, mapping.SourceTable, cursor, batchSize)
+		if err != nil {
+			return err
+		}
+		records := make([]syncSourceRecord, 0, len(rows))
+		targetIDs := make([]string, 0, len(rows))
+		for _, row := range rows {
+			r := prepareSyncRecord(row, sourceKey, targetKey, fieldMap, rules)
+			records = append(records, r)
+			targetIDs = append(targetIDs, r.targetID)
+		}
+		kept := keptSyncRecords(e.db, task.ID, mapping.TargetTable, targetIDs)
+		for i := range records {
+			stats.Processed++
+			failed := stats.Failed
+			e.syncRecord(ctx, task, mapping, target, &records[i], since, kept, stats)
+			cursor = syncCursor{UpdatedAt: syncTime(records[i].row["updated_at"]), Key: records[i].key}
+			// 检查点停在第一条失败的记录之前，下次增量同步从该记录重试（之后已成功的记录再次同步时没有变化）
+			if stats.Failed > failed {
+				blocked = true
+			}
+			if !blocked {
+				saved = cursor
+			}
+		}
+		if len(rows) > 0 {
+			raw, _ := json.Marshal(saved)
+			checkpoint.Checkpoint = models.JSON(raw)
+			checkpoint.LastSyncID = saved.Key
+			if err := e.db.Save(&checkpoint).Error; err != nil {
+				return fmt.Errorf("save checkpoint: %w", err)
+			}
+			stats.Checkpoint = saved
+		}
+		if len(rows) < batchSize {
+			return nil
+		}
+	}
+}
+
+// syncSourceRecord 一条待同步的源记录：映射后的记录、目标主键，映射失败时 err 非空
+type syncSourceRecord struct {
+	row      map[string]interface{}
+	key      string
+	targetID string
+	record   map[string]interface{}
+	err      error
+}
+
+func prepareSyncRecord(row map[string]interface{}, sourceKey, targetKey string, fieldMap map[string]string, rules map[string]interface{}) syncSourceRecord {
+	r := syncSourceRecord{row: row, key: syncString(normalizeSyncValue(row[sourceKey]))}
+	r.targetID = r.key
+	r.record, r.err = applySyncMapping(row, fieldMap, rules)
+	if r.err == nil {
+		if v, ok := r.record[targetKey]; ok && !isEmptySyncValue(v) {
+			r.targetID = syncString(v)
+		}
+	}
+	return r
+}
+
+func (e *SyncEngine) syncRecord(ctx context.Context, task *models.SyncTask, mapping *models.SyncMapping, target syncEndpoint, r *syncSourceRecord, since *time.Time, kept map[string]map[string]interface{}, stats *syncMappingStats) {
+	fail := func(err error) {
+		stats.Failed++
+		syncRecordsTotal.WithLabelValues("failed").Inc()
+		if len(stats.Errors) < 20 {
+			stats.Errors = append(stats.Errors, fmt.Sprintf("%s: %v", r.key, err))
+		}
+	}
+
+	if r.err != nil {
+		fail(r.err)
+		return
+	}
+	row, record, targetID := r.row, r.record, r.targetID
+	deleted := row["deleted_at"] != nil
+	// 按 target_wins 处理过且源数据未再变化的记录不覆盖目标
+	if previous, ok := kept[targetID]; ok && !deleted && sameSyncRecord(record, previous) {
+		stats.Skipped++
+		syncRecordsTotal.WithLabelValues("skipped").Inc()
+		return
+	}
+
+	err := target.apply(ctx, mapping.TargetTable, targetID, record, deleted, since)
+	var conflict *syncConflictError
+	switch {
+	case err == nil:
+		stats.Success++
+		syncRecordsTotal.WithLabelValues("success").Inc()
+	case errors.Is(err, errSyncUnchanged):
+		stats.Skipped++
+		syncRecordsTotal.WithLabelValues("skipped").Inc()
+	case errors.As(err, &conflict):
+		e.handleConflict(ctx, task, target, newSyncConflict(task.ID, mapping.TargetTable, targetID, record, syncTime(row["updated_at"]), conflict), stats)
+	default:
+		fail(err)
+	}
+}
+
+// endpoint 按项目名返回同步端点：unit-auth 为本地库，其余为已启用的项目
+func (e *SyncEngine) endpoint(project string) (syncEndpoint, error) {
+	if project == SyncCentralProject {
+		return &centralSyncEndpoint{db: e.db}, nil
+	}
+	var p models.Project
+	if err := e.db.Where("`key` = ? AND enabled = ?", project, true).First(&p).Error; err != nil {
+		return nil, fmt.Errorf("project %s not found or disabled", project)
+	}
+	return &projectSyncEndpoint{db: e.db, project: p}, nil
+}
+
+// ValidateSyncEndpoints 校验任务的源与目标（创建任务、添加映射时调用）
+func ValidateSyncEndpoints(db *gorm.DB, task *models.SyncTask, mapping *models.SyncMapping) error {
+	e := &SyncEngine{db: db}
+	source, err := e.endpoint(task.SourceProject)
+	if err != nil {
+		return err
+	}
+	target, err := e.endpoint(task.TargetProject)
+	if err != nil {
+		return err
+	}
+	if mapping == nil {
+		return nil
+	}
+	if err := source.validate(mapping.SourceTable, true); err != nil {
+		return err
+	}
+	return target.validate(mapping.TargetTable, false)
+}
+
+// centralSyncEndpoint unit-auth 本地库
+type centralSyncEndpoint struct {
+	db *gorm.DB
+}
+
+func (c *centralSyncEndpoint) keyField(table string) string {
+	return centralSyncTables[table].key
+}
+
+func (c *centralSyncEndpoint) validate(table string, asSource bool) error {
+	spec, ok := centralSyncTables[table]
+	if !ok {
+		tables := make([]string, 0, len(centralSyncTables))
+		for t := range centralSyncTables {
+			tables = append(tables, t)
+		}
+		return fmt.Errorf("table %s is not available for sync (available: %s)", table, strings.Join(tables, ", "))
+	}
+	if !asSource && len(spec.writable) == 0 {
+		return fmt.Errorf("table %s is read-only for sync", table)
+	}
+	return nil
+}
+
+func (c *centralSyncEndpoint) get(ctx context.Context, table, key string) (map[string]interface{}, error) {
+	spec := centralSyncTables[table]
+	var row map[string]interface{}
+	if err := c.db.WithContext(ctx).Table(table).Where(spec.key+" = ?", key).Take(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("target record %s not found", key)
+		}
+		return nil, err
+	}
+	for _, column := range spec.hidden {
+		delete(row, column)
+	}
+	for k, v := range row {
+		row[k] = normalizeSyncValue(v)
+	}
+	return row, nil
+}
+
+func (c *centralSyncEndpoint) fetch(ctx context.Context, table string, cursor syncCursor, limit int) ([]map[string]interface{}, error) {
+	spec := centralSyncTables[table]
+	query := c.db.WithContext(ctx).Table(table)
+	if !cursor.UpdatedAt.IsZero() || cursor.Key != "" {
+		query = query.Where("updated_at > ? OR (updated_at = ? AND "+spec.key+" > ?)", cursor.UpdatedAt, cursor.UpdatedAt, cursor.Key)
+	}
+	var rows []map[string]interface{}
+	if err := query.Order("updated_at ASC, " + spec.key + " ASC").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for _, column := range spec.hidden {
+			delete(row, column)
+		}
+		for k, v := range row {
+			row[k] = normalizeSyncValue(v)
+		}
+	}
+	return rows, nil
+}
+
+// apply 本地库只更新已存在的记录（同步不创建本地用户）；用户资料变更发布事件并同步到已映射项目
+func (c *centralSyncEndpoint) apply(ctx context.Context, table, key string, record map[string]interface{}, deleted bool, since *time.Time) error {
+	spec := centralSyncTables[table]
+	if deleted {
+		return fmt.Errorf("deleting %s via sync is not supported", table)
+	}
+	updates := map[string]interface{}{}
+	for _, column := range spec.writable {
+		if v, ok := record[column]; ok {
+			updates[column] = v
+		}
+	}
+	if len(updates) == 0 {
+		return errSyncUnchanged
+	}
+
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current map[string]interface{}
+		if err := tx.Table(table).Where(spec.key+" = ?", key).Take(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("target record %s not found", key)
+			}
+			return err
+		}
+		changed := map[string]interface{}{}
+		for column, v := range updates {
+			if !syncValuesEqual(current[column], v) {
+				changed[column] = v
+			}
+		}
+		if len(changed) == 0 {
+			return errSyncUnchanged
+		}
+		if since != nil && syncTime(current["updated_at"]).After(*since) {
+			for _, column := range spec.hidden {
+				delete(current, column)
+			}
+			for k, v := range current {
+				current[k] = normalizeSyncValue(v)
+			}
+			return &syncConflictError{conflictType: models.SyncConflictDataInconsistency, target: current, reason: "target modified since last sync"}
+		}
+
+		if table != "users" {
+			return classifySyncWriteError(tx.Table(table).Where(spec.key+" = ?", key).Updates(changed).Error, current)
+		}
+		var user models.User
+		if err := tx.Where("id = ?", key).First(&user).Error; err != nil {
+			return err
+		}
+		before := user.ToResponse()
+		if err := classifySyncWriteError(tx.Model(&user).Updates(changed).Error, current); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", key).First(&user).Error; err != nil {
+			return err
+		}
+		PublishUserChanges(tx, before, &user, "")
+		if len(ChangedUserFields(before, user.ToResponse())) > 0 {
+			if _, err := EnqueueUserSync(tx, models.ProvisioningUpdate, user.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// classifySyncWriteError 唯一键与约束冲突转换为同步冲突
+func classifySyncWriteError(err error, target map[string]interface{}) error {
+	var mysqlErr *mysql.MySQLError
+	if err == nil || !errors.As(err, &mysqlErr) {
+		return err
+	}
+	switch mysqlErr.Number {
+	case 1062:
+		return &syncConflictError{conflictType: models.SyncConflictDuplicateKey, target: target, reason: mysqlErr.Message}
+	case 1048, 1216, 1217, 1451, 1452, 3819:
+		return &syncConflictError{conflictType: models.SyncConflictConstraintViolation, target: target, reason: mysqlErr.Message}
+	}
+	return err
+}
+
+// projectSyncEndpoint 第三方项目：通过项目用户接口写入 users，按项目映射决定创建或更新
+type projectSyncEndpoint struct {
+	db      *gorm.DB
+	project models.Project
+}
+
+func (p *projectSyncEndpoint) keyField(table string) string {
+	return "user_id"
+}
+
+func (p *projectSyncEndpoint) validate(table string, asSource bool) error {
+	if asSource {
+		return fmt.Errorf("project %s cannot be used as a sync source", p.project.Key)
+	}
+	if table != "users" {
+		return fmt.Errorf("project %s only supports the users table", p.project.Key)
+	}
+	return nil
+}
+
+func (p *projectSyncEndpoint) fetch(ctx context.Context, table string, cursor syncCursor, limit int) ([]map[string]interface{}, error) {
+	return nil, fmt.Errorf("project %s cannot be used as a sync source", p.project.Key)
+}
+
+// get 按映射读取项目用户；没有有效映射或项目侧已不存在时返回 nil
+func (p *projectSyncEndpoint) get(ctx context.Context, table, key string) (map[string]interface{}, error) {
+	var pm models.ProjectMapping
+	if err := p.db.Where("project_name = ? AND user_id = ? AND is_active = ?", p.project.Key, key, true).First(&pm).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	remote, err := NewProjectClient(p.project).GetUser(ctx, pm.LocalUserID)
+	if err != nil {
+		if isProjectNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return projectSyncRecord(key, remote), nil
+}
+
+// projectSyncFields 写入项目用户接口的字段
+var projectSyncFields = []string{"email", "phone", "username", "nickname", "avatar"}
+
+func projectSyncRecord(key string, remote *RemoteUser) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id":  key,
+		"email":    remote.Email,
+		"phone":    remote.Phone,
+		"username": remote.Username,
+		"nickname": remote.Nickname,
+		"avatar":   remote.Avatar,
+	}
+}
+
+// apply key 为 unit-auth 用户ID；记录字段对应项目用户接口的 user_id、email、phone、username、nickname、avatar。
+// 更新前读取项目用户：本次要修改的字段在项目中已不同于上次同步写入后的快照时，视为项目侧修改，记为冲突（since 为 nil 时直接覆盖）
+func (p *projectSyncEndpoint) apply(ctx context.Context, table, key string, record map[string]interface{}, deleted bool, since *time.Time) error {
+	outbound := OutboundUser{
+		UserID:   key,
+		Email:    syncString(record["email"]),
+		Phone:    syncString(record["phone"]),
+		Username: syncString(record["username"]),
+		Nickname: syncString(record["nickname"]),
+		Avatar:   syncString(record["avatar"]),
+	}
+	client := NewProjectClient(p.project)
+
+	var pm models.ProjectMapping
+	err := p.db.Where("project_name = ? AND user_id = ?", p.project.Key, key).First(&pm).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	mapped := err == nil && pm.IsActive
+
+	switch {
+	case deleted:
+		if !mapped {
+			return errSyncUnchanged
+		}
+		if err := client.DeleteUser(ctx, pm.LocalUserID); err != nil {
+			return p.classify(err, &pm)
+		}
+		p.db.Where("project_key = ? AND table_name = ? AND record_id = ?", p.project.Key, table, key).Delete(&models.SyncTargetSnapshot{})
+		return p.db.Model(&pm).Update("is_active", false).Error
+	case mapped:
+		remote, err := client.GetUser(ctx, pm.LocalUserID)
+		if err != nil {
+			return p.classify(err, &pm)
+		}
+		current := projectSyncRecord(key, remote)
+		var changed []string
+		for _, field := range projectSyncFields {
+			if v, ok := projectOutboundValue(outbound, field); ok && !syncValuesEqual(current[field], v) {
+				changed = append(changed, field)
+			}
+		}
+		snapshot := p.snapshot(table, key)
+		if len(changed) == 0 {
+			p.saveSnapshot(table, key, snapshot, current)
+			return errSyncUnchanged
+		}
+		if since != nil && snapshot != nil {
+			for _, field := range changed {
+				if !syncValuesEqual(current[field], snapshot[field]) {
+					// 项目接口没有修改时间，以发现修改的时间作为目标时间
+					current["local_user_id"] = pm.LocalUserID
+					current["updated_at"] = time.Now()
+					return &syncConflictError{conflictType: models.SyncConflictDataInconsistency, target: current, reason: "project user modified since last sync"}
+				}
+			}
+		}
+		if err := client.UpdateUser(ctx, pm.LocalUserID, outbound); err != nil {
+			return p.classify(err, &pm)
+		}
+		p.refreshSnapshot(ctx, client, table, key, pm.LocalUserID, snapshot)
+		return nil
+	}
+
+	// 幂等键按任务记录生成，同一记录重复同步时项目返回首次创建的用户
+	localUserID, err := client.CreateUser(WithIdempotencyKey(ctx, "sync_"+p.project.Key+"_"+key), outbound)
+	if err != nil {
+		return p.classify(err, nil)
+	}
+	if pm.ID != 0 {
+		if err := p.db.Model(&pm).Updates(map[string]interface{}{"local_user_id": localUserID, "is_active": true}).Error; err != nil {
+			return err
+		}
+	} else {
+		if err := p.db.Create(&models.ProjectMapping{UserID: key, ProjectName: p.project.Key, LocalUserID: localUserID}).Error; err != nil {
+			return classifySyncWriteError(err, map[string]interface{}{"local_user_id": localUserID})
+		}
+		runProjectMappedHooks(p.db, key, p.project.Key, localUserID)
+	}
+	p.refreshSnapshot(ctx, client, table, key, localUserID, p.snapshot(table, key))
+	return nil
+}
+
+// projectOutboundValue 本次写入的字段值；email、phone 为空时项目接口不修改该字段
+func projectOutboundValue(u OutboundUser, field string) (string, bool) {
+	switch field {
+	case "email":
+		return u.Email, u.Email != ""
+	case "phone":
+		return u.Phone, u.Phone != ""
+	case "username":
+		return u.Username, true
+	case "nickname":
+		return u.Nickname, true
+	case "avatar":
+		return u.Avatar, true
+	}
+	return "", false
+}
+
+// snapshot 上次同步写入后的项目用户字段，没有快照时返回 nil（不检测项目侧修改）
+func (p *projectSyncEndpoint) snapshot(table, key string) map[string]interface{} {
+	var row models.SyncTargetSnapshot
+	if err := p.db.Where("project_key = ? AND table_name = ? AND record_id = ?", p.project.Key, table, key).First(&row).Error; err != nil {
+		return nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(row.Data, &data); err != nil {
+		return nil
+	}
+	return data
+}
+
+// refreshSnapshot 写入后读取项目用户作为新的快照（项目可能规范化字段值），读取失败时保留原快照
+func (p *projectSyncEndpoint) refreshSnapshot(ctx context.Context, client *ProjectClient, table, key, localUserID string, previous map[string]interface{}) {
+	remote, err := client.GetUser(ctx, localUserID)
+	if err != nil {
+		log.Printf("Warning: failed to read back project %s user %s after sync: %v", p.project.Key, localUserID, err)
+		return
+	}
+	p.saveSnapshot(table, key, previous, projectSyncRecord(key, remote))
+}
+
+// saveSnapshot 保存项目用户字段快照，与原快照相同时不写入
+func (p *projectSyncEndpoint) saveSnapshot(table, key string, previous, current map[string]interface{}) {
+	if err := saveSyncTargetSnapshot(p.db, p.project.Key, table, key, previous, current); err != nil {
+		log.Printf("Warning: failed to save sync snapshot for project %s user %s: %v", p.project.Key, key, err)
+	}
+}
+
+// saveSyncTargetSnapshot 保存目标为项目时的字段快照（只保留同步写入的字段）
+func saveSyncTargetSnapshot(db *gorm.DB, projectKey, table, key string, previous, current map[string]interface{}) error {
+	data := make(map[string]interface{}, len(projectSyncFields))
+	same := previous != nil
+	for _, field := range projectSyncFields {
+		data[field] = current[field]
+		if same && !syncValuesEqual(previous[field], current[field]) {
+			same = false
+		}
+	}
+	if same {
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	row := models.SyncTargetSnapshot{ProjectKey: projectKey, TableName: table, RecordID: key}
+	if err := db.Where("project_key = ? AND table_name = ? AND record_id = ?", projectKey, table, key).FirstOrInit(&row).Error; err != nil {
+		return err
+	}
+	row.Data = models.JSON(raw)
+	return db.Save(&row).Error
+}
+
+// classify 项目返回 409 视为重复冲突
+func (p *projectSyncEndpoint) classify(err error, pm *models.ProjectMapping) error {
+	var perr *ProjectError
+	if errors.As(err, &perr) && perr.StatusCode == 409 {
+		target := map[string]interface{}{"code": perr.Code, "message": perr.Message}
+		if pm != nil {
+			target["local_user_id"] = pm.LocalUserID
+		}
+		return &syncConflictError{conflictType: models.SyncConflictDuplicateKey, target: target, reason: perr.Error()}
+	}
+	return err
+}
+
+func syncTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case *time.Time:
+		if t != nil {
+			return *t
+		}
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return parsed
+		}
+		if parsed, err := time.ParseInLocation("2006-01-02 15:04:05.999", t, time.Local); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
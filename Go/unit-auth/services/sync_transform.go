@@ -0,0 +1,226 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 同步转换规则（SyncMapping.TransformRule）：以目标字段为键，值为规则名、规则对象或二者组成的数组（依次执行）
+//
+//	{"email": "lowercase", "nickname": ["trim", {"type": "default", "value": "匿名"}],
+//	 "source": {"type": "constant", "value": "unit-auth"},
+//	 "display_name": {"type": "concat", "fields": ["nickname", "username"], "separator": " / "},
+//	 "status": {"type": "map", "values": {"active": 1, "inactive": 0}, "default": 0}}
+//
+// 规则：trim、lowercase、uppercase、to_string、omit_empty、default、constant、map、prefix、suffix、concat（源字段）、truncate、date_format
+var syncTransformTypes = map[string]bool{
+	"trim": true, "lowercase": true, "uppercase": true, "to_string": true, "omit_empty": true,
+	"default": true, "constant": true, "map": true, "prefix": true, "suffix": true,
+	"concat": true, "truncate": true, "date_format": true,
+}
+
+// syncOmit 转换结果为该值时目标记录不包含此字段
+type syncOmitValue struct{}
+
+var syncOmit = syncOmitValue{}
+
+// ValidateSyncTransformRules 校验转换规则格式
+func ValidateSyncTransformRules(rules map[string]interface{}) error {
+	for field, rule := range rules {
+		for _, step := range syncRuleSteps(rule) {
+			name, params, ok := syncRuleName(step)
+			if !ok || !syncTransformTypes[name] {
+				return fmt.Errorf("unknown transform rule for %s", field)
+			}
+			switch name {
+			case "map":
+				if _, ok := params["values"].(map[string]interface{}); !ok {
+					return fmt.Errorf("transform map for %s requires values", field)
+				}
+			case "concat":
+				if _, ok := params["fields"].([]interface{}); !ok {
+					return fmt.Errorf("transform concat for %s requires fields", field)
+				}
+			case "truncate":
+				if n, ok := params["length"].(float64); !ok || n <= 0 {
+					return fmt.Errorf("transform truncate for %s requires a positive length", field)
+				}
+			case "prefix", "suffix", "date_format":
+				if _, ok := params["value"].(string); !ok && name != "date_format" {
+					return fmt.Errorf("transform %s for %s requires a string value", name, field)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applySyncMapping 按字段映射（源字段 → 目标字段）与转换规则把源记录转换为目标记录
+func applySyncMapping(row map[string]interface{}, fieldMap map[string]string, rules map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(fieldMap)+len(rules))
+	for src, dst := range fieldMap {
+		out[dst] = normalizeSyncValue(row[src])
+	}
+	// 规则按字段名顺序执行，结果可复现
+	fields := make([]string, 0, len(rules))
+	for field := range rules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		value := out[field]
+		for _, step := range syncRuleSteps(rules[field]) {
+			var err error
+			if value, err = applySyncTransform(value, step, row); err != nil {
+				return nil, fmt.Errorf("transform %s: %w", field, err)
+			}
+		}
+		if value == syncOmit {
+			delete(out, field)
+		} else {
+			out[field] = value
+		}
+	}
+	return out, nil
+}
+
+func syncRuleSteps(rule interface{}) []interface{} {
+	if steps, ok := rule.([]interface{}); ok {
+		return steps
+	}
+	return []interface{}{rule}
+}
+
+func syncRuleName(step interface{}) (string, map[string]interface{}, bool) {
+	switch v := step.(type) {
+	case string:
+		return v, map[string]interface{}{}, true
+	case map[string]interface{}:
+		name, ok := v["type"].(string)
+		return name, v, ok
+	}
+	return "", nil, false
+}
+
+func applySyncTransform(value interface{}, step interface{}, row map[string]interface{}) (interface{}, error) {
+	name, params, ok := syncRuleName(step)
+	if !ok {
+		return nil, fmt.Errorf("invalid rule")
+	}
+	if value == syncOmit {
+		return value, nil
+	}
+	switch name {
+	case "trim":
+		if s, ok := value.(string); ok {
+			return strings.TrimSpace(s), nil
+		}
+	case "lowercase":
+		if s, ok := value.(string); ok {
+			return strings.ToLower(s), nil
+		}
+	case "uppercase":
+		if s, ok := value.(string); ok {
+			return strings.ToUpper(s), nil
+		}
+	case "to_string":
+		return syncString(value), nil
+	case "omit_empty":
+		if isEmptySyncValue(value) {
+			return syncOmit, nil
+		}
+	case "default":
+		if isEmptySyncValue(value) {
+			return params["value"], nil
+		}
+	case "constant":
+		return params["value"], nil
+	case "map":
+		values, _ := params["values"].(map[string]interface{})
+		if mapped, ok := values[syncString(value)]; ok {
+			return mapped, nil
+		}
+		if def, ok := params["default"]; ok {
+			return def, nil
+		}
+	case "prefix":
+		if !isEmptySyncValue(value) {
+			return fmt.Sprint(params["value"]) + syncString(value), nil
+		}
+	case "suffix":
+		if !isEmptySyncValue(value) {
+			return syncString(value) + fmt.Sprint(params["value"]), nil
+		}
+	case "concat":
+		fields, _ := params["fields"].([]interface{})
+		separator, _ := params["separator"].(string)
+		parts := make([]string, 0, len(fields))
+		for _, f := range fields {
+			if s := syncString(normalizeSyncValue(row[fmt.Sprint(f)])); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, separator), nil
+	case "truncate":
+		n, _ := params["length"].(float64)
+		if s, ok := value.(string); ok && len([]rune(s)) > int(n) {
+			return string([]rune(s)[:int(n)]), nil
+		}
+	case "date_format":
+		layout, _ := params["value"].(string)
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		if t, ok := value.(time.Time); ok {
+			return t.Format(layout), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule %s", name)
+	}
+	return value, nil
+}
+
+// normalizeSyncValue 数据库驱动返回的 []byte 等转换为可比较、可序列化的值
+func normalizeSyncValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case *time.Time:
+		if x == nil {
+			return nil
+		}
+		return *x
+	}
+	return v
+}
+
+func syncString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case time.Time:
+		return x.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		if x {
+			return "1"
+		}
+		return "0"
+	}
+	return fmt.Sprint(v)
+}
+
+func isEmptySyncValue(v interface{}) bool {
+	return v == nil || syncString(v) == ""
+}
+
+// syncValuesEqual 按字符串形式比较（数据库整数 / 布尔与 JSON 数字可能类型不同）
+func syncValuesEqual(a, b interface{}) bool {
+	return syncString(normalizeSyncValue(a)) == syncString(normalizeSyncValue(b))
+}
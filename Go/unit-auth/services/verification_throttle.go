@@ -0,0 +1,586 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unit-auth/config"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+// 验证码发送渠道
+const (
+	VerificationChannelSMS   = "sms"
+	VerificationChannelEmail = "email"
+)
+
+// 验证码发送被拒绝的原因
+const (
+	ThrottleReasonCooldown        = "cooldown"         // 同一接收方发送过于频繁
+	ThrottleReasonDailyCap        = "daily_cap"        // 同一接收方达到每日上限
+	ThrottleReasonCountryBudget   = "country_budget"   // 国家/地区每日预算用尽
+	ThrottleReasonPrefixBudget    = "prefix_budget"    // 号段每日预算用尽
+	ThrottleReasonSpendLimit      = "spend_limit"      // 全局短信费用熔断
+	ThrottleReasonCaptchaRequired = "captcha_required" // 需要完成人机验证
+	ThrottleReasonCaptchaInvalid  = "captcha_invalid"  // 人机验证未通过
+)
+
+// smsBudgetOtherCountries 未收录区号的号码合并计入的国家预算
+const smsBudgetOtherCountries = "*"
+
+var verificationThrottledTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "verification_throttled_total",
+	Help: "Total number of verification code sends rejected by channel and reason",
+}, []string{"channel", "reason"})
+
+var smsSpendToday = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "sms_spend_today",
+	Help: "Estimated SMS spend of the current day in cost units",
+})
+
+// ThrottleError 验证码发送被限制
+type ThrottleError struct {
+	Channel    string
+	Reason     string
+	RetryAfter time.Duration     // 建议的重试等待时间，0 表示不确定
+	Captcha    *CaptchaChallenge // 需要人机验证时返回给前端
+}
+
+func (e *ThrottleError) Error() string {
+	switch e.Reason {
+	case ThrottleReasonCooldown:
+		return fmt.Sprintf("please wait %d seconds before requesting another code", int(e.RetryAfter.Seconds()+0.5))
+	case ThrottleReasonDailyCap:
+		return "daily verification code limit reached for this recipient"
+	case ThrottleReasonCountryBudget, ThrottleReasonPrefixBudget:
+		return "verification codes to this destination are temporarily unavailable"
+	case ThrottleReasonSpendLimit:
+		return "sms service is temporarily unavailable"
+	case ThrottleReasonCaptchaRequired:
+		return "captcha verification required"
+	default:
+		return "captcha verification failed"
+	}
+}
+
+// CaptchaChallenge 前端需要完成的人机验证
+type CaptchaChallenge struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"site_key"`
+}
+
+// VerificationAttempt 一次验证码发送请求
+type VerificationAttempt struct {
+	Channel      string
+	Recipient    string // 手机号为 E.164 格式，邮箱不区分大小写
+	IP           string
+	CaptchaToken string
+}
+
+// VerificationThrottleConfig 验证码发送限制配置；各项为 0 时不做对应限制
+type VerificationThrottleConfig struct {
+	Cooldown        time.Duration
+	DailyCap        int
+	CaptchaAfter    int
+	CaptchaIPHourly int
+	CountryBudgets  map[string]int // 地区代码（CN）或区号（852），"*" 为其余国家（未收录区号的号码合并计入）；未配置不限，0 即禁止
+	PrefixBudgets   map[string]int // E.164 号段前缀，按最长前缀匹配；未配置不限，0 即禁止
+	Costs           map[string]int // 单条费用，键同 CountryBudgets，未配置时按 1 计
+	DailySpendLimit int
+}
+
+// VerificationThrottle 验证码发送限制：按接收方冷却与每日上限、按国家/号段的每日短信预算、
+// 全局短信费用熔断，超过阈值时要求 CAPTCHA。接收方计数保存在进程内，按自然日重置，启动时由当日短信投递记录恢复；
+// 配置了数据库时，国家/号段预算、费用与熔断以 sms_daily_counters 为准，多实例共享
+type VerificationThrottle struct {
+	cfg     VerificationThrottleConfig
+	captcha CaptchaVerifier
+	db      *gorm.DB
+
+	mu             sync.Mutex
+	day            string
+	lastSent       map[string]time.Time
+	recipientDaily map[string]int
+	ipHits         map[string][]time.Time
+	countryDaily   map[string]int
+	prefixDaily    map[string]int
+	sent           map[string]int // 渠道 -> 当日发送数
+	spend          int
+	breakerOpened  *time.Time
+	rejected       map[string]map[string]int // 渠道 -> 原因 -> 当日拒绝次数
+	captchaStats   map[string]int            // challenged / passed / failed
+}
+
+// NewVerificationThrottle 创建验证码发送限制器，captcha 为 nil 时不做人机验证
+func NewVerificationThrottle(cfg VerificationThrottleConfig, captcha CaptchaVerifier) *VerificationThrottle {
+	t := &VerificationThrottle{cfg: cfg, captcha: captcha}
+	t.resetLocked(throttleDay(time.Now()))
+	return t
+}
+
+// NewVerificationThrottleFromEnv 按配置创建限制器，并从当日短信投递记录恢复计数
+func NewVerificationThrottleFromEnv(db *gorm.DB) *VerificationThrottle {
+	cfg := config.AppConfig
+	t := NewVerificationThrottle(VerificationThrottleConfig{
+		Cooldown:        time.Duration(cfg.VerifyCooldownSeconds) * time.Second,
+		DailyCap:        cfg.VerifyDailyCap,
+		CaptchaAfter:    cfg.VerifyCaptchaAfter,
+		CaptchaIPHourly: cfg.VerifyCaptchaIPHourly,
+		CountryBudgets:  ParseSMSBudgets(cfg.SMSCountryBudgets),
+		PrefixBudgets:   ParseSMSBudgets(cfg.SMSPrefixBudgets),
+		Costs:           ParseSMSBudgets(cfg.SMSCosts),
+		DailySpendLimit: cfg.SMSDailySpendLimit,
+	}, NewCaptchaVerifierFromEnv())
+	if db != nil {
+		t.db = db
+		t.restore(db)
+	}
+	return t
+}
+
+// ParseSMSBudgets 解析 "CN:20000,852:500,*:200" 形式的配置，值无效的项被忽略
+func ParseSMSBudgets(spec string) map[string]int {
+	budgets := map[string]int{}
+	for key, value := range ParseSMSTemplates(spec) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			log.Printf("Warning: ignore invalid sms budget %s:%s", key, value)
+			continue
+		}
+		budgets[strings.ToUpper(key)] = n
+	}
+	return budgets
+}
+
+// restore 从当日短信投递记录恢复短信计数与每个号码最近一次发送时间（每个请求只计一次，失败的提交不计），
+// 重启后冷却期仍然有效
+func (t *VerificationThrottle) restore(db *gorm.DB) {
+	var rows []struct {
+		RequestID string
+		Phone     string
+		CreatedAt time.Time
+	}
+	if err := db.Model(&models.SMSDelivery{}).
+		Select("request_id, phone, MAX(created_at) AS created_at").
+		Where("created_at >= ? AND status <> ?", startOfDay(time.Now()), models.SMSDeliveryFailed).
+		Group("request_id, phone").
+		Scan(&rows).Error; err != nil {
+		log.Printf("Warning: failed to restore sms throttle counters: %v", err)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, row := range rows {
+		dest := t.smsDestination(row.Phone)
+		key := VerificationChannelSMS + ":" + row.Phone
+		if row.CreatedAt.After(t.lastSent[key]) {
+			t.lastSent[key] = row.CreatedAt
+		}
+		t.recipientDaily[key]++
+		t.sent[VerificationChannelSMS]++
+		t.countryDaily[dest.country]++
+		if dest.prefix != "" {
+			t.prefixDaily[dest.prefix]++
+		}
+		t.spend += dest.cost
+	}
+	smsSpendToday.Set(float64(t.spend))
+}
+
+// Acquire 检查并占用一次发送额度；发送失败时调用返回的 release 归还额度
+func (t *VerificationThrottle) Acquire(ctx context.Context, attempt VerificationAttempt) (func(), error) {
+	if attempt.Channel == VerificationChannelEmail {
+		attempt.Recipient = strings.ToLower(strings.TrimSpace(attempt.Recipient))
+	}
+
+	t.mu.Lock()
+	needCaptcha, err := t.checkLocked(attempt, time.Now())
+	t.mu.Unlock()
+	if err != nil {
+		return nil, t.reject(attempt.Channel, err)
+	}
+
+	// 人机验证在锁外调用服务商接口
+	if needCaptcha {
+		if err := t.verifyCaptcha(ctx, attempt); err != nil {
+			return nil, t.reject(attempt.Channel, err)
+		}
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	if _, err := t.checkLocked(attempt, now); err != nil {
+		t.mu.Unlock()
+		return nil, t.reject(attempt.Channel, err)
+	}
+	release := t.reserveLocked(attempt, now)
+	t.mu.Unlock()
+
+	if attempt.Channel == VerificationChannelSMS && t.db != nil {
+		day := throttleDay(now)
+		deltas, rejected := t.reserveShared(day, t.smsDestination(attempt.Recipient), now)
+		if rejected != nil {
+			release()
+			return nil, t.reject(attempt.Channel, rejected)
+		}
+		local := release
+		var once sync.Once
+		release = func() {
+			once.Do(func() {
+				local()
+				t.releaseShared(day, deltas)
+			})
+		}
+	}
+	return release, nil
+}
+
+// checkLocked 检查各项限制，返回是否需要人机验证
+func (t *VerificationThrottle) checkLocked(attempt VerificationAttempt, now time.Time) (bool, *ThrottleError) {
+	t.rollLocked(now)
+	key := attempt.Channel + ":" + attempt.Recipient
+
+	// 配置了数据库时费用与熔断由 reserveShared 在共享计数上检查
+	if attempt.Channel == VerificationChannelSMS && t.db == nil && t.breakerOpened != nil {
+		return false, &ThrottleError{Channel: attempt.Channel, Reason: ThrottleReasonSpendLimit, RetryAfter: untilTomorrow(now)}
+	}
+	if last, ok := t.lastSent[key]; ok && t.cfg.Cooldown > 0 {
+		if wait := t.cfg.Cooldown - now.Sub(last); wait > 0 {
+			return false, &ThrottleError{Channel: attempt.Channel, Reason: ThrottleReasonCooldown, RetryAfter: wait}
+		}
+	}
+	if t.cfg.DailyCap > 0 && t.recipientDaily[key] >= t.cfg.DailyCap {
+		return false, &ThrottleError{Channel: attempt.Channel, Reason: ThrottleReasonDailyCap, RetryAfter: untilTomorrow(now)}
+	}
+
+	if attempt.Channel == VerificationChannelSMS {
+		dest := t.smsDestination(attempt.Recipient)
+		if limit, ok := t.countryBudget(dest); ok && t.countryDaily[dest.country] >= limit {
+			return false, &ThrottleError{Channel: attempt.Channel, Reason: ThrottleReasonCountryBudget, RetryAfter: untilTomorrow(now)}
+		}
+		if dest.prefix != "" && t.prefixDaily[dest.prefix] >= t.cfg.PrefixBudgets[dest.prefix] {
+			return false, &ThrottleError{Channel: attempt.Channel, Reason: ThrottleReasonPrefixBudget, RetryAfter: untilTomorrow(now)}
+		}
+		if t.db == nil && t.cfg.DailySpendLimit > 0 && t.spend+dest.cost > t.cfg.DailySpendLimit {
+			opened := now
+			t.breakerOpened = &opened
+			log.Printf("Warning: sms spend limit reached (%d/%d), sms verification codes are suspended until tomorrow", t.spend, t.cfg.DailySpendLimit)
+			return false, &ThrottleError{Channel: attempt.Channel, Reason: ThrottleReasonSpendLimit, RetryAfter: untilTomorrow(now)}
+		}
+	}
+
+	if t.captcha == nil {
+		return false, nil
+	}
+	if t.cfg.CaptchaAfter > 0 && t.recipientDaily[key] >= t.cfg.CaptchaAfter {
+		return true, nil
+	}
+	if t.cfg.CaptchaIPHourly > 0 && attempt.IP != "" && len(t.recentIPHitsLocked(attempt.IP, now)) >= t.cfg.CaptchaIPHourly {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (t *VerificationThrottle) verifyCaptcha(ctx context.Context, attempt VerificationAttempt) *ThrottleError {
+	challenge := &CaptchaChallenge{Provider: t.captcha.Provider(), SiteKey: t.captcha.SiteKey()}
+	if attempt.CaptchaToken == "" {
+		t.countCaptcha("challenged")
+		return &ThrottleError{Channel: attempt.Channel, Reason: ThrottleReasonCaptchaRequired, Captcha: challenge}
+	}
+	if err := t.captcha.Verify(ctx, attempt.CaptchaToken, attempt.IP); err != nil {
+		if err != ErrCaptchaInvalid {
+			log.Printf("Warning: captcha verification error: %v", err)
+		}
+		t.countCaptcha("failed")
+		return &ThrottleError{Channel: attempt.Channel, Reason: ThrottleReasonCaptchaInvalid, Captcha: challenge}
+	}
+	t.countCaptcha("passed")
+	return nil
+}
+
+func (t *VerificationThrottle) countCaptcha(result string) {
+	t.mu.Lock()
+	t.captchaStats[result]++
+	t.mu.Unlock()
+}
+
+// reserveLocked 记录一次发送，返回归还函数
+func (t *VerificationThrottle) reserveLocked(attempt VerificationAttempt, now time.Time) func() {
+	key := attempt.Channel + ":" + attempt.Recipient
+	day := t.day
+	previous, hadPrevious := t.lastSent[key]
+
+	t.lastSent[key] = now
+	t.recipientDaily[key]++
+	t.sent[attempt.Channel]++
+	if attempt.IP != "" {
+		t.ipHits[attempt.IP] = append(t.recentIPHitsLocked(attempt.IP, now), now)
+	}
+	var dest smsDestination
+	if attempt.Channel == VerificationChannelSMS {
+		dest = t.smsDestination(attempt.Recipient)
+		t.countryDaily[dest.country]++
+		if dest.prefix != "" {
+			t.prefixDaily[dest.prefix]++
+		}
+		t.spend += dest.cost
+		smsSpendToday.Set(float64(t.spend))
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.day != day {
+				return
+			}
+			if hadPrevious {
+				t.lastSent[key] = previous
+			} else {
+				delete(t.lastSent, key)
+			}
+			t.recipientDaily[key]--
+			t.sent[attempt.Channel]--
+			if attempt.Channel == VerificationChannelSMS {
+				t.countryDaily[dest.country]--
+				if dest.prefix != "" {
+					t.prefixDaily[dest.prefix]--
+				}
+				t.spend -= dest.cost
+				smsSpendToday.Set(float64(t.spend))
+			}
+		})
+	}
+}
+
+func (t *VerificationThrottle) reject(channel string, err *ThrottleError) error {
+	verificationThrottledTotal.WithLabelValues(channel, err.Reason).Inc()
+	t.mu.Lock()
+	if t.rejected[channel] == nil {
+		t.rejected[channel] = map[string]int{}
+	}
+	t.rejected[channel][err.Reason]++
+	t.mu.Unlock()
+	return err
+}
+
+// recentIPHitsLocked 最近一小时内该 IP 的发送时间
+func (t *VerificationThrottle) recentIPHitsLocked(ip string, now time.Time) []time.Time {
+	hits := t.ipHits[ip]
+	i := 0
+	for i < len(hits) && now.Sub(hits[i]) >= time.Hour {
+		i++
+	}
+	if i == len(hits) {
+		delete(t.ipHits, ip)
+		return nil
+	}
+	hits = hits[i:]
+	t.ipHits[ip] = hits
+	return hits
+}
+
+// smsDestination 号码所属的预算分组与单条费用
+type smsDestination struct {
+	region  string // 地区代码，未收录区号时为空
+	code    string // 国际区号，未收录区号时为空
+	country string // 国家预算计数键
+	prefix  string // 命中的号段前缀
+	cost    int
+}
+
+func (t *VerificationThrottle) smsDestination(phone string) smsDestination {
+	dest := smsDestination{country: smsBudgetOtherCountries, cost: 1}
+	if p, err := utils.ParsePhone(phone, utils.DefaultPhoneRegion()); err == nil && p.CountryCode != "" {
+		dest.region, dest.code, dest.country = p.Region, p.CountryCode, p.Region
+		phone = p.E164()
+	}
+	for prefix := range t.cfg.PrefixBudgets {
+		if strings.HasPrefix(phone, prefix) && len(prefix) > len(dest.prefix) {
+			dest.prefix = prefix
+		}
+	}
+	if cost, ok := t.lookupCountry(t.cfg.Costs, dest); ok {
+		dest.cost = cost
+	}
+	return dest
+}
+
+func (t *VerificationThrottle) countryBudget(dest smsDestination) (int, bool) {
+	return t.lookupCountry(t.cfg.CountryBudgets, dest)
+}
+
+// lookupCountry 依次按地区代码、区号、"*" 查找配置
+func (t *VerificationThrottle) lookupCountry(values map[string]int, dest smsDestination) (int, bool) {
+	for _, key := range []string{dest.region, dest.code, smsBudgetOtherCountries} {
+		if key == "" {
+			continue
+		}
+		if v, ok := values[key]; ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// rollLocked 跨天时重置所有计数，费用熔断随之恢复
+func (t *VerificationThrottle) rollLocked(now time.Time) {
+	if day := throttleDay(now); day != t.day {
+		t.resetLocked(day)
+		smsSpendToday.Set(0)
+	}
+}
+
+func (t *VerificationThrottle) resetLocked(day string) {
+	t.day = day
+	t.lastSent = map[string]time.Time{}
+	t.recipientDaily = map[string]int{}
+	t.ipHits = map[string][]time.Time{}
+	t.countryDaily = map[string]int{}
+	t.prefixDaily = map[string]int{}
+	t.sent = map[string]int{}
+	t.spend = 0
+	t.breakerOpened = nil
+	t.rejected = map[string]map[string]int{}
+	t.captchaStats = map[string]int{}
+}
+
+// ResetSpendBreaker 手动恢复已熔断的短信发送（当日费用计数保留，再次超出时重新熔断）
+func (t *VerificationThrottle) ResetSpendBreaker() bool {
+	opened := false
+	if t.db != nil {
+		opened = t.resetSharedBreaker(throttleDay(time.Now()))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	opened = opened || t.breakerOpened != nil
+	t.breakerOpened = nil
+	return opened
+}
+
+// Stats 当日限制计数
+func (t *VerificationThrottle) Stats() map[string]interface{} {
+	now := time.Now()
+	var shared map[string]int64
+	if t.db != nil {
+		shared = t.sharedCounters(throttleDay(now))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollLocked(now)
+
+	countries := map[string]interface{}{}
+	countryItem := func(country string) map[string]interface{} {
+		if item, ok := countries[country].(map[string]interface{}); ok {
+			return item
+		}
+		item := map[string]interface{}{}
+		if limit, ok := t.cfg.CountryBudgets[country]; ok {
+			item["budget"] = limit
+		} else if limit, ok := t.cfg.CountryBudgets[smsBudgetOtherCountries]; ok {
+			item["budget"] = limit
+		}
+		countries[country] = item
+		return item
+	}
+	for country, sent := range t.countryDaily {
+		countryItem(country)["sent"] = sent
+	}
+	prefixes := map[string]interface{}{}
+	for prefix, limit := range t.cfg.PrefixBudgets {
+		prefixes[prefix] = map[string]interface{}{"sent": t.prefixDaily[prefix], "budget": limit}
+	}
+
+	// 配置了数据库时预算、费用与熔断以共享计数为准
+	spend, breakerOpened := t.spend, t.breakerOpened
+	if shared != nil {
+		spend = int(shared[smsCounterSpend])
+		breakerOpened = nil
+		if opened := shared[smsCounterBreaker]; opened > 0 {
+			at := time.Unix(opened, 0)
+			breakerOpened = &at
+		}
+		for key, value := range shared {
+			switch {
+			case strings.HasPrefix(key, smsCounterCountry):
+				countryItem(strings.TrimPrefix(key, smsCounterCountry))["sent"] = int(value)
+			case strings.HasPrefix(key, smsCounterPrefix):
+				if item, ok := prefixes[strings.TrimPrefix(key, smsCounterPrefix)].(map[string]interface{}); ok {
+					item["sent"] = int(value)
+				}
+			}
+		}
+	}
+
+	throttledRecipients := map[string]int{}
+	for key, count := range t.recipientDaily {
+		if t.cfg.DailyCap > 0 && count >= t.cfg.DailyCap {
+			throttledRecipients[key[:strings.Index(key, ":")]]++
+		}
+	}
+	activeIPs := 0
+	for ip := range t.ipHits {
+		if len(t.recentIPHitsLocked(ip, now)) > 0 {
+			activeIPs++
+		}
+	}
+
+	captcha := map[string]interface{}{"enabled": t.captcha != nil}
+	if t.captcha != nil {
+		captcha["provider"] = t.captcha.Provider()
+	}
+	for _, result := range []string{"challenged", "passed", "failed"} {
+		captcha[result] = t.captchaStats[result]
+	}
+
+	return map[string]interface{}{
+		"day": t.day,
+		"sms": map[string]interface{}{
+			"sent_today":         t.sent[VerificationChannelSMS],
+			"spend_today":        spend,
+			"spend_limit":        t.cfg.DailySpendLimit,
+			"breaker_open":       breakerOpened != nil,
+			"breaker_opened_at":  breakerOpened,
+			"countries":          countries,
+			"prefixes":           prefixes,
+			"capped_recipients":  throttledRecipients[VerificationChannelSMS],
+			"rejected_by_reason": t.rejected[VerificationChannelSMS],
+		},
+		"email": map[string]interface{}{
+			"sent_today":         t.sent[VerificationChannelEmail],
+			"capped_recipients":  throttledRecipients[VerificationChannelEmail],
+			"rejected_by_reason": t.rejected[VerificationChannelEmail],
+		},
+		"active_ips_last_hour": activeIPs,
+		"captcha":              captcha,
+		"limits": map[string]interface{}{
+			"cooldown_seconds":  int(t.cfg.Cooldown.Seconds()),
+			"daily_cap":         t.cfg.DailyCap,
+			"captcha_after":     t.cfg.CaptchaAfter,
+			"captcha_ip_hourly": t.cfg.CaptchaIPHourly,
+		},
+	}
+}
+
+func throttleDay(now time.Time) string {
+	return now.Format("2006-01-02")
+}
+
+func startOfDay(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+}
+
+func untilTomorrow(now time.Time) time.Duration {
+	return startOfDay(now).AddDate(0, 0, 1).Sub(now)
+}
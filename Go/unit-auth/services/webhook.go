@@ -0,0 +1,643 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unit-auth/config"
+	"unit-auth/models"
+	"unit-auth/utils"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWebhookSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound     = errors.New("webhook delivery not found")
+	ErrWebhookDeliveryInProgress   = errors.New("webhook delivery is still pending")
+)
+
+// 重放事件的单次上限
+const webhookReplayLimit = 1000
+
+// 轮换密钥后旧密钥继续参与签名的时间
+const webhookSecretOverlap = 24 * time.Hour
+
+var (
+	webhookEventsPublishedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_events_published_total",
+		Help: "Total number of user lifecycle events published by type",
+	}, []string{"type"})
+	webhookDeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_deliveries_total",
+		Help: "Total number of webhook delivery attempts by result (success, retry, dead)",
+	}, []string{"result"})
+	webhookDeliveryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "webhook_delivery_duration_seconds",
+		Help:    "Webhook delivery request duration in seconds",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// WebhookPayload 投递的请求体
+type WebhookPayload struct {
+	ID          string                 `json:"id"` // 事件ID，重试与重放时不变，接收方据此去重
+	Type        string                 `json:"type"`
+	CreatedAt   time.Time              `json:"created_at"`
+	Project     string                 `json:"project"`
+	LocalUserID string                 `json:"local_user_id,omitempty"` // 用户在该项目中的本地ID（项目映射）
+	Data        map[string]interface{} `json:"data"`
+}
+
+// WebhookDispatcherConfig 投递 worker 与重试配置
+type WebhookDispatcherConfig struct {
+	Workers      int
+	MaxAttempts  int           // 达到后转入死信
+	RetryBase    time.Duration // 第 n 次失败后等待 RetryBase*2^(n-1)（带抖动），不超过 RetryMax
+	RetryMax     time.Duration
+	PollInterval time.Duration
+	Lease        time.Duration
+	Timeout      time.Duration // 单次请求超时
+}
+
+// WebhookDispatcher 用户事件 Webhook：订阅事件总线，按项目映射为每个匹配的订阅写入投递记录，
+// 后台 worker 签名后 POST，非 2xx 按指数退避重试，超过次数进入死信；投递可由管理员重放
+type WebhookDispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+	cfg    WebhookDispatcherConfig
+
+	wake chan struct{}
+	jobs chan uint
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// NewWebhookDispatcher 创建 Webhook 投递器
+func NewWebhookDispatcher(db *gorm.DB, cfg WebhookDispatcherConfig) *WebhookDispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.RetryBase <= 0 {
+		cfg.RetryBase = 30 * time.Second
+	}
+	if cfg.RetryMax < cfg.RetryBase {
+		cfg.RetryMax = cfg.RetryBase
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = cfg.Timeout + time.Minute
+	}
+	return &WebhookDispatcher{
+		db:     db,
+		client: utils.NewUpstreamClient(utils.UpstreamClientOptions{Timeout: cfg.Timeout}),
+		cfg:    cfg,
+		wake:   make(chan struct{}, 1),
+		jobs:   make(chan uint, cfg.Workers),
+		stop:   make(chan struct{}),
+	}
+}
+
+// NewWebhookDispatcherFromConfig 按 WEBHOOK_* 配置创建投递器
+func NewWebhookDispatcherFromConfig(db *gorm.DB) *WebhookDispatcher {
+	return NewWebhookDispatcher(db, WebhookDispatcherConfig{
+		Workers:     config.AppConfig.WebhookWorkers,
+		MaxAttempts: config.AppConfig.WebhookMaxAttempts,
+		RetryBase:   time.Duration(config.AppConfig.WebhookRetryBaseSeconds) * time.Second,
+		RetryMax:    time.Duration(config.AppConfig.WebhookRetryMaxSeconds) * time.Second,
+		Timeout:     time.Duration(config.AppConfig.WebhookTimeoutSeconds) * time.Second,
+	})
+}
+
+// HandleEvent 事件总线处理函数：记录事件，并为用户已映射项目中订阅了该事件的订阅写入投递记录（与发布方同一事务）
+func (d *WebhookDispatcher) HandleEvent(db *gorm.DB, event UserEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	record := models.WebhookEvent{
+		EventID:   event.ID,
+		Type:      event.Type,
+		UserID:    event.UserID,
+		ActorID:   event.ActorID,
+		Data:      models.JSON(data),
+		CreatedAt: event.OccurredAt,
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return err
+	}
+	webhookEventsPublishedTotal.WithLabelValues(event.Type).Inc()
+
+	targets, err := d.targets(db, event.UserID, 0)
+	if err != nil {
+		return err
+	}
+	queued := 0
+	for _, t := range targets {
+		if !t.sub.Wants(event.Type) {
+			continue
+		}
+		if _, err := d.enqueue(db, t.sub, &record, t.localUserID); err != nil {
+			return err
+		}
+		queued++
+	}
+	if queued > 0 {
+		d.notify()
+	}
+	return nil
+}
+
+type webhookTarget struct {
+	sub         models.WebhookSubscription
+	localUserID string
+}
+
+// targets 用户已映射且启用的项目下的启用订阅（subscriptionID 非 0 时只取该订阅）
+func (d *WebhookDispatcher) targets(db *gorm.DB, userID string, subscriptionID uint) ([]webhookTarget, error) {
+	var mappings []models.ProjectMapping
+	if err := db.Where("user_id = ? AND is_active = ?", userID, true).Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+	if len(mappings) == 0 {
+		return nil, nil
+	}
+	localIDs := map[string]string{}
+	keys := make([]string, 0, len(mappings))
+	for _, m := range mappings {
+		localIDs[m.ProjectName] = m.LocalUserID
+		keys = append(keys, m.ProjectName)
+	}
+	var enabled []string
+	if err := db.Model(&models.Project{}).Where("`key` IN ? AND enabled = ?", keys, true).Pluck("key", &enabled).Error; err != nil {
+		return nil, err
+	}
+	if len(enabled) == 0 {
+		return nil, nil
+	}
+	query := db.Where("project_key IN ? AND enabled = ?", enabled, true)
+	if subscriptionID != 0 {
+		query = query.Where("id = ?", subscriptionID)
+	}
+	var subs []models.WebhookSubscription
+	if err := query.Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	targets := make([]webhookTarget, 0, len(subs))
+	for _, s := range subs {
+		targets = append(targets, webhookTarget{sub: s, localUserID: localIDs[s.ProjectKey]})
+	}
+	return targets, nil
+}
+
+// enqueue 为订阅写入一条待投递记录
+func (d *WebhookDispatcher) enqueue(db *gorm.DB, sub models.WebhookSubscription, event *models.WebhookEvent, localUserID string) (*models.WebhookDelivery, error) {
+	var data map[string]interface{}
+	if len(event.Data) > 0 {
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return nil, err
+		}
+	}
+	payload, err := json.Marshal(WebhookPayload{
+		ID:          event.EventID,
+		Type:        event.Type,
+		CreatedAt:   event.CreatedAt.UTC(),
+		Project:     sub.ProjectKey,
+		LocalUserID: localUserID,
+		Data:        data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery := models.WebhookDelivery{
+		DeliveryID:     uuid.NewString(),
+		SubscriptionID: sub.ID,
+		ProjectKey:     sub.ProjectKey,
+		EventID:        event.EventID,
+		EventType:      event.Type,
+		Payload:        string(payload),
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  time.Now(),
+	}
+	if err := db.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// deliverCreated 用户在项目下的映射由开通 worker 建立后，向该项目补发最近一次 user.created
+// （注册时映射尚未建立，发布事件时该项目不在接收范围内）
+func (d *WebhookDispatcher) deliverCreated(db *gorm.DB, userID, projectKey, localUserID string) {
+	var event models.WebhookEvent
+	if err := db.Where("user_id = ? AND type = ?", userID, EventUserCreated).Order("id DESC").First(&event).Error; err != nil {
+		return
+	}
+	var subs []models.WebhookSubscription
+	if err := db.Where("project_key = ? AND enabled = ?", projectKey, true).Find(&subs).Error; err != nil {
+		log.Printf("Warning: failed to load webhook subscriptions of project %s: %v", projectKey, err)
+		return
+	}
+	queued := 0
+	for _, sub := range subs {
+		if !sub.Wants(EventUserCreated) {
+			continue
+		}
+		if _, err := d.enqueue(db, sub, &event, localUserID); err != nil {
+			log.Printf("Warning: failed to queue user.created of user %s to project %s: %v", userID, projectKey, err)
+			continue
+		}
+		queued++
+	}
+	if queued > 0 {
+		d.notify()
+	}
+}
+
+func (d *WebhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start 订阅默认事件总线并启动调度协程与 worker
+func (d *WebhookDispatcher) Start() {
+	Events.Subscribe(d.HandleEvent)
+	OnProjectMapped(d.deliverCreated)
+	log.Printf("🪝 启动 Webhook 投递: workers=%d max_attempts=%d", d.cfg.Workers, d.cfg.MaxAttempts)
+	for i := 0; i < d.cfg.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+	d.wg.Add(1)
+	go d.dispatch()
+}
+
+// Stop 停止领取新投递，等待进行中的请求完成
+func (d *WebhookDispatcher) Stop() {
+	d.once.Do(func() { close(d.stop) })
+	d.wg.Wait()
+}
+
+func (d *WebhookDispatcher) dispatch() {
+	defer d.wg.Done()
+	defer close(d.jobs)
+
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for _, id := range d.claim() {
+			select {
+			case d.jobs <- id:
+			case <-d.stop:
+				return
+			}
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *WebhookDispatcher) worker() {
+	defer d.wg.Done()
+	for id := range d.jobs {
+		d.deliver(id)
+	}
+}
+
+// dueCondition 到期的待投递记录，以及租约已过期的投递中记录
+func (d *WebhookDispatcher) dueCondition(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)",
+		models.WebhookDeliveryPending, now, models.WebhookDeliverySending, now)
+}
+
+// claim 领取一批到期投递：逐条条件更新为 sending，更新成功才算领取到
+func (d *WebhookDispatcher) claim() []uint {
+	now := time.Now()
+	var ids []uint
+	if err := d.dueCondition(d.db.Model(&models.WebhookDelivery{}), now).
+		Order("next_attempt_at ASC").Limit(d.cfg.Workers*2).Pluck("id", &ids).Error; err != nil {
+		log.Printf("Warning: failed to poll webhook deliveries: %v", err)
+		return nil
+	}
+
+	lockedUntil := now.Add(d.cfg.Lease)
+	claimed := ids[:0]
+	for _, id := range ids {
+		res := d.dueCondition(d.db.Model(&models.WebhookDelivery{}).Where("id = ?", id), now).
+			Updates(map[string]interface{}{"status": models.WebhookDeliverySending, "locked_until": lockedUntil})
+		if res.Error != nil {
+			log.Printf("Warning: failed to claim webhook delivery %d: %v", id, res.Error)
+			continue
+		}
+		if res.RowsAffected == 1 {
+			claimed = append(claimed, id)
+		}
+	}
+	return claimed
+}
+
+func (d *WebhookDispatcher) deliver(id uint) {
+	var row models.WebhookDelivery
+	if err := d.db.First(&row, id).Error; err != nil {
+		log.Printf("Warning: failed to load webhook delivery %d: %v", id, err)
+		return
+	}
+
+	// 订阅被删除或停用时不再重试
+	var (
+		sub        models.WebhookSubscription
+		statusCode int
+		body       string
+		duration   time.Duration
+		err        error
+		permanent  bool
+	)
+	if lookupErr := d.db.First(&sub, row.SubscriptionID).Error; lookupErr != nil {
+		err, permanent = fmt.Errorf("subscription %d not found", row.SubscriptionID), true
+	} else if !sub.Enabled {
+		err, permanent = errors.New("subscription disabled"), true
+	} else {
+		statusCode, body, duration, err = d.post(&sub, &row)
+	}
+	updates := map[string]interface{}{"attempts": row.Attempts + 1, "locked_until": nil}
+	updates["response_status"] = statusCode
+	updates["response_body"] = truncate(body, 1000)
+	updates["duration_ms"] = duration.Milliseconds()
+
+	now := time.Now()
+	result := "success"
+	switch {
+	case err == nil:
+		updates["status"] = models.WebhookDeliverySucceeded
+		updates["delivered_at"] = now
+		updates["last_error"] = ""
+	case permanent || row.Attempts+1 >= d.cfg.MaxAttempts:
+		result = "dead"
+		updates["status"] = models.WebhookDeliveryDead
+		updates["last_error"] = truncate(err.Error(), 500)
+		log.Printf("Warning: webhook %s (%s) to project %s dead-lettered after %d attempts: %v", row.DeliveryID, row.EventType, row.ProjectKey, row.Attempts+1, err)
+	default:
+		result = "retry"
+		delay := utils.ExpBackoffJitter(d.cfg.RetryBase, d.cfg.RetryMax, row.Attempts+1)
+		updates["status"] = models.WebhookDeliveryPending
+		updates["next_attempt_at"] = now.Add(delay)
+		updates["last_error"] = truncate(err.Error(), 500)
+		log.Printf("Warning: webhook %s (%s) to project %s failed (attempt %d), retrying in %s: %v", row.DeliveryID, row.EventType, row.ProjectKey, row.Attempts+1, delay.Round(time.Second), err)
+	}
+	webhookDeliveriesTotal.WithLabelValues(result).Inc()
+
+	// 仅在仍持有租约时回写
+	if err := d.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ?", row.ID, models.WebhookDeliverySending, row.Attempts).
+		Updates(updates).Error; err != nil {
+		log.Printf("Warning: failed to update webhook delivery %d: %v", row.ID, err)
+	}
+}
+
+// post 签名并发送，返回状态码、响应体前 1000 字符与耗时；非 2xx 视为失败
+func (d *WebhookDispatcher) post(sub *models.WebhookSubscription, row *models.WebhookDelivery) (int, string, time.Duration, error) {
+	secrets, err := subscriptionSecrets(sub)
+	if err != nil {
+		return 0, "", 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signatures := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		signatures = append(signatures, "v1="+SignWebhookPayload(secret, timestamp, []byte(row.Payload)))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader([]byte(row.Payload)))
+	if err != nil {
+		return 0, "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "unit-auth-webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", row.EventID)
+	req.Header.Set("X-Webhook-Delivery", row.DeliveryID)
+	req.Header.Set("X-Webhook-Event", row.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", strings.Join(signatures, ","))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	duration := time.Since(start)
+	webhookDeliveryDuration.Observe(duration.Seconds())
+	if err != nil {
+		return 0, "", duration, err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1000))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(raw), duration, fmt.Errorf("endpoint returned HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(raw), duration, nil
+}
+
+// Replay 重放一次投递：以原事件与载荷新建一条投递记录（事件ID不变）
+func (d *WebhookDispatcher) Replay(deliveryID uint) (*models.WebhookDelivery, error) {
+	var original models.WebhookDelivery
+	if err := d.db.First(&original, deliveryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+	if original.Status == models.WebhookDeliveryPending || original.Status == models.WebhookDeliverySending {
+		return nil, ErrWebhookDeliveryInProgress
+	}
+	delivery := models.WebhookDelivery{
+		DeliveryID:     uuid.NewString(),
+		SubscriptionID: original.SubscriptionID,
+		ProjectKey:     original.ProjectKey,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  time.Now(),
+		ReplayOf:       &original.ID,
+	}
+	if err := d.db.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	d.notify()
+	return &delivery, nil
+}
+
+// WebhookReplayResult 重放结果；truncated 时以 next_after_id 作为 after_id 再次调用继续重放
+type WebhookReplayResult struct {
+	Queued      int  `json:"queued"`
+	Truncated   bool `json:"truncated"`
+	NextAfterID uint `json:"next_after_id,omitempty"`
+}
+
+// ReplayEvents 将时间范围内 ID 大于 afterID 的事件重新投递到指定订阅，单次最多 webhookReplayLimit 条。
+// 事件类型（订阅的事件与 eventTypes 的交集）与接收范围（订阅项目当前的有效映射）在 SQL 中过滤
+func (d *WebhookDispatcher) ReplayEvents(subscriptionID uint, since, until time.Time, eventTypes []string, afterID uint) (*WebhookReplayResult, error) {
+	var sub models.WebhookSubscription
+	if err := d.db.First(&sub, subscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookSubscriptionNotFound
+		}
+		return nil, err
+	}
+
+	types := eventTypes
+	if subscribed := sub.GetEvents(); len(subscribed) > 0 {
+		if len(types) == 0 {
+			types = subscribed
+		} else {
+			types = nil
+			for _, t := range eventTypes {
+				if sub.Wants(t) {
+					types = append(types, t)
+				}
+			}
+			if len(types) == 0 {
+				return &WebhookReplayResult{}, nil
+			}
+		}
+	}
+
+	query := d.db.Where("id > ? AND created_at >= ? AND created_at <= ?", afterID, since, until).
+		Where("user_id IN (?)", d.db.Model(&models.ProjectMapping{}).Select("user_id").
+			Where("project_name = ? AND is_active = ?", sub.ProjectKey, true))
+	if len(types) > 0 {
+		query = query.Where("type IN ?", types)
+	}
+	var events []models.WebhookEvent
+	if err := query.Order("id ASC").Limit(webhookReplayLimit + 1).Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	result := &WebhookReplayResult{}
+	if len(events) > webhookReplayLimit {
+		events = events[:webhookReplayLimit]
+		result.Truncated = true
+		result.NextAfterID = events[len(events)-1].ID
+	}
+	for i := range events {
+		targets, err := d.targets(d.db, events[i].UserID, sub.ID)
+		if err != nil {
+			return result, err
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		if _, err := d.enqueue(d.db, targets[0].sub, &events[i], targets[0].localUserID); err != nil {
+			return result, err
+		}
+		result.Queued++
+	}
+	if result.Queued > 0 {
+		d.notify()
+	}
+	return result, nil
+}
+
+// SendTest 向订阅投递一条 webhook.test 事件
+func (d *WebhookDispatcher) SendTest(subscriptionID uint) (*models.WebhookDelivery, error) {
+	var sub models.WebhookSubscription
+	if err := d.db.First(&sub, subscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookSubscriptionNotFound
+		}
+		return nil, err
+	}
+	event := models.WebhookEvent{
+		EventID:   "evt_" + uuid.NewString(),
+		Type:      EventWebhookTest,
+		Data:      models.JSON(`{"message":"webhook test"}`),
+		CreatedAt: time.Now(),
+	}
+	delivery, err := d.enqueue(d.db, sub, &event, "")
+	if err != nil {
+		return nil, err
+	}
+	d.notify()
+	return delivery, nil
+}
+
+// NewWebhookSecret 生成订阅签名密钥
+func NewWebhookSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// RotateWebhookSecret 为订阅生成新密钥，旧密钥在 24 小时内继续参与签名，返回新密钥（仅此一次可见）
+func RotateWebhookSecret(sub *models.WebhookSubscription) (string, error) {
+	secret, err := NewWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+	enc, err := utils.EncryptString(secret)
+	if err != nil {
+		return "", err
+	}
+	if sub.SecretEnc != "" {
+		expiresAt := time.Now().Add(webhookSecretOverlap)
+		sub.PreviousSecretEnc = sub.SecretEnc
+		sub.PreviousSecretExpiresAt = &expiresAt
+	}
+	sub.SecretEnc = enc
+	return secret, nil
+}
+
+// SignWebhookPayload 签名：hex(HMAC-SHA256(secret, timestamp + "." + body))
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscriptionSecrets 当前密钥与仍在过渡期内的旧密钥
+func subscriptionSecrets(sub *models.WebhookSubscription) ([]string, error) {
+	secret, err := utils.DecryptString(sub.SecretEnc)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt webhook secret: %w", err)
+	}
+	secrets := []string{secret}
+	if sub.PreviousSecretEnc != "" && sub.PreviousSecretExpiresAt != nil && time.Now().Before(*sub.PreviousSecretExpiresAt) {
+		if previous, err := utils.DecryptString(sub.PreviousSecretEnc); err == nil {
+			secrets = append(secrets, previous)
+		}
+	}
+	return secrets, nil
+}
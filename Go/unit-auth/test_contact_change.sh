@@ -0,0 +1,51 @@
+#!/bin/bash
+
+# 修改邮箱 / 手机号测试
+# 用法: TOKEN=... PASSWORD=... ./test_contact_change.sh new@example.com
+# 建议以 file 传输启动 unit-auth: MAIL_TRANSPORT=file MAIL_FILE_DIR=./tmp/mail，验证码与撤销链接在邮件中查看
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+NEW_EMAIL="${1:-new@example.com}"
+
+if [ -z "$TOKEN" ]; then
+    echo "❌ 请设置 TOKEN（用户登录令牌）"
+    exit 1
+fi
+
+echo "🧪 开始测试修改邮箱..."
+
+echo "📧 申请修改邮箱（验证码发送到 $NEW_EMAIL）..."
+curl -s -X POST $BASE_URL/api/v1/user/change-email \
+  -H "Authorization: Bearer $TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"password\": \"$PASSWORD\", \"new_email\": \"$NEW_EMAIL\"}"
+
+echo -e "\n\n❌ 错误密码（应返回 400）..."
+curl -s -X POST $BASE_URL/api/v1/user/change-email \
+  -H "Authorization: Bearer $TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"password\": \"wrong-password\", \"new_email\": \"$NEW_EMAIL\"}"
+
+echo -e "\n"
+read -p "请输入新邮箱收到的验证码: " CODE
+
+echo "✅ 确认修改..."
+curl -s -X POST $BASE_URL/api/v1/user/change-email/confirm \
+  -H "Authorization: Bearer $TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"code\": \"$CODE\"}"
+
+echo -e "\n"
+read -p "请输入旧邮箱通知中的撤销令牌（留空跳过）: " REVERT_TOKEN
+if [ -n "$REVERT_TOKEN" ]; then
+    echo "↩️  撤销修改..."
+    curl -s -X POST "$BASE_URL/api/v1/user/contact-change/revert?token=$REVERT_TOKEN" -H "Accept: application/json"
+
+    echo -e "\n\n🔁 再次撤销（应返回 400）..."
+    curl -s -X POST "$BASE_URL/api/v1/user/contact-change/revert?token=$REVERT_TOKEN" -H "Accept: application/json"
+fi
+
+echo -e "\n\n👤 当前用户信息..."
+curl -s $BASE_URL/api/v1/user/profile -H "Authorization: Bearer $TOKEN"
+
+echo -e "\n\n✅ 测试完成"
@@ -0,0 +1,37 @@
+#!/bin/bash
+
+# 数据变更捕获测试
+# 需要管理员令牌与一个普通用户ID:
+# ADMIN_TOKEN=... ./test_data_changes.sh <user_id>
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+USER_ID="$1"
+
+if [ -z "$ADMIN_TOKEN" ] || [ -z "$USER_ID" ]; then
+    echo "用法: ADMIN_TOKEN=... $0 <user_id>"
+    exit 1
+fi
+
+echo "🧪 开始测试数据变更捕获..."
+
+echo "✏️ 管理员修改用户昵称（产生一条 update 变更，操作者为管理员）..."
+curl -s -X PUT $BASE_URL/api/v1/admin/users/$USER_ID \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"nickname\": \"cdc-$(date +%s)\"}"
+
+sleep 1
+
+echo -e "\n\n📜 该用户的变更记录（按时间正序）..."
+curl -s "$BASE_URL/api/v1/admin/data-changes?table_name=users&record_id=$USER_ID&order=asc" \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n❌ 处理失败的变更..."
+curl -s "$BASE_URL/api/v1/admin/data-changes?sync_status=failed" \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n🔁 重试不存在的变更（404）..."
+curl -s -X POST $BASE_URL/api/v1/admin/data-changes/999999999/retry \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n✅ 数据变更捕获测试完成"
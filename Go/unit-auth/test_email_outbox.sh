@@ -0,0 +1,38 @@
+#!/bin/bash
+
+# 邮件发件箱测试
+# 建议以 file 传输启动 unit-auth: MAIL_TRANSPORT=file MAIL_FILE_DIR=./tmp/mail
+# 查看队列需要管理员令牌: ADMIN_TOKEN=... ./test_email_outbox.sh
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+EMAIL="${1:-test@example.com}"
+MAIL_DIR="${MAIL_FILE_DIR:-./tmp/mail}"
+
+echo "🧪 开始测试邮件发件箱..."
+
+echo "📧 发送验证码（应立即返回）..."
+time curl -s -X POST $BASE_URL/api/v1/auth/send-email-code \
+  -H "Content-Type: application/json" \
+  -d "{\"email\": \"$EMAIL\", \"type\": \"register\"}"
+
+echo -e "\n\n⏳ 等待 worker 投递..."
+sleep 3
+
+if [ -d "$MAIL_DIR/new" ]; then
+    echo "📂 maildir 中最新的邮件:"
+    latest=$(ls -t "$MAIL_DIR/new" | head -1)
+    [ -n "$latest" ] && head -20 "$MAIL_DIR/new/$latest"
+fi
+
+if [ -n "$ADMIN_TOKEN" ]; then
+    echo -e "\n\n📊 队列统计..."
+    curl -s $BASE_URL/api/v1/admin/email-outbox/stats -H "Authorization: Bearer $ADMIN_TOKEN"
+
+    echo -e "\n\n📮 最近的消息..."
+    curl -s "$BASE_URL/api/v1/admin/email-outbox?to=$EMAIL&page_size=5" -H "Authorization: Bearer $ADMIN_TOKEN"
+
+    echo -e "\n\n💀 死信..."
+    curl -s "$BASE_URL/api/v1/admin/email-outbox?status=dead" -H "Authorization: Bearer $ADMIN_TOKEN"
+fi
+
+echo -e "\n\n✅ 测试完成"
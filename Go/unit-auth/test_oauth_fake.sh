@@ -0,0 +1,58 @@
+#!/bin/bash
+
+# 第三方登录完整流程测试（基于本地 fake OAuth 服务）
+# 先启动: go run ./cmd/fake-oauth -addr :9999
+# 再按 docs/FAKE_OAUTH.md 配置端点覆盖后启动 unit-auth
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+PROVIDER="${1:-google}"
+COOKIE_JAR=$(mktemp)
+trap 'rm -f "$COOKIE_JAR"' EXIT
+
+echo "🧪 开始测试 $PROVIDER 第三方登录完整流程..."
+
+echo "📡 检查服务状态..."
+curl -s $BASE_URL/health | jq .
+
+echo -e "\n\n🔗 获取授权地址..."
+URL_RESPONSE=$(curl -s -c "$COOKIE_JAR" "$BASE_URL/api/v1/auth/oauth/$PROVIDER/url")
+echo $URL_RESPONSE | jq .
+
+AUTH_URL=$(echo $URL_RESPONSE | jq -r '.data.auth_url')
+if [ "$AUTH_URL" == "null" ] || [ "$AUTH_URL" == "" ]; then
+    echo "❌ 获取授权地址失败"
+    exit 1
+fi
+
+echo -e "\n\n✅ 访问 fake 授权页（自动同意）..."
+LOCATION=$(curl -s -o /dev/null -w '%{redirect_url}' "$AUTH_URL")
+echo "回调地址: $LOCATION"
+
+CODE=$(echo "$LOCATION" | sed -n 's/.*[?&]code=\([^&#]*\).*/\1/p')
+STATE=$(echo "$LOCATION" | sed -n 's/.*[?&]state=\([^&#]*\).*/\1/p')
+if [ "$CODE" == "" ] || [ "$STATE" == "" ]; then
+    echo "❌ 回调中缺少 code 或 state"
+    exit 1
+fi
+
+echo -e "\n\n🔐 使用授权码登录..."
+LOGIN_RESPONSE=$(curl -s -b "$COOKIE_JAR" -X POST $BASE_URL/api/v1/auth/oauth-login \
+  -H "Content-Type: application/json" \
+  -d "{\"provider\": \"$PROVIDER\", \"code\": \"$CODE\", \"state\": \"$STATE\"}")
+echo $LOGIN_RESPONSE | jq .
+
+TOKEN=$(echo $LOGIN_RESPONSE | jq -r '.data.token')
+if [ "$TOKEN" == "null" ] || [ "$TOKEN" == "" ]; then
+    echo "❌ 登录失败"
+    exit 1
+fi
+
+echo -e "\n\n👤 获取当前用户信息..."
+curl -s $BASE_URL/api/v1/user/profile -H "Authorization: Bearer $TOKEN" | jq .
+
+echo -e "\n\n🔁 重放同一 state（应被拒绝）..."
+curl -s -b "$COOKIE_JAR" -X POST $BASE_URL/api/v1/auth/oauth-login \
+  -H "Content-Type: application/json" \
+  -d "{\"provider\": \"$PROVIDER\", \"code\": \"$CODE\", \"state\": \"$STATE\"}" | jq .
+
+echo -e "\n\n✅ $PROVIDER 第三方登录流程测试完成"
@@ -0,0 +1,65 @@
+#!/bin/bash
+
+# 项目映射核对测试
+# 需要管理员令牌；PROJECT_KEY 为已启用、实现了用户列表 / 读取接口的项目:
+# ADMIN_TOKEN=... ./test_project_reconciliation.sh crm
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+PROJECT_KEY="${1:-demo}"
+API_URL="$BASE_URL/api/v1/admin/projects/$PROJECT_KEY/reconciliations"
+
+if [ -z "$ADMIN_TOKEN" ]; then
+    echo "请设置 ADMIN_TOKEN"
+    exit 1
+fi
+
+echo "🧪 开始测试项目映射核对..."
+
+echo "🔍 启动试运行..."
+RUN_RESP=$(curl -s -X POST $API_URL \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"dry_run": true, "backfill": true, "batch_size": 50, "rate_per_second": 5}')
+echo "$RUN_RESP"
+RUN_ID=$(echo "$RUN_RESP" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+
+if [ -z "$RUN_ID" ]; then
+    echo "启动核对失败"
+    exit 1
+fi
+
+echo -e "\n\n❌ 重复启动（409）..."
+curl -s -X POST $API_URL -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n⏸️ 暂停并查看游标..."
+curl -s -X POST $API_URL/$RUN_ID/pause -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n▶️ 恢复..."
+curl -s -X POST $API_URL/$RUN_ID/resume -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n⏳ 等待完成..."
+for i in $(seq 1 30); do
+    STATUS=$(curl -s $API_URL/$RUN_ID -H "Authorization: Bearer $ADMIN_TOKEN" | grep -o '"status":"[^"]*"' | head -1 | cut -d'"' -f4)
+    echo "status: $STATUS"
+    if [ "$STATUS" != "pending" ] && [ "$STATUS" != "running" ]; then
+        break
+    fi
+    sleep 2
+done
+
+echo -e "\n📊 进度与汇总..."
+curl -s $API_URL/$RUN_ID -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n📋 试运行报告（没有映射的用户）..."
+curl -s "$API_URL/$RUN_ID/report?kind=missing&page_size=10" -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n📋 项目侧已不存在的映射..."
+curl -s "$API_URL/$RUN_ID/report?kind=local_orphan&page_size=10" -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n❌ 已完成的任务不能暂停（409）..."
+curl -s -X POST $API_URL/$RUN_ID/pause -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n📋 核对列表..."
+curl -s "$API_URL?page_size=5" -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n✅ 项目映射核对测试完成"
@@ -0,0 +1,60 @@
+#!/bin/bash
+
+# 项目管理与对接测试
+# 需要管理员令牌；PROJECT_BASE_URL 为实现了 /api/v1/users 接口的项目地址:
+# ADMIN_TOKEN=... PROJECT_BASE_URL=http://localhost:9001 ./test_projects.sh demo_app
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+PROJECT_KEY="${1:-demo_app}"
+PROJECT_BASE_URL="${PROJECT_BASE_URL:-http://localhost:9001}"
+
+if [ -z "$ADMIN_TOKEN" ]; then
+    echo "请设置 ADMIN_TOKEN"
+    exit 1
+fi
+
+echo "🧪 开始测试项目管理..."
+
+echo "🆕 创建项目（未提供凭据时自动生成，仅返回一次）..."
+curl -s -w "\nHTTP %{http_code}\n" -X POST $BASE_URL/api/v1/admin/projects \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"key\": \"$PROJECT_KEY\", \"name\": \"Demo App\", \"base_url\": \"$PROJECT_BASE_URL\", \"auth_mode\": \"hmac\", \"timeout_ms\": 3000, \"retry_policy\": {\"max_retries\": 2}, \"allowed_redirect_uris\": \"http://localhost:3000/callback\", \"allowed_origins\": \"http://localhost:3000\", \"default_phone_region\": \"CN\", \"enabled\": false}"
+
+echo -e "\n✏️ 更新项目..."
+curl -s -X PUT $BASE_URL/api/v1/admin/projects/$PROJECT_KEY \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"allowed_redirect_uris": "http://localhost:3000/callback\nhttp://localhost:3000/app/*"}'
+
+echo -e "\n\n🔌 连通性测试（试运行用户依次创建、更新、删除）..."
+curl -s -X POST $BASE_URL/api/v1/admin/projects/$PROJECT_KEY/test \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n📄 对接文档（管理员，含未启用项目）..."
+curl -s $BASE_URL/api/v1/admin/projects/$PROJECT_KEY/integration-docs \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n✅ 启用项目..."
+curl -s -X PUT $BASE_URL/api/v1/admin/projects/$PROJECT_KEY \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"enabled": true}'
+
+echo -e "\n\n📄 公开对接文档..."
+curl -s "$BASE_URL/api/v1/projects/integration-docs" -H "X-Genres-Type: $PROJECT_KEY"
+
+echo -e "\n\n🌐 CORS 预检（允许的来源）..."
+curl -s -o /dev/null -D - -X OPTIONS $BASE_URL/api/v1/projects/public \
+  -H "Origin: http://localhost:3000" \
+  -H "Access-Control-Request-Method: GET" | grep -i "access-control-allow-origin"
+
+echo -e "\n🔑 轮换凭据..."
+curl -s -X POST $BASE_URL/api/v1/admin/projects/$PROJECT_KEY/rotate-credentials \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n📋 项目列表..."
+curl -s "$BASE_URL/api/v1/admin/projects?search=$PROJECT_KEY" \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n✅ 项目管理测试完成"
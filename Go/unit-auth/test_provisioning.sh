@@ -0,0 +1,41 @@
+#!/bin/bash
+
+# 项目开通发件箱测试
+# 需要一个已启用的项目（其 base_url 实现 /api/v1/users 接口）与管理员令牌:
+# ADMIN_TOKEN=... PROJECT_KEY=<project_key> ./test_provisioning.sh test@example.com 123456
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+EMAIL="${1:-test@example.com}"
+CODE="$2"
+
+if [ -z "$PROJECT_KEY" ]; then
+    echo "❌ 请设置 PROJECT_KEY"
+    exit 1
+fi
+
+echo "🧪 开始测试项目开通发件箱..."
+
+if [ -z "$CODE" ]; then
+    echo "📧 发送注册验证码..."
+    curl -s -X POST $BASE_URL/api/v1/auth/send-email-code \
+      -H "Content-Type: application/json" \
+      -d "{\"email\": \"$EMAIL\", \"type\": \"register\"}"
+    echo -e "\n\n请收到验证码后执行: $0 $EMAIL <code>"
+    exit 0
+fi
+
+echo "📝 带项目Key注册（同步等待首次开通结果）..."
+curl -s -w "\nHTTP %{http_code}\n" -X POST $BASE_URL/api/v1/auth/register \
+  -H "Content-Type: application/json" \
+  -H "X-Genres-Type: $PROJECT_KEY" \
+  -d "{\"email\": \"$EMAIL\", \"username\": \"prov_$(date +%s)\", \"nickname\": \"开通测试\", \"password\": \"password123\", \"code\": \"$CODE\"}"
+
+if [ -n "$ADMIN_TOKEN" ]; then
+    echo -e "\n📮 最近的开通任务..."
+    curl -s "$BASE_URL/api/v1/admin/provisioning?project_key=$PROJECT_KEY&page_size=5" -H "Authorization: Bearer $ADMIN_TOKEN"
+
+    echo -e "\n\n💀 死信..."
+    curl -s "$BASE_URL/api/v1/admin/provisioning?status=dead" -H "Authorization: Bearer $ADMIN_TOKEN"
+fi
+
+echo -e "\n\n✅ 测试完成"
@@ -0,0 +1,127 @@
+#!/bin/bash
+
+# SCIM 2.0 开通接口测试
+# 需要管理员令牌；PROJECT_KEY 为已启用的项目:
+# ADMIN_TOKEN=... ./test_scim.sh crm
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+PROJECT_KEY="${1:-demo}"
+SCIM_URL="$BASE_URL/scim/v2"
+
+if [ -z "$ADMIN_TOKEN" ]; then
+    echo "请设置 ADMIN_TOKEN"
+    exit 1
+fi
+
+echo "🧪 开始测试 SCIM 接口..."
+
+echo "🔑 签发 SCIM 令牌..."
+TOKEN_RESP=$(curl -s -X POST $BASE_URL/api/v1/admin/projects/$PROJECT_KEY/scim-tokens \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"name": "test_scim.sh", "expires_in_days": 1}')
+echo "$TOKEN_RESP"
+SCIM_TOKEN=$(echo "$TOKEN_RESP" | grep -o '"secret":"[^"]*"' | cut -d'"' -f4)
+TOKEN_ID=$(echo "$TOKEN_RESP" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+
+if [ -z "$SCIM_TOKEN" ]; then
+    echo "签发令牌失败"
+    exit 1
+fi
+
+echo -e "\n\n❌ 无令牌访问..."
+curl -s -i $SCIM_URL/Users | head -1
+
+echo -e "\n📋 ServiceProviderConfig..."
+curl -s $SCIM_URL/ServiceProviderConfig -H "Authorization: Bearer $SCIM_TOKEN"
+
+echo -e "\n\n📋 ResourceTypes..."
+curl -s $SCIM_URL/ResourceTypes -H "Authorization: Bearer $SCIM_TOKEN"
+
+SUFFIX=$(date +%s)
+echo -e "\n\n👤 开通用户..."
+USER_RESP=$(curl -s -X POST $SCIM_URL/Users \
+  -H "Authorization: Bearer $SCIM_TOKEN" \
+  -H "Content-Type: application/scim+json" \
+  -d '{
+    "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+    "userName": "scim_'$SUFFIX'",
+    "externalId": "ext-'$SUFFIX'",
+    "name": {"givenName": "Alice", "familyName": "Zhang"},
+    "emails": [{"value": "scim_'$SUFFIX'@example.com", "type": "work", "primary": true}],
+    "title": "Engineer",
+    "active": true
+  }')
+echo "$USER_RESP"
+USER_ID=$(echo "$USER_RESP" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+
+echo -e "\n\n❌ 重复的 userName（409 uniqueness）..."
+curl -s -X POST $SCIM_URL/Users \
+  -H "Authorization: Bearer $SCIM_TOKEN" \
+  -H "Content-Type: application/scim+json" \
+  -d '{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "scim_'$SUFFIX'"}'
+
+echo -e "\n\n🔍 按 userName 过滤..."
+curl -s -G $SCIM_URL/Users -H "Authorization: Bearer $SCIM_TOKEN" \
+  --data-urlencode 'filter=userName eq "scim_'$SUFFIX'"'
+
+echo -e "\n\n🔍 按邮箱后缀过滤，只返回 userName..."
+curl -s -G $SCIM_URL/Users -H "Authorization: Bearer $SCIM_TOKEN" \
+  --data-urlencode 'filter=emails[value ew "@example.com"] and active eq true' \
+  --data-urlencode 'attributes=userName' \
+  --data-urlencode 'count=5'
+
+echo -e "\n\n🏷️ ETag 与 If-None-Match..."
+ETAG=$(curl -s -D - -o /dev/null $SCIM_URL/Users/$USER_ID -H "Authorization: Bearer $SCIM_TOKEN" | grep -i '^etag:' | cut -d' ' -f2- | tr -d '\r')
+echo "ETag: $ETAG"
+curl -s -i $SCIM_URL/Users/$USER_ID -H "Authorization: Bearer $SCIM_TOKEN" -H "If-None-Match: $ETAG" | head -1
+
+echo -e "\n✏️ PATCH 修改邮箱并停用..."
+curl -s -X PATCH $SCIM_URL/Users/$USER_ID \
+  -H "Authorization: Bearer $SCIM_TOKEN" \
+  -H "Content-Type: application/scim+json" \
+  -H "If-Match: $ETAG" \
+  -d '{
+    "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+    "Operations": [
+      {"op": "replace", "path": "emails[type eq \"work\"].value", "value": "scim_'$SUFFIX'@example.org"},
+      {"op": "Replace", "path": "active", "value": "False"}
+    ]
+  }'
+
+echo -e "\n\n❌ 旧版本的 If-Match（412）..."
+curl -s -X PATCH $SCIM_URL/Users/$USER_ID \
+  -H "Authorization: Bearer $SCIM_TOKEN" \
+  -H "Content-Type: application/scim+json" \
+  -H "If-Match: $ETAG" \
+  -d '{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "replace", "path": "title", "value": "Lead"}]}'
+
+echo -e "\n\n👥 创建组..."
+GROUP_RESP=$(curl -s -X POST $SCIM_URL/Groups \
+  -H "Authorization: Bearer $SCIM_TOKEN" \
+  -H "Content-Type: application/scim+json" \
+  -d '{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"], "displayName": "scim_group_'$SUFFIX'", "members": [{"value": "'$USER_ID'"}]}')
+echo "$GROUP_RESP"
+GROUP_ID=$(echo "$GROUP_RESP" | grep -o '"id":"[^"]*"' | head -1 | cut -d'"' -f4)
+
+echo -e "\n\n🔍 按成员过滤组..."
+curl -s -G $SCIM_URL/Groups -H "Authorization: Bearer $SCIM_TOKEN" \
+  --data-urlencode 'filter=members[value eq "'$USER_ID'"]' \
+  --data-urlencode 'excludedAttributes=members'
+
+echo -e "\n\n➖ PATCH 移除成员..."
+curl -s -X PATCH $SCIM_URL/Groups/$GROUP_ID \
+  -H "Authorization: Bearer $SCIM_TOKEN" \
+  -H "Content-Type: application/scim+json" \
+  -d '{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "remove", "path": "members[value eq \"'$USER_ID'\"]"}]}'
+
+echo -e "\n\n🗑️ 删除组与用户..."
+curl -s -o /dev/null -w "%{http_code}\n" -X DELETE $SCIM_URL/Groups/$GROUP_ID -H "Authorization: Bearer $SCIM_TOKEN"
+curl -s -o /dev/null -w "%{http_code}\n" -X DELETE $SCIM_URL/Users/$USER_ID -H "Authorization: Bearer $SCIM_TOKEN"
+
+echo -e "\n🔒 吊销令牌..."
+curl -s -X DELETE $BASE_URL/api/v1/admin/projects/$PROJECT_KEY/scim-tokens/$TOKEN_ID \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+curl -s -i $SCIM_URL/Users -H "Authorization: Bearer $SCIM_TOKEN" | head -1
+
+echo -e "\n✅ SCIM 接口测试完成"
@@ -0,0 +1,42 @@
+#!/bin/bash
+
+# 短信网关测试（基于本地 fake 短信服务）
+# 先启动: go run ./cmd/fake-sms -addr :9998
+# 再按 docs/SMS_GATEWAY.md 配置服务商端点后启动 unit-auth
+# 查询投递记录需要管理员令牌: ADMIN_TOKEN=... ./test_sms_gateway.sh
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+FAKE_SMS_URL="${FAKE_SMS_URL:-http://localhost:9998}"
+PHONE="${1:-13800138000}"
+
+echo "🧪 开始测试短信网关..."
+
+echo "📱 发送登录验证码..."
+curl -s -X POST $BASE_URL/api/v1/auth/send-sms-code \
+  -H "Content-Type: application/json" \
+  -d "{\"phone\": \"$PHONE\", \"type\": \"login\"}" | jq .
+
+echo -e "\n\n📨 fake 服务收到的短信..."
+curl -s $FAKE_SMS_URL/_fake/messages | jq '.[-1]'
+
+echo -e "\n\n💥 令 aliyun 接下来 1 次发送失败..."
+curl -s -X POST "$FAKE_SMS_URL/_fake/fail?vendor=aliyun&count=1" | jq .
+
+echo -e "\n\n⏳ 等待发送冷却（1分钟）..."
+sleep 61
+
+echo -e "\n\n📱 再次发送（应故障转移到下一个服务商）..."
+curl -s -X POST $BASE_URL/api/v1/auth/send-sms-code \
+  -H "Content-Type: application/json" \
+  -d "{\"phone\": \"$PHONE\", \"type\": \"login\"}" | jq .
+curl -s $FAKE_SMS_URL/_fake/messages | jq '.[-1]'
+
+if [ -n "$ADMIN_TOKEN" ]; then
+    echo -e "\n\n📊 服务商路由状态..."
+    curl -s $BASE_URL/api/v1/admin/sms/vendors -H "Authorization: Bearer $ADMIN_TOKEN" | jq .
+
+    echo -e "\n\n📋 投递记录..."
+    curl -s "$BASE_URL/api/v1/admin/sms/deliveries?phone=$PHONE&page_size=5" -H "Authorization: Bearer $ADMIN_TOKEN" | jq .
+fi
+
+echo -e "\n\n✅ 短信网关测试完成"
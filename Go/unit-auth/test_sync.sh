@@ -0,0 +1,68 @@
+#!/bin/bash
+
+# 数据同步引擎测试
+# 需要管理员令牌；PROJECT_KEY 为已启用的项目:
+# ADMIN_TOKEN=... ./test_sync.sh demo_app
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+PROJECT_KEY="${1:-demo_app}"
+TASK_NAME="users_to_${PROJECT_KEY}_$(date +%s)"
+
+if [ -z "$ADMIN_TOKEN" ]; then
+    echo "请设置 ADMIN_TOKEN"
+    exit 1
+fi
+
+echo "🧪 开始测试数据同步..."
+
+echo "🆕 创建同步任务（每 15 分钟增量）..."
+TASK=$(curl -s -X POST $BASE_URL/api/v1/admin/sync/tasks \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"name\": \"$TASK_NAME\", \"source_project\": \"unit-auth\", \"target_project\": \"$PROJECT_KEY\", \"sync_type\": \"incremental\", \"schedule\": \"*/15 * * * *\", \"config\": {\"batch_size\": 100}}")
+echo "$TASK"
+TASK_ID=$(echo "$TASK" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+
+echo -e "\n❌ 无效的 cron 表达式..."
+curl -s -X POST $BASE_URL/api/v1/admin/sync/tasks \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"name\": \"${TASK_NAME}_bad\", \"source_project\": \"unit-auth\", \"target_project\": \"$PROJECT_KEY\", \"sync_type\": \"full\", \"schedule\": \"61 * * * *\"}"
+
+echo -e "\n\n🔗 添加映射..."
+curl -s -X POST $BASE_URL/api/v1/admin/sync/mappings \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"task_id\": $TASK_ID, \"source_table\": \"users\", \"target_table\": \"users\", \"field_mapping\": {\"id\": \"user_id\", \"email\": \"email\", \"phone\": \"phone\", \"username\": \"username\", \"nickname\": \"nickname\"}, \"transform_rule\": {\"email\": [\"trim\", \"lowercase\"], \"nickname\": {\"type\": \"default\", \"value\": \"user\"}}}"
+
+echo -e "\n\n▶️ 立即全量执行..."
+curl -s -X POST "$BASE_URL/api/v1/admin/sync/tasks/$TASK_ID/run?mode=full" \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n🔁 重复执行（执行中返回 409）..."
+curl -s -X POST "$BASE_URL/api/v1/admin/sync/tasks/$TASK_ID/run" \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+sleep 3
+
+echo -e "\n\n📋 任务详情（含检查点）..."
+curl -s $BASE_URL/api/v1/admin/sync/tasks/$TASK_ID \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n📜 执行日志..."
+curl -s "$BASE_URL/api/v1/admin/sync/logs?task_id=$TASK_ID" \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n⚠️ 冲突..."
+curl -s "$BASE_URL/api/v1/admin/sync/conflicts?task_id=$TASK_ID&resolved=false" \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n⏸️ 暂停..."
+curl -s -X POST $BASE_URL/api/v1/admin/sync/tasks/$TASK_ID/pause \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n⏯️ 恢复..."
+curl -s -X POST $BASE_URL/api/v1/admin/sync/tasks/$TASK_ID/resume \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n✅ 数据同步测试完成"
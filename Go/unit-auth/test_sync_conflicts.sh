@@ -0,0 +1,76 @@
+#!/bin/bash
+
+# 同步冲突处理测试
+# 需要管理员令牌；TASK_ID 为已产生冲突的同步任务:
+# ADMIN_TOKEN=... ./test_sync_conflicts.sh 3
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+TASK_ID="${1:-1}"
+
+if [ -z "$ADMIN_TOKEN" ]; then
+    echo "请设置 ADMIN_TOKEN"
+    exit 1
+fi
+
+echo "🧪 开始测试同步冲突处理..."
+
+echo "⚙️ 设置任务冲突策略为 last_writer_wins..."
+curl -s -X PUT $BASE_URL/api/v1/admin/sync/tasks/$TASK_ID \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"config": {"conflict_strategy": "last_writer_wins"}}'
+
+echo -e "\n\n❌ 无效的冲突策略..."
+curl -s -X PUT $BASE_URL/api/v1/admin/sync/tasks/$TASK_ID \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"config": {"conflict_strategy": "newest"}}'
+
+echo -e "\n\n📥 待处理队列（最早的在前）..."
+QUEUE=$(curl -s "$BASE_URL/api/v1/admin/sync/conflicts?task_id=$TASK_ID&resolved=false&order=asc&page_size=5" \
+  -H "Authorization: Bearer $ADMIN_TOKEN")
+echo "$QUEUE"
+CONFLICT_IDS=($(echo "$QUEUE" | grep -o '"id":[0-9]*,"task_id"' | cut -d: -f2 | cut -d, -f1))
+
+if [ ${#CONFLICT_IDS[@]} -eq 0 ]; then
+    echo -e "\n没有待处理的冲突"
+    exit 0
+fi
+CONFLICT_ID=${CONFLICT_IDS[0]}
+
+echo -e "\n\n🔍 冲突详情（逐字段对照）..."
+curl -s $BASE_URL/api/v1/admin/sync/conflicts/$CONFLICT_ID \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n❌ 非 manual 处理不允许指定字段..."
+curl -s -X POST $BASE_URL/api/v1/admin/sync/conflicts/$CONFLICT_ID/resolve \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"resolution": "source_wins", "fields": {"nickname": "target"}}'
+
+echo -e "\n\n✍️ 手动处理：昵称取源，用户名保留目标..."
+curl -s -X POST $BASE_URL/api/v1/admin/sync/conflicts/$CONFLICT_ID/resolve \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"resolution": "manual", "fields": {"nickname": "source", "username": "target"}, "notes": "测试脚本手动处理"}'
+
+echo -e "\n\n🔁 重复处理（返回 409）..."
+curl -s -X POST $BASE_URL/api/v1/admin/sync/conflicts/$CONFLICT_ID/resolve \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"resolution": "ignore"}'
+
+if [ ${#CONFLICT_IDS[@]} -gt 1 ]; then
+    IDS=$(IFS=,; echo "${CONFLICT_IDS[*]:1}")
+    echo -e "\n\n📦 批量保留目标..."
+    curl -s -X POST $BASE_URL/api/v1/admin/sync/conflicts/resolve \
+      -H "Authorization: Bearer $ADMIN_TOKEN" \
+      -H "Content-Type: application/json" \
+      -d "{\"ids\": [$IDS], \"resolution\": \"target_wins\", \"notes\": \"批量保留目标\"}"
+fi
+
+echo -e "\n\n📋 已处理的冲突..."
+curl -s "$BASE_URL/api/v1/admin/sync/conflicts?task_id=$TASK_ID&resolved=true" \
+  -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n✅ 同步冲突处理测试完成"
@@ -0,0 +1,38 @@
+#!/bin/bash
+
+# 验证码发送限制测试
+# 建议以较小的限制启动 unit-auth: VERIFY_COOLDOWN_SECONDS=5 VERIFY_DAILY_CAP=3 VERIFY_CAPTCHA_AFTER=2
+# 查看计数需要管理员令牌: ADMIN_TOKEN=... ./test_verification_throttle.sh
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+PHONE="${1:-13800138000}"
+
+echo "🧪 开始测试验证码发送限制..."
+
+send_code() {
+    curl -s -i -X POST $BASE_URL/api/v1/auth/send-sms-code \
+      -H "Content-Type: application/json" \
+      -d "{\"phone\": \"$PHONE\", \"type\": \"login\"$1}" | grep -E "^HTTP|^Retry-After|^\{"
+}
+
+echo "📱 第一次发送..."
+send_code
+
+echo -e "\n\n📱 立即再次发送（应返回 429 与 Retry-After）..."
+send_code
+
+for i in 1 2 3; do
+    echo -e "\n\n⏳ 等待冷却后第 $((i + 1)) 次发送（达到阈值后返回 428 要求人机验证，达到上限后返回 429）..."
+    sleep 6
+    send_code
+done
+
+echo -e "\n\n🤖 携带 captcha_token 发送..."
+send_code ", \"captcha_token\": \"${CAPTCHA_TOKEN:-invalid-token}\""
+
+if [ -n "$ADMIN_TOKEN" ]; then
+    echo -e "\n\n📊 发送限制统计..."
+    curl -s $BASE_URL/api/v1/admin/verification-stats -H "Authorization: Bearer $ADMIN_TOKEN" | jq .data.throttle
+fi
+
+echo -e "\n\n✅ 验证码发送限制测试完成"
@@ -0,0 +1,62 @@
+#!/bin/bash
+
+# 用户事件 Webhook 测试
+# 需要管理员令牌与一个可接收请求的地址（如 https://webhook.site 生成的 URL）:
+# ADMIN_TOKEN=... WEBHOOK_URL=https://... PROJECT_KEY=<project_key> ./test_webhooks.sh
+
+BASE_URL="${BASE_URL:-http://localhost:8080}"
+WEBHOOK_URL="${WEBHOOK_URL:-http://localhost:9000/hooks}"
+
+if [ -z "$ADMIN_TOKEN" ]; then
+    echo "❌ 请设置 ADMIN_TOKEN"
+    exit 1
+fi
+if [ -z "$PROJECT_KEY" ]; then
+    echo "❌ 请设置 PROJECT_KEY"
+    exit 1
+fi
+
+echo "🧪 开始测试用户事件 Webhook..."
+
+echo "📋 可订阅的事件类型..."
+curl -s $BASE_URL/api/v1/admin/webhooks/event-types -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n➕ 新增订阅（密钥只返回这一次）..."
+response=$(curl -s -X POST $BASE_URL/api/v1/admin/webhooks/subscriptions \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"project_key\": \"$PROJECT_KEY\", \"url\": \"$WEBHOOK_URL\", \"description\": \"test_webhooks.sh\"}")
+echo "$response"
+SUB_ID=$(echo "$response" | grep -o '"subscription":{"id":[0-9]*' | grep -o '[0-9]*$')
+
+if [ -z "$SUB_ID" ]; then
+    echo "❌ 创建订阅失败"
+    exit 1
+fi
+
+echo -e "\n\n📨 发送测试事件..."
+curl -s -X POST $BASE_URL/api/v1/admin/webhooks/subscriptions/$SUB_ID/test -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n⏳ 等待 worker 投递..."
+sleep 3
+
+echo -e "\n📮 该订阅最近的投递..."
+curl -s "$BASE_URL/api/v1/admin/webhooks/deliveries?subscription_id=$SUB_ID&page_size=5" -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n🔁 重放最近一小时的事件..."
+since=$(date -u -d '1 hour ago' +%Y-%m-%dT%H:%M:%SZ 2>/dev/null || date -u -v-1H +%Y-%m-%dT%H:%M:%SZ)
+curl -s -X POST $BASE_URL/api/v1/admin/webhooks/subscriptions/$SUB_ID/replay \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d "{\"since\": \"$since\"}"
+
+echo -e "\n\n🔑 轮换密钥..."
+curl -s -X POST $BASE_URL/api/v1/admin/webhooks/subscriptions/$SUB_ID/rotate-secret -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n💀 死信..."
+curl -s "$BASE_URL/api/v1/admin/webhooks/deliveries?status=dead" -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n🗑️ 删除订阅..."
+curl -s -X DELETE $BASE_URL/api/v1/admin/webhooks/subscriptions/$SUB_ID -H "Authorization: Bearer $ADMIN_TOKEN"
+
+echo -e "\n\n✅ 测试完成"
@@ -32,6 +32,9 @@ if [ "$STATE" != "null" ] && [ "$STATE" != "" ]; then
     echo "📱 二维码URL: $(echo $QR_RESPONSE | jq -r '.data.qr_url')"
     echo "⏰ 过期时间: $(echo $QR_RESPONSE | jq -r '.data.expires_at')"
     
+    echo -e "\n\n📡 也可以通过 SSE 实时接收状态："
+    echo "curl -N $BASE_URL/api/v1/auth/wechat/events/$STATE"
+
     echo -e "\n\n🔄 开始轮询状态（按Ctrl+C停止）..."
     while true; do
         sleep 2
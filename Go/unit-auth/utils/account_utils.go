@@ -15,8 +15,13 @@ const (
 	AccountTypeUnknown  AccountType = "unknown"
 )
 
-// IdentifyAccountType 识别账号类型
+// IdentifyAccountType 识别账号类型（不带区号的手机号按全局默认地区识别）
 func IdentifyAccountType(account string) AccountType {
+	return IdentifyAccountTypeInRegion(account, DefaultPhoneRegion())
+}
+
+// IdentifyAccountTypeInRegion 识别账号类型，不带区号的手机号按 region 的号码规则识别
+func IdentifyAccountTypeInRegion(account, region string) AccountType {
 	account = strings.TrimSpace(account)
 
 	// 检查是否为邮箱
@@ -25,7 +30,7 @@ func IdentifyAccountType(account string) AccountType {
 	}
 
 	// 检查是否为手机号
-	if isPhone(account) {
+	if isPhone(account, region) {
 		return AccountTypePhone
 	}
 
@@ -43,11 +48,10 @@ func isEmail(email string) bool {
 	return emailRegex.MatchString(email)
 }
 
-// isPhone 检查是否为手机号
-func isPhone(phone string) bool {
-	// 支持中国大陆手机号格式
-	phoneRegex := regexp.MustCompile(`^1[3-9]\d{9}$`)
-	return phoneRegex.MatchString(phone)
+// isPhone 检查是否为手机号（带 + / 00 区号的国际号码，或 region 的本地号码）
+func isPhone(phone, region string) bool {
+	_, err := ParsePhone(phone, region)
+	return err == nil
 }
 
 // isUsername 检查是否为用户名
@@ -90,3 +94,28 @@ func GetAccountTypeDescription(accountType AccountType) string {
 		return "未知类型"
 	}
 }
+
+// MaskEmail 邮箱脱敏：保留本地部分前两位与域名，如 al***@example.com
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return MaskPhone(email)
+	}
+	runes := []rune(local)
+	if len(runes) > 2 {
+		runes = runes[:2]
+	}
+	return string(runes) + "***@" + domain
+}
+
+// MaskPhone 手机号脱敏：保留区号/前三位与末四位，如 +86138****8000
+func MaskPhone(phone string) string {
+	runes := []rune(phone)
+	if len(runes) <= 7 {
+		if len(runes) <= 2 {
+			return "***"
+		}
+		return string(runes[:1]) + "***" + string(runes[len(runes)-1:])
+	}
+	return string(runes[:len(runes)-8]) + "****" + string(runes[len(runes)-4:])
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"math/rand"
+	"time"
+)
+
+// ExpBackoffJitter 第 attempt 次（从 1 开始）失败后的等待时间：base*2^(attempt-1)，不超过 max，
+// 取其 50%~100% 的随机值，避免大量任务同时重试
+func ExpBackoffJitter(base, max time.Duration, attempt int) time.Duration {
+	wait := base
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"unit-auth/config"
+)
+
+// 密文前缀（用于将来轮换算法或密钥）
+const encryptedPrefix = "v1:"
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+func dataKey() []byte {
+	key := config.AppConfig.DataEncryptionKey
+	if key == "" {
+		key = config.AppConfig.JWTSecret
+	}
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// EncryptString 使用 AES-256-GCM 加密字符串（空串原样返回）
+func EncryptString(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	block, err := aes.NewCipher(dataKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString 解密 EncryptString 的结果（空串原样返回）
+func DecryptString(enc string) (string, error) {
+	if enc == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(enc, encryptedPrefix) {
+		return "", ErrInvalidCiphertext
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(enc, encryptedPrefix))
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	block, err := aes.NewCipher(dataKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	return string(plain), nil
+}
+
+// DecryptStringOrPlain 解密 EncryptString 的结果；不带加密前缀的旧数据视为明文原样返回
+func DecryptStringOrPlain(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	return DecryptString(value)
+}
@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dkimSignedHeaders 参与签名的邮件头（存在才签）；From、To、Subject 额外多签一次，防止被追加同名头
+var dkimSignedHeaders = []string{
+	"from", "to", "cc", "reply-to", "subject", "date", "message-id",
+	"mime-version", "content-type", "list-unsubscribe", "list-unsubscribe-post",
+}
+
+var dkimOversignedHeaders = []string{"from", "to", "subject"}
+
+// DKIMSigner 单个发件域名的 DKIM 签名（relaxed/relaxed，rsa-sha256 或 ed25519-sha256）
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	key      crypto.Signer
+}
+
+// NewDKIMSigner 由 PEM 私钥（PKCS#1 / PKCS#8 的 RSA，或 PKCS#8 的 Ed25519）创建签名器
+func NewDKIMSigner(domain, selector string, keyPEM []byte) (*DKIMSigner, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	selector = strings.TrimSpace(selector)
+	if domain == "" || selector == "" {
+		return nil, errors.New("dkim domain and selector are required")
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("dkim private key is not PEM encoded")
+	}
+	var key crypto.Signer
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = rsaKey
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch k := parsed.(type) {
+		case *rsa.PrivateKey:
+			key = k
+		case ed25519.PrivateKey:
+			key = k
+		default:
+			return nil, fmt.Errorf("unsupported dkim key type %T", parsed)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported dkim PEM block %q", block.Type)
+	}
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok && rsaKey.N.BitLen() < 1024 {
+		return nil, errors.New("dkim rsa key must be at least 1024 bits")
+	}
+	return &DKIMSigner{Domain: domain, Selector: selector, key: key}, nil
+}
+
+// Algorithm DKIM-Signature 的 a= 标签
+func (s *DKIMSigner) Algorithm() string {
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		return "ed25519-sha256"
+	}
+	return "rsa-sha256"
+}
+
+// DNSRecord 需要发布的 TXT 记录：<selector>._domainkey.<domain>
+func (s *DKIMSigner) DNSRecord() (name, value string, err error) {
+	name = s.Selector + "._domainkey." + s.Domain
+	switch pub := s.key.Public().(type) {
+	case ed25519.PublicKey:
+		return name, "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub), nil
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", "", err
+		}
+		return name, "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+	}
+	return "", "", errors.New("unsupported dkim key type")
+}
+
+// Sign 对完整的 RFC 5322 邮件签名，返回在最前面加上 DKIM-Signature 头的邮件
+func (s *DKIMSigner) Sign(message []byte) ([]byte, error) {
+	message = toCRLF(message)
+	headerEnd := bytes.Index(message, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, errors.New("dkim: message has no header/body separator")
+	}
+	headers := splitHeaderFields(string(message[:headerEnd+2]))
+	body := message[headerEnd+4:]
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	// 按名称从下往上选取参与签名的头
+	used := map[string]int{}
+	var names []string
+	var signed strings.Builder
+	pick := func(name string) {
+		names = append(names, name)
+		count := 0
+		for i := len(headers) - 1; i >= 0; i-- {
+			if headerFieldName(headers[i]) != name {
+				continue
+			}
+			if count == used[name] {
+				signed.WriteString(relaxedHeader(headers[i]))
+				used[name]++
+				return
+			}
+			count++
+		}
+	}
+	for _, name := range dkimSignedHeaders {
+		for _, field := range headers {
+			if headerFieldName(field) == name {
+				pick(name)
+				break
+			}
+		}
+	}
+	for _, name := range dkimOversignedHeaders {
+		pick(name)
+	}
+
+	tags := []string{
+		"v=1",
+		"a=" + s.Algorithm(),
+		"c=relaxed/relaxed",
+		"d=" + s.Domain,
+		"s=" + s.Selector,
+		"t=" + strconv.FormatInt(time.Now().Unix(), 10),
+		"h=" + strings.Join(names, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}
+	unsigned := "DKIM-Signature: " + strings.Join(tags, ";\r\n\t")
+	signed.WriteString(strings.TrimSuffix(relaxedHeader(unsigned+"\r\n"), "\r\n"))
+
+	digest := sha256.Sum256([]byte(signed.String()))
+	var sig []byte
+	var err error
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		// ed25519-sha256（RFC 8463）对 SHA-256 摘要做 PureEdDSA 签名
+		sig, err = s.key.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	} else {
+		sig, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(unsigned)
+	out.WriteString(foldBase64(base64.StdEncoding.EncodeToString(sig)))
+	out.WriteString("\r\n")
+	out.Write(message)
+	return out.Bytes(), nil
+}
+
+// DKIMKeyring 按发件人域名选择签名器
+type DKIMKeyring struct {
+	signers map[string]*DKIMSigner
+}
+
+// LoadDKIMKeyring 解析 "domain:selector:/path/to/key.pem[,...]"，无法加载的条目打印警告后跳过
+func LoadDKIMKeyring(spec string) *DKIMKeyring {
+	keyring := &DKIMKeyring{signers: map[string]*DKIMSigner{}}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 {
+			log.Printf("Warning: invalid MAIL_DKIM_KEYS entry %q, expected domain:selector:keyfile", item)
+			continue
+		}
+		keyPEM, err := os.ReadFile(strings.TrimSpace(parts[2]))
+		if err != nil {
+			log.Printf("Warning: skip dkim key for %s: %v", parts[0], err)
+			continue
+		}
+		signer, err := NewDKIMSigner(parts[0], parts[1], keyPEM)
+		if err != nil {
+			log.Printf("Warning: skip dkim key for %s: %v", parts[0], err)
+			continue
+		}
+		keyring.signers[signer.Domain] = signer
+	}
+	return keyring
+}
+
+// SignerFor 发件地址所在域名的签名器，未配置时返回 nil
+func (k *DKIMKeyring) SignerFor(from string) *DKIMSigner {
+	if k == nil {
+		return nil
+	}
+	return k.signers[EmailDomain(from)]
+}
+
+// Signers 已配置的签名器（按域名）
+func (k *DKIMKeyring) Signers() []*DKIMSigner {
+	if k == nil {
+		return nil
+	}
+	list := make([]*DKIMSigner, 0, len(k.signers))
+	for _, s := range k.signers {
+		list = append(list, s)
+	}
+	return list
+}
+
+// EmailDomain 邮件地址的域名（小写）
+func EmailDomain(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return strings.ToLower(strings.TrimRight(address[i+1:], "> "))
+	}
+	return ""
+}
+
+func toCRLF(b []byte) []byte {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))
+}
+
+// splitHeaderFields 拆分邮件头（续行并入上一字段），每个字段保留结尾 CRLF
+func splitHeaderFields(block string) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(block, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func headerFieldName(field string) string {
+	if i := strings.Index(field, ":"); i >= 0 {
+		return strings.ToLower(strings.TrimSpace(field[:i]))
+	}
+	return ""
+}
+
+// relaxedHeader RFC 6376 3.4.2：名称小写，展开续行，连续空白压缩为一个空格，去掉冒号两侧与行尾空白
+func relaxedHeader(field string) string {
+	i := strings.Index(field, ":")
+	if i < 0 {
+		return ""
+	}
+	name := strings.ToLower(strings.TrimSpace(field[:i]))
+	value := strings.NewReplacer("\r\n", "").Replace(field[i+1:])
+	return name + ":" + strings.TrimSpace(collapseWSP(value)) + "\r\n"
+}
+
+// relaxedBody RFC 6376 3.4.4：行内连续空白压缩为一个空格，去掉行尾空白与末尾空行
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWSP(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// foldBase64 将签名值按 72 字符折行（b= 中的空白在校验时会被忽略）
+func foldBase64(s string) string {
+	var b strings.Builder
+	for len(s) > 72 {
+		b.WriteString(s[:72])
+		b.WriteString("\r\n\t")
+		s = s[72:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
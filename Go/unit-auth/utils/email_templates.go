@@ -0,0 +1,409 @@
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"unit-auth/config"
+)
+
+// 内置邮件模板 Key
+const (
+	EmailTemplateVerificationRegister      = "verification_register"
+	EmailTemplateVerificationLogin         = "verification_login"
+	EmailTemplateVerificationResetPassword = "verification_reset_password"
+	EmailTemplateVerificationCode          = "verification_code"
+	EmailTemplateWelcome                   = "welcome"
+	EmailTemplatePasswordChanged           = "password_changed"
+	EmailTemplateAccountLocked             = "account_locked"
+	EmailTemplateLoginNotification         = "login_notification"
+	EmailTemplateVerificationChangeEmail   = "verification_change_email"
+	EmailTemplateContactChanged            = "contact_changed"
+)
+
+// ErrEmailTemplateNotFound 模板 Key 不存在
+var ErrEmailTemplateNotFound = errors.New("email template not found")
+
+// 内置模板：templates/email/layout.html 为统一布局，<语言>/<key>.tmpl 定义 subject、html、text 三个子模板，
+// <语言>/_common.tmpl 定义页脚等公共片段
+//
+//go:embed all:templates/email
+var emailTemplateFS embed.FS
+
+// emailTemplateSamples 各模板的变量及预览用示例值（发送时缺少的变量按空字符串处理）
+var emailTemplateSamples = map[string]map[string]interface{}{
+	EmailTemplateVerificationRegister:      {"Code": "123456", "ExpiresMinutes": 10},
+	EmailTemplateVerificationLogin:         {"Code": "123456", "ExpiresMinutes": 10},
+	EmailTemplateVerificationResetPassword: {"Code": "123456", "ExpiresMinutes": 10},
+	EmailTemplateVerificationCode:          {"Code": "123456", "ExpiresMinutes": 10},
+	EmailTemplateWelcome:                   {"Username": "alice"},
+	EmailTemplatePasswordChanged:           {"Username": "alice"},
+	EmailTemplateAccountLocked:             {"Username": "alice", "Reason": "too many failed login attempts"},
+	EmailTemplateLoginNotification: {
+		"Username": "alice", "Time": "2024-01-01 12:00:00", "IP": "203.0.113.10",
+		"Location": "Shanghai, CN", "Device": "Chrome on macOS",
+	},
+	EmailTemplateVerificationChangeEmail: {"Code": "123456", "ExpiresMinutes": 10},
+	EmailTemplateContactChanged: {
+		"Username": "alice", "Channel": "email", "OldValue": "al***@example.com", "NewValue": "al***@example.org",
+		"Time": "2024-01-01 12:00:00", "RevertURL": "https://auth.example.com/api/v1/user/contact-change/revert?token=sample", "RevertDays": 7,
+	},
+}
+
+// EmailBranding 邮件品牌（项目可覆盖）
+type EmailBranding struct {
+	Name       string `json:"name"`
+	SenderName string `json:"sender_name"`
+	Color      string `json:"color"`
+	LogoURL    string `json:"logo_url"`
+	LoginURL   string `json:"login_url"`
+}
+
+// DefaultEmailBranding 全局品牌（MAIL_* 配置）
+func DefaultEmailBranding() EmailBranding {
+	return EmailBranding{
+		Name:       config.AppConfig.MailBrandName,
+		SenderName: config.AppConfig.MailSenderName,
+		Color:      config.AppConfig.MailBrandColor,
+		LogoURL:    config.AppConfig.MailLogoURL,
+		LoginURL:   config.AppConfig.MailLoginURL,
+	}
+}
+
+var emailBrandColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// IsValidEmailBrandColor 品牌色需为 #RGB 或 #RRGGBB
+func IsValidEmailBrandColor(color string) bool {
+	return emailBrandColorPattern.MatchString(color)
+}
+
+// EmailContext 发送邮件的上下文：所属项目（品牌与模板覆盖）与语言偏好（语言代码或 Accept-Language）
+type EmailContext struct {
+	ProjectKey string
+	Locale     string
+}
+
+// EmailTemplateOverride 模板覆盖，留空的部分使用内置模板；HTML 覆盖而 Text 留空时纯文本由 HTML 生成
+type EmailTemplateOverride struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// RenderedEmail 渲染结果
+type RenderedEmail struct {
+	Locale     string `json:"locale"`
+	Subject    string `json:"subject"`
+	HTML       string `json:"html"`
+	Text       string `json:"text"`
+	SenderName string `json:"sender_name"`
+}
+
+// EmailTemplateInfo 内置模板信息
+type EmailTemplateInfo struct {
+	Key           string                 `json:"key"`
+	Transactional bool                   `json:"transactional"` // false 为通知类：附带退订头，收件人可退订
+	Locales       []string               `json:"locales"`
+	Variables     map[string]interface{} `json:"variables"` // 变量及示例值
+}
+
+type emailTemplateRegistry struct {
+	layout  string
+	common  map[string]string            // 语言 -> 公共片段
+	sources map[string]map[string]string // 语言 -> key -> 模板源码
+}
+
+var emailTemplates = loadEmailTemplates()
+
+func loadEmailTemplates() *emailTemplateRegistry {
+	layout, err := emailTemplateFS.ReadFile("templates/email/layout.html")
+	if err != nil {
+		panic(fmt.Sprintf("email templates: %v", err))
+	}
+	r := &emailTemplateRegistry{layout: string(layout), common: map[string]string{}, sources: map[string]map[string]string{}}
+	err = fs.WalkDir(emailTemplateFS, "templates/email", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".tmpl" {
+			return err
+		}
+		content, err := emailTemplateFS.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		locale, name := path.Base(path.Dir(p)), strings.TrimSuffix(path.Base(p), ".tmpl")
+		if name == "_common" {
+			r.common[locale] = string(content)
+			return nil
+		}
+		if r.sources[locale] == nil {
+			r.sources[locale] = map[string]string{}
+		}
+		r.sources[locale][name] = string(content)
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("email templates: %v", err))
+	}
+	// 启动时校验全部内置模板
+	for locale, sources := range r.sources {
+		for key := range sources {
+			if _, err := r.render(key, locale, nil, EmailBranding{Name: "Verita", Color: "#2563eb"}, emailTemplateSamples[key]); err != nil {
+				panic(fmt.Sprintf("email template %s/%s: %v", locale, key, err))
+			}
+		}
+	}
+	return r
+}
+
+// EmailTemplateList 内置模板列表
+func EmailTemplateList() []EmailTemplateInfo {
+	byKey := map[string][]string{}
+	for locale, sources := range emailTemplates.sources {
+		for key := range sources {
+			byKey[key] = append(byKey[key], locale)
+		}
+	}
+	list := make([]EmailTemplateInfo, 0, len(byKey))
+	for key, locales := range byKey {
+		sort.Strings(locales)
+		list = append(list, EmailTemplateInfo{Key: key, Transactional: IsTransactionalEmailTemplate(key), Locales: locales, Variables: EmailTemplateSample(key)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// EmailTemplateSample 模板的示例变量
+func EmailTemplateSample(key string) map[string]interface{} {
+	sample := map[string]interface{}{}
+	for k, v := range emailTemplateSamples[key] {
+		sample[k] = v
+	}
+	return sample
+}
+
+// IsEmailTemplateKey 是否为内置模板 Key
+func IsEmailTemplateKey(key string) bool {
+	_, ok := emailTemplateSamples[key]
+	return ok
+}
+
+// EmailLocales 内置模板支持的语言
+func EmailLocales() []string {
+	return emailTemplates.locales()
+}
+
+func (r *emailTemplateRegistry) locales() []string {
+	locales := make([]string, 0, len(r.sources))
+	for locale := range r.sources {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// MatchEmailLocale 按偏好依次匹配支持的语言：每个偏好可以是语言代码（zh-CN、en）或 Accept-Language 头；
+// 先精确匹配，再按主语言匹配（en-US → en），都不匹配时使用 MAIL_DEFAULT_LOCALE
+func MatchEmailLocale(preferences ...string) string {
+	for _, pref := range preferences {
+		for _, tag := range parseAcceptLanguage(pref) {
+			if locale := emailTemplates.matchLocale(tag); locale != "" {
+				return locale
+			}
+		}
+	}
+	if locale := emailTemplates.matchLocale(config.AppConfig.MailDefaultLocale); locale != "" {
+		return locale
+	}
+	return "zh-CN"
+}
+
+func (r *emailTemplateRegistry) matchLocale(tag string) string {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return ""
+	}
+	locales := r.locales()
+	for _, locale := range locales {
+		if strings.EqualFold(locale, tag) {
+			return locale
+		}
+	}
+	base := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+	for _, locale := range locales {
+		if strings.ToLower(strings.SplitN(locale, "-", 2)[0]) == base {
+			return locale
+		}
+	}
+	return ""
+}
+
+// parseAcceptLanguage 按 q 值降序返回语言标签
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
+
+// RenderEmailTemplate 渲染邮件模板（html/template 渲染 HTML，text/template 渲染主题与纯文本）
+func RenderEmailTemplate(key, locale string, override *EmailTemplateOverride, brand EmailBranding, vars map[string]interface{}) (*RenderedEmail, error) {
+	return emailTemplates.render(key, locale, override, brand, vars)
+}
+
+func (r *emailTemplateRegistry) render(key, locale string, override *EmailTemplateOverride, brand EmailBranding, vars map[string]interface{}) (*RenderedEmail, error) {
+	if !IsEmailTemplateKey(key) {
+		return nil, ErrEmailTemplateNotFound
+	}
+	locale = r.localeFor(key, locale)
+	source := r.common[locale] + r.sources[locale][key]
+	if override == nil {
+		override = &EmailTemplateOverride{}
+	}
+	if !IsValidEmailBrandColor(brand.Color) {
+		brand.Color = "#2563eb"
+	}
+
+	data := map[string]interface{}{}
+	for k := range emailTemplateSamples[key] {
+		data[k] = ""
+	}
+	for k, v := range vars {
+		data[k] = v
+	}
+	data["Brand"] = brand
+	data["Locale"] = locale
+
+	textTmpl := texttemplate.New(key)
+	if _, err := textTmpl.Parse(source); err != nil {
+		return nil, err
+	}
+	if override.Subject != "" {
+		if _, err := textTmpl.Parse(`{{define "subject"}}` + override.Subject + `{{end}}`); err != nil {
+			return nil, fmt.Errorf("subject: %w", err)
+		}
+	}
+	if override.Text != "" {
+		if _, err := textTmpl.Parse(`{{define "text"}}` + override.Text + `{{end}}`); err != nil {
+			return nil, fmt.Errorf("text: %w", err)
+		}
+	}
+	var subject bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("subject: %w", err)
+	}
+	data["Subject"] = strings.Join(strings.Fields(subject.String()), " ")
+
+	htmlTmpl := htmltemplate.New("layout")
+	if _, err := htmlTmpl.Parse(r.layout); err != nil {
+		return nil, err
+	}
+	if _, err := htmlTmpl.Parse(source); err != nil {
+		return nil, err
+	}
+	if override.HTML != "" {
+		if _, err := htmlTmpl.Parse(`{{define "html"}}` + override.HTML + `{{end}}`); err != nil {
+			return nil, fmt.Errorf("html: %w", err)
+		}
+	}
+	var content, page bytes.Buffer
+	if err := htmlTmpl.ExecuteTemplate(&content, "html", data); err != nil {
+		return nil, fmt.Errorf("html: %w", err)
+	}
+	if err := htmlTmpl.ExecuteTemplate(&page, "layout", data); err != nil {
+		return nil, fmt.Errorf("html: %w", err)
+	}
+
+	var text string
+	if override.HTML != "" && override.Text == "" {
+		text = htmlToText(content.String())
+	} else {
+		var buf bytes.Buffer
+		if err := textTmpl.ExecuteTemplate(&buf, "text", data); err != nil {
+			return nil, fmt.Errorf("text: %w", err)
+		}
+		text = strings.TrimSpace(buf.String())
+	}
+
+	return &RenderedEmail{
+		Locale:     locale,
+		Subject:    data["Subject"].(string),
+		HTML:       page.String(),
+		Text:       text,
+		SenderName: brand.SenderName,
+	}, nil
+}
+
+// localeFor 模板在该语言不存在时回退到默认语言，再回退到任一提供该模板的语言
+func (r *emailTemplateRegistry) localeFor(key, locale string) string {
+	if _, ok := r.sources[locale][key]; ok {
+		return locale
+	}
+	if fallback := r.matchLocale(config.AppConfig.MailDefaultLocale); fallback != "" {
+		if _, ok := r.sources[fallback][key]; ok {
+			return fallback
+		}
+	}
+	for _, l := range r.locales() {
+		if _, ok := r.sources[l][key]; ok {
+			return l
+		}
+	}
+	return locale
+}
+
+var (
+	htmlDropPattern    = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+	htmlLinkPattern    = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	htmlBreakPattern   = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|li|tr|ol|ul)>`)
+	htmlItemPattern    = regexp.MustCompile(`(?i)<li[^>]*>`)
+	htmlTagPattern     = regexp.MustCompile(`<[^>]+>`)
+	blankLinesPattern  = regexp.MustCompile(`\n{3,}`)
+	lineIndentsPattern = regexp.MustCompile(`(?m)^[ \t]+|[ \t]+$`)
+)
+
+// htmlToText 由 HTML 正文生成纯文本（链接保留地址）
+func htmlToText(s string) string {
+	s = htmlDropPattern.ReplaceAllString(s, "")
+	s = htmlLinkPattern.ReplaceAllString(s, "$2 ($1)")
+	s = htmlItemPattern.ReplaceAllString(s, "- ")
+	s = htmlBreakPattern.ReplaceAllString(s, "\n")
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = lineIndentsPattern.ReplaceAllString(s, "")
+	s = blankLinesPattern.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
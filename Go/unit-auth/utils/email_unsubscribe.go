@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"unit-auth/config"
+)
+
+// ErrInvalidUnsubscribeToken 退订令牌无效
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// notificationEmailTemplates 通知类（非事务）模板：附带 List-Unsubscribe，收件人退订后不再发送；
+// 验证码、密码修改、账户锁定等安全相关邮件始终发送
+var notificationEmailTemplates = map[string]bool{
+	EmailTemplateWelcome:           true,
+	EmailTemplateLoginNotification: true,
+}
+
+// IsTransactionalEmailTemplate 是否为事务类模板（不可退订）
+func IsTransactionalEmailTemplate(key string) bool {
+	return !notificationEmailTemplates[key]
+}
+
+// EmailUnsubscribeToken 退订令牌：邮箱 + HMAC（数据加密密钥派生），不过期
+func EmailUnsubscribeToken(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	return base64.RawURLEncoding.EncodeToString([]byte(email)) + "." + base64.RawURLEncoding.EncodeToString(unsubscribeMAC(email))
+}
+
+// ParseEmailUnsubscribeToken 校验退订令牌，返回邮箱
+func ParseEmailUnsubscribeToken(token string) (string, error) {
+	encoded, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidUnsubscribeToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidUnsubscribeToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(mac)
+	if err != nil || !hmac.Equal(sig, unsubscribeMAC(string(raw))) {
+		return "", ErrInvalidUnsubscribeToken
+	}
+	return string(raw), nil
+}
+
+// EmailUnsubscribeURL 退订链接（MAIL_UNSUBSCRIBE_URL?token=...）
+func EmailUnsubscribeURL(email string) string {
+	base := config.AppConfig.MailUnsubscribeURL
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(EmailUnsubscribeToken(email))
+}
+
+func unsubscribeMAC(email string) []byte {
+	mac := hmac.New(sha256.New, dataKey())
+	mac.Write([]byte("email-unsubscribe:" + email))
+	return mac.Sum(nil)[:16]
+}
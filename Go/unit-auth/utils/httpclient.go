@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	"unit-auth/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 上游（第三方登录、短信等外部服务）请求指标，按目标主机区分
+var (
+	upstreamRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_http_requests_total",
+		Help: "Total number of outbound HTTP requests by upstream host and status",
+	}, []string{"upstream", "method", "status"})
+	upstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "upstream_http_request_duration_seconds",
+		Help:    "Outbound HTTP request duration in seconds by upstream host",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"upstream", "method"})
+	upstreamRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_http_retries_total",
+		Help: "Total number of retried outbound HTTP requests by upstream host",
+	}, []string{"upstream"})
+)
+
+// UpstreamClientOptions 上游 HTTP 客户端配置
+type UpstreamClientOptions struct {
+	Timeout      time.Duration // 单次请求超时（等待响应头）
+	Retries      int           // 幂等请求（GET/HEAD/OPTIONS）的最大重试次数
+	RetryBackoff time.Duration // 首次重试等待，之后指数退避并加抖动
+	Proxy        string        // 出口代理，留空时读取 HTTP(S)_PROXY 环境变量
+}
+
+var (
+	upstreamClient     *http.Client
+	upstreamClientOnce sync.Once
+)
+
+// UpstreamHTTPClient 共享的上游 HTTP 客户端（按 config 中的 UPSTREAM_HTTP_* 配置创建）
+func UpstreamHTTPClient() *http.Client {
+	upstreamClientOnce.Do(func() {
+		upstreamClient = NewUpstreamClient(UpstreamClientOptions{
+			Timeout: time.Duration(config.AppConfig.UpstreamTimeoutMS) * time.Millisecond,
+			Retries: config.AppConfig.UpstreamRetries,
+			Proxy:   config.AppConfig.UpstreamProxy,
+		})
+	})
+	return upstreamClient
+}
+
+// NewUpstreamClient 创建带超时、重试与 Prometheus 指标的 HTTP 客户端
+func NewUpstreamClient(opts UpstreamClientOptions) *http.Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries > 5 {
+		opts.Retries = 5
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 200 * time.Millisecond
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		if proxyURL, err := url.Parse(opts.Proxy); err == nil {
+			proxy = http.ProxyURL(proxyURL)
+		}
+	}
+
+	base := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: opts.Timeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   10,
+	}
+
+	// 整体超时覆盖所有重试
+	overall := opts.Timeout*time.Duration(opts.Retries+1) + opts.RetryBackoff*time.Duration(1<<opts.Retries)
+	return &http.Client{
+		Timeout: overall,
+		Transport: &instrumentedTransport{
+			base:    base,
+			retries: opts.Retries,
+			backoff: opts.RetryBackoff,
+		},
+	}
+}
+
+// instrumentedTransport 记录指标并对幂等请求的网络错误、429、5xx 进行重试
+type instrumentedTransport struct {
+	base    http.RoundTripper
+	retries int
+	backoff time.Duration
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	upstream := req.URL.Host
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		resp, err := t.base.RoundTrip(req)
+		status := "error"
+		if err == nil {
+			status = strconv.Itoa(resp.StatusCode)
+		}
+		upstreamRequestsTotal.WithLabelValues(upstream, req.Method, status).Inc()
+		upstreamRequestDuration.WithLabelValues(upstream, req.Method).Observe(time.Since(start).Seconds())
+
+		if attempt >= t.retries || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		wait := t.backoff << attempt
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		upstreamRetriesTotal.WithLabelValues(upstream).Inc()
+	}
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		// 授权码等一次性请求不重试
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -21,7 +21,8 @@ type EnhancedClaims struct {
 	Role        string `json:"role"`
 	ProjectKey  string `json:"project_key,omitempty"`
 	LocalUserID string `json:"local_user_id,omitempty"`
-	TokenType   string `json:"token_type"` // "access", "refresh", "remember_me"
+	TokenType   string `json:"token_type"` // "access", "refresh", "remember_me", "impersonation"
+	ActorID     string `json:"-"`          // 代操作者（act.sub），仅模拟登录token携带
 	jwt.RegisteredClaims
 }
 
@@ -211,10 +212,21 @@ func ValidateEnhancedToken(tokenString string) (*EnhancedClaims, error) {
 	if v, ok := claims["jti"].(string); ok {
 		enh.ID = v
 	}
+	// act（RFC 8693）：{"sub": "<admin id>"}
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		if v, ok := act["sub"].(string); ok {
+			enh.ActorID = v
+		}
+	}
 
 	return enh, nil
 }
 
+// IsImpersonation 是否为管理员模拟登录token
+func (c *EnhancedClaims) IsImpersonation() bool {
+	return c.ActorID != ""
+}
+
 // ValidateTokenType 验证指定类型的token
 func ValidateTokenType(tokenString string, expectedType string) (*EnhancedClaims, error) {
 	claims, err := ValidateEnhancedToken(tokenString)
@@ -408,6 +420,10 @@ func GenerateAccessTokenWithAudience(userID string, email, role, audience, proje
 
 // GenerateCompactAccessToken 生成带短字段的访问token（sub, uid, pid, luid, iss, aud, iat, exp, jti）
 func GenerateCompactAccessToken(userID string, emailOrIdentifier, role, projectKey, localUserID string) (string, error) {
+	return generateCompactAccessToken(userID, emailOrIdentifier, role, projectKey, localUserID, nil)
+}
+
+func generateCompactAccessToken(userID string, emailOrIdentifier, role, projectKey, localUserID string, extra map[string]interface{}) (string, error) {
 
 	// 兼容无项目映射的情况：pid/luid 为空则不放
 	claims := jwt.MapClaims{
@@ -432,6 +448,12 @@ func GenerateCompactAccessToken(userID string, emailOrIdentifier, role, projectK
 	if strings.TrimSpace(emailOrIdentifier) != "" {
 		claims["email"] = emailOrIdentifier
 	}
+	// 附加声明（不覆盖已有字段）
+	for k, v := range extra {
+		if _, exists := claims[k]; !exists && !reservedClaims[k] {
+			claims[k] = v
+		}
+	}
 	log.Printf("claims: %+v\n", claims)
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -442,3 +464,51 @@ func GenerateCompactAccessToken(userID string, emailOrIdentifier, role, projectK
 func GenerateUnifiedToken(userID, identifier, role, projectKey, localUserID string) (string, error) {
 	return GenerateCompactAccessToken(userID, identifier, role, projectKey, localUserID)
 }
+
+// 附加声明不可使用的保留字段
+var reservedClaims = map[string]bool{
+	"sub": true, "uid": true, "user_id": true, "pid": true, "project_key": true,
+	"luid": true, "local_user_id": true, "role": true, "email": true, "token_type": true,
+	"iss": true, "aud": true, "iat": true, "exp": true, "nbf": true, "jti": true, "act": true,
+}
+
+// GenerateUnifiedTokenWithClaims 统一的token生成，并写入认证钩子补充的附加声明
+func GenerateUnifiedTokenWithClaims(userID, identifier, role, projectKey, localUserID string, extra map[string]interface{}) (string, error) {
+	return generateCompactAccessToken(userID, identifier, role, projectKey, localUserID, extra)
+}
+
+// GenerateImpersonationToken 生成管理员模拟登录token：携带 act 声明，类型为 impersonation，不可续签
+func GenerateImpersonationToken(userID, identifier, role, projectKey, localUserID, actorID string, ttl time.Duration) (string, string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	jti := uuid.New().String()
+
+	claims := jwt.MapClaims{
+		"uid":        userID,
+		"iss":        os.Getenv("JWT_ISS"),
+		"iat":        now.Unix(),
+		"exp":        expiresAt.Unix(),
+		"jti":        jti,
+		"token_type": "impersonation",
+		"act":        map[string]interface{}{"sub": actorID},
+	}
+	if strings.TrimSpace(projectKey) != "" {
+		claims["aud"] = projectKey
+		claims["pid"] = projectKey
+	}
+	if strings.TrimSpace(localUserID) != "" {
+		claims["luid"] = localUserID
+	}
+	if strings.TrimSpace(role) != "" {
+		claims["role"] = role
+	}
+	if strings.TrimSpace(identifier) != "" {
+		claims["email"] = identifier
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.AppConfig.JWTSecret))
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return token, jti, expiresAt, nil
+}
@@ -0,0 +1,537 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unit-auth/config"
+
+	"gopkg.in/mail.v2"
+)
+
+// 邮件传输方式
+const (
+	EmailTransportSMTP = "smtp"
+	EmailTransportFile = "file"
+	EmailTransportHTTP = "http"
+	EmailTransportLog  = "log"
+)
+
+// OutgoingEmail 已渲染、待投递的邮件
+type OutgoingEmail struct {
+	MessageID  string // 发件箱消息ID，文件名与 HTTP API 的幂等键
+	ProjectKey string
+	Template   string
+	From       string
+	FromName   string
+	To         string
+	Subject    string
+	HTML       string
+	Text       string
+}
+
+// EmailTransport 邮件传输（SMTP、本地 maildir、邮件服务商 HTTP API 等）
+type EmailTransport interface {
+	Name() string
+	Send(ctx context.Context, email *OutgoingEmail) error
+}
+
+// PermanentEmailError 不可重试的投递错误（收件人被拒、请求无效等），发件箱直接转入死信
+type PermanentEmailError struct {
+	Err error
+}
+
+func (e *PermanentEmailError) Error() string { return "permanent: " + e.Err.Error() }
+
+func (e *PermanentEmailError) Unwrap() error { return e.Err }
+
+// IsPermanentEmailError 是否为不可重试的投递错误
+func IsPermanentEmailError(err error) bool {
+	var permanent *PermanentEmailError
+	return errors.As(err, &permanent)
+}
+
+// NewEmailTransportFromConfig 按 MAIL_TRANSPORT 创建传输；为空时配置了 SMTP 账号使用 smtp，否则使用 log。
+// smtp 与 file 传输按发件域名使用 MAIL_DKIM_KEYS 中的私钥签名
+func NewEmailTransportFromConfig() (EmailTransport, error) {
+	name := strings.ToLower(strings.TrimSpace(config.AppConfig.MailTransport))
+	if name == "" {
+		name = EmailTransportLog
+		if config.AppConfig.SMTPUser != "" && config.AppConfig.SMTPPassword != "" {
+			name = EmailTransportSMTP
+		}
+	}
+	dkim := LoadDKIMKeyring(config.AppConfig.MailDKIMKeys)
+	switch name {
+	case EmailTransportSMTP:
+		return NewSMTPTransport(dkim), nil
+	case EmailTransportFile:
+		return NewFileTransport(config.AppConfig.MailFileDir, dkim)
+	case EmailTransportHTTP:
+		return NewHTTPTransport(config.AppConfig.MailHTTPURL, config.AppConfig.MailHTTPToken)
+	case EmailTransportLog:
+		return LogTransport{}, nil
+	}
+	return nil, fmt.Errorf("unknown mail transport %q", name)
+}
+
+// EmailHeaders 附加邮件头：Message-ID（发件域名下唯一）；通知类邮件附加 List-Unsubscribe 与一键退订（RFC 8058）
+func EmailHeaders(email *OutgoingEmail) map[string]string {
+	domain := EmailDomain(email.From)
+	if domain == "" {
+		domain = "localhost"
+	}
+	headers := map[string]string{
+		"Message-ID": "<" + email.MessageID + "@" + domain + ">",
+	}
+	if !IsTransactionalEmailTemplate(email.Template) {
+		headers["List-Unsubscribe"] = "<" + EmailUnsubscribeURL(email.To) + ">"
+		headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+	}
+	return headers
+}
+
+// buildMessage 组装 MIME 邮件：multipart/alternative，纯文本在前、HTML 在后（客户端优先展示最后一个可渲染的部分）
+func buildMessage(email *OutgoingEmail) *mail.Message {
+	msg := mail.NewMessage()
+	msg.SetAddressHeader("From", email.From, email.FromName)
+	msg.SetHeader("To", email.To)
+	msg.SetHeader("Subject", email.Subject)
+	for name, value := range EmailHeaders(email) {
+		msg.SetHeader(name, value)
+	}
+	// 同时提供纯文本与HTML，降低被判为垃圾邮件的概率
+	switch {
+	case email.Text == "":
+		msg.SetBody("text/html", email.HTML)
+	case email.HTML == "":
+		msg.SetBody("text/plain", email.Text)
+	default:
+		msg.SetBody("text/plain", email.Text)
+		msg.AddAlternative("text/html", email.HTML)
+	}
+
+	// 添加邮件头
+	msg.SetHeader("X-Mailer", "Verita Auth Service")
+	msg.SetHeader("X-Priority", "3")
+	return msg
+}
+
+// EncodeEmail 编码为 RFC 5322 邮件，发件域名配置了 DKIM 时附加签名（签名失败时发送未签名邮件并打印警告）
+func EncodeEmail(email *OutgoingEmail, dkim *DKIMKeyring) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := buildMessage(email).WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	signer := dkim.SignerFor(email.From)
+	if signer == nil {
+		return buf.Bytes(), nil
+	}
+	signed, err := signer.Sign(buf.Bytes())
+	if err != nil {
+		log.Printf("Warning: dkim signing failed for %s, sending unsigned: %v", signer.Domain, err)
+		return buf.Bytes(), nil
+	}
+	return signed, nil
+}
+
+// SMTPTransport 通过 SMTP 服务器发送
+type SMTPTransport struct {
+	dialer *mail.Dialer
+	dkim   *DKIMKeyring
+}
+
+// NewSMTPTransport 按 SMTP_* 配置创建 SMTP 传输
+func NewSMTPTransport(dkim *DKIMKeyring) *SMTPTransport {
+	dialer := mail.NewDialer(
+		config.AppConfig.SMTPHost,
+		config.AppConfig.SMTPPort,
+		config.AppConfig.SMTPUser,
+		config.AppConfig.SMTPPassword,
+	)
+
+	fmt.Printf("🔧 初始化SMTP传输: %s:%d\n", config.AppConfig.SMTPHost, config.AppConfig.SMTPPort)
+
+	// 配置TLS - 根据SMTP服务器和端口选择不同的配置
+	if config.AppConfig.SMTPHost == "smtp.163.com" {
+		// 163邮箱特殊配置
+		if config.AppConfig.SMTPPort == 465 {
+			// SSL连接
+			dialer.SSL = true
+			dialer.TLSConfig = &tls.Config{
+				InsecureSkipVerify: false,
+				ServerName:         config.AppConfig.SMTPHost,
+			}
+		} else if config.AppConfig.SMTPPort == 587 {
+			// STARTTLS连接
+			dialer.TLSConfig = &tls.Config{
+				InsecureSkipVerify: false,
+				ServerName:         config.AppConfig.SMTPHost,
+			}
+			dialer.StartTLSPolicy = mail.MandatoryStartTLS
+		}
+	} else if config.AppConfig.SMTPHost == "smtp.gmail.com" {
+		// Gmail配置
+		if config.AppConfig.SMTPPort == 465 {
+			dialer.SSL = true
+			dialer.TLSConfig = &tls.Config{
+				InsecureSkipVerify: false,
+				ServerName:         config.AppConfig.SMTPHost,
+			}
+		} else if config.AppConfig.SMTPPort == 587 {
+			dialer.TLSConfig = &tls.Config{
+				InsecureSkipVerify: false,
+				ServerName:         config.AppConfig.SMTPHost,
+			}
+			dialer.StartTLSPolicy = mail.MandatoryStartTLS
+		}
+	} else {
+		// 其他SMTP服务器通用配置
+		if config.AppConfig.SMTPPort == 465 {
+			dialer.SSL = true
+			dialer.TLSConfig = &tls.Config{
+				InsecureSkipVerify: true,
+				ServerName:         config.AppConfig.SMTPHost,
+			}
+		} else if config.AppConfig.SMTPPort == 587 {
+			dialer.TLSConfig = &tls.Config{
+				InsecureSkipVerify: true,
+				ServerName:         config.AppConfig.SMTPHost,
+			}
+			dialer.StartTLSPolicy = mail.MandatoryStartTLS
+		}
+	}
+
+	if config.AppConfig.SMTPUser != config.AppConfig.SMTPFrom {
+		fmt.Println("⚠️ 发件人与SMTP用户不一致，可能被退信 (建议两者一致)")
+	}
+
+	// 设置连接超时
+	dialer.Timeout = 15 * time.Second
+
+	return &SMTPTransport{dialer: dialer, dkim: dkim}
+}
+
+func (t *SMTPTransport) Name() string { return EmailTransportSMTP }
+
+// Send 连接 SMTP 服务器发送；投递阶段服务器返回 5xx（收件人不存在、内容被拒等）视为不可重试
+func (t *SMTPTransport) Send(ctx context.Context, email *OutgoingEmail) error {
+	data, err := EncodeEmail(email, t.dkim)
+	if err != nil {
+		return &PermanentEmailError{Err: err}
+	}
+	client, err := t.dial(ctx)
+	if err != nil {
+		printSMTPHints(err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer client.Close()
+
+	if err := smtpDeliver(client, email.From, email.To, data); err != nil {
+		printSMTPHints(err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var smtpErr *textproto.Error
+		if errors.As(err, &smtpErr) && smtpErr.Code >= 500 {
+			return &PermanentEmailError{Err: err}
+		}
+		return err
+	}
+	return client.Quit()
+}
+
+// smtpDefaultSendTimeout 调用方未设置截止时间时整个 SMTP 会话的超时
+const smtpDefaultSendTimeout = time.Minute
+
+// dial 连接、协商 TLS 并认证（与 mail.Dialer.Dial 的流程一致）。
+// 连接的截止时间取 ctx 的截止时间（发件箱为 SendTimeout），ctx 取消时关闭连接，整个会话不会超过该时间
+func (t *SMTPTransport) dial(ctx context.Context) (*smtp.Client, error) {
+	d := t.dialer
+	netDialer := net.Dialer{Timeout: d.Timeout}
+	conn, err := netDialer.DialContext(ctx, "tcp", net.JoinHostPort(d.Host, strconv.Itoa(d.Port)))
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpDefaultSendTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// ctx 取消时关闭连接，阻塞中的读写立即返回
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-done:
+			}
+		}()
+		conn = &notifyCloseConn{Conn: conn, done: done}
+	}
+
+	tlsConfig := d.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: d.Host}
+	}
+	if d.SSL {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, d.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if d.LocalName != "" {
+		if err := client.Hello(d.LocalName); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if !d.SSL && d.StartTLSPolicy != mail.NoStartTLS {
+		ok, _ := client.Extension("STARTTLS")
+		if !ok && d.StartTLSPolicy == mail.MandatoryStartTLS {
+			client.Close()
+			return nil, mail.StartTLSUnsupportedError{Policy: d.StartTLSPolicy}
+		}
+		if ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+	if d.Username != "" {
+		if ok, mechanisms := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtpAuth(mechanisms, d.Username, d.Password, d.Host)); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+	return client, nil
+}
+
+// smtpDeliver 在已认证的连接上投递一封邮件
+func smtpDeliver(client *smtp.Client, from, to string, data []byte) error {
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// smtpAuth 按服务器支持的机制选择认证方式：CRAM-MD5 优先，仅支持 LOGIN 时用 LOGIN，否则用 PLAIN
+func smtpAuth(mechanisms, username, password, host string) smtp.Auth {
+	switch {
+	case strings.Contains(mechanisms, "CRAM-MD5"):
+		return smtp.CRAMMD5Auth(username, password)
+	case strings.Contains(mechanisms, "LOGIN") && !strings.Contains(mechanisms, "PLAIN"):
+		return &smtpLoginAuth{username: username, password: password, host: host}
+	}
+	return smtp.PlainAuth("", username, password, host)
+}
+
+// smtpLoginAuth LOGIN 认证（net/smtp 未提供）；未加密的连接上只在服务器声明支持时使用
+type smtpLoginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *smtpLoginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		advertised := false
+		for _, mechanism := range server.Auth {
+			if mechanism == "LOGIN" {
+				advertised = true
+				break
+			}
+		}
+		if !advertised {
+			return "", nil, errors.New("unencrypted connection")
+		}
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *smtpLoginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(fromServer) {
+	case "Username:":
+		return []byte(a.username), nil
+	case "Password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+}
+
+// notifyCloseConn 关闭时通知 ctx 监听协程退出
+type notifyCloseConn struct {
+	net.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+func (c *notifyCloseConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+func printSMTPHints(err error) {
+	fmt.Printf("❌ SMTP错误详情: %v\n", err)
+
+	// 提供邮箱特定的错误提示
+	if config.AppConfig.SMTPHost == "smtp.163.com" || config.AppConfig.SMTPHost == "smtp.yeah.net" {
+		fmt.Println("💡 网易邮箱故障排除:")
+		fmt.Println("   1. 确认已开启SMTP服务")
+		fmt.Println("   2. 确认使用的是授权码，不是邮箱密码")
+		fmt.Println("   3. 确认发件人邮箱与SMTP用户一致")
+		fmt.Println("   4. 尝试使用465端口")
+	}
+}
+
+// FileTransport 将邮件以 .eml 写入 maildir（tmp/ 写完后移动到 new/），用于本地开发与测试
+type FileTransport struct {
+	dir  string
+	dkim *DKIMKeyring
+}
+
+// NewFileTransport 创建 maildir 传输，目录不存在时自动创建
+func NewFileTransport(dir string, dkim *DKIMKeyring) (*FileTransport, error) {
+	if dir == "" {
+		return nil, errors.New("mail file dir is required")
+	}
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &FileTransport{dir: dir, dkim: dkim}, nil
+}
+
+func (t *FileTransport) Name() string { return EmailTransportFile }
+
+func (t *FileTransport) Send(ctx context.Context, email *OutgoingEmail) error {
+	data, err := EncodeEmail(email, t.dkim)
+	if err != nil {
+		return &PermanentEmailError{Err: err}
+	}
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%s.%s.eml", time.Now().UnixNano(), email.MessageID, strings.ReplaceAll(host, "/", "_"))
+	tmp := filepath.Join(t.dir, "tmp", name)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.dir, "new", name))
+}
+
+// HTTPTransport 通过邮件服务商 HTTP API 发送：POST JSON，Bearer 鉴权，message_id 作为幂等键；
+// DKIM 由服务商按其域名配置签名，附加头通过 headers 传递
+type HTTPTransport struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewHTTPTransport 创建 HTTP API 传输
+func NewHTTPTransport(url, token string) (*HTTPTransport, error) {
+	if url == "" {
+		return nil, errors.New("MAIL_HTTP_URL is required for http mail transport")
+	}
+	return &HTTPTransport{url: url, token: token, httpClient: UpstreamHTTPClient()}, nil
+}
+
+func (t *HTTPTransport) Name() string { return EmailTransportHTTP }
+
+// Send 2xx 视为成功；4xx（408、429 除外）视为不可重试
+func (t *HTTPTransport) Send(ctx context.Context, email *OutgoingEmail) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"message_id": email.MessageID,
+		"from":       email.From,
+		"from_name":  email.FromName,
+		"to":         email.To,
+		"subject":    email.Subject,
+		"html":       email.HTML,
+		"text":       email.Text,
+		"headers":    EmailHeaders(email),
+	})
+	if err != nil {
+		return &PermanentEmailError{Err: err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", email.MessageID)
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("mail api returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &PermanentEmailError{Err: err}
+	}
+	return err
+}
+
+// LogTransport 仅打印邮件摘要，不实际发送（未配置 SMTP 时的开发环境默认）
+type LogTransport struct{}
+
+func (LogTransport) Name() string { return EmailTransportLog }
+
+func (LogTransport) Send(ctx context.Context, email *OutgoingEmail) error {
+	fmt.Printf("📧 邮件内容预览 (开发环境模拟发送):\n")
+	fmt.Printf("主题: %s\n", email.Subject)
+	fmt.Printf("收件人: %s\n", email.To)
+	fmt.Printf("发件人: %s <%s>\n", email.FromName, email.From)
+	fmt.Printf("正文:\n%s\n", email.Text)
+	return nil
+}
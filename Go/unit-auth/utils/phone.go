@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unit-auth/config"
+)
+
+// ErrInvalidPhone 手机号格式不正确（或不符合所属国家/地区的号码规则）
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// phoneRegion 国家/地区的手机号规则
+type phoneRegion struct {
+	Region      string         // ISO 3166-1 二位代码
+	CallingCode string         // 国际区号
+	TrunkPrefix string         // 国内长途前缀（本地写法中可能带上，如英国 07700...）
+	Mobile      *regexp.Regexp // 国内有效号码（不含区号与长途前缀）
+	Groups      []int          // 展示分组，最后一组包含剩余数字
+}
+
+// phoneRegions 支持按国家规则校验的地区；其余区号按 E.164 通用规则（8-15 位数字）处理
+var phoneRegions = []phoneRegion{
+	{"CN", "86", "0", regexp.MustCompile(`^1[3-9]\d{9}$`), []int{3, 4, 4}},
+	{"HK", "852", "", regexp.MustCompile(`^[4-9]\d{7}$`), []int{4, 4}},
+	{"MO", "853", "", regexp.MustCompile(`^6\d{7}$`), []int{4, 4}},
+	{"TW", "886", "0", regexp.MustCompile(`^9\d{8}$`), []int{3, 3, 3}},
+	{"US", "1", "1", regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`), []int{3, 3, 4}},
+	{"CA", "1", "1", regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`), []int{3, 3, 4}},
+	{"GB", "44", "0", regexp.MustCompile(`^7\d{9}$`), []int{4, 6}},
+	{"JP", "81", "0", regexp.MustCompile(`^[789]0\d{8}$`), []int{2, 4, 4}},
+	{"KR", "82", "0", regexp.MustCompile(`^1\d{8,9}$`), []int{2, 4, 4}},
+	{"SG", "65", "", regexp.MustCompile(`^[89]\d{7}$`), []int{4, 4}},
+	{"MY", "60", "0", regexp.MustCompile(`^1\d{8,9}$`), []int{2, 3, 4}},
+	{"TH", "66", "0", regexp.MustCompile(`^[689]\d{8}$`), []int{2, 3, 4}},
+	{"VN", "84", "0", regexp.MustCompile(`^[35789]\d{8}$`), []int{2, 3, 4}},
+	{"PH", "63", "0", regexp.MustCompile(`^9\d{9}$`), []int{3, 3, 4}},
+	{"ID", "62", "0", regexp.MustCompile(`^8\d{8,11}$`), []int{3, 4, 4}},
+	{"IN", "91", "0", regexp.MustCompile(`^[6-9]\d{9}$`), []int{5, 5}},
+	{"AU", "61", "0", regexp.MustCompile(`^4\d{8}$`), []int{3, 3, 3}},
+	{"NZ", "64", "0", regexp.MustCompile(`^2\d{7,9}$`), []int{2, 3, 4}},
+	{"DE", "49", "0", regexp.MustCompile(`^1[5-7]\d{8,9}$`), []int{3, 8}},
+	{"FR", "33", "0", regexp.MustCompile(`^[67]\d{8}$`), []int{1, 2, 2, 2, 2}},
+	{"RU", "7", "8", regexp.MustCompile(`^9\d{9}$`), []int{3, 3, 2, 2}},
+}
+
+var (
+	phoneRegionsByCode   = map[string]*phoneRegion{}
+	phoneRegionsByRegion = map[string]*phoneRegion{}
+)
+
+func init() {
+	for i := range phoneRegions {
+		r := &phoneRegions[i]
+		phoneRegionsByRegion[r.Region] = r
+		// 共用区号时以先出现的地区为主（+1 → US）
+		if _, ok := phoneRegionsByCode[r.CallingCode]; !ok {
+			phoneRegionsByCode[r.CallingCode] = r
+		}
+	}
+}
+
+// PhoneNumber 解析后的手机号
+type PhoneNumber struct {
+	CountryCode string // 国际区号，如 86
+	Region      string // 国家/地区，未收录的区号为空
+	National    string // 国内号码（不含区号与长途前缀）
+}
+
+// E164 E.164 格式（入库格式），如 +8613800138000
+func (p *PhoneNumber) E164() string {
+	return "+" + p.CountryCode + p.National
+}
+
+// Display 国际展示格式，如 +86 138 0013 8000
+func (p *PhoneNumber) Display() string {
+	region := phoneRegionsByRegion[p.Region]
+	if region == nil {
+		return p.E164()
+	}
+	parts := []string{"+" + p.CountryCode}
+	rest := p.National
+	for i, size := range region.Groups {
+		if rest == "" {
+			break
+		}
+		if i == len(region.Groups)-1 || size >= len(rest) {
+			parts = append(parts, rest)
+			rest = ""
+			break
+		}
+		parts = append(parts, rest[:size])
+		rest = rest[size:]
+	}
+	if rest != "" {
+		parts = append(parts, rest)
+	}
+	return strings.Join(parts, " ")
+}
+
+// DefaultPhoneRegion 全局默认地区（PHONE_DEFAULT_REGION，未配置时为 CN）
+func DefaultPhoneRegion() string {
+	if region := strings.ToUpper(strings.TrimSpace(config.AppConfig.PhoneDefaultRegion)); IsSupportedPhoneRegion(region) {
+		return region
+	}
+	return "CN"
+}
+
+// IsSupportedPhoneRegion 是否为支持按国家规则校验的地区
+func IsSupportedPhoneRegion(region string) bool {
+	_, ok := phoneRegionsByRegion[strings.ToUpper(region)]
+	return ok
+}
+
+// ParsePhone 解析手机号：带 + 或 00 前缀的号码按国际区号解析，否则按 defaultRegion 的本地号码解析。
+// 支持空格、横线、括号等分隔符，以及本地写法中的长途前缀和省略 + 的区号（如 8613800138000）
+func ParsePhone(raw, defaultRegion string) (*PhoneNumber, error) {
+	s := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')', '\u00a0', '\t':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(raw))
+
+	international := false
+	switch {
+	case strings.HasPrefix(s, "+"):
+		s, international = s[1:], true
+	case strings.HasPrefix(s, "00"):
+		s, international = s[2:], true
+	}
+	if s == "" || strings.Trim(s, "0123456789") != "" {
+		return nil, ErrInvalidPhone
+	}
+
+	if international {
+		for l := 1; l <= 3 && l < len(s); l++ {
+			code := s[:l]
+			if _, ok := phoneRegionsByCode[code]; !ok {
+				continue
+			}
+			for i := range phoneRegions {
+				if r := &phoneRegions[i]; r.CallingCode == code {
+					if national, ok := r.match(s[l:]); ok {
+						return &PhoneNumber{CountryCode: code, Region: r.Region, National: national}, nil
+					}
+				}
+			}
+			return nil, ErrInvalidPhone
+		}
+		// 未收录的区号：只做 E.164 长度校验，无法区分区号与国内号码
+		if len(s) < 8 || len(s) > 15 || s[0] == '0' {
+			return nil, ErrInvalidPhone
+		}
+		return &PhoneNumber{National: s}, nil
+	}
+
+	region := phoneRegionsByRegion[strings.ToUpper(defaultRegion)]
+	if region == nil {
+		region = phoneRegionsByRegion[DefaultPhoneRegion()]
+	}
+	if national, ok := region.match(s); ok {
+		return &PhoneNumber{CountryCode: region.CallingCode, Region: region.Region, National: national}, nil
+	}
+	// 省略 + 的国际写法，如 8613800138000
+	if strings.HasPrefix(s, region.CallingCode) {
+		if national, ok := region.match(s[len(region.CallingCode):]); ok {
+			return &PhoneNumber{CountryCode: region.CallingCode, Region: region.Region, National: national}, nil
+		}
+	}
+	return nil, ErrInvalidPhone
+}
+
+// match 校验国内号码，允许带长途前缀
+func (r *phoneRegion) match(national string) (string, bool) {
+	if r.Mobile.MatchString(national) {
+		return national, true
+	}
+	if r.TrunkPrefix != "" && strings.HasPrefix(national, r.TrunkPrefix) {
+		trimmed := national[len(r.TrunkPrefix):]
+		if r.Mobile.MatchString(trimmed) {
+			return trimmed, true
+		}
+	}
+	return "", false
+}
+
+// NormalizePhone 规范化为 E.164 格式（入库与查询统一使用）
+func NormalizePhone(raw, defaultRegion string) (string, error) {
+	p, err := ParsePhone(raw, defaultRegion)
+	if err != nil {
+		return "", err
+	}
+	return p.E164(), nil
+}
+
+// FormatPhoneDisplay 将已入库的手机号格式化为展示格式，无法解析时原样返回
+func FormatPhoneDisplay(phone string) string {
+	if phone == "" {
+		return ""
+	}
+	p, err := ParsePhone(phone, DefaultPhoneRegion())
+	if err != nil {
+		return phone
+	}
+	return p.Display()
+}
+
+// PhoneUsername 手机号注册时的默认用户名：国内号码部分（不含 + 与区号）
+func PhoneUsername(phone string) string {
+	p, err := ParsePhone(phone, DefaultPhoneRegion())
+	if err != nil {
+		return strings.TrimPrefix(phone, "+")
+	}
+	return p.National
+}
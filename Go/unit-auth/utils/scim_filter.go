@@ -0,0 +1,450 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScimFilter SCIM 过滤表达式（RFC 7644 3.4.2.2）
+type ScimFilter interface {
+	scimFilter()
+}
+
+// ScimAttrExpr 属性比较：attrPath op value，op 为 pr 时没有 Value
+type ScimAttrExpr struct {
+	Path  string // 小写，已去掉核心 schema 前缀，如 emails.value
+	Op    string // eq ne co sw ew gt ge lt le pr
+	Value interface{}
+}
+
+// ScimLogicalExpr and / or
+type ScimLogicalExpr struct {
+	Op          string
+	Left, Right ScimFilter
+}
+
+// ScimNotExpr not ( filter )
+type ScimNotExpr struct {
+	Expr ScimFilter
+}
+
+// ScimValuePathExpr 多值属性过滤：emails[type eq "work"]
+type ScimValuePathExpr struct {
+	Path   string
+	Filter ScimFilter
+}
+
+func (ScimAttrExpr) scimFilter()      {}
+func (ScimLogicalExpr) scimFilter()   {}
+func (ScimNotExpr) scimFilter()       {}
+func (ScimValuePathExpr) scimFilter() {}
+
+var scimCompareOps = map[string]bool{"eq": true, "ne": true, "co": true, "sw": true, "ew": true, "gt": true, "ge": true, "lt": true, "le": true}
+
+// NormalizeScimAttrPath 属性名不区分大小写；去掉核心 schema 前缀（urn:...:User:userName → username）
+func NormalizeScimAttrPath(path string) string {
+	lower := strings.ToLower(strings.TrimSpace(path))
+	for _, prefix := range []string{"urn:ietf:params:scim:schemas:core:2.0:user:", "urn:ietf:params:scim:schemas:core:2.0:group:"} {
+		if strings.HasPrefix(lower, prefix) {
+			return lower[len(prefix):]
+		}
+	}
+	return lower
+}
+
+type scimToken struct {
+	kind  string // word, string, punct
+	text  string
+	value string // kind 为 string 时的解码值
+}
+
+func tokenizeScimFilter(s string) ([]scimToken, error) {
+	var tokens []scimToken
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '(' || ch == ')' || ch == '[' || ch == ']':
+			tokens = append(tokens, scimToken{kind: "punct", text: string(ch)})
+			i++
+		case ch == '"':
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\\' {
+					j++
+					continue
+				}
+				if s[j] == '"' {
+					break
+				}
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			var value string
+			if err := json.Unmarshal([]byte(s[i:j+1]), &value); err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", i)
+			}
+			tokens = append(tokens, scimToken{kind: "string", text: s[i : j+1], value: value})
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n\r()[]\"", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, scimToken{kind: "word", text: s[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []scimToken
+	pos    int
+}
+
+// ParseScimFilter 解析过滤表达式；优先级 not > and > or，支持括号与 attr[filter]
+func ParseScimFilter(s string) (ScimFilter, error) {
+	tokens, err := tokenizeScimFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+func (p *scimFilterParser) peek() *scimToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *scimFilterParser) peekWord(word string) bool {
+	t := p.peek()
+	return t != nil && t.kind == "word" && strings.EqualFold(t.text, word)
+}
+
+func (p *scimFilterParser) expect(punct string) error {
+	t := p.peek()
+	if t == nil || t.kind != "punct" || t.text != punct {
+		return fmt.Errorf("expected %q", punct)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *scimFilterParser) parseOr() (ScimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = ScimLogicalExpr{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (ScimFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = ScimLogicalExpr{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseUnary() (ScimFilter, error) {
+	if p.peekWord("not") {
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return ScimNotExpr{Expr: inner}, nil
+	}
+	if t := p.peek(); t != nil && t.kind == "punct" && t.text == "(" {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	return p.parseAttr()
+}
+
+func (p *scimFilterParser) parseAttr() (ScimFilter, error) {
+	t := p.peek()
+	if t == nil || t.kind != "word" {
+		return nil, fmt.Errorf("expected attribute path")
+	}
+	p.pos++
+	path := NormalizeScimAttrPath(t.text)
+
+	if next := p.peek(); next != nil && next.kind == "punct" && next.text == "[" {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return ScimValuePathExpr{Path: path, Filter: inner}, nil
+	}
+
+	opTok := p.peek()
+	if opTok == nil || opTok.kind != "word" {
+		return nil, fmt.Errorf("expected operator after %s", path)
+	}
+	op := strings.ToLower(opTok.text)
+	p.pos++
+	if op == "pr" {
+		return ScimAttrExpr{Path: path, Op: op}, nil
+	}
+	if !scimCompareOps[op] {
+		return nil, fmt.Errorf("unsupported operator %q", opTok.text)
+	}
+
+	valTok := p.peek()
+	if valTok == nil {
+		return nil, fmt.Errorf("expected value after %s %s", path, op)
+	}
+	p.pos++
+	if valTok.kind == "string" {
+		return ScimAttrExpr{Path: path, Op: op, Value: valTok.value}, nil
+	}
+	if valTok.kind != "word" {
+		return nil, fmt.Errorf("unexpected %q", valTok.text)
+	}
+	switch strings.ToLower(valTok.text) {
+	case "true":
+		return ScimAttrExpr{Path: path, Op: op, Value: true}, nil
+	case "false":
+		return ScimAttrExpr{Path: path, Op: op, Value: false}, nil
+	case "null":
+		return ScimAttrExpr{Path: path, Op: op, Value: nil}, nil
+	}
+	n, err := strconv.ParseFloat(valTok.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", valTok.text)
+	}
+	return ScimAttrExpr{Path: path, Op: op, Value: n}, nil
+}
+
+// ScimPath PATCH 操作的 path：attr、attr.sub、attr[filter]、attr[filter].sub
+type ScimPath struct {
+	Attr   string // 小写
+	Filter ScimFilter
+	Sub    string // 小写
+}
+
+// ParseScimPath 解析 PATCH path
+func ParseScimPath(path string) (*ScimPath, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	out := &ScimPath{}
+	if open := strings.Index(path, "["); open >= 0 {
+		closeIdx := strings.LastIndex(path, "]")
+		if closeIdx < open {
+			return nil, fmt.Errorf("unbalanced brackets in path")
+		}
+		f, err := ParseScimFilter(path[open+1 : closeIdx])
+		if err != nil {
+			return nil, err
+		}
+		out.Attr = NormalizeScimAttrPath(path[:open])
+		out.Filter = f
+		rest := path[closeIdx+1:]
+		if rest != "" {
+			if !strings.HasPrefix(rest, ".") || len(rest) == 1 {
+				return nil, fmt.Errorf("invalid path %q", path)
+			}
+			out.Sub = strings.ToLower(rest[1:])
+		}
+		return out, nil
+	}
+	normalized := NormalizeScimAttrPath(path)
+	// urn 前缀已去掉后剩余的点分隔为子属性
+	if dot := strings.Index(normalized, "."); dot >= 0 && !strings.HasPrefix(normalized, "urn:") {
+		out.Attr, out.Sub = normalized[:dot], normalized[dot+1:]
+	} else {
+		out.Attr = normalized
+	}
+	return out, nil
+}
+
+// MatchScimFilter 在内存中对 JSON 对象求值（PATCH 的 attr[filter]），属性名与字符串比较不区分大小写
+func MatchScimFilter(f ScimFilter, obj map[string]interface{}) bool {
+	switch x := f.(type) {
+	case ScimLogicalExpr:
+		if x.Op == "and" {
+			return MatchScimFilter(x.Left, obj) && MatchScimFilter(x.Right, obj)
+		}
+		return MatchScimFilter(x.Left, obj) || MatchScimFilter(x.Right, obj)
+	case ScimNotExpr:
+		return !MatchScimFilter(x.Expr, obj)
+	case ScimValuePathExpr:
+		for _, item := range scimLookupList(obj, x.Path) {
+			if m, ok := item.(map[string]interface{}); ok && MatchScimFilter(x.Filter, m) {
+				return true
+			}
+		}
+		return false
+	case ScimAttrExpr:
+		v, found := scimLookup(obj, x.Path)
+		if x.Op == "pr" {
+			return found && v != nil && v != ""
+		}
+		return compareScimValue(v, x.Op, x.Value)
+	}
+	return false
+}
+
+func scimLookup(obj map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = obj
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		found := false
+		for k, v := range m {
+			if strings.EqualFold(k, part) {
+				cur, found = v, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func scimLookupList(obj map[string]interface{}, path string) []interface{} {
+	v, _ := scimLookup(obj, path)
+	list, _ := v.([]interface{})
+	return list
+}
+
+func compareScimValue(actual interface{}, op string, expected interface{}) bool {
+	switch e := expected.(type) {
+	case nil:
+		if op == "eq" {
+			return actual == nil
+		}
+		if op == "ne" {
+			return actual != nil
+		}
+		return false
+	case bool:
+		a, ok := actual.(bool)
+		if op == "eq" {
+			return ok && a == e
+		}
+		if op == "ne" {
+			return !ok || a != e
+		}
+		return false
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return op == "ne"
+		}
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+		return false
+	case string:
+		a, ok := actual.(string)
+		if !ok {
+			return op == "ne"
+		}
+		// 时间按时间比较，其余按不区分大小写的字符串比较
+		if at, err := time.Parse(time.RFC3339, a); err == nil {
+			if et, err := time.Parse(time.RFC3339, e); err == nil {
+				return compareOrdered(at.Compare(et), op)
+			}
+		}
+		al, el := strings.ToLower(a), strings.ToLower(e)
+		switch op {
+		case "co":
+			return strings.Contains(al, el)
+		case "sw":
+			return strings.HasPrefix(al, el)
+		case "ew":
+			return strings.HasSuffix(al, el)
+		}
+		return compareOrdered(strings.Compare(al, el), op)
+	}
+	return false
+}
+
+func compareOrdered(cmp int, op string) bool {
+	switch op {
+	case "eq":
+		return cmp == 0
+	case "ne":
+		return cmp != 0
+	case "gt":
+		return cmp > 0
+	case "ge":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "le":
+		return cmp <= 0
+	}
+	return false
+}